@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/materials-commons/hydra/pkg/mcdb/filewalk"
+	"github.com/spf13/cobra"
+)
+
+// backfillFlags are the flags shared by the backfill commands.
+type backfillFlags struct {
+	projectID   int
+	batchSize   int
+	maxDuration time.Duration
+	dryRun      bool
+	json        bool
+	every       time.Duration
+}
+
+func (f *backfillFlags) register(cmd *cobra.Command, dryRunUsage string) {
+	cmd.Flags().IntVar(&f.projectID, "project", 0, "Only backfill this project (default all projects)")
+	cmd.Flags().IntVar(&f.batchSize, "batch", 0, "Number of files to load from the database at a time")
+	cmd.Flags().DurationVar(&f.maxDuration, "max-duration", 0, "Stop after running this long (default no limit)")
+	cmd.Flags().BoolVar(&f.dryRun, "dry-run", false, dryRunUsage)
+	cmd.Flags().BoolVar(&f.json, "json", false, "Print the report as JSON")
+	cmd.Flags().DurationVar(&f.every, "every", 0, "Keep running, backfilling once per interval")
+}
+
+func (f *backfillFlags) options() filewalk.Options {
+	return filewalk.Options{
+		ProjectID:   f.projectID,
+		BatchSize:   f.batchSize,
+		MaxDuration: f.maxDuration,
+		DryRun:      f.dryRun,
+	}
+}
+
+// run calls runOnce, or with --every calls runEvery, which keeps backfilling until interrupted.
+func (f *backfillFlags) run(job string, runOnce func() error, runEvery func(ctx context.Context, interval time.Duration)) {
+	if f.every != 0 {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		runEvery(ctx, f.every)
+		return
+	}
+
+	if err := runOnce(); err != nil {
+		log.Fatalf("%s failed: %s", job, err)
+	}
+}
+
+// printReport prints the report of a backfill, whose part common to every backfill is walk. With --json
+// the whole report is printed as JSON, otherwise its problems are printed followed by summary.
+func (f *backfillFlags) printReport(report interface{}, walk *filewalk.Report, summary ...string) {
+	if f.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+		return
+	}
+
+	for _, problem := range walk.Problems {
+		detail := problem.Error
+		if problem.Expected != "" || problem.Actual != "" {
+			detail = fmt.Sprintf("expected %s, got %s", problem.Expected, problem.Actual)
+		}
+		fmt.Printf("File %d (%s): %s %s\n", problem.FileID, problem.BlobKey, problem.Kind, detail)
+	}
+
+	for _, line := range summary {
+		fmt.Println(line)
+	}
+
+	if !walk.Complete {
+		fmt.Println("Stopped before every file was checked, run again to continue")
+	}
+	if walk.DryRun {
+		fmt.Println("Dry run, nothing was stored")
+	}
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/mime/backfill"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mimeBackfillFlags backfillFlags
+	mimeBackfillAll   bool
+)
+
+var backfillMimeCmd = &cobra.Command{
+	Use:   "backfill-mime",
+	Short: "Detect the type of files from their contents",
+	Long: `Reads the start of the blob for every file (or every file in --project) that has a generic type,
+such as application/octet-stream or unknown, and detects its type again from its name and contents.
+With --all every file is re-detected. Formats beyond the built-in ones can be configured with a JSON
+file named by MC_MIME_FORMATS. The file type counts in the project stats are updated the next time
+the stats are rebuilt. With --every the backfill keeps running, once per interval, until interrupted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		db, mcfsDir := mustLoadEnv()
+		blobs := blobstore.MustFromEnv(mcfsDir)
+		fileStor := stor.NewGormFileStorWithBlobStore(db, mcfsDir, blobs)
+		backfiller := backfill.NewBackfiller(fileStor, blobs)
+		opts := backfill.Options{Options: mimeBackfillFlags.options(), All: mimeBackfillAll}
+
+		mimeBackfillFlags.run("MIME type backfill", func() error {
+			report, err := backfiller.Run(opts)
+			if report != nil {
+				mimeBackfillFlags.printReport(report, &report.Report, mimeBackfillSummary(report)...)
+			}
+			return err
+		}, func(ctx context.Context, interval time.Duration) {
+			backfiller.RunEvery(ctx, interval, opts)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backfillMimeCmd)
+	mimeBackfillFlags.register(backfillMimeCmd, "Detect types without storing them")
+	backfillMimeCmd.Flags().BoolVar(&mimeBackfillAll, "all", false, "Re-detect every file, not just those with a generic type")
+}
+
+// mimeBackfillSummary lists the number of files changed to each type, followed by the totals.
+func mimeBackfillSummary(report *backfill.Report) []string {
+	mimeTypes := make([]string, 0, len(report.Types))
+	for mimeType := range report.Types {
+		mimeTypes = append(mimeTypes, mimeType)
+	}
+	sort.Strings(mimeTypes)
+
+	var lines []string
+	for _, mimeType := range mimeTypes {
+		lines = append(lines, fmt.Sprintf("%s: %d", mimeType, report.Types[mimeType]))
+	}
+
+	return append(lines, fmt.Sprintf("Checked %d files: %d changed, %d missing, %d errors",
+		report.FilesChecked, report.Changed, report.Missing, report.Errors))
+}
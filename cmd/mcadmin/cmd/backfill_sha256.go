@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest/backfill"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/spf13/cobra"
+)
+
+var sha256BackfillFlags backfillFlags
+
+var backfillSha256Cmd = &cobra.Command{
+	Use:   "backfill-sha256",
+	Short: "Compute the SHA-256 for files uploaded before it was stored",
+	Long: `Reads the blob for every file (or every file in --project) that doesn't have a SHA-256 yet,
+verifies it against the stored MD5 checksum and records its SHA-256. Files without an MD5, or whose
+blob is missing or doesn't match its MD5, are reported and skipped. Files already filled in are not
+read again, so a backfill stopped by --max-duration carries on where it left off on the next run.
+With --every the backfill keeps running, once per interval, until interrupted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		db, mcfsDir := mustLoadEnv()
+		blobs := blobstore.MustFromEnv(mcfsDir)
+		fileStor := stor.NewGormFileStorWithBlobStore(db, mcfsDir, blobs)
+		backfiller := backfill.NewBackfiller(fileStor, blobs)
+		opts := sha256BackfillFlags.options()
+
+		sha256BackfillFlags.run("SHA-256 backfill", func() error {
+			report, err := backfiller.Run(opts)
+			if report != nil {
+				sha256BackfillFlags.printReport(report, &report.Report,
+					fmt.Sprintf("Checked %d files: %d backfilled, %d without a checksum, %d missing, %d mismatched, %d errors",
+						report.FilesChecked, report.Backfilled, report.NoChecksum, report.Missing, report.Mismatched, report.Errors))
+			}
+			return err
+		}, func(ctx context.Context, interval time.Duration) {
+			backfiller.RunEvery(ctx, interval, opts)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backfillSha256Cmd)
+	sha256BackfillFlags.register(backfillSha256Cmd, "Compute and verify checksums without storing them")
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/datasetexport"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportDatasetID int
+	exportFormat    string
+	exportOut       string
+)
+
+var exportDatasetCmd = &cobra.Command{
+	Use:   "export-dataset",
+	Short: "Export a dataset as a BagIt bag or an RO-Crate",
+	Long: `Writes the dataset's files, along with metadata describing the dataset, its samples, the processes
+performed on them and their attributes, to --out. With --format ro-crate the metadata is written to
+ro-crate-metadata.json next to the files. With --format bagit the RO-Crate is the payload of a BagIt bag
+with SHA-256 and MD5 manifests. --out must not exist or must be empty. Exporting the same dataset twice
+produces identical output.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if exportDatasetID == 0 || exportOut == "" {
+			log.Fatalf("--dataset and --out are required")
+		}
+
+		db, mcfsDir := mustLoadEnv()
+		blobs := blobstore.MustFromEnv(mcfsDir)
+		exporter := datasetexport.NewExporter(stor.NewGormDatasetStor(db), blobs)
+
+		report, err := exporter.Export(exportDatasetID, exportFormat, exportOut)
+		if err != nil {
+			log.Fatalf("Export of dataset %d failed: %s", exportDatasetID, err)
+		}
+
+		fmt.Printf("Exported dataset %d as %s to %s: %d files, %d bytes\n",
+			report.DatasetID, report.Format, report.Dir, report.FileCount, report.TotalSize)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportDatasetCmd)
+	exportDatasetCmd.Flags().IntVar(&exportDatasetID, "dataset", 0, "Id of the dataset to export")
+	exportDatasetCmd.Flags().StringVar(&exportFormat, "format", datasetexport.FormatBagIt, "Export format, bagit or ro-crate")
+	exportDatasetCmd.Flags().StringVar(&exportOut, "out", "", "Directory to write the export to")
+}
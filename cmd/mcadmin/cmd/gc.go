@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/materials-commons/hydra/pkg/blobgc"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcGracePeriod time.Duration
+	gcDryRun      bool
+	gcJSON        bool
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Find and remove blobs that no file references",
+	Long: `Walks every blob under MCFS_DIR (or the configured blob store) and cross references it
+against the files table. Blobs that no file points at, either by uuid or uses_uuid, and that are
+older than the grace period are removed. Blobs that an in-progress upload is writing to are never
+removed. Use --dry-run to only report what would be removed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		db, mcfsDir := mustLoadEnv()
+		blobs := blobstore.MustFromEnv(mcfsDir)
+		stors := stor.NewGormStorsWithBlobStore(db, mcfsDir, blobs)
+
+		report, err := blobgc.NewCollector(blobs, stors).Run(blobgc.Options{
+			GracePeriod: gcGracePeriod,
+			DryRun:      gcDryRun,
+		})
+
+		if report != nil {
+			printGCReport(report)
+		}
+
+		if err != nil {
+			log.Fatalf("Garbage collection failed: %s", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+	gcCmd.Flags().DurationVar(&gcGracePeriod, "grace", blobgc.DefaultGracePeriod, "Only collect blobs older than this")
+	gcCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "Report orphaned blobs without removing them")
+	gcCmd.Flags().BoolVar(&gcJSON, "json", false, "Print the report as JSON")
+}
+
+func printGCReport(report *blobgc.Report) {
+	if gcJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+		return
+	}
+
+	if len(report.Orphans) != 0 {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header([]string{"Key", "Size", "Modified", "Deleted", "Error"})
+		for _, orphan := range report.Orphans {
+			_ = table.Append([]string{
+				orphan.Key,
+				fmt.Sprintf("%d", orphan.Size),
+				orphan.ModTime.Format(time.RFC3339),
+				fmt.Sprintf("%t", orphan.Deleted),
+				orphan.Error,
+			})
+		}
+		_ = table.Render()
+	}
+
+	fmt.Printf("Scanned %d blobs: %d referenced, %d protected by uploads, %d within grace period\n",
+		report.Scanned, report.Referenced, report.Protected, report.SkippedGrace)
+	fmt.Printf("Orphaned: %d blobs, %d bytes\n", len(report.Orphans), report.OrphanBytes)
+	if report.DryRun {
+		fmt.Println("Dry run, nothing was removed")
+	} else {
+		fmt.Printf("Removed: %d blobs, %d bytes\n", report.Deleted, report.DeletedBytes)
+	}
+}
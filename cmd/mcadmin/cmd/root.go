@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/apex/log"
+	"github.com/materials-commons/hydra/pkg/mcdb"
+	"github.com/spf13/cobra"
+	"github.com/subosito/gotenv"
+	"gorm.io/gorm"
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "mcadmin",
+	Short: "Administrative tasks for a Materials Commons installation",
+	Long:  `Administrative tasks, such as garbage collecting blobs, that run against the database and MCFS_DIR.`,
+}
+
+// Execute adds all child commands to the root command and sets flags appropriately.
+// This is called by main.main(). It only needs to happen once to the rootCmd.
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// mustLoadEnv loads the configuration pointed at by MC_DOTENV_PATH, connects to the database and
+// returns the database along with MCFS_DIR.
+func mustLoadEnv() (*gorm.DB, string) {
+	dotenvFilePath := os.Getenv("MC_DOTENV_PATH")
+	if dotenvFilePath == "" {
+		log.Fatalf("MC_DOTENV_PATH not set or blank")
+	}
+
+	if err := gotenv.Load(dotenvFilePath); err != nil {
+		log.Fatalf("Failed loading configuration file %s: %s", dotenvFilePath, err)
+	}
+
+	mcfsDir := os.Getenv("MCFS_DIR")
+	if mcfsDir == "" {
+		log.Fatalf("MCFS_DIR not set or blank")
+	}
+
+	return mcdb.MustConnectToDB(), mcfsDir
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/materials-commons/hydra/pkg/scrub"
+	"github.com/spf13/cobra"
+)
+
+var (
+	scrubProjectID      int
+	scrubBytesPerSecond int64
+	scrubStateFile      string
+	scrubReportFile     string
+	scrubMaxDuration    time.Duration
+	scrubDryRun         bool
+)
+
+var scrubCmd = &cobra.Command{
+	Use:   "scrub",
+	Short: "Verify file contents against their checksums and update file health",
+	Long: `Re-hashes the blob for every file (or every file in --project) and compares it against the
+checksum and size in the files table. Missing or corrupted files are marked as missing, and files
+marked missing whose blob checks out again are marked fixed. Progress is saved to --state so a
+scrub that is stopped, or that hits --max-duration, resumes on the next run.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		db, mcfsDir := mustLoadEnv()
+		blobs := blobstore.MustFromEnv(mcfsDir)
+		fileStor := stor.NewGormFileStorWithBlobStore(db, mcfsDir, blobs)
+
+		report, err := scrub.NewScrubber(fileStor, blobs).Run(scrub.Options{
+			ProjectID:      scrubProjectID,
+			BytesPerSecond: scrubBytesPerSecond,
+			StateFile:      scrubStateFile,
+			MaxDuration:    scrubMaxDuration,
+			DryRun:         scrubDryRun,
+		})
+
+		if report != nil {
+			writeScrubReport(report)
+		}
+
+		if err != nil {
+			log.Fatalf("Scrub failed: %s", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scrubCmd)
+	scrubCmd.Flags().IntVar(&scrubProjectID, "project", 0, "Only scrub this project (default all projects)")
+	scrubCmd.Flags().Int64Var(&scrubBytesPerSecond, "bytes-per-second", 0, "Limit how fast blobs are read (default no limit)")
+	scrubCmd.Flags().StringVar(&scrubStateFile, "state", "", "File to save progress to, so the scrub can resume")
+	scrubCmd.Flags().StringVar(&scrubReportFile, "report", "", "File to write the JSON report to (default stdout)")
+	scrubCmd.Flags().DurationVar(&scrubMaxDuration, "max-duration", 0, "Stop after running this long (default no limit)")
+	scrubCmd.Flags().BoolVar(&scrubDryRun, "dry-run", false, "Report problems without updating file health")
+}
+
+func writeScrubReport(report *scrub.Report) {
+	out := os.Stdout
+	if scrubReportFile != "" {
+		f, err := os.Create(scrubReportFile)
+		if err != nil {
+			log.Fatalf("Unable to create report file %s: %s", scrubReportFile, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Errorf("Unable to write report: %s", err)
+	}
+
+	if scrubReportFile != "" {
+		fmt.Printf("Checked %d files: %d missing, %d corrupted, %d restored, %d errors (complete: %t)\n",
+			report.FilesChecked, report.Missing, report.Corrupted, report.Restored, report.Errors, report.Complete)
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/materials-commons/hydra/pkg/projectstats"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statsProjectID int
+	statsDryRun    bool
+	statsJSON      bool
+	statsEvery     time.Duration
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Rebuild project size, counts and file types from the files table",
+	Long: `Derives the size, file count, directory count and file type histogram for every project (or
+the project given by --project) from the files table, reports any that differ from the values stored
+on the project, and corrects them. Use --dry-run to only report the differences. With --every the
+rebuild keeps running, once per interval, until interrupted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		db, _ := mustLoadEnv()
+		rebuilder := projectstats.NewRebuilder(stor.NewGormProjectStor(db))
+		opts := projectstats.Options{ProjectID: statsProjectID, DryRun: statsDryRun}
+
+		if statsEvery != 0 {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			rebuilder.RunEvery(ctx, statsEvery, opts)
+			return
+		}
+
+		report, err := rebuilder.Run(opts)
+		if err != nil {
+			log.Fatalf("Rebuilding project statistics failed: %s", err)
+		}
+
+		printStatsReport(report)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+	statsCmd.Flags().IntVar(&statsProjectID, "project", 0, "Only rebuild this project (default all projects)")
+	statsCmd.Flags().BoolVar(&statsDryRun, "dry-run", false, "Report differences without correcting them")
+	statsCmd.Flags().BoolVar(&statsJSON, "json", false, "Print the report as JSON")
+	statsCmd.Flags().DurationVar(&statsEvery, "every", 0, "Keep running, rebuilding once per interval")
+}
+
+func printStatsReport(report *projectstats.Report) {
+	if statsJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+		return
+	}
+
+	if len(report.Projects) != 0 {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header([]string{"Project", "Field", "Stored", "Computed"})
+		for _, projectReport := range report.Projects {
+			for _, diff := range projectReport.Diffs {
+				_ = table.Append([]string{
+					fmt.Sprintf("%d", projectReport.ProjectID),
+					diff.Field,
+					diff.Stored,
+					diff.Computed,
+				})
+			}
+		}
+		_ = table.Render()
+	}
+
+	for _, projectErr := range report.Errors {
+		fmt.Printf("Project %d: %s\n", projectErr.ProjectID, projectErr.Error)
+	}
+
+	fmt.Printf("Checked %d projects: %d differed, %d errors\n",
+		report.ProjectsChecked, report.ProjectsDiffering, len(report.Errors))
+	if report.DryRun {
+		fmt.Println("Dry run, nothing was corrected")
+	} else {
+		fmt.Printf("Corrected: %d projects\n", report.ProjectsCorrected)
+	}
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/materials-commons/hydra/pkg/blobgc"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var trashDryRun bool
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "List, restore and purge deleted project files",
+}
+
+var trashListCmd = &cobra.Command{
+	Use:   "list <project-id>",
+	Short: "List the entries in a project's trash",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db, mcfsDir := mustLoadEnv()
+		fileStor := stor.NewGormFileStor(db, mcfsDir)
+
+		entries, err := fileStor.ListTrash(mustAtoi(args[0]))
+		if err != nil {
+			log.Fatalf("Unable to list trash: %s", err)
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header([]string{"ID", "Path", "Type", "Size", "Deleted"})
+		for _, entry := range entries {
+			kind := "file"
+			if entry.IsDir() {
+				kind = "directory"
+			}
+			_ = table.Append([]string{
+				strconv.Itoa(entry.ID),
+				entry.FullPath(),
+				kind,
+				fmt.Sprintf("%d", entry.Size),
+				entry.DeletedAt.Format(time.RFC3339),
+			})
+		}
+		_ = table.Render()
+	},
+}
+
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore <file-id>",
+	Short: "Restore a trash entry to its original location",
+	Long: `Restores a file, or a directory and everything deleted with it, to its original location. If
+the original directory no longer exists it is recreated, and if the name is taken the restored entry
+is renamed, e.g. "file (1).txt".`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db, mcfsDir := mustLoadEnv()
+		fileStor := stor.NewGormFileStor(db, mcfsDir)
+
+		restored, err := fileStor.RestoreFromTrash(mustGetTrashEntry(fileStor, args[0]))
+		if err != nil {
+			log.Fatalf("Unable to restore %s: %s", args[0], err)
+		}
+
+		fmt.Printf("Restored to %s\n", restored.FullPath())
+	},
+}
+
+var trashPurgeCmd = &cobra.Command{
+	Use:   "purge <file-id>",
+	Short: "Permanently remove a trash entry and the blobs only it used",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db, mcfsDir := mustLoadEnv()
+		blobs := blobstore.MustFromEnv(mcfsDir)
+		stors := stor.NewGormStorsWithBlobStore(db, mcfsDir, blobs)
+
+		entry := mustGetTrashEntry(stors.FileStor, args[0])
+		if trashDryRun {
+			fmt.Printf("Would purge %s\n", entry.FullPath())
+			return
+		}
+
+		uuids, err := stors.FileStor.PurgeFromTrash(entry)
+		if err != nil {
+			log.Fatalf("Unable to purge %s: %s", args[0], err)
+		}
+
+		report, err := blobgc.NewCollector(blobs, stors).CollectUUIDs(uuids, blobgc.Options{})
+		if err != nil {
+			log.Fatalf("Purged %s but collecting its blobs failed, run 'mcadmin gc' to clean up: %s", entry.FullPath(), err)
+		}
+
+		fmt.Printf("Purged %s, removed %d blobs (%d bytes)\n", entry.FullPath(), report.Deleted, report.DeletedBytes)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(trashCmd)
+	trashCmd.AddCommand(trashListCmd, trashRestoreCmd, trashPurgeCmd)
+	trashPurgeCmd.Flags().BoolVar(&trashDryRun, "dry-run", false, "Show what would be purged without removing it")
+}
+
+func mustGetTrashEntry(fileStor stor.FileStor, id string) *mcmodel.File {
+	entry, err := fileStor.GetFileByID(mustAtoi(id))
+	if err != nil {
+		log.Fatalf("Unable to find file %s: %s", id, err)
+	}
+
+	if entry.DeletedAt.IsZero() {
+		log.Fatalf("File %s is not in the trash", id)
+	}
+
+	return entry
+}
+
+func mustAtoi(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		log.Fatalf("Invalid id %q: %s", s, err)
+	}
+	return n
+}
@@ -0,0 +1,7 @@
+package main
+
+import "github.com/materials-commons/hydra/cmd/mcadmin/cmd"
+
+func main() {
+	cmd.Execute()
+}
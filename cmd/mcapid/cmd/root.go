@@ -9,7 +9,9 @@ import (
 	"github.com/apex/log"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/materials-commons/hydra/pkg/blobstore"
 	"github.com/materials-commons/hydra/pkg/config"
+	"github.com/materials-commons/hydra/pkg/mcapid/webapi/apimiddleware"
 	"github.com/materials-commons/hydra/pkg/mcdb"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 	"github.com/spf13/cobra"
@@ -33,14 +35,16 @@ var rootCmd = &cobra.Command{
 		log.Infof("MCFS Dir: %s", mcfsDir)
 
 		// Initialize all the storage interfaces
-		stors := stor.NewGormStors(db, mcfsDir)
+		stors := stor.NewGormStorsWithBlobStore(db, mcfsDir, blobstore.MustFromEnv(mcfsDir))
 
 		// Setup internal and external routes
 		setupInternalRoutes(e, RouteOpts{
 			fileStor: stors.FileStor,
 		})
 
-		setupExternalRoutes(e, *stors)
+		// Site admins are listed by email in MCAPID_SITE_ADMINS. They manage user quotas.
+		siteAdmins := apimiddleware.ParseSiteAdmins(c.GetKeyWithDefault("MCAPID_SITE_ADMINS", ""))
+		setupExternalRoutes(e, *stors, mcfsDir, siteAdmins)
 
 		if err := e.Start(":" + c.GetKeyWithDefault("MCAPID_PORT", "1352")); err != nil {
 			log.Fatalf("Unable to start server: %v", err)
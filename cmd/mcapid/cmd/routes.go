@@ -3,9 +3,13 @@ package cmd
 import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/materials-commons/hydra/pkg/apitoken"
+	"github.com/materials-commons/hydra/pkg/authz"
+	"github.com/materials-commons/hydra/pkg/datasetzip"
 	"github.com/materials-commons/hydra/pkg/mcapid/webapi"
 	"github.com/materials-commons/hydra/pkg/mcapid/webapi/apimiddleware"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/materials-commons/hydra/pkg/provenance"
 )
 
 type RouteOpts struct {
@@ -22,18 +26,18 @@ func setupInternalRoutes(e *echo.Echo, opts RouteOpts) {
 
 }
 
-func setupExternalRoutes(e *echo.Echo, stors stor.Stors) {
-	userCache := apimiddleware.NewAPIKeyCache(stors.UserStor)
+func setupExternalRoutes(e *echo.Echo, stors stor.Stors, mcfsDir string, siteAdmins apimiddleware.SiteAdmins) {
+	authenticator := apitoken.NewAuthenticator(stors.UserStor, stors.APITokenStor, apitoken.DefaultCacheTTL)
 	apikeyConfig := apimiddleware.APIKeyConfig{
-		Skipper:         middleware.DefaultSkipper,
-		Keyname:         "apikey",
-		GetUserByAPIKey: userCache.GetUserByAPIKey,
+		Skipper:      middleware.DefaultSkipper,
+		Keyname:      "apikey",
+		Authenticate: authenticator.Authenticate,
 	}
 
 	projectAccessCache := apimiddleware.NewProjectAccessCache(stors.ProjectStor)
 	projectAccessConfig := apimiddleware.ProjectAccessConfig{
-		Skipper:            middleware.DefaultSkipper,
-		HasAccessToProject: projectAccessCache.HasAccessToProject,
+		Skipper:        middleware.DefaultSkipper,
+		GetProjectRole: projectAccessCache.GetProjectRole,
 	}
 
 	// Add the resumable upload controller for unlimited, restartable file uploads
@@ -42,10 +46,83 @@ func setupExternalRoutes(e *echo.Echo, stors stor.Stors) {
 	resumableUploadGroup.Use(apimiddleware.APIKeyAuth(apikeyConfig))
 	resumableUploadGroup.Use(apimiddleware.ProjectAccessAuth(projectAccessConfig))
 
-	resumableUploadGroup.POST("/start", resumableUploadController.StartUpload)
-	resumableUploadGroup.POST("/upload-chunk", resumableUploadController.UploadChunk)
-	resumableUploadGroup.POST("/finalize", resumableUploadController.FinalizeUpload)
-	resumableUploadGroup.GET("/status", resumableUploadController.GetUploadStatus)
+	// Every project route says whether it reads or writes, which checks both the user's role and the
+	// scope of the API token. Checking on an upload is part of uploading, so it needs write access.
+	canRead := apimiddleware.RequireProjectRole(authz.Viewer)
+	canWrite := apimiddleware.RequireProjectRole(authz.Contributor)
+	resumableUploadGroup.POST("/start", resumableUploadController.StartUpload, canWrite)
+	resumableUploadGroup.POST("/upload-chunk", resumableUploadController.UploadChunk, canWrite)
+	resumableUploadGroup.POST("/finalize", resumableUploadController.FinalizeUpload, canWrite)
+	resumableUploadGroup.GET("/status", resumableUploadController.GetUploadStatus, canWrite)
+
+	// File version history
+	fileVersionGroup := e.Group("/file-versions")
+	fileVersionController := webapi.NewFileVersionController(stors.FileStor)
+	fileVersionGroup.Use(apimiddleware.APIKeyAuth(apikeyConfig))
+	fileVersionGroup.Use(apimiddleware.ProjectAccessAuth(projectAccessConfig))
+
+	fileVersionGroup.GET("", fileVersionController.ListVersions, canRead)
+	fileVersionGroup.POST("/promote", fileVersionController.PromoteVersion, canWrite)
+	fileVersionGroup.GET("/diff", fileVersionController.DiffVersions, canRead)
+
+	// Dataset zip archives
+	datasetGroup := e.Group("/datasets")
+	datasetZipBuilder := datasetzip.NewBuilder(stors.DatasetStor, stors.FileStor.Blobs(), mcfsDir)
+	datasetZipController := webapi.NewDatasetZipController(stors.DatasetStor, datasetZipBuilder)
+	datasetGroup.Use(apimiddleware.APIKeyAuth(apikeyConfig))
+	datasetGroup.Use(apimiddleware.ProjectAccessAuth(projectAccessConfig))
+
+	// Building an archive writes it under MCFS_DIR, so it needs write access.
+	datasetGroup.POST("/zip", datasetZipController.BuildZip, canWrite)
+	datasetGroup.GET("/zip/status", datasetZipController.GetZipStatus, canRead)
+
+	datasetSelectionController := webapi.NewDatasetSelectionController(stors.DatasetStor)
+	datasetGroup.POST("/selection/preview", datasetSelectionController.PreviewSelection, canRead)
+
+	datasetMetadataController := webapi.NewDatasetMetadataController(stors.DatasetStor)
+	datasetGroup.GET("/metadata/datacite", datasetMetadataController.GetDataCite, canRead)
+	datasetGroup.GET("/metadata/schema-org", datasetMetadataController.GetSchemaOrg, canRead)
+	datasetGroup.GET("/metadata/validate", datasetMetadataController.ValidateMetadata, canRead)
+
+	// Provenance (lineage) of samples and files
+	provenanceGroup := e.Group("/provenance")
+	provenanceService := provenance.NewService(stors.EntityStor, stors.ActivityStor, stors.FileStor)
+	provenanceController := webapi.NewProvenanceController(provenanceService)
+	provenanceGroup.Use(apimiddleware.APIKeyAuth(apikeyConfig))
+	provenanceGroup.Use(apimiddleware.ProjectAccessAuth(projectAccessConfig))
+
+	provenanceGroup.GET("/samples", provenanceController.GetSampleLineage, canRead)
+	provenanceGroup.GET("/files", provenanceController.GetFileLineage, canRead)
+
+	// Scoped API tokens for automation
+	apiTokenGroup := e.Group("/api-tokens")
+	apiTokenController := webapi.NewAPITokenController(stors.APITokenStor, stors.ProjectStor, authenticator)
+	apiTokenGroup.Use(apimiddleware.APIKeyAuth(apikeyConfig))
+
+	apiTokenGroup.POST("", apiTokenController.CreateToken)
+	apiTokenGroup.GET("", apiTokenController.ListTokens)
+	apiTokenGroup.DELETE("/:id", apiTokenController.RevokeToken)
+
+	// Storage quotas. Project quotas are managed by the project's admins, user quotas by the site admins.
+	quotaController := webapi.NewQuotaController(stors.QuotaStor)
+	projectQuotaGroup := e.Group("/quotas/projects")
+	projectQuotaGroup.Use(apimiddleware.APIKeyAuth(apikeyConfig))
+	projectQuotaGroup.Use(apimiddleware.ProjectAccessAuth(apimiddleware.ProjectAccessConfig{
+		Skipper:        middleware.DefaultSkipper,
+		GetProjectRole: projectAccessCache.GetProjectRole,
+		ProjectIDParam: "id",
+	}))
+
+	canAdmin := apimiddleware.RequireProjectRole(authz.Admin)
+	projectQuotaGroup.GET("/:id", quotaController.GetProjectQuota, canRead)
+	projectQuotaGroup.PUT("/:id", quotaController.SetProjectQuota, canAdmin)
+
+	userQuotaGroup := e.Group("/quotas/users")
+	userQuotaGroup.Use(apimiddleware.APIKeyAuth(apikeyConfig))
+	userQuotaGroup.Use(apimiddleware.RequireSiteAdmin(siteAdmins))
+
+	userQuotaGroup.GET("/:id", quotaController.GetUserQuota)
+	userQuotaGroup.PUT("/:id", quotaController.SetUserQuota)
 
 	//g := e.Group("/transfers")
 	//g.Use(apimiddleware.APIKeyAuth(apikeyConfig))
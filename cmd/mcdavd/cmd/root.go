@@ -7,6 +7,7 @@ import (
 	"github.com/apex/log"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/materials-commons/hydra/pkg/blobstore"
 	"github.com/materials-commons/hydra/pkg/mcdav"
 	"github.com/materials-commons/hydra/pkg/mcdav/fs"
 	"github.com/materials-commons/hydra/pkg/mcdav/webapi"
@@ -32,6 +33,8 @@ var rootCmd = &cobra.Command{
 		}
 
 		db := mcdb.MustConnectToDB()
+		mcfsDir := os.Getenv("MCFS_DIR")
+		blobs := blobstore.MustFromEnv(mcfsDir)
 		userStor := stor.NewGormUserStor(db)
 		users := mcdav.NewUsers(userStor)
 
@@ -58,10 +61,11 @@ var rootCmd = &cobra.Command{
 
 			if userEntry.Server == nil {
 				userFS := fs.NewUserFS(&fs.UserFSOpts{
-					MCFSRoot:       os.Getenv("MCFS_DIR"),
+					MCFSRoot:       mcfsDir,
 					ProjectStor:    stor.NewGormProjectStor(db),
-					FileStor:       stor.NewGormFileStor(db, os.Getenv("MCFS_DIR")),
+					FileStor:       stor.NewGormFileStorWithBlobStore(db, mcfsDir, blobs),
 					ConversionStor: stor.NewGormConversionStor(db),
+					QuotaStor:      stor.NewGormQuotaStor(db),
 					User:           userEntry.User,
 				})
 
@@ -11,6 +11,7 @@ import (
 	"github.com/apex/log"
 	"github.com/hanwen/go-fuse/v2/fuse"
 	"github.com/labstack/echo/v4"
+	"github.com/materials-commons/hydra/pkg/blobstore"
 	"github.com/materials-commons/hydra/pkg/config"
 	"github.com/materials-commons/hydra/pkg/globus"
 	"github.com/materials-commons/hydra/pkg/mcdb"
@@ -50,7 +51,7 @@ func Run(c context.Context, args []string, config config.Configer) error {
 	log.Infof("MCFS Dir: %s", mcfsDir)
 
 	db := mcdb.MustConnectToDB()
-	stors := stor.NewGormStors(db, mcfsDir)
+	stors := stor.NewGormStorsWithBlobStore(db, mcfsDir, blobstore.MustFromEnv(mcfsDir))
 	fsState := fsstate.NewFSState(fsstate.NewTransferStateTracker(),
 		fsstate.NewTransferRequestCache(stors.TransferRequestStor),
 		fsstate.NewActivityTracker())
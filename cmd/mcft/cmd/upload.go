@@ -16,7 +16,6 @@ package cmd
 
 import (
 	"bytes"
-	"crypto/md5"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -30,6 +29,7 @@ import (
 
 	"github.com/apex/log"
 	"github.com/gorilla/websocket"
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/mcft/protocol"
 	"github.com/saracen/walker"
 	"github.com/spf13/cobra"
@@ -184,7 +184,7 @@ func uploadFile(pathToFile, uploadToPath, apiKey string) error {
 
 	data := make([]byte, 32*1024*1024)
 	fb := protocol.FileBlockRequest{}
-	hasher := md5.New()
+	hasher := digest.New()
 	for {
 
 		n, err := f.Read(data)
@@ -224,7 +224,9 @@ func uploadFile(pathToFile, uploadToPath, apiKey string) error {
 
 	// compute checksum and check that they match by sending to the server
 	var finishUploadRequest protocol.FinishUploadRequest
-	finishUploadRequest.FileChecksum = fmt.Sprintf("%x", hasher.Sum(nil))
+	sums := hasher.Sums()
+	finishUploadRequest.FileChecksum = sums.MD5
+	finishUploadRequest.FileSha256 = sums.SHA256
 	finishUploadRequest.Path = uploadToPath
 	incomingReq.RequestType = protocol.FinishUploadReq
 
@@ -20,6 +20,7 @@ import (
 	"os"
 
 	"github.com/gorilla/websocket"
+	"github.com/materials-commons/hydra/pkg/blobstore"
 	"github.com/materials-commons/hydra/pkg/mcdb"
 	"github.com/materials-commons/hydra/pkg/mcft/ft"
 	"github.com/spf13/cobra"
@@ -62,7 +63,7 @@ var rootCmd = &cobra.Command{
 		e.HidePort = true
 		e.Use(middleware.Recover())
 
-		s := mcft.NewServer(e, db)
+		s := mcft.NewServer(e, db, blobstore.MustFromEnv(mcfsDir))
 
 		if err := s.Init(); err != nil {
 			log.Fatalf("Failed to initialize mcftservd: %s", err)
@@ -4,17 +4,22 @@ Copyright © 2026 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/feather-lang/feather"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest/backfill"
 	"github.com/materials-commons/hydra/pkg/mcdb"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 	"github.com/materials-commons/hydra/pkg/mchubd/wserv"
 	"github.com/materials-commons/hydra/pkg/mqld/mql"
+	"github.com/materials-commons/hydra/pkg/projectstats"
 	"github.com/spf13/cobra"
 	"github.com/subosito/gotenv"
 )
@@ -55,9 +60,28 @@ to control these services and provide scripting capabilities in the web interfac
 			log.Fatalf("Unable to load user: %s", err)
 		}
 
-		hub := wserv.NewHub(db, mcfsDir)
+		hub := wserv.NewHub(db, mcfsDir, blobstore.MustFromEnv(mcfsDir))
 		go hub.Run()
 
+		// Periodically rebuild the project statistics, which drift as they are updated incrementally.
+		if interval := os.Getenv("MC_PROJECT_STATS_INTERVAL"); interval != "" {
+			every, err := time.ParseDuration(interval)
+			if err != nil {
+				log.Fatalf("Invalid MC_PROJECT_STATS_INTERVAL %q: %s", interval, err)
+			}
+			go projectstats.NewRebuilder(projectStor).RunEvery(context.Background(), every, projectstats.Options{})
+		}
+
+		// Periodically fill in the SHA-256 for files uploaded before it was computed on upload.
+		if interval := os.Getenv("MC_SHA256_BACKFILL_INTERVAL"); interval != "" {
+			every, err := time.ParseDuration(interval)
+			if err != nil {
+				log.Fatalf("Invalid MC_SHA256_BACKFILL_INTERVAL %q: %s", interval, err)
+			}
+			backfiller := backfill.NewBackfiller(hub.FileStor, hub.FileStor.Blobs())
+			go backfiller.RunEvery(context.Background(), every, backfill.Options{})
+		}
+
 		interp := feather.New()
 		mqlCmd := mql.NewMQLCommands(proj, user, db, interp, hub)
 
@@ -14,6 +14,7 @@ import (
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
 	"github.com/charmbracelet/wish/scp"
+	"github.com/materials-commons/hydra/pkg/blobstore"
 	"github.com/materials-commons/hydra/pkg/mcdb"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
@@ -100,7 +101,7 @@ func init() {
 
 func mcsshdMain(cmd *cobra.Command, args []string) {
 	db := mcdb.MustConnectToDB()
-	stores := mc.NewGormStores(db, mcfsRoot)
+	stores := mc.NewGormStores(db, mcfsRoot, blobstore.MustFromEnv(mcfsRoot))
 	userStore = stor.NewGormUserStor(db)
 
 	// Setup SSH server and SCP Middleware handler
@@ -9,6 +9,7 @@ import (
 
 	"github.com/apex/log"
 	"github.com/feather-lang/feather"
+	"github.com/materials-commons/hydra/pkg/blobstore"
 	"github.com/materials-commons/hydra/pkg/mcdb"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 	"github.com/materials-commons/hydra/pkg/mchubd/wserv"
@@ -44,8 +45,9 @@ var rootCmd = &cobra.Command{
 			log.Fatalf("Unable to create directory %s: %s", tusChunksDir, err)
 		}
 
+		blobs := blobstore.MustFromEnv(mcfsDir)
 		progressCache := mctus2.NewUploadProgressCache()
-		app := mctus2.NewApp(mctus2.LocalFileStore{Path: tusChunksDir}, db, mcfsDir, progressCache)
+		app := mctus2.NewApp(mctus2.LocalFileStore{Path: tusChunksDir}, db, mcfsDir, blobs, progressCache)
 
 		tusLockDir := filepath.Join(mcfsDir, "__tus", "locks")
 		fmt.Printf("tusLockDir: %s\n", tusLockDir)
@@ -59,12 +61,13 @@ var rootCmd = &cobra.Command{
 		locker.UseIn(composer)
 
 		config := tusd.Config{
-			BasePath:                "/files/",
-			StoreComposer:           composer,
-			NotifyCompleteUploads:   true,
-			RespectForwardedHeaders: true,
-			DisableDownload:         true,
-			NotifyUploadProgress:    true,
+			BasePath:                  "/files/",
+			StoreComposer:             composer,
+			NotifyCompleteUploads:     true,
+			RespectForwardedHeaders:   true,
+			DisableDownload:           true,
+			NotifyUploadProgress:      true,
+			PreFinishResponseCallback: app.PreFinishResponse,
 		}
 
 		handler, err := tusd.NewHandler(config)
@@ -88,7 +91,7 @@ var rootCmd = &cobra.Command{
 			progressController.GetUploadProgressHandler(w, r)
 		})
 
-		hub := wserv.NewHub(db, mcfsDir)
+		hub := wserv.NewHub(db, mcfsDir, blobs)
 		go hub.Run()
 
 		//http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
@@ -7,7 +7,6 @@ require (
 	github.com/charmbracelet/ssh v0.0.0-20240725163421-eb71b85b27aa
 	github.com/charmbracelet/wish v1.4.1
 	github.com/feather-lang/feather v0.0.0-20260119183325-601d6c2067cd // v0.0.0-20251227222940-8b153391b49e //v0.0.0-20260119183325-601d6c2067cd
-	github.com/gliderlabs/ssh v0.3.7
 	github.com/go-resty/resty/v2 v2.14.0
 	github.com/gorilla/websocket v1.5.3
 	github.com/gosimple/slug v1.14.0
@@ -15,6 +14,7 @@ require (
 	github.com/hashicorp/go-uuid v1.0.3
 	github.com/labstack/echo/v4 v4.12.0
 	github.com/mitchellh/go-homedir v1.1.0
+	github.com/olekukonko/tablewriter v1.1.2
 	github.com/pkg/errors v0.9.1
 	github.com/pkg/sftp v1.13.6
 	github.com/saracen/walker v0.1.4
@@ -25,6 +25,7 @@ require (
 	github.com/tus/tusd/v2 v2.4.0
 	golang.org/x/crypto v0.25.0
 	golang.org/x/sys v0.39.0
+	golang.org/x/text v0.16.0
 	gorm.io/driver/mysql v1.5.7
 	gorm.io/driver/sqlite v1.5.6
 	gorm.io/gorm v1.25.11
@@ -80,7 +81,6 @@ require (
 	github.com/olekukonko/cat v0.0.0-20250911104152-50322a0618f6 // indirect
 	github.com/olekukonko/errors v1.1.0 // indirect
 	github.com/olekukonko/ll v0.1.3 // indirect
-	github.com/olekukonko/tablewriter v1.1.2 // indirect
 	github.com/pelletier/go-toml/v2 v2.2.2 // indirect
 	github.com/pmezard/go-difflib v1.0.1-0.20181226105442-5d4384ee4fb2 // indirect
 	github.com/prometheus/client_golang v1.19.1 // indirect
@@ -102,7 +102,6 @@ require (
 	golang.org/x/exp v0.0.0-20240719175910-8a7402abbf56 // indirect
 	golang.org/x/net v0.27.0 // indirect
 	golang.org/x/sync v0.7.0 // indirect
-	golang.org/x/text v0.16.0 // indirect
 	golang.org/x/time v0.6.0 // indirect
 	google.golang.org/protobuf v1.34.2 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
@@ -0,0 +1,206 @@
+// Package apitoken authenticates the API tokens sent to the daemons. Two kinds of token are
+// accepted: a user's api_token, which can do anything the user can, and the tokens in api_tokens
+// (mcmodel.APIToken), which can be restricted to one project, to reading or to writing, and which
+// expire and can be revoked.
+//
+// Authenticated tokens are cached for a limited time, so a daemon that didn't revoke a token itself
+// stops accepting it within the cache's TTL. The daemon that revokes a token stops accepting it
+// immediately.
+package apitoken
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"gorm.io/gorm"
+)
+
+// DefaultCacheTTL is how long an Authenticator trusts a token it has looked up.
+const DefaultCacheTTL = time.Minute
+
+var (
+	// ErrExpired is returned when authenticating with an expired token.
+	ErrExpired = errors.New("api token has expired")
+
+	// ErrRevoked is returned when authenticating with a revoked token.
+	ErrRevoked = errors.New("api token has been revoked")
+)
+
+// The errors returned when a token's scope doesn't allow a request. Like the authz errors they
+// match fs.ErrPermission.
+var (
+	ErrWrongProject = &scopeError{msg: "api token is restricted to a different project"}
+	ErrNoReadScope  = &scopeError{msg: "api token can't be used to read"}
+	ErrNoWriteScope = &scopeError{msg: "api token can't be used to write"}
+)
+
+type scopeError struct {
+	msg string
+}
+
+func (e *scopeError) Error() string {
+	return e.msg
+}
+
+func (e *scopeError) Is(target error) bool {
+	return target == fs.ErrPermission
+}
+
+// Principal is who a request was authenticated as.
+type Principal struct {
+	User *mcmodel.User
+
+	// Token is the APIToken used, or nil when the user's api_token was used.
+	Token *mcmodel.APIToken
+}
+
+// CheckProject returns ErrWrongProject when the token is restricted to a different project.
+func (p *Principal) CheckProject(projectID int) error {
+	if p.Token != nil && !p.Token.CanAccessProject(projectID) {
+		return ErrWrongProject
+	}
+
+	return nil
+}
+
+// CheckRead returns nil if the token can be used to read projectID.
+func (p *Principal) CheckRead(projectID int) error {
+	if err := p.CheckProject(projectID); err != nil {
+		return err
+	}
+
+	if p.Token != nil && !p.Token.CanRead() {
+		return ErrNoReadScope
+	}
+
+	return nil
+}
+
+// CheckWrite returns nil if the token can be used to write to projectID.
+func (p *Principal) CheckWrite(projectID int) error {
+	if err := p.CheckProject(projectID); err != nil {
+		return err
+	}
+
+	if p.Token != nil && !p.Token.CanWrite() {
+		return ErrNoWriteScope
+	}
+
+	return nil
+}
+
+// IsScoped returns true if an APIToken was used. Scoped tokens can't be used to manage tokens.
+func (p *Principal) IsScoped() bool {
+	return p.Token != nil
+}
+
+// Authenticator authenticates tokens, caching the results. It is safe for concurrent use.
+type Authenticator struct {
+	userStor  stor.UserStor
+	tokenStor stor.APITokenStor
+	ttl       time.Duration
+	now       func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedPrincipal
+}
+
+type cachedPrincipal struct {
+	principal *Principal
+	expires   time.Time
+}
+
+// NewAuthenticator creates an Authenticator that caches what it looks up for ttl.
+func NewAuthenticator(userStor stor.UserStor, tokenStor stor.APITokenStor, ttl time.Duration) *Authenticator {
+	return &Authenticator{
+		userStor:  userStor,
+		tokenStor: tokenStor,
+		ttl:       ttl,
+		now:       time.Now,
+		cache:     make(map[string]cachedPrincipal),
+	}
+}
+
+// Authenticate returns who secret belongs to. Secrets are cached by their hash, so the cache doesn't
+// hold usable tokens.
+func (a *Authenticator) Authenticate(secret string) (*Principal, error) {
+	key := mcmodel.HashAPITokenSecret(secret)
+	now := a.now()
+
+	a.mu.Lock()
+	cached, ok := a.cache[key]
+	a.mu.Unlock()
+
+	if !ok || !now.Before(cached.expires) {
+		principal, err := a.lookup(secret)
+		if err != nil {
+			return nil, err
+		}
+
+		cached = cachedPrincipal{principal: principal, expires: now.Add(a.ttl)}
+		a.mu.Lock()
+		a.cache[key] = cached
+		a.mu.Unlock()
+	}
+
+	// A cached token can expire before its cache entry does.
+	if token := cached.principal.Token; token != nil && token.IsExpired(now) {
+		a.Forget(secret)
+		return nil, ErrExpired
+	}
+
+	return cached.principal, nil
+}
+
+func (a *Authenticator) lookup(secret string) (*Principal, error) {
+	if !mcmodel.IsAPITokenSecret(secret) {
+		user, err := a.userStor.GetUserByAPIToken(secret)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Principal{User: user}, nil
+	}
+
+	token, err := a.tokenStor.GetAPITokenBySecret(secret)
+	switch {
+	case err != nil:
+		return nil, err
+	case token.IsRevoked():
+		return nil, ErrRevoked
+	case token.User == nil:
+		// The token's user has been deleted.
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return &Principal{User: token.User, Token: token}, nil
+}
+
+// Revoke revokes one of the user's tokens and stops accepting it straight away.
+func (a *Authenticator) Revoke(userID, tokenID int) (*mcmodel.APIToken, error) {
+	token, err := a.tokenStor.RevokeAPIToken(userID, tokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, cached := range a.cache {
+		if cached.principal.Token != nil && cached.principal.Token.ID == tokenID {
+			delete(a.cache, key)
+		}
+	}
+
+	return token, nil
+}
+
+// Forget drops secret from the cache, so the next Authenticate looks it up again.
+func (a *Authenticator) Forget(secret string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.cache, mcmodel.HashAPITokenSecret(secret))
+}
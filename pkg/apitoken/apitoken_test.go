@@ -0,0 +1,98 @@
+package apitoken
+
+import (
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	user := b.User("user1")
+	require.NoError(t, db.Model(user).Update("api_token", "legacy-token").Error)
+	proj := b.Project("proj1", user)
+
+	userStor := stor.NewGormUserStor(db)
+	tokenStor := stor.NewGormAPITokenStor(db)
+	auth := NewAuthenticator(userStor, tokenStor, time.Minute)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	auth.now = func() time.Time { return now }
+
+	t.Run("UserToken", func(t *testing.T) {
+		p, err := auth.Authenticate("legacy-token")
+		require.NoError(t, err)
+		require.Equal(t, user.ID, p.User.ID)
+		require.False(t, p.IsScoped())
+		require.NoError(t, p.CheckWrite(proj.ID+1))
+
+		_, err = auth.Authenticate("no-such-token")
+		require.Error(t, err)
+	})
+
+	t.Run("Scopes", func(t *testing.T) {
+		secret, _, err := tokenStor.CreateAPIToken(&mcmodel.APIToken{
+			UserID: user.ID, ProjectID: proj.ID, Scope: mcmodel.APITokenScopeRead,
+		})
+		require.NoError(t, err)
+
+		p, err := auth.Authenticate(secret)
+		require.NoError(t, err)
+		require.True(t, p.IsScoped())
+		require.Equal(t, user.ID, p.User.ID)
+		require.NoError(t, p.CheckRead(proj.ID))
+		require.ErrorIs(t, p.CheckWrite(proj.ID), ErrNoWriteScope)
+		require.ErrorIs(t, p.CheckRead(proj.ID+1), ErrWrongProject)
+		require.ErrorIs(t, p.CheckRead(proj.ID+1), fs.ErrPermission)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		expires := now.Add(time.Hour)
+		secret, _, err := tokenStor.CreateAPIToken(&mcmodel.APIToken{
+			UserID: user.ID, Scope: mcmodel.APITokenScopeReadWrite, ExpiresAt: &expires,
+		})
+		require.NoError(t, err)
+
+		p, err := auth.Authenticate(secret)
+		require.NoError(t, err)
+		require.NoError(t, p.CheckWrite(proj.ID))
+
+		// The cached token expires as well.
+		now = now.Add(30 * time.Minute)
+		_, err = auth.Authenticate(secret)
+		require.NoError(t, err)
+		now = now.Add(30 * time.Minute)
+		_, err = auth.Authenticate(secret)
+		require.ErrorIs(t, err, ErrExpired)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		secret, token, err := tokenStor.CreateAPIToken(&mcmodel.APIToken{UserID: user.ID, Scope: mcmodel.APITokenScopeWrite})
+		require.NoError(t, err)
+		_, err = auth.Authenticate(secret)
+		require.NoError(t, err)
+
+		// Another daemon's cache keeps accepting the token until its cache entry expires.
+		other := NewAuthenticator(userStor, tokenStor, time.Minute)
+		other.now = auth.now
+		_, err = other.Authenticate(secret)
+		require.NoError(t, err)
+
+		revoked, err := auth.Revoke(user.ID, token.ID)
+		require.NoError(t, err)
+		require.True(t, revoked.IsRevoked())
+		_, err = auth.Authenticate(secret)
+		require.ErrorIs(t, err, ErrRevoked)
+
+		_, err = other.Authenticate(secret)
+		require.NoError(t, err)
+		now = now.Add(2 * time.Minute)
+		_, err = other.Authenticate(secret)
+		require.ErrorIs(t, err, ErrRevoked)
+	})
+}
@@ -0,0 +1,147 @@
+// Package authz decides what a user may do in a project. A user's access to a project is one of
+// three roles, resolved from project membership and the project's team:
+//
+//   - Admin: the project owner and the team's admins.
+//   - Contributor: the team's members.
+//   - Viewer: users granted read-only access to the project (project2viewer) who aren't on its team.
+//
+// Viewers can browse and download, contributors can also upload, create, rename and delete, and
+// admins can also manage the project. Every front end (mcapid, SFTP, SCP, WebDAV, FUSE, tus and the
+// hub) denies a write by a viewer with ErrReadOnly.
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// Role is a user's level of access to a project. Roles are ordered, each role can do everything the
+// roles below it can.
+type Role int
+
+const (
+	None Role = iota
+	Viewer
+	Contributor
+	Admin
+)
+
+var roleNames = map[Role]string{
+	None:        "none",
+	Viewer:      "viewer",
+	Contributor: "contributor",
+	Admin:       "admin",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+// ParseRole returns the Role named by s. Names are case-insensitive.
+func ParseRole(s string) (Role, error) {
+	for role, name := range roleNames {
+		if strings.EqualFold(s, name) {
+			return role, nil
+		}
+	}
+
+	return None, fmt.Errorf("unknown role %q", s)
+}
+
+// MarshalText writes a role by its name, so roles are strings in JSON.
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Role) UnmarshalText(text []byte) error {
+	role, err := ParseRole(string(text))
+	if err != nil {
+		return err
+	}
+
+	*r = role
+	return nil
+}
+
+// CanRead is true for roles that can browse and download the project's files.
+func (r Role) CanRead() bool {
+	return r >= Viewer
+}
+
+// CanWrite is true for roles that can change the project's files.
+func (r Role) CanWrite() bool {
+	return r >= Contributor
+}
+
+// CanAdmin is true for roles that can manage the project.
+func (r Role) CanAdmin() bool {
+	return r >= Admin
+}
+
+// The errors returned when a role doesn't allow an operation. They all match fs.ErrPermission, so
+// front ends that already turn a permission error into their protocol's "permission denied" need no
+// changes to report them.
+var (
+	// ErrNoAccess is returned when the user has no access to the project.
+	ErrNoAccess error = &accessError{msg: "user does not have access to the project"}
+
+	// ErrReadOnly is returned when a user with read-only (viewer) access attempts a write.
+	ErrReadOnly error = &accessError{msg: "user has read-only access to the project"}
+
+	// ErrAdminRequired is returned when a user who isn't a project admin attempts to manage it.
+	ErrAdminRequired error = &accessError{msg: "project admin access is required"}
+)
+
+type accessError struct {
+	msg string
+}
+
+func (e *accessError) Error() string {
+	return e.msg
+}
+
+func (e *accessError) Is(target error) bool {
+	return target == fs.ErrPermission
+}
+
+// Check returns nil when role allows what required allows, otherwise it returns the error describing
+// why it doesn't: ErrNoAccess, ErrReadOnly or ErrAdminRequired.
+func Check(role, required Role) error {
+	switch {
+	case role >= required:
+		return nil
+	case !role.CanRead():
+		return ErrNoAccess
+	case required == Contributor:
+		return ErrReadOnly
+	default:
+		return ErrAdminRequired
+	}
+}
+
+// IsDenied is true for the errors returned by Check.
+func IsDenied(err error) bool {
+	var ae *accessError
+	return errors.As(err, &ae)
+}
+
+// RoleResolver returns a user's role in a project. stor.ProjectStor and Cache are both RoleResolvers.
+type RoleResolver interface {
+	GetUserProjectRole(userID, projectID int) (Role, error)
+}
+
+// Require resolves the user's role in the project and checks it against required.
+func Require(resolver RoleResolver, userID, projectID int, required Role) error {
+	role, err := resolver.GetUserProjectRole(userID, projectID)
+	if err != nil {
+		return err
+	}
+
+	return Check(role, required)
+}
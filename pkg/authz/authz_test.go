@@ -0,0 +1,110 @@
+package authz
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		want     error
+	}{
+		{None, Viewer, ErrNoAccess},
+		{None, Contributor, ErrNoAccess},
+		{Viewer, Viewer, nil},
+		{Viewer, Contributor, ErrReadOnly},
+		{Viewer, Admin, ErrAdminRequired},
+		{Contributor, Contributor, nil},
+		{Contributor, Admin, ErrAdminRequired},
+		{Admin, Contributor, nil},
+		{Admin, Admin, nil},
+	}
+
+	for _, test := range tests {
+		err := Check(test.role, test.required)
+		require.Equal(t, test.want, err, "%s requires %s", test.role, test.required)
+		if err != nil {
+			require.True(t, IsDenied(err))
+			require.ErrorIs(t, err, fs.ErrPermission)
+			require.ErrorIs(t, err, os.ErrPermission)
+		}
+	}
+
+	require.False(t, IsDenied(os.ErrPermission))
+	require.True(t, IsDenied(errors.Join(errors.New("upload"), ErrReadOnly)))
+}
+
+func TestRoleNames(t *testing.T) {
+	for _, role := range []Role{None, Viewer, Contributor, Admin} {
+		parsed, err := ParseRole(role.String())
+		require.NoError(t, err)
+		require.Equal(t, role, parsed)
+	}
+
+	role, err := ParseRole("Contributor")
+	require.NoError(t, err)
+	require.Equal(t, Contributor, role)
+
+	_, err = ParseRole("owner")
+	require.Error(t, err)
+
+	data, err := json.Marshal(map[string]Role{"role": Viewer})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"role": "viewer"}`, string(data))
+
+	var decoded map[string]Role
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, Viewer, decoded["role"])
+}
+
+type fakeResolver struct {
+	roles   map[int]Role
+	lookups int
+	err     error
+}
+
+func (r *fakeResolver) GetUserProjectRole(userID, _ int) (Role, error) {
+	r.lookups++
+	return r.roles[userID], r.err
+}
+
+func TestCache(t *testing.T) {
+	resolver := &fakeResolver{roles: map[int]Role{1: Contributor}}
+	c := NewCache(resolver, time.Minute)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	role, err := c.GetUserProjectRole(1, 10)
+	require.NoError(t, err)
+	require.Equal(t, Contributor, role)
+
+	// Changes aren't seen until the cached role expires.
+	resolver.roles[1] = Viewer
+	role, _ = c.GetUserProjectRole(1, 10)
+	require.Equal(t, Contributor, role)
+	require.Equal(t, 1, resolver.lookups)
+
+	now = now.Add(2 * time.Minute)
+	require.ErrorIs(t, Require(c, 1, 10, Contributor), ErrReadOnly)
+	require.Equal(t, 2, resolver.lookups)
+
+	// Forget drops the cached role straight away.
+	resolver.roles[1] = Admin
+	c.Forget(1, 10)
+	require.NoError(t, Require(c, 1, 10, Admin))
+
+	// Errors aren't cached.
+	resolver.err = errors.New("db down")
+	_, err = c.GetUserProjectRole(2, 10)
+	require.Error(t, err)
+	resolver.err = nil
+	require.ErrorIs(t, Require(c, 2, 10, Viewer), ErrNoAccess)
+}
@@ -0,0 +1,74 @@
+package authz
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long a Cache trusts a resolved role. Roles are cached rather than resolved on
+// every request, so a change to a user's access takes up to this long to be seen.
+const DefaultCacheTTL = time.Minute
+
+// Cache caches the roles resolved by another RoleResolver for a limited time. It is safe for
+// concurrent use.
+type Cache struct {
+	resolver RoleResolver
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	roles map[cacheKey]cachedRole
+}
+
+type cacheKey struct {
+	userID    int
+	projectID int
+}
+
+type cachedRole struct {
+	role    Role
+	expires time.Time
+}
+
+// NewCache creates a Cache in front of resolver. Roles are kept for ttl.
+func NewCache(resolver RoleResolver, ttl time.Duration) *Cache {
+	return &Cache{
+		resolver: resolver,
+		ttl:      ttl,
+		now:      time.Now,
+		roles:    make(map[cacheKey]cachedRole),
+	}
+}
+
+// GetUserProjectRole returns the user's role in the project, resolving it when it isn't cached or
+// has expired. Errors aren't cached.
+func (c *Cache) GetUserProjectRole(userID, projectID int) (Role, error) {
+	key := cacheKey{userID: userID, projectID: projectID}
+
+	c.mu.Lock()
+	cached, ok := c.roles[key]
+	c.mu.Unlock()
+
+	now := c.now()
+	if ok && now.Before(cached.expires) {
+		return cached.role, nil
+	}
+
+	role, err := c.resolver.GetUserProjectRole(userID, projectID)
+	if err != nil {
+		return None, err
+	}
+
+	c.mu.Lock()
+	c.roles[key] = cachedRole{role: role, expires: now.Add(c.ttl)}
+	c.mu.Unlock()
+
+	return role, nil
+}
+
+// Forget drops the cached role of the user in the project, so the next lookup resolves it again.
+func (c *Cache) Forget(userID, projectID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.roles, cacheKey{userID: userID, projectID: projectID})
+}
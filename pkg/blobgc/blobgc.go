@@ -0,0 +1,267 @@
+// Package blobgc finds and removes orphaned blobs. A blob is orphaned when no row in the
+// files table references its UUID, either directly or through uses_uuid. Blobs can end up
+// orphaned when an upload is abandoned, when a deduplicated upload fails to clean up after
+// itself, or when rows are removed from the database by hand.
+package blobgc
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+)
+
+// DefaultGracePeriod is how old a blob has to be before it is considered for collection.
+// Uploads create the blob before the file row points at it, so young blobs are left alone.
+const DefaultGracePeriod = 24 * time.Hour
+
+// referenceBatchSize is the number of UUIDs that are checked against the database at once.
+const referenceBatchSize = 500
+
+type Options struct {
+	// GracePeriod protects blobs modified more recently than this. Zero means DefaultGracePeriod.
+	GracePeriod time.Duration
+
+	// DryRun reports orphans without deleting them.
+	DryRun bool
+
+	// Now is the time the grace period is measured from. Zero means time.Now().
+	Now time.Time
+}
+
+// Orphan is a blob that nothing references.
+type Orphan struct {
+	Key     string    `json:"key"`
+	UUID    string    `json:"uuid"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Deleted bool      `json:"deleted"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Report is the result of a collection run.
+type Report struct {
+	DryRun       bool     `json:"dry_run"`
+	Scanned      int      `json:"scanned"`
+	Referenced   int      `json:"referenced"`
+	Protected    int      `json:"protected"`
+	SkippedGrace int      `json:"skipped_grace"`
+	Orphans      []Orphan `json:"orphans"`
+	OrphanBytes  int64    `json:"orphan_bytes"`
+	Deleted      int      `json:"deleted"`
+	DeletedBytes int64    `json:"deleted_bytes"`
+}
+
+type Collector struct {
+	blobs                    blobstore.BlobStore
+	fileStor                 stor.FileStor
+	partialTransferFileStor  stor.PartialTransferFileStor
+	remoteClientTransferStor stor.RemoteClientTransferStor
+}
+
+func NewCollector(blobs blobstore.BlobStore, stors *stor.Stors) *Collector {
+	return &Collector{
+		blobs:                    blobs,
+		fileStor:                 stors.FileStor,
+		partialTransferFileStor:  stors.PartialTransferFileStor,
+		remoteClientTransferStor: stors.RemoteClientTransferStor,
+	}
+}
+
+// Run walks the blob store and collects every orphaned blob that is older than the grace period.
+// Blobs that a live PartialTransferFile or RemoteClientTransfer points at are never collected,
+// even when no file row references them yet.
+func (c *Collector) Run(opts Options) (*Report, error) {
+	if opts.GracePeriod == 0 {
+		opts.GracePeriod = DefaultGracePeriod
+	}
+
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	protected, err := c.loadProtectedUUIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{DryRun: opts.DryRun, Orphans: []Orphan{}}
+	cutoff := opts.Now.Add(-opts.GracePeriod)
+
+	var batch []blobstore.BlobInfo
+	err = c.blobs.Walk(func(info blobstore.BlobInfo) error {
+		report.Scanned++
+
+		uuid := path.Base(info.Key)
+		switch {
+		case !keyMatchesUUID(info.Key, uuid):
+			// Not something we created, leave it alone.
+			return nil
+		case protected[uuid]:
+			report.Protected++
+			return nil
+		case info.ModTime.After(cutoff):
+			report.SkippedGrace++
+			return nil
+		}
+
+		batch = append(batch, info)
+		if len(batch) < referenceBatchSize {
+			return nil
+		}
+
+		err := c.collectBatch(batch, opts, report)
+		batch = batch[:0]
+		return err
+	})
+
+	if err != nil {
+		return report, err
+	}
+
+	if err := c.collectBatch(batch, opts, report); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// CollectUUIDs collects the blobs for the given file UUIDs, such as those returned by FileStor.PurgeFromTrash.
+// The grace period doesn't apply since the caller knows the blobs are no longer wanted, but references and
+// in-flight transfers are still checked, so a blob that something still uses is never removed.
+func (c *Collector) CollectUUIDs(uuids []string, opts Options) (*Report, error) {
+	protected, err := c.loadProtectedUUIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{DryRun: opts.DryRun, Orphans: []Orphan{}}
+
+	var batch []blobstore.BlobInfo
+	for _, uuid := range uuids {
+		key := mcmodel.File{UUID: uuid}.BlobKeyForUUID()
+		info, err := c.blobs.Stat(key)
+		switch {
+		case blobstore.IsNotExist(err):
+			continue
+		case err != nil:
+			return report, err
+		}
+
+		report.Scanned++
+		if protected[uuid] {
+			report.Protected++
+			continue
+		}
+
+		batch = append(batch, info)
+		if len(batch) == referenceBatchSize {
+			if err := c.collectBatch(batch, opts, report); err != nil {
+				return report, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if err := c.collectBatch(batch, opts, report); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// collectBatch checks a batch of candidate blobs against the files table, and deletes the ones
+// that aren't referenced.
+func (c *Collector) collectBatch(batch []blobstore.BlobInfo, opts Options, report *Report) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	uuids := make([]string, 0, len(batch))
+	for _, info := range batch {
+		uuids = append(uuids, path.Base(info.Key))
+	}
+
+	referenced, err := c.fileStor.FindReferencedUUIDs(uuids)
+	if err != nil {
+		return fmt.Errorf("unable to check references: %w", err)
+	}
+
+	for _, info := range batch {
+		uuid := path.Base(info.Key)
+		if referenced[uuid] {
+			report.Referenced++
+			continue
+		}
+
+		orphan := Orphan{Key: info.Key, UUID: uuid, Size: info.Size, ModTime: info.ModTime}
+		report.OrphanBytes += info.Size
+
+		if !opts.DryRun {
+			if err := c.blobs.Delete(info.Key); err != nil {
+				log.Errorf("Unable to delete orphaned blob %s: %s", info.Key, err)
+				orphan.Error = err.Error()
+			} else {
+				orphan.Deleted = true
+				report.Deleted++
+				report.DeletedBytes += info.Size
+			}
+		}
+
+		report.Orphans = append(report.Orphans, orphan)
+	}
+
+	return nil
+}
+
+// loadProtectedUUIDs returns the UUIDs of blobs that in-flight transfers are writing to.
+func (c *Collector) loadProtectedUUIDs() (map[string]bool, error) {
+	protected := make(map[string]bool)
+
+	partialFiles, err := c.partialTransferFileStor.GetUploadingFiles()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load partial transfer files: %w", err)
+	}
+
+	for _, ptf := range partialFiles {
+		protected[ptf.UUID] = true
+		if ptf.FilePath != "" {
+			protected[filepath.Base(ptf.FilePath)] = true
+		}
+	}
+
+	transfers, err := c.remoteClientTransferStor.GetActiveTransfers()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load remote client transfers: %w", err)
+	}
+
+	for _, transfer := range transfers {
+		if transfer.File == nil {
+			continue
+		}
+
+		protected[transfer.File.UUID] = true
+		if transfer.File.UsesUUID != "" {
+			protected[transfer.File.UsesUUID] = true
+		}
+	}
+
+	return protected, nil
+}
+
+// keyMatchesUUID checks that key is the key a file with uuid would have, that is, the shard
+// directories are the first four characters of the second group of the uuid.
+func keyMatchesUUID(key, uuid string) bool {
+	pieces := strings.Split(uuid, "-")
+	if len(pieces) != 5 || len(pieces[1]) < 4 {
+		return false
+	}
+
+	return key == path.Join(pieces[1][0:2], pieces[1][2:4], uuid)
+}
@@ -0,0 +1,107 @@
+package blobgc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	referencedUUID = "00000000-aaaa-0000-0000-000000000001"
+	usedUUID       = "00000000-aaab-0000-0000-000000000002"
+	orphanUUID     = "00000000-aaac-0000-0000-000000000003"
+	youngUUID      = "00000000-aaad-0000-0000-000000000004"
+	partialUUID    = "00000000-aaae-0000-0000-000000000005"
+	transferUUID   = "00000000-aaaf-0000-0000-000000000006"
+	deletedUUID    = "00000000-aab0-0000-0000-000000000007"
+)
+
+func TestCollector(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+
+	root := t.TempDir()
+	blobs := blobstore.NewLocalBlobStore(root)
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+
+	for _, uuid := range []string{referencedUUID, usedUUID, orphanUUID, youngUUID, partialUUID, transferUUID, deletedUUID} {
+		key := mcmodel.File{UUID: uuid}.BlobKey()
+		w, err := blobs.Create(key)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(uuid))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		modTime := old
+		if uuid == youngUUID {
+			modTime = now
+		}
+		require.NoError(t, os.Chtimes(blobs.Path(key), modTime, modTime))
+	}
+
+	// Files that aren't in the sharded layout, or whose shard doesn't match their name, are never touched.
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "__tus", "chunks"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "__tus", "chunks", "upload"), []byte("x"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "00", "00"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "00", "00", "notes.txt"), []byte("x"), 0644))
+
+	require.NoError(t, db.Create(&mcmodel.File{UUID: referencedUUID, Name: "a.txt", MimeType: "text/plain"}).Error)
+	require.NoError(t, db.Create(&mcmodel.File{UUID: "00000000-ffff-0000-0000-000000000008", UsesUUID: usedUUID, Name: "b.txt", MimeType: "text/plain"}).Error)
+	require.NoError(t, db.Create(&mcmodel.File{UUID: deletedUUID, Name: "c.txt", MimeType: "text/plain", DeletedAt: old}).Error)
+
+	transferFile := mcmodel.File{UUID: "00000000-ffff-0000-0000-000000000009", UsesUUID: transferUUID, Name: "d.txt", MimeType: "text/plain"}
+	require.NoError(t, db.Create(&transferFile).Error)
+	require.NoError(t, db.Create(&mcmodel.RemoteClientTransfer{UUID: "rct", State: "uploading", TransferID: "t1", FileID: transferFile.ID}).Error)
+
+	require.NoError(t, db.Create(&mcmodel.PartialTransferFile{
+		UUID:     "ptf",
+		Status:   "uploading",
+		FilePath: mcmodel.File{UUID: partialUUID}.ToUnderlyingFilePath(root),
+	}).Error)
+
+	stors := stor.NewGormStors(db, root)
+	stors.FileStor = stor.NewGormFileStorWithBlobStore(db, root, blobs)
+	collector := NewCollector(blobs, stors)
+
+	report, err := collector.Run(Options{DryRun: true, Now: now})
+	require.NoError(t, err)
+	require.Equal(t, 8, report.Scanned)
+	require.Equal(t, 3, report.Referenced)
+	require.Equal(t, 2, report.Protected)
+	require.Equal(t, 1, report.SkippedGrace)
+	require.Len(t, report.Orphans, 1)
+	require.Equal(t, orphanUUID, report.Orphans[0].UUID)
+	require.Equal(t, int64(len(orphanUUID)), report.OrphanBytes)
+	require.Equal(t, 0, report.Deleted)
+	require.True(t, blobstore.Exists(blobs, mcmodel.File{UUID: orphanUUID}.BlobKey()))
+
+	// Once the partial transfer is no longer uploading its blob is fair game.
+	require.NoError(t, db.Model(&mcmodel.PartialTransferFile{}).Where("uuid = ?", "ptf").Update("status", "failed").Error)
+
+	report, err = collector.Run(Options{Now: now})
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Protected)
+	require.Len(t, report.Orphans, 2)
+	require.Equal(t, 2, report.Deleted)
+	require.False(t, blobstore.Exists(blobs, mcmodel.File{UUID: orphanUUID}.BlobKey()))
+	require.False(t, blobstore.Exists(blobs, mcmodel.File{UUID: partialUUID}.BlobKey()))
+	require.True(t, blobstore.Exists(blobs, mcmodel.File{UUID: referencedUUID}.BlobKey()))
+	require.True(t, blobstore.Exists(blobs, mcmodel.File{UUID: youngUUID}.BlobKey()))
+	require.True(t, blobstore.Exists(blobs, mcmodel.File{UUID: deletedUUID}.BlobKey()))
+
+	// Collecting specific UUIDs ignores the grace period, but still checks references.
+	report, err = collector.CollectUUIDs([]string{youngUUID, referencedUUID, orphanUUID}, Options{Now: now})
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Scanned)
+	require.Equal(t, 1, report.Referenced)
+	require.Equal(t, 1, report.Deleted)
+	require.False(t, blobstore.Exists(blobs, mcmodel.File{UUID: youngUUID}.BlobKey()))
+	require.True(t, blobstore.Exists(blobs, mcmodel.File{UUID: referencedUUID}.BlobKey()))
+}
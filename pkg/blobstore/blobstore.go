@@ -0,0 +1,156 @@
+// Package blobstore abstracts where the contents of Materials Commons files are kept. Every file
+// has a blob key derived from its UUID (see mcmodel.File.BlobKey). A BlobStore maps that key onto
+// the underlying storage. The LocalBlobStore keeps the historical <mcfs-dir>/xx/yy/<uuid> layout,
+// and the S3BlobStore stores the same keys as objects in an S3 compatible bucket.
+package blobstore
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNotLocal is returned by LocalPath when the store doesn't keep blobs on the local filesystem.
+var ErrNotLocal = errors.New("blob store is not backed by the local filesystem")
+
+// Reader is a blob opened for reading. It supports both streaming reads and random access.
+type Reader interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+}
+
+// Writer is a blob opened for writing. Writes are only guaranteed to be visible to other
+// readers of the store once Close returns without an error.
+type Writer interface {
+	io.Writer
+	io.WriterAt
+	io.Closer
+	Truncate(size int64) error
+	Sync() error
+}
+
+// BlobInfo describes a stored blob.
+type BlobInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// BlobStore is the interface all services use to read and write file contents. Keys are
+// slash separated relative paths, such as those returned by mcmodel.File.BlobKey. Errors
+// for blobs that don't exist satisfy errors.Is(err, fs.ErrNotExist).
+type BlobStore interface {
+	// Open opens the blob for reading, positioned at offset.
+	Open(key string, offset int64) (Reader, error)
+
+	// Create creates the blob, truncating it if it already exists.
+	Create(key string) (Writer, error)
+
+	// Append opens the blob for writing, positioned at the end of its existing
+	// content. The blob is created if it doesn't exist.
+	Append(key string) (Writer, error)
+
+	// Stat returns the size and modification time of the blob.
+	Stat(key string) (BlobInfo, error)
+
+	// Delete removes the blob. Deleting a blob that doesn't exist is not an error.
+	Delete(key string) error
+
+	// Rename moves the blob at fromKey into place at toKey, replacing anything already at toKey.
+	Rename(fromKey, toKey string) error
+
+	// Walk calls fn, in key order, for every blob stored in the xx/yy/<name> layout. Anything
+	// else in the store, such as the __tus and zipfiles directories, is skipped. Returning an
+	// error from fn stops the walk and returns that error.
+	Walk(fn func(info BlobInfo) error) error
+}
+
+// Exists returns true if the blob exists in the store.
+func Exists(bs BlobStore, key string) bool {
+	_, err := bs.Stat(key)
+	return err == nil
+}
+
+// LocalPath returns the path on the local filesystem for key. It returns ErrNotLocal when the
+// store keeps its blobs somewhere else. This exists for FUSE, which has to hand real file
+// descriptors to the kernel.
+func LocalPath(bs BlobStore, key string) (string, error) {
+	if local, ok := bs.(*LocalBlobStore); ok {
+		return local.Path(key), nil
+	}
+
+	return "", ErrNotLocal
+}
+
+// ImportFile moves a file that lives on the local filesystem (for example a completed tus upload) into
+// the store at key. For a LocalBlobStore this is a rename when possible. For all other stores the contents
+// are copied and the local file is removed.
+func ImportFile(bs BlobStore, localPath string, key string) error {
+	if local, ok := bs.(*LocalBlobStore); ok {
+		if err := local.mkdirFor(key); err != nil {
+			return err
+		}
+
+		if err := os.Rename(localPath, local.Path(key)); err == nil {
+			return nil
+		}
+
+		// Rename can fail when the source is on a different device, fall back to copying.
+	}
+
+	src, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := bs.Create(key)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		_ = bs.Delete(key)
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		_ = bs.Delete(key)
+		return err
+	}
+
+	_ = src.Close()
+	return os.Remove(localPath)
+}
+
+// IsShardedKey returns true if key has the xx/yy/<name> layout that blob keys use.
+func IsShardedKey(key string) bool {
+	parts := strings.Split(key, "/")
+	return len(parts) == 3 && isShardName(parts[0]) && isShardName(parts[1]) && parts[2] != ""
+}
+
+// isShardName returns true if name is a two character lowercase hex directory name.
+func isShardName(name string) bool {
+	if len(name) != 2 {
+		return false
+	}
+
+	for _, c := range name {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsNotExist reports whether err says a blob is missing.
+func IsNotExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist)
+}
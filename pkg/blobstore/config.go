@@ -0,0 +1,50 @@
+package blobstore
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/apex/log"
+)
+
+// FromEnv creates the BlobStore described by the environment. MC_BLOB_STORE selects the
+// backend, either "local" (the default) or "s3". The local store keeps blobs under mcfsRoot.
+// The s3 store is configured with:
+//
+//	MC_S3_ENDPOINT, MC_S3_BUCKET, MC_S3_ACCESS_KEY, MC_S3_SECRET_KEY (required)
+//	MC_S3_REGION (default us-east-1), MC_S3_PREFIX, MC_S3_SPOOL_DIR (default os.TempDir())
+func FromEnv(mcfsRoot string) (BlobStore, error) {
+	switch strings.ToLower(os.Getenv("MC_BLOB_STORE")) {
+	case "", "local":
+		return NewLocalBlobStore(mcfsRoot), nil
+	case "s3":
+		cfg := S3Config{
+			Endpoint:  os.Getenv("MC_S3_ENDPOINT"),
+			Region:    os.Getenv("MC_S3_REGION"),
+			Bucket:    os.Getenv("MC_S3_BUCKET"),
+			Prefix:    os.Getenv("MC_S3_PREFIX"),
+			AccessKey: os.Getenv("MC_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("MC_S3_SECRET_KEY"),
+			SpoolDir:  os.Getenv("MC_S3_SPOOL_DIR"),
+		}
+
+		if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+			return nil, fmt.Errorf("MC_BLOB_STORE is s3, but one of MC_S3_ENDPOINT, MC_S3_BUCKET, MC_S3_ACCESS_KEY or MC_S3_SECRET_KEY is blank")
+		}
+
+		return NewS3BlobStore(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown MC_BLOB_STORE '%s'", os.Getenv("MC_BLOB_STORE"))
+	}
+}
+
+// MustFromEnv is FromEnv, but exits when the environment describes an invalid store.
+func MustFromEnv(mcfsRoot string) BlobStore {
+	bs, err := FromEnv(mcfsRoot)
+	if err != nil {
+		log.Fatalf("Unable to create blob store: %s", err)
+	}
+
+	return bs
+}
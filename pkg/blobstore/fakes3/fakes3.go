@@ -0,0 +1,304 @@
+// Package fakes3 is a small in-memory stand-in for an S3 compatible service. It implements
+// just enough of the API (path style HEAD, GET with Range, PUT, copy, DELETE and multipart
+// uploads) to exercise blobstore.S3BlobStore in tests without a real bucket.
+package fakes3
+
+import (
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type object struct {
+	data    []byte
+	modTime time.Time
+}
+
+type multipartUpload struct {
+	key   string
+	parts map[int][]byte
+}
+
+// Server is an in-memory S3 service. Objects are keyed by "<bucket>/<key>".
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	objects  map[string]object
+	uploads  map[string]*multipartUpload
+	uploadID int
+
+	// Requests counts the requests received, keyed by method.
+	Requests map[string]int
+
+	// MaxKeys, when set, overrides the page size of object listings so that paging can be tested.
+	MaxKeys int
+}
+
+// NewServer starts a new stand-in. Call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		objects:  make(map[string]object),
+		uploads:  make(map[string]*multipartUpload),
+		Requests: make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Object returns the contents of an object and whether it exists.
+func (s *Server) Object(bucket, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[bucket+"/"+key]
+	return obj.data, ok
+}
+
+// Keys returns the sorted list of object names in bucket.
+func (s *Server) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for name := range s.objects {
+		if strings.HasPrefix(name, bucket+"/") {
+			keys = append(keys, strings.TrimPrefix(name, bucket+"/"))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Requests[r.Method]++
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		writeError(w, http.StatusForbidden, "AccessDenied", "missing signature")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.initiateUpload(w, name)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		s.completeUpload(w, r, name, query.Get("uploadId"))
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		s.uploadPart(w, r, query)
+	case r.Method == http.MethodPut && r.Header.Get("x-amz-copy-source") != "":
+		s.copyObject(w, r, name)
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		s.objects[name] = object{data: data, modTime: time.Now()}
+		w.Header().Set("ETag", etag(data))
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		delete(s.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && query.Get("list-type") == "2":
+		s.listObjects(w, name, query)
+	case r.Method == http.MethodHead, r.Method == http.MethodGet:
+		s.getObject(w, r, name)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, name string) {
+	obj, ok := s.objects[name]
+	if !ok {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeError(w, http.StatusNotFound, "NoSuchKey", name)
+		return
+	}
+
+	data := obj.data
+	status := http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" {
+		start, end, err := parseRange(rng, int64(len(data)))
+		if err != nil {
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", err.Error())
+			return
+		}
+		data = data[start : end+1]
+		status = http.StatusPartialContent
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+	w.Header().Set("ETag", etag(obj.data))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(data)
+	}
+}
+
+// listObjects implements ListObjectsV2. The continuation token is the last key returned.
+func (s *Server) listObjects(w http.ResponseWriter, bucket string, query url.Values) {
+	maxKeys := 1000
+	if mk := query.Get("max-keys"); mk != "" {
+		maxKeys, _ = strconv.Atoi(mk)
+	}
+
+	if s.MaxKeys != 0 {
+		maxKeys = s.MaxKeys
+	}
+
+	prefix := query.Get("prefix")
+	after := query.Get("continuation-token")
+
+	var names []string
+	for name := range s.objects {
+		key, ok := strings.CutPrefix(name, bucket+"/")
+		if ok && strings.HasPrefix(key, prefix) && key > after {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+
+	truncated := len(names) > maxKeys
+	if truncated {
+		names = names[:maxKeys]
+	}
+
+	_, _ = fmt.Fprint(w, "<ListBucketResult>")
+	for _, key := range names {
+		obj := s.objects[bucket+"/"+key]
+		_, _ = fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size><LastModified>%s</LastModified></Contents>",
+			key, len(obj.data), obj.modTime.UTC().Format(time.RFC3339))
+	}
+
+	if truncated {
+		_, _ = fmt.Fprintf(w, "<IsTruncated>true</IsTruncated><NextContinuationToken>%s</NextContinuationToken>", names[len(names)-1])
+	} else {
+		_, _ = fmt.Fprint(w, "<IsTruncated>false</IsTruncated>")
+	}
+	_, _ = fmt.Fprint(w, "</ListBucketResult>")
+}
+
+// SetModTime changes the modification time of an object. It is used to make objects look old.
+func (s *Server) SetModTime(bucket, key string, modTime time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if obj, ok := s.objects[bucket+"/"+key]; ok {
+		obj.modTime = modTime
+		s.objects[bucket+"/"+key] = obj
+	}
+}
+
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, name string) {
+	source, _ := url.PathUnescape(strings.TrimPrefix(r.Header.Get("x-amz-copy-source"), "/"))
+	obj, ok := s.objects[source]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey", source)
+		return
+	}
+
+	s.objects[name] = object{data: append([]byte(nil), obj.data...), modTime: time.Now()}
+	_, _ = fmt.Fprintf(w, "<CopyObjectResult><ETag>%s</ETag></CopyObjectResult>", etag(obj.data))
+}
+
+func (s *Server) initiateUpload(w http.ResponseWriter, name string) {
+	s.uploadID++
+	id := strconv.Itoa(s.uploadID)
+	s.uploads[id] = &multipartUpload{key: name, parts: make(map[int][]byte)}
+	_, _ = fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, query url.Values) {
+	upload, ok := s.uploads[query.Get("uploadId")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", query.Get("uploadId"))
+		return
+	}
+
+	partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+	data, _ := io.ReadAll(r.Body)
+	upload.parts[partNumber] = data
+	w.Header().Set("ETag", etag(data))
+}
+
+func (s *Server) completeUpload(w http.ResponseWriter, r *http.Request, name, uploadID string) {
+	upload, ok := s.uploads[uploadID]
+	if !ok || upload.key != name {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", uploadID)
+		return
+	}
+
+	var complete struct {
+		Parts []struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&complete); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+
+	var data []byte
+	for _, part := range complete.Parts {
+		partData, ok := upload.parts[part.PartNumber]
+		if !ok || etag(partData) != part.ETag {
+			writeError(w, http.StatusBadRequest, "InvalidPart", strconv.Itoa(part.PartNumber))
+			return
+		}
+		data = append(data, partData...)
+	}
+
+	delete(s.uploads, uploadID)
+	s.objects[name] = object{data: data, modTime: time.Now()}
+	_, _ = fmt.Fprintf(w, "<CompleteMultipartUploadResult><Key>%s</Key></CompleteMultipartUploadResult>", name)
+}
+
+func parseRange(rng string, size int64) (int64, int64, error) {
+	spec, ok := strings.CutPrefix(rng, "bytes=")
+	if !ok {
+		return 0, 0, fmt.Errorf("bad range %s", rng)
+	}
+
+	startStr, endStr, _ := strings.Cut(spec, "-")
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, fmt.Errorf("bad range %s", rng)
+	}
+
+	end := size - 1
+	if endStr != "" {
+		if end, err = strconv.ParseInt(endStr, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("bad range %s", rng)
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	return start, end, nil
+}
+
+func etag(data []byte) string {
+	return fmt.Sprintf("\"%x\"", md5.Sum(data))
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, message)
+}
@@ -0,0 +1,150 @@
+package blobstore
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LocalBlobStore keeps blobs as regular files under a root directory. Given the key
+// xx/yy/<uuid> the blob is stored at <root>/xx/yy/<uuid>, which is the layout
+// Materials Commons has always used for MCFS_DIR.
+type LocalBlobStore struct {
+	root string
+}
+
+func NewLocalBlobStore(root string) *LocalBlobStore {
+	return &LocalBlobStore{root: root}
+}
+
+// Root returns the directory the blobs are stored under.
+func (s *LocalBlobStore) Root() string {
+	return s.root
+}
+
+// Path returns the filesystem path for key.
+func (s *LocalBlobStore) Path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+func (s *LocalBlobStore) Open(key string, offset int64) (Reader, error) {
+	f, err := os.Open(s.Path(key))
+	if err != nil {
+		return nil, err
+	}
+
+	if offset != 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func (s *LocalBlobStore) Create(key string) (Writer, error) {
+	if err := s.mkdirFor(key); err != nil {
+		return nil, err
+	}
+
+	return os.Create(s.Path(key))
+}
+
+// Append opens the file without O_APPEND, and instead seeks to the end. O_APPEND would
+// make WriteAt unusable, and resumed uploads write chunks at explicit offsets.
+func (s *LocalBlobStore) Append(key string) (Writer, error) {
+	if err := s.mkdirFor(key); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(s.Path(key), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (s *LocalBlobStore) Stat(key string) (BlobInfo, error) {
+	finfo, err := os.Stat(s.Path(key))
+	if err != nil {
+		return BlobInfo{}, err
+	}
+
+	return BlobInfo{Key: key, Size: finfo.Size(), ModTime: finfo.ModTime()}, nil
+}
+
+func (s *LocalBlobStore) Delete(key string) error {
+	if err := os.Remove(s.Path(key)); err != nil && !IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *LocalBlobStore) Rename(fromKey, toKey string) error {
+	if err := s.mkdirFor(toKey); err != nil {
+		return err
+	}
+
+	return os.Rename(s.Path(fromKey), s.Path(toKey))
+}
+
+func (s *LocalBlobStore) Walk(fn func(info BlobInfo) error) error {
+	level1, err := os.ReadDir(s.root)
+	if err != nil {
+		return err
+	}
+
+	for _, d1 := range level1 {
+		if !d1.IsDir() || !isShardName(d1.Name()) {
+			continue
+		}
+
+		level2, err := os.ReadDir(filepath.Join(s.root, d1.Name()))
+		if err != nil {
+			return err
+		}
+
+		for _, d2 := range level2 {
+			if !d2.IsDir() || !isShardName(d2.Name()) {
+				continue
+			}
+
+			entries, err := os.ReadDir(filepath.Join(s.root, d1.Name(), d2.Name()))
+			if err != nil {
+				return err
+			}
+
+			for _, entry := range entries {
+				if !entry.Type().IsRegular() {
+					continue
+				}
+
+				finfo, err := entry.Info()
+				if err != nil {
+					// The file was removed after the directory was read.
+					continue
+				}
+
+				key := d1.Name() + "/" + d2.Name() + "/" + entry.Name()
+				if err := fn(BlobInfo{Key: key, Size: finfo.Size(), ModTime: finfo.ModTime()}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// mkdirFor creates the directory that the blob for key lives in.
+func (s *LocalBlobStore) mkdirFor(key string) error {
+	return os.MkdirAll(filepath.Dir(s.Path(key)), 0755)
+}
@@ -0,0 +1,525 @@
+package blobstore
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultPartSize is the size of each part in a multipart upload. Blobs at or
+// below this size are uploaded with a single PUT.
+const defaultPartSize int64 = 64 * 1024 * 1024
+
+// S3Config describes how to reach an S3 compatible bucket. Requests use path style
+// addressing (<endpoint>/<bucket>/<key>) so that MinIO, Ceph and other stand-ins work.
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+
+	// SpoolDir is where blobs being written are staged before they are uploaded. S3 objects
+	// can't be written at an offset, so writers stage to a local file and upload on Close.
+	SpoolDir string
+
+	// PartSize is the multipart upload part size. Defaults to 64MiB.
+	PartSize int64
+
+	// Client is the http.Client to use. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// S3BlobStore stores blobs as objects in an S3 compatible bucket. The object
+// name is the blob key with S3Config.Prefix prepended.
+type S3BlobStore struct {
+	cfg S3Config
+	now func() time.Time
+}
+
+func NewS3BlobStore(cfg S3Config) *S3BlobStore {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	if cfg.PartSize <= 0 {
+		cfg.PartSize = defaultPartSize
+	}
+
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+
+	if cfg.SpoolDir == "" {
+		cfg.SpoolDir = os.TempDir()
+	}
+
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	return &S3BlobStore{cfg: cfg, now: time.Now}
+}
+
+// S3Error is returned when the S3 service responds with an error status. A 404
+// response satisfies errors.Is(err, fs.ErrNotExist).
+type S3Error struct {
+	Op         string
+	Key        string
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("s3 %s %s: %d %s %s", e.Op, e.Key, e.StatusCode, e.Code, e.Message)
+}
+
+func (e *S3Error) Is(target error) bool {
+	return target == fs.ErrNotExist && (e.StatusCode == http.StatusNotFound || e.Code == "NoSuchKey")
+}
+
+func (s *S3BlobStore) Open(key string, offset int64) (Reader, error) {
+	info, err := s.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Reader{store: s, key: key, size: info.Size, offset: offset}, nil
+}
+
+func (s *S3BlobStore) Create(key string) (Writer, error) {
+	spool, err := os.CreateTemp(s.cfg.SpoolDir, "blob-*")
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Writer{store: s, key: key, spool: spool}, nil
+}
+
+// Append downloads the existing object into the spool file so that writes continue
+// from the end of it.
+func (s *S3BlobStore) Append(key string) (Writer, error) {
+	w, err := s.Create(key)
+	if err != nil {
+		return nil, err
+	}
+
+	spool := w.(*s3Writer).spool
+	resp, err := s.do(http.MethodGet, key, nil, nil, nil, emptyPayloadHash)
+	switch {
+	case err == nil:
+		_, err = io.Copy(spool, resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			w.(*s3Writer).discard()
+			return nil, err
+		}
+	case errors.Is(err, fs.ErrNotExist):
+		// Nothing to append to, this is the same as a Create.
+	default:
+		w.(*s3Writer).discard()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (s *S3BlobStore) Stat(key string) (BlobInfo, error) {
+	resp, err := s.do(http.MethodHead, key, nil, nil, nil, emptyPayloadHash)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	_ = resp.Body.Close()
+
+	info := BlobInfo{Key: key, Size: resp.ContentLength}
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		info.ModTime, _ = http.ParseTime(lastModified)
+	}
+
+	return info, nil
+}
+
+func (s *S3BlobStore) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, nil, nil, emptyPayloadHash)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// Rename is a server side copy followed by a delete of the source object. S3 has no
+// rename, so there is a window where both objects exist.
+func (s *S3BlobStore) Rename(fromKey, toKey string) error {
+	headers := http.Header{}
+	headers.Set("x-amz-copy-source", "/"+s.cfg.Bucket+"/"+uriEncode(s.objectName(fromKey), false))
+	resp, err := s.do(http.MethodPut, toKey, nil, headers, nil, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+
+	// A copy can fail after S3 has already sent a 200, in which case the body holds the error.
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if bytes.Contains(body, []byte("<Error>")) {
+		return s3ErrorFromBody("copy", toKey, http.StatusInternalServerError, body)
+	}
+
+	return s.Delete(fromKey)
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string `xml:"Key"`
+		Size         int64  `xml:"Size"`
+		LastModified string `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// Walk pages through the bucket with ListObjectsV2, restricted to S3Config.Prefix.
+func (s *S3BlobStore) Walk(fn func(info BlobInfo) error) error {
+	continuationToken := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.cfg.Prefix}}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+
+		resp, err := s.send(http.MethodGet, s.cfg.Endpoint+"/"+s.cfg.Bucket+"?"+query.Encode(), s.cfg.Bucket, nil, nil, emptyPayloadHash)
+		if err != nil {
+			return err
+		}
+
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, obj := range result.Contents {
+			key := strings.TrimPrefix(obj.Key, s.cfg.Prefix)
+			if !IsShardedKey(key) {
+				continue
+			}
+
+			info := BlobInfo{Key: key, Size: obj.Size}
+			info.ModTime, _ = time.Parse(time.RFC3339, obj.LastModified)
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+func (s *S3BlobStore) objectName(key string) string {
+	return s.cfg.Prefix + strings.TrimPrefix(key, "/")
+}
+
+func (s *S3BlobStore) objectURL(key string, query url.Values) string {
+	u := s.cfg.Endpoint + "/" + s.cfg.Bucket + "/" + uriEncode(s.objectName(key), false)
+	if len(query) != 0 {
+		u = u + "?" + query.Encode()
+	}
+
+	return u
+}
+
+// do builds, signs and sends a request for key. Any non 2xx response is turned into an *S3Error.
+func (s *S3BlobStore) do(method, key string, query url.Values, headers http.Header, body io.Reader, payloadHash string) (*http.Response, error) {
+	return s.send(method, s.objectURL(key, query), key, headers, body, payloadHash)
+}
+
+// send signs and sends a request to u. The key is only used for error messages.
+func (s *S3BlobStore) send(method, u, key string, headers http.Header, body io.Reader, payloadHash string) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range headers {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+
+	if sized, ok := body.(interface{ Size() int64 }); ok {
+		req.ContentLength = sized.Size()
+		if req.ContentLength == 0 {
+			// Otherwise net/http treats the length as unknown and uses chunked encoding, which S3 rejects.
+			req.Body = http.NoBody
+		}
+	}
+
+	signV4(req, s.cfg.AccessKey, s.cfg.SecretKey, s.cfg.Region, payloadHash, s.now())
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		errBody, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, s3ErrorFromBody(strings.ToLower(method), key, resp.StatusCode, errBody)
+	}
+
+	return resp, nil
+}
+
+func s3ErrorFromBody(op, key string, statusCode int, body []byte) error {
+	s3err := &S3Error{Op: op, Key: key, StatusCode: statusCode}
+	_ = xml.Unmarshal(body, s3err)
+	return s3err
+}
+
+// upload sends the contents of spool to key. Small blobs use a single PUT, larger ones
+// use a multipart upload.
+func (s *S3BlobStore) upload(key string, spool *os.File) error {
+	finfo, err := spool.Stat()
+	if err != nil {
+		return err
+	}
+
+	if finfo.Size() <= s.cfg.PartSize {
+		resp, err := s.do(http.MethodPut, key, nil, nil, io.NewSectionReader(spool, 0, finfo.Size()), unsignedPayload)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	return s.multipartUpload(key, spool, finfo.Size())
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+func (s *S3BlobStore) multipartUpload(key string, spool *os.File, size int64) error {
+	resp, err := s.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	_ = resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	abort := func() {
+		if resp, err := s.do(http.MethodDelete, key, url.Values{"uploadId": {initiated.UploadID}}, nil, nil, emptyPayloadHash); err == nil {
+			_ = resp.Body.Close()
+		}
+	}
+
+	var complete completeMultipartUpload
+	for partNumber, offset := 1, int64(0); offset < size; partNumber, offset = partNumber+1, offset+s.cfg.PartSize {
+		partSize := s.cfg.PartSize
+		if offset+partSize > size {
+			partSize = size - offset
+		}
+
+		query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {initiated.UploadID}}
+		resp, err := s.do(http.MethodPut, key, query, nil, io.NewSectionReader(spool, offset, partSize), unsignedPayload)
+		if err != nil {
+			abort()
+			return err
+		}
+		_ = resp.Body.Close()
+
+		complete.Parts = append(complete.Parts, completedPart{PartNumber: partNumber, ETag: resp.Header.Get("ETag")})
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		abort()
+		return err
+	}
+
+	resp, err = s.do(http.MethodPost, key, url.Values{"uploadId": {initiated.UploadID}}, nil, bytes.NewReader(body), sha256Hex(body))
+	if err != nil {
+		abort()
+		return err
+	}
+
+	// Like copy, completing an upload can return a 200 with an error in the body.
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if bytes.Contains(respBody, []byte("<Error>")) {
+		abort()
+		return s3ErrorFromBody("complete", key, http.StatusInternalServerError, respBody)
+	}
+
+	return nil
+}
+
+// s3Reader reads an object using ranged GETs. Sequential reads stream a single response
+// starting at the current offset; ReadAt issues a request per call.
+type s3Reader struct {
+	store  *S3BlobStore
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *s3Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		headers := http.Header{}
+		headers.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+		resp, err := r.store.do(http.MethodGet, r.key, nil, headers, nil, emptyPayloadHash)
+		if err != nil {
+			return 0, err
+		}
+		r.body = resp.Body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *s3Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	end := off + int64(len(p)) - 1
+	if end >= r.size {
+		end = r.size - 1
+	}
+
+	headers := http.Header{}
+	headers.Set("Range", fmt.Sprintf("bytes=%d-%d", off, end))
+	resp, err := r.store.do(http.MethodGet, r.key, nil, headers, nil, emptyPayloadHash)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	n, err := io.ReadFull(resp.Body, p[:end-off+1])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+func (r *s3Reader) Seek(offset int64, whence int) (int64, error) {
+	var newOffset int64
+	switch whence {
+	case io.SeekStart:
+		newOffset = offset
+	case io.SeekCurrent:
+		newOffset = r.offset + offset
+	case io.SeekEnd:
+		newOffset = r.size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+
+	if newOffset < 0 {
+		return 0, fmt.Errorf("negative offset %d", newOffset)
+	}
+
+	if newOffset != r.offset {
+		r.closeBody()
+		r.offset = newOffset
+	}
+
+	return newOffset, nil
+}
+
+func (r *s3Reader) Close() error {
+	r.closeBody()
+	return nil
+}
+
+func (r *s3Reader) closeBody() {
+	if r.body != nil {
+		_ = r.body.Close()
+		r.body = nil
+	}
+}
+
+// s3Writer stages writes in a local spool file and uploads it on Close.
+type s3Writer struct {
+	store  *S3BlobStore
+	key    string
+	spool  *os.File
+	closed bool
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.spool.Write(p)
+}
+
+func (w *s3Writer) WriteAt(p []byte, off int64) (int, error) {
+	return w.spool.WriteAt(p, off)
+}
+
+func (w *s3Writer) Truncate(size int64) error {
+	return w.spool.Truncate(size)
+}
+
+func (w *s3Writer) Sync() error {
+	return w.spool.Sync()
+}
+
+// Close uploads the spooled contents. Only the first call uploads, later calls return nil.
+func (w *s3Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+
+	w.closed = true
+	defer w.discard()
+	return w.store.upload(w.key, w.spool)
+}
+
+func (w *s3Writer) discard() {
+	_ = w.spool.Close()
+	_ = os.Remove(w.spool.Name())
+}
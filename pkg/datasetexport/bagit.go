@@ -0,0 +1,124 @@
+package datasetexport
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	bagItVersion     = "1.0"
+	bagSoftwareAgent = "Materials Commons hydra"
+	bagSourceOrg     = "Materials Commons"
+	bagPayloadDir    = "data"
+)
+
+// writeBag writes the dataset as a BagIt bag whose payload is the dataset's RO-Crate.
+func (e *Exporter) writeBag(c *content, dir string) ([]payloadFile, error) {
+	payloadDir := filepath.Join(dir, bagPayloadDir)
+	if err := os.Mkdir(payloadDir, 0755); err != nil {
+		return nil, err
+	}
+
+	payload, err := e.writeROCrate(c, payloadDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var tagFiles []payloadFile
+	writeTagFile := func(name string, data []byte) error {
+		pf, err := writeFile(dir, name, data)
+		if err != nil {
+			return err
+		}
+		tagFiles = append(tagFiles, pf)
+		return nil
+	}
+
+	bagit := fmt.Sprintf("BagIt-Version: %s\nTag-File-Character-Encoding: UTF-8\n", bagItVersion)
+	if err := writeTagFile("bagit.txt", []byte(bagit)); err != nil {
+		return nil, err
+	}
+
+	if err := writeTagFile("bag-info.txt", c.bagInfo(payload)); err != nil {
+		return nil, err
+	}
+
+	if err := writeTagFile("manifest-sha256.txt", manifest(payload, bagPayloadDir+"/", sha256Of)); err != nil {
+		return nil, err
+	}
+
+	if err := writeTagFile("manifest-md5.txt", manifest(payload, bagPayloadDir+"/", md5Of)); err != nil {
+		return nil, err
+	}
+
+	// The tag manifest covers every tag file other than the tag manifests themselves.
+	if _, err := writeFile(dir, "tagmanifest-sha256.txt", manifest(tagFiles, "", sha256Of)); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// bagInfo returns the contents of bag-info.txt. The fields are always written in the same order.
+func (c *content) bagInfo(payload []payloadFile) []byte {
+	var totalSize int64
+	for _, pf := range payload {
+		totalSize += pf.size
+	}
+
+	var b bytes.Buffer
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", name, tagValue(value))
+		}
+	}
+
+	field("Bag-Software-Agent", bagSoftwareAgent)
+	field("Bagging-Date", datasetDate(c.dataset).Format(time.DateOnly))
+	field("External-Description", c.dataset.Name)
+	if c.dataset.DOI != "" {
+		field("External-Identifier", doiURL(c.dataset.DOI))
+	}
+	field("Internal-Sender-Identifier", c.dataset.UUID)
+	field("Payload-Oxum", fmt.Sprintf("%d.%d", totalSize, len(payload)))
+	field("Source-Organization", bagSourceOrg)
+
+	return b.Bytes()
+}
+
+func sha256Of(pf payloadFile) string {
+	return pf.sums.SHA256
+}
+
+func md5Of(pf payloadFile) string {
+	return pf.sums.MD5
+}
+
+// manifest returns the contents of a manifest listing files, one "<checksum>  <path>" line per file
+// sorted by path. prefix is prepended to each path.
+func manifest(files []payloadFile, prefix string, checksum func(pf payloadFile) string) []byte {
+	sorted := append([]payloadFile(nil), files...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].path < sorted[j].path })
+
+	var b bytes.Buffer
+	for _, pf := range sorted {
+		fmt.Fprintf(&b, "%s  %s\n", checksum(pf), manifestPath(prefix+pf.path))
+	}
+
+	return b.Bytes()
+}
+
+// manifestPath encodes the characters RFC 8493 requires to be percent-encoded in manifest paths.
+func manifestPath(path string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(path)
+}
+
+// tagValue keeps a bag-info.txt value on a single line.
+func tagValue(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
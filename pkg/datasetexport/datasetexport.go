@@ -0,0 +1,215 @@
+// Package datasetexport exports a dataset in formats other data repositories understand. Two formats are
+// supported:
+//
+//   - RO-Crate: the dataset's files along with a ro-crate-metadata.json that describes the dataset, its
+//     files, the samples (entities) selected by its entity template, the processes (activities) performed
+//     on them, and their attributes.
+//   - BagIt: a bag (RFC 8493) whose payload is the RO-Crate, with SHA-256 and MD5 manifests for the payload
+//     and a SHA-256 manifest for the tag files.
+//
+// Exports are deterministic, exporting the same dataset twice produces byte for byte identical output.
+// Dates come from the dataset rather than the time of the export, and everything is written in a fixed
+// order. An export is written to a temporary directory next to the destination and renamed into place
+// once it is complete.
+package datasetexport
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+)
+
+// Export formats.
+const (
+	FormatBagIt   = "bagit"
+	FormatROCrate = "ro-crate"
+)
+
+// Report describes a completed export.
+type Report struct {
+	DatasetID int    `json:"dataset_id"`
+	Format    string `json:"format"`
+	Dir       string `json:"dir"`
+	FileCount int    `json:"file_count"`
+	TotalSize int64  `json:"total_size"`
+}
+
+type Exporter struct {
+	datasetStor stor.DatasetStor
+	blobs       blobstore.BlobStore
+}
+
+func NewExporter(datasetStor stor.DatasetStor, blobs blobstore.BlobStore) *Exporter {
+	return &Exporter{datasetStor: datasetStor, blobs: blobs}
+}
+
+// Export writes the dataset in format to dir. dir must not exist, or must be empty.
+func (e *Exporter) Export(datasetID int, format string, dir string) (*Report, error) {
+	var write func(c *content, dir string) ([]payloadFile, error)
+	switch format {
+	case FormatBagIt:
+		write = e.writeBag
+	case FormatROCrate:
+		write = e.writeROCrate
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+
+	if err := checkDestination(dir); err != nil {
+		return nil, err
+	}
+
+	c, err := e.load(datasetID)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp(filepath.Dir(filepath.Clean(dir)), ".export-*")
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := write(c, tmpDir)
+	if err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return nil, err
+	}
+
+	// MkdirTemp creates the directory 0700, give the export the usual permissions.
+	if err := os.Chmod(tmpDir, 0755); err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return nil, err
+	}
+
+	if err := os.Rename(tmpDir, dir); err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return nil, err
+	}
+
+	report := &Report{DatasetID: datasetID, Format: format, Dir: dir, FileCount: len(c.files)}
+	for _, f := range files {
+		report.TotalSize += f.size
+	}
+
+	return report, nil
+}
+
+// content is everything in the dataset that gets exported.
+type content struct {
+	dataset          *mcmodel.Dataset
+	files            []mcmodel.File
+	entities         []mcmodel.Entity
+	activities       []mcmodel.Activity
+	activityEntities map[int][]int
+}
+
+func (e *Exporter) load(datasetID int) (*content, error) {
+	dataset, err := e.datasetStor.GetDatasetByID(datasetID)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &content{dataset: dataset}
+
+	if c.files, err = e.datasetStor.ListSelectedFiles(dataset); err != nil {
+		return nil, fmt.Errorf("unable to list files for dataset %d: %w", datasetID, err)
+	}
+
+	if c.entities, err = e.datasetStor.ListDatasetEntities(dataset); err != nil {
+		return nil, fmt.Errorf("unable to list entities for dataset %d: %w", datasetID, err)
+	}
+
+	entityIDs := make([]int, 0, len(c.entities))
+	for _, entity := range c.entities {
+		entityIDs = append(entityIDs, entity.ID)
+	}
+
+	if c.activities, c.activityEntities, err = e.datasetStor.ListActivitiesForEntities(entityIDs); err != nil {
+		return nil, fmt.Errorf("unable to list activities for dataset %d: %w", datasetID, err)
+	}
+
+	return c, nil
+}
+
+// payloadFile is a file written into an export. path is relative to the directory it was written to,
+// and is always slash separated.
+type payloadFile struct {
+	path string
+	size int64
+	sums digest.Sums
+}
+
+// copyFile copies the contents of file into dir at its project path, computing its checksums as it
+// goes. A file whose contents don't match its stored checksum fails the export.
+func (e *Exporter) copyFile(file mcmodel.File, dir string) (payloadFile, error) {
+	pf := payloadFile{path: relativePath(file)}
+
+	r, err := e.blobs.Open(file.BlobKey(), 0)
+	if err != nil {
+		return pf, fmt.Errorf("unable to open %s (file %d): %w", file.FullPath(), file.ID, err)
+	}
+	defer r.Close()
+
+	dest := filepath.Join(dir, filepath.FromSlash(pf.path))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return pf, err
+	}
+
+	w, err := os.Create(dest)
+	if err != nil {
+		return pf, err
+	}
+
+	hasher := digest.New()
+	pf.size, err = io.Copy(io.MultiWriter(w, hasher), r)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return pf, fmt.Errorf("unable to copy %s (file %d): %w", file.FullPath(), file.ID, err)
+	}
+
+	pf.sums = hasher.Sums()
+	if !pf.sums.Matches(file.Sums()) && !file.Sums().IsZero() {
+		return pf, fmt.Errorf("%s (file %d) doesn't match its checksum", file.FullPath(), file.ID)
+	}
+
+	return pf, nil
+}
+
+// writeFile writes data to dir at the relative path name, and returns its checksums.
+func writeFile(dir, name string, data []byte) (payloadFile, error) {
+	if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), data, 0644); err != nil {
+		return payloadFile{}, err
+	}
+
+	h := digest.New()
+	_, _ = h.Write(data)
+	return payloadFile{path: name, size: int64(len(data)), sums: h.Sums()}, nil
+}
+
+// relativePath is the path a file is exported at, its project path without the leading slash.
+func relativePath(file mcmodel.File) string {
+	return file.FullPath()[1:]
+}
+
+// checkDestination returns an error unless dir doesn't exist or is an empty directory.
+func checkDestination(dir string) error {
+	entries, err := os.ReadDir(dir)
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return err
+	case len(entries) != 0:
+		return fmt.Errorf("export destination %s is not empty", dir)
+	}
+
+	return nil
+}
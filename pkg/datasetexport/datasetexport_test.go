@@ -0,0 +1,290 @@
+package datasetexport
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type fixture struct {
+	db       *gorm.DB
+	exporter *Exporter
+	dataset  *mcmodel.Dataset
+	sample   *mcmodel.Entity
+	process  *mcmodel.Activity
+	image    *mcmodel.File
+}
+
+func newFixture(t *testing.T) *fixture {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	blobs := blobstore.NewLocalBlobStore(t.TempDir())
+
+	user := b.User("user1")
+	proj := b.Project("proj1", user)
+	raw := b.Dir(proj, proj.RootDir, "raw")
+	images := b.Dir(proj, proj.RootDir, "images")
+	addFile(t, b, blobs, proj, raw, "a.csv", "1,2,3\n")
+	addFile(t, b, blobs, proj, raw, "b.csv", "4,5,6\n")
+	addFile(t, b, blobs, proj, proj.RootDir, "notes.txt", "not in the dataset")
+	image := addFile(t, b, blobs, proj, images, "grain 100%.png", "png")
+
+	sample := b.Entity(proj, "Sample 1")
+	b.EntityStateAttribute(&sample.EntityStates[0], "composition", "Mg-2%Al", "")
+	b.EntityStateAttribute(&sample.EntityStates[0], "thickness", 1.5, "mm")
+	b.AddFileToEntity(sample, image)
+
+	process := b.Activity(proj, "Heat Treatment")
+	b.ActivityAttribute(process, "temperature", 300, "c")
+	b.Link(process, sample)
+
+	// Not in the dataset.
+	other := b.Entity(proj, "Sample 2")
+	b.Link(b.Activity(proj, "Polish"), other)
+
+	ds := b.Dataset(proj, "Heat Treated Mg")
+	published := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, db.Model(ds).Updates(map[string]interface{}{
+		"file_selection": `{"include_dirs": ["/raw"]}`,
+		"description":    "Heat treatment of Mg samples",
+		"doi":            "10.1234/mc.1",
+		"license":        "Open Database License (ODC-ODbL)",
+		"license_link":   "https://opendatacommons.org/licenses/odbl/summary/",
+		"published_at":   published,
+	}).Error)
+	b.AddEntityToDataset(ds, sample)
+
+	return &fixture{
+		db:       db,
+		exporter: NewExporter(stor.NewGormDatasetStor(db), blobs),
+		dataset:  ds,
+		sample:   sample,
+		process:  process,
+		image:    image,
+	}
+}
+
+func TestROCrate(t *testing.T) {
+	f := newFixture(t)
+	dir := filepath.Join(t.TempDir(), "crate")
+
+	report, err := f.exporter.Export(f.dataset.ID, FormatROCrate, dir)
+	require.NoError(t, err)
+	require.Equal(t, 3, report.FileCount)
+
+	require.Equal(t, map[string]string{
+		"raw/a.csv":             "1,2,3\n",
+		"raw/b.csv":             "4,5,6\n",
+		"images/grain 100%.png": "png",
+		ROCrateMetadataName:     readFile(t, dir, ROCrateMetadataName),
+	}, readTree(t, dir))
+
+	var crate struct {
+		Context []interface{}            `json:"@context"`
+		Graph   []map[string]interface{} `json:"@graph"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(readFile(t, dir, ROCrateMetadataName)), &crate))
+	require.Equal(t, "https://w3id.org/ro/crate/1.1/context", crate.Context[0])
+
+	graph := make(map[string]map[string]interface{})
+	for _, n := range crate.Graph {
+		graph[n["@id"].(string)] = n
+	}
+
+	require.Equal(t, ROCrateMetadataName, crate.Graph[0]["@id"])
+	require.Equal(t, "./", crate.Graph[1]["@id"])
+
+	root := graph["./"]
+	require.Equal(t, "Heat Treated Mg", root["name"])
+	require.Equal(t, "2024-03-01T12:00:00Z", root["datePublished"])
+	require.Equal(t, "https://doi.org/10.1234/mc.1", root["identifier"])
+	require.Equal(t, map[string]interface{}{"@id": "https://opendatacommons.org/licenses/odbl/summary/"}, root["license"])
+	require.Len(t, root["hasPart"], 3)
+
+	imageNode := graph["images/grain 100%.png"]
+	require.Equal(t, "File", imageNode["@type"])
+	require.Equal(t, "3", imageNode["contentSize"])
+	require.Equal(t, sha256Hex("png"), imageNode["sha256"])
+	require.Equal(t, []interface{}{map[string]interface{}{"@id": sampleID(f.sample.ID)}}, imageNode["about"])
+
+	sample := graph[sampleID(f.sample.ID)]
+	require.Equal(t, "Sample", sample["@type"])
+	require.Len(t, sample["additionalProperty"], 2)
+
+	process := graph[processID(f.process.ID)]
+	require.Equal(t, "CreateAction", process["@type"])
+	require.Equal(t, []interface{}{map[string]interface{}{"@id": sampleID(f.sample.ID)}}, process["object"])
+
+	var temperature map[string]interface{}
+	for _, n := range crate.Graph {
+		if n["@type"] == "PropertyValue" && n["name"] == "temperature" {
+			temperature = n
+		}
+	}
+	require.Equal(t, float64(300), temperature["value"])
+	require.Equal(t, "c", temperature["unitText"])
+
+	// Only the dataset's sample and the processes performed on it are described.
+	for _, n := range crate.Graph {
+		require.NotEqual(t, "Sample 2", n["name"])
+		require.NotEqual(t, "Polish", n["name"])
+	}
+}
+
+func TestBag(t *testing.T) {
+	f := newFixture(t)
+	dir := filepath.Join(t.TempDir(), "bag")
+
+	report, err := f.exporter.Export(f.dataset.ID, FormatBagIt, dir)
+	require.NoError(t, err)
+	require.Equal(t, 3, report.FileCount)
+
+	require.Equal(t, "BagIt-Version: 1.0\nTag-File-Character-Encoding: UTF-8\n", readFile(t, dir, "bagit.txt"))
+
+	// Every payload file is in the manifests with its checksum, and nothing else is.
+	tree := readTree(t, dir)
+	var payload []string
+	var payloadSize int
+	for path, contents := range tree {
+		if strings.HasPrefix(path, "data/") {
+			payload = append(payload, path)
+			payloadSize += len(contents)
+		}
+	}
+	require.Len(t, payload, 4)
+
+	sha256Manifest := parseManifest(t, readFile(t, dir, "manifest-sha256.txt"))
+	md5Manifest := parseManifest(t, readFile(t, dir, "manifest-md5.txt"))
+	require.Len(t, sha256Manifest, len(payload))
+	require.Len(t, md5Manifest, len(payload))
+	for _, path := range payload {
+		encoded := strings.ReplaceAll(path, "%", "%25")
+		require.Equal(t, sha256Hex(tree[path]), sha256Manifest[encoded], path)
+		require.Equal(t, md5Hex(tree[path]), md5Manifest[encoded], path)
+	}
+
+	tagManifest := parseManifest(t, readFile(t, dir, "tagmanifest-sha256.txt"))
+	require.Len(t, tagManifest, 4)
+	for path, sum := range tagManifest {
+		require.Equal(t, sha256Hex(tree[path]), sum, path)
+	}
+
+	bagInfo := readFile(t, dir, "bag-info.txt")
+	require.Contains(t, bagInfo, "Bagging-Date: 2024-03-01\n")
+	require.Contains(t, bagInfo, "External-Identifier: https://doi.org/10.1234/mc.1\n")
+	require.Contains(t, bagInfo, "Internal-Sender-Identifier: "+f.dataset.UUID+"\n")
+	require.Contains(t, bagInfo, fmt.Sprintf("Payload-Oxum: %d.%d\n", payloadSize, len(payload)))
+}
+
+func TestExportIsDeterministic(t *testing.T) {
+	f := newFixture(t)
+	parent := t.TempDir()
+
+	for _, format := range []string{FormatBagIt, FormatROCrate} {
+		first := filepath.Join(parent, format+"-1")
+		second := filepath.Join(parent, format+"-2")
+
+		_, err := f.exporter.Export(f.dataset.ID, format, first)
+		require.NoError(t, err)
+		_, err = f.exporter.Export(f.dataset.ID, format, second)
+		require.NoError(t, err)
+
+		require.Equal(t, readTree(t, first), readTree(t, second), format)
+	}
+}
+
+func TestExportFailures(t *testing.T) {
+	f := newFixture(t)
+	parent := t.TempDir()
+
+	_, err := f.exporter.Export(f.dataset.ID, "zip", filepath.Join(parent, "zip"))
+	require.Error(t, err)
+
+	notEmpty := filepath.Join(parent, "not-empty")
+	require.NoError(t, os.MkdirAll(notEmpty, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(notEmpty, "x"), []byte("x"), 0644))
+	_, err = f.exporter.Export(f.dataset.ID, FormatBagIt, notEmpty)
+	require.Error(t, err)
+
+	// A file whose contents don't match its checksum fails the export, and leaves nothing behind.
+	require.NoError(t, f.db.Model(f.image).Update("checksum", md5Hex("not the contents")).Error)
+	_, err = f.exporter.Export(f.dataset.ID, FormatBagIt, filepath.Join(parent, "corrupt"))
+	require.Error(t, err)
+
+	entries, err := os.ReadDir(parent)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func addFile(t *testing.T, b *mcdbtest.Builder, blobs blobstore.BlobStore, proj *mcmodel.Project, dir *mcmodel.File, name, content string) *mcmodel.File {
+	f := b.File(proj, dir, name, uint64(len(content)))
+	w, err := blobs.Create(f.BlobKey())
+	require.NoError(t, err)
+	_, err = w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return f
+}
+
+func readFile(t *testing.T, dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	require.NoError(t, err)
+	return string(data)
+}
+
+// readTree returns the contents of every file under dir, keyed by slash separated relative path.
+func readTree(t *testing.T, dir string) map[string]string {
+	tree := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		tree[filepath.ToSlash(rel)] = string(data)
+		return err
+	})
+	require.NoError(t, err)
+	return tree
+}
+
+// parseManifest returns the checksums in a manifest keyed by path.
+func parseManifest(t *testing.T, manifest string) map[string]string {
+	sums := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSuffix(manifest, "\n"), "\n") {
+		sum, path, ok := strings.Cut(line, "  ")
+		require.True(t, ok, line)
+		sums[path] = sum
+	}
+	return sums
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,293 @@
+package datasetexport
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+)
+
+// ROCrateMetadataName is the name of the RO-Crate metadata file at the root of the crate.
+const ROCrateMetadataName = "ro-crate-metadata.json"
+
+const (
+	roCrateContext = "https://w3id.org/ro/crate/1.1/context"
+	roCrateProfile = "https://w3id.org/ro/crate/1.1"
+	sampleType     = "https://bioschemas.org/Sample"
+)
+
+// node is a single entity in the RO-Crate @graph. It's a map so encoding/json writes its keys in sorted
+// order, which keeps the metadata file deterministic.
+type node map[string]interface{}
+
+// ref is a reference from one node to another.
+func ref(id string) node {
+	return node{"@id": id}
+}
+
+// writeROCrate copies the dataset's files into dir and writes the ro-crate-metadata.json describing them.
+func (e *Exporter) writeROCrate(c *content, dir string) ([]payloadFile, error) {
+	files := make([]payloadFile, 0, len(c.files)+1)
+	for _, file := range c.files {
+		pf, err := e.copyFile(file, dir)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, pf)
+	}
+
+	metadata, err := json.MarshalIndent(c.roCrate(files), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	pf, err := writeFile(dir, ROCrateMetadataName, append(metadata, '\n'))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(files, pf), nil
+}
+
+// roCrate builds the RO-Crate metadata document. files are the copied dataset files, in the same order
+// as c.files.
+func (c *content) roCrate(files []payloadFile) node {
+	var (
+		graph      []node
+		properties []node
+		hasPart    []node
+		about      []node
+		mentions   []node
+	)
+
+	// Samples a file is attached to.
+	fileSamples := make(map[int][]node)
+	for _, entity := range c.entities {
+		for _, file := range entity.Files {
+			fileSamples[file.ID] = append(fileSamples[file.ID], ref(sampleID(entity.ID)))
+		}
+	}
+
+	for i, file := range c.files {
+		n := node{
+			"@id":         files[i].path,
+			"@type":       "File",
+			"name":        file.Name,
+			"contentSize": fmt.Sprintf("%d", files[i].size),
+			"sha256":      files[i].sums.SHA256,
+		}
+
+		if file.MimeType != "" {
+			n["encodingFormat"] = file.MimeType
+		}
+
+		if samples := fileSamples[file.ID]; len(samples) != 0 {
+			n["about"] = samples
+		}
+
+		hasPart = append(hasPart, ref(files[i].path))
+		graph = append(graph, n)
+	}
+
+	for _, entity := range c.entities {
+		n := node{
+			"@id":   sampleID(entity.ID),
+			"@type": "Sample",
+			"name":  entity.Name,
+		}
+
+		if entity.Description != "" {
+			n["description"] = entity.Description
+		}
+
+		var attrRefs []node
+		attrRefs, properties = addProperties(properties, currentState(entity).Attributes)
+		if len(attrRefs) != 0 {
+			n["additionalProperty"] = attrRefs
+		}
+
+		about = append(about, ref(sampleID(entity.ID)))
+		graph = append(graph, n)
+	}
+
+	for _, activity := range c.activities {
+		n := node{
+			"@id":   processID(activity.ID),
+			"@type": "CreateAction",
+			"name":  activity.Name,
+		}
+
+		if activity.Description != "" {
+			n["description"] = activity.Description
+		}
+
+		var objects []node
+		for _, entityID := range c.activityEntities[activity.ID] {
+			objects = append(objects, ref(sampleID(entityID)))
+		}
+		if len(objects) != 0 {
+			n["object"] = objects
+		}
+
+		var attrRefs []node
+		attrRefs, properties = addProperties(properties, activity.Attributes)
+		if len(attrRefs) != 0 {
+			n["additionalProperty"] = attrRefs
+		}
+
+		mentions = append(mentions, ref(processID(activity.ID)))
+		graph = append(graph, n)
+	}
+
+	descriptor := node{
+		"@id":        ROCrateMetadataName,
+		"@type":      "CreativeWork",
+		"about":      ref("./"),
+		"conformsTo": ref(roCrateProfile),
+	}
+
+	graph = append([]node{descriptor, c.roCrateRoot(hasPart, about, mentions)}, graph...)
+	graph = append(graph, properties...)
+
+	return node{
+		"@context": []interface{}{roCrateContext, node{"Sample": sampleType}},
+		"@graph":   graph,
+	}
+}
+
+// roCrateRoot is the root data entity, the dataset itself.
+func (c *content) roCrateRoot(hasPart, about, mentions []node) node {
+	ds := c.dataset
+	root := node{
+		"@id":           "./",
+		"@type":         "Dataset",
+		"name":          ds.Name,
+		"datePublished": datasetDate(ds).Format(time.RFC3339),
+		"hasPart":       nonNil(hasPart),
+	}
+
+	if ds.Description != "" {
+		root["description"] = ds.Description
+	} else if ds.Summary != "" {
+		root["description"] = ds.Summary
+	}
+
+	switch {
+	case ds.LicenseLink != "":
+		root["license"] = ref(ds.LicenseLink)
+	case ds.License != "":
+		root["license"] = ds.License
+	}
+
+	if ds.DOI != "" {
+		root["identifier"] = doiURL(ds.DOI)
+	}
+
+	if ds.Authors != "" {
+		root["creator"] = ds.Authors
+	}
+
+	if len(about) != 0 {
+		root["about"] = about
+	}
+
+	if len(mentions) != 0 {
+		root["mentions"] = mentions
+	}
+
+	return root
+}
+
+// addProperties appends a PropertyValue node to properties for each value of each attribute, and
+// returns references to the new nodes along with the updated properties.
+func addProperties(properties []node, attrs []mcmodel.Attribute) ([]node, []node) {
+	var refs []node
+	for _, attr := range attrs {
+		for _, value := range attr.AttributeValues {
+			n := node{
+				"@id":   propertyID(value.ID),
+				"@type": "PropertyValue",
+				"name":  attr.Name,
+				"value": decodeValue(value.Val),
+			}
+
+			if value.Unit != "" {
+				n["unitText"] = value.Unit
+			}
+
+			refs = append(refs, ref(propertyID(value.ID)))
+			properties = append(properties, n)
+		}
+	}
+
+	return refs, properties
+}
+
+// decodeValue returns the value stored in an attribute value's Val column. Val is a JSON object of the
+// form {"value": ...}, the value is returned as raw JSON so numbers are written exactly as stored. When
+// Val isn't in that form it's returned as is.
+func decodeValue(val string) interface{} {
+	var v struct {
+		Value json.RawMessage `json:"value"`
+	}
+
+	if err := json.Unmarshal([]byte(val), &v); err != nil || len(v.Value) == 0 {
+		return val
+	}
+
+	return v.Value
+}
+
+// currentState returns the entity's current state, or its latest state if none are marked current.
+func currentState(entity mcmodel.Entity) mcmodel.EntityState {
+	for _, state := range entity.EntityStates {
+		if state.Current {
+			return state
+		}
+	}
+
+	if len(entity.EntityStates) == 0 {
+		return mcmodel.EntityState{}
+	}
+
+	states := append([]mcmodel.EntityState(nil), entity.EntityStates...)
+	sort.Slice(states, func(i, j int) bool { return states[i].ID < states[j].ID })
+	return states[len(states)-1]
+}
+
+// datasetDate is the date an export of the dataset is stamped with, when it was published or, for an
+// unpublished dataset, when it was last updated.
+func datasetDate(ds *mcmodel.Dataset) time.Time {
+	if !ds.PublishedAt.IsZero() {
+		return ds.PublishedAt.UTC()
+	}
+
+	return ds.UpdatedAt.UTC()
+}
+
+func doiURL(doi string) string {
+	return "https://doi.org/" + doi
+}
+
+func sampleID(id int) string {
+	return fmt.Sprintf("#sample-%d", id)
+}
+
+func processID(id int) string {
+	return fmt.Sprintf("#process-%d", id)
+}
+
+func propertyID(id int) string {
+	return fmt.Sprintf("#property-%d", id)
+}
+
+// nonNil makes sure an empty list is written as [] rather than null.
+func nonNil(nodes []node) []node {
+	if nodes == nil {
+		return []node{}
+	}
+
+	return nodes
+}
@@ -0,0 +1,111 @@
+package datasetmeta
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Author is a single author parsed from a dataset's Authors string.
+type Author struct {
+	Name        string `json:"name"`
+	GivenName   string `json:"given_name,omitempty"`
+	FamilyName  string `json:"family_name,omitempty"`
+	Affiliation string `json:"affiliation,omitempty"`
+	ORCID       string `json:"orcid,omitempty"`
+}
+
+// ORCIDURL returns the author's ORCID iD as a URL, or "" if they don't have one.
+func (a Author) ORCIDURL() string {
+	if a.ORCID == "" {
+		return ""
+	}
+
+	return "https://orcid.org/" + a.ORCID
+}
+
+var orcidPattern = regexp.MustCompile(`(?:https?://orcid\.org/)?(\d{4}-\d{4}-\d{4}-\d{3}[\dX])`)
+
+// ParseAuthors parses a dataset's Authors string. Authors are separated by semicolons or new lines. Each
+// author is written either as "Given Family" or "Family, Given", optionally followed by an affiliation in
+// parentheses and an ORCID iD, for example:
+//
+//	Jane Smith (University of Michigan) 0000-0002-1825-0097; Doe, John (Ohio State University)
+//
+// Empty entries are ignored. An entry that can't be parsed, or that has an invalid ORCID iD, is an error.
+func ParseAuthors(s string) ([]Author, error) {
+	var authors []Author
+	for _, entry := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		author, err := parseAuthor(entry)
+		if err != nil {
+			return nil, err
+		}
+		authors = append(authors, author)
+	}
+
+	return authors, nil
+}
+
+func parseAuthor(entry string) (Author, error) {
+	var author Author
+	rest := entry
+
+	if m := orcidPattern.FindStringSubmatchIndex(rest); m != nil {
+		author.ORCID = rest[m[2]:m[3]]
+		if !validORCID(author.ORCID) {
+			return author, fmt.Errorf("author %q has an invalid ORCID iD %s", entry, author.ORCID)
+		}
+		rest = rest[:m[0]] + rest[m[1]:]
+	}
+
+	if open := strings.Index(rest, "("); open != -1 {
+		closing := strings.LastIndex(rest, ")")
+		if closing < open {
+			return author, fmt.Errorf("author %q has an unclosed affiliation", entry)
+		}
+		author.Affiliation = strings.TrimSpace(rest[open+1 : closing])
+		rest = rest[:open] + rest[closing+1:]
+	} else if strings.Contains(rest, ")") {
+		return author, fmt.Errorf("author %q has an unopened affiliation", entry)
+	}
+
+	rest = strings.Join(strings.Fields(rest), " ")
+	if family, given, ok := strings.Cut(rest, ","); ok {
+		author.FamilyName = strings.TrimSpace(family)
+		author.GivenName = strings.TrimSpace(given)
+	} else if i := strings.LastIndex(rest, " "); i != -1 {
+		author.GivenName = rest[:i]
+		author.FamilyName = rest[i+1:]
+	} else {
+		author.FamilyName = rest
+	}
+
+	if author.FamilyName == "" {
+		return author, fmt.Errorf("author %q has no name", entry)
+	}
+
+	author.Name = strings.TrimSpace(author.GivenName + " " + author.FamilyName)
+	return author, nil
+}
+
+// validORCID checks the ORCID iD's check digit (ISO 7064 MOD 11-2).
+func validORCID(orcid string) bool {
+	digits := strings.ReplaceAll(orcid, "-", "")
+	total := 0
+	for _, c := range digits[:len(digits)-1] {
+		total = (total + int(c-'0')) * 2
+	}
+
+	check := (12 - total%11) % 11
+	want := byte('0' + check)
+	if check == 10 {
+		want = 'X'
+	}
+
+	return digits[len(digits)-1] == want
+}
@@ -0,0 +1,45 @@
+package datasetmeta
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAuthors(t *testing.T) {
+	authors, err := ParseAuthors("Jane Q. Smith (University of Michigan) 0000-0002-1825-0097;\n Doe, John (Ohio State University) ;; Plato")
+	require.NoError(t, err)
+	require.Equal(t, []Author{
+		{
+			Name:        "Jane Q. Smith",
+			GivenName:   "Jane Q.",
+			FamilyName:  "Smith",
+			Affiliation: "University of Michigan",
+			ORCID:       "0000-0002-1825-0097",
+		},
+		{Name: "John Doe", GivenName: "John", FamilyName: "Doe", Affiliation: "Ohio State University"},
+		{Name: "Plato", FamilyName: "Plato"},
+	}, authors)
+
+	authors, err = ParseAuthors("Smith, Jane https://orcid.org/0000-0001-5109-3700")
+	require.NoError(t, err)
+	require.Equal(t, "0000-0001-5109-3700", authors[0].ORCID)
+	require.Equal(t, "https://orcid.org/0000-0001-5109-3700", authors[0].ORCIDURL())
+
+	authors, err = ParseAuthors("  ")
+	require.NoError(t, err)
+	require.Empty(t, authors)
+}
+
+func TestParseAuthorsErrors(t *testing.T) {
+	for _, s := range []string{
+		"Jane Smith 0000-0002-1825-0098",
+		"Jane Smith (University of Michigan",
+		"Jane Smith University of Michigan)",
+		"(University of Michigan)",
+		", Jane",
+	} {
+		_, err := ParseAuthors(s)
+		require.Error(t, err, s)
+	}
+}
@@ -0,0 +1,160 @@
+package datasetmeta
+
+import (
+	"encoding/xml"
+	"strconv"
+)
+
+const (
+	dataCiteNamespace      = "http://datacite.org/schema/kernel-4"
+	dataCiteSchemaLocation = "http://datacite.org/schema/kernel-4 http://schema.datacite.org/meta/kernel-4/metadata.xsd"
+	xsiNamespace           = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+// The DataCite kernel-4 elements that are rendered. Elements are declared in the order the schema
+// documents them.
+type dataCiteResource struct {
+	XMLName        xml.Name              `xml:"resource"`
+	Xmlns          string                `xml:"xmlns,attr"`
+	XmlnsXSI       string                `xml:"xmlns:xsi,attr"`
+	SchemaLocation string                `xml:"xsi:schemaLocation,attr"`
+	Identifier     dataCiteIdentifier    `xml:"identifier"`
+	Creators       []dataCiteCreator     `xml:"creators>creator"`
+	Titles         []string              `xml:"titles>title"`
+	Publisher      string                `xml:"publisher"`
+	Year           string                `xml:"publicationYear"`
+	ResourceType   dataCiteResourceType  `xml:"resourceType"`
+	Contributors   []dataCiteContributor `xml:"contributors>contributor,omitempty"`
+	Dates          []dataCiteDate        `xml:"dates>date"`
+	Rights         []dataCiteRights      `xml:"rightsList>rights,omitempty"`
+	Descriptions   []dataCiteDescription `xml:"descriptions>description,omitempty"`
+}
+
+type dataCiteIdentifier struct {
+	Type  string `xml:"identifierType,attr"`
+	Value string `xml:",chardata"`
+}
+
+type dataCiteName struct {
+	Type  string `xml:"nameType,attr"`
+	Value string `xml:",chardata"`
+}
+
+type dataCiteNameIdentifier struct {
+	Scheme    string `xml:"nameIdentifierScheme,attr"`
+	SchemeURI string `xml:"schemeURI,attr"`
+	Value     string `xml:",chardata"`
+}
+
+type dataCiteCreator struct {
+	Name           dataCiteName            `xml:"creatorName"`
+	GivenName      string                  `xml:"givenName,omitempty"`
+	FamilyName     string                  `xml:"familyName,omitempty"`
+	NameIdentifier *dataCiteNameIdentifier `xml:"nameIdentifier,omitempty"`
+	Affiliation    string                  `xml:"affiliation,omitempty"`
+}
+
+type dataCiteResourceType struct {
+	General string `xml:"resourceTypeGeneral,attr"`
+	Value   string `xml:",chardata"`
+}
+
+type dataCiteContributor struct {
+	Type string       `xml:"contributorType,attr"`
+	Name dataCiteName `xml:"contributorName"`
+}
+
+type dataCiteDate struct {
+	Type  string `xml:"dateType,attr"`
+	Value string `xml:",chardata"`
+}
+
+type dataCiteRights struct {
+	URI   string `xml:"rightsURI,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type dataCiteDescription struct {
+	Type  string `xml:"descriptionType,attr"`
+	Value string `xml:",chardata"`
+}
+
+// DataCite renders the DataCite kernel-4 XML for the dataset. When required fields are missing it returns
+// a *ValidationError listing them.
+func DataCite(src Source, opts Options) ([]byte, error) {
+	r, err := newRecord(src, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	published := r.publicationDate()
+	res := dataCiteResource{
+		Xmlns:          dataCiteNamespace,
+		XmlnsXSI:       xsiNamespace,
+		SchemaLocation: dataCiteSchemaLocation,
+		Identifier:     dataCiteIdentifier{Type: "DOI", Value: r.doi},
+		Titles:         []string{r.title},
+		Publisher:      r.publisher,
+		Year:           strconv.Itoa(published.Year()),
+		ResourceType:   dataCiteResourceType{General: "Dataset", Value: "Dataset"},
+		Dates:          []dataCiteDate{{Type: "Issued", Value: published.Format("2006-01-02")}},
+	}
+
+	if !r.created.IsZero() {
+		res.Dates = append(res.Dates, dataCiteDate{Type: "Created", Value: r.created.UTC().Format("2006-01-02")})
+	}
+
+	for _, author := range r.creators {
+		creator := dataCiteCreator{
+			Name:        dataCiteName{Type: "Personal", Value: creatorName(author)},
+			GivenName:   author.GivenName,
+			FamilyName:  author.FamilyName,
+			Affiliation: author.Affiliation,
+		}
+
+		if author.ORCID != "" {
+			creator.NameIdentifier = &dataCiteNameIdentifier{
+				Scheme:    "ORCID",
+				SchemeURI: "https://orcid.org",
+				Value:     author.ORCIDURL(),
+			}
+		}
+
+		res.Creators = append(res.Creators, creator)
+	}
+
+	if r.contact != nil && r.contact.Name != "" {
+		res.Contributors = append(res.Contributors, dataCiteContributor{
+			Type: "ContactPerson",
+			Name: dataCiteName{Type: "Personal", Value: r.contact.Name},
+		})
+	}
+
+	if r.license != "" || r.licenseURL != "" {
+		name := r.license
+		if name == "" {
+			name = r.licenseURL
+		}
+		res.Rights = append(res.Rights, dataCiteRights{URI: r.licenseURL, Value: name})
+	}
+
+	if r.description != "" {
+		res.Descriptions = append(res.Descriptions, dataCiteDescription{Type: "Abstract", Value: r.description})
+	}
+
+	data, err := xml.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// creatorName is the name DataCite expects for a person, "Family, Given".
+func creatorName(author Author) string {
+	if author.GivenName == "" {
+		return author.FamilyName
+	}
+
+	return author.FamilyName + ", " + author.GivenName
+}
@@ -0,0 +1,184 @@
+// Package datasetmeta renders the metadata describing a dataset for the services it is published to:
+// DataCite kernel-4 XML for minting DOIs, and schema.org JSON-LD for search engines and data catalogs.
+// Both are built from the dataset record, the project it is in, and the project's owner.
+package datasetmeta
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+)
+
+// DefaultPublisher is the publisher used when Options.Publisher isn't set.
+const DefaultPublisher = "Materials Commons"
+
+// Source is everything the metadata is built from. Project and Owner are optional, the owner is listed as
+// the contact for the dataset and used as its creator when the dataset has no authors.
+type Source struct {
+	Dataset *mcmodel.Dataset
+	Project *mcmodel.Project
+	Owner   *mcmodel.User
+}
+
+// Options control how the metadata is rendered.
+type Options struct {
+	// Test renders the metadata for the dataset's test DOI and test publication date.
+	Test bool
+
+	// Publisher defaults to DefaultPublisher.
+	Publisher string
+
+	// LandingURL, when set, is the URL of the dataset's landing page.
+	LandingURL string
+}
+
+// FieldError is a required field that is missing or invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists everything that stops metadata from being rendered for a dataset.
+type ValidationError struct {
+	Problems []FieldError `json:"problems"`
+}
+
+func (e *ValidationError) Error() string {
+	var msgs []string
+	for _, p := range e.Problems {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", p.Field, p.Message))
+	}
+
+	return "invalid dataset metadata: " + strings.Join(msgs, "; ")
+}
+
+// record is the metadata common to every format, after validation.
+type record struct {
+	doi         string
+	title       string
+	description string
+	creators    []Author
+	contact     *mcmodel.User
+	project     *mcmodel.Project
+	publisher   string
+	published   time.Time
+	created     time.Time
+	license     string
+	licenseURL  string
+	landingURL  string
+}
+
+// Validate checks that the source has everything needed to render its metadata. Any problems are returned
+// as a *ValidationError.
+func Validate(src Source, opts Options) error {
+	_, err := newRecord(src, opts)
+	return err
+}
+
+func newRecord(src Source, opts Options) (*record, error) {
+	verr := &ValidationError{}
+	problem := func(field, msg string) {
+		verr.Problems = append(verr.Problems, FieldError{Field: field, Message: msg})
+	}
+
+	ds := src.Dataset
+	if ds == nil {
+		problem("dataset", "is required")
+		return nil, verr
+	}
+
+	r := &record{
+		title:       strings.TrimSpace(ds.Name),
+		description: strings.TrimSpace(ds.Description),
+		contact:     src.Owner,
+		project:     src.Project,
+		publisher:   opts.Publisher,
+		created:     ds.CreatedAt,
+		published:   ds.PublishedAt,
+		doi:         normalizeDOI(ds.DOI),
+		license:     strings.TrimSpace(ds.License),
+		licenseURL:  strings.TrimSpace(ds.LicenseLink),
+		landingURL:  opts.LandingURL,
+	}
+
+	if r.description == "" {
+		r.description = strings.TrimSpace(ds.Summary)
+	}
+
+	if r.publisher == "" {
+		r.publisher = DefaultPublisher
+	}
+
+	if opts.Test {
+		r.doi = normalizeDOI(ds.TestDOI)
+		r.published = ds.TestPublishedAt
+	}
+
+	switch {
+	case r.doi == "" && opts.Test:
+		problem("test_doi", "is required")
+	case r.doi == "":
+		problem("doi", "is required")
+	case !strings.HasPrefix(r.doi, "10.") || !strings.Contains(r.doi, "/"):
+		problem("doi", fmt.Sprintf("%q is not a DOI", r.doi))
+	}
+
+	if r.title == "" {
+		problem("name", "is required")
+	}
+
+	authors, err := ParseAuthors(ds.Authors)
+	switch {
+	case err != nil:
+		problem("authors", err.Error())
+	case len(authors) != 0:
+		r.creators = authors
+	case src.Owner != nil && strings.TrimSpace(src.Owner.Name) != "":
+		// Without authors the owner is the creator.
+		owner, err := parseAuthor(src.Owner.Name)
+		if err != nil {
+			problem("authors", err.Error())
+		}
+		r.creators = []Author{owner}
+	default:
+		problem("authors", "at least one author is required")
+	}
+
+	// An unpublished dataset's DOI is minted as a draft, its publication year is the year it was created.
+	if r.published.IsZero() && r.created.IsZero() {
+		problem("published_at", "the publication date or creation date is required")
+	}
+
+	if len(verr.Problems) != 0 {
+		return nil, verr
+	}
+
+	return r, nil
+}
+
+// publicationDate is when the dataset was published, or when it was created if it hasn't been.
+func (r *record) publicationDate() time.Time {
+	if !r.published.IsZero() {
+		return r.published.UTC()
+	}
+
+	return r.created.UTC()
+}
+
+func (r *record) doiURL() string {
+	return "https://doi.org/" + r.doi
+}
+
+// normalizeDOI strips any resolver prefix, so "https://doi.org/10.1/x" and "doi:10.1/x" become "10.1/x".
+func normalizeDOI(doi string) string {
+	doi = strings.TrimSpace(doi)
+	for _, prefix := range []string{"https://doi.org/", "http://doi.org/", "https://dx.doi.org/", "http://dx.doi.org/", "doi:"} {
+		if len(doi) >= len(prefix) && strings.EqualFold(doi[:len(prefix)], prefix) {
+			return doi[len(prefix):]
+		}
+	}
+
+	return doi
+}
@@ -0,0 +1,162 @@
+package datasetmeta
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/stretchr/testify/require"
+)
+
+func newSource() Source {
+	return Source{
+		Dataset: &mcmodel.Dataset{
+			Name:            "Heat Treated Mg",
+			Description:     "Heat treatment of Mg samples",
+			DOI:             "https://doi.org/10.1234/mc.1",
+			TestDOI:         "10.5072/mc.1",
+			Authors:         "Jane Smith (University of Michigan) 0000-0002-1825-0097; Doe, John",
+			License:         "Open Database License (ODC-ODbL)",
+			LicenseLink:     "https://opendatacommons.org/licenses/odbl/summary/",
+			CreatedAt:       time.Date(2023, 11, 20, 0, 0, 0, 0, time.UTC),
+			PublishedAt:     time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+			TestPublishedAt: time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC),
+		},
+		Project: &mcmodel.Project{Name: "Mg Alloys"},
+		Owner:   &mcmodel.User{Name: "Jane Smith", Email: "jane@example.com"},
+	}
+}
+
+func TestDataCite(t *testing.T) {
+	data, err := DataCite(newSource(), Options{})
+	require.NoError(t, err)
+
+	var res struct {
+		Identifier string `xml:"identifier"`
+		Creators   []struct {
+			Name           string `xml:"creatorName"`
+			FamilyName     string `xml:"familyName"`
+			Affiliation    string `xml:"affiliation"`
+			NameIdentifier string `xml:"nameIdentifier"`
+		} `xml:"creators>creator"`
+		Title        string `xml:"titles>title"`
+		Publisher    string `xml:"publisher"`
+		Year         string `xml:"publicationYear"`
+		ResourceType struct {
+			General string `xml:"resourceTypeGeneral,attr"`
+		} `xml:"resourceType"`
+		Contact string `xml:"contributors>contributor>contributorName"`
+		Dates   []struct {
+			Type  string `xml:"dateType,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"dates>date"`
+		Rights struct {
+			URI   string `xml:"rightsURI,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"rightsList>rights"`
+		Description string `xml:"descriptions>description"`
+	}
+	require.NoError(t, xml.Unmarshal(data, &res))
+	require.Contains(t, string(data), `<resource xmlns="http://datacite.org/schema/kernel-4"`)
+
+	require.Equal(t, "10.1234/mc.1", res.Identifier)
+	require.Len(t, res.Creators, 2)
+	require.Equal(t, "Smith, Jane", res.Creators[0].Name)
+	require.Equal(t, "University of Michigan", res.Creators[0].Affiliation)
+	require.Equal(t, "https://orcid.org/0000-0002-1825-0097", res.Creators[0].NameIdentifier)
+	require.Equal(t, "Doe, John", res.Creators[1].Name)
+	require.Equal(t, "Heat Treated Mg", res.Title)
+	require.Equal(t, DefaultPublisher, res.Publisher)
+	require.Equal(t, "2024", res.Year)
+	require.Equal(t, "Dataset", res.ResourceType.General)
+	require.Equal(t, "Jane Smith", res.Contact)
+	require.Equal(t, "2024-03-01", res.Dates[0].Value)
+	require.Equal(t, "https://opendatacommons.org/licenses/odbl/summary/", res.Rights.URI)
+	require.Equal(t, "Heat treatment of Mg samples", res.Description)
+
+	// Test metadata uses the test DOI and test publication date.
+	data, err = DataCite(newSource(), Options{Test: true})
+	require.NoError(t, err)
+	res.Dates = nil
+	require.NoError(t, xml.Unmarshal(data, &res))
+	require.Equal(t, "10.5072/mc.1", res.Identifier)
+	require.Equal(t, "2024-02-01", res.Dates[0].Value)
+}
+
+func TestSchemaOrg(t *testing.T) {
+	data, err := SchemaOrg(newSource(), Options{LandingURL: "https://materialscommons.org/public/datasets/1"})
+	require.NoError(t, err)
+
+	var ds map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &ds))
+	require.Equal(t, "https://schema.org", ds["@context"])
+	require.Equal(t, "Dataset", ds["@type"])
+	require.Equal(t, "https://doi.org/10.1234/mc.1", ds["identifier"])
+	require.Equal(t, "https://materialscommons.org/public/datasets/1", ds["url"])
+	require.Equal(t, "2024-03-01", ds["datePublished"])
+	require.Equal(t, "https://opendatacommons.org/licenses/odbl/summary/", ds["license"])
+	require.Equal(t, map[string]interface{}{"@type": "ResearchProject", "name": "Mg Alloys"}, ds["isPartOf"])
+
+	creators := ds["creator"].([]interface{})
+	require.Len(t, creators, 2)
+	jane := creators[0].(map[string]interface{})
+	require.Equal(t, "https://orcid.org/0000-0002-1825-0097", jane["@id"])
+	require.Equal(t, "University of Michigan", jane["affiliation"].(map[string]interface{})["name"])
+
+	// The owner's email address isn't published.
+	require.NotContains(t, string(data), "jane@example.com")
+}
+
+func TestOwnerIsCreatorWithoutAuthors(t *testing.T) {
+	src := newSource()
+	src.Dataset.Authors = ""
+
+	data, err := DataCite(src, Options{})
+	require.NoError(t, err)
+	require.Contains(t, string(data), "<creatorName nameType=\"Personal\">Smith, Jane</creatorName>")
+}
+
+func TestUnpublishedUsesCreationDate(t *testing.T) {
+	src := newSource()
+	src.Dataset.PublishedAt = time.Time{}
+
+	data, err := DataCite(src, Options{})
+	require.NoError(t, err)
+	require.Contains(t, string(data), "<publicationYear>2023</publicationYear>")
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, Validate(newSource(), Options{}))
+
+	src := Source{Dataset: &mcmodel.Dataset{Authors: "Jane Smith (Michigan"}}
+	err := Validate(src, Options{})
+
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr))
+	var fields []string
+	for _, p := range verr.Problems {
+		fields = append(fields, p.Field)
+	}
+	require.Equal(t, []string{"doi", "name", "authors", "published_at"}, fields)
+
+	_, err = SchemaOrg(src, Options{})
+	require.True(t, errors.As(err, &verr))
+
+	src = newSource()
+	src.Dataset.TestDOI = ""
+	err = Validate(src, Options{Test: true})
+	require.True(t, errors.As(err, &verr))
+	require.Equal(t, "test_doi", verr.Problems[0].Field)
+
+	src = newSource()
+	src.Dataset.DOI = "mc.1"
+	require.Error(t, Validate(src, Options{}))
+
+	src = newSource()
+	src.Dataset.Authors = ""
+	src.Owner = nil
+	require.Error(t, Validate(src, Options{}))
+}
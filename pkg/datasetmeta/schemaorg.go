@@ -0,0 +1,103 @@
+package datasetmeta
+
+import (
+	"encoding/json"
+)
+
+type schemaOrgDataset struct {
+	Context       string                `json:"@context"`
+	Type          string                `json:"@type"`
+	ID            string                `json:"@id"`
+	Identifier    string                `json:"identifier"`
+	Name          string                `json:"name"`
+	Description   string                `json:"description,omitempty"`
+	URL           string                `json:"url,omitempty"`
+	Creator       []schemaOrgPerson     `json:"creator"`
+	Maintainer    *schemaOrgPerson      `json:"maintainer,omitempty"`
+	License       string                `json:"license,omitempty"`
+	DateCreated   string                `json:"dateCreated,omitempty"`
+	DatePublished string                `json:"datePublished"`
+	Publisher     schemaOrgOrganization `json:"publisher"`
+	IsPartOf      *schemaOrgProject     `json:"isPartOf,omitempty"`
+}
+
+type schemaOrgPerson struct {
+	Type        string                 `json:"@type"`
+	ID          string                 `json:"@id,omitempty"`
+	Name        string                 `json:"name"`
+	GivenName   string                 `json:"givenName,omitempty"`
+	FamilyName  string                 `json:"familyName,omitempty"`
+	Affiliation *schemaOrgOrganization `json:"affiliation,omitempty"`
+}
+
+type schemaOrgOrganization struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+type schemaOrgProject struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+// SchemaOrg renders the schema.org Dataset JSON-LD for the dataset. When required fields are missing it
+// returns a *ValidationError listing them.
+func SchemaOrg(src Source, opts Options) ([]byte, error) {
+	r, err := newRecord(src, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := schemaOrgDataset{
+		Context:       "https://schema.org",
+		Type:          "Dataset",
+		ID:            r.doiURL(),
+		Identifier:    r.doiURL(),
+		Name:          r.title,
+		Description:   r.description,
+		URL:           r.landingURL,
+		DatePublished: r.publicationDate().Format("2006-01-02"),
+		Publisher:     schemaOrgOrganization{Type: "Organization", Name: r.publisher},
+	}
+
+	if !r.created.IsZero() {
+		ds.DateCreated = r.created.UTC().Format("2006-01-02")
+	}
+
+	for _, author := range r.creators {
+		person := schemaOrgPerson{
+			Type:       "Person",
+			ID:         author.ORCIDURL(),
+			Name:       author.Name,
+			GivenName:  author.GivenName,
+			FamilyName: author.FamilyName,
+		}
+
+		if author.Affiliation != "" {
+			person.Affiliation = &schemaOrgOrganization{Type: "Organization", Name: author.Affiliation}
+		}
+
+		ds.Creator = append(ds.Creator, person)
+	}
+
+	if r.contact != nil && r.contact.Name != "" {
+		ds.Maintainer = &schemaOrgPerson{Type: "Person", Name: r.contact.Name}
+	}
+
+	if r.licenseURL != "" {
+		ds.License = r.licenseURL
+	} else {
+		ds.License = r.license
+	}
+
+	if r.project != nil && r.project.Name != "" {
+		ds.IsPartOf = &schemaOrgProject{Type: "ResearchProject", Name: r.project.Name}
+	}
+
+	data, err := json.MarshalIndent(ds, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,366 @@
+// Package datasetzip builds the zip archive that is downloaded for a dataset. The files in the archive
+// are the ones the dataset's file selection (see mcdb.DatasetFileSelector) puts in the dataset, read from
+// the blob store through their UsesUUID. A manifest of the paths and checksums of every file is stored at
+// the root of the zip, and a copy is kept next to the zip so the status of a build can be reported
+// without opening the archive.
+//
+// The zip is written to a temporary file in the dataset's zipfile directory and renamed into place, so a
+// download never sees a partially written archive. Rebuilds are incremental: when the selection hasn't
+// changed nothing is written, and otherwise the compressed entries for unchanged files are copied from
+// the previous zip rather than being read and compressed again.
+package datasetzip
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/gosimple/slug"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+)
+
+// ErrBuildInProgress is returned when a build is requested for a dataset that is already being built.
+var ErrBuildInProgress = errors.New("dataset zip build already in progress")
+
+// States a dataset's zip can be in.
+const (
+	StateNone     = "none"
+	StateBuilding = "building"
+	StateReady    = "ready"
+	StateFailed   = "failed"
+)
+
+// Status describes the zip for a dataset. BuiltAt, FileCount and TotalSize describe the last successful
+// build, and are reported alongside a build that is in progress or that failed.
+type Status struct {
+	DatasetID int       `json:"dataset_id"`
+	State     string    `json:"state"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+	BuiltAt   time.Time `json:"built_at,omitempty"`
+	FileCount int       `json:"file_count"`
+	TotalSize uint64    `json:"total_size"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Report is the result of a build.
+type Report struct {
+	DatasetID   int       `json:"dataset_id"`
+	ZipfilePath string    `json:"zipfile_path"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	UpToDate    bool      `json:"up_to_date"`
+	FileCount   int       `json:"file_count"`
+	Reused      int       `json:"reused"`
+	Added       int       `json:"added"`
+	TotalSize   uint64    `json:"total_size"`
+}
+
+type Builder struct {
+	datasetStor stor.DatasetStor
+	blobs       blobstore.BlobStore
+	mcfsDir     string
+
+	// builds tracks the builds that are running, or that failed, by dataset id. Successful builds
+	// are reported from the manifest stored next to the zip.
+	mu     sync.Mutex
+	builds map[int]*Status
+}
+
+func NewBuilder(datasetStor stor.DatasetStor, blobs blobstore.BlobStore, mcfsDir string) *Builder {
+	return &Builder{
+		datasetStor: datasetStor,
+		blobs:       blobs,
+		mcfsDir:     mcfsDir,
+		builds:      make(map[int]*Status),
+	}
+}
+
+// Build builds, or incrementally rebuilds, the zip for a dataset and waits for it to finish.
+func (b *Builder) Build(datasetID int) (*Report, error) {
+	dataset, err := b.datasetStor.GetDatasetByID(datasetID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.startBuilding(datasetID); err != nil {
+		return nil, err
+	}
+
+	report, err := b.build(dataset)
+	b.finishBuilding(datasetID, err)
+	return report, err
+}
+
+// StartBuild starts building the zip for a dataset in the background, and returns its status.
+func (b *Builder) StartBuild(datasetID int) (*Status, error) {
+	dataset, err := b.datasetStor.GetDatasetByID(datasetID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.startBuilding(datasetID); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		_, err := b.build(dataset)
+		if err != nil {
+			log.Errorf("Building zip for dataset %d failed: %s", datasetID, err)
+		}
+		b.finishBuilding(datasetID, err)
+	}()
+
+	return b.Status(datasetID)
+}
+
+// Status returns the status of the zip for a dataset.
+func (b *Builder) Status(datasetID int) (*Status, error) {
+	dataset, err := b.datasetStor.GetDatasetByID(datasetID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := Status{DatasetID: datasetID, State: StateNone}
+
+	if m, err := loadManifest(filepath.Join(dataset.ZipfileDir(b.mcfsDir), ManifestName)); err == nil {
+		status.State = StateReady
+		status.BuiltAt = m.BuiltAt
+		status.FileCount = len(m.Files)
+		status.TotalSize = m.TotalSize
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if build, ok := b.builds[datasetID]; ok {
+		status.State = build.State
+		status.StartedAt = build.StartedAt
+		status.Error = build.Error
+	}
+
+	return &status, nil
+}
+
+func (b *Builder) startBuilding(datasetID int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if build, ok := b.builds[datasetID]; ok && build.State == StateBuilding {
+		return ErrBuildInProgress
+	}
+
+	b.builds[datasetID] = &Status{DatasetID: datasetID, State: StateBuilding, StartedAt: time.Now()}
+	return nil
+}
+
+func (b *Builder) finishBuilding(datasetID int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		delete(b.builds, datasetID)
+		return
+	}
+
+	build := b.builds[datasetID]
+	build.State = StateFailed
+	build.Error = err.Error()
+}
+
+func (b *Builder) build(dataset *mcmodel.Dataset) (*Report, error) {
+	report := &Report{
+		DatasetID:   dataset.ID,
+		ZipfilePath: dataset.ZipfilePath(b.mcfsDir),
+		StartedAt:   time.Now(),
+	}
+
+	files, err := b.datasetStor.ListSelectedFiles(dataset)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list files for dataset %d: %w", dataset.ID, err)
+	}
+
+	manifest := &Manifest{
+		DatasetID:   dataset.ID,
+		DatasetUUID: dataset.UUID,
+		Root:        slug.Make(dataset.Name),
+		Files:       make([]ManifestEntry, 0, len(files)),
+	}
+
+	for _, file := range files {
+		entry := newManifestEntry(file)
+		manifest.Files = append(manifest.Files, entry)
+		manifest.TotalSize += entry.Size
+	}
+
+	report.FileCount = len(manifest.Files)
+	report.TotalSize = manifest.TotalSize
+
+	zipDir := dataset.ZipfileDir(b.mcfsDir)
+	if err := os.MkdirAll(zipDir, 0755); err != nil {
+		return nil, err
+	}
+
+	previous, err := openPreviousZip(report.ZipfilePath)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		defer previous.Close()
+	}
+
+	if previous != nil && previous.manifest.sameFiles(manifest) {
+		report.UpToDate = true
+		report.FinishedAt = time.Now()
+
+		// The zip is current, make sure the copy of its manifest is too.
+		manifestPath := filepath.Join(zipDir, ManifestName)
+		if _, err := os.Stat(manifestPath); err != nil {
+			if err := previous.manifest.save(manifestPath); err != nil {
+				return nil, err
+			}
+		}
+
+		return report, nil
+	}
+
+	manifest.BuiltAt = time.Now()
+
+	tmp, err := os.CreateTemp(zipDir, ".build-*.zip")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.writeZip(tmp, manifest, previous, report); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	if err := os.Rename(tmp.Name(), report.ZipfilePath); err != nil {
+		_ = os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	if err := manifest.save(filepath.Join(zipDir, ManifestName)); err != nil {
+		return nil, err
+	}
+
+	removeStaleZips(zipDir, report.ZipfilePath)
+
+	report.FinishedAt = time.Now()
+
+	return report, nil
+}
+
+// writeZip writes every file in the manifest, followed by the manifest itself, to w. Entries whose
+// contents haven't changed since the previous zip are copied from it without being recompressed.
+func (b *Builder) writeZip(f *os.File, manifest *Manifest, previous *previousZip, report *Report) error {
+	zw := zip.NewWriter(f)
+
+	for _, entry := range manifest.Files {
+		name := entry.zipName(manifest.Root)
+
+		if prev := previous.entryFor(entry); prev != nil {
+			if err := copyRaw(zw, prev, name); err != nil {
+				return err
+			}
+			report.Reused++
+			continue
+		}
+
+		if err := b.addBlob(zw, entry, name); err != nil {
+			return err
+		}
+		report.Added++
+	}
+
+	w, err := zw.Create(ManifestName)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+// addBlob compresses the contents of the file described by entry into the zip as name.
+func (b *Builder) addBlob(zw *zip.Writer, entry ManifestEntry, name string) error {
+	key := mcmodel.File{UUID: entry.BlobUUID}.BlobKey()
+	r, err := b.blobs.Open(key, 0)
+	if err != nil {
+		return fmt.Errorf("unable to open %s (file %d): %w", entry.Path, entry.FileID, err)
+	}
+	defer r.Close()
+
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(w, r)
+	switch {
+	case err != nil:
+		return fmt.Errorf("unable to add %s (file %d): %w", entry.Path, entry.FileID, err)
+	case uint64(n) != entry.Size:
+		return fmt.Errorf("%s (file %d) is %d bytes, expected %d", entry.Path, entry.FileID, n, entry.Size)
+	}
+
+	return nil
+}
+
+// copyRaw copies the compressed contents of prev into the zip as name.
+func copyRaw(zw *zip.Writer, prev *zip.File, name string) error {
+	fh := prev.FileHeader
+	fh.Name = name
+
+	r, err := prev.OpenRaw()
+	if err != nil {
+		return err
+	}
+
+	w, err := zw.CreateRaw(&fh)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// removeStaleZips removes any zip other than current from dir. These are left behind when a dataset
+// is renamed, since the name of the zip comes from the dataset name.
+func removeStaleZips(dir, current string) {
+	zips, _ := filepath.Glob(filepath.Join(dir, "*.zip"))
+	for _, path := range zips {
+		if path == current || strings.HasPrefix(filepath.Base(path), ".") {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			log.Errorf("Unable to remove stale dataset zip %s: %s", path, err)
+		}
+	}
+}
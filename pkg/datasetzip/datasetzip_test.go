@@ -0,0 +1,174 @@
+package datasetzip
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestBuilder(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	mcfsDir := t.TempDir()
+	blobs := blobstore.NewLocalBlobStore(mcfsDir)
+
+	user := b.User("user1")
+	proj := b.Project("proj1", user)
+	d1 := b.Dir(proj, proj.RootDir, "d1")
+	d2 := b.Dir(proj, proj.RootDir, "d2")
+	a := addFile(t, b, blobs, proj, d1, "a.txt", "aaaa")
+	addFile(t, b, blobs, proj, d1, "excluded.txt", "no")
+	c := addFile(t, b, blobs, proj, d2, "c.txt", "cc")
+	addFile(t, b, blobs, proj, d2, "not-selected.txt", "no")
+
+	// c.txt shares the blob of another file.
+	shared := addFile(t, b, blobs, proj, proj.RootDir, "shared.txt", "shared")
+	require.NoError(t, db.Model(c).Update("uses_uuid", shared.UUID).Error)
+	require.NoError(t, db.Model(c).Update("size", len("shared")).Error)
+
+	ds := b.Dataset(proj, "My Dataset")
+	setSelection(t, db, ds, mcmodel.FileSelection{
+		IncludeDirs:  []string{"/d1"},
+		ExcludeFiles: []string{"/d1/excluded.txt"},
+		IncludeFiles: []string{"/d2/c.txt"},
+	})
+
+	builder := NewBuilder(stor.NewGormDatasetStor(db), blobs, mcfsDir)
+
+	status, err := builder.Status(ds.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateNone, status.State)
+
+	report, err := builder.Build(ds.ID)
+	require.NoError(t, err)
+	require.False(t, report.UpToDate)
+	require.Equal(t, 2, report.FileCount)
+	require.Equal(t, 2, report.Added)
+	require.Equal(t, ds.ZipfilePath(mcfsDir), report.ZipfilePath)
+
+	contents, manifest := readZip(t, report.ZipfilePath)
+	require.Equal(t, map[string]string{
+		"my-dataset/d1/a.txt": "aaaa",
+		"my-dataset/d2/c.txt": "shared",
+	}, contents)
+	require.Len(t, manifest.Files, 2)
+	require.Equal(t, "/d1/a.txt", manifest.Files[0].Path)
+	require.Equal(t, a.Checksum, manifest.Files[0].Checksum)
+	require.Equal(t, shared.UUID, manifest.Files[1].BlobUUID)
+
+	status, err = builder.Status(ds.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateReady, status.State)
+	require.Equal(t, 2, status.FileCount)
+	require.Equal(t, uint64(len("aaaa")+len("shared")), status.TotalSize)
+
+	// Nothing changed, so nothing is rebuilt.
+	report, err = builder.Build(ds.ID)
+	require.NoError(t, err)
+	require.True(t, report.UpToDate)
+
+	// Selecting another file only compresses the new file.
+	setSelection(t, db, ds, mcmodel.FileSelection{
+		IncludeDirs:  []string{"/d1", "/d2"},
+		ExcludeFiles: []string{"/d1/excluded.txt"},
+	})
+	report, err = builder.Build(ds.ID)
+	require.NoError(t, err)
+	require.False(t, report.UpToDate)
+	require.Equal(t, 3, report.FileCount)
+	require.Equal(t, 2, report.Reused)
+	require.Equal(t, 1, report.Added)
+
+	contents, _ = readZip(t, report.ZipfilePath)
+	require.Equal(t, "aaaa", contents["my-dataset/d1/a.txt"])
+	require.Equal(t, "shared", contents["my-dataset/d2/c.txt"])
+	require.Equal(t, "no", contents["my-dataset/d2/not-selected.txt"])
+
+	// Renaming the dataset moves the zip and removes the old one.
+	oldPath := report.ZipfilePath
+	require.NoError(t, db.Model(ds).Update("name", "Renamed").Error)
+	report, err = builder.Build(ds.ID)
+	require.NoError(t, err)
+	require.Equal(t, 3, report.Added)
+	require.NoFileExists(t, oldPath)
+	require.FileExists(t, report.ZipfilePath)
+}
+
+func TestBuilderFailure(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	mcfsDir := t.TempDir()
+	blobs := blobstore.NewLocalBlobStore(mcfsDir)
+
+	user := b.User("user1")
+	proj := b.Project("proj1", user)
+	b.File(proj, proj.RootDir, "no-blob.txt", 10)
+	ds := b.Dataset(proj, "ds")
+	setSelection(t, db, ds, mcmodel.FileSelection{IncludeDirs: []string{"/"}})
+
+	builder := NewBuilder(stor.NewGormDatasetStor(db), blobs, mcfsDir)
+	status, err := builder.StartBuild(ds.ID)
+	require.NoError(t, err)
+	require.Equal(t, StateBuilding, status.State)
+
+	require.Eventually(t, func() bool {
+		status, err = builder.Status(ds.ID)
+		return err == nil && status.State != StateBuilding
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, StateFailed, status.State)
+	require.Contains(t, status.Error, "/no-blob.txt")
+
+	// A failed build never leaves a zip or temporary files behind.
+	leftover, _ := filepath.Glob(filepath.Join(ds.ZipfileDir(mcfsDir), "*"))
+	require.Empty(t, leftover)
+}
+
+func addFile(t *testing.T, b *mcdbtest.Builder, blobs blobstore.BlobStore, proj *mcmodel.Project, dir *mcmodel.File, name, content string) *mcmodel.File {
+	f := b.File(proj, dir, name, uint64(len(content)))
+	w, err := blobs.Create(f.BlobKey())
+	require.NoError(t, err)
+	_, err = w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return f
+}
+
+func setSelection(t *testing.T, db *gorm.DB, ds *mcmodel.Dataset, selection mcmodel.FileSelection) {
+	data, err := json.Marshal(selection)
+	require.NoError(t, err)
+	require.NoError(t, db.Model(ds).Update("file_selection", string(data)).Error)
+}
+
+func readZip(t *testing.T, path string) (map[string]string, *Manifest) {
+	zr, err := zip.OpenReader(path)
+	require.NoError(t, err)
+	defer zr.Close()
+
+	contents := make(map[string]string)
+	var manifest Manifest
+	for _, f := range zr.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		_ = r.Close()
+
+		if f.Name == ManifestName {
+			require.NoError(t, json.Unmarshal(data, &manifest))
+			continue
+		}
+		contents[f.Name] = string(data)
+	}
+
+	return contents, &manifest
+}
@@ -0,0 +1,113 @@
+package datasetzip
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+)
+
+// ManifestName is the name of the manifest, both at the root of the zip and next to it in the dataset's
+// zipfile directory.
+const ManifestName = "manifest.json"
+
+// Manifest lists every file in a dataset's zip along with its checksums. Files are stored in the zip
+// under Root, at their project path.
+type Manifest struct {
+	DatasetID   int             `json:"dataset_id"`
+	DatasetUUID string          `json:"dataset_uuid"`
+	Root        string          `json:"root"`
+	BuiltAt     time.Time       `json:"built_at"`
+	TotalSize   uint64          `json:"total_size"`
+	Files       []ManifestEntry `json:"files"`
+}
+
+// ManifestEntry describes a single file in the zip. BlobUUID is the UUID the file's contents are stored
+// under, which is shared by every file with the same contents.
+type ManifestEntry struct {
+	Path     string `json:"path"`
+	FileID   int    `json:"file_id"`
+	BlobUUID string `json:"blob_uuid"`
+	Size     uint64 `json:"size"`
+	Checksum string `json:"checksum"`
+	Sha256   string `json:"sha256,omitempty"`
+}
+
+func newManifestEntry(file mcmodel.File) ManifestEntry {
+	return ManifestEntry{
+		Path:     file.FullPath(),
+		FileID:   file.ID,
+		BlobUUID: file.UUIDForUses(),
+		Size:     file.Size,
+		Checksum: file.Checksum,
+		Sha256:   file.Sha256,
+	}
+}
+
+// sameContents returns true when e and other are the same path with the same contents, which means
+// the compressed entry for one can be reused for the other.
+func (e ManifestEntry) sameContents(other ManifestEntry) bool {
+	return e.Path == other.Path && e.BlobUUID == other.BlobUUID && e.Size == other.Size && e.Checksum == other.Checksum
+}
+
+// zipName is the name of the entry for e in a zip whose files are under root.
+func (e ManifestEntry) zipName(root string) string {
+	return root + "/" + e.Path[1:]
+}
+
+// sameFiles returns true when m and other list the same files with the same contents under the same root.
+func (m *Manifest) sameFiles(other *Manifest) bool {
+	if m.Root != other.Root || len(m.Files) != len(other.Files) {
+		return false
+	}
+
+	for i := range m.Files {
+		if !m.Files[i].sameContents(other.Files[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func loadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// save writes the manifest to path, replacing any existing manifest atomically.
+func (m *Manifest) save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".manifest-*.json")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
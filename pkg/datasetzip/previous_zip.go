@@ -0,0 +1,91 @@
+package datasetzip
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"io/fs"
+
+	"github.com/apex/log"
+)
+
+// previousZip is the zip from an earlier build, opened so its entries can be reused.
+type previousZip struct {
+	zr       *zip.ReadCloser
+	manifest *Manifest
+
+	// entries maps a file's project path to its manifest entry and zip entry.
+	entries map[string]previousEntry
+}
+
+type previousEntry struct {
+	entry ManifestEntry
+	file  *zip.File
+}
+
+// openPreviousZip opens the zip at path. It returns nil when there is no zip, or when the zip can't be
+// used for an incremental build, in which case the whole zip is rebuilt.
+func openPreviousZip(path string) (*previousZip, error) {
+	zr, err := zip.OpenReader(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		log.Warnf("Unable to open previous dataset zip %s, rebuilding it: %s", path, err)
+		return nil, nil
+	}
+
+	manifest, err := readZipManifest(zr)
+	if err != nil {
+		log.Warnf("Unable to read manifest from previous dataset zip %s, rebuilding it: %s", path, err)
+		_ = zr.Close()
+		return nil, nil
+	}
+
+	zipFiles := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		zipFiles[f.Name] = f
+	}
+
+	p := &previousZip{zr: zr, manifest: manifest, entries: make(map[string]previousEntry, len(manifest.Files))}
+	for _, entry := range manifest.Files {
+		if f, ok := zipFiles[entry.zipName(manifest.Root)]; ok {
+			p.entries[entry.Path] = previousEntry{entry: entry, file: f}
+		}
+	}
+
+	return p, nil
+}
+
+func readZipManifest(zr *zip.ReadCloser) (*Manifest, error) {
+	r, err := zr.Open(ManifestName)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// entryFor returns the zip entry holding the same contents as entry, or nil if there isn't one.
+func (p *previousZip) entryFor(entry ManifestEntry) *zip.File {
+	if p == nil {
+		return nil
+	}
+
+	prev, ok := p.entries[entry.Path]
+	if !ok || !prev.entry.sameContents(entry) {
+		return nil
+	}
+
+	return prev.file
+}
+
+func (p *previousZip) Close() error {
+	return p.zr.Close()
+}
@@ -0,0 +1,140 @@
+// Package backfill computes the SHA-256 for files that were uploaded before it was stored. Each file's
+// blob is re-read, and its MD5 is checked against the stored checksum before the SHA-256 is recorded,
+// so a corrupted blob never gets a SHA-256 that vouches for the wrong contents. Files without an MD5 to
+// check, or whose blob is missing or doesn't match, are reported and left alone, the scrubber is
+// responsible for their health.
+//
+// Files that share a blob through uses_uuid are filled in together, and so are only read once. Since
+// files that have been filled in no longer need backfilling, a backfill that is stopped (or that hits
+// MaxDuration) simply carries on with the remaining files on its next run.
+package backfill
+
+import (
+	"context"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest"
+	"github.com/materials-commons/hydra/pkg/mcdb/filewalk"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+)
+
+// Kinds of problems a backfill reports, along with filewalk.ProblemMissing and filewalk.ProblemError.
+const (
+	ProblemNoChecksum       = "no-checksum"
+	ProblemChecksumMismatch = "checksum-mismatch"
+)
+
+type Options = filewalk.Options
+
+// Report is the result of a backfill.
+type Report struct {
+	filewalk.Report
+	Backfilled int   `json:"backfilled"`
+	BytesRead  int64 `json:"bytes_read"`
+	NoChecksum int   `json:"no_checksum"`
+	Mismatched int   `json:"mismatched"`
+}
+
+type Backfiller struct {
+	fileStor stor.FileStor
+	blobs    blobstore.BlobStore
+
+	// hashed caches the checksums computed for a blob, so a dry run (which doesn't fill in the files
+	// sharing a blob) doesn't read the same blob more than once.
+	hashed map[string]digest.Sums
+}
+
+func NewBackfiller(fileStor stor.FileStor, blobs blobstore.BlobStore) *Backfiller {
+	return &Backfiller{fileStor: fileStor, blobs: blobs}
+}
+
+// Run backfills the SHA-256 for the files selected by opts.
+func (b *Backfiller) Run(opts Options) (*Report, error) {
+	b.hashed = make(map[string]digest.Sums)
+	report := &Report{Report: filewalk.NewReport(opts)}
+	err := filewalk.Walk(opts, &report.Report, b.fileStor.ListFilesMissingSha256, func(file *mcmodel.File) {
+		b.backfillFile(file, opts, report)
+	})
+
+	return report, err
+}
+
+// backfillFile computes and verifies the checksums for a single file, and stores its SHA-256.
+func (b *Backfiller) backfillFile(file *mcmodel.File, opts Options, report *Report) {
+	report.FilesChecked++
+
+	// Without an MD5 the contents can't be verified, so the blob isn't read.
+	if file.Checksum == "" {
+		report.NoChecksum++
+		report.AddProblem(filewalk.NewProblem(file, ProblemNoChecksum))
+		return
+	}
+
+	sums, err := b.hashBlob(file.BlobKey(), report)
+	switch {
+	case err != nil:
+		report.AddError(file, err)
+		return
+
+	case sums.MD5 != file.Checksum:
+		problem := filewalk.NewProblem(file, ProblemChecksumMismatch)
+		problem.Expected = file.Checksum
+		problem.Actual = sums.MD5
+		report.Mismatched++
+		report.AddProblem(problem)
+		return
+	}
+
+	if !opts.DryRun {
+		if err := b.fileStor.SetFileSha256(file, sums.SHA256); err != nil {
+			report.AddError(file, err)
+			return
+		}
+	}
+
+	report.Backfilled++
+}
+
+// hashBlob returns the checksums for the blob at key. A missing blob is reported through an error
+// that blobstore.IsNotExist recognizes.
+func (b *Backfiller) hashBlob(key string, report *Report) (digest.Sums, error) {
+	if sums, ok := b.hashed[key]; ok {
+		return sums, nil
+	}
+
+	r, err := b.blobs.Open(key, 0)
+	if err != nil {
+		return digest.Sums{}, err
+	}
+	defer r.Close()
+
+	sums, n, err := digest.FromReader(r)
+	report.BytesRead += n
+	if err != nil {
+		return digest.Sums{}, err
+	}
+
+	b.hashed[key] = sums
+	return sums, nil
+}
+
+// RunEvery runs a backfill immediately, and then once every interval, until ctx is cancelled. Each
+// backfill is logged.
+func (b *Backfiller) RunEvery(ctx context.Context, interval time.Duration, opts Options) {
+	filewalk.RunEvery(ctx, interval, func() { b.runAndLog(opts) })
+}
+
+func (b *Backfiller) runAndLog(opts Options) {
+	report, err := b.Run(opts)
+	if err != nil {
+		log.Errorf("SHA-256 backfill failed: %s", err)
+		return
+	}
+
+	report.LogProblems("SHA-256 backfill")
+	log.Infof("SHA-256 backfill checked %d files: %d backfilled, %d without a checksum, %d missing, %d mismatched, %d errors (complete: %t)",
+		report.FilesChecked, report.Backfilled, report.NoChecksum, report.Missing, report.Mismatched, report.Errors, report.Complete)
+}
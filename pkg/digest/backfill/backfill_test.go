@@ -0,0 +1,109 @@
+package backfill
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestBackfiller(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	root := t.TempDir()
+	blobs := blobstore.NewLocalBlobStore(root)
+	fileStor := stor.NewGormFileStorWithBlobStore(db, root, blobs)
+
+	good := createFile(t, db, blobs, "00000000-aaaa-0000-0000-000000000001", "good", "good")
+	sharing := createFile(t, db, blobs, "00000000-aaab-0000-0000-000000000002", "good", "")
+	require.NoError(t, db.Model(sharing).Update("uses_uuid", good.UUID).Error)
+	missing := createFile(t, db, blobs, "00000000-aaac-0000-0000-000000000003", "missing", "")
+	corrupted := createFile(t, db, blobs, "00000000-aaad-0000-0000-000000000004", "abcdef", "ABCDEF")
+	already := createFile(t, db, blobs, "00000000-aaae-0000-0000-000000000005", "already", "already")
+	require.NoError(t, db.Model(already).Update("sha256", "existing").Error)
+
+	// A file without an MD5 can't be verified, and deleted files and files that are still being
+	// uploaded are skipped.
+	noChecksum := createFile(t, db, blobs, "00000000-aaaf-0000-0000-000000000006", "nosum", "nosum")
+	require.NoError(t, db.Model(noChecksum).Update("checksum", "").Error)
+	deleted := createFile(t, db, blobs, "00000000-aab0-0000-0000-000000000007", "deleted", "deleted")
+	require.NoError(t, db.Model(deleted).Update("deleted_at", time.Now()).Error)
+	uploading := createFile(t, db, blobs, "00000000-aab1-0000-0000-000000000008", "uploading", "upl")
+	require.NoError(t, db.Model(uploading).Updates(map[string]interface{}{"current": false, "checksum": ""}).Error)
+
+	report, err := NewBackfiller(fileStor, blobs).Run(Options{DryRun: true, BatchSize: 2})
+	require.NoError(t, err)
+	require.True(t, report.Complete)
+	require.Equal(t, 5, report.FilesChecked)
+	require.Equal(t, 2, report.Backfilled)
+	require.Equal(t, 1, report.NoChecksum)
+	require.Equal(t, 1, report.Missing)
+	require.Equal(t, 1, report.Mismatched)
+	// The shared blob is only read once.
+	require.Equal(t, int64(len("good")+len("ABCDEF")), report.BytesRead)
+
+	// A dry run doesn't store anything.
+	require.Equal(t, "", reload(t, db, good.ID).Sha256)
+
+	report, err = NewBackfiller(fileStor, blobs).Run(Options{})
+	require.NoError(t, err)
+	require.True(t, report.Complete)
+
+	want, _, err := digest.FromReader(strings.NewReader("good"))
+	require.NoError(t, err)
+	require.Equal(t, want.SHA256, reload(t, db, good.ID).Sha256)
+	require.Equal(t, want.SHA256, reload(t, db, sharing.ID).Sha256)
+	require.Equal(t, "", reload(t, db, missing.ID).Sha256)
+	require.Equal(t, "", reload(t, db, corrupted.ID).Sha256)
+	require.Equal(t, "existing", reload(t, db, already.ID).Sha256)
+	require.Equal(t, "", reload(t, db, noChecksum.ID).Sha256)
+	require.Equal(t, "", reload(t, db, deleted.ID).Sha256)
+	require.Equal(t, "", reload(t, db, uploading.ID).Sha256)
+
+	// Only the files that couldn't be backfilled are left.
+	report, err = NewBackfiller(fileStor, blobs).Run(Options{})
+	require.NoError(t, err)
+	require.Equal(t, 3, report.FilesChecked)
+	require.Equal(t, 0, report.Backfilled)
+}
+
+// createFile creates a file row whose MD5 and size describe content, and stores blobContent as its
+// blob. A blank blobContent leaves the blob missing.
+func createFile(t *testing.T, db *gorm.DB, blobs blobstore.BlobStore, uuid, content, blobContent string) *mcmodel.File {
+	sums, _, err := digest.FromReader(strings.NewReader(content))
+	require.NoError(t, err)
+
+	f := &mcmodel.File{
+		UUID:      uuid,
+		ProjectID: 1,
+		Name:      uuid,
+		Path:      "/" + uuid,
+		MimeType:  "text/plain",
+		Size:      uint64(len(content)),
+		Checksum:  sums.MD5,
+		Current:   true,
+	}
+	require.NoError(t, db.Create(f).Error)
+
+	if blobContent != "" {
+		w, err := blobs.Create(f.BlobKey())
+		require.NoError(t, err)
+		_, err = w.Write([]byte(blobContent))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+	}
+
+	return f
+}
+
+func reload(t *testing.T, db *gorm.DB, id int) mcmodel.File {
+	var f mcmodel.File
+	require.NoError(t, db.First(&f, id).Error)
+	return f
+}
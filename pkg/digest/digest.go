@@ -0,0 +1,93 @@
+// Package digest computes the checksums stored for a file's contents. Files have always been
+// checksummed with MD5, which is what the files table's checksum column holds. MD5 is kept for
+// compatibility with existing clients and data, and a SHA-256 is computed alongside it in the same
+// pass over the data. When deciding whether two files have the same contents, the SHA-256 is
+// preferred whenever both files have one.
+package digest
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+)
+
+// Sums are the checksums of a file's contents, as lowercase hex strings. Either can be blank when it
+// isn't known, for example SHA256 for files uploaded before it was computed.
+type Sums struct {
+	MD5    string `json:"md5"`
+	SHA256 string `json:"sha256"`
+}
+
+// IsZero returns true when neither checksum is known.
+func (s Sums) IsZero() bool {
+	return s.MD5 == "" && s.SHA256 == ""
+}
+
+// Matches returns true if s and other are checksums of the same contents. The SHA-256 is compared when
+// both have one, otherwise it falls back to the MD5. Sums with no checksum in common never match.
+func (s Sums) Matches(other Sums) bool {
+	if s.SHA256 != "" && other.SHA256 != "" {
+		return s.SHA256 == other.SHA256
+	}
+
+	return s.MD5 != "" && s.MD5 == other.MD5
+}
+
+// Hasher computes all the checksums in a single pass. Data is written to it the same way it is
+// written to a hash.Hash.
+type Hasher struct {
+	md5    hash.Hash
+	sha256 hash.Hash
+	w      io.Writer
+}
+
+func New() *Hasher {
+	h := &Hasher{md5: md5.New(), sha256: sha256.New()}
+	h.w = io.MultiWriter(h.md5, h.sha256)
+	return h
+}
+
+// Write adds more data to the running checksums. It never returns an error.
+func (h *Hasher) Write(p []byte) (int, error) {
+	return h.w.Write(p)
+}
+
+// Reset discards the data written so far.
+func (h *Hasher) Reset() {
+	h.md5.Reset()
+	h.sha256.Reset()
+}
+
+// Sums returns the checksums of the data written so far. It doesn't change the state of the Hasher.
+func (h *Hasher) Sums() Sums {
+	return Sums{
+		MD5:    hex.EncodeToString(h.md5.Sum(nil)),
+		SHA256: hex.EncodeToString(h.sha256.Sum(nil)),
+	}
+}
+
+// FromReader reads r to the end and returns its checksums along with the number of bytes read.
+func FromReader(r io.Reader) (Sums, int64, error) {
+	h := New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return Sums{}, n, err
+	}
+
+	return h.Sums(), n, nil
+}
+
+// FromFile returns the checksums for the contents of the file at path.
+func FromFile(path string) (Sums, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Sums{}, err
+	}
+	defer f.Close()
+
+	sums, _, err := FromReader(f)
+	return sums, err
+}
@@ -0,0 +1,49 @@
+package digest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHasher(t *testing.T) {
+	h := New()
+	_, _ = h.Write([]byte("hello "))
+	_, _ = h.Write([]byte("world"))
+	sums := h.Sums()
+	require.Equal(t, "5eb63bbbe01eeed093cb22bb8f5acdc3", sums.MD5)
+	require.Equal(t, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", sums.SHA256)
+
+	fromReader, n, err := FromReader(strings.NewReader("hello world"))
+	require.NoError(t, err)
+	require.Equal(t, int64(11), n)
+	require.Equal(t, sums, fromReader)
+
+	path := filepath.Join(t.TempDir(), "f.txt")
+	require.NoError(t, os.WriteFile(path, []byte("hello world"), 0644))
+	fromFile, err := FromFile(path)
+	require.NoError(t, err)
+	require.Equal(t, sums, fromFile)
+
+	h.Reset()
+	require.Equal(t, "d41d8cd98f00b204e9800998ecf8427e", h.Sums().MD5)
+}
+
+func TestSumsMatches(t *testing.T) {
+	both := Sums{MD5: "m1", SHA256: "s1"}
+
+	// The SHA-256 wins when both have one, even if the MD5s agree.
+	require.True(t, both.Matches(Sums{MD5: "m2", SHA256: "s1"}))
+	require.False(t, both.Matches(Sums{MD5: "m1", SHA256: "s2"}))
+
+	// Otherwise fall back to the MD5.
+	require.True(t, both.Matches(Sums{MD5: "m1"}))
+	require.True(t, Sums{MD5: "m1"}.Matches(both))
+	require.False(t, both.Matches(Sums{MD5: "m2"}))
+
+	require.False(t, Sums{}.Matches(Sums{}))
+	require.True(t, Sums{}.IsZero())
+}
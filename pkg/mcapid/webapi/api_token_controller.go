@@ -0,0 +1,137 @@
+package webapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/materials-commons/hydra/pkg/apitoken"
+	"github.com/materials-commons/hydra/pkg/mcapid/webapi/apimiddleware"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+)
+
+// APITokenController lets users create, list and revoke the scoped API tokens used for automation.
+// Tokens can only be managed with the user's own api_token, not with another scoped token.
+type APITokenController struct {
+	tokenStor   stor.APITokenStor
+	projectStor stor.ProjectStor
+	auth        *apitoken.Authenticator
+}
+
+func NewAPITokenController(tokenStor stor.APITokenStor, projectStor stor.ProjectStor, auth *apitoken.Authenticator) *APITokenController {
+	return &APITokenController{tokenStor: tokenStor, projectStor: projectStor, auth: auth}
+}
+
+// createAPITokenResponse is the only time a token's secret is returned.
+type createAPITokenResponse struct {
+	*mcmodel.APIToken
+	Secret string `json:"secret"`
+}
+
+// CreateToken creates a token for the user. The project_id is optional, without it the token can be
+// used with all the user's projects. The expires_at is optional too, a token without one is valid
+// until it's revoked.
+func (c *APITokenController) CreateToken(ctx echo.Context) error {
+	var req struct {
+		Name      string     `json:"name"`
+		ProjectID int        `json:"project_id"`
+		Scope     string     `json:"scope"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	user, err := c.tokenOwner(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+
+	if !mcmodel.ValidAPITokenScope(req.Scope) {
+		return errorResponse(ctx, http.StatusBadRequest, "scope must be one of read, write or read-write")
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return errorResponse(ctx, http.StatusBadRequest, "expires_at must be in the future")
+	}
+
+	if req.ProjectID != 0 {
+		role, err := c.projectStor.GetUserProjectRole(user.ID, req.ProjectID)
+		switch {
+		case err != nil:
+			return errorResponse(ctx, http.StatusInternalServerError, "Failed to check project access")
+		case !role.CanRead():
+			return errorResponse(ctx, http.StatusForbidden, "User does not have access to project")
+		}
+	}
+
+	token := &mcmodel.APIToken{
+		Name:      req.Name,
+		UserID:    user.ID,
+		ProjectID: req.ProjectID,
+		Scope:     req.Scope,
+		ExpiresAt: req.ExpiresAt,
+	}
+
+	secret, token, err := c.tokenStor.CreateAPIToken(token)
+	if err != nil {
+		return errorResponse(ctx, http.StatusInternalServerError, "Failed to create token")
+	}
+
+	return ctx.JSON(http.StatusCreated, createAPITokenResponse{APIToken: token, Secret: secret})
+}
+
+// ListTokens returns the user's tokens, without their secrets.
+func (c *APITokenController) ListTokens(ctx echo.Context) error {
+	user, err := c.tokenOwner(ctx)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := c.tokenStor.ListAPITokensForUser(user.ID)
+	if err != nil {
+		return errorResponse(ctx, http.StatusInternalServerError, "Failed to list tokens")
+	}
+
+	return ctx.JSON(http.StatusOK, tokens)
+}
+
+// RevokeToken revokes the token given by the id path parameter. It stops being accepted by mcapid
+// straight away, and by the other servers once their caches expire.
+func (c *APITokenController) RevokeToken(ctx echo.Context) error {
+	user, err := c.tokenOwner(ctx)
+	if err != nil {
+		return err
+	}
+
+	tokenID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return errorResponse(ctx, http.StatusBadRequest, "Invalid token ID")
+	}
+
+	token, err := c.auth.Revoke(user.ID, tokenID)
+	switch {
+	case stor.IsRecordNotFound(err):
+		return errorResponse(ctx, http.StatusNotFound, "Token not found")
+	case err != nil:
+		return errorResponse(ctx, http.StatusInternalServerError, "Failed to revoke token")
+	}
+
+	return ctx.JSON(http.StatusOK, token)
+}
+
+// tokenOwner returns the authenticated user, or an error if they authenticated with a scoped token.
+func (c *APITokenController) tokenOwner(ctx echo.Context) (*mcmodel.User, error) {
+	principal := apimiddleware.Principal(ctx)
+	switch {
+	case principal == nil:
+		return nil, echo.ErrUnauthorized
+	case principal.IsScoped():
+		return nil, echo.NewHTTPError(http.StatusForbidden, "API tokens can't be managed with a scoped API token")
+	default:
+		return principal.User, nil
+	}
+}
@@ -6,17 +6,23 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/apitoken"
 )
 
-type GetUserByAPIKeyFN func(string) (*mcmodel.User, error)
+// principalKey is the context key the authenticated apitoken.Principal is stored under.
+const principalKey = "principal"
+
+type AuthenticateFN func(string) (*apitoken.Principal, error)
 
 type APIKeyConfig struct {
-	Skipper         middleware.Skipper
-	Keyname         string
-	GetUserByAPIKey GetUserByAPIKeyFN
+	Skipper      middleware.Skipper
+	Keyname      string
+	Authenticate AuthenticateFN
 }
 
+// APIKeyAuth middleware authenticates the request by the API key in the Keyname header or query
+// parameter. The key can be a user's api_token or a scoped API token. The user is stored in the
+// context as "user", and the scopes are checked by ProjectAccessAuth and RequireProjectRole.
 func APIKeyAuth(config APIKeyConfig) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -29,20 +35,27 @@ func APIKeyAuth(config APIKeyConfig) echo.MiddlewareFunc {
 				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 			}
 
-			user, err := config.GetUserByAPIKey(value)
+			principal, err := config.Authenticate(value)
 			switch {
 			case err != nil:
 				return echo.ErrUnauthorized
-			case user == nil:
+			case principal == nil || principal.User == nil:
 				return echo.ErrUnauthorized
 			default:
-				c.Set("User", *user)
+				c.Set("user", principal.User)
+				c.Set(principalKey, principal)
 				return next(c)
 			}
 		}
 	}
 }
 
+// Principal returns who the request was authenticated as, as stored in the context by APIKeyAuth.
+func Principal(c echo.Context) *apitoken.Principal {
+	principal, _ := c.Get(principalKey).(*apitoken.Principal)
+	return principal
+}
+
 func getAPIKeyFromRequest(key string, c echo.Context) (string, error) {
 	if value, err := keyFromHeader(key, c); err == nil {
 		return value, nil
@@ -6,19 +6,33 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/materials-commons/hydra/pkg/authz"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 )
 
-type HasAccessToProjectFN func(userID, projectID int) (bool, error)
+// The context keys the project and the user's role in it are stored under.
+const (
+	projectIDKey   = "project_id"
+	projectRoleKey = "project_role"
+)
+
+type GetProjectRoleFN func(userID, projectID int) (authz.Role, error)
 
 type ProjectAccessConfig struct {
-	Skipper            middleware.Skipper
-	HasAccessToProject HasAccessToProjectFN
+	Skipper        middleware.Skipper
+	GetProjectRole GetProjectRoleFN
+
+	// ProjectIDParam is the path parameter the project ID is in. When it's empty the project ID is the
+	// project_id query parameter.
+	ProjectIDParam string
 }
 
 // ProjectAccessAuth middleware checks that the user has access to the project. It assumes that the
-// project ID is passed in as a query parameter and that the user is stored in the context as "user".
-// This means the APIKeyAuth middleware must be used before this middleware.
+// project ID is passed in as a query parameter (or in config.ProjectIDParam) and that the user is
+// stored in the context as "user".
+// This means the APIKeyAuth middleware must be used before this middleware. Any role in the project
+// is enough, the user's role is stored in the context for RequireProjectRole to check. An API token
+// restricted to a different project is denied.
 func ProjectAccessAuth(config ProjectAccessConfig) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -26,25 +40,75 @@ func ProjectAccessAuth(config ProjectAccessConfig) echo.MiddlewareFunc {
 				return next(c)
 			}
 
-			projectId, err := strconv.Atoi(c.QueryParam("project_id"))
+			projectIDValue := c.QueryParam("project_id")
+			if config.ProjectIDParam != "" {
+				projectIDValue = c.Param(config.ProjectIDParam)
+			}
+
+			projectId, err := strconv.Atoi(projectIDValue)
 			if err != nil {
 				return echo.NewHTTPError(http.StatusBadRequest, "Invalid project ID")
 			}
 
-			user := c.Get("user").(*mcmodel.User)
+			user, _ := c.Get("user").(*mcmodel.User)
 			if user == nil {
 				return echo.NewHTTPError(http.StatusUnauthorized, "User not authenticated")
 			}
 
-			hasAccess, err := config.HasAccessToProject(user.ID, projectId)
+			if principal := Principal(c); principal != nil {
+				if err := principal.CheckProject(projectId); err != nil {
+					return echo.NewHTTPError(http.StatusForbidden, err.Error())
+				}
+			}
+
+			role, err := config.GetProjectRole(user.ID, projectId)
 			if err != nil {
 				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 			}
 
-			if !hasAccess {
+			if !role.CanRead() {
 				return echo.NewHTTPError(http.StatusForbidden, "User does not have access to project")
 			}
+
+			c.Set(projectIDKey, projectId)
+			c.Set(projectRoleKey, role)
+			return next(c)
+		}
+	}
+}
+
+// RequireProjectRole middleware denies requests from users whose role in the project is below
+// required. It must be used after ProjectAccessAuth. Denied requests get a 403 with the authz error,
+// so a viewer attempting a write always sees authz.ErrReadOnly. Requests made with an API token must
+// also be in its scope: requiring authz.Contributor or above needs a token that can write, anything
+// less a token that can read.
+func RequireProjectRole(required authz.Role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role, _ := c.Get(projectRoleKey).(authz.Role)
+			if err := authz.Check(role, required); err != nil {
+				return echo.NewHTTPError(http.StatusForbidden, err.Error())
+			}
+
+			if principal := Principal(c); principal != nil {
+				projectID, _ := c.Get(projectIDKey).(int)
+				checkScope := principal.CheckRead
+				if required.CanWrite() {
+					checkScope = principal.CheckWrite
+				}
+
+				if err := checkScope(projectID); err != nil {
+					return echo.NewHTTPError(http.StatusForbidden, err.Error())
+				}
+			}
+
 			return next(c)
 		}
 	}
 }
+
+// ProjectRole returns the user's role in the project, as stored in the context by ProjectAccessAuth.
+func ProjectRole(c echo.Context) authz.Role {
+	role, _ := c.Get(projectRoleKey).(authz.Role)
+	return role
+}
@@ -0,0 +1,54 @@
+package apimiddleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+)
+
+// SiteAdmins is the set of users, by email, who administer the whole site rather than a project.
+type SiteAdmins map[string]bool
+
+// ParseSiteAdmins parses a comma separated list of email addresses, such as the MCAPID_SITE_ADMINS
+// setting. Emails are compared case-insensitively, and blank entries are ignored.
+func ParseSiteAdmins(commaSeparatedEmails string) SiteAdmins {
+	admins := make(SiteAdmins)
+	for _, email := range strings.Split(commaSeparatedEmails, ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			admins[email] = true
+		}
+	}
+
+	return admins
+}
+
+// IsSiteAdmin returns true if user is one of the site admins.
+func (a SiteAdmins) IsSiteAdmin(user *mcmodel.User) bool {
+	return user != nil && a[strings.ToLower(user.Email)]
+}
+
+// RequireSiteAdmin middleware denies requests from users who aren't site admins. It must be used after
+// APIKeyAuth. Site administration can't be done with a scoped API token, only with the user's own
+// api_token.
+func RequireSiteAdmin(admins SiteAdmins) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user, _ := c.Get("user").(*mcmodel.User)
+			if user == nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "User not authenticated")
+			}
+
+			if principal := Principal(c); principal != nil && principal.IsScoped() {
+				return echo.NewHTTPError(http.StatusForbidden, "Scoped API tokens can't be used for site administration")
+			}
+
+			if !admins.IsSiteAdmin(user) {
+				return echo.NewHTTPError(http.StatusForbidden, "Site admin access is required")
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package apimiddleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/materials-commons/hydra/pkg/apitoken"
+	"github.com/materials-commons/hydra/pkg/authz"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/stretchr/testify/require"
+)
+
+// TestQuotaAdminAccess sets up the middleware the way mcapid does for the quota routes: project quotas
+// can only be changed by the project's admins, user quotas only by site admins.
+func TestQuotaAdminAccess(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	owner := b.User("owner")
+	member := b.User("member")
+	siteAdmin := b.User("siteadmin")
+	project := b.Project("proj", owner)
+	b.AddMember(project, member)
+	for _, user := range []*mcmodel.User{owner, member, siteAdmin} {
+		require.NoError(t, db.Model(user).Update("api_token", user.Name+"-token").Error)
+	}
+
+	tokenStor := stor.NewGormAPITokenStor(db)
+	scopedSecret, _, err := tokenStor.CreateAPIToken(&mcmodel.APIToken{
+		UserID: siteAdmin.ID, Scope: mcmodel.APITokenScopeReadWrite,
+	})
+	require.NoError(t, err)
+
+	authenticator := apitoken.NewAuthenticator(stor.NewGormUserStor(db), tokenStor, time.Minute)
+	apikeyAuth := APIKeyAuth(APIKeyConfig{
+		Skipper:      middleware.DefaultSkipper,
+		Keyname:      "apikey",
+		Authenticate: authenticator.Authenticate,
+	})
+
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e := echo.New()
+	projectQuotas := e.Group("/quotas/projects", apikeyAuth, ProjectAccessAuth(ProjectAccessConfig{
+		Skipper:        middleware.DefaultSkipper,
+		GetProjectRole: stor.NewGormProjectStor(db).GetUserProjectRole,
+		ProjectIDParam: "id",
+	}))
+	projectQuotas.GET("/:id", ok, RequireProjectRole(authz.Viewer))
+	projectQuotas.PUT("/:id", ok, RequireProjectRole(authz.Admin))
+
+	userQuotas := e.Group("/quotas/users", apikeyAuth, RequireSiteAdmin(ParseSiteAdmins(" , SiteAdmin@Test.com")))
+	userQuotas.PUT("/:id", ok)
+
+	request := func(method, path, apikey string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"limit_bytes":0}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if apikey != "" {
+			req.Header.Set("apikey", apikey)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	projectPath := fmt.Sprintf("/quotas/projects/%d", project.ID)
+	userPath := fmt.Sprintf("/quotas/users/%d", member.ID)
+
+	var tests = []struct {
+		name     string
+		method   string
+		path     string
+		apikey   string
+		expected int
+	}{
+		{name: "Anonymous project quota change", method: http.MethodPut, path: projectPath, expected: http.StatusBadRequest},
+		{name: "Unknown key project quota change", method: http.MethodPut, path: projectPath, apikey: "no-such-token", expected: http.StatusUnauthorized},
+		{name: "Contributor project quota change", method: http.MethodPut, path: projectPath, apikey: "member-token", expected: http.StatusForbidden},
+		{name: "Non-member project quota change", method: http.MethodPut, path: projectPath, apikey: "siteadmin-token", expected: http.StatusForbidden},
+		{name: "Project admin project quota change", method: http.MethodPut, path: projectPath, apikey: "owner-token", expected: http.StatusOK},
+		{name: "Contributor reads project quota", method: http.MethodGet, path: projectPath, apikey: "member-token", expected: http.StatusOK},
+		{name: "Anonymous user quota change", method: http.MethodPut, path: userPath, expected: http.StatusBadRequest},
+		{name: "Project admin user quota change", method: http.MethodPut, path: userPath, apikey: "owner-token", expected: http.StatusForbidden},
+		{name: "Site admin scoped token user quota change", method: http.MethodPut, path: userPath, apikey: scopedSecret, expected: http.StatusForbidden},
+		{name: "Site admin user quota change", method: http.MethodPut, path: userPath, apikey: "siteadmin-token", expected: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, request(test.method, test.path, test.apikey))
+		})
+	}
+}
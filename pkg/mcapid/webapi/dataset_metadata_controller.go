@@ -0,0 +1,125 @@
+package webapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/materials-commons/hydra/pkg/datasetmeta"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+)
+
+// DatasetMetadataController renders the DataCite and schema.org metadata for a dataset, for the tools
+// that mint its DOI and publish it.
+type DatasetMetadataController struct {
+	datasetStor stor.DatasetStor
+}
+
+func NewDatasetMetadataController(datasetStor stor.DatasetStor) *DatasetMetadataController {
+	return &DatasetMetadataController{datasetStor: datasetStor}
+}
+
+// GetDataCite returns the DataCite kernel-4 XML for the dataset given by the dataset_id query parameter.
+// With test=true it is rendered for the dataset's test DOI. A dataset missing required metadata gets a
+// 422 listing the problems.
+func (c *DatasetMetadataController) GetDataCite(ctx echo.Context) error {
+	src, opts, err := c.source(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := datasetmeta.DataCite(src, opts)
+	if err != nil {
+		return metadataErrorResponse(ctx, err)
+	}
+
+	return ctx.Blob(http.StatusOK, echo.MIMEApplicationXMLCharsetUTF8, data)
+}
+
+// GetSchemaOrg returns the schema.org JSON-LD for the dataset given by the dataset_id query parameter.
+func (c *DatasetMetadataController) GetSchemaOrg(ctx echo.Context) error {
+	src, opts, err := c.source(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := datasetmeta.SchemaOrg(src, opts)
+	if err != nil {
+		return metadataErrorResponse(ctx, err)
+	}
+
+	return ctx.Blob(http.StatusOK, "application/ld+json", data)
+}
+
+// ValidateMetadata checks that the dataset has the metadata required to mint its DOI. It returns the
+// problems found, which is an empty list when there are none.
+func (c *DatasetMetadataController) ValidateMetadata(ctx echo.Context) error {
+	src, opts, err := c.source(ctx)
+	if err != nil {
+		return err
+	}
+
+	var verr *datasetmeta.ValidationError
+	err = datasetmeta.Validate(src, opts)
+	switch {
+	case errors.As(err, &verr):
+		return ctx.JSON(http.StatusOK, verr)
+	case err != nil:
+		return errorResponse(ctx, http.StatusInternalServerError, "Failed to validate dataset metadata")
+	}
+
+	return ctx.JSON(http.StatusOK, datasetmeta.ValidationError{Problems: []datasetmeta.FieldError{}})
+}
+
+// source loads the dataset given by the dataset_id query parameter, checking it is in the project given
+// by project_id, along with its project and owner. When the request is invalid it returns an
+// echo.HTTPError for the handler to return.
+func (c *DatasetMetadataController) source(ctx echo.Context) (datasetmeta.Source, datasetmeta.Options, error) {
+	var (
+		src  datasetmeta.Source
+		opts datasetmeta.Options
+	)
+
+	projectID, err := strconv.Atoi(ctx.QueryParam("project_id"))
+	if err != nil {
+		return src, opts, echo.NewHTTPError(http.StatusBadRequest, "Invalid project ID")
+	}
+
+	datasetID, err := strconv.Atoi(ctx.QueryParam("dataset_id"))
+	if err != nil {
+		return src, opts, echo.NewHTTPError(http.StatusBadRequest, "Invalid dataset ID")
+	}
+
+	if test := ctx.QueryParam("test"); test != "" {
+		if opts.Test, err = strconv.ParseBool(test); err != nil {
+			return src, opts, echo.NewHTTPError(http.StatusBadRequest, "Invalid test flag")
+		}
+	}
+
+	src.Dataset, err = c.datasetStor.GetDatasetByID(datasetID)
+	switch {
+	case stor.IsRecordNotFound(err):
+		return src, opts, echo.NewHTTPError(http.StatusNotFound, "Dataset not found")
+	case err != nil:
+		return src, opts, echo.NewHTTPError(http.StatusInternalServerError, "Failed to get dataset")
+	case src.Dataset.ProjectID != projectID:
+		return src, opts, echo.NewHTTPError(http.StatusNotFound, "Dataset not found")
+	}
+
+	if src.Project, err = c.datasetStor.GetDatasetProject(src.Dataset); err != nil {
+		return src, opts, echo.NewHTTPError(http.StatusInternalServerError, "Failed to get dataset project")
+	}
+	src.Owner = src.Project.Owner
+
+	return src, opts, nil
+}
+
+func metadataErrorResponse(ctx echo.Context, err error) error {
+	var verr *datasetmeta.ValidationError
+	if errors.As(err, &verr) {
+		return ctx.JSON(http.StatusUnprocessableEntity, verr)
+	}
+
+	return errorResponse(ctx, http.StatusInternalServerError, "Failed to render dataset metadata")
+}
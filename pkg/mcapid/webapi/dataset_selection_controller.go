@@ -0,0 +1,93 @@
+package webapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/materials-commons/hydra/pkg/mcdb"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+)
+
+// DatasetSelectionController previews which files a dataset's file selection puts in the dataset.
+type DatasetSelectionController struct {
+	datasetStor stor.DatasetStor
+}
+
+func NewDatasetSelectionController(datasetStor stor.DatasetStor) *DatasetSelectionController {
+	return &DatasetSelectionController{datasetStor: datasetStor}
+}
+
+// SelectionPreviewFile is a single file in a selection preview.
+type SelectionPreviewFile struct {
+	ID   int    `json:"id"`
+	Path string `json:"path"`
+	Size uint64 `json:"size"`
+}
+
+// SelectionPreview is the list of files a file selection puts in a dataset, and their total size.
+type SelectionPreview struct {
+	FileCount int                    `json:"file_count"`
+	TotalSize uint64                 `json:"total_size"`
+	Files     []SelectionPreviewFile `json:"files"`
+}
+
+// PreviewSelection returns the files that would be in the dataset given by the dataset_id query parameter.
+// When the body contains a file_selection it is previewed in place of the dataset's current selection,
+// without changing the dataset.
+func (c *DatasetSelectionController) PreviewSelection(ctx echo.Context) error {
+	var req struct {
+		FileSelection *mcmodel.FileSelection `json:"file_selection"`
+	}
+
+	projectID, err := strconv.Atoi(ctx.QueryParam("project_id"))
+	if err != nil {
+		return errorResponse(ctx, http.StatusBadRequest, "Invalid project ID")
+	}
+
+	datasetID, err := strconv.Atoi(ctx.QueryParam("dataset_id"))
+	if err != nil {
+		return errorResponse(ctx, http.StatusBadRequest, "Invalid dataset ID")
+	}
+
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+
+	dataset, err := c.datasetStor.GetDatasetByID(datasetID)
+	switch {
+	case stor.IsRecordNotFound(err):
+		return errorResponse(ctx, http.StatusNotFound, "Dataset not found")
+	case err != nil:
+		return errorResponse(ctx, http.StatusInternalServerError, "Failed to get dataset")
+	case dataset.ProjectID != projectID:
+		return errorResponse(ctx, http.StatusNotFound, "Dataset not found")
+	}
+
+	if req.FileSelection != nil {
+		if err := mcdb.ValidateFileSelection(req.FileSelection); err != nil {
+			return errorResponse(ctx, http.StatusBadRequest, err.Error())
+		}
+
+		selection, err := json.Marshal(req.FileSelection)
+		if err != nil {
+			return errorResponse(ctx, http.StatusBadRequest, "Invalid file selection")
+		}
+		dataset.FileSelection = string(selection)
+	}
+
+	files, err := c.datasetStor.ListSelectedFiles(dataset)
+	if err != nil {
+		return errorResponse(ctx, http.StatusInternalServerError, "Failed to list selected files")
+	}
+
+	preview := SelectionPreview{FileCount: len(files), Files: make([]SelectionPreviewFile, 0, len(files))}
+	for _, file := range files {
+		preview.TotalSize += file.Size
+		preview.Files = append(preview.Files, SelectionPreviewFile{ID: file.ID, Path: file.FullPath(), Size: file.Size})
+	}
+
+	return ctx.JSON(http.StatusOK, preview)
+}
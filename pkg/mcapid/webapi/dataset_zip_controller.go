@@ -0,0 +1,82 @@
+package webapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/materials-commons/hydra/pkg/datasetzip"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+)
+
+// DatasetZipController starts builds of the zip archive for a dataset and reports their status.
+type DatasetZipController struct {
+	datasetStor stor.DatasetStor
+	builder     *datasetzip.Builder
+}
+
+func NewDatasetZipController(datasetStor stor.DatasetStor, builder *datasetzip.Builder) *DatasetZipController {
+	return &DatasetZipController{datasetStor: datasetStor, builder: builder}
+}
+
+// BuildZip starts building the zip for the dataset given by the dataset_id query parameter. The build
+// runs in the background, use GetZipStatus to follow it.
+func (c *DatasetZipController) BuildZip(ctx echo.Context) error {
+	datasetID, err := c.datasetParam(ctx)
+	if err != nil {
+		return err
+	}
+
+	status, err := c.builder.StartBuild(datasetID)
+	switch {
+	case errors.Is(err, datasetzip.ErrBuildInProgress):
+		return errorResponse(ctx, http.StatusConflict, "Dataset zip is already being built")
+	case err != nil:
+		return errorResponse(ctx, http.StatusInternalServerError, "Failed to start building dataset zip")
+	}
+
+	return ctx.JSON(http.StatusAccepted, status)
+}
+
+// GetZipStatus returns the status of the zip for the dataset given by the dataset_id query parameter.
+func (c *DatasetZipController) GetZipStatus(ctx echo.Context) error {
+	datasetID, err := c.datasetParam(ctx)
+	if err != nil {
+		return err
+	}
+
+	status, err := c.builder.Status(datasetID)
+	if err != nil {
+		return errorResponse(ctx, http.StatusInternalServerError, "Failed to get dataset zip status")
+	}
+
+	return ctx.JSON(http.StatusOK, status)
+}
+
+// datasetParam gets the dataset_id query parameter, and checks that the dataset is in the project given
+// by the project_id query parameter that access was checked against. When either is invalid it returns
+// an echo.HTTPError for the handler to return.
+func (c *DatasetZipController) datasetParam(ctx echo.Context) (int, error) {
+	projectID, err := strconv.Atoi(ctx.QueryParam("project_id"))
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid project ID")
+	}
+
+	datasetID, err := strconv.Atoi(ctx.QueryParam("dataset_id"))
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid dataset ID")
+	}
+
+	dataset, err := c.datasetStor.GetDatasetByID(datasetID)
+	switch {
+	case stor.IsRecordNotFound(err):
+		return 0, echo.NewHTTPError(http.StatusNotFound, "Dataset not found")
+	case err != nil:
+		return 0, echo.NewHTTPError(http.StatusInternalServerError, "Failed to get dataset")
+	case dataset.ProjectID != projectID:
+		return 0, echo.NewHTTPError(http.StatusNotFound, "Dataset not found")
+	}
+
+	return datasetID, nil
+}
@@ -0,0 +1,155 @@
+package webapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/materials-commons/hydra/pkg/mcapid"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+)
+
+// FileVersionController exposes the version history of project files. Every request identifies the
+// file by the project_id and path query parameters.
+type FileVersionController struct {
+	fileStor stor.FileStor
+}
+
+// NewFileVersionController creates a new FileVersionController.
+func NewFileVersionController(fileStor stor.FileStor) *FileVersionController {
+	return &FileVersionController{fileStor: fileStor}
+}
+
+// FileVersion is a single version of a file as returned by the API.
+type FileVersion struct {
+	ID           int    `json:"id"`
+	UUID         string `json:"uuid"`
+	Current      bool   `json:"current"`
+	Size         uint64 `json:"size"`
+	Checksum     string `json:"checksum"`
+	Sha256       string `json:"sha256"`
+	MimeType     string `json:"mime_type"`
+	UploadSource string `json:"upload_source"`
+	OwnerID      int    `json:"owner_id"`
+	OwnerName    string `json:"owner_name"`
+	CreatedAt    string `json:"created_at"`
+}
+
+func toFileVersion(file mcmodel.File) FileVersion {
+	v := FileVersion{
+		ID:           file.ID,
+		UUID:         file.UUID,
+		Current:      file.Current,
+		Size:         file.Size,
+		Checksum:     file.Checksum,
+		Sha256:       file.Sha256,
+		MimeType:     file.MimeType,
+		UploadSource: file.UploadSource,
+		OwnerID:      file.OwnerID,
+		CreatedAt:    file.CreatedAt.UTC().Format(time.RFC3339),
+	}
+
+	if file.Owner != nil {
+		v.OwnerName = file.Owner.Name
+	}
+
+	return v
+}
+
+// ListVersions returns all the versions of a file, oldest first.
+func (c *FileVersionController) ListVersions(ctx echo.Context) error {
+	projectID, path, err := fileVersionParams(ctx)
+	if err != nil {
+		return err
+	}
+
+	versions, err := c.fileStor.ListFileVersions(projectID, path)
+	switch {
+	case stor.IsRecordNotFound(err):
+		return errorResponse(ctx, http.StatusNotFound, "File not found")
+	case err != nil:
+		return errorResponse(ctx, http.StatusInternalServerError, "Failed to list file versions")
+	}
+
+	resp := make([]FileVersion, 0, len(versions))
+	for _, version := range versions {
+		resp = append(resp, toFileVersion(version))
+	}
+
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// PromoteVersion makes the version given by the version_id query parameter the current version of the file.
+func (c *FileVersionController) PromoteVersion(ctx echo.Context) error {
+	projectID, path, err := fileVersionParams(ctx)
+	if err != nil {
+		return err
+	}
+
+	versionID, err := strconv.Atoi(ctx.QueryParam("version_id"))
+	if err != nil {
+		return errorResponse(ctx, http.StatusBadRequest, "Invalid version ID")
+	}
+
+	var version *mcmodel.File
+	err = mcapid.WithProjectMutex(projectID, func() error {
+		version, err = c.fileStor.PromoteFileVersion(projectID, path, versionID)
+		return err
+	})
+
+	switch {
+	case stor.IsRecordNotFound(err):
+		return errorResponse(ctx, http.StatusNotFound, "Version not found")
+	case err != nil:
+		return errorResponse(ctx, http.StatusInternalServerError, "Failed to promote version")
+	}
+
+	return ctx.JSON(http.StatusOK, toFileVersion(*version))
+}
+
+// DiffVersions returns the metadata fields that differ between the versions given by the from and to
+// query parameters.
+func (c *FileVersionController) DiffVersions(ctx echo.Context) error {
+	projectID, path, err := fileVersionParams(ctx)
+	if err != nil {
+		return err
+	}
+
+	fromID, err := strconv.Atoi(ctx.QueryParam("from"))
+	if err != nil {
+		return errorResponse(ctx, http.StatusBadRequest, "Invalid from version ID")
+	}
+
+	toID, err := strconv.Atoi(ctx.QueryParam("to"))
+	if err != nil {
+		return errorResponse(ctx, http.StatusBadRequest, "Invalid to version ID")
+	}
+
+	diffs, err := c.fileStor.DiffFileVersions(projectID, path, fromID, toID)
+	switch {
+	case stor.IsRecordNotFound(err):
+		return errorResponse(ctx, http.StatusNotFound, "Version not found")
+	case err != nil:
+		return errorResponse(ctx, http.StatusInternalServerError, "Failed to diff versions")
+	}
+
+	return ctx.JSON(http.StatusOK, diffs)
+}
+
+// fileVersionParams gets the project_id and path query parameters. When they are invalid it returns an
+// echo.HTTPError for the handler to return.
+func fileVersionParams(ctx echo.Context) (int, string, error) {
+	projectID, err := strconv.Atoi(ctx.QueryParam("project_id"))
+	if err != nil {
+		return 0, "", echo.NewHTTPError(http.StatusBadRequest, "Invalid project ID")
+	}
+
+	path := ctx.QueryParam("path")
+	if path == "" || path[0] != '/' {
+		return 0, "", echo.NewHTTPError(http.StatusBadRequest, "Invalid path")
+	}
+
+	return projectID, path, nil
+}
@@ -0,0 +1,116 @@
+package webapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/materials-commons/hydra/pkg/provenance"
+)
+
+// ProvenanceController returns the lineage of samples and files, as a JSON graph or GraphViz DOT.
+type ProvenanceController struct {
+	service *provenance.Service
+}
+
+func NewProvenanceController(service *provenance.Service) *ProvenanceController {
+	return &ProvenanceController{service: service}
+}
+
+// lineageRequest is the query parameters shared by the lineage endpoints.
+type lineageRequest struct {
+	projectID int
+	direction provenance.Direction
+	depth     int
+	format    string
+}
+
+// GetSampleLineage returns the lineage of the sample given by the entity_id query parameter. The optional
+// direction (upstream, downstream or both), depth and format (json or dot) query parameters control
+// what's returned.
+func (c *ProvenanceController) GetSampleLineage(ctx echo.Context) error {
+	req, err := parseLineageRequest(ctx)
+	if err != nil {
+		return err
+	}
+
+	entityID, err := strconv.Atoi(ctx.QueryParam("entity_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid entity ID")
+	}
+
+	g, err := c.service.SampleLineage(req.projectID, entityID, req.direction, req.depth)
+	switch {
+	case stor.IsRecordNotFound(err):
+		return echo.NewHTTPError(http.StatusNotFound, "Sample not found")
+	case err != nil:
+		return errorResponse(ctx, http.StatusInternalServerError, "Failed to build sample lineage")
+	}
+
+	return writeLineage(ctx, g, req.format)
+}
+
+// GetFileLineage returns the lineage of the file given by the file_id query parameter. It takes the
+// same optional query parameters as GetSampleLineage.
+func (c *ProvenanceController) GetFileLineage(ctx echo.Context) error {
+	req, err := parseLineageRequest(ctx)
+	if err != nil {
+		return err
+	}
+
+	fileID, err := strconv.Atoi(ctx.QueryParam("file_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid file ID")
+	}
+
+	g, err := c.service.FileLineage(req.projectID, fileID, req.direction, req.depth)
+	switch {
+	case stor.IsRecordNotFound(err):
+		return echo.NewHTTPError(http.StatusNotFound, "File not found")
+	case err != nil:
+		return errorResponse(ctx, http.StatusInternalServerError, "Failed to build file lineage")
+	}
+
+	return writeLineage(ctx, g, req.format)
+}
+
+func parseLineageRequest(ctx echo.Context) (lineageRequest, error) {
+	var (
+		req lineageRequest
+		err error
+	)
+
+	if req.projectID, err = strconv.Atoi(ctx.QueryParam("project_id")); err != nil {
+		return req, echo.NewHTTPError(http.StatusBadRequest, "Invalid project ID")
+	}
+
+	if req.direction, err = provenance.ParseDirection(ctx.QueryParam("direction")); err != nil {
+		return req, echo.NewHTTPError(http.StatusBadRequest, "Invalid direction")
+	}
+
+	req.depth = provenance.DefaultDepth
+	if depth := ctx.QueryParam("depth"); depth != "" {
+		if req.depth, err = strconv.Atoi(depth); err != nil || req.depth < 1 {
+			return req, echo.NewHTTPError(http.StatusBadRequest, "Invalid depth")
+		}
+	}
+
+	switch req.format = ctx.QueryParam("format"); req.format {
+	case "":
+		req.format = "json"
+	case "json", "dot":
+	default:
+		return req, echo.NewHTTPError(http.StatusBadRequest, "Invalid format")
+	}
+
+	return req, nil
+}
+
+func writeLineage(ctx echo.Context, g *provenance.Graph, format string) error {
+	if format == "dot" {
+		return ctx.Blob(http.StatusOK, "text/vnd.graphviz; charset=UTF-8", []byte(g.DOT()))
+	}
+
+	return ctx.JSON(http.StatusOK, g)
+}
@@ -0,0 +1,78 @@
+package webapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+)
+
+// QuotaController lets admins set and inspect project and user storage quotas. A limit of 0 removes
+// the quota.
+type QuotaController struct {
+	quotaStor stor.QuotaStor
+}
+
+func NewQuotaController(quotaStor stor.QuotaStor) *QuotaController {
+	return &QuotaController{quotaStor: quotaStor}
+}
+
+func (c *QuotaController) GetProjectQuota(ctx echo.Context) error {
+	return c.getQuota(ctx, c.quotaStor.GetProjectQuotaUsage)
+}
+
+func (c *QuotaController) SetProjectQuota(ctx echo.Context) error {
+	return c.setQuota(ctx, c.quotaStor.SetProjectQuota, c.quotaStor.GetProjectQuotaUsage)
+}
+
+func (c *QuotaController) GetUserQuota(ctx echo.Context) error {
+	return c.getQuota(ctx, c.quotaStor.GetUserQuotaUsage)
+}
+
+func (c *QuotaController) SetUserQuota(ctx echo.Context) error {
+	return c.setQuota(ctx, c.quotaStor.SetUserQuota, c.quotaStor.GetUserQuotaUsage)
+}
+
+func (c *QuotaController) getQuota(ctx echo.Context, getUsage func(id int) (*mcmodel.QuotaUsage, error)) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return errorResponse(ctx, http.StatusBadRequest, "Invalid ID")
+	}
+
+	usage, err := getUsage(id)
+	switch {
+	case stor.IsRecordNotFound(err):
+		return errorResponse(ctx, http.StatusNotFound, "Not found")
+	case err != nil:
+		return errorResponse(ctx, http.StatusInternalServerError, "Failed to get quota")
+	}
+
+	return ctx.JSON(http.StatusOK, usage)
+}
+
+func (c *QuotaController) setQuota(ctx echo.Context, setLimit func(id int, limitBytes int64) error, getUsage func(id int) (*mcmodel.QuotaUsage, error)) error {
+	var req struct {
+		LimitBytes int64 `json:"limit_bytes"`
+	}
+
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return errorResponse(ctx, http.StatusBadRequest, "Invalid ID")
+	}
+
+	if err := ctx.Bind(&req); err != nil {
+		return err
+	}
+
+	if req.LimitBytes < 0 {
+		return errorResponse(ctx, http.StatusBadRequest, "limit_bytes can't be negative")
+	}
+
+	if err := setLimit(id, req.LimitBytes); err != nil {
+		return errorResponse(ctx, http.StatusInternalServerError, "Failed to set quota")
+	}
+
+	return c.getQuota(ctx, getUsage)
+}
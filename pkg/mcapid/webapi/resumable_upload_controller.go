@@ -13,6 +13,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/mime"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 )
 
@@ -227,14 +228,13 @@ func (c *ResumableUploadController) GetUploadStatus(ctx echo.Context) error {
 	}
 
 	// Get the file size if it exists
-	filePath := file.ToUnderlyingFilePath(c.fileStor.Root())
 	fileExists := false
 	var fileSize int64 = 0
 
-	fileInfo, err := os.Stat(filePath)
+	blobInfo, err := c.fileStor.Blobs().Stat(file.BlobKey())
 	if err == nil {
 		fileExists = true
-		fileSize = fileInfo.Size()
+		fileSize = blobInfo.Size
 	}
 
 	// Get chunk information
@@ -307,8 +307,7 @@ func (c *ResumableUploadController) FinalizeUpload(ctx echo.Context) error {
 	}
 
 	// Create the final file
-	filePath := file.ToUnderlyingFilePath(c.fileStor.Root())
-	finalFile, err := os.Create(filePath)
+	finalFile, err := c.fileStor.Blobs().Create(file.BlobKey())
 	if err != nil {
 		return errorResponse(ctx, http.StatusInternalServerError, fmt.Sprintf("Failed to create final file: %v", err))
 	}
@@ -334,6 +333,10 @@ func (c *ResumableUploadController) FinalizeUpload(ctx echo.Context) error {
 		totalSize += int64(written)
 	}
 
+	if err := finalFile.Close(); err != nil {
+		return errorResponse(ctx, http.StatusInternalServerError, fmt.Sprintf("Failed to close final file: %v", err))
+	}
+
 	// Clean up the chunks
 	c.mu.Lock()
 	delete(c.chunks[user.ID], fileID)
@@ -418,31 +421,10 @@ func (c *ResumableUploadController) getOrCreateMCFile(projectID, ownerID, dirID
 	// 2. Create the file.
 	//   Directory exists, and we know the ownerID and projectID are good because the middleware already checked them.
 	//   The created file will have the current entry set to false. We will set it to true when the upload is finalized.
-	return c.fileStor.CreateFile(fileName, projectID, ownerID, dir.ID, getMimeType(fileName))
+	return c.fileStor.CreateFile(fileName, projectID, ownerID, dir.ID, mime.DetectByName(fileName))
 }
 
 func (c *ResumableUploadController) getOrCreateUploadState(projectID int, ownerID int, fileID int) *ResumableUploadInstanceState {
 	//finfo, err := os.Stat(c.getUploadState(projectID, ownerID, fileID))
 	return nil
 }
-
-// getMimeType returns the MIME type for a file based on its extension.
-func getMimeType(fileName string) string {
-	ext := filepath.Ext(fileName)
-	switch ext {
-	case ".txt":
-		return "text/plain"
-	case ".pdf":
-		return "application/pdf"
-	case ".jpg", ".jpeg":
-		return "image/jpeg"
-	case ".png":
-		return "image/png"
-	case ".gif":
-		return "image/gif"
-	case ".zip":
-		return "application/zip"
-	default:
-		return "application/octet-stream"
-	}
-}
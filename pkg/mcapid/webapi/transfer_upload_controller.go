@@ -4,14 +4,13 @@ import (
 	"errors"
 	"github.com/apex/log"
 	"net/http"
-	"os"
 	"path/filepath"
 
 	"github.com/labstack/echo/v4"
 	"github.com/materials-commons/hydra/pkg/mcapid"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/mime"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
-	"github.com/materials-commons/hydra/pkg/mcssh/mc"
 )
 
 type TransferUploadController struct {
@@ -113,11 +112,11 @@ func (c *TransferUploadController) StartUpload(ctx echo.Context) error {
 			return err
 		}
 
-		finfo, err := os.Stat(f.ToUnderlyingFilePath(c.fileStor.Root()))
+		blobInfo, err := c.fileStor.Blobs().Stat(f.BlobKey())
 		if err != nil {
 		}
 
-		if finfo.Size() == req.ExpectedSize {
+		if blobInfo.Size == req.ExpectedSize {
 
 		}
 	}
@@ -170,7 +169,7 @@ func (c *TransferUploadController) createTransferRequestFile(tr *mcmodel.Transfe
 	}
 
 	filename := filepath.Base(req.DestinationPath)
-	f, err := c.fileStor.CreateFile(filename, req.ProjectID, userID, dir.ID, mc.GetMimeTypeByExtension(filename))
+	f, err := c.fileStor.CreateFile(filename, req.ProjectID, userID, dir.ID, mime.DetectByName(filename))
 	if err != nil {
 		return nil, err
 	}
@@ -3,22 +3,27 @@ package fs
 import (
 	"bytes"
 	"context"
-	"fmt"
-	"hash"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/materials-commons/hydra/pkg/quota"
 )
 
 // MCFile represents the underlying "/" (root), project, or file/directory in a project.
-// Only a real project file (as opposed to a directory) will have a non-nil os.File.
+// Only a real project file (as opposed to a directory) will have a non-nil reader or writer.
 type MCFile struct {
-	// If there is a real file, then this will be non-nil
-	*os.File
+	// If there is a real file opened for read, then this will be non-nil
+	reader blobstore.Reader
+
+	// If there is a real file opened for write, then this will be non-nil
+	writer blobstore.Writer
+
 	fileStor       stor.FileStor
 	projectStor    stor.ProjectStor
 	conversionStor stor.ConversionStor
@@ -31,31 +36,43 @@ type MCFile struct {
 	user *mcmodel.User
 
 	// When a real file is opened, each write updates the checksum we are accumulating.
-	hasher hash.Hash
+	hasher *digest.Hasher
+
+	// limiter enforces the project and user storage quotas for a file opened for write.
+	limiter *quota.Limiter
+
+	// forget removes the file from the UserFS knownFiles when it is discarded.
+	forget func()
 }
 
-// Close will close the underlying os.File if its non-nil. Note that readonly files
-// from UserFS.OpenFile only return a *os.File and not a MCFile. That means that
-// close doesn't need to handle the case where the actually opened file is a file
-// that was only read and not written.
+// Close will close the underlying reader or writer if either is non-nil. When the file
+// was opened for write the file and project metadata is also updated.
 func (f *MCFile) Close() error {
-	if f.File == nil {
+	if f.reader != nil {
+		return f.reader.Close()
+	}
+
+	if f.writer == nil {
 		return nil
 	}
 
-	// All MCFile entries are files that were opened for write. So lets update the metadata.
+	// The writer has to be closed before the size can be determined, as some blob stores
+	// only make the contents visible once the writer is closed.
+	if closeErr := f.writer.Close(); closeErr != nil {
+		return closeErr
+	}
+
+	if f.limiter.Exceeded() {
+		return f.discard()
+	}
 
 	var size int64 = 0
-	finfo, err := f.File.Stat()
+	blobInfo, err := f.fileStor.Blobs().Stat(f.mcfile.BlobKey())
 	if err == nil {
-		size = finfo.Size()
+		size = blobInfo.Size
 	}
 
-	closeErr := f.File.Close()
-
-	checksum := fmt.Sprintf("%x", f.hasher.Sum(nil))
-
-	if err := f.fileStor.UpdateMetadataForFileAndProject(f.mcfile, checksum, size); err != nil {
+	if err := f.fileStor.UpdateMetadataForFileAndProject(f.mcfile, f.hasher.Sums(), size); err != nil {
 		// log that we couldn't update the database
 	}
 
@@ -65,16 +82,38 @@ func (f *MCFile) Close() error {
 		}
 	}
 
-	return closeErr
+	return nil
+}
+
+// Read reads from a file opened for read.
+func (f *MCFile) Read(p []byte) (n int, err error) {
+	if f.reader == nil {
+		return 0, os.ErrInvalid
+	}
+
+	return f.reader.Read(p)
+}
+
+// Seek sets the offset for the next Read on a file opened for read.
+func (f *MCFile) Seek(offset int64, whence int) (int64, error) {
+	if f.reader == nil {
+		return 0, os.ErrInvalid
+	}
+
+	return f.reader.Seek(offset, whence)
 }
 
 // Write to the file and update the checksum (hasher) state.
 func (f *MCFile) Write(p []byte) (n int, err error) {
-	if f.File == nil {
+	if f.writer == nil {
 		return 0, os.ErrInvalid
 	}
 
-	if n, err = f.File.Write(p); err != nil {
+	if err = f.limiter.Add(int64(len(p))); err != nil {
+		return 0, err
+	}
+
+	if n, err = f.writer.Write(p); err != nil {
 		return 0, err
 	}
 
@@ -83,6 +122,33 @@ func (f *MCFile) Write(p []byte) (n int, err error) {
 	return n, err
 }
 
+// discard removes a file that went over quota. The file was made current when it was created, so the
+// newest remaining version, if there is one, is made current again.
+func (f *MCFile) discard() error {
+	_ = f.fileStor.Blobs().Delete(f.mcfile.BlobKey())
+	f.forget()
+
+	if err := f.fileStor.DeleteFileByID(f.mcfile.ID); err != nil {
+		return err
+	}
+
+	dir, err := f.fileStor.GetFileByID(f.mcfile.DirectoryID)
+	if err != nil {
+		return err
+	}
+
+	versions, err := f.fileStor.ListFileVersions(f.mcfile.ProjectID, filepath.Join(dir.Path, f.mcfile.Name))
+	switch {
+	case stor.IsRecordNotFound(err):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	_, err = f.fileStor.SetFileAsCurrent(&versions[len(versions)-1])
+	return err
+}
+
 func (f *MCFile) ContentType(ctx context.Context) (string, error) {
 	return f.mcfile.MimeType, nil
 }
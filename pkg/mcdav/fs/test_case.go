@@ -5,11 +5,10 @@ import (
 	"os"
 	"testing"
 
-	"github.com/materials-commons/hydra/pkg/mcdb"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 	"github.com/stretchr/testify/require"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -28,12 +27,7 @@ type testCase struct {
 }
 
 func newTestCase(t *testing.T) *testCase {
-	dsn := mcdb.SqliteInMemoryDSN
-	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
-	require.NoErrorf(t, err, "gorm.Open failed: %s", err)
-	sqlitedb, err := db.DB()
-	sqlitedb.SetMaxOpenConns(1)
-	err = mcdb.RunMigrations(db)
+	db := mcdbtest.NewDB(t)
 	tc := &testCase{
 		db:      db,
 		T:       t,
@@ -44,8 +38,6 @@ func newTestCase(t *testing.T) *testCase {
 
 	_ = os.MkdirAll(tc.mcfsDir, 0755)
 
-	require.NoErrorf(t, err, "Migration failed with: %s", err)
-
 	tc.populateDatabase()
 
 	tc.userFS = NewUserFS(&UserFSOpts{
@@ -53,6 +45,7 @@ func newTestCase(t *testing.T) *testCase {
 		User:        tc.user,
 		ProjectStor: tc.stors.ProjectStor,
 		FileStor:    tc.stors.FileStor,
+		QuotaStor:   tc.stors.QuotaStor,
 	})
 
 	tc.ctx = context.Background()
@@ -2,18 +2,24 @@ package fs
 
 import (
 	"context"
-	"crypto/md5"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/apex/log"
+	"github.com/materials-commons/hydra/pkg/authz"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/mime"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 	"github.com/materials-commons/hydra/pkg/mcssh/mc"
+	"github.com/materials-commons/hydra/pkg/quota"
 	"github.com/materials-commons/hydra/pkg/webdav"
 )
 
@@ -26,6 +32,7 @@ type UserFS struct {
 	fileStor       stor.FileStor
 	projectStor    stor.ProjectStor
 	conversionStor stor.ConversionStor
+	quotaStor      stor.QuotaStor
 
 	// A cache of projects the user has access to
 	projects sync.Map
@@ -33,6 +40,10 @@ type UserFS struct {
 	// projects that the user tried to access that they don't have access to
 	projectsWithoutAccess sync.Map
 
+	// The user's roles in projects. A UserFS lives as long as the server, so roles are cached for a
+	// limited time to pick up changes to the user's access.
+	roles *authz.Cache
+
 	// MC User this is associated with
 	user *mcmodel.User
 
@@ -53,6 +64,7 @@ type UserFSOpts struct {
 	ProjectStor    stor.ProjectStor
 	FileStor       stor.FileStor
 	ConversionStor stor.ConversionStor
+	QuotaStor      stor.QuotaStor
 }
 
 // NewUserFS creates a new UserFS. All the fields in UserFSOpts must be filled in. This is not checked.
@@ -63,6 +75,8 @@ func NewUserFS(opts *UserFSOpts) *UserFS {
 		projectStor:    opts.ProjectStor,
 		fileStor:       opts.FileStor,
 		conversionStor: opts.ConversionStor,
+		quotaStor:      opts.QuotaStor,
+		roles:          authz.NewCache(opts.ProjectStor, authz.DefaultCacheTTL),
 		useKnownFiles:  false,
 	}
 }
@@ -79,6 +93,10 @@ func (fs *UserFS) Mkdir(ctx context.Context, path string, perm os.FileMode) erro
 		return err
 	}
 
+	if err := fs.checkWrite(project); err != nil {
+		return err
+	}
+
 	dirPath := mc.RemoveProjectSlugFromPath(path, projectSlug)
 	parentDir, err := fs.fileStor.GetFileByPath(project.ID, filepath.Dir(dirPath))
 	if err != nil {
@@ -108,7 +126,7 @@ func (fs *UserFS) OpenFile(ctx context.Context, path string, flags int, perm os.
 			Path:      "/",
 		}
 		mcfile := &MCFile{
-			File:           nil, // There is no real underlying File to open.
+			// There is no real underlying file to open.
 			fileStor:       fs.fileStor,
 			projectStor:    fs.projectStor,
 			conversionStor: fs.conversionStor,
@@ -139,7 +157,6 @@ func (fs *UserFS) OpenFile(ctx context.Context, path string, flags int, perm os.
 		}
 
 		mcfile := &MCFile{
-			File:           nil,
 			fileStor:       fs.fileStor,
 			projectStor:    fs.projectStor,
 			conversionStor: fs.conversionStor,
@@ -182,7 +199,6 @@ func (fs *UserFS) OpenFile(ctx context.Context, path string, flags int, perm os.
 
 	if file.IsDir() {
 		mcfile := &MCFile{
-			File:           nil,
 			fileStor:       fs.fileStor,
 			projectStor:    fs.projectStor,
 			conversionStor: fs.conversionStor,
@@ -195,7 +211,21 @@ func (fs *UserFS) OpenFile(ctx context.Context, path string, flags int, perm os.
 
 	// If we are here then the file exists. For readonly we just open the file.
 	if isReadonly(flags) {
-		return os.Open(file.ToUnderlyingFilePath(fs.mcfsRoot))
+		r, err := fs.fileStor.Blobs().Open(file.BlobKey(), 0)
+		if err != nil {
+			return nil, err
+		}
+
+		mcfile := &MCFile{
+			reader:         r,
+			fileStor:       fs.fileStor,
+			projectStor:    fs.projectStor,
+			conversionStor: fs.conversionStor,
+			mcfile:         file,
+			user:           fs.user,
+		}
+
+		return mcfile, nil
 	}
 
 	// For all other cases we create the file (or return the file from knownFiles).
@@ -205,28 +235,22 @@ func (fs *UserFS) OpenFile(ctx context.Context, path string, flags int, perm os.
 // createFile checks if a file entry was already accessed in knownFiles. If so it uses that. Otherwise,
 // it creates a new version, sticks it in knownFiles and uses it.
 func (fs *UserFS) createFile(filePath string, project *mcmodel.Project) (webdav.File, error) {
+	if err := fs.checkWrite(project); err != nil {
+		return nil, err
+	}
+
 	knownFile, ok := fs.knownFiles.Load(filePath)
 	if ok {
 		// This file has already been created.
 		file := knownFile.(*mcmodel.File)
 
-		// Always open with O_TRUNC, because WebDAV will resend the entire file contents.
-		f, err := os.OpenFile(file.ToUnderlyingFilePath(fs.mcfsRoot), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+		// Always truncate, because WebDAV will resend the entire file contents.
+		w, err := fs.fileStor.Blobs().Create(file.BlobKey())
 		if err != nil {
 			return nil, err
 		}
 
-		mcfile := &MCFile{
-			File:           f,
-			fileStor:       fs.fileStor,
-			projectStor:    fs.projectStor,
-			conversionStor: fs.conversionStor,
-			mcfile:         file,
-			user:           fs.user,
-			hasher:         md5.New(),
-		}
-
-		return mcfile, nil
+		return fs.newWritableMCFile(filePath, project, file, w)
 	}
 
 	// if we are here then there wasn't an entry in knownFiles, so we need to create a new file in the project, and
@@ -242,7 +266,7 @@ func (fs *UserFS) createFile(filePath string, project *mcmodel.Project) (webdav.
 
 	// Create the file in the given directory.
 	name := filepath.Base(filePath)
-	file, err := fs.fileStor.CreateFile(name, project.ID, dir.ID, fs.user.ID, mc.GetMimeTypeByExtension(name))
+	file, err := fs.fileStor.CreateFile(name, project.ID, dir.ID, fs.user.ID, mime.DetectByName(name))
 	if err != nil {
 		return nil, err
 	}
@@ -250,44 +274,152 @@ func (fs *UserFS) createFile(filePath string, project *mcmodel.Project) (webdav.
 	// Make newly created file as current, setting previous versions as not-current.
 	file, err = fs.fileStor.SetFileAsCurrent(file)
 
-	// Create the underlying directory path from the UUID.
-	err = file.MkdirUnderlyingPath(fs.mcfsRoot)
+	// Create an empty file
+	w, err := fs.fileStor.Blobs().Create(file.BlobKey())
 	if err != nil {
 		// What to do with the already created database file entry?
 		return nil, err
 	}
 
-	// Create an empty file
-	f, err := os.Create(file.ToUnderlyingFilePath(fs.mcfsRoot))
+	// place in knownFiles so subsequent attempts to write will reuse this entry.
+	fs.knownFiles.Store(filePath, file)
+
+	return fs.newWritableMCFile(filePath, project, file, w)
+}
+
+// newWritableMCFile creates the MCFile for writing to file. WebDAV doesn't send the size up front, so
+// the project and user quotas are enforced as the file is written.
+func (fs *UserFS) newWritableMCFile(filePath string, project *mcmodel.Project, file *mcmodel.File, w blobstore.Writer) (*MCFile, error) {
+	limiter, err := quota.NewLimiter(fs.quotaStor, project.ID, fs.user.ID)
 	if err != nil {
-		// What to do with the already created database file entry?
+		_ = w.Close()
 		return nil, err
 	}
 
 	mcfile := &MCFile{
-		File:           f,
+		writer:         w,
 		fileStor:       fs.fileStor,
 		projectStor:    fs.projectStor,
 		conversionStor: fs.conversionStor,
 		mcfile:         file,
 		user:           fs.user,
-		hasher:         md5.New(),
+		hasher:         digest.New(),
+		limiter:        limiter,
+		forget:         func() { fs.knownFiles.Delete(filePath) },
 	}
 
-	// place in knownFiles so subsequent attempts to write will reuse this entry.
-	fs.knownFiles.Store(filePath, file)
-
 	return mcfile, nil
 }
 
+// RemoveAll moves a file or directory, and everything under it, into the project trash. As with
+// os.RemoveAll, a path that doesn't exist is not an error.
 func (fs *UserFS) RemoveAll(ctx context.Context, name string) error {
-	fmt.Println("fs.RemoveAll", name)
-	return fmt.Errorf("method RemoveAll not implemented")
+	project, projectSlug, err := fs.getProject(name)
+	if err != nil {
+		return err
+	}
+
+	if pathIsOnlyForProjectSlug(name) {
+		// Projects can't be deleted through WebDAV.
+		return os.ErrPermission
+	}
+
+	if err := fs.checkWrite(project); err != nil {
+		return err
+	}
+
+	path := mc.RemoveProjectSlugFromPath(name, projectSlug)
+	file, err := fs.fileStor.GetFileByPath(project.ID, path)
+	switch {
+	case stor.IsRecordNotFound(err):
+		// Like os.RemoveAll, removing a path that doesn't exist isn't an error.
+		return nil
+	case err != nil:
+		log.Errorf("Unable to look up %s in project %d for removal: %s", path, project.ID, err)
+		return err
+	}
+
+	if file.IsDir() {
+		err = fs.fileStor.DeleteDirectory(file, true)
+	} else {
+		err = fs.fileStor.DeleteFile(file)
+	}
+
+	switch {
+	case errors.Is(err, stor.ErrRootDirectory):
+		return os.ErrPermission
+	case err != nil:
+		log.Errorf("Unable to remove %s in project %d: %s", path, project.ID, err)
+		return err
+	}
+
+	fs.forgetKnownFiles(path)
+
+	return nil
 }
 
+// Rename moves a file or directory. Both paths must be in the same project.
 func (fs *UserFS) Rename(ctx context.Context, oldName, newName string) error {
-	fmt.Println("fs.Rename", oldName, newName)
-	return fmt.Errorf("method Rename not implemented")
+	project, projectSlug, err := fs.getProject(oldName)
+	if err != nil {
+		return err
+	}
+
+	if pathIsOnlyForProjectSlug(oldName) || mc.GetProjectSlugFromPath(newName) != projectSlug {
+		// Projects can't be renamed, and files can't be moved between projects.
+		return os.ErrPermission
+	}
+
+	if err := fs.checkWrite(project); err != nil {
+		return err
+	}
+
+	oldPath := mc.RemoveProjectSlugFromPath(oldName, projectSlug)
+	newPath := mc.RemoveProjectSlugFromPath(newName, projectSlug)
+
+	file, err := fs.fileStor.GetFileByPath(project.ID, oldPath)
+	if err != nil {
+		return os.ErrNotExist
+	}
+
+	toDir, err := fs.fileStor.GetDirByPath(project.ID, filepath.Dir(newPath))
+	if err != nil {
+		return os.ErrNotExist
+	}
+
+	if file.IsDir() {
+		_, err = fs.fileStor.MoveDirectory(file, toDir, filepath.Base(newPath))
+	} else {
+		_, err = fs.fileStor.MoveFile(file, toDir, filepath.Base(newPath))
+	}
+
+	switch {
+	case errors.Is(err, stor.ErrAlreadyExists):
+		return os.ErrExist
+	case errors.Is(err, stor.ErrInvalidMove):
+		return os.ErrInvalid
+	case err != nil:
+		log.Errorf("Unable to rename %s to %s in project %d: %s", oldPath, newPath, project.ID, err)
+		return err
+	}
+
+	// Entries in knownFiles are keyed by path, so they are stale after a rename.
+	fs.forgetKnownFiles(oldPath)
+	fs.forgetKnownFiles(newPath)
+
+	return nil
+}
+
+// forgetKnownFiles removes path from knownFiles. When path is a directory the entries for everything
+// under it are removed as well.
+func (fs *UserFS) forgetKnownFiles(path string) {
+	prefix := strings.TrimSuffix(path, "/") + "/"
+	fs.knownFiles.Range(func(key, value interface{}) bool {
+		if key == path || strings.HasPrefix(key.(string), prefix) {
+			fs.knownFiles.Delete(key)
+		}
+		return true
+	})
 }
 
 // Stat get the stat (os.FileInfo) for a file. It handles "/" and /<project-slug>
@@ -394,6 +526,17 @@ func (fs *UserFS) getProject(path string) (*mcmodel.Project, string, error) {
 	return project, projectSlug, nil
 }
 
+// checkWrite returns authz.ErrReadOnly when the user's role in the project doesn't allow writes. It
+// matches os.ErrPermission, which the WebDAV handler turns into a 403.
+func (fs *UserFS) checkWrite(project *mcmodel.Project) error {
+	err := authz.Require(fs.roles, fs.user.ID, project.ID, authz.Contributor)
+	if err != nil {
+		log.Errorf("User %d can't write to project %d: %s", fs.user.ID, project.ID, err)
+	}
+
+	return err
+}
+
 // TODO flagSet and isReadonly are from mcfs. Move these into a fsutil directory or something to share
 // between packages.
 
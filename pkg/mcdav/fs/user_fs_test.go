@@ -5,6 +5,8 @@ import (
 	"os"
 	"testing"
 
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 	"github.com/stretchr/testify/require"
 )
 
@@ -115,3 +117,91 @@ func TestCreatingAFileInProjectRoot(t *testing.T) {
 	require.True(t, file.Current, "file.Current isn't true")
 	require.Equal(t, uint64(5), file.Size, "file.Size is not 5")
 }
+
+func TestRemoveAll(t *testing.T) {
+	tc := newTestCase(t)
+
+	// Removing a path that doesn't exist isn't an error.
+	require.NoError(t, tc.userFS.RemoveAll(tc.ctx, "/proj1/dir1/does-not-exist.txt"))
+
+	require.NoError(t, tc.userFS.RemoveAll(tc.ctx, "/proj1/dir1/test.txt"))
+	_, err := tc.userFS.fileStor.GetFileByPath(tc.proj.ID, "/dir1/test.txt")
+	require.True(t, stor.IsRecordNotFound(err))
+}
+
+func TestRenameDirectoryForgetsKnownFilesUnderIt(t *testing.T) {
+	tc := newTestCase(t)
+
+	f, err := tc.userFS.OpenFile(tc.ctx, "/proj1/dir1/hello.txt", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	_, ok := tc.userFS.knownFiles.Load("/dir1/hello.txt")
+	require.True(t, ok)
+
+	require.NoError(t, tc.userFS.Rename(tc.ctx, "/proj1/dir1", "/proj1/dir2"))
+	_, ok = tc.userFS.knownFiles.Load("/dir1/hello.txt")
+	require.False(t, ok, "knownFiles still has an entry under the renamed directory")
+
+	file, err := tc.userFS.fileStor.GetFileByPath(tc.proj.ID, "/dir2/hello.txt")
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), file.Size)
+}
+
+func TestWriteOverQuotaRestoresPreviousVersion(t *testing.T) {
+	tc := newTestCase(t)
+
+	project, err := tc.stors.ProjectStor.GetProjectByID(tc.proj.ID)
+	require.NoError(t, err)
+	require.NoError(t, tc.stors.QuotaStor.SetProjectQuota(tc.proj.ID, project.Size+4))
+
+	f, err := tc.userFS.OpenFile(tc.ctx, "/proj1/dir1/test.txt", os.O_RDWR|os.O_TRUNC, 0666)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("too much data"))
+	require.Error(t, err)
+	require.NoError(t, f.Close())
+
+	// The new version is removed and test.txt is back to the version created by the test case.
+	file, err := tc.userFS.fileStor.GetFileByPath(tc.proj.ID, "/dir1/test.txt")
+	require.NoError(t, err)
+	require.Equal(t, tc.f.ID, file.ID)
+	require.True(t, file.Current)
+
+	versions, err := tc.userFS.fileStor.ListFileVersions(tc.proj.ID, "/dir1/test.txt")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+
+	_, ok := tc.userFS.knownFiles.Load("/dir1/test.txt")
+	require.False(t, ok)
+}
+
+func TestViewerCannotWrite(t *testing.T) {
+	tc := newTestCase(t)
+
+	viewer, err := tc.stors.UserStor.CreateUser(&mcmodel.User{Email: "viewer@test.com"})
+	require.NoError(t, err)
+	require.NoError(t, tc.stors.ProjectStor.AddViewerToProject(tc.proj, viewer))
+	viewerFS := NewUserFS(&UserFSOpts{
+		MCFSRoot:    tc.mcfsDir,
+		User:        viewer,
+		ProjectStor: tc.stors.ProjectStor,
+		FileStor:    tc.stors.FileStor,
+		QuotaStor:   tc.stors.QuotaStor,
+	})
+
+	// Viewers can still read.
+	_, err = viewerFS.Stat(tc.ctx, "/proj1/dir1/test.txt")
+	require.NoError(t, err)
+
+	_, err = viewerFS.OpenFile(tc.ctx, "/proj1/dir1/hello.txt", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	require.ErrorIs(t, err, os.ErrPermission)
+	require.ErrorIs(t, viewerFS.Mkdir(tc.ctx, "/proj1/dir2", 0755), os.ErrPermission)
+	require.ErrorIs(t, viewerFS.Rename(tc.ctx, "/proj1/dir1/test.txt", "/proj1/dir1/renamed.txt"), os.ErrPermission)
+	require.ErrorIs(t, viewerFS.RemoveAll(tc.ctx, "/proj1/dir1/test.txt"), os.ErrPermission)
+
+	file, err := tc.stors.FileStor.GetFileByPath(tc.proj.ID, "/dir1/test.txt")
+	require.NoError(t, err)
+	require.Equal(t, tc.f.ID, file.ID)
+}
@@ -7,6 +7,15 @@ import (
 	"strings"
 )
 
+// DatasetFileSelector decides which project files are in a dataset. A file is checked against the
+// dataset's FileSelection in this order, and the first rule that applies decides:
+//
+//  1. IncludeFiles, then ExcludeFiles, matched exactly against the file's path.
+//  2. Files attached to the entities selected by the dataset's entity template (see LoadEntityFiles).
+//  3. Patterns, where the last pattern that matches wins (see selectionPattern for the syntax).
+//  4. IncludeDirs and ExcludeDirs, where the closest directory above the file that is listed wins.
+//
+// A file that no rule applies to isn't in the dataset.
 type DatasetFileSelector struct {
 	DatasetID    int
 	IncludeFiles map[string]bool
@@ -14,11 +23,14 @@ type DatasetFileSelector struct {
 	IncludeDirs  map[string]bool
 	ExcludeDirs  map[string]bool
 	EntityFiles  map[string]bool
+	patterns     []*selectionPattern
 }
 
+// NewDatasetFileSelector creates the selector for dataset's file selection. Invalid patterns are ignored,
+// use ValidateFileSelection to find them.
 func NewDatasetFileSelector(dataset mcmodel.Dataset) *DatasetFileSelector {
 	fs, _ := dataset.GetFileSelection()
-	return &DatasetFileSelector{
+	s := &DatasetFileSelector{
 		DatasetID:    dataset.ID,
 		IncludeFiles: createSelectionEntries(fs.IncludeFiles),
 		ExcludeFiles: createSelectionEntries(fs.ExcludeFiles),
@@ -26,6 +38,14 @@ func NewDatasetFileSelector(dataset mcmodel.Dataset) *DatasetFileSelector {
 		ExcludeDirs:  createSelectionEntries(fs.ExcludeDirs),
 		EntityFiles:  make(map[string]bool),
 	}
+
+	for _, pattern := range fs.Patterns {
+		if p, err := compileSelectionPattern(pattern); err == nil {
+			s.patterns = append(s.patterns, p)
+		}
+	}
+
+	return s
 }
 
 func (s *DatasetFileSelector) LoadEntityFiles(db *gorm.DB) error {
@@ -70,10 +90,37 @@ func (s *DatasetFileSelector) IsIncludedFile(filePath string) bool {
 		return true
 	}
 
-	return s.IsIncludedDir(filepath.Dir(filePath))
+	if included, matched := s.matchPatterns(func(p *selectionPattern) bool { return p.matchesFile(filePath) }); matched {
+		return included
+	}
+
+	return s.isIncludedByDirs(filepath.Dir(filePath))
 }
 
 func (s *DatasetFileSelector) IsIncludedDir(dirPath string) bool {
+	dirPath = filepath.Clean(dirPath)
+	if included, matched := s.matchPatterns(func(p *selectionPattern) bool { return p.matchesDir(dirPath) }); matched {
+		return included
+	}
+
+	return s.isIncludedByDirs(dirPath)
+}
+
+// matchPatterns applies the patterns in order using matches. It returns whether the last pattern that
+// matched includes or excludes, and false for matched if no pattern matched.
+func (s *DatasetFileSelector) matchPatterns(matches func(p *selectionPattern) bool) (included bool, matched bool) {
+	for _, p := range s.patterns {
+		if matches(p) {
+			included, matched = !p.negate, true
+		}
+	}
+
+	return included, matched
+}
+
+// isIncludedByDirs applies the IncludeDirs and ExcludeDirs entries to dirPath, using the entry for the
+// closest directory.
+func (s *DatasetFileSelector) isIncludedByDirs(dirPath string) bool {
 	if _, ok := s.IncludeDirs[dirPath]; ok {
 		return true
 	}
@@ -1,7 +1,132 @@
 package mcdb
 
-import "testing"
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/stretchr/testify/require"
+)
 
 func TestSelectingFiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		selection mcmodel.FileSelection
+		included  []string
+		excluded  []string
+	}{
+		{
+			name:      "exact include dir covers subdirectories",
+			selection: mcmodel.FileSelection{IncludeDirs: []string{"/raw"}},
+			included:  []string{"/raw/a.csv", "/raw/run-1/b.csv"},
+			excluded:  []string{"/a.csv", "/rawdata/a.csv"},
+		},
+		{
+			name: "closest listed directory wins",
+			selection: mcmodel.FileSelection{
+				IncludeDirs: []string{"/raw", "/raw/keep/again"},
+				ExcludeDirs: []string{"/raw/keep"},
+			},
+			included: []string{"/raw/a.csv", "/raw/keep/again/b.csv"},
+			excluded: []string{"/raw/keep/b.csv"},
+		},
+		{
+			name:      "double star matches at any depth",
+			selection: mcmodel.FileSelection{Patterns: []string{"**/*.csv"}},
+			included:  []string{"/a.csv", "/raw/a.csv", "/raw/run-1/deep/a.csv"},
+			excluded:  []string{"/a.txt", "/raw/a.csv.bak"},
+		},
+		{
+			name:      "pattern without a slash matches at any depth",
+			selection: mcmodel.FileSelection{Patterns: []string{"*.csv"}},
+			included:  []string{"/a.csv", "/raw/run-1/a.csv"},
+			excluded:  []string{"/a.txt"},
+		},
+		{
+			name:      "pattern with a slash is anchored to the root",
+			selection: mcmodel.FileSelection{Patterns: []string{"raw/*.csv"}},
+			included:  []string{"/raw/a.csv"},
+			excluded:  []string{"/other/raw/a.csv", "/raw/run-1/a.csv"},
+		},
+		{
+			name:      "trailing slash selects everything under matching directories",
+			selection: mcmodel.FileSelection{Patterns: []string{"raw/run-*/"}},
+			included:  []string{"/raw/run-1/a.csv", "/raw/run-2/deep/b.txt"},
+			excluded:  []string{"/raw/a.csv", "/raw/run-1", "/run-1/a.csv"},
+		},
+		{
+			name:      "a pattern matching a directory selects its contents",
+			selection: mcmodel.FileSelection{Patterns: []string{"results"}},
+			included:  []string{"/results", "/results/a.csv", "/x/results/b.csv"},
+			excluded:  []string{"/results.csv"},
+		},
+		{
+			name:      "negation excludes and the last matching pattern wins",
+			selection: mcmodel.FileSelection{Patterns: []string{"raw/", "!*.tmp", "raw/keep.tmp"}},
+			included:  []string{"/raw/a.csv", "/raw/keep.tmp"},
+			excluded:  []string{"/raw/scratch.tmp", "/raw/run-1/x.tmp"},
+		},
+		{
+			name: "patterns take precedence over directories",
+			selection: mcmodel.FileSelection{
+				IncludeDirs: []string{"/"},
+				ExcludeDirs: []string{"/scratch"},
+				Patterns:    []string{"!**/*.log", "scratch/*.csv"},
+			},
+			included: []string{"/a.txt", "/scratch/a.csv"},
+			excluded: []string{"/a.log", "/raw/b.log", "/scratch/a.txt"},
+		},
+		{
+			name: "exact files take precedence over patterns",
+			selection: mcmodel.FileSelection{
+				IncludeFiles: []string{"/raw/a.log"},
+				ExcludeFiles: []string{"/raw/b.csv"},
+				Patterns:     []string{"raw/", "!*.log"},
+			},
+			included: []string{"/raw/a.log", "/raw/c.csv"},
+			excluded: []string{"/raw/b.csv", "/raw/c.log"},
+		},
+		{
+			name:      "question marks and classes don't cross directories",
+			selection: mcmodel.FileSelection{Patterns: []string{"/run-?/[ab].csv"}},
+			included:  []string{"/run-1/a.csv", "/run-2/b.csv"},
+			excluded:  []string{"/run-10/a.csv", "/run-1/c.csv", "/run-/a.csv"},
+		},
+		{
+			name:      "invalid patterns are ignored",
+			selection: mcmodel.FileSelection{Patterns: []string{"[", "*.csv"}},
+			included:  []string{"/a.csv"},
+			excluded:  []string{"/["},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(test.selection)
+			require.NoError(t, err)
+			selector := NewDatasetFileSelector(mcmodel.Dataset{FileSelection: string(data)})
+
+			for _, path := range test.included {
+				require.True(t, selector.IsIncludedFile(path), "expected %s to be included", path)
+			}
+
+			for _, path := range test.excluded {
+				require.False(t, selector.IsIncludedFile(path), "expected %s to be excluded", path)
+			}
+		})
+	}
+}
+
+func TestEntityFilesTakePrecedenceOverPatterns(t *testing.T) {
+	selector := NewDatasetFileSelector(mcmodel.Dataset{FileSelection: `{"patterns": ["!*.tmp"]}`})
+	selector.EntityFiles["/sample/a.tmp"] = true
+	require.True(t, selector.IsIncludedFile("/sample/a.tmp"))
+	require.False(t, selector.IsIncludedFile("/sample/b.tmp"))
+}
 
+func TestValidateFileSelection(t *testing.T) {
+	require.NoError(t, ValidateFileSelection(&mcmodel.FileSelection{Patterns: []string{"**/*.csv", "!raw/", "run-[0-9]/"}}))
+	require.Error(t, ValidateFileSelection(&mcmodel.FileSelection{Patterns: []string{"raw/[a-"}}))
+	require.Error(t, ValidateFileSelection(&mcmodel.FileSelection{Patterns: []string{"!"}}))
+	require.Error(t, ValidateFileSelection(&mcmodel.FileSelection{Patterns: []string{"/"}}))
 }
@@ -57,9 +57,20 @@ func MustConnectToDB() *gorm.DB {
 	}
 }
 
+// RunMigrations creates, or brings up to date, every table the models in mcmodel use. This includes
+// the join tables that are queried directly. It is primarily used to create the schema for tests
+// that run against SQLite. The changes to the production schema are in the migrations directory.
 func RunMigrations(db *gorm.DB) error {
-	return db.AutoMigrate(&mcmodel.File{}, &mcmodel.Project{}, &mcmodel.User{}, &mcmodel.Conversion{},
-		&mcmodel.TransferRequest{}, &mcmodel.TransferRequestFile{}, &mcmodel.GlobusTransfer{}, &mcmodel.Team{})
+	return db.AutoMigrate(
+		&mcmodel.File{}, &mcmodel.Project{}, &mcmodel.User{}, &mcmodel.Team{}, &mcmodel.Conversion{},
+		&mcmodel.TransferRequest{}, &mcmodel.TransferRequestFile{}, &mcmodel.GlobusTransfer{},
+		&mcmodel.ClientTransfer{}, &mcmodel.RemoteClient{}, &mcmodel.RemoteClientTransfer{},
+		&mcmodel.PartialTransferFile{}, &mcmodel.StorageQuota{}, &mcmodel.APIToken{},
+		&mcmodel.Entity{}, &mcmodel.EntityState{}, &mcmodel.Activity{}, &mcmodel.Attribute{},
+		&mcmodel.AttributeValue{}, &mcmodel.Experiment{}, &mcmodel.Dataset{},
+		&mcmodel.Activity2Entity{}, &mcmodel.Experiment2Entity{}, &mcmodel.Experiment2Activity{},
+		&mcmodel.Dataset2File{}, &mcmodel.Project2User{}, &mcmodel.Project2Viewer{},
+		&mcmodel.Item2EntitySelection{})
 }
 
 func GetDBInstance() *gorm.DB {
@@ -0,0 +1,174 @@
+// Package filewalk walks the files of a project, or of every project, in batches. It is shared by the
+// jobs, such as the SHA-256 and MIME type backfills, that go through files one at a time to fill in
+// something about them. Files are visited in id order. A walk stopped by MaxDuration isn't complete, and
+// since the jobs only list the files that still need work, running the job again carries on from where
+// it stopped.
+package filewalk
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+)
+
+// Kinds of problems shared by every job. Jobs add their own kinds for the problems only they find.
+const (
+	ProblemMissing = "missing"
+	ProblemError   = "error"
+)
+
+const defaultBatchSize = 200
+
+type Options struct {
+	// ProjectID limits the walk to a single project. Zero walks every project.
+	ProjectID int
+
+	// BatchSize is the number of files loaded from the database at a time.
+	BatchSize int
+
+	// MaxDuration stops the walk once it has run this long. Zero means no limit.
+	MaxDuration time.Duration
+
+	// DryRun does the work for each file without storing the result.
+	DryRun bool
+}
+
+// Problem describes a file a job couldn't do its work for.
+type Problem struct {
+	FileID    int    `json:"file_id"`
+	ProjectID int    `json:"project_id"`
+	UUID      string `json:"uuid"`
+	BlobKey   string `json:"blob_key"`
+	Kind      string `json:"kind"`
+	Expected  string `json:"expected,omitempty"`
+	Actual    string `json:"actual,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Report is the part of a job's result that is common to every job. When Complete is false the walk
+// stopped early.
+type Report struct {
+	ProjectID    int       `json:"project_id"`
+	DryRun       bool      `json:"dry_run"`
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+	Complete     bool      `json:"complete"`
+	FilesChecked int       `json:"files_checked"`
+	Missing      int       `json:"missing"`
+	Errors       int       `json:"errors"`
+	Problems     []Problem `json:"problems"`
+}
+
+// NewReport starts the report for a walk with opts.
+func NewReport(opts Options) Report {
+	return Report{
+		ProjectID: opts.ProjectID,
+		DryRun:    opts.DryRun,
+		StartedAt: time.Now(),
+		Problems:  []Problem{},
+	}
+}
+
+// ListFunc lists up to limit files, in id order, with an id greater than afterID. When projectID is 0
+// files in every project are listed.
+type ListFunc func(projectID, afterID, limit int) ([]mcmodel.File, error)
+
+// Walk calls visit for each of the files listed by list, until there are none left or the walk has run
+// for opts.MaxDuration. It sets report.Complete once every file has been visited.
+func Walk(opts Options, report *Report, list ListFunc, visit func(file *mcmodel.File)) error {
+	if opts.BatchSize == 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	defer func() { report.FinishedAt = time.Now() }()
+
+	lastFileID := 0
+	for !outOfTime(opts, report) {
+		files, err := list(opts.ProjectID, lastFileID, opts.BatchSize)
+		if err != nil {
+			return fmt.Errorf("unable to list files after %d: %w", lastFileID, err)
+		}
+
+		if len(files) == 0 {
+			report.Complete = true
+			return nil
+		}
+
+		for i := range files {
+			visit(&files[i])
+			lastFileID = files[i].ID
+			if outOfTime(opts, report) {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// outOfTime returns true once the walk has run for longer than opts.MaxDuration.
+func outOfTime(opts Options, report *Report) bool {
+	return opts.MaxDuration != 0 && time.Since(report.StartedAt) >= opts.MaxDuration
+}
+
+// NewProblem returns a problem of kind with file.
+func NewProblem(file *mcmodel.File, kind string) Problem {
+	return Problem{
+		FileID:    file.ID,
+		ProjectID: file.ProjectID,
+		UUID:      file.UUID,
+		BlobKey:   file.BlobKey(),
+		Kind:      kind,
+	}
+}
+
+// AddProblem records problem, counting it in Missing or Errors when it is one of those kinds.
+func (r *Report) AddProblem(problem Problem) {
+	switch problem.Kind {
+	case ProblemMissing:
+		r.Missing++
+	case ProblemError:
+		r.Errors++
+	}
+
+	r.Problems = append(r.Problems, problem)
+}
+
+// AddError records an error doing the work for file. An error that blobstore.IsNotExist recognizes is
+// recorded as a missing blob.
+func (r *Report) AddError(file *mcmodel.File, err error) {
+	if blobstore.IsNotExist(err) {
+		r.AddProblem(NewProblem(file, ProblemMissing))
+		return
+	}
+
+	problem := NewProblem(file, ProblemError)
+	problem.Error = err.Error()
+	r.AddProblem(problem)
+}
+
+// LogProblems logs each of the problems found by job.
+func (r *Report) LogProblems(job string) {
+	for _, problem := range r.Problems {
+		log.Warnf("%s: file %d (%s): %s %s", job, problem.FileID, problem.BlobKey, problem.Kind, problem.Error)
+	}
+}
+
+// RunEvery calls run immediately, and then once every interval, until ctx is cancelled.
+func RunEvery(ctx context.Context, interval time.Duration, run func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		run()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
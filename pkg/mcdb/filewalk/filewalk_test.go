@@ -0,0 +1,54 @@
+package filewalk
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalk(t *testing.T) {
+	files := []mcmodel.File{{ID: 1}, {ID: 3}, {ID: 4}, {ID: 7}, {ID: 9}}
+	list := func(projectID, afterID, limit int) ([]mcmodel.File, error) {
+		var batch []mcmodel.File
+		for _, f := range files {
+			if f.ID > afterID && len(batch) < limit {
+				batch = append(batch, f)
+			}
+		}
+		return batch, nil
+	}
+
+	var visited []int
+	report := NewReport(Options{})
+	err := Walk(Options{BatchSize: 2}, &report, list, func(file *mcmodel.File) {
+		visited = append(visited, file.ID)
+	})
+	require.NoError(t, err)
+	require.True(t, report.Complete)
+	require.Equal(t, []int{1, 3, 4, 7, 9}, visited)
+	require.False(t, report.FinishedAt.IsZero())
+
+	failing := func(projectID, afterID, limit int) ([]mcmodel.File, error) {
+		return nil, errors.New("no database")
+	}
+	report = NewReport(Options{})
+	require.Error(t, Walk(Options{}, &report, failing, func(file *mcmodel.File) {}))
+	require.False(t, report.Complete)
+}
+
+func TestReportProblems(t *testing.T) {
+	report := NewReport(Options{})
+	file := &mcmodel.File{ID: 1, UUID: "00000000-aaaa-0000-0000-000000000001"}
+
+	report.AddError(file, errors.New("read failed"))
+	report.AddProblem(NewProblem(file, ProblemMissing))
+	report.AddProblem(NewProblem(file, "other"))
+
+	require.Equal(t, 1, report.Errors)
+	require.Equal(t, 1, report.Missing)
+	require.Len(t, report.Problems, 3)
+	require.Equal(t, "read failed", report.Problems[0].Error)
+	require.Equal(t, file.BlobKey(), report.Problems[0].BlobKey)
+}
@@ -0,0 +1,310 @@
+// Package mcdbtest provides an in-memory SQLite database with the full Materials Commons schema, and a
+// Builder for populating it, so that stores and loaders can be tested without a MySQL server.
+package mcdbtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/materials-commons/hydra/pkg/mcdb"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var dbCounter atomic.Int64
+
+// NewDB opens a new, empty, in-memory SQLite database and runs the migrations against it. Each call
+// gets its own database, so tests don't see each others data. The database is closed when the test
+// finishes.
+func NewDB(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	dsn := fmt.Sprintf("file:%s-%d?mode=memory&cache=shared", name, dbCounter.Add(1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoErrorf(t, err, "gorm.Open failed: %s", err)
+
+	sqlitedb, err := db.DB()
+	require.NoError(t, err)
+
+	// A shared cache in-memory database disappears when its last connection is closed. Limiting the
+	// pool to a single connection keeps it alive, and avoids "database is locked" errors.
+	sqlitedb.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlitedb.Close() })
+
+	require.NoErrorf(t, mcdb.RunMigrations(db), "Migration failed")
+
+	return db
+}
+
+// Builder creates fixtures. Every method fails the test if the underlying insert fails, so fixture
+// setup doesn't need error checking.
+type Builder struct {
+	t  testing.TB
+	db *gorm.DB
+}
+
+func NewBuilder(t testing.TB, db *gorm.DB) *Builder {
+	return &Builder{t: t, db: db}
+}
+
+func (b *Builder) create(value interface{}) {
+	b.t.Helper()
+	require.NoError(b.t, b.db.Create(value).Error)
+}
+
+func (b *Builder) uuid() string {
+	b.t.Helper()
+	id, err := uuid.GenerateUUID()
+	require.NoError(b.t, err)
+	return id
+}
+
+// User creates a user whose slug is name and whose email is name@test.com.
+func (b *Builder) User(name string) *mcmodel.User {
+	b.t.Helper()
+	user := &mcmodel.User{UUID: b.uuid(), Name: name, Slug: name, Email: name + "@test.com"}
+	b.create(user)
+	return user
+}
+
+// Project creates a project owned by owner the same way ProjectStor.CreateProject does: the project
+// gets a team, with owner as its admin, and a root directory. The root directory is returned in
+// Project.RootDir.
+func (b *Builder) Project(name string, owner *mcmodel.User) *mcmodel.Project {
+	b.t.Helper()
+	team := &mcmodel.Team{UUID: b.uuid(), Name: "Team for " + name, OwnerID: owner.ID, Admins: []mcmodel.User{*owner}}
+	b.create(team)
+
+	project := &mcmodel.Project{
+		UUID:      b.uuid(),
+		Name:      name,
+		Slug:      name,
+		TeamID:    team.ID,
+		OwnerID:   owner.ID,
+		FileTypes: "{}",
+	}
+	b.create(project)
+	b.create(&mcmodel.Project2User{ProjectID: project.ID, UserID: owner.ID})
+
+	project.RootDir = &mcmodel.File{
+		UUID:                 b.uuid(),
+		ProjectID:            project.ID,
+		Name:                 "/",
+		Path:                 "/",
+		MimeType:             "directory",
+		MediaTypeDescription: "directory",
+		Current:              true,
+		OwnerID:              owner.ID,
+	}
+	b.create(project.RootDir)
+
+	return project
+}
+
+// AddMember gives user access to project as a member of the project's team.
+func (b *Builder) AddMember(project *mcmodel.Project, user *mcmodel.User) {
+	b.t.Helper()
+	require.NoError(b.t, b.db.Model(&mcmodel.Team{ID: project.TeamID}).Association("Members").Append(user))
+	b.create(&mcmodel.Project2User{ProjectID: project.ID, UserID: user.ID})
+}
+
+// AddViewer gives user read-only access to project without adding them to its team.
+func (b *Builder) AddViewer(project *mcmodel.Project, user *mcmodel.User) {
+	b.t.Helper()
+	b.create(&mcmodel.Project2Viewer{ProjectID: project.ID, UserID: user.ID})
+}
+
+// Dir creates a directory called name in parent, and counts it in the project's DirectoryCount.
+func (b *Builder) Dir(project *mcmodel.Project, parent *mcmodel.File, name string) *mcmodel.File {
+	b.t.Helper()
+	dir := &mcmodel.File{
+		UUID:                 b.uuid(),
+		ProjectID:            project.ID,
+		Name:                 name,
+		Path:                 filepath.Join(parent.Path, name),
+		DirectoryID:          parent.ID,
+		MimeType:             "directory",
+		MediaTypeDescription: "directory",
+		Current:              true,
+		OwnerID:              project.OwnerID,
+	}
+	b.create(dir)
+	b.addToProjectCounts(project, "directory_count", 1)
+	project.DirectoryCount++
+	return dir
+}
+
+// File creates the current version of a file called name in dir, and counts it in the project's
+// FileCount and Size. Only the database entry is created, the caller is responsible for any file
+// contents.
+func (b *Builder) File(project *mcmodel.Project, dir *mcmodel.File, name string, size uint64) *mcmodel.File {
+	b.t.Helper()
+	f := b.file(project, dir, name, size, true)
+	b.addToProjectCounts(project, "file_count", 1)
+	project.FileCount++
+	return f
+}
+
+// FileVersion creates a previous version of the file called name in dir, and counts it in the project's
+// Size. Previous versions aren't counted in FileCount. Create the previous versions of a file before its
+// current version so that their IDs are in upload order.
+func (b *Builder) FileVersion(project *mcmodel.Project, dir *mcmodel.File, name string, size uint64) *mcmodel.File {
+	b.t.Helper()
+	return b.file(project, dir, name, size, false)
+}
+
+func (b *Builder) file(project *mcmodel.Project, dir *mcmodel.File, name string, size uint64, current bool) *mcmodel.File {
+	b.t.Helper()
+	f := &mcmodel.File{
+		UUID:        b.uuid(),
+		ProjectID:   project.ID,
+		Name:        name,
+		DirectoryID: dir.ID,
+		Size:        size,
+		MimeType:    "text/plain",
+		Current:     current,
+		OwnerID:     project.OwnerID,
+	}
+	b.create(f)
+	f.Directory = dir
+	b.addToProjectCounts(project, "size", int64(size))
+	project.Size += int64(size)
+	return f
+}
+
+func (b *Builder) addToProjectCounts(project *mcmodel.Project, column string, n int64) {
+	b.t.Helper()
+	err := b.db.Model(&mcmodel.Project{}).Where("id = ?", project.ID).
+		Update(column, gorm.Expr(column+" + ?", n)).Error
+	require.NoError(b.t, err)
+}
+
+// Experiment creates an experiment in project.
+func (b *Builder) Experiment(project *mcmodel.Project, name string) *mcmodel.Experiment {
+	b.t.Helper()
+	experiment := &mcmodel.Experiment{UUID: b.uuid(), Name: name, ProjectID: project.ID, OwnerID: project.OwnerID}
+	b.create(experiment)
+	return experiment
+}
+
+// Entity creates a sample in project along with its initial (current) state. The state is returned
+// in Entity.EntityStates.
+func (b *Builder) Entity(project *mcmodel.Project, name string) *mcmodel.Entity {
+	b.t.Helper()
+	entity := &mcmodel.Entity{
+		UUID:      b.uuid(),
+		Name:      name,
+		Category:  "experimental",
+		ProjectID: project.ID,
+		OwnerID:   project.OwnerID,
+	}
+	b.create(entity)
+	b.EntityState(entity)
+	return entity
+}
+
+// EntityState adds a new current state to entity.
+func (b *Builder) EntityState(entity *mcmodel.Entity) *mcmodel.EntityState {
+	b.t.Helper()
+	state := mcmodel.EntityState{UUID: b.uuid(), EntityID: entity.ID, Current: true, OwnerID: entity.OwnerID}
+	b.create(&state)
+	entity.EntityStates = append(entity.EntityStates, state)
+	return &entity.EntityStates[len(entity.EntityStates)-1]
+}
+
+// Activity creates a process in project.
+func (b *Builder) Activity(project *mcmodel.Project, name string) *mcmodel.Activity {
+	b.t.Helper()
+	activity := &mcmodel.Activity{
+		UUID:      b.uuid(),
+		Name:      name,
+		Category:  "experimental",
+		ProjectID: project.ID,
+		OwnerID:   project.OwnerID,
+	}
+	b.create(activity)
+	return activity
+}
+
+// ActivityAttribute adds an attribute with a single value to activity.
+func (b *Builder) ActivityAttribute(activity *mcmodel.Activity, name string, value interface{}, unit string) *mcmodel.Attribute {
+	b.t.Helper()
+	return b.attribute("App\\Models\\Activity", activity.ID, name, value, unit)
+}
+
+// EntityStateAttribute adds an attribute with a single value to an entity state.
+func (b *Builder) EntityStateAttribute(state *mcmodel.EntityState, name string, value interface{}, unit string) *mcmodel.Attribute {
+	b.t.Helper()
+	return b.attribute("App\\Models\\EntityState", state.ID, name, value, unit)
+}
+
+// attribute creates the attribute and its value. Values are stored the way the web application stores
+// them, as JSON in the form {"value": value}.
+func (b *Builder) attribute(attributableType string, attributableID int, name string, value interface{}, unit string) *mcmodel.Attribute {
+	b.t.Helper()
+	val, err := json.Marshal(map[string]interface{}{"value": value})
+	require.NoError(b.t, err)
+
+	attr := &mcmodel.Attribute{
+		UUID:             b.uuid(),
+		Name:             name,
+		AttributableID:   attributableID,
+		AttributableType: attributableType,
+		AttributeValues:  []mcmodel.AttributeValue{{UUID: b.uuid(), Unit: unit, Val: string(val)}},
+	}
+	b.create(attr)
+	return attr
+}
+
+// Link records that activity was performed on entity.
+func (b *Builder) Link(activity *mcmodel.Activity, entity *mcmodel.Entity) {
+	b.t.Helper()
+	b.create(&mcmodel.Activity2Entity{ActivityID: activity.ID, EntityID: entity.ID})
+}
+
+// AddEntityToExperiment adds entity to experiment.
+func (b *Builder) AddEntityToExperiment(experiment *mcmodel.Experiment, entity *mcmodel.Entity) {
+	b.t.Helper()
+	b.create(&mcmodel.Experiment2Entity{ExperimentID: experiment.ID, EntityID: entity.ID})
+}
+
+// AddActivityToExperiment adds activity to experiment.
+func (b *Builder) AddActivityToExperiment(experiment *mcmodel.Experiment, activity *mcmodel.Activity) {
+	b.t.Helper()
+	b.create(&mcmodel.Experiment2Activity{ExperimentID: experiment.ID, ActivityID: activity.ID})
+}
+
+// AddFileToEntity attaches f to entity.
+func (b *Builder) AddFileToEntity(entity *mcmodel.Entity, f *mcmodel.File) {
+	b.t.Helper()
+	require.NoError(b.t, b.db.Model(entity).Association("Files").Append(f))
+}
+
+// Dataset creates an unpublished dataset in project with an empty file selection.
+func (b *Builder) Dataset(project *mcmodel.Project, name string) *mcmodel.Dataset {
+	b.t.Helper()
+	ds := &mcmodel.Dataset{UUID: b.uuid(), Name: name, ProjectID: project.ID, FileSelection: "{}"}
+	b.create(ds)
+	return ds
+}
+
+// AddFileToDataset publishes f in ds.
+func (b *Builder) AddFileToDataset(ds *mcmodel.Dataset, f *mcmodel.File) {
+	b.t.Helper()
+	b.create(&mcmodel.Dataset2File{DatasetID: ds.ID, FileID: f.ID})
+}
+
+// AddEntityToDataset selects entity for ds.
+func (b *Builder) AddEntityToDataset(ds *mcmodel.Dataset, entity *mcmodel.Entity) {
+	b.t.Helper()
+	b.create(&mcmodel.Item2EntitySelection{ItemID: ds.ID, ItemType: "App\\Models\\Dataset", EntityID: entity.ID})
+}
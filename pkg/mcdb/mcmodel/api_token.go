@@ -0,0 +1,90 @@
+package mcmodel
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix starts the secret of every APIToken. It tells them apart from the api_token column
+// in users, which is still accepted everywhere an APIToken is.
+const APITokenPrefix = "mct_"
+
+// The scopes of an APIToken.
+const (
+	APITokenScopeRead      = "read"
+	APITokenScopeWrite     = "write"
+	APITokenScopeReadWrite = "read-write"
+)
+
+// APIToken is a token for automation, such as an instrument PC uploading its data. Unlike the
+// user's api_token it can be restricted to a single project, to reading or writing, and it can
+// expire and be revoked. Only a hash of the secret is stored, the secret is shown once when the
+// token is created.
+type APIToken struct {
+	ID         int        `json:"id"`
+	UUID       string     `json:"uuid"`
+	Name       string     `json:"name"`
+	UserID     int        `json:"user_id"`
+	User       *User      `json:"-" gorm:"foreignKey:UserID;references:ID"`
+	ProjectID  int        `json:"project_id" gorm:"default:null"`
+	Scope      string     `json:"scope"`
+	SecretHash string     `json:"-" gorm:"uniqueIndex;size:64"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
+
+// HashAPITokenSecret returns the hash an APIToken's secret is stored and looked up by. Secrets are
+// long and random, so a plain SHA-256 is enough.
+func HashAPITokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPITokenSecret returns true if secret looks like the secret of an APIToken rather than a user's
+// api_token.
+func IsAPITokenSecret(secret string) bool {
+	return strings.HasPrefix(secret, APITokenPrefix)
+}
+
+// ValidAPITokenScope returns true for the scopes an APIToken can have.
+func ValidAPITokenScope(scope string) bool {
+	switch scope {
+	case APITokenScopeRead, APITokenScopeWrite, APITokenScopeReadWrite:
+		return true
+	default:
+		return false
+	}
+}
+
+// CanRead returns true if the token can be used to browse and download.
+func (t *APIToken) CanRead() bool {
+	return t.Scope == APITokenScopeRead || t.Scope == APITokenScopeReadWrite
+}
+
+// CanWrite returns true if the token can be used to upload and change files.
+func (t *APIToken) CanWrite() bool {
+	return t.Scope == APITokenScopeWrite || t.Scope == APITokenScopeReadWrite
+}
+
+// CanAccessProject returns true if the token isn't restricted to a different project.
+func (t *APIToken) CanAccessProject(projectID int) bool {
+	return t.ProjectID == 0 || t.ProjectID == projectID
+}
+
+// IsExpired returns true if the token has an expiry and it has passed.
+func (t *APIToken) IsExpired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// IsRevoked returns true if the token has been revoked.
+func (t *APIToken) IsRevoked() bool {
+	return t.RevokedAt != nil
+}
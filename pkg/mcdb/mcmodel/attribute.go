@@ -1,7 +1,11 @@
 package mcmodel
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -44,73 +48,226 @@ type AttributeValue struct {
 	ValueArrayOfComplex []map[string]interface{} `gorm:"-"`
 }
 
+// LoadValues decodes every one of the attribute's values, see AttributeValue.Decode. Values that were
+// already decoded are left alone. All the values are decoded even when some fail, the errors for the
+// ones that failed are returned together.
 func (a *Attribute) LoadValues() error {
-	if len(a.AttributeValues) == 0 {
-		return nil
-	}
+	var errs []error
 	for i := range a.AttributeValues {
 		if a.AttributeValues[i].ValueType != ValueTypeUnset {
 			// Value already set so skip
 			continue
 		}
 
-		var val map[string]interface{}
-		if err := json.Unmarshal([]byte(a.AttributeValues[i].Val), &val); err != nil {
-			return err
-		}
-		//fmt.Printf("%+v\n", val)
-		switch val["value"].(type) {
-		case int:
-			a.AttributeValues[i].ValueType = ValueTypeInt
-			a.AttributeValues[i].ValueInt = val["value"].(int64)
-		case []int:
-			a.AttributeValues[i].ValueType = ValueTypeArrayOfInt
-			a.AttributeValues[i].ValueArrayOfInt = val["value"].([]int64)
-		case float32, float64:
-			a.AttributeValues[i].ValueType = ValueTypeFloat
-			a.AttributeValues[i].ValueFloat = val["value"].(float64)
-		case []float32, []float64:
-			a.AttributeValues[i].ValueType = ValueTypeArrayOfFloat
-			a.AttributeValues[i].ValueArrayOfFloat = val["value"].([]float64)
-		case string:
-			// Lots of numeric values are stored as strings, so we need to check and convert
-			valAsStr := val["value"].(string)
-
-			if strings.Contains(valAsStr, ".") {
-				// Try and convert to float, if that fails, then keep as string
-				valAsFloat, err := strconv.ParseFloat(valAsStr, 64)
-				if err == nil {
-					a.AttributeValues[i].ValueType = ValueTypeFloat
-					a.AttributeValues[i].ValueFloat = valAsFloat
-					return nil
-				}
-			}
-
-			// Float failed so try and convert to int and if that is successful store as int, otherwise as string
-			valAsInt, err := strconv.ParseInt(valAsStr, 10, 64)
-			if err == nil {
-				a.AttributeValues[i].ValueType = ValueTypeInt
-				a.AttributeValues[i].ValueInt = valAsInt
-				return nil
-			}
-
-			// Nope, its still a string
-			a.AttributeValues[i].ValueType = ValueTypeString
-			a.AttributeValues[i].ValueString = valAsStr
-		case []string:
-			// support later
-		case map[interface{}]interface{}:
-			// support later
-		case []map[interface{}]interface{}:
-			// support later
-		default:
-			//fmt.Printf("Unknown cast type for attribute %s\n", a.Name)
-			// What to do here?
+		if err := a.AttributeValues[i].Decode(); err != nil {
+			errs = append(errs, err)
 		}
 	}
-	return nil
+
+	return errors.Join(errs...)
 }
 
+// GetValue returns the decoded value of the attribute's first value, or nil if it doesn't have one or
+// it hasn't been decoded.
 func (a Attribute) GetValue() interface{} {
+	if len(a.AttributeValues) == 0 {
+		return nil
+	}
+
+	return a.AttributeValues[0].GetValue()
+}
+
+// Decode fills in ValueType and the matching Value* field from Val. Val holds JSON of the form
+// {"value": ...}, and the value is decoded as follows:
+//
+//   - A number without a fraction or exponent that fits in an int64 is an int, any other number is a float.
+//   - A string holding a number is converted the same way, as lots of numeric values are stored as
+//     strings. Any other string, or a number too large for a float64, is a string. Booleans are stored
+//     as the strings "true" and "false".
+//   - An object is complex.
+//   - An array whose elements are all ints is an array of int. An array of numbers that aren't all ints is
+//     an array of float, and an array of objects is an array of complex. Any other array, including an
+//     empty one or one mixing strings and numbers, is an array of string with each element converted to a
+//     string. Strings in arrays are not converted to numbers.
+//   - null leaves the value unset.
+func (v *AttributeValue) Decode() error {
+	v.clearValue()
+
+	var val map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(v.Val), &val); err != nil {
+		return fmt.Errorf("attribute value %d: invalid val %q: %w", v.ID, v.Val, err)
+	}
+
+	raw, ok := val["value"]
+	if !ok {
+		return fmt.Errorf("attribute value %d: val %q has no value", v.ID, v.Val)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return fmt.Errorf("attribute value %d: invalid val %q: %w", v.ID, v.Val, err)
+	}
+
+	switch value := value.(type) {
+	case nil:
+		// Leave unset
+	case json.Number:
+		v.setNumberOrString(value.String())
+	case string:
+		v.setNumberOrString(value)
+	case bool:
+		v.ValueType = ValueTypeString
+		v.ValueString = strconv.FormatBool(value)
+	case map[string]interface{}:
+		v.ValueType = ValueTypeComplex
+		v.ValueComplex = fromJSONNumbers(value).(map[string]interface{})
+	case []interface{}:
+		v.setArray(value)
+	}
+
 	return nil
 }
+
+// GetValue returns the decoded value, as the type of the Value* field ValueType selects. It returns nil
+// when the value is unset.
+func (v AttributeValue) GetValue() interface{} {
+	switch v.ValueType {
+	case ValueTypeInt:
+		return v.ValueInt
+	case ValueTypeFloat:
+		return v.ValueFloat
+	case ValueTypeString:
+		return v.ValueString
+	case ValueTypeComplex:
+		return v.ValueComplex
+	case ValueTypeArrayOfInt:
+		return v.ValueArrayOfInt
+	case ValueTypeArrayOfFloat:
+		return v.ValueArrayOfFloat
+	case ValueTypeArrayOfString:
+		return v.ValueArrayOfString
+	case ValueTypeArrayOfComplex:
+		return v.ValueArrayOfComplex
+	default:
+		return nil
+	}
+}
+
+func (v *AttributeValue) clearValue() {
+	val, id, uuid, attributeID, unit := v.Val, v.ID, v.UUID, v.AttributeID, v.Unit
+	*v = AttributeValue{ID: id, UUID: uuid, AttributeID: attributeID, Unit: unit, Val: val}
+}
+
+// setNumberOrString sets the value to s as an int or float when it is a number, and as a string when it
+// isn't or is too large to be represented.
+func (v *AttributeValue) setNumberOrString(s string) {
+	if i, ok := parseInt(s); ok {
+		v.ValueType = ValueTypeInt
+		v.ValueInt = i
+	} else if f, ok := parseFloat(s); ok {
+		v.ValueType = ValueTypeFloat
+		v.ValueFloat = f
+	} else {
+		v.ValueType = ValueTypeString
+		v.ValueString = s
+	}
+}
+
+func (v *AttributeValue) setArray(values []interface{}) {
+	nonEmpty := len(values) != 0
+	allInts, allNumbers, allComplex := nonEmpty, nonEmpty, nonEmpty
+
+	for _, value := range values {
+		n, isNumber := value.(json.Number)
+		_, isInt := parseInt(n.String())
+		_, isComplex := value.(map[string]interface{})
+		allInts = allInts && isNumber && isInt
+		allNumbers = allNumbers && isNumber
+		allComplex = allComplex && isComplex
+	}
+
+	switch {
+	case allInts:
+		v.ValueType = ValueTypeArrayOfInt
+		v.ValueArrayOfInt = make([]int64, 0, len(values))
+		for _, value := range values {
+			i, _ := parseInt(value.(json.Number).String())
+			v.ValueArrayOfInt = append(v.ValueArrayOfInt, i)
+		}
+	case allNumbers:
+		v.ValueType = ValueTypeArrayOfFloat
+		v.ValueArrayOfFloat = make([]float64, 0, len(values))
+		for _, value := range values {
+			f, _ := value.(json.Number).Float64()
+			v.ValueArrayOfFloat = append(v.ValueArrayOfFloat, f)
+		}
+	case allComplex:
+		v.ValueType = ValueTypeArrayOfComplex
+		v.ValueArrayOfComplex = make([]map[string]interface{}, 0, len(values))
+		for _, value := range values {
+			v.ValueArrayOfComplex = append(v.ValueArrayOfComplex, fromJSONNumbers(value).(map[string]interface{}))
+		}
+	default:
+		v.ValueType = ValueTypeArrayOfString
+		v.ValueArrayOfString = make([]string, 0, len(values))
+		for _, value := range values {
+			v.ValueArrayOfString = append(v.ValueArrayOfString, arrayElementString(value))
+		}
+	}
+}
+
+// parseInt parses s as an int64. Only plain integers are accepted, "1.0" and "1e3" aren't.
+func parseInt(s string) (int64, bool) {
+	i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	return i, err == nil
+}
+
+// parseFloat parses s as a finite float64. Strings such as "inf" and "nan" that strconv accepts are not
+// numbers here.
+func parseFloat(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return f, !math.IsInf(f, 0) && !math.IsNaN(f)
+}
+
+// fromJSONNumbers replaces the json.Numbers in a decoded value with float64s, the same as decoding
+// without UseNumber.
+func fromJSONNumbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		f, _ := value.Float64()
+		return f
+	case map[string]interface{}:
+		for k, v := range value {
+			value[k] = fromJSONNumbers(v)
+		}
+		return value
+	case []interface{}:
+		for i, v := range value {
+			value[i] = fromJSONNumbers(v)
+		}
+		return value
+	default:
+		return value
+	}
+}
+
+// arrayElementString converts an element of an array of mixed values to a string.
+func arrayElementString(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case nil:
+		return ""
+	default:
+		b, _ := json.Marshal(fromJSONNumbers(value))
+		return string(b)
+	}
+}
@@ -54,3 +54,100 @@ func TestSampleJSON(t *testing.T) {
 
 	fmt.Println(string(b))
 }
+
+func TestDecodeAttributeValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		val      string
+		expected AttributeValue
+	}{
+		{name: "int", val: `{"value": 5}`, expected: AttributeValue{ValueType: ValueTypeInt, ValueInt: 5}},
+		{name: "negative int", val: `{"value": -12}`, expected: AttributeValue{ValueType: ValueTypeInt, ValueInt: -12}},
+		{name: "large int keeps its precision", val: `{"value": 9007199254740993}`, expected: AttributeValue{ValueType: ValueTypeInt, ValueInt: 9007199254740993}},
+		{name: "int too large for int64 is a float", val: `{"value": 92233720368547758070}`, expected: AttributeValue{ValueType: ValueTypeFloat, ValueFloat: 92233720368547758070}},
+		{name: "float", val: `{"value": 0.81}`, expected: AttributeValue{ValueType: ValueTypeFloat, ValueFloat: 0.81}},
+		{name: "float with a zero fraction", val: `{"value": 3.0}`, expected: AttributeValue{ValueType: ValueTypeFloat, ValueFloat: 3}},
+		{name: "exponent", val: `{"value": 1e3}`, expected: AttributeValue{ValueType: ValueTypeFloat, ValueFloat: 1000}},
+		{name: "number too large for a float", val: `{"value": 1e400}`, expected: AttributeValue{ValueType: ValueTypeString, ValueString: "1e400"}},
+		{name: "string", val: `{"value": "zn45"}`, expected: AttributeValue{ValueType: ValueTypeString, ValueString: "zn45"}},
+		{name: "empty string", val: `{"value": ""}`, expected: AttributeValue{ValueType: ValueTypeString}},
+		{name: "int in a string", val: `{"value": "400"}`, expected: AttributeValue{ValueType: ValueTypeInt, ValueInt: 400}},
+		{name: "float in a string", val: `{"value": "0.5"}`, expected: AttributeValue{ValueType: ValueTypeFloat, ValueFloat: 0.5}},
+		{name: "exponent in a string", val: `{"value": "2.5e-3"}`, expected: AttributeValue{ValueType: ValueTypeFloat, ValueFloat: 0.0025}},
+		{name: "inf in a string is a string", val: `{"value": "Inf"}`, expected: AttributeValue{ValueType: ValueTypeString, ValueString: "Inf"}},
+		{name: "nan in a string is a string", val: `{"value": "NaN"}`, expected: AttributeValue{ValueType: ValueTypeString, ValueString: "NaN"}},
+		{name: "bool", val: `{"value": true}`, expected: AttributeValue{ValueType: ValueTypeString, ValueString: "true"}},
+		{name: "null", val: `{"value": null}`, expected: AttributeValue{ValueType: ValueTypeUnset}},
+		{
+			name:     "object",
+			val:      `{"value": {"x": 1, "label": "a", "nested": {"y": [1, 2]}}}`,
+			expected: AttributeValue{ValueType: ValueTypeComplex, ValueComplex: map[string]interface{}{"x": 1.0, "label": "a", "nested": map[string]interface{}{"y": []interface{}{1.0, 2.0}}}},
+		},
+		{name: "array of int", val: `{"value": [1, 2, 3]}`, expected: AttributeValue{ValueType: ValueTypeArrayOfInt, ValueArrayOfInt: []int64{1, 2, 3}}},
+		{name: "array of float", val: `{"value": [1.5, 2.5]}`, expected: AttributeValue{ValueType: ValueTypeArrayOfFloat, ValueArrayOfFloat: []float64{1.5, 2.5}}},
+		{name: "ints and floats are floats", val: `{"value": [1, 2.5]}`, expected: AttributeValue{ValueType: ValueTypeArrayOfFloat, ValueArrayOfFloat: []float64{1, 2.5}}},
+		{name: "array of string", val: `{"value": ["a", "b"]}`, expected: AttributeValue{ValueType: ValueTypeArrayOfString, ValueArrayOfString: []string{"a", "b"}}},
+		{name: "strings in arrays aren't converted", val: `{"value": ["1", "2"]}`, expected: AttributeValue{ValueType: ValueTypeArrayOfString, ValueArrayOfString: []string{"1", "2"}}},
+		{name: "mixed array", val: `{"value": ["a", 1, true, null, [2]]}`, expected: AttributeValue{ValueType: ValueTypeArrayOfString, ValueArrayOfString: []string{"a", "1", "true", "", "[2]"}}},
+		{name: "empty array", val: `{"value": []}`, expected: AttributeValue{ValueType: ValueTypeArrayOfString, ValueArrayOfString: []string{}}},
+		{
+			name:     "array of complex",
+			val:      `{"value": [{"x": 1}, {"x": 2}]}`,
+			expected: AttributeValue{ValueType: ValueTypeArrayOfComplex, ValueArrayOfComplex: []map[string]interface{}{{"x": 1.0}, {"x": 2.0}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := AttributeValue{ID: 1, Unit: "mm", Val: test.val}
+			require.NoError(t, v.Decode())
+
+			test.expected.ID, test.expected.Unit, test.expected.Val = 1, "mm", test.val
+			require.Equal(t, test.expected, v)
+		})
+	}
+}
+
+func TestDecodeAttributeValueErrors(t *testing.T) {
+	for _, val := range []string{``, `5`, `{"val": 5}`, `{"value": 5`} {
+		v := AttributeValue{Val: val}
+		require.Error(t, v.Decode(), val)
+		require.Equal(t, ValueTypeUnset, v.ValueType)
+	}
+}
+
+func TestDecodeAttributeValueClearsPreviousValue(t *testing.T) {
+	v := AttributeValue{Val: `{"value": [1, 2]}`, ValueType: ValueTypeString, ValueString: "old"}
+	require.NoError(t, v.Decode())
+	require.Equal(t, ValueTypeArrayOfInt, v.ValueType)
+	require.Empty(t, v.ValueString)
+}
+
+func TestLoadValues(t *testing.T) {
+	attr := Attribute{
+		AttributeValues: []AttributeValue{
+			{Val: `{"value": "1.5"}`},
+			{Val: `not json`},
+			{Val: `{"value": "2"}`},
+			{Val: `{"value": "ignored"}`, ValueType: ValueTypeInt, ValueInt: 7},
+		},
+	}
+
+	// Every value is decoded, even after one fails.
+	require.Error(t, attr.LoadValues())
+	require.Equal(t, 1.5, attr.AttributeValues[0].ValueFloat)
+	require.Equal(t, ValueTypeUnset, attr.AttributeValues[1].ValueType)
+	require.Equal(t, int64(2), attr.AttributeValues[2].ValueInt)
+	require.Equal(t, int64(7), attr.AttributeValues[3].ValueInt)
+	require.Equal(t, 1.5, attr.GetValue())
+
+	require.NoError(t, (&Attribute{}).LoadValues())
+	require.Nil(t, Attribute{}.GetValue())
+}
+
+func TestAttributeValueGetValue(t *testing.T) {
+	require.Equal(t, int64(1), AttributeValue{ValueType: ValueTypeInt, ValueInt: 1}.GetValue())
+	require.Equal(t, []string{"a"}, AttributeValue{ValueType: ValueTypeArrayOfString, ValueArrayOfString: []string{"a"}}.GetValue())
+	require.Equal(t, []float64{1}, AttributeValue{ValueType: ValueTypeArrayOfFloat, ValueArrayOfFloat: []float64{1}}.GetValue())
+	require.Nil(t, AttributeValue{}.GetValue())
+}
@@ -43,11 +43,15 @@ func (d Dataset) GetFileSelection() (*FileSelection, error) {
 	return &fs, err
 }
 
+// FileSelection is the set of rules that decide which project files are in a dataset. The Include and
+// Exclude entries are exact paths. Patterns are .gitignore style globs, such as "**/*.csv", "raw/run-*/"
+// and "!*.tmp". See mcdb.DatasetFileSelector for how the rules are combined.
 type FileSelection struct {
 	IncludeFiles []string `json:"include_files"`
 	ExcludeFiles []string `json:"exclude_files"`
 	IncludeDirs  []string `json:"include_dirs"`
 	ExcludeDirs  []string `json:"exclude_dirs"`
+	Patterns     []string `json:"patterns,omitempty"`
 }
 
 func (d Dataset) GetFiles(db *gorm.DB) *gorm.DB {
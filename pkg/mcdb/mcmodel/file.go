@@ -3,9 +3,12 @@ package mcmodel
 import (
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/materials-commons/hydra/pkg/digest"
 )
 
 type File struct {
@@ -16,16 +19,19 @@ type File struct {
 	ProjectID               int       `json:"project_id"`
 	Name                    string    `json:"name"`
 	OwnerID                 int       `json:"owner_id"`
+	Owner                   *User     `json:"owner,omitempty" gorm:"foreignKey:OwnerID;references:ID"`
 	Path                    string    `json:"path"`
 	DirectoryID             int       `json:"directory_id" gorm:"default:null"`
 	DatasetID               int       `json:"dataset_id" gorm:"default:null"`
 	Size                    uint64    `json:"size"`
 	Checksum                string    `json:"checksum"`
+	Sha256                  string    `json:"sha256"`
 	MimeType                string    `json:"mime_type"`
 	MediaTypeDescription    string    `json:"media_type_description"`
 	Current                 bool      `json:"current"`
 	Directory               *File     `json:"directory" gorm:"foreignKey:DirectoryID;references:ID"`
 	DeletedAt               time.Time `gorm:"default:null"`
+	TrashID                 string    `json:"trash_id" gorm:"default:null"`
 	CreatedAt               time.Time `json:"created_at"`
 	UpdatedAt               time.Time `json:"updated_at"`
 	UploadSource            string    `json:"upload_source"`
@@ -33,6 +39,7 @@ type File struct {
 	FileMissingDeterminedBy string    `json:"file_missing_determined_by"`
 	Health                  string    `json:"health"`
 	HealthFixedBy           string    `json:"health_fixed_by"`
+	HealthFixedAt           time.Time `json:"health_fixed_at" gorm:"default:null"`
 	ThumbnailCreatedAt      time.Time `json:"thumbnail_created_at" gorm:"default:null"`
 	ThumbnailStatus         string    `json:"thumbnail_status"`
 	ConversionCreatedAt     time.Time `json:"conversion_created_at" gorm:"default:null"`
@@ -79,6 +86,11 @@ func (f File) IsFile() bool {
 	return f.MimeType != "directory"
 }
 
+// Sums returns the checksums recorded for the file's contents.
+func (f File) Sums() digest.Sums {
+	return digest.Sums{MD5: f.Checksum, SHA256: f.Sha256}
+}
+
 func (f File) IsDir() bool {
 	return f.MimeType == "directory"
 }
@@ -106,12 +118,28 @@ func (f File) RealFileExists(mcdir string) bool {
 }
 
 func (f File) ToUnderlyingFilePath(mcdir string) string {
-	return filepath.Join(f.ToUnderlyingDirPath(mcdir), f.UUIDForPath())
+	return filepath.Join(mcdir, filepath.FromSlash(f.BlobKey()))
 }
 
 func (f File) ToUnderlyingFilePathForUUID(mcdir string) string {
-	uuidParts := strings.Split(f.UUID, "-")
-	return filepath.Join(mcdir, uuidParts[1][0:2], uuidParts[1][2:4], f.UUID)
+	return filepath.Join(mcdir, filepath.FromSlash(f.BlobKeyForUUID()))
+}
+
+// BlobKey is the key for the file's contents in a blobstore.BlobStore. It has the same
+// xx/yy/<uuid> layout as ToUnderlyingFilePath, relative to the store, and like
+// ToUnderlyingFilePath it uses UsesUUID when the file points at another file's contents.
+func (f File) BlobKey() string {
+	return blobKeyFor(f.UUIDForPath())
+}
+
+// BlobKeyForUUID is the key for the file's own contents, ignoring UsesUUID.
+func (f File) BlobKeyForUUID() string {
+	return blobKeyFor(f.UUID)
+}
+
+func blobKeyFor(uuid string) string {
+	uuidParts := strings.Split(uuid, "-")
+	return path.Join(uuidParts[1][0:2], uuidParts[1][2:4], uuid)
 }
 
 func (f File) ToUnderlyingDirPath(mcdir string) string {
@@ -0,0 +1,45 @@
+package mcmodel
+
+import (
+	"fmt"
+	"time"
+)
+
+// FileVersionDiff is a single metadata field that differs between two versions of a file.
+type FileVersionDiff struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// DiffFileVersions compares the metadata of two versions of a file and returns the fields that
+// changed going from one version to the other. The contents of the versions aren't compared, only
+// the checksum that was recorded when each was uploaded.
+func DiffFileVersions(from, to File) []FileVersionDiff {
+	diffs := []FileVersionDiff{}
+
+	add := func(field, fromValue, toValue string) {
+		if fromValue != toValue {
+			diffs = append(diffs, FileVersionDiff{Field: field, From: fromValue, To: toValue})
+		}
+	}
+
+	add("size", fmt.Sprintf("%d", from.Size), fmt.Sprintf("%d", to.Size))
+	add("checksum", from.Checksum, to.Checksum)
+	add("sha256", from.Sha256, to.Sha256)
+	add("mime_type", from.MimeType, to.MimeType)
+	add("owner_id", fmt.Sprintf("%d", from.OwnerID), fmt.Sprintf("%d", to.OwnerID))
+	add("upload_source", from.UploadSource, to.UploadSource)
+	add("health", from.Health, to.Health)
+	add("created_at", formatVersionTime(from.CreatedAt), formatVersionTime(to.CreatedAt))
+
+	return diffs
+}
+
+func formatVersionTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,28 @@
+package mcmodel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffFileVersions(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	from := File{Size: 10, Checksum: "abc", MimeType: "text/plain", OwnerID: 1, UploadSource: "TUS", CreatedAt: created}
+
+	require.Empty(t, DiffFileVersions(from, from))
+
+	to := from
+	to.Size = 20
+	to.Checksum = "def"
+	to.UploadSource = "MCFT"
+	to.CreatedAt = created.Add(time.Hour)
+
+	require.Equal(t, []FileVersionDiff{
+		{Field: "size", From: "10", To: "20"},
+		{Field: "checksum", From: "abc", To: "def"},
+		{Field: "upload_source", From: "TUS", To: "MCFT"},
+		{Field: "created_at", From: "2024-01-02T03:04:05Z", To: "2024-01-02T04:04:05Z"},
+	}, DiffFileVersions(from, to))
+}
@@ -0,0 +1,89 @@
+package mcmodel
+
+// The models in this file describe the join tables that are queried directly (rather than through
+// a gorm many2many association). They exist so that RunMigrations can create the tables, and so that
+// code and tests have a typed way to read and write rows in them.
+
+// Activity2Entity joins processes (activities) to the samples (entities) they operate on.
+type Activity2Entity struct {
+	ID         int `json:"id"`
+	ActivityID int `json:"activity_id"`
+	EntityID   int `json:"entity_id"`
+}
+
+func (Activity2Entity) TableName() string {
+	return "activity2entity"
+}
+
+// Experiment2Entity joins experiments to their samples (entities).
+type Experiment2Entity struct {
+	ID           int `json:"id"`
+	EntityID     int `json:"entity_id"`
+	ExperimentID int `json:"experiment_id"`
+}
+
+func (Experiment2Entity) TableName() string {
+	return "experiment2entity"
+}
+
+// Experiment2Activity joins experiments to their processes (activities).
+type Experiment2Activity struct {
+	ID           int `json:"id"`
+	ActivityID   int `json:"activity_id"`
+	ExperimentID int `json:"experiment_id"`
+}
+
+func (Experiment2Activity) TableName() string {
+	return "experiment2activity"
+}
+
+// Dataset2File joins a dataset to the files that have been published in it.
+type Dataset2File struct {
+	ID        int `json:"id"`
+	DatasetID int `json:"dataset_id"`
+	FileID    int `json:"file_id"`
+}
+
+func (Dataset2File) TableName() string {
+	return "dataset2file"
+}
+
+// Project2User joins a project to the users that have access to it.
+type Project2User struct {
+	ID        int `json:"id"`
+	ProjectID int `json:"project_id"`
+	UserID    int `json:"user_id"`
+}
+
+func (Project2User) TableName() string {
+	return "project2user"
+}
+
+// Project2Viewer grants a user read-only access to a project. Unlike project2user, which the web app
+// fills in for the project's team, rows are only written by AddViewerToProject, so a user is never
+// made a viewer by a row that wasn't meant to grant access.
+type Project2Viewer struct {
+	ID        int `json:"id"`
+	ProjectID int `json:"project_id"`
+	UserID    int `json:"user_id"`
+}
+
+func (Project2Viewer) TableName() string {
+	return "project2viewer"
+}
+
+// Item2EntitySelection records the samples (entities) selected for an item, such as a dataset. An
+// entry either selects a specific entity by EntityID, or selects an entity by EntityName from the
+// given experiment.
+type Item2EntitySelection struct {
+	ID           int    `json:"id"`
+	ItemID       int    `json:"item_id"`
+	ItemType     string `json:"item_type"`
+	ExperimentID int    `json:"experiment_id" gorm:"default:null"`
+	EntityID     int    `json:"entity_id" gorm:"default:null"`
+	EntityName   string `json:"entity_name"`
+}
+
+func (Item2EntitySelection) TableName() string {
+	return "item2entity_selection"
+}
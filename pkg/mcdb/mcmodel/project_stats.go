@@ -0,0 +1,86 @@
+package mcmodel
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ProjectStats are the fields on a project that summarize its files. Size is the total bytes across
+// every version of every file, FileCount and FileTypes only count the current version of each file,
+// and DirectoryCount doesn't include the root directory.
+type ProjectStats struct {
+	Size           int64          `json:"size"`
+	FileCount      int            `json:"file_count"`
+	DirectoryCount int            `json:"directory_count"`
+	FileTypes      map[string]int `json:"file_types"`
+}
+
+// Stats returns the statistics currently stored on the project. FileTypes that can't be parsed are
+// treated as empty.
+func (p Project) Stats() ProjectStats {
+	fileTypes, err := p.GetFileTypes()
+	if err != nil || fileTypes == nil {
+		fileTypes = make(map[string]int)
+	}
+
+	return ProjectStats{
+		Size:           p.Size,
+		FileCount:      p.FileCount,
+		DirectoryCount: p.DirectoryCount,
+		FileTypes:      fileTypes,
+	}
+}
+
+// ProjectStatsDiff is a single statistic whose stored value differs from the value derived from the
+// project's files. File type counts are reported individually as "file_types.<description>".
+type ProjectStatsDiff struct {
+	Field    string `json:"field"`
+	Stored   string `json:"stored"`
+	Computed string `json:"computed"`
+}
+
+// DiffProjectStats compares the stored statistics for a project against the ones computed from its
+// files. File types with a zero count are treated the same as missing ones.
+func DiffProjectStats(stored, computed ProjectStats) []ProjectStatsDiff {
+	diffs := []ProjectStatsDiff{}
+
+	add := func(field string, storedValue, computedValue interface{}) {
+		s, c := fmt.Sprintf("%v", storedValue), fmt.Sprintf("%v", computedValue)
+		if s != c {
+			diffs = append(diffs, ProjectStatsDiff{Field: field, Stored: s, Computed: c})
+		}
+	}
+
+	add("size", stored.Size, computed.Size)
+	add("file_count", stored.FileCount, computed.FileCount)
+	add("directory_count", stored.DirectoryCount, computed.DirectoryCount)
+
+	fileTypes := make(map[string]bool)
+	for fileType := range stored.FileTypes {
+		fileTypes[fileType] = true
+	}
+	for fileType := range computed.FileTypes {
+		fileTypes[fileType] = true
+	}
+
+	sortedFileTypes := make([]string, 0, len(fileTypes))
+	for fileType := range fileTypes {
+		sortedFileTypes = append(sortedFileTypes, fileType)
+	}
+	sort.Strings(sortedFileTypes)
+
+	for _, fileType := range sortedFileTypes {
+		add("file_types."+fileType, stored.FileTypes[fileType], computed.FileTypes[fileType])
+	}
+
+	return diffs
+}
+
+// ProjectStatsReport is the result of rebuilding the statistics for one project.
+type ProjectStatsReport struct {
+	ProjectID int                `json:"project_id"`
+	Stored    ProjectStats       `json:"stored"`
+	Computed  ProjectStats       `json:"computed"`
+	Diffs     []ProjectStatsDiff `json:"diffs"`
+	Corrected bool               `json:"corrected"`
+}
@@ -14,6 +14,7 @@ type RemoteClientTransfer struct {
 	TransferType     string        `json:"transfer_type"`
 	ExpectedSize     uint64        `json:"expected_size"`
 	ExpectedChecksum string        `json:"expected_checksum"`
+	ExpectedSha256   string        `json:"expected_sha256"`
 	ChunkSize        int           `json:"chunk_size"`
 	RemotePath       string        `json:"remote_path"`
 	RemoteClientID   int           `json:"remote_client_id"`
@@ -0,0 +1,46 @@
+package mcmodel
+
+import "time"
+
+// StorageQuota limits the number of bytes stored by a project or by a user across all their projects.
+// Exactly one of ProjectID and UserID is set.
+type StorageQuota struct {
+	ID         int       `json:"id"`
+	ProjectID  int       `json:"project_id" gorm:"default:null"`
+	UserID     int       `json:"user_id" gorm:"default:null"`
+	LimitBytes int64     `json:"limit_bytes"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (StorageQuota) TableName() string {
+	return "storage_quotas"
+}
+
+const (
+	QuotaScopeProject = "project"
+	QuotaScopeUser    = "user"
+)
+
+// QuotaUsage is the usage of a project or user against its quota. A LimitBytes of 0 means there is no quota.
+type QuotaUsage struct {
+	Scope      string `json:"scope"`
+	ID         int    `json:"id"`
+	LimitBytes int64  `json:"limit_bytes"`
+	UsedBytes  int64  `json:"used_bytes"`
+}
+
+// IsLimited returns true if there is a quota.
+func (u QuotaUsage) IsLimited() bool {
+	return u.LimitBytes > 0
+}
+
+// RemainingBytes returns how many more bytes can be stored before the quota is reached. It is never
+// negative, and is only meaningful when IsLimited is true.
+func (u QuotaUsage) RemainingBytes() int64 {
+	if u.UsedBytes >= u.LimitBytes {
+		return 0
+	}
+
+	return u.LimitBytes - u.UsedBytes
+}
@@ -0,0 +1,9 @@
+-- SHA-256 checksums, computed alongside MD5 on upload. Existing files are filled in by
+-- mchubd's backfill. FindMatchingFileByChecksum looks files up by sha256.
+ALTER TABLE files
+    ADD COLUMN sha256 VARCHAR(64) NULL AFTER checksum,
+    ADD INDEX files_sha256_index (sha256);
+
+-- The SHA-256 the hub client expects for an upload, when it sent one.
+ALTER TABLE remote_client_transfers
+    ADD COLUMN expected_sha256 VARCHAR(64) NULL;
@@ -0,0 +1,3 @@
+-- When a file's health was last set to fixed, alongside health_fixed_by.
+ALTER TABLE files
+    ADD COLUMN health_fixed_at TIMESTAMP NULL AFTER health_fixed_by;
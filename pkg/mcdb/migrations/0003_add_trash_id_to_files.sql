@@ -0,0 +1,5 @@
+-- Entries deleted together share a trash_id, so that they are restored or purged together.
+-- Entries deleted before this column existed have no trash_id and are grouped by deleted_at.
+ALTER TABLE files
+    ADD COLUMN trash_id VARCHAR(36) NULL AFTER deleted_at,
+    ADD INDEX files_trash_id_index (trash_id);
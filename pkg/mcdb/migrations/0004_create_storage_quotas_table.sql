@@ -0,0 +1,13 @@
+-- Storage quotas for a project or for a user across all their projects. Exactly one of project_id
+-- and user_id is set, and there is at most one quota for each.
+CREATE TABLE storage_quotas
+(
+    id          INT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    project_id  INT UNSIGNED NULL,
+    user_id     INT UNSIGNED NULL,
+    limit_bytes BIGINT       NOT NULL,
+    created_at  TIMESTAMP    NULL,
+    updated_at  TIMESTAMP    NULL,
+    UNIQUE INDEX storage_quotas_project_id_unique (project_id),
+    UNIQUE INDEX storage_quotas_user_id_unique (user_id)
+);
@@ -0,0 +1,9 @@
+-- Users with read-only access to a project. Rows are only written by AddViewerToProject.
+CREATE TABLE project2viewer
+(
+    id         INT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    project_id INT UNSIGNED NOT NULL,
+    user_id    INT UNSIGNED NOT NULL,
+    UNIQUE INDEX project2viewer_project_id_user_id_unique (project_id, user_id),
+    INDEX project2viewer_user_id_index (user_id)
+);
@@ -0,0 +1,18 @@
+-- Scoped, expiring API tokens. Only the SHA-256 of the secret is stored. A NULL project_id means
+-- the token can be used with all of the user's projects.
+CREATE TABLE api_tokens
+(
+    id          INT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    uuid        VARCHAR(36)  NOT NULL,
+    name        VARCHAR(255) NOT NULL,
+    user_id     INT UNSIGNED NOT NULL,
+    project_id  INT UNSIGNED NULL,
+    scope       VARCHAR(16)  NOT NULL,
+    secret_hash VARCHAR(64)  NOT NULL,
+    expires_at  TIMESTAMP    NULL,
+    revoked_at  TIMESTAMP    NULL,
+    created_at  TIMESTAMP    NULL,
+    updated_at  TIMESTAMP    NULL,
+    UNIQUE INDEX api_tokens_secret_hash_unique (secret_hash),
+    INDEX api_tokens_user_id_index (user_id)
+);
@@ -0,0 +1,124 @@
+// Package backfill detects the type of files again from their contents. Files were typed from their
+// extension alone when they were uploaded, so formats such as HDF5 saved without an extension, or
+// POSCAR files, ended up as application/octet-stream or unknown. By default only files with one of
+// those generic types are looked at, Options.All re-detects every file.
+//
+// Each file's name and the first mime.SniffLen bytes of its blob are run through the same detector
+// the upload paths use. A backfill that is stopped (or that hits MaxDuration) can be started again,
+// files that now have a specific type are not selected a second time. The file type counts in the
+// project stats are only updated when the stats are next rebuilt.
+package backfill
+
+import (
+	"context"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/filewalk"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/mime"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+)
+
+type Options struct {
+	filewalk.Options
+
+	// All re-detects the type of every file, not just those with a generic type.
+	All bool
+}
+
+// Report is the result of a backfill. Types counts the files that were changed by their new type.
+type Report struct {
+	filewalk.Report
+	Changed int            `json:"changed"`
+	Types   map[string]int `json:"types"`
+}
+
+type Backfiller struct {
+	fileStor stor.FileStor
+	blobs    blobstore.BlobStore
+	detector *mime.Detector
+}
+
+func NewBackfiller(fileStor stor.FileStor, blobs blobstore.BlobStore) *Backfiller {
+	return &Backfiller{fileStor: fileStor, blobs: blobs, detector: mime.Default()}
+}
+
+// Run detects the types of the files selected by opts.
+func (b *Backfiller) Run(opts Options) (*Report, error) {
+	report := &Report{Report: filewalk.NewReport(opts.Options), Types: make(map[string]int)}
+	err := filewalk.Walk(opts.Options, &report.Report, b.fileStor.ListFilesAfterID, func(file *mcmodel.File) {
+		if opts.All || IsGeneric(file.MimeType) {
+			b.backfillFile(file, opts, report)
+		}
+	})
+
+	return report, err
+}
+
+// IsGeneric returns true for the types that say nothing about a file's format, which are the types
+// a backfill re-detects by default.
+func IsGeneric(mimeType string) bool {
+	switch mimeType {
+	case "", "unknown", mime.OctetStream, mime.TextPlain:
+		return true
+	default:
+		return false
+	}
+}
+
+// backfillFile detects the type of a single file, and stores it when it has changed.
+func (b *Backfiller) backfillFile(file *mcmodel.File, opts Options, report *Report) {
+	report.FilesChecked++
+
+	mimeType, err := b.detect(file)
+	switch {
+	case err != nil:
+		report.AddError(file, err)
+		return
+
+	case mimeType == file.MimeType:
+		return
+	}
+
+	if !opts.DryRun {
+		if err := b.fileStor.SetFileMimeType(file, mimeType); err != nil {
+			report.AddError(file, err)
+			return
+		}
+	}
+
+	report.Changed++
+	report.Types[mimeType]++
+}
+
+// detect returns the type of file from its name and the start of its blob. A missing blob is
+// reported through an error that blobstore.IsNotExist recognizes.
+func (b *Backfiller) detect(file *mcmodel.File) (string, error) {
+	r, err := b.blobs.Open(file.BlobKey(), 0)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	return b.detector.DetectReader(file.Name, r)
+}
+
+// RunEvery runs a backfill immediately, and then once every interval, until ctx is cancelled. Each
+// backfill is logged.
+func (b *Backfiller) RunEvery(ctx context.Context, interval time.Duration, opts Options) {
+	filewalk.RunEvery(ctx, interval, func() { b.runAndLog(opts) })
+}
+
+func (b *Backfiller) runAndLog(opts Options) {
+	report, err := b.Run(opts)
+	if err != nil {
+		log.Errorf("MIME type backfill failed: %s", err)
+		return
+	}
+
+	report.LogProblems("MIME type backfill")
+	log.Infof("MIME type backfill checked %d files: %d changed, %d missing, %d errors (complete: %t)",
+		report.FilesChecked, report.Changed, report.Missing, report.Errors, report.Complete)
+}
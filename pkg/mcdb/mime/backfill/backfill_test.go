@@ -0,0 +1,91 @@
+package backfill
+
+import (
+	"testing"
+
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/filewalk"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var hdf5Signature = []byte("\x89HDF\r\n\x1a\n")
+
+func TestBackfiller(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	root := t.TempDir()
+	blobs := blobstore.NewLocalBlobStore(root)
+	fileStor := stor.NewGormFileStorWithBlobStore(db, root, blobs)
+
+	hdf5 := createFile(t, db, blobs, "00000000-aaaa-0000-0000-000000000001", "scan", "application/octet-stream", hdf5Signature)
+	poscar := createFile(t, db, blobs, "00000000-aaab-0000-0000-000000000002", "POSCAR", "unknown", []byte("Si\n1.0\n"))
+	missing := createFile(t, db, blobs, "00000000-aaac-0000-0000-000000000003", "lost.h5", "unknown", nil)
+	specific := createFile(t, db, blobs, "00000000-aaad-0000-0000-000000000004", "notes.pdf", "application/pdf", hdf5Signature)
+	unchanged := createFile(t, db, blobs, "00000000-aaae-0000-0000-000000000005", "blob", "application/octet-stream", []byte{0, 1, 2})
+
+	report, err := NewBackfiller(fileStor, blobs).Run(Options{Options: filewalk.Options{DryRun: true, BatchSize: 2}})
+	require.NoError(t, err)
+	require.True(t, report.Complete)
+	require.Equal(t, 4, report.FilesChecked)
+	require.Equal(t, 2, report.Changed)
+	require.Equal(t, 1, report.Missing)
+	require.Equal(t, map[string]int{"application/x-hdf5": 1, "chemical/x-vasp-poscar": 1}, report.Types)
+
+	// A dry run doesn't store anything.
+	require.Equal(t, "application/octet-stream", reload(t, db, hdf5.ID).MimeType)
+
+	report, err = NewBackfiller(fileStor, blobs).Run(Options{})
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Changed)
+	require.Equal(t, "application/x-hdf5", reload(t, db, hdf5.ID).MimeType)
+	require.Equal(t, "chemical/x-vasp-poscar", reload(t, db, poscar.ID).MimeType)
+	require.Equal(t, "unknown", reload(t, db, missing.ID).MimeType)
+	require.Equal(t, "application/pdf", reload(t, db, specific.ID).MimeType)
+	require.Equal(t, "application/octet-stream", reload(t, db, unchanged.ID).MimeType)
+
+	// Files with a specific type are only looked at again when asked to.
+	report, err = NewBackfiller(fileStor, blobs).Run(Options{})
+	require.NoError(t, err)
+	require.Equal(t, 2, report.FilesChecked)
+	require.Equal(t, 0, report.Changed)
+
+	report, err = NewBackfiller(fileStor, blobs).Run(Options{All: true})
+	require.NoError(t, err)
+	require.Equal(t, 5, report.FilesChecked)
+	require.Equal(t, 1, report.Changed)
+	require.Equal(t, "application/x-hdf5", reload(t, db, specific.ID).MimeType)
+}
+
+// createFile creates a file row called name with the type mimeType, and stores content as its blob. A
+// nil content leaves the blob missing.
+func createFile(t *testing.T, db *gorm.DB, blobs blobstore.BlobStore, uuid, name, mimeType string, content []byte) *mcmodel.File {
+	f := &mcmodel.File{
+		UUID:      uuid,
+		ProjectID: 1,
+		Name:      name,
+		Path:      "/" + name,
+		MimeType:  mimeType,
+		Size:      uint64(len(content)),
+		Current:   true,
+	}
+	require.NoError(t, db.Create(f).Error)
+
+	if content != nil {
+		w, err := blobs.Create(f.BlobKey())
+		require.NoError(t, err)
+		_, err = w.Write(content)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+	}
+
+	return f
+}
+
+func reload(t *testing.T, db *gorm.DB, id int) mcmodel.File {
+	var f mcmodel.File
+	require.NoError(t, db.First(&f, id).Error)
+	return f
+}
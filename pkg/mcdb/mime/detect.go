@@ -0,0 +1,209 @@
+package mime
+
+import (
+	"io"
+	stdmime "mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/apex/log"
+)
+
+// SniffLen is the number of bytes at the start of a file that are used to detect its type. It's
+// large enough to find an HDF5 signature after a user block.
+const SniffLen = 4096
+
+// The types returned when nothing more specific is known about a file.
+const (
+	OctetStream = "application/octet-stream"
+	TextPlain   = "text/plain"
+)
+
+// containerTypes are sniffed types that only say how a file is packaged. Many formats, such as Office
+// documents, are zip files, so for them the extension gives the more specific type.
+var containerTypes = map[string]bool{
+	"application/zip":    true,
+	"application/x-gzip": true,
+}
+
+// officeExtensions are the Office formats that are zip files. They are registered so that they are
+// detected by extension even where the system has no MIME types file listing them.
+var officeExtensions = map[string]string{
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+func init() {
+	for ext, mimeType := range officeExtensions {
+		if stdmime.TypeByExtension(ext) == "" {
+			_ = stdmime.AddExtensionType(ext, mimeType)
+		}
+	}
+}
+
+// Detector determines the MIME type of files from their name and the first SniffLen bytes of their
+// contents. It is safe for concurrent use.
+type Detector struct {
+	formats []Format
+}
+
+// NewDetector creates a Detector for formats. Earlier formats take precedence over later ones.
+func NewDetector(formats []Format) (*Detector, error) {
+	d := &Detector{formats: make([]Format, len(formats))}
+	for i, f := range formats {
+		f.Magic = append([]Magic(nil), f.Magic...)
+		if err := f.compile(); err != nil {
+			return nil, err
+		}
+		d.formats[i] = f
+	}
+
+	return d, nil
+}
+
+// Detect returns the MIME type of the file called name whose contents start with head. The head
+// can be empty when the contents aren't available yet, in which case only the name is used. The
+// type is chosen, in order, from:
+//
+//  1. a format whose magic bytes match head,
+//  2. a format whose name or extension matches name,
+//  3. sniffing head, when that gives something more specific than text, binary or a container
+//     such as zip,
+//  4. the extension of name,
+//  5. the sniffed type, such as text/plain for text, and application/octet-stream otherwise.
+func (d *Detector) Detect(name string, head []byte) string {
+	if len(head) > SniffLen {
+		head = head[:SniffLen]
+	}
+
+	if len(head) != 0 {
+		for i := range d.formats {
+			if d.formats[i].matchesContent(head) {
+				return d.formats[i].MimeType
+			}
+		}
+	}
+
+	for i := range d.formats {
+		if d.formats[i].matchesName(name) {
+			return d.formats[i].MimeType
+		}
+	}
+
+	sniffed := ""
+	if len(head) != 0 {
+		sniffed = mediaType(http.DetectContentType(head))
+		if sniffed != OctetStream && sniffed != TextPlain && !containerTypes[sniffed] {
+			return sniffed
+		}
+	}
+
+	if byExtension := mediaType(stdmime.TypeByExtension(filepath.Ext(name))); byExtension != "" {
+		return byExtension
+	}
+
+	if sniffed != "" {
+		return sniffed
+	}
+
+	return OctetStream
+}
+
+// DetectReader reads the start of r and detects the type of the file called name from it.
+func (d *Detector) DetectReader(name string, r io.Reader) (string, error) {
+	head := make([]byte, SniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	return d.Detect(name, head[:n]), nil
+}
+
+// DetectFile detects the type of the file at path. The name is used for the name and extension
+// rules, since uploads are often written to a path that doesn't have the file's name.
+func (d *Detector) DetectFile(name, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return d.DetectReader(name, f)
+}
+
+// Format returns the format with the MIME type mimeType.
+func (d *Detector) Format(mimeType string) (*Format, bool) {
+	for i := range d.formats {
+		if d.formats[i].MimeType == mimeType {
+			return &d.formats[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// mediaType strips any parameters, such as the charset, from a MIME type.
+func mediaType(mimeType string) string {
+	if semicolon := strings.Index(mimeType, ";"); semicolon != -1 {
+		mimeType = mimeType[:semicolon]
+	}
+
+	return strings.TrimSpace(mimeType)
+}
+
+var (
+	defaultDetector     *Detector
+	defaultDetectorOnce sync.Once
+)
+
+// Default returns the Detector for DefaultFormats, along with the formats in the file named by the
+// MC_MIME_FORMATS environment variable. The formats in the file take precedence. If the file can't
+// be loaded the error is logged and only DefaultFormats are used.
+func Default() *Detector {
+	defaultDetectorOnce.Do(func() {
+		formats := DefaultFormats
+		if path := os.Getenv("MC_MIME_FORMATS"); path != "" {
+			configured, err := LoadFormats(path)
+			if err != nil {
+				log.Errorf("Unable to load MIME formats from %s, using the defaults: %s", path, err)
+			} else {
+				formats = append(configured, DefaultFormats...)
+			}
+		}
+
+		var err error
+		if defaultDetector, err = NewDetector(formats); err != nil {
+			log.Errorf("Invalid MIME formats, using the defaults: %s", err)
+			defaultDetector, _ = NewDetector(DefaultFormats)
+		}
+	})
+
+	return defaultDetector
+}
+
+// Detect detects the type of a file using the Default Detector.
+func Detect(name string, head []byte) string {
+	return Default().Detect(name, head)
+}
+
+// DetectByName detects the type of a file from its name alone, using the Default Detector. It is for
+// when a file is created before its contents have been written, the type should be detected again
+// once they have.
+func DetectByName(name string) string {
+	return Default().Detect(name, nil)
+}
+
+// DetectReader detects the type of a file from the start of r using the Default Detector.
+func DetectReader(name string, r io.Reader) (string, error) {
+	return Default().DetectReader(name, r)
+}
+
+// DetectFile detects the type of the file at path using the Default Detector.
+func DetectFile(name, path string) (string, error) {
+	return Default().DetectFile(name, path)
+}
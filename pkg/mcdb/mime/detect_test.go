@@ -0,0 +1,89 @@
+package mime
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetect(t *testing.T) {
+	hdf5 := []byte("\x89HDF\r\n\x1a\n\x00\x00")
+	userBlockHDF5 := append(make([]byte, 512), hdf5...)
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	binary := []byte{0x00, 0x01, 0x02, 0xff, 0xfe}
+	zip := []byte("PK\x03\x04\x14\x00\x06\x00\x08\x00\x00\x00!\x00")
+
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		// Magic bytes win over the extension.
+		{"scan.dat", hdf5, "application/x-hdf5"},
+		{"scan", userBlockHDF5, "application/x-hdf5"},
+		{"stack", []byte("II*\x00\x08\x00\x00\x00"), "image/tiff"},
+		{"stack.raw", []byte("II+\x00\x08\x00\x00\x00"), "image/tiff"},
+		{"structure.txt", []byte("#\\#CIF_2.0\ndata_NaCl\n"), "chemical/x-cif"},
+
+		// Format names and extensions.
+		{"POSCAR", []byte("NaCl\n1.0\n5.6 0 0\n"), "chemical/x-vasp-poscar"},
+		{"run1/CONTCAR.relaxed", nil, "chemical/x-vasp-poscar"},
+		{"image.DM4", binary, "application/x-dm4"},
+		{"NaCl.cif", []byte("data_NaCl\n"), "chemical/x-cif"},
+		{"data.h5", nil, "application/x-hdf5"},
+
+		// Sniffing, then the extension, for everything else.
+		{"picture", png, "image/png"},
+		{"picture.dat", png, "image/png"},
+		{"doc.pdf", nil, "application/pdf"},
+		{"results.json", []byte(`{"a": 1}`), "application/json"},
+		{"spectrum.dat", []byte("1.0 2.0\n2.0 3.0\n"), TextPlain},
+		{"detector.frame", binary, OctetStream},
+
+		// Zip is only a container, so the extension says what's in it.
+		{"data.xlsx", zip, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		{"report.docx", zip, "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"archive", zip, "application/zip"},
+		{"README", []byte("Some notes"), TextPlain},
+		{"no-contents-yet", nil, OctetStream},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.want, Detect(test.name, test.head), test.name)
+	}
+}
+
+func TestConfiguredFormats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "formats.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"mime_type": "application/x-spe", "description": "SPE", "file_type": "binary",
+		 "extensions": [".spe"], "magic": [{"offset": 2, "hex": "cafe"}]}
+	]`), 0600))
+
+	formats, err := LoadFormats(path)
+	require.NoError(t, err)
+	d, err := NewDetector(append(formats, DefaultFormats...))
+	require.NoError(t, err)
+
+	require.Equal(t, "application/x-spe", d.Detect("frame.spe", nil))
+	require.Equal(t, "application/x-spe", d.Detect("frame", []byte{0, 0, 0xca, 0xfe}))
+	require.Equal(t, "chemical/x-cif", d.Detect("a.cif", nil))
+
+	head, err := d.DetectReader("frame", strings.NewReader("\x00\x00\xca\xfe"))
+	require.NoError(t, err)
+	require.Equal(t, "application/x-spe", head)
+
+	_, err = NewDetector([]Format{{MimeType: "x/bad", Magic: []Magic{{Hex: "zz"}}}})
+	require.Error(t, err)
+}
+
+func TestDescriptions(t *testing.T) {
+	require.Equal(t, "HDF5", Mime2Description("application/x-hdf5"))
+	require.Equal(t, "binary", Mime2FileType("application/x-hdf5"))
+	require.Equal(t, "Image", Mime2Description("image/tiff"))
+	require.Equal(t, "excel", Mime2FileType(Detect("data.xlsx", []byte("PK\x03\x04"))))
+	require.Equal(t, "Unknown", Mime2Description("application/x-unheard-of"))
+}
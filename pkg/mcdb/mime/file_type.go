@@ -52,6 +52,10 @@ func Mime2FileType(mimeStr string) string {
 		return fileType
 	}
 
+	if format, ok := Default().Format(mimeStr); ok && format.FileType != "" {
+		return format.FileType
+	}
+
 	return "unknown"
 }
 
@@ -61,6 +65,10 @@ func Mime2Description(mimeStr string) string {
 		return description
 	}
 
+	if format, ok := Default().Format(mimeStr); ok && format.Description != "" {
+		return format.Description
+	}
+
 	if strings.Contains(mimeStr, "video") {
 		return "Video"
 	}
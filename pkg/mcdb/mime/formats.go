@@ -0,0 +1,180 @@
+package mime
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Format describes a file format that the standard library doesn't know about, such as the
+// instrument and simulation formats used in materials science. Formats are matched by their magic
+// bytes first, and then by their file name or extension. The built-in formats can be extended, or
+// overridden, by a JSON file of Formats named by the MC_MIME_FORMATS environment variable.
+type Format struct {
+	// MimeType is the type stored for files of this format.
+	MimeType string `json:"mime_type"`
+
+	// Description is the name shown for the format, as returned by Mime2Description.
+	Description string `json:"description"`
+
+	// FileType is the kind of file, as returned by Mime2FileType.
+	FileType string `json:"file_type"`
+
+	// Extensions are the extensions, including the leading dot, files of this format have. They are
+	// matched case-insensitively.
+	Extensions []string `json:"extensions"`
+
+	// Names are file names, such as POSCAR, that identify the format regardless of extension.
+	Names []string `json:"names"`
+
+	// Magic are the signatures that identify the format from a file's contents. Any one of them
+	// matching is enough.
+	Magic []Magic `json:"magic"`
+}
+
+// Magic is a signature at a fixed offset in a file.
+type Magic struct {
+	Offset int `json:"offset"`
+
+	// Hex is the signature's bytes, hex encoded.
+	Hex string `json:"hex"`
+
+	bytes []byte
+}
+
+// matches returns true if head has the signature at its offset.
+func (m *Magic) matches(head []byte) bool {
+	end := m.Offset + len(m.bytes)
+	return len(m.bytes) != 0 && end <= len(head) && bytes.Equal(head[m.Offset:end], m.bytes)
+}
+
+func (f *Format) matchesContent(head []byte) bool {
+	for i := range f.Magic {
+		if f.Magic[i].matches(head) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *Format) matchesName(name string) bool {
+	base := filepath.Base(name)
+	for _, n := range f.Names {
+		// VASP appends a suffix to files such as POSCAR when running several calculations in one
+		// directory, e.g. POSCAR.relaxed.
+		if base == n || strings.HasPrefix(base, n+".") {
+			return true
+		}
+	}
+
+	ext := strings.ToLower(filepath.Ext(base))
+	for _, e := range f.Extensions {
+		if ext != "" && ext == strings.ToLower(e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compile decodes the format's magic.
+func (f *Format) compile() error {
+	if f.MimeType == "" {
+		return fmt.Errorf("format has no mime_type")
+	}
+
+	for i := range f.Magic {
+		b, err := hex.DecodeString(f.Magic[i].Hex)
+		if err != nil {
+			return fmt.Errorf("format %s has invalid magic %q: %w", f.MimeType, f.Magic[i].Hex, err)
+		}
+		f.Magic[i].bytes = b
+	}
+
+	return nil
+}
+
+// DefaultFormats are the formats known without any configuration.
+var DefaultFormats = []Format{
+	{
+		MimeType:    "application/x-hdf5",
+		Description: "HDF5",
+		FileType:    "binary",
+		Extensions:  []string{".h5", ".hdf5", ".he5", ".hdf", ".nxs"},
+		// The HDF5 signature is at offset 0, unless the file has a user block, in which case it's at
+		// the next power of two from 512.
+		Magic: []Magic{
+			{Offset: 0, Hex: "894844460d0a1a0a"},
+			{Offset: 512, Hex: "894844460d0a1a0a"},
+			{Offset: 1024, Hex: "894844460d0a1a0a"},
+			{Offset: 2048, Hex: "894844460d0a1a0a"},
+		},
+	},
+	{
+		MimeType:    "image/tiff",
+		Description: "Image",
+		FileType:    "image",
+		Extensions:  []string{".tif", ".tiff"},
+		// Classic TIFF, and BigTIFF which is used for large image stacks, in both byte orders.
+		Magic: []Magic{
+			{Offset: 0, Hex: "49492a00"},
+			{Offset: 0, Hex: "4d4d002a"},
+			{Offset: 0, Hex: "49492b00"},
+			{Offset: 0, Hex: "4d4d002b"},
+		},
+	},
+	{
+		// Gatan DigitalMicrograph images start with a big endian version number, which is too short to
+		// be a reliable signature, so they are only recognized by extension.
+		MimeType:    "application/x-dm3",
+		Description: "DigitalMicrograph",
+		FileType:    "image",
+		Extensions:  []string{".dm3"},
+	},
+	{
+		MimeType:    "application/x-dm4",
+		Description: "DigitalMicrograph",
+		FileType:    "image",
+		Extensions:  []string{".dm4"},
+	},
+	{
+		MimeType:    "chemical/x-cif",
+		Description: "CIF",
+		FileType:    "text",
+		Extensions:  []string{".cif", ".mcif"},
+		Magic:       []Magic{{Offset: 0, Hex: hex.EncodeToString([]byte("#\\#CIF_"))}},
+	},
+	{
+		MimeType:    "chemical/x-vasp-poscar",
+		Description: "VASP Structure",
+		FileType:    "text",
+		Extensions:  []string{".vasp", ".poscar"},
+		Names:       []string{"POSCAR", "CONTCAR"},
+	},
+	{
+		MimeType:    "chemical/x-xyz",
+		Description: "XYZ",
+		FileType:    "text",
+		Extensions:  []string{".xyz", ".extxyz"},
+	},
+}
+
+// LoadFormats reads a JSON array of Formats from path.
+func LoadFormats(path string) ([]Format, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var formats []Format
+	if err := json.Unmarshal(data, &formats); err != nil {
+		return nil, fmt.Errorf("unable to parse formats in %s: %w", path, err)
+	}
+
+	return formats, nil
+}
@@ -0,0 +1,130 @@
+package mcdb
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+)
+
+// selectionPattern is a compiled entry from FileSelection.Patterns. Patterns follow .gitignore rules:
+//
+//   - A leading "!" negates the pattern, files it matches are excluded rather than included.
+//   - A trailing "/" only matches directories, and so selects everything under them.
+//   - A pattern containing a "/" (other than a trailing one) is anchored to the project root. Without one
+//     it matches at any depth, so "*.csv" is the same as "**/*.csv".
+//   - "**" matches any number of directories, including none. Other segments are matched with path.Match,
+//     so "*", "?" and "[...]" don't cross a "/".
+//   - A pattern matching a directory also matches everything under it.
+type selectionPattern struct {
+	pattern  string
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+func compileSelectionPattern(pattern string) (*selectionPattern, error) {
+	p := &selectionPattern{pattern: pattern}
+
+	pattern = strings.TrimSpace(pattern)
+	if strings.HasPrefix(pattern, "!") {
+		p.negate = true
+		pattern = pattern[1:]
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		p.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+
+	if pattern == "" {
+		return nil, fmt.Errorf("invalid selection pattern %q: empty", p.pattern)
+	}
+
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+
+	p.segments = strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	for _, segment := range p.segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return nil, fmt.Errorf("invalid selection pattern %q: %w", p.pattern, err)
+		}
+	}
+
+	return p, nil
+}
+
+// matchesFile returns true if the pattern matches the file at filePath, or one of the directories it is in.
+func (p *selectionPattern) matchesFile(filePath string) bool {
+	segments := splitPath(filePath)
+	if !p.dirOnly && matchSegments(p.segments, segments) {
+		return true
+	}
+
+	return p.matchesAncestor(segments[:len(segments)-1])
+}
+
+// matchesDir returns true if the pattern matches the directory at dirPath, or one of the directories it is in.
+func (p *selectionPattern) matchesDir(dirPath string) bool {
+	return p.matchesAncestor(splitPath(dirPath))
+}
+
+// matchesAncestor returns true if the pattern matches the directory made up of segments, or any directory
+// above it.
+func (p *selectionPattern) matchesAncestor(segments []string) bool {
+	for i := len(segments); i > 0; i-- {
+		if matchSegments(p.segments, segments[:i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchSegments matches a path, split into its segments, against pattern segments.
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+
+	return strings.Split(p, "/")
+}
+
+// ValidateFileSelection returns an error describing the first invalid pattern in fs.
+func ValidateFileSelection(fs *mcmodel.FileSelection) error {
+	for _, pattern := range fs.Patterns {
+		if _, err := compileSelectionPattern(pattern); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -2,6 +2,45 @@ package stor
 
 import (
 	"fmt"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 )
 
 var ErrNotImplemented = fmt.Errorf("not implemented")
+
+// ErrAlreadyExists is returned when an operation would replace an entry that can't be replaced.
+var ErrAlreadyExists = fmt.Errorf("already exists")
+
+// ErrInvalidMove is returned for moves that can't be done, such as moving a directory into itself
+// or moving between projects.
+var ErrInvalidMove = fmt.Errorf("invalid move")
+
+// ErrNotEmpty is returned when a non-recursive delete is attempted on a directory that has entries.
+var ErrNotEmpty = fmt.Errorf("directory not empty")
+
+// ErrNotInTrash is returned when restoring or purging a file that hasn't been deleted.
+var ErrNotInTrash = fmt.Errorf("not in trash")
+
+// ErrRootDirectory is returned for operations that can't be performed on a project's root directory.
+var ErrRootDirectory = fmt.Errorf("not allowed on the root directory")
+
+// ErrInvalidAPITokenScope is returned when creating an API token with an unknown scope.
+var ErrInvalidAPITokenScope = fmt.Errorf("invalid api token scope")
+
+// ErrQuotaExceeded is matched by a QuotaExceededError.
+var ErrQuotaExceeded = fmt.Errorf("storage quota exceeded")
+
+// QuotaExceededError is returned when a write would take a project or user over its storage quota.
+type QuotaExceededError struct {
+	Usage          mcmodel.QuotaUsage
+	RequestedBytes int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s %d storage quota exceeded: %d of %d bytes used, %d bytes requested",
+		e.Usage.Scope, e.Usage.ID, e.Usage.UsedBytes, e.Usage.LimitBytes, e.RequestedBytes)
+}
+
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
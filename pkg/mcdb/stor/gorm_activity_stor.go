@@ -25,7 +25,7 @@ func (s *GormActivityStor) GetProjectActivityByID(projectID int, activityID int)
 	}
 
 	if activity.ProjectID != projectID {
-		return nil, fmt.Errorf("activity %d not found for project %d", activityID, projectID)
+		return nil, fmt.Errorf("activity %d not found for project %d: %w", activityID, projectID, gorm.ErrRecordNotFound)
 	}
 
 	return &activity, err
@@ -47,3 +47,12 @@ func (s *GormActivityStor) CreateActivity(activity *mcmodel.Activity) (*mcmodel.
 
 	return activity, nil
 }
+
+// ListActivityEntities returns the entities (samples) the activity was performed on, ordered by id.
+func (s *GormActivityStor) ListActivityEntities(activityID int) ([]mcmodel.Entity, error) {
+	var entities []mcmodel.Entity
+	err := s.db.Where("id IN (?)", s.db.Model(&mcmodel.Activity2Entity{}).Select("entity_id").Where("activity_id = ?", activityID)).
+		Order("id").
+		Find(&entities).Error
+	return entities, err
+}
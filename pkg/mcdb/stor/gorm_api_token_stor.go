@@ -0,0 +1,97 @@
+package stor
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"gorm.io/gorm"
+)
+
+type GormAPITokenStor struct {
+	db *gorm.DB
+}
+
+func NewGormAPITokenStor(db *gorm.DB) *GormAPITokenStor {
+	return &GormAPITokenStor{db: db}
+}
+
+// CreateAPIToken creates token, generating its secret. The secret is returned, only its hash is stored,
+// so it can't be retrieved later.
+func (s *GormAPITokenStor) CreateAPIToken(token *mcmodel.APIToken) (string, *mcmodel.APIToken, error) {
+	if !mcmodel.ValidAPITokenScope(token.Scope) {
+		return "", nil, fmt.Errorf("%w: %q", ErrInvalidAPITokenScope, token.Scope)
+	}
+
+	var err error
+	if token.UUID, err = uuid.GenerateUUID(); err != nil {
+		return "", nil, err
+	}
+
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", nil, err
+	}
+
+	secret := mcmodel.APITokenPrefix + base64.RawURLEncoding.EncodeToString(randomBytes)
+	token.SecretHash = mcmodel.HashAPITokenSecret(secret)
+
+	err = WithTxRetry(s.db, func(tx *gorm.DB) error {
+		return tx.Create(token).Error
+	})
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	return secret, token, nil
+}
+
+// GetAPITokenBySecret returns the token, with its user, whose secret is secret. Expired and revoked
+// tokens are returned too, it's up to the caller to reject them.
+func (s *GormAPITokenStor) GetAPITokenBySecret(secret string) (*mcmodel.APIToken, error) {
+	var token mcmodel.APIToken
+	err := s.db.Preload("User").
+		Where("secret_hash = ?", mcmodel.HashAPITokenSecret(secret)).
+		First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// ListAPITokensForUser returns all the user's tokens, including expired and revoked ones.
+func (s *GormAPITokenStor) ListAPITokensForUser(userID int) ([]mcmodel.APIToken, error) {
+	var tokens []mcmodel.APIToken
+	err := s.db.Where("user_id = ?", userID).Order("id").Find(&tokens).Error
+	return tokens, err
+}
+
+// RevokeAPIToken revokes one of the user's tokens. Revoking a token that is already revoked leaves it
+// unchanged.
+func (s *GormAPITokenStor) RevokeAPIToken(userID, tokenID int) (*mcmodel.APIToken, error) {
+	var token mcmodel.APIToken
+	err := WithTxRetry(s.db, func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND user_id = ?", tokenID, userID).First(&token).Error; err != nil {
+			return err
+		}
+
+		if token.IsRevoked() {
+			return nil
+		}
+
+		now := time.Now()
+		token.RevokedAt = &now
+		return tx.Model(&token).Update("revoked_at", now).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
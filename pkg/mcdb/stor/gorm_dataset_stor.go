@@ -0,0 +1,146 @@
+package stor
+
+import (
+	"sort"
+
+	"github.com/materials-commons/hydra/pkg/mcdb"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"gorm.io/gorm"
+)
+
+type GormDatasetStor struct {
+	db *gorm.DB
+}
+
+func NewGormDatasetStor(db *gorm.DB) *GormDatasetStor {
+	return &GormDatasetStor{db: db}
+}
+
+func (s *GormDatasetStor) GetDatasetByID(datasetID int) (*mcmodel.Dataset, error) {
+	var dataset mcmodel.Dataset
+	if err := s.db.First(&dataset, datasetID).Error; err != nil {
+		return nil, err
+	}
+
+	return &dataset, nil
+}
+
+// GetDatasetProject returns the project the dataset is in, with its Owner preloaded.
+func (s *GormDatasetStor) GetDatasetProject(dataset *mcmodel.Dataset) (*mcmodel.Project, error) {
+	var project mcmodel.Project
+	if err := s.db.Preload("Owner").First(&project, dataset.ProjectID).Error; err != nil {
+		return nil, err
+	}
+
+	return &project, nil
+}
+
+// ListSelectedFiles returns the current files in the dataset's project that its file selection (including
+// files coming from the entity template) puts in the dataset. Files are preloaded with their Directory, and
+// are sorted by their full path.
+func (s *GormDatasetStor) ListSelectedFiles(dataset *mcmodel.Dataset) ([]mcmodel.File, error) {
+	selector := mcdb.NewDatasetFileSelector(*dataset)
+	if err := selector.LoadEntityFiles(s.db); err != nil {
+		return nil, err
+	}
+
+	var (
+		batch    []mcmodel.File
+		selected []mcmodel.File
+	)
+
+	err := s.db.Preload("Directory").
+		Where("project_id = ?", dataset.ProjectID).
+		Where("mime_type <> ?", "directory").
+		Where("current = ?", true).
+		Where("deleted_at IS NULL").
+		Where("dataset_id IS NULL").
+		FindInBatches(&batch, 1000, func(tx *gorm.DB, _ int) error {
+			for _, file := range batch {
+				if file.Directory != nil && selector.IsIncludedFile(file.FullPath()) {
+					selected = append(selected, file)
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].FullPath() < selected[j].FullPath()
+	})
+
+	return selected, nil
+}
+
+// ListDatasetEntities returns the entities selected by the dataset's entity template, ordered by id. Each
+// entity is preloaded with its files and its states, along with the states' attributes and their values.
+func (s *GormDatasetStor) ListDatasetEntities(dataset *mcmodel.Dataset) ([]mcmodel.Entity, error) {
+	selected, err := dataset.GetEntitiesFromTemplate(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(selected) == 0 {
+		return []mcmodel.Entity{}, nil
+	}
+
+	ids := make([]int, 0, len(selected))
+	for _, entity := range selected {
+		ids = append(ids, entity.ID)
+	}
+
+	var entities []mcmodel.Entity
+	err = s.db.Preload("Files.Directory").
+		Preload("EntityStates", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("EntityStates.Attributes", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("EntityStates.Attributes.AttributeValues", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("id IN ?", ids).
+		Order("id").
+		Find(&entities).Error
+	return entities, err
+}
+
+// ListActivitiesForEntities returns the activities performed on any of the entities, ordered by id and
+// preloaded with their attributes and the attribute values. The map gives the ids of the entities in
+// entityIDs each activity was performed on.
+func (s *GormDatasetStor) ListActivitiesForEntities(entityIDs []int) ([]mcmodel.Activity, map[int][]int, error) {
+	activityEntities := make(map[int][]int)
+	if len(entityIDs) == 0 {
+		return []mcmodel.Activity{}, activityEntities, nil
+	}
+
+	var links []mcmodel.Activity2Entity
+	err := s.db.Where("entity_id IN ?", entityIDs).
+		Order("activity_id").
+		Order("entity_id").
+		Find(&links).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(links) == 0 {
+		return []mcmodel.Activity{}, activityEntities, nil
+	}
+
+	activityIDs := make([]int, 0, len(links))
+	for _, link := range links {
+		if _, ok := activityEntities[link.ActivityID]; !ok {
+			activityIDs = append(activityIDs, link.ActivityID)
+		}
+		activityEntities[link.ActivityID] = append(activityEntities[link.ActivityID], link.EntityID)
+	}
+
+	var activities []mcmodel.Activity
+	err = s.db.Preload("Attributes", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Attributes.AttributeValues", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("id IN ?", activityIDs).
+		Order("id").
+		Find(&activities).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return activities, activityEntities, nil
+}
@@ -0,0 +1,36 @@
+package stor
+
+import (
+	"testing"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListSelectedFiles(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	user := b.User("user1")
+	proj := b.Project("proj1", user)
+	raw := b.Dir(proj, proj.RootDir, "raw")
+	run1 := b.Dir(proj, raw, "run-1")
+	b.File(proj, raw, "a.csv", 1)
+	b.File(proj, run1, "b.csv", 2)
+	b.File(proj, run1, "b.tmp", 3)
+	b.File(proj, proj.RootDir, "notes.txt", 4)
+
+	ds := b.Dataset(proj, "ds")
+	require.NoError(t, db.Model(ds).Update("file_selection", `{"patterns": ["raw/run-*/", "**/*.csv", "!*.tmp"]}`).Error)
+
+	datasetStor := NewGormDatasetStor(db)
+	dataset, err := datasetStor.GetDatasetByID(ds.ID)
+	require.NoError(t, err)
+
+	files, err := datasetStor.ListSelectedFiles(dataset)
+	require.NoError(t, err)
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.FullPath())
+	}
+	require.Equal(t, []string{"/raw/a.csv", "/raw/run-1/b.csv"}, paths)
+}
@@ -24,7 +24,7 @@ func (s *GormEntityStor) GetProjectEntityByID(projectID int, entityID int) (*mcm
 	}
 
 	if entity.ProjectID != projectID {
-		return nil, fmt.Errorf("entity %d not found for project %d", entityID, projectID)
+		return nil, fmt.Errorf("entity %d not found for project %d: %w", entityID, projectID, gorm.ErrRecordNotFound)
 	}
 
 	return &entity, nil
@@ -33,7 +33,7 @@ func (s *GormEntityStor) GetProjectEntityByID(projectID int, entityID int) (*mcm
 func (s *GormEntityStor) ListProjectEntitiesByCategory(projectID int, category string) ([]mcmodel.Entity, error) {
 	var entities []mcmodel.Entity
 	err := s.db.Where("project_id = ? AND category = ?", projectID, category).Find(&entities).Error
-	return nil, err
+	return entities, err
 }
 
 func (s *GormEntityStor) CreateEntity(entity *mcmodel.Entity) (*mcmodel.Entity, error) {
@@ -49,3 +49,32 @@ func (s *GormEntityStor) CreateEntity(entity *mcmodel.Entity) (*mcmodel.Entity,
 
 	return entity, err
 }
+
+// ListEntityActivities returns the activities (processes) performed on the entity, ordered by id.
+func (s *GormEntityStor) ListEntityActivities(entityID int) ([]mcmodel.Activity, error) {
+	var activities []mcmodel.Activity
+	err := s.db.Where("id IN (?)", s.db.Model(&mcmodel.Activity2Entity{}).Select("activity_id").Where("entity_id = ?", entityID)).
+		Order("id").
+		Find(&activities).Error
+	return activities, err
+}
+
+// ListEntityFiles returns the files attached to the entity, ordered by id and preloaded with their
+// directory.
+func (s *GormEntityStor) ListEntityFiles(entityID int) ([]mcmodel.File, error) {
+	var files []mcmodel.File
+	err := s.db.Preload("Directory").
+		Where("id IN (?)", s.db.Table("entity2file").Select("file_id").Where("entity_id = ?", entityID)).
+		Order("id").
+		Find(&files).Error
+	return files, err
+}
+
+// ListFileEntities returns the entities the file is attached to, ordered by id.
+func (s *GormEntityStor) ListFileEntities(fileID int) ([]mcmodel.Entity, error) {
+	var entities []mcmodel.Entity
+	err := s.db.Where("id IN (?)", s.db.Table("entity2file").Select("entity_id").Where("file_id = ?", fileID)).
+		Order("id").
+		Find(&entities).Error
+	return entities, err
+}
@@ -2,30 +2,48 @@ package stor
 
 import (
 	"errors"
-	"os"
+	"fmt"
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/apex/log"
 	"github.com/hashicorp/go-uuid"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/mime"
 	"gorm.io/gorm"
 )
 
 type GormFileStor struct {
 	db       *gorm.DB
 	mcfsRoot string
+	blobs    blobstore.BlobStore
 }
 
+// NewGormFileStor creates a GormFileStor whose file contents are kept on the local filesystem
+// under mcfsRoot.
 func NewGormFileStor(db *gorm.DB, mcfsRoot string) *GormFileStor {
-	return &GormFileStor{db: db, mcfsRoot: mcfsRoot}
+	return NewGormFileStorWithBlobStore(db, mcfsRoot, blobstore.NewLocalBlobStore(mcfsRoot))
+}
+
+// NewGormFileStorWithBlobStore creates a GormFileStor that uses the given blob store. Commands
+// create the blob store once, usually with blobstore.MustFromEnv, and share it.
+func NewGormFileStorWithBlobStore(db *gorm.DB, mcfsRoot string, blobs blobstore.BlobStore) *GormFileStor {
+	return &GormFileStor{db: db, mcfsRoot: mcfsRoot, blobs: blobs}
 }
 
 func (s *GormFileStor) Root() string {
 	return s.mcfsRoot
 }
 
+// Blobs returns the store that holds the contents of files.
+func (s *GormFileStor) Blobs() blobstore.BlobStore {
+	return s.blobs
+}
+
 func (s *GormFileStor) GetFileByID(fileID int) (*mcmodel.File, error) {
 	var file mcmodel.File
 	if err := s.db.Find(&file, fileID).Error; err != nil {
@@ -45,13 +63,17 @@ func (s *GormFileStor) GetFileByUUID(fileUUID string) (*mcmodel.File, error) {
 }
 
 // UpdateMetadataForFileAndProject updates the metadata and project meta data for a file
-func (s *GormFileStor) UpdateMetadataForFileAndProject(file *mcmodel.File, checksum string, totalBytes int64) error {
-	finfo, err := os.Stat(file.ToUnderlyingFilePath(s.mcfsRoot))
+func (s *GormFileStor) UpdateMetadataForFileAndProject(file *mcmodel.File, sums digest.Sums, totalBytes int64) error {
+	finfo, err := s.blobs.Stat(file.BlobKey())
 	if err != nil {
-		log.Errorf("UpdateMetadataForFileAndProject Stat %s failed: %s", file.ToUnderlyingFilePath(s.mcfsRoot), err)
+		log.Errorf("UpdateMetadataForFileAndProject Stat %s failed: %s", file.BlobKey(), err)
 		return err
 	}
 
+	// Files are created before their contents are written, so their type was only detected from their
+	// name. Now that the contents are available they are used too.
+	mimeType := detectMimeType(s.blobs, file)
+
 	return WithTxRetry(s.db, func(tx *gorm.DB) error {
 		// To set file as the current (ie viewable) version we first need to set all its previous
 		// versions to have current set to false.
@@ -67,17 +89,23 @@ func (s *GormFileStor) UpdateMetadataForFileAndProject(file *mcmodel.File, check
 		}
 
 		// Now we can update the metadata on the current file. This includes, the size, current, and if there is
-		// a new computed checksum, also update the checksum field.
+		// new computed checksums, also update the checksum fields.
 		fileMetadata := mcmodel.File{
-			Size:     uint64(finfo.Size()),
+			Size:     uint64(finfo.Size),
 			Current:  true,
-			Checksum: checksum,
+			Checksum: sums.MD5,
+			Sha256:   sums.SHA256,
+			MimeType: mimeType,
 		}
 
 		if err := tx.Model(file).Updates(&fileMetadata).Error; err != nil {
 			return err
 		}
 
+		if mimeType != "" {
+			file.MimeType = mimeType
+		}
+
 		var project mcmodel.Project
 
 		if result := tx.Find(&project, file.ProjectID); result.Error != nil {
@@ -88,6 +116,25 @@ func (s *GormFileStor) UpdateMetadataForFileAndProject(file *mcmodel.File, check
 	})
 }
 
+// detectMimeType detects the type of file from its name and the start of its blob. It returns an empty
+// string when the blob can't be read, which leaves the file's type as it is.
+func detectMimeType(blobs blobstore.BlobStore, file *mcmodel.File) string {
+	r, err := blobs.Open(file.BlobKey(), 0)
+	if err != nil {
+		log.Errorf("Unable to open %s to detect its type: %s", file.BlobKey(), err)
+		return ""
+	}
+	defer r.Close()
+
+	mimeType, err := mime.DetectReader(file.Name, r)
+	if err != nil {
+		log.Errorf("Unable to read %s to detect its type: %s", file.BlobKey(), err)
+		return ""
+	}
+
+	return mimeType
+}
+
 func (s *GormFileStor) UpdateFile(file, updates *mcmodel.File) (*mcmodel.File, error) {
 	err := WithTxRetry(s.db, func(tx *gorm.DB) error {
 		return tx.Model(file).Updates(updates).Error
@@ -377,7 +424,7 @@ func (s *GormFileStor) PointAtExistingIfExists(file *mcmodel.File) (bool, error)
 	switched := false // Set to true in withTxRetry if an existing file with same checksum is found
 	err := WithTxRetry(s.db, func(tx *gorm.DB) error {
 		var matched mcmodel.File
-		err := tx.Where("checksum = ?", file.Checksum).
+		err := whereSameContents(tx, file.Sums()).
 			Where("deleted_at IS NULL").
 			Where("dataset_id IS NULL").
 			Where("id <> ?", file.ID).
@@ -401,13 +448,13 @@ func (s *GormFileStor) PointAtExistingIfExists(file *mcmodel.File) (bool, error)
 // DoneWritingToFile is called when a file has been opened for writing and the caller is finished writing to it.
 // It consolidates common steps such as updating metadata, switching to point to a file that already exists with
 // the same checksum, and queuing the file for conversion (if needed).
-func (s *GormFileStor) DoneWritingToFile(file *mcmodel.File, checksum string, size int64, conversionStore ConversionStor) (bool, error) {
+func (s *GormFileStor) DoneWritingToFile(file *mcmodel.File, sums digest.Sums, size int64, conversionStore ConversionStor) (bool, error) {
 	var (
 		fileSwitched = false
 		err          error
 	)
 
-	if err = s.UpdateMetadataForFileAndProject(file, checksum, size); err != nil {
+	if err = s.UpdateMetadataForFileAndProject(file, sums, size); err != nil {
 		log.Errorf("failure updating file (%d) and project (%d) metadata: %s", file.ID, file.ProjectID, err)
 		return false, err
 	}
@@ -428,11 +475,11 @@ func (s *GormFileStor) DoneWritingToFile(file *mcmodel.File, checksum string, si
 	return fileSwitched, nil
 }
 
-func (s *GormFileStor) GetMatchingFileInDirectory(directoryID int, checksum string, name string) (*mcmodel.File, error) {
+func (s *GormFileStor) GetMatchingFileInDirectory(directoryID int, sums digest.Sums, name string) (*mcmodel.File, error) {
 	var file mcmodel.File
-	err := s.db.Where("directory_id = ?", directoryID).
+	err := whereSameContents(s.db, sums).
+		Where("directory_id = ?", directoryID).
 		Where("name = ?", name).
-		Where("checksum = ?", checksum).
 		Where("deleted_at IS NULL").
 		Where("dataset_id IS NULL").
 		First(&file).Error
@@ -482,16 +529,19 @@ func (s *GormFileStor) SetFileHealthMissing(file *mcmodel.File, determinedBy str
 	return file, err
 }
 
+// SetFileHealthFixed marks file, and the files that use its blob, as fixed. The returned file has the new
+// health, including when it was fixed in HealthFixedAt.
 func (s *GormFileStor) SetFileHealthFixed(file *mcmodel.File, fixedBy string, source string) (*mcmodel.File, error) {
 	if source == "" {
 		source = file.UploadSource
 	}
+	fixedAt := time.Now()
 	err := WithTxRetry(s.db, func(tx *gorm.DB) error {
 		err := tx.Model(file).
 			Updates(map[string]interface{}{
 				"health":                     "fixed",
 				"health_fixed_by":            fixedBy,
-				"health_fixed_at":            time.Now(),
+				"health_fixed_at":            fixedAt,
 				"file_missing_at":            gorm.Expr("NULL"),
 				"file_missing_determined_by": gorm.Expr("NULL"),
 				"upload_source":              source,
@@ -507,7 +557,7 @@ func (s *GormFileStor) SetFileHealthFixed(file *mcmodel.File, fixedBy string, so
 			Updates(map[string]interface{}{
 				"health":                     "fixed",
 				"health_fixed_by":            fixedBy,
-				"health_fixed_at":            time.Now(),
+				"health_fixed_at":            fixedAt,
 				"file_missing_at":            gorm.Expr("NULL"),
 				"file_missing_determined_by": gorm.Expr("NULL"),
 			}).Error
@@ -519,10 +569,19 @@ func (s *GormFileStor) SetFileHealthFixed(file *mcmodel.File, fixedBy string, so
 		return err
 	})
 
+	if err == nil {
+		file.Health = "fixed"
+		file.HealthFixedBy = fixedBy
+		file.HealthFixedAt = fixedAt
+		file.FileMissingAt = time.Time{}
+		file.FileMissingDeterminedBy = ""
+		file.UploadSource = source
+	}
+
 	return file, err
 }
 
-func (s *GormFileStor) FindMatchingFileByChecksumAndPath(projectID int, filePath string, checksum string) (*mcmodel.File, error) {
+func (s *GormFileStor) FindMatchingFileByChecksumAndPath(projectID int, filePath string, sums digest.Sums) (*mcmodel.File, error) {
 	dirPath := filepath.Dir(filePath)
 	dir, err := s.GetDirByPath(projectID, dirPath)
 	if err != nil {
@@ -531,7 +590,7 @@ func (s *GormFileStor) FindMatchingFileByChecksumAndPath(projectID int, filePath
 
 	var file mcmodel.File
 	fileName := filepath.Base(filePath)
-	err = s.db.Where("checksum = ?", checksum).
+	err = whereSameContents(s.db, sums).
 		Where("directory_id = ?", dir.ID).
 		Where("name = ?", fileName).
 		Where("deleted_at IS NULL").
@@ -545,9 +604,9 @@ func (s *GormFileStor) FindMatchingFileByChecksumAndPath(projectID int, filePath
 	return &file, nil
 }
 
-func (s *GormFileStor) FindMatchingFileByChecksum(checksum string) (*mcmodel.File, error) {
+func (s *GormFileStor) FindMatchingFileByChecksum(sums digest.Sums) (*mcmodel.File, error) {
 	var file mcmodel.File
-	err := s.db.Where("checksum = ?", checksum).
+	err := whereSameContents(s.db, sums).
 		Where("deleted_at IS NULL").
 		Where("dataset_id IS NULL").
 		First(&file).Error
@@ -559,8 +618,901 @@ func (s *GormFileStor) FindMatchingFileByChecksum(checksum string) (*mcmodel.Fil
 	return &file, nil
 }
 
+// whereSameContents limits a query to the files whose contents have the checksums in sums. When sums has a
+// SHA-256, files that also have one must match it, and only files without one fall back to matching on the
+// MD5. Files matching on the SHA-256 are returned first. When sums has no checksums nothing matches.
+func whereSameContents(db *gorm.DB, sums digest.Sums) *gorm.DB {
+	switch {
+	case sums.SHA256 == "" && sums.MD5 == "":
+		return db.Where("1 = 0")
+	case sums.SHA256 == "":
+		return db.Where("checksum = ?", sums.MD5)
+	case sums.MD5 == "":
+		return db.Where("sha256 = ?", sums.SHA256)
+	default:
+		// Any file here with a SHA-256 matched on it, so those sort first.
+		return db.Where("sha256 = ? OR (checksum = ? AND (sha256 IS NULL OR sha256 = ''))", sums.SHA256, sums.MD5).
+			Order("CASE WHEN sha256 IS NULL OR sha256 = '' THEN 1 ELSE 0 END")
+	}
+}
+
+// ListFilesMissingSha256 returns up to limit files, ordered by id and with an id greater than afterID, that
+// have contents but no SHA-256 recorded. When projectID is 0 files in all projects are returned. Deleted
+// files are left out, and so are files that are still being uploaded: only the current version of a file,
+// or an older version that has a checksum because its upload finished, is returned.
+func (s *GormFileStor) ListFilesMissingSha256(projectID, afterID, limit int) ([]mcmodel.File, error) {
+	var files []mcmodel.File
+	query := s.db.Where("id > ?", afterID).
+		Where("mime_type <> ?", "directory").
+		Where("deleted_at IS NULL").
+		Where("current = ? OR (checksum IS NOT NULL AND checksum <> '')", true).
+		Where("sha256 IS NULL OR sha256 = ''")
+	if projectID != 0 {
+		query = query.Where("project_id = ?", projectID)
+	}
+
+	err := query.Order("id").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+// SetFileSha256 records the SHA-256 for file. Every other file that shares its blob, through uses_uuid, and
+// doesn't have a SHA-256 yet gets the same value.
+func (s *GormFileStor) SetFileSha256(file *mcmodel.File, sha256 string) error {
+	usesUUID := file.UUIDForUses()
+	err := WithTxRetry(s.db, func(tx *gorm.DB) error {
+		return tx.Model(&mcmodel.File{}).
+			Where("id = ? OR uuid = ? OR uses_uuid = ?", file.ID, usesUUID, usesUUID).
+			Where("sha256 IS NULL OR sha256 = ''").
+			Update("sha256", sha256).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	file.Sha256 = sha256
+	return nil
+}
+
+// SetFileMimeType sets the type of file. Unlike SetFileSha256 files sharing its blob are left alone, since
+// their names, which the type also depends on, can differ.
+func (s *GormFileStor) SetFileMimeType(file *mcmodel.File, mimeType string) error {
+	err := WithTxRetry(s.db, func(tx *gorm.DB) error {
+		return tx.Model(&mcmodel.File{}).
+			Where("id = ?", file.ID).
+			Where("mime_type <> ?", "directory").
+			Update("mime_type", mimeType).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	file.MimeType = mimeType
+	return nil
+}
+
 func (s *GormFileStor) DeleteFileByID(ID int) error {
 	return WithTxRetry(s.db, func(tx *gorm.DB) error {
 		return tx.Delete(&mcmodel.File{}, ID).Error
 	})
 }
+
+// FindReferencedUUIDs returns the subset of uuids that a row in the files table still points at, either
+// directly or through uses_uuid. Soft deleted and dataset rows are included on purpose, their blobs are
+// still needed for restores and published datasets.
+func (s *GormFileStor) FindReferencedUUIDs(uuids []string) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	if len(uuids) == 0 {
+		return referenced, nil
+	}
+
+	var rows []struct {
+		UUID     string
+		UsesUUID string
+	}
+
+	err := s.db.Model(&mcmodel.File{}).
+		Select("uuid", "uses_uuid").
+		Where("uuid IN ? OR uses_uuid IN ?", uuids, uuids).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		referenced[row.UUID] = true
+		if row.UsesUUID != "" {
+			referenced[row.UsesUUID] = true
+		}
+	}
+
+	return referenced, nil
+}
+
+// ListFilesAfterID returns up to limit files (not directories), in ID order, whose ID is greater than afterID.
+// All versions are returned, not just the current one. A projectID of 0 lists files across all projects. This
+// is meant for jobs that page through the whole files table and need to be able to pick up where they left off.
+func (s *GormFileStor) ListFilesAfterID(projectID, afterID, limit int) ([]mcmodel.File, error) {
+	var files []mcmodel.File
+
+	query := s.db.Where("id > ?", afterID).
+		Where("mime_type <> ?", "directory").
+		Where("deleted_at IS NULL").
+		Where("dataset_id IS NULL")
+
+	if projectID != 0 {
+		query = query.Where("project_id = ?", projectID)
+	}
+
+	err := query.Order("id").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+// MoveFile moves file, along with all of its previous versions, into toDir and gives it the name name. When
+// toDir already has a file called name, those files become previous versions of the moved file, which is how
+// an upload of a new version behaves. ErrAlreadyExists is returned if toDir has a directory called name.
+// Files can only be moved within a project.
+func (s *GormFileStor) MoveFile(file, toDir *mcmodel.File, name string) (*mcmodel.File, error) {
+	if !file.IsFile() || !toDir.IsDir() || file.ProjectID != toDir.ProjectID || name == "" {
+		return nil, ErrInvalidMove
+	}
+
+	if file.DirectoryID == toDir.ID && file.Name == name {
+		return file, nil
+	}
+
+	err := WithTxRetry(s.db, func(tx *gorm.DB) error {
+		var existing []mcmodel.File
+		err := tx.Where("directory_id = ?", toDir.ID).
+			Where("name = ?", name).
+			Where("deleted_at IS NULL").
+			Where("dataset_id IS NULL").
+			Find(&existing).Error
+		if err != nil {
+			return err
+		}
+
+		var existingIDs []int
+		replaced := make(map[string]int)
+		replacedCount := 0
+		for _, f := range existing {
+			if f.IsDir() {
+				return ErrAlreadyExists
+			}
+			existingIDs = append(existingIDs, f.ID)
+			if f.Current {
+				replaced[f.MimeType]--
+				replacedCount++
+			}
+		}
+
+		if len(existingIDs) != 0 {
+			if err := tx.Model(&mcmodel.File{}).Where("id IN ?", existingIDs).Update("current", false).Error; err != nil {
+				return err
+			}
+		}
+
+		// The files that were current are now previous versions, so they no longer count as project files.
+		if replacedCount != 0 {
+			if err := adjustProjectCounts(tx, file.ProjectID, 0, -replacedCount, 0); err != nil {
+				return err
+			}
+
+			if err := adjustProjectFileTypes(tx, file.ProjectID, replaced); err != nil {
+				return err
+			}
+		}
+
+		versions := tx.Model(&mcmodel.File{}).
+			Where("directory_id = ?", file.DirectoryID).
+			Where("name = ?", file.Name).
+			Where("deleted_at IS NULL").
+			Where("dataset_id IS NULL")
+		if err := versions.Updates(map[string]interface{}{"directory_id": toDir.ID, "name": name}).Error; err != nil {
+			return err
+		}
+
+		// Files don't usually carry a path, but if any of the versions do then keep it accurate.
+		return tx.Model(&mcmodel.File{}).
+			Where("directory_id = ?", toDir.ID).
+			Where("name = ?", name).
+			Where("path IS NOT NULL").
+			Where("path <> ''").
+			Where("id NOT IN ?", append(existingIDs, 0)).
+			Update("path", filepath.Join(toDir.Path, name)).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetFileByID(file.ID)
+}
+
+// MoveDirectory moves dir, and everything under it, into toParent and gives it the name name. The path of every
+// entry in the subtree is rewritten in the same transaction. When toParent already has an empty directory called
+// name that directory is replaced (and the project directory count is reduced by one), otherwise an existing entry
+// called name causes ErrAlreadyExists. Directories can only be moved within a project, and can't be moved into
+// themselves.
+func (s *GormFileStor) MoveDirectory(dir, toParent *mcmodel.File, name string) (*mcmodel.File, error) {
+	if !dir.IsDir() || !toParent.IsDir() || dir.ProjectID != toParent.ProjectID || dir.Path == "/" || name == "" {
+		return nil, ErrInvalidMove
+	}
+
+	oldPath := dir.Path
+	newPath := filepath.Join(toParent.Path, name)
+
+	if newPath == oldPath {
+		return dir, nil
+	}
+
+	if toParent.Path == oldPath || strings.HasPrefix(toParent.Path, oldPath+"/") {
+		return nil, ErrInvalidMove
+	}
+
+	err := WithTxRetry(s.db, func(tx *gorm.DB) error {
+		if err := s.replaceEmptyDirectory(tx, toParent, name); err != nil {
+			return err
+		}
+
+		err := tx.Model(&mcmodel.File{ID: dir.ID}).Updates(map[string]interface{}{
+			"directory_id": toParent.ID,
+			"name":         name,
+			"path":         newPath,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		// Rewrite the path for everything under the directory. SUBSTR is used rather than LIKE so that
+		// paths containing % or _ don't need escaping. Deleted entries are left alone, their path is
+		// recomputed from their parent when they are restored.
+		prefix := oldPath + "/"
+		var entries []mcmodel.File
+		err = tx.Select("id", "path").
+			Where("project_id = ?", dir.ProjectID).
+			Where("deleted_at IS NULL").
+			Where("dataset_id IS NULL").
+			Where("SUBSTR(path, 1, ?) = ?", utf8.RuneCountInString(prefix), prefix).
+			Find(&entries).Error
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			entryPath := newPath + "/" + strings.TrimPrefix(entry.Path, prefix)
+			if err := tx.Model(&mcmodel.File{ID: entry.ID}).Update("path", entryPath).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetFileByID(dir.ID)
+}
+
+// replaceEmptyDirectory checks if parent has an entry called name. If the entry is an empty directory it is
+// deleted so that a directory can be moved into its place. Any other entry causes ErrAlreadyExists.
+func (s *GormFileStor) replaceEmptyDirectory(tx *gorm.DB, parent *mcmodel.File, name string) error {
+	var existing []mcmodel.File
+	err := tx.Where("directory_id = ?", parent.ID).
+		Where("name = ?", name).
+		Where("deleted_at IS NULL").
+		Where("dataset_id IS NULL").
+		Find(&existing).Error
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range existing {
+		if entry.IsFile() {
+			return ErrAlreadyExists
+		}
+
+		var childCount int64
+		err := tx.Model(&mcmodel.File{}).
+			Where("directory_id = ?", entry.ID).
+			Where("deleted_at IS NULL").
+			Where("dataset_id IS NULL").
+			Count(&childCount).Error
+		if err != nil {
+			return err
+		}
+
+		if childCount != 0 {
+			return ErrAlreadyExists
+		}
+
+		trash, err := newTrashUpdates()
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&entry).Updates(trash).Error; err != nil {
+			return err
+		}
+
+		var project mcmodel.Project
+		if result := tx.Find(&project, entry.ProjectID); result.Error != nil {
+			return result.Error
+		}
+
+		if err := tx.Model(&project).Update("directory_count", project.DirectoryCount-1).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteFile soft deletes file along with all of its previous versions. The versions are all given the same
+// trash_id so that they can be restored, or purged, together. The project size, file count and file types
+// are reduced.
+func (s *GormFileStor) DeleteFile(file *mcmodel.File) error {
+	if !file.IsFile() {
+		return ErrInvalidMove
+	}
+
+	trash, err := newTrashUpdates()
+	if err != nil {
+		return err
+	}
+
+	return WithTxRetry(s.db, func(tx *gorm.DB) error {
+		var versions []mcmodel.File
+		err := tx.Where("directory_id = ?", file.DirectoryID).
+			Where("name = ?", file.Name).
+			Where("deleted_at IS NULL").
+			Where("dataset_id IS NULL").
+			Find(&versions).Error
+		if err != nil {
+			return err
+		}
+
+		if len(versions) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		size, fileCount, ids := summarizeEntries(versions)
+		if err := tx.Model(&mcmodel.File{}).Where("id IN ?", ids).Updates(trash).Error; err != nil {
+			return err
+		}
+
+		if err := adjustProjectCounts(tx, file.ProjectID, -size, -fileCount, 0); err != nil {
+			return err
+		}
+
+		return adjustProjectFileTypesFor(tx, file.ProjectID, versions, -1)
+	})
+}
+
+// DeleteDirectory soft deletes dir. When recursive is true everything under dir is deleted along with it, all
+// sharing the same trash_id, otherwise ErrNotEmpty is returned if dir has any entries. The project size, file
+// count, directory count and file types are reduced.
+func (s *GormFileStor) DeleteDirectory(dir *mcmodel.File, recursive bool) error {
+	if !dir.IsDir() {
+		return ErrInvalidMove
+	}
+
+	if dir.Path == "/" {
+		return ErrRootDirectory
+	}
+
+	trash, err := newTrashUpdates()
+	if err != nil {
+		return err
+	}
+
+	return WithTxRetry(s.db, func(tx *gorm.DB) error {
+		live := func(db *gorm.DB) *gorm.DB {
+			return db.Where("deleted_at IS NULL")
+		}
+
+		dirs, files, err := collectSubtree(tx, dir.ID, live)
+		if err != nil {
+			return err
+		}
+
+		if !recursive && len(dirs)+len(files) > 1 {
+			return ErrNotEmpty
+		}
+
+		size, fileCount, ids := summarizeEntries(append(dirs, files...))
+		if err := tx.Model(&mcmodel.File{}).Where("id IN ?", ids).Updates(trash).Error; err != nil {
+			return err
+		}
+
+		if err := adjustProjectCounts(tx, dir.ProjectID, -size, -fileCount, -len(dirs)); err != nil {
+			return err
+		}
+
+		return adjustProjectFileTypesFor(tx, dir.ProjectID, files, -1)
+	})
+}
+
+// ListTrash returns the deleted entries in a project, most recently deleted first. Only the entries that were
+// deleted directly are returned. For example, after deleting a directory the directory is listed but the files
+// that were deleted along with it are not. Files are represented by their current version.
+func (s *GormFileStor) ListTrash(projectID int) ([]mcmodel.File, error) {
+	var files []mcmodel.File
+	err := s.db.Table("files AS f").
+		Select("f.*").
+		Joins("LEFT JOIN files AS d ON d.id = f.directory_id").
+		Where("f.project_id = ?", projectID).
+		Where("f.deleted_at IS NOT NULL").
+		Where("f.dataset_id IS NULL").
+		Where("(f.mime_type = ? OR f.current = ?)", "directory", true).
+		Where("(f.trash_id IS NULL OR d.trash_id IS NULL OR d.trash_id <> f.trash_id)").
+		Order("f.deleted_at DESC").
+		Order("f.id").
+		Find(&files).Error
+	return files, err
+}
+
+// RestoreFromTrash restores an entry returned by ListTrash, along with everything deleted with it, to its
+// original location. If the original directory has since been deleted, then the directory path is recreated.
+// If the original location now has an entry with the same name, then the restored entry is renamed, for
+// example file.txt is restored as "file (1).txt". The project size, counts and file types are increased again.
+func (s *GormFileStor) RestoreFromTrash(entry *mcmodel.File) (*mcmodel.File, error) {
+	if entry.DeletedAt.IsZero() {
+		return nil, ErrNotInTrash
+	}
+
+	var parent mcmodel.File
+	if err := s.db.First(&parent, entry.DirectoryID).Error; err != nil {
+		return nil, err
+	}
+
+	toDir := &parent
+	if !parent.DeletedAt.IsZero() {
+		var err error
+		if toDir, err = s.GetOrCreateDirPath(entry.ProjectID, entry.OwnerID, parent.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	err := WithTxRetry(s.db, func(tx *gorm.DB) error {
+		name, err := uniqueNameInDirectory(tx, toDir.ID, entry.Name, entry.IsDir())
+		if err != nil {
+			return err
+		}
+
+		deletedTogether := deletedWith(entry)
+
+		var dirs, files []mcmodel.File
+		if entry.IsDir() {
+			if dirs, files, err = collectSubtree(tx, entry.ID, deletedTogether); err != nil {
+				return err
+			}
+		} else {
+			err = deletedTogether(tx).
+				Where("directory_id = ?", entry.DirectoryID).
+				Where("name = ?", entry.Name).
+				Where("dataset_id IS NULL").
+				Find(&files).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		size, fileCount, ids := summarizeEntries(append(dirs, files...))
+		if err := tx.Model(&mcmodel.File{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"deleted_at": gorm.Expr("NULL"),
+			"trash_id":   gorm.Expr("NULL"),
+		}).Error; err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			// The subtree may be restored under a different path, so recompute the path of every directory.
+			newPath := filepath.Join(toDir.Path, name)
+			for _, dir := range dirs {
+				updates := map[string]interface{}{"path": newPath + strings.TrimPrefix(dir.Path, entry.Path)}
+				if dir.ID == entry.ID {
+					updates["directory_id"] = toDir.ID
+					updates["name"] = name
+				}
+
+				if err := tx.Model(&mcmodel.File{ID: dir.ID}).Updates(updates).Error; err != nil {
+					return err
+				}
+			}
+		} else {
+			err := tx.Model(&mcmodel.File{}).
+				Where("id IN ?", ids).
+				Updates(map[string]interface{}{"directory_id": toDir.ID, "name": name}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := adjustProjectCounts(tx, entry.ProjectID, size, fileCount, len(dirs)); err != nil {
+			return err
+		}
+
+		return adjustProjectFileTypesFor(tx, entry.ProjectID, files, 1)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetFileByID(entry.ID)
+}
+
+// PurgeFromTrash permanently removes an entry returned by ListTrash, and everything in the trash under it. It
+// returns the UUIDs of the blobs that no remaining file references, either directly or through uses_uuid. Those
+// blobs are safe to hand to the garbage collector. Blobs still used by another file are not returned.
+func (s *GormFileStor) PurgeFromTrash(entry *mcmodel.File) ([]string, error) {
+	if entry.DeletedAt.IsZero() {
+		return nil, ErrNotInTrash
+	}
+
+	var blobUUIDs []string
+	err := WithTxRetry(s.db, func(tx *gorm.DB) error {
+		blobUUIDs = nil
+
+		deleted := func(db *gorm.DB) *gorm.DB {
+			return db.Where("deleted_at IS NOT NULL")
+		}
+
+		var dirs, files []mcmodel.File
+		var err error
+		if entry.IsDir() {
+			if dirs, files, err = collectSubtree(tx, entry.ID, deleted); err != nil {
+				return err
+			}
+		} else {
+			err = deletedWith(entry)(tx).
+				Where("directory_id = ?", entry.DirectoryID).
+				Where("name = ?", entry.Name).
+				Where("dataset_id IS NULL").
+				Find(&files).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, f := range files {
+			blobUUIDs = append(blobUUIDs, f.UUIDForPath())
+		}
+
+		_, _, ids := summarizeEntries(append(dirs, files...))
+		if len(ids) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return tx.Where("id IN ?", ids).Delete(&mcmodel.File{}).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	referenced, err := s.FindReferencedUUIDs(blobUUIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var unreferenced []string
+	seen := make(map[string]bool)
+	for _, blobUUID := range blobUUIDs {
+		if !referenced[blobUUID] && !seen[blobUUID] {
+			unreferenced = append(unreferenced, blobUUID)
+		}
+		seen[blobUUID] = true
+	}
+
+	return unreferenced, nil
+}
+
+// ListFileVersions returns all the versions of the file at path, oldest first. Each version has its Owner
+// loaded so callers can show who uploaded it.
+func (s *GormFileStor) ListFileVersions(projectID int, path string) ([]mcmodel.File, error) {
+	var versions []mcmodel.File
+	err := s.fileVersionsQuery(s.db, projectID, path, func(query *gorm.DB) error {
+		return query.Preload("Owner").Order("created_at").Order("id").Find(&versions).Error
+	})
+
+	switch {
+	case err != nil:
+		return nil, err
+	case len(versions) == 0:
+		return nil, gorm.ErrRecordNotFound
+	default:
+		return versions, nil
+	}
+}
+
+// GetFileVersion returns the version versionID of the file at path. It returns gorm.ErrRecordNotFound
+// if versionID isn't a version of path.
+func (s *GormFileStor) GetFileVersion(projectID int, path string, versionID int) (*mcmodel.File, error) {
+	var version mcmodel.File
+	err := s.fileVersionsQuery(s.db, projectID, path, func(query *gorm.DB) error {
+		return query.Preload("Owner").Where("id = ?", versionID).First(&version).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &version, nil
+}
+
+// PromoteFileVersion makes the version versionID the current version of the file at path. Unlike
+// SetFileAsCurrent the lookup of the version and the switch happen in one transaction, so the version
+// can't be deleted or moved out from under the promotion. The project's file_types are updated when the
+// promoted version has a different mime type.
+func (s *GormFileStor) PromoteFileVersion(projectID int, path string, versionID int) (*mcmodel.File, error) {
+	var version mcmodel.File
+	err := WithTxRetry(s.db, func(tx *gorm.DB) error {
+		err := s.fileVersionsQuery(tx, projectID, path, func(query *gorm.DB) error {
+			return query.Where("id = ?", versionID).First(&version).Error
+		})
+		if err != nil {
+			return err
+		}
+
+		versions := func() *gorm.DB {
+			return tx.Model(&mcmodel.File{}).
+				Where("directory_id = ?", version.DirectoryID).
+				Where("name = ?", version.Name).
+				Where("deleted_at IS NULL").
+				Where("dataset_id IS NULL")
+		}
+
+		var previous []mcmodel.File
+		if err := versions().Where("current = ?", true).Find(&previous).Error; err != nil {
+			return err
+		}
+
+		if err := versions().Update("current", false).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&version).Update("current", true).Error; err != nil {
+			return err
+		}
+
+		// The project counts only include current versions, so swap the previous current version's type for
+		// the promoted version's type.
+		fileTypeDeltas := map[string]int{version.MimeType: 1}
+		for _, f := range previous {
+			fileTypeDeltas[f.MimeType]--
+		}
+
+		for mimeType, delta := range fileTypeDeltas {
+			if delta == 0 {
+				delete(fileTypeDeltas, mimeType)
+			}
+		}
+
+		if len(previous) != 1 {
+			if err := adjustProjectCounts(tx, projectID, 0, 1-len(previous), 0); err != nil {
+				return err
+			}
+		}
+
+		if len(fileTypeDeltas) == 0 {
+			return nil
+		}
+
+		return adjustProjectFileTypes(tx, projectID, fileTypeDeltas)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	version.Current = true
+	return &version, nil
+}
+
+// DiffFileVersions compares the metadata of two versions of the file at path.
+func (s *GormFileStor) DiffFileVersions(projectID int, path string, fromVersionID, toVersionID int) ([]mcmodel.FileVersionDiff, error) {
+	from, err := s.GetFileVersion(projectID, path, fromVersionID)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := s.GetFileVersion(projectID, path, toVersionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return mcmodel.DiffFileVersions(*from, *to), nil
+}
+
+// fileVersionsQuery looks up the directory for path and calls fn with a query that selects the versions
+// of the file in that directory.
+func (s *GormFileStor) fileVersionsQuery(db *gorm.DB, projectID int, path string, fn func(query *gorm.DB) error) error {
+	dir, err := findDirByPath(db, projectID, filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	return fn(db.Model(&mcmodel.File{}).
+		Where("directory_id = ?", dir.ID).
+		Where("name = ?", filepath.Base(path)).
+		Where("mime_type <> ?", "directory").
+		Where("deleted_at IS NULL").
+		Where("dataset_id IS NULL"))
+}
+
+// newTrashUpdates returns the column updates that move entries into the trash. Every delete gets its own
+// trash_id, which all the entries deleted together share, so that they can be found again. deleted_at can't
+// be used for this as two deletes in the same second would be merged once MySQL rounds it to a DATETIME.
+func newTrashUpdates() (map[string]interface{}, error) {
+	trashID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{"deleted_at": time.Now(), "trash_id": trashID}, nil
+}
+
+// deletedWith returns a filter for the entries deleted together with entry. Entries deleted outside of
+// FileStor have no trash_id, so for those the entries sharing its deleted_at are used instead.
+func deletedWith(entry *mcmodel.File) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if entry.TrashID != "" {
+			return db.Where("trash_id = ?", entry.TrashID)
+		}
+
+		return db.Where("deleted_at = ?", entry.DeletedAt).Where("trash_id IS NULL")
+	}
+}
+
+// collectSubtree returns the directory rootID, all the directories under it, and all the files in those
+// directories. Only entries matching filter are included, and a directory that doesn't match the filter
+// isn't descended into. Directories are found by following directory_id rather than by path, so entries
+// from an earlier directory with the same path are never picked up.
+func collectSubtree(tx *gorm.DB, rootID int, filter func(db *gorm.DB) *gorm.DB) (dirs []mcmodel.File, files []mcmodel.File, err error) {
+	if err := filter(tx).Where("id = ?", rootID).Find(&dirs).Error; err != nil {
+		return nil, nil, err
+	}
+
+	if len(dirs) == 0 {
+		return nil, nil, gorm.ErrRecordNotFound
+	}
+
+	frontier := []int{rootID}
+	for len(frontier) != 0 {
+		var entries []mcmodel.File
+		err := filter(tx).
+			Where("directory_id IN ?", frontier).
+			Where("dataset_id IS NULL").
+			Find(&entries).Error
+		if err != nil {
+			return nil, nil, err
+		}
+
+		frontier = nil
+		for _, entry := range entries {
+			if entry.IsDir() {
+				dirs = append(dirs, entry)
+				frontier = append(frontier, entry.ID)
+			} else {
+				files = append(files, entry)
+			}
+		}
+	}
+
+	return dirs, files, nil
+}
+
+// summarizeEntries returns the total size of the files in entries, the number of files (counting only current
+// versions, since previous versions don't count towards the project file count), and the IDs of all entries.
+func summarizeEntries(entries []mcmodel.File) (size int64, fileCount int, ids []int) {
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+		if entry.IsDir() {
+			continue
+		}
+
+		size += int64(entry.Size)
+		if entry.Current {
+			fileCount++
+		}
+	}
+
+	return size, fileCount, ids
+}
+
+// adjustProjectCounts adds the deltas to the project's size, file count and directory count.
+func adjustProjectCounts(tx *gorm.DB, projectID int, sizeDelta int64, fileCountDelta, directoryCountDelta int) error {
+	var project mcmodel.Project
+	if result := tx.Find(&project, projectID); result.Error != nil {
+		return result.Error
+	}
+
+	return tx.Model(&project).Updates(map[string]interface{}{
+		"size":            project.Size + sizeDelta,
+		"file_count":      project.FileCount + fileCountDelta,
+		"directory_count": project.DirectoryCount + directoryCountDelta,
+	}).Error
+}
+
+// adjustProjectFileTypes adds the deltas, keyed by mime type, to the counts in the project's file_types. The
+// counts are stored by the description of the mime type. Counts that reach zero are removed.
+func adjustProjectFileTypes(tx *gorm.DB, projectID int, mimeTypeDeltas map[string]int) error {
+	var project mcmodel.Project
+	if result := tx.Find(&project, projectID); result.Error != nil {
+		return result.Error
+	}
+
+	fileTypes, err := project.GetFileTypes()
+	if err != nil {
+		return err
+	}
+
+	if fileTypes == nil {
+		fileTypes = make(map[string]int)
+	}
+
+	for mimeType, delta := range mimeTypeDeltas {
+		description := mime.Mime2Description(mimeType)
+		fileTypes[description] += delta
+		if fileTypes[description] == 0 {
+			delete(fileTypes, description)
+		}
+	}
+
+	fileTypesAsStr, err := project.ToFileTypeAsString(fileTypes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&project).Update("file_types", fileTypesAsStr).Error
+}
+
+// adjustProjectFileTypesFor adds sign to the project's file_types count for each current file in entries. It is
+// called with -1 when the files are removed from the project, and 1 when they are added back.
+func adjustProjectFileTypesFor(tx *gorm.DB, projectID int, entries []mcmodel.File, sign int) error {
+	mimeTypeDeltas := make(map[string]int)
+	for _, entry := range entries {
+		if !entry.IsDir() && entry.Current {
+			mimeTypeDeltas[entry.MimeType] += sign
+		}
+	}
+
+	if len(mimeTypeDeltas) == 0 {
+		return nil
+	}
+
+	return adjustProjectFileTypes(tx, projectID, mimeTypeDeltas)
+}
+
+// uniqueNameInDirectory returns name if dirID doesn't have an entry called name, otherwise it returns the first
+// of "name (1)", "name (2)", ... that is free. For files the number goes before the extension.
+func uniqueNameInDirectory(tx *gorm.DB, dirID int, name string, isDir bool) (string, error) {
+	base, ext := name, ""
+	if !isDir {
+		ext = filepath.Ext(name)
+		base = strings.TrimSuffix(name, ext)
+	}
+
+	candidate := name
+	for i := 1; ; i++ {
+		var count int64
+		err := tx.Model(&mcmodel.File{}).
+			Where("directory_id = ?", dirID).
+			Where("name = ?", candidate).
+			Where("deleted_at IS NULL").
+			Where("dataset_id IS NULL").
+			Count(&count).Error
+		if err != nil {
+			return "", err
+		}
+
+		if count == 0 {
+			return candidate, nil
+		}
+
+		candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
@@ -0,0 +1,84 @@
+package stor
+
+import (
+	"testing"
+
+	"github.com/materials-commons/hydra/pkg/digest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindMatchingFileByChecksum(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	user := b.User("user1")
+	proj := b.Project("proj1", user)
+
+	md5Only := b.File(proj, proj.RootDir, "md5-only.txt", 10)
+	strong := b.File(proj, proj.RootDir, "strong.txt", 10)
+	collision := b.File(proj, proj.RootDir, "collision.txt", 10)
+	require.NoError(t, db.Model(md5Only).Update("checksum", "m1").Error)
+	require.NoError(t, db.Model(strong).Updates(map[string]interface{}{"checksum": "m1", "sha256": "s1"}).Error)
+	require.NoError(t, db.Model(collision).Updates(map[string]interface{}{"checksum": "m2", "sha256": "s2"}).Error)
+
+	fileStor := NewGormFileStor(db, "/")
+
+	// When both sides have a SHA-256 it is preferred over an MD5 only match.
+	found, err := fileStor.FindMatchingFileByChecksum(digest.Sums{MD5: "m1", SHA256: "s1"})
+	require.NoError(t, err)
+	require.Equal(t, strong.ID, found.ID)
+
+	// A file that only has an MD5 still matches on it.
+	found, err = fileStor.FindMatchingFileByChecksum(digest.Sums{MD5: "m1", SHA256: "other"})
+	require.NoError(t, err)
+	require.Equal(t, md5Only.ID, found.ID)
+
+	// Same MD5 but a different SHA-256 is different contents.
+	_, err = fileStor.FindMatchingFileByChecksum(digest.Sums{MD5: "m2", SHA256: "other"})
+	require.Error(t, err)
+
+	// Uploads from clients that only know the MD5 match on it.
+	found, err = fileStor.FindMatchingFileByChecksum(digest.Sums{MD5: "m2"})
+	require.NoError(t, err)
+	require.Equal(t, collision.ID, found.ID)
+
+	_, err = fileStor.FindMatchingFileByChecksum(digest.Sums{})
+	require.Error(t, err)
+}
+
+func TestSetFileSha256(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	user := b.User("user1")
+	proj := b.Project("proj1", user)
+
+	original := b.File(proj, proj.RootDir, "original.txt", 10)
+	sharing := b.File(proj, proj.RootDir, "sharing.txt", 10)
+	other := b.File(proj, proj.RootDir, "other.txt", 10)
+	require.NoError(t, db.Model(sharing).Update("uses_uuid", original.UUID).Error)
+	sharing.UsesUUID = original.UUID
+
+	fileStor := NewGormFileStor(db, "/")
+
+	missing, err := fileStor.ListFilesMissingSha256(proj.ID, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, missing, 3)
+
+	require.NoError(t, fileStor.SetFileSha256(sharing, "s1"))
+	require.Equal(t, "s1", sharing.Sha256)
+
+	missing, err = fileStor.ListFilesMissingSha256(proj.ID, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, missing, 1)
+	require.Equal(t, other.ID, missing[0].ID)
+
+	reloaded, err := fileStor.GetFileByID(original.ID)
+	require.NoError(t, err)
+	require.Equal(t, "s1", reloaded.Sha256)
+
+	// An existing SHA-256 isn't overwritten.
+	require.NoError(t, fileStor.SetFileSha256(original, "s2"))
+	reloaded, err = fileStor.GetFileByID(sharing.ID)
+	require.NoError(t, err)
+	require.Equal(t, "s1", reloaded.Sha256)
+}
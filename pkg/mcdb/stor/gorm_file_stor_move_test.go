@@ -0,0 +1,111 @@
+package stor
+
+import (
+	"testing"
+
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newTestFileStor returns a GormFileStor for db that keeps its blobs in a temporary directory.
+func newTestFileStor(t *testing.T, db *gorm.DB) *GormFileStor {
+	return NewGormFileStorWithBlobStore(db, "", blobstore.NewLocalBlobStore(t.TempDir()))
+}
+
+func reloadProject(t *testing.T, db *gorm.DB, projectID int) mcmodel.Project {
+	var p mcmodel.Project
+	require.NoError(t, db.First(&p, projectID).Error)
+	return p
+}
+
+func TestMoveFileAndDirectory(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	project := b.Project("proj", b.User("owner"))
+	root := project.RootDir
+	fileStor := newTestFileStor(t, db)
+
+	dirA := b.Dir(project, root, "a")
+	dirB := b.Dir(project, dirA, "b%")
+	dirC := b.Dir(project, root, "c")
+	b.Dir(project, dirC, "empty")
+	b.Dir(project, b.Dir(project, dirC, "full"), "x")
+
+	oldVersion := b.FileVersion(project, dirB, "f.txt", 0)
+	movedFile := b.File(project, dirB, "f.txt", 0)
+	existing := b.File(project, dirC, "f.txt", 0)
+
+	// Directories
+	moved, err := fileStor.MoveDirectory(dirA, root, "z")
+	require.NoError(t, err)
+	require.Equal(t, "/z", moved.Path)
+	require.Equal(t, "z", moved.Name)
+
+	dirB, err = fileStor.GetDirByPath(project.ID, "/z/b%")
+	require.NoError(t, err)
+	require.Equal(t, moved.ID, dirB.DirectoryID)
+
+	_, err = fileStor.GetDirByPath(project.ID, "/a")
+	require.True(t, IsRecordNotFound(err))
+
+	_, err = fileStor.MoveDirectory(moved, dirB, "loop")
+	require.ErrorIs(t, err, ErrInvalidMove)
+
+	_, err = fileStor.MoveDirectory(moved, dirC, "full")
+	require.ErrorIs(t, err, ErrAlreadyExists)
+
+	_, err = fileStor.MoveDirectory(moved, dirC, "f.txt")
+	require.ErrorIs(t, err, ErrAlreadyExists)
+
+	before := reloadProject(t, db, project.ID)
+
+	moved, err = fileStor.MoveDirectory(moved, dirC, "empty")
+	require.NoError(t, err)
+	require.Equal(t, "/c/empty", moved.Path)
+
+	after := reloadProject(t, db, project.ID)
+	require.Equal(t, before.DirectoryCount-1, after.DirectoryCount)
+
+	dirB, err = fileStor.GetDirByPath(project.ID, "/c/empty/b%")
+	require.NoError(t, err)
+
+	// Files
+	_, err = fileStor.MoveFile(movedFile, dirC, "full")
+	require.ErrorIs(t, err, ErrAlreadyExists)
+
+	f, err := fileStor.GetFileByPath(project.ID, "/c/empty/b%/f.txt")
+	require.NoError(t, err)
+	require.Equal(t, movedFile.ID, f.ID)
+
+	f, err = fileStor.MoveFile(f, dirB, "g.txt")
+	require.NoError(t, err)
+	require.Equal(t, "g.txt", f.Name)
+
+	// The builder doesn't fill in file_types, so set it for the two current files.
+	require.NoError(t, db.Model(project).Update("file_types", `{"Text":2}`).Error)
+
+	f, err = fileStor.MoveFile(f, dirC, "f.txt")
+	require.NoError(t, err)
+	require.Equal(t, dirC.ID, f.DirectoryID)
+
+	// The existing /c/f.txt is now a previous version, so it's no longer counted.
+	after = reloadProject(t, db, project.ID)
+	require.Equal(t, 1, after.FileCount)
+	require.Equal(t, `{"Text":1}`, after.FileTypes)
+
+	current, err := fileStor.GetFileByPath(project.ID, "/c/f.txt")
+	require.NoError(t, err)
+	require.Equal(t, movedFile.ID, current.ID)
+
+	var versions []mcmodel.File
+	require.NoError(t, db.Where("directory_id = ?", dirC.ID).Where("name = ?", "f.txt").Order("id").Find(&versions).Error)
+	require.Len(t, versions, 3)
+	require.Equal(t, []int{oldVersion.ID, movedFile.ID, existing.ID}, []int{versions[0].ID, versions[1].ID, versions[2].ID})
+	require.False(t, versions[2].Current)
+
+	_, err = fileStor.GetFileByPath(project.ID, "/c/empty/b%/f.txt")
+	require.True(t, IsRecordNotFound(err))
+}
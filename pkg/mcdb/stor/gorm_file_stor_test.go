@@ -1,25 +1,30 @@
 package stor
 
 import (
-	"fmt"
 	"testing"
 
-	"gorm.io/driver/mysql"
-	"gorm.io/gorm"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFindFileByPath(t *testing.T) {
-	dsn := "mc:mcpw@tcp(127.0.0.1:3306)/mc?charset=utf8mb4&parseTime=True&loc=Local"
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
-	if err != nil {
-		t.Errorf("Failed to open db: %s", err)
-	}
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	user := b.User("user1")
+	proj := b.Project("proj1", user)
+	d1 := b.Dir(proj, proj.RootDir, "D1")
+	f := b.File(proj, d1, "f.txt", 10)
 
 	fileStore := NewGormFileStor(db, "/")
 
-	f, err := fileStore.GetDirByPath(509, "/D1")
-	if err != nil {
-		t.Fatalf("FindDirByPath failed: %s", err)
-	}
-	fmt.Printf("%+v\n", f)
+	dir, err := fileStore.GetDirByPath(proj.ID, "/D1")
+	require.NoError(t, err)
+	require.Equal(t, d1.ID, dir.ID)
+
+	found, err := fileStore.GetFileByPath(proj.ID, "/D1/f.txt")
+	require.NoError(t, err)
+	require.Equal(t, f.ID, found.ID)
+
+	_, err = fileStore.GetDirByPath(proj.ID, "/D2")
+	require.Error(t, err)
 }
@@ -0,0 +1,198 @@
+package stor
+
+import (
+	"testing"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrash(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	builder := mcdbtest.NewBuilder(t, db)
+	project := builder.Project("proj", builder.User("owner"))
+	root, projectID := project.RootDir, project.ID
+	fileStor := newTestFileStor(t, db)
+
+	d1 := builder.Dir(project, root, "d1")
+	d2 := builder.Dir(project, d1, "d2")
+	builder.FileVersion(project, d1, "a.txt", 5)
+	a := builder.File(project, d1, "a.txt", 10)
+	b := builder.File(project, d2, "b.txt", 7)
+	c := builder.File(project, root, "c.txt", 3)
+	img := builder.File(project, d2, "img.png", 0)
+	require.NoError(t, db.Model(img).Update("mime_type", "image/png").Error)
+
+	// The builder doesn't fill in file_types, so set it for the current files.
+	require.NoError(t, db.Model(project).Update("file_types", `{"Text":3,"Image":1}`).Error)
+	start := reloadProject(t, db, projectID)
+
+	// Delete a file
+	require.NoError(t, fileStor.DeleteFile(c))
+	_, err := fileStor.GetFileByPath(projectID, "/c.txt")
+	require.True(t, IsRecordNotFound(err))
+	p := reloadProject(t, db, projectID)
+	require.Equal(t, start.Size-3, p.Size)
+	require.Equal(t, start.FileCount-1, p.FileCount)
+	requireFileTypes(t, p, map[string]int{"Text": 2, "Image": 1})
+
+	// Delete a directory
+	require.ErrorIs(t, fileStor.DeleteDirectory(d1, false), ErrNotEmpty)
+	require.ErrorIs(t, fileStor.DeleteDirectory(root, true), ErrRootDirectory)
+	require.NoError(t, fileStor.DeleteDirectory(d1, true))
+	_, err = fileStor.GetDirByPath(projectID, "/d1")
+	require.True(t, IsRecordNotFound(err))
+	p = reloadProject(t, db, projectID)
+	require.Equal(t, start.Size-25, p.Size)
+	require.Equal(t, start.FileCount-4, p.FileCount)
+	require.Equal(t, start.DirectoryCount-2, p.DirectoryCount)
+	requireFileTypes(t, p, map[string]int{})
+
+	// Only the entries deleted directly show up in the trash.
+	trash, err := fileStor.ListTrash(projectID)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []int{c.ID, d1.ID}, trashIDs(trash))
+
+	// Restoring when the original names are taken renames the restored entries. The builder doesn't count
+	// the new c.txt in file_types.
+	builder.Dir(project, root, "d1")
+	builder.File(project, root, "c.txt", 1)
+
+	for _, entry := range trash {
+		restored, err := fileStor.RestoreFromTrash(&entry)
+		require.NoError(t, err)
+		if entry.ID == c.ID {
+			require.Equal(t, "c (1).txt", restored.Name)
+		} else {
+			require.Equal(t, "d1 (1)", restored.Name)
+			require.Equal(t, "/d1 (1)", restored.Path)
+		}
+	}
+
+	dir, err := fileStor.GetDirByPath(projectID, "/d1 (1)/d2")
+	require.NoError(t, err)
+	require.Equal(t, d2.ID, dir.ID)
+
+	f, err := fileStor.GetFileByPath(projectID, "/d1 (1)/d2/b.txt")
+	require.NoError(t, err)
+	require.Equal(t, b.ID, f.ID)
+
+	f, err = fileStor.GetFileByPath(projectID, "/d1 (1)/a.txt")
+	require.NoError(t, err)
+	require.Equal(t, a.ID, f.ID)
+
+	// Everything is back, along with the new /d1 and /c.txt.
+	p = reloadProject(t, db, projectID)
+	require.Equal(t, start.Size+1, p.Size)
+	require.Equal(t, start.FileCount+1, p.FileCount)
+	require.Equal(t, start.DirectoryCount+1, p.DirectoryCount)
+	requireFileTypes(t, p, map[string]int{"Text": 3, "Image": 1})
+
+	trash, err = fileStor.ListTrash(projectID)
+	require.NoError(t, err)
+	require.Empty(t, trash)
+
+	_, err = fileStor.RestoreFromTrash(a)
+	require.ErrorIs(t, err, ErrNotInTrash)
+}
+
+func TestTrashRestoreRecreatesDirectory(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	project := b.Project("proj", b.User("owner"))
+	projectID := project.ID
+	fileStor := newTestFileStor(t, db)
+
+	dir := b.Dir(project, b.Dir(project, project.RootDir, "x"), "y")
+	f := b.File(project, dir, "f.txt", 1)
+
+	require.NoError(t, fileStor.DeleteFile(f))
+	deleted, err := fileStor.GetFileByID(f.ID)
+	require.NoError(t, err)
+
+	// Delete the directory straight after the file. Even within the same second the file and directory are
+	// separate trash entries.
+	x, err := fileStor.GetDirByPath(projectID, "/x")
+	require.NoError(t, err)
+	require.NoError(t, fileStor.DeleteDirectory(x, true))
+
+	trash, err := fileStor.ListTrash(projectID)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []int{f.ID, x.ID}, trashIDs(trash))
+
+	// Restoring just the file recreates its directory path.
+	restored, err := fileStor.RestoreFromTrash(deleted)
+	require.NoError(t, err)
+	newDir, err := fileStor.GetDirByPath(projectID, "/x/y")
+	require.NoError(t, err)
+	require.NotEqual(t, dir.ID, newDir.ID)
+	require.Equal(t, newDir.ID, restored.DirectoryID)
+
+	// Restoring the directory doesn't bring back a second copy of the file.
+	trash, err = fileStor.ListTrash(projectID)
+	require.NoError(t, err)
+	require.Equal(t, []int{x.ID}, trashIDs(trash))
+	_, err = fileStor.RestoreFromTrash(&trash[0])
+	require.NoError(t, err)
+	_, err = fileStor.GetFileByPath(projectID, "/x (1)/y/f.txt")
+	require.True(t, IsRecordNotFound(err))
+}
+
+func TestTrashPurge(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	project := b.Project("proj", b.User("owner"))
+	fileStor := newTestFileStor(t, db)
+
+	dir := b.Dir(project, project.RootDir, "d")
+	original := b.File(project, dir, "original.txt", 1)
+	duplicate := b.File(project, project.RootDir, "duplicate.txt", 1)
+	require.NoError(t, fileStor.UpdateFileUses(duplicate, original.UUID, original.ID))
+	other := b.File(project, dir, "other.txt", 1)
+
+	_, err := fileStor.PurgeFromTrash(original)
+	require.ErrorIs(t, err, ErrNotInTrash)
+
+	// The directory is purged, but the blob for original.txt is still used by duplicate.txt.
+	require.NoError(t, fileStor.DeleteDirectory(dir, true))
+	trash, err := fileStor.ListTrash(project.ID)
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+
+	unreferenced, err := fileStor.PurgeFromTrash(&trash[0])
+	require.NoError(t, err)
+	require.Equal(t, []string{other.UUID}, unreferenced)
+
+	var count int64
+	require.NoError(t, db.Model(&mcmodel.File{}).Where("id IN ?", []int{dir.ID, original.ID, other.ID}).Count(&count).Error)
+	require.Equal(t, int64(0), count)
+
+	// Once duplicate.txt is gone the shared blob is unreferenced.
+	duplicate, err = fileStor.GetFileByID(duplicate.ID)
+	require.NoError(t, err)
+	require.NoError(t, fileStor.DeleteFile(duplicate))
+	duplicate, err = fileStor.GetFileByID(duplicate.ID)
+	require.NoError(t, err)
+	unreferenced, err = fileStor.PurgeFromTrash(duplicate)
+	require.NoError(t, err)
+	require.Equal(t, []string{original.UUID}, unreferenced)
+}
+
+func trashIDs(entries []mcmodel.File) []int {
+	var ids []int
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+func requireFileTypes(t *testing.T, project mcmodel.Project, expected map[string]int) {
+	fileTypes, err := project.GetFileTypes()
+	require.NoError(t, err)
+	if len(expected) == 0 {
+		require.Empty(t, fileTypes)
+		return
+	}
+	require.Equal(t, expected, fileTypes)
+}
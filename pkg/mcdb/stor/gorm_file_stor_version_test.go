@@ -0,0 +1,81 @@
+package stor
+
+import (
+	"testing"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileVersions(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	project := b.Project("proj", b.User("uploader"))
+	projectID := project.ID
+	fileStor := newTestFileStor(t, db)
+
+	dir := b.Dir(project, project.RootDir, "d")
+	v1 := b.FileVersion(project, dir, "f.txt", 10)
+	v2 := b.File(project, dir, "f.txt", 20)
+	b.File(project, dir, "other.txt", 5)
+	require.NoError(t, db.Model(v2).Updates(map[string]interface{}{"checksum": "abc", "upload_source": "TUS"}).Error)
+	require.NoError(t, db.Model(v1).Update("mime_type", "image/png").Error)
+
+	// The builder doesn't fill in file_types, so set it for the two current files.
+	require.NoError(t, db.Model(project).Update("file_types", `{"Text":2}`).Error)
+
+	versions, err := fileStor.ListFileVersions(projectID, "/d/f.txt")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	require.Equal(t, v1.ID, versions[0].ID)
+	require.Equal(t, v2.ID, versions[1].ID)
+	require.True(t, versions[1].Current)
+	require.Equal(t, "TUS", versions[1].UploadSource)
+	require.NotNil(t, versions[1].Owner)
+	require.Equal(t, "uploader", versions[1].Owner.Name)
+
+	_, err = fileStor.ListFileVersions(projectID, "/d/missing.txt")
+	require.True(t, IsRecordNotFound(err))
+
+	diffs, err := fileStor.DiffFileVersions(projectID, "/d/f.txt", v1.ID, v2.ID)
+	require.NoError(t, err)
+	fields := map[string]mcmodel.FileVersionDiff{}
+	for _, diff := range diffs {
+		fields[diff.Field] = diff
+	}
+	require.Equal(t, mcmodel.FileVersionDiff{Field: "size", From: "10", To: "20"}, fields["size"])
+	require.Equal(t, "abc", fields["checksum"].To)
+	require.Equal(t, "TUS", fields["upload_source"].To)
+
+	// A version of a different file can't be promoted through this path.
+	other, err := fileStor.GetFileByPath(projectID, "/d/other.txt")
+	require.NoError(t, err)
+	_, err = fileStor.PromoteFileVersion(projectID, "/d/f.txt", other.ID)
+	require.True(t, IsRecordNotFound(err))
+
+	promoted, err := fileStor.PromoteFileVersion(projectID, "/d/f.txt", v1.ID)
+	require.NoError(t, err)
+	require.True(t, promoted.Current)
+
+	// The promoted version is an image, so the project now has one text file and one image.
+	p := reloadProject(t, db, projectID)
+	require.Equal(t, 2, p.FileCount)
+	fileTypes, err := p.GetFileTypes()
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"Text": 1, "Image": 1}, fileTypes)
+
+	current, err := fileStor.GetFileByPath(projectID, "/d/f.txt")
+	require.NoError(t, err)
+	require.Equal(t, v1.ID, current.ID)
+
+	versions, err = fileStor.ListFileVersions(projectID, "/d/f.txt")
+	require.NoError(t, err)
+	require.True(t, versions[0].Current)
+	require.False(t, versions[1].Current)
+
+	// The other file in the directory is untouched.
+	other, err = fileStor.GetFileByID(other.ID)
+	require.NoError(t, err)
+	require.True(t, other.Current)
+}
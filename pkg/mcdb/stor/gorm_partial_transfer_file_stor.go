@@ -37,7 +37,9 @@ func (s *GormPartialTransferFileStor) UpdateFileSize(transferID string, size int
 }
 
 func (s *GormPartialTransferFileStor) GetUploadingFiles() ([]mcmodel.PartialTransferFile, error) {
-	return nil, nil
+	var files []mcmodel.PartialTransferFile
+	err := s.db.Where("status = ?", "uploading").Find(&files).Error
+	return files, err
 }
 
 func (s *GormPartialTransferFileStor) GetPartialTransferFileByID(transferID string) (*mcmodel.PartialTransferFile, error) {
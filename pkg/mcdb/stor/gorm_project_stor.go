@@ -6,7 +6,9 @@ import (
 
 	"github.com/gosimple/slug"
 	"github.com/hashicorp/go-uuid"
+	"github.com/materials-commons/hydra/pkg/authz"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/mime"
 	"gorm.io/gorm"
 )
 
@@ -128,6 +130,22 @@ func (s *GormProjectStor) AddAdminToProject(project *mcmodel.Project, user *mcmo
 	return err
 }
 
+// AddViewerToProject gives the user read-only access to the project by adding them to project2viewer.
+// The user isn't added to the project's team.
+func (s *GormProjectStor) AddViewerToProject(project *mcmodel.Project, user *mcmodel.User) error {
+	return WithTxRetry(s.db, func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&mcmodel.Project2Viewer{}).
+			Where("project_id = ? AND user_id = ?", project.ID, user.ID).
+			Count(&count).Error
+		if err != nil || count != 0 {
+			return err
+		}
+
+		return tx.Create(&mcmodel.Project2Viewer{ProjectID: project.ID, UserID: user.ID}).Error
+	})
+}
+
 func (s *GormProjectStor) GetProjectByID(projectID int) (*mcmodel.Project, error) {
 	var project mcmodel.Project
 	err := s.db.Find(&project, projectID).Error
@@ -152,6 +170,7 @@ func (s *GormProjectStor) GetProjectsForUser(userID int) ([]mcmodel.Project, err
 
 	err := s.db.Where("team_id in (select team_id from team2admin where user_id = ?)", userID).
 		Or("team_id in (select team_id from team2member where user_id = ?)", userID).
+		Or("id in (select project_id from project2viewer where user_id = ?)", userID).
 		Find(&projects).Error
 	return projects, err
 }
@@ -185,35 +204,184 @@ func (s *GormProjectStor) UpdateProjectDirectoryCount(projectID int, directoryCo
 	})
 }
 
+// UserCanAccessProject returns true when the user has any role in the project. See GetUserProjectRole.
 func (s *GormProjectStor) UserCanAccessProject(userID, projectID int) bool {
-	var project mcmodel.Project
+	role, err := s.GetUserProjectRole(userID, projectID)
+	if err != nil {
+		return false
+	}
+
+	return role.CanRead()
+}
 
+// GetUserProjectRole resolves the user's role in the project. The project owner and the admins of the
+// project's team are admins, the team's members are contributors, and users granted read-only access
+// with AddViewerToProject (in project2viewer) are viewers. Everyone else has no role, which is not an
+// error. project2user isn't consulted: the web app writes it for the project's team, and a row there
+// has never granted access on its own.
+func (s *GormProjectStor) GetUserProjectRole(userID, projectID int) (authz.Role, error) {
+	var project mcmodel.Project
 	if err := s.db.Find(&project, projectID).Error; err != nil {
-		return false
+		return authz.None, err
+	}
+
+	if project.ID == 0 {
+		return authz.None, nil
 	}
 
 	if project.OwnerID == userID {
-		return true
+		return authz.Admin, nil
 	}
 
-	var userCount int64
-	s.db.Table("team2member").
-		Where("user_id = ?", userID).
-		Where("team_id = ?", project.TeamID).
-		Count(&userCount)
+	roleTables := []struct {
+		table string
+		role  authz.Role
+	}{
+		{"team2admin", authz.Admin},
+		{"team2member", authz.Contributor},
+	}
 
-	if userCount != 0 {
-		return true
+	for _, rt := range roleTables {
+		var count int64
+		err := s.db.Table(rt.table).
+			Where("user_id = ?", userID).
+			Where("team_id = ?", project.TeamID).
+			Count(&count).Error
+		if err != nil {
+			return authz.None, err
+		}
+
+		if count != 0 {
+			return rt.role, nil
+		}
 	}
 
-	s.db.Table("team2admin").
+	var count int64
+	err := s.db.Model(&mcmodel.Project2Viewer{}).
 		Where("user_id = ?", userID).
-		Where("team_id = ?", project.TeamID).
-		Count(&userCount)
+		Where("project_id = ?", projectID).
+		Count(&count).Error
+	if err != nil {
+		return authz.None, err
+	}
+
+	if count != 0 {
+		return authz.Viewer, nil
+	}
+
+	return authz.None, nil
+}
+
+// ListProjectIDs returns the id of every project, in ascending order.
+func (s *GormProjectStor) ListProjectIDs() ([]int, error) {
+	var ids []int
+	err := s.db.Model(&mcmodel.Project{}).Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// RebuildProjectStats derives the size, file and directory counts, and file type histogram for a project
+// from its files, and compares them against the values stored on the project. Unless dryRun is true, any
+// values that differ are corrected. Reading the files and correcting the project happen in the same
+// transaction.
+func (s *GormProjectStor) RebuildProjectStats(projectID int, dryRun bool) (*mcmodel.ProjectStatsReport, error) {
+	var report *mcmodel.ProjectStatsReport
+
+	err := WithTxRetry(s.db, func(tx *gorm.DB) error {
+		var project mcmodel.Project
+		if err := tx.First(&project, projectID).Error; err != nil {
+			return err
+		}
+
+		computed, err := computeProjectStats(tx, projectID)
+		if err != nil {
+			return err
+		}
+
+		report = &mcmodel.ProjectStatsReport{
+			ProjectID: projectID,
+			Stored:    project.Stats(),
+			Computed:  *computed,
+		}
+		report.Diffs = mcmodel.DiffProjectStats(report.Stored, report.Computed)
+
+		if dryRun || len(report.Diffs) == 0 {
+			return nil
+		}
+
+		fileTypes, err := project.ToFileTypeAsString(computed.FileTypes)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&project).Updates(map[string]interface{}{
+			"size":            computed.Size,
+			"file_count":      computed.FileCount,
+			"directory_count": computed.DirectoryCount,
+			"file_types":      fileTypes,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		report.Corrected = true
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// computeProjectStats derives the project statistics from the project's files. Deleted files and files
+// belonging to datasets aren't counted.
+func computeProjectStats(tx *gorm.DB, projectID int) (*mcmodel.ProjectStats, error) {
+	stats := &mcmodel.ProjectStats{FileTypes: make(map[string]int)}
+
+	projectFiles := func() *gorm.DB {
+		return tx.Model(&mcmodel.File{}).
+			Where("project_id = ?", projectID).
+			Where("deleted_at IS NULL").
+			Where("dataset_id IS NULL")
+	}
+
+	err := projectFiles().
+		Where("mime_type <> ?", "directory").
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&stats.Size).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var directoryCount int64
+	err = projectFiles().
+		Where("mime_type = ?", "directory").
+		Where("path <> ?", "/").
+		Count(&directoryCount).Error
+	if err != nil {
+		return nil, err
+	}
+	stats.DirectoryCount = int(directoryCount)
+
+	var mimeTypeCounts []struct {
+		MimeType string
+		Count    int
+	}
+	err = projectFiles().
+		Where("mime_type <> ?", "directory").
+		Where("current = ?", true).
+		Select("mime_type, COUNT(*) AS count").
+		Group("mime_type").
+		Scan(&mimeTypeCounts).Error
+	if err != nil {
+		return nil, err
+	}
 
-	if userCount != 0 {
-		return true
+	for _, mimeTypeCount := range mimeTypeCounts {
+		stats.FileCount += mimeTypeCount.Count
+		stats.FileTypes[mime.Mime2Description(mimeTypeCount.MimeType)] += mimeTypeCount.Count
 	}
 
-	return false
+	return stats, nil
 }
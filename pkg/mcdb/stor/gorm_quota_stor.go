@@ -0,0 +1,143 @@
+package stor
+
+import (
+	"errors"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"gorm.io/gorm"
+)
+
+type GormQuotaStor struct {
+	db *gorm.DB
+}
+
+func NewGormQuotaStor(db *gorm.DB) *GormQuotaStor {
+	return &GormQuotaStor{db: db}
+}
+
+// SetProjectQuota sets the number of bytes a project can store. A limitBytes of 0 or less removes the quota.
+func (s *GormQuotaStor) SetProjectQuota(projectID int, limitBytes int64) error {
+	return s.setQuota("project_id", projectID, limitBytes)
+}
+
+// SetUserQuota sets the number of bytes a user can store across all projects. A limitBytes of 0 or less
+// removes the quota.
+func (s *GormQuotaStor) SetUserQuota(userID int, limitBytes int64) error {
+	return s.setQuota("user_id", userID, limitBytes)
+}
+
+func (s *GormQuotaStor) setQuota(column string, id int, limitBytes int64) error {
+	return WithTxRetry(s.db, func(tx *gorm.DB) error {
+		if limitBytes <= 0 {
+			return tx.Where(column+" = ?", id).Delete(&mcmodel.StorageQuota{}).Error
+		}
+
+		var quota mcmodel.StorageQuota
+		err := tx.Where(column+" = ?", id).First(&quota).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			quota.LimitBytes = limitBytes
+			if column == "project_id" {
+				quota.ProjectID = id
+			} else {
+				quota.UserID = id
+			}
+			return tx.Create(&quota).Error
+		case err != nil:
+			return err
+		default:
+			return tx.Model(&quota).Update("limit_bytes", limitBytes).Error
+		}
+	})
+}
+
+// GetProjectQuotaUsage returns a project's quota and usage. The usage is the project size, which includes
+// every version of every file but not files in the trash.
+func (s *GormQuotaStor) GetProjectQuotaUsage(projectID int) (*mcmodel.QuotaUsage, error) {
+	var project mcmodel.Project
+	if err := s.db.Select("id", "size").First(&project, projectID).Error; err != nil {
+		return nil, err
+	}
+
+	usage := &mcmodel.QuotaUsage{Scope: mcmodel.QuotaScopeProject, ID: projectID, UsedBytes: project.Size}
+	if err := s.loadLimit("project_id", projectID, usage); err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// GetUserQuotaUsage returns a user's quota and usage. The usage is the size of every version of every file
+// the user uploaded, across all projects, not counting files in the trash.
+func (s *GormQuotaStor) GetUserQuotaUsage(userID int) (*mcmodel.QuotaUsage, error) {
+	usage := &mcmodel.QuotaUsage{Scope: mcmodel.QuotaScopeUser, ID: userID}
+	err := s.db.Model(&mcmodel.File{}).
+		Select("COALESCE(SUM(size), 0)").
+		Where("owner_id = ?", userID).
+		Where("mime_type <> ?", "directory").
+		Where("deleted_at IS NULL").
+		Where("dataset_id IS NULL").
+		Scan(&usage.UsedBytes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loadLimit("user_id", userID, usage); err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+func (s *GormQuotaStor) loadLimit(column string, id int, usage *mcmodel.QuotaUsage) error {
+	var quotas []mcmodel.StorageQuota
+	if err := s.db.Where(column+" = ?", id).Limit(1).Find(&quotas).Error; err != nil {
+		return err
+	}
+
+	if len(quotas) != 0 {
+		usage.LimitBytes = quotas[0].LimitBytes
+	}
+
+	return nil
+}
+
+// GetRemainingQuota returns whichever of the project's and the user's quota has the fewest bytes remaining.
+// If neither has a quota then the returned usage is for the project and is not limited.
+func (s *GormQuotaStor) GetRemainingQuota(projectID, userID int) (*mcmodel.QuotaUsage, error) {
+	projectUsage, err := s.GetProjectQuotaUsage(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	userUsage, err := s.GetUserQuotaUsage(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case !userUsage.IsLimited():
+		return projectUsage, nil
+	case !projectUsage.IsLimited():
+		return userUsage, nil
+	case userUsage.RemainingBytes() < projectUsage.RemainingBytes():
+		return userUsage, nil
+	default:
+		return projectUsage, nil
+	}
+}
+
+// CheckQuota returns a *QuotaExceededError if storing size more bytes in the project would go over either
+// the project's or the user's quota.
+func (s *GormQuotaStor) CheckQuota(projectID, userID int, size int64) error {
+	usage, err := s.GetRemainingQuota(projectID, userID)
+	if err != nil {
+		return err
+	}
+
+	if usage.IsLimited() && size > usage.RemainingBytes() {
+		return &QuotaExceededError{Usage: *usage, RequestedBytes: size}
+	}
+
+	return nil
+}
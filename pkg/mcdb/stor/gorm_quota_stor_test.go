@@ -0,0 +1,73 @@
+package stor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotas(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	owner := b.User("owner")
+	project := b.Project("proj", owner)
+	quotaStor := NewGormQuotaStor(db)
+	projectID := project.ID
+
+	dir := b.Dir(project, project.RootDir, "d")
+	b.FileVersion(project, dir, "a.txt", 30)
+	b.File(project, dir, "a.txt", 20)
+	deleted := b.File(project, dir, "b.txt", 1000)
+	require.NoError(t, newTestFileStor(t, db).DeleteFile(deleted))
+	require.NoError(t, db.Model(project).Update("size", 100).Error)
+
+	// No quotas
+	usage, err := quotaStor.GetProjectQuotaUsage(projectID)
+	require.NoError(t, err)
+	require.False(t, usage.IsLimited())
+	require.Equal(t, int64(100), usage.UsedBytes)
+	require.NoError(t, quotaStor.CheckQuota(projectID, owner.ID, 1<<40))
+
+	usage, err = quotaStor.GetUserQuotaUsage(owner.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(50), usage.UsedBytes)
+
+	// A project quota
+	require.NoError(t, quotaStor.SetProjectQuota(projectID, 150))
+	require.NoError(t, quotaStor.CheckQuota(projectID, owner.ID, 50))
+
+	err = quotaStor.CheckQuota(projectID, owner.ID, 51)
+	require.True(t, errors.Is(err, ErrQuotaExceeded))
+	var quotaErr *QuotaExceededError
+	require.ErrorAs(t, err, &quotaErr)
+	require.Equal(t, mcmodel.QuotaUsage{Scope: mcmodel.QuotaScopeProject, ID: projectID, LimitBytes: 150, UsedBytes: 100}, quotaErr.Usage)
+	require.Equal(t, int64(51), quotaErr.RequestedBytes)
+
+	// A tighter user quota wins
+	require.NoError(t, quotaStor.SetUserQuota(owner.ID, 60))
+	usage, err = quotaStor.GetRemainingQuota(projectID, owner.ID)
+	require.NoError(t, err)
+	require.Equal(t, mcmodel.QuotaScopeUser, usage.Scope)
+	require.Equal(t, int64(10), usage.RemainingBytes())
+
+	// Updating a quota replaces it, and a limit of 0 removes it
+	require.NoError(t, quotaStor.SetUserQuota(owner.ID, 500))
+	usage, err = quotaStor.GetRemainingQuota(projectID, owner.ID)
+	require.NoError(t, err)
+	require.Equal(t, mcmodel.QuotaScopeProject, usage.Scope)
+
+	require.NoError(t, quotaStor.SetProjectQuota(projectID, 0))
+	usage, err = quotaStor.GetRemainingQuota(projectID, owner.ID)
+	require.NoError(t, err)
+	require.Equal(t, mcmodel.QuotaUsage{Scope: mcmodel.QuotaScopeUser, ID: owner.ID, LimitBytes: 500, UsedBytes: 50}, *usage)
+
+	var count int64
+	require.NoError(t, db.Model(&mcmodel.StorageQuota{}).Count(&count).Error)
+	require.Equal(t, int64(1), count)
+
+	_, err = quotaStor.GetProjectQuotaUsage(projectID + 1)
+	require.True(t, IsRecordNotFound(err))
+}
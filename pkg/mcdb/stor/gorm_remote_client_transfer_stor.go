@@ -71,7 +71,7 @@ func (s *GormRemoteClientTransferStor) DeleteRemoteClientTransferByTransferID(tr
 func (s *GormRemoteClientTransferStor) GetAllTransfersForRemoteClient(remoteClientID int) ([]mcmodel.RemoteClientTransfer, error) {
 	var transfers []mcmodel.RemoteClientTransfer
 	err := s.db.Where("remote_client_id = ?", remoteClientID).Find(&transfers).Error
-	return nil, err
+	return transfers, err
 }
 
 func (s *GormRemoteClientTransferStor) GetAllUploadTransfersForRemoteClient(remoteClientID int) ([]mcmodel.RemoteClientTransfer, error) {
@@ -85,3 +85,10 @@ func (s *GormRemoteClientTransferStor) GetAllDownloadTransfersForRemoteClient(re
 	err := s.db.Where("remote_client_id = ? and transfer_type = ?", remoteClientID, "download").Find(&transfers).Error
 	return transfers, err
 }
+
+// GetActiveTransfers returns all transfers that haven't completed, along with the file each is writing to.
+func (s *GormRemoteClientTransferStor) GetActiveTransfers() ([]mcmodel.RemoteClientTransfer, error) {
+	var transfers []mcmodel.RemoteClientTransfer
+	err := s.db.Preload("File").Where("state <> ?", "complete").Find(&transfers).Error
+	return transfers, err
+}
@@ -1,11 +1,14 @@
 package stor
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 
 	"github.com/apex/log"
 	"github.com/hashicorp/go-uuid"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 	"github.com/materials-commons/hydra/pkg/mcdb/mime"
 	"gorm.io/gorm"
@@ -14,10 +17,16 @@ import (
 type GormTransferRequestStor struct {
 	db       *gorm.DB
 	mcfsRoot string
+	blobs    blobstore.BlobStore
 }
 
 func NewGormTransferRequestStor(db *gorm.DB, mcfsRoot string) *GormTransferRequestStor {
-	return &GormTransferRequestStor{db: db, mcfsRoot: mcfsRoot}
+	return NewGormTransferRequestStorWithBlobStore(db, mcfsRoot, blobstore.NewLocalBlobStore(mcfsRoot))
+}
+
+// NewGormTransferRequestStorWithBlobStore creates a GormTransferRequestStor that uses the given blob store.
+func NewGormTransferRequestStorWithBlobStore(db *gorm.DB, mcfsRoot string, blobs blobstore.BlobStore) *GormTransferRequestStor {
+	return &GormTransferRequestStor{db: db, mcfsRoot: mcfsRoot, blobs: blobs}
 }
 
 // CreateTransferRequest creates a new TransferRequest, filling in the ID and UUID for the transfer request
@@ -53,13 +62,19 @@ func (s *GormTransferRequestStor) ListTransferRequests() ([]mcmodel.TransferRequ
 }
 
 // MarkFileReleased should only be called for files that were created or opened with the Write flag set.
-func (s *GormTransferRequestStor) MarkFileReleased(file *mcmodel.File, checksum string, projectID int, totalBytes int64) error {
-	finfo, err := os.Stat(file.ToUnderlyingFilePath(s.mcfsRoot))
+func (s *GormTransferRequestStor) MarkFileReleased(file *mcmodel.File, sums digest.Sums, projectID int, totalBytes int64) error {
+	finfo, err := s.blobs.Stat(file.BlobKey())
 	if err != nil {
-		log.Errorf("MarkFileReleased Stat %s failed: %s", file.ToUnderlyingFilePath(s.mcfsRoot), err)
+		log.Errorf("MarkFileReleased Stat %s failed: %s", file.BlobKey(), err)
 		return err
 	}
 
+	var mimeType string
+	if !sums.IsZero() {
+		// Detect the type again now that the contents have been written.
+		mimeType = detectMimeType(s.blobs, file)
+	}
+
 	return WithTxRetry(s.db, func(tx *gorm.DB) error {
 		// To set file as the current (ie viewable) version we first need to set all its previous
 		// versions to have current set to false.
@@ -80,15 +95,17 @@ func (s *GormTransferRequestStor) MarkFileReleased(file *mcmodel.File, checksum
 		}
 
 		// Now we can update the meta data on the current file. This includes, the size, current, and if there is
-		// a new computed checksum, also update the checksum field.
+		// new computed checksums, also update the checksum fields.
 		switch {
-		case checksum != "":
+		case !sums.IsZero():
 			// If we are here then the file was written to so besides updating the file meta data we also have
 			// to update the project size meta data
 			fileMetadata := mcmodel.File{
-				Size:     uint64(finfo.Size()),
+				Size:     uint64(finfo.Size),
 				Current:  true,
-				Checksum: checksum,
+				Checksum: sums.MD5,
+				Sha256:   sums.SHA256,
+				MimeType: mimeType,
 			}
 
 			if err := tx.Model(file).Updates(&fileMetadata).Error; err != nil {
@@ -105,7 +122,7 @@ func (s *GormTransferRequestStor) MarkFileReleased(file *mcmodel.File, checksum
 		default:
 			// If we are here then the file was opened for read/write but it was never written to. In this situation there
 			// is no checksum that has been computed, so don't update the field.
-			return tx.Model(file).Updates(mcmodel.File{Size: uint64(finfo.Size()), Current: true}).Error
+			return tx.Model(file).Updates(mcmodel.File{Size: uint64(finfo.Size), Current: true}).Error
 		}
 	})
 }
@@ -127,9 +144,9 @@ func (s *GormTransferRequestStor) CreateNewFile(file, dir *mcmodel.File, transfe
 		return file, trf, err
 	}
 
-	if err := os.MkdirAll(file.ToUnderlyingDirPath(s.mcfsRoot), 0755); err != nil {
+	if err := s.makeLocalBlobDir(file); err != nil {
 		// TODO: If this fails then we should remove the created file from the database
-		log.Errorf("os.MkdirAll failed (%s): %s\n", file.ToUnderlyingDirPath(s.mcfsRoot), err)
+		log.Errorf("os.MkdirAll failed (%s): %s\n", file.BlobKey(), err)
 		return nil, nil, err
 	}
 
@@ -145,9 +162,9 @@ func (s *GormTransferRequestStor) CreateNewFileVersion(file, dir *mcmodel.File,
 		return file, err
 	}
 
-	if err := os.MkdirAll(file.ToUnderlyingDirPath(s.mcfsRoot), 0755); err != nil {
+	if err := s.makeLocalBlobDir(file); err != nil {
 		// TODO: If this fails then we should remove the created file from the database
-		log.Errorf("os.MkdirAll failed (%s): %s\n", file.ToUnderlyingDirPath(s.mcfsRoot), err)
+		log.Errorf("os.MkdirAll failed (%s): %s\n", file.BlobKey(), err)
 		return nil, err
 	}
 
@@ -155,6 +172,18 @@ func (s *GormTransferRequestStor) CreateNewFileVersion(file, dir *mcmodel.File,
 	return file, nil
 }
 
+// makeLocalBlobDir creates the directory the file's blob goes in when the blob store is on the local
+// filesystem. The FUSE bridge (mcbridgefs) writes new files there directly rather than through the blob
+// store. Other stores create whatever they need when the blob is created, so there is nothing to do.
+func (s *GormTransferRequestStor) makeLocalBlobDir(file *mcmodel.File) error {
+	path, err := blobstore.LocalPath(s.blobs, file.BlobKey())
+	if errors.Is(err, blobstore.ErrNotLocal) {
+		return nil
+	}
+
+	return os.MkdirAll(filepath.Dir(path), 0755)
+}
+
 // addFileToDatabase will add an mcmodel.File entry and an associated mcmodel.TransferRequestFile entry
 // to the database. The file parameter must be filled out, except for the UUID which will be generated
 // for the file. The TransferRequestFile will be created based on the file entry.
@@ -0,0 +1,35 @@
+package stor
+
+import (
+	"testing"
+
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkFileReleasedDetectsTypeFromBlob(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	user := b.User("user1")
+	proj := b.Project("proj1", user)
+	f := b.File(proj, proj.RootDir, "scan", 0)
+
+	// The blobs aren't under mcfsRoot, so the contents can only be found through the blob store.
+	blobs := blobstore.NewLocalBlobStore(t.TempDir())
+	w, err := blobs.Create(f.BlobKey())
+	require.NoError(t, err)
+	_, err = w.Write([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	trStor := NewGormTransferRequestStorWithBlobStore(db, t.TempDir(), blobs)
+	require.NoError(t, trStor.MarkFileReleased(f, digest.Sums{MD5: "m1", SHA256: "s1"}, proj.ID, 16))
+
+	var released mcmodel.File
+	require.NoError(t, db.First(&released, f.ID).Error)
+	require.Equal(t, "image/png", released.MimeType)
+	require.Equal(t, uint64(16), released.Size)
+}
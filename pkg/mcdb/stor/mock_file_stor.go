@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 )
 
@@ -122,10 +124,17 @@ func (m *MockFileStor) Root() string {
 	return m.root
 }
 
+// Blobs returns a local blob store rooted at the mock's root directory
+func (m *MockFileStor) Blobs() blobstore.BlobStore {
+	return blobstore.NewLocalBlobStore(m.root)
+}
+
 // Implement other methods of the FileStor interface with minimal functionality
 
 // UpdateMetadataForFileAndProject updates file metadata
-func (m *MockFileStor) UpdateMetadataForFileAndProject(file *mcmodel.File, checksum string, totalBytes int64) error {
+func (m *MockFileStor) UpdateMetadataForFileAndProject(file *mcmodel.File, sums digest.Sums, totalBytes int64) error {
+	file.Checksum = sums.MD5
+	file.Sha256 = sums.SHA256
 	return nil
 }
 
@@ -180,6 +189,109 @@ func (m *MockFileStor) PointAtExistingIfExists(file *mcmodel.File) (bool, error)
 }
 
 // DoneWritingToFile marks a file as done writing
-func (m *MockFileStor) DoneWritingToFile(file *mcmodel.File, checksum string, size int64, conversionStore ConversionStor) (bool, error) {
+func (m *MockFileStor) DoneWritingToFile(file *mcmodel.File, sums digest.Sums, size int64, conversionStore ConversionStor) (bool, error) {
+	file.Checksum = sums.MD5
+	file.Sha256 = sums.SHA256
 	return false, nil
 }
+
+// DeleteFileByID deletes a file
+func (m *MockFileStor) DeleteFileByID(ID int) error {
+	return nil
+}
+
+// FindReferencedUUIDs returns the uuids that are referenced
+func (m *MockFileStor) FindReferencedUUIDs(uuids []string) (map[string]bool, error) {
+	return make(map[string]bool), nil
+}
+
+// ListFilesAfterID lists files after the given ID
+func (m *MockFileStor) ListFilesAfterID(projectID, afterID, limit int) ([]mcmodel.File, error) {
+	return []mcmodel.File{}, nil
+}
+
+// ListFilesMissingSha256 lists files without a SHA-256
+func (m *MockFileStor) ListFilesMissingSha256(projectID, afterID, limit int) ([]mcmodel.File, error) {
+	return []mcmodel.File{}, nil
+}
+
+// SetFileSha256 sets the SHA-256 for a file
+func (m *MockFileStor) SetFileSha256(file *mcmodel.File, sha256 string) error {
+	file.Sha256 = sha256
+	return nil
+}
+
+// SetFileMimeType sets the MIME type for a file
+func (m *MockFileStor) SetFileMimeType(file *mcmodel.File, mimeType string) error {
+	file.MimeType = mimeType
+	return nil
+}
+
+// MoveFile moves a file
+func (m *MockFileStor) MoveFile(file, toDir *mcmodel.File, name string) (*mcmodel.File, error) {
+	file.DirectoryID = toDir.ID
+	file.Name = name
+	return file, nil
+}
+
+// MoveDirectory moves a directory
+func (m *MockFileStor) MoveDirectory(dir, toParent *mcmodel.File, name string) (*mcmodel.File, error) {
+	dir.DirectoryID = toParent.ID
+	dir.Name = name
+	dir.Path = filepath.Join(toParent.Path, name)
+	return dir, nil
+}
+
+// DeleteFile deletes a file
+func (m *MockFileStor) DeleteFile(file *mcmodel.File) error {
+	return nil
+}
+
+// DeleteDirectory deletes a directory
+func (m *MockFileStor) DeleteDirectory(dir *mcmodel.File, recursive bool) error {
+	return nil
+}
+
+// ListTrash lists the deleted files in a project
+func (m *MockFileStor) ListTrash(projectID int) ([]mcmodel.File, error) {
+	return []mcmodel.File{}, nil
+}
+
+// RestoreFromTrash restores a deleted file
+func (m *MockFileStor) RestoreFromTrash(entry *mcmodel.File) (*mcmodel.File, error) {
+	return entry, nil
+}
+
+// PurgeFromTrash permanently removes a deleted file
+func (m *MockFileStor) PurgeFromTrash(entry *mcmodel.File) ([]string, error) {
+	return nil, nil
+}
+
+// ListFileVersions lists the versions of a file
+func (m *MockFileStor) ListFileVersions(projectID int, path string) ([]mcmodel.File, error) {
+	file, err := m.GetFileByPath(projectID, path)
+	if err != nil {
+		return nil, err
+	}
+	return []mcmodel.File{*file}, nil
+}
+
+// GetFileVersion gets a version of a file
+func (m *MockFileStor) GetFileVersion(projectID int, path string, versionID int) (*mcmodel.File, error) {
+	return m.GetFileByID(versionID)
+}
+
+// PromoteFileVersion makes a version of a file the current version
+func (m *MockFileStor) PromoteFileVersion(projectID int, path string, versionID int) (*mcmodel.File, error) {
+	file, err := m.GetFileByID(versionID)
+	if err != nil {
+		return nil, err
+	}
+	file.Current = true
+	return file, nil
+}
+
+// DiffFileVersions compares two versions of a file
+func (m *MockFileStor) DiffFileVersions(projectID int, path string, fromVersionID, toVersionID int) ([]mcmodel.FileVersionDiff, error) {
+	return []mcmodel.FileVersionDiff{}, nil
+}
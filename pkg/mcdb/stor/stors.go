@@ -1,6 +1,9 @@
 package stor
 
 import (
+	"github.com/materials-commons/hydra/pkg/authz"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 	"gorm.io/gorm"
 )
@@ -12,7 +15,7 @@ type ConversionStor interface {
 type FileStor interface {
 	GetFileByID(fileID int) (*mcmodel.File, error)
 	GetFileByUUID(fileUUID string) (*mcmodel.File, error)
-	UpdateMetadataForFileAndProject(file *mcmodel.File, checksum string, totalBytes int64) error
+	UpdateMetadataForFileAndProject(file *mcmodel.File, sums digest.Sums, totalBytes int64) error
 	UpdateFile(file, updates *mcmodel.File) (*mcmodel.File, error)
 	SetUsesToNull(file *mcmodel.File) (*mcmodel.File, error)
 	SetFileAsCurrent(file *mcmodel.File) (*mcmodel.File, error)
@@ -25,14 +28,31 @@ type FileStor interface {
 	GetFileByPath(projectID int, path string) (*mcmodel.File, error)
 	UpdateFileUses(file *mcmodel.File, uuid string, fileID int) error
 	PointAtExistingIfExists(file *mcmodel.File) (bool, error)
-	DoneWritingToFile(file *mcmodel.File, checksum string, size int64, conversionStore ConversionStor) (bool, error)
-	GetMatchingFileInDirectory(directoryID int, checksum string, name string) (*mcmodel.File, error)
+	DoneWritingToFile(file *mcmodel.File, sums digest.Sums, size int64, conversionStore ConversionStor) (bool, error)
+	GetMatchingFileInDirectory(directoryID int, sums digest.Sums, name string) (*mcmodel.File, error)
 	SetFileHealthMissing(file *mcmodel.File, determinedBy string, source string) (*mcmodel.File, error)
 	SetFileHealthFixed(file *mcmodel.File, fixedBy string, source string) (*mcmodel.File, error)
-	FindMatchingFileByChecksum(checksum string) (*mcmodel.File, error)
-	FindMatchingFileByChecksumAndPath(projectID int, filePath string, checksum string) (*mcmodel.File, error)
+	FindMatchingFileByChecksum(sums digest.Sums) (*mcmodel.File, error)
+	FindMatchingFileByChecksumAndPath(projectID int, filePath string, sums digest.Sums) (*mcmodel.File, error)
+	ListFilesMissingSha256(projectID, afterID, limit int) ([]mcmodel.File, error)
+	SetFileSha256(file *mcmodel.File, sha256 string) error
+	SetFileMimeType(file *mcmodel.File, mimeType string) error
 	DeleteFileByID(ID int) error
+	FindReferencedUUIDs(uuids []string) (map[string]bool, error)
+	ListFilesAfterID(projectID, afterID, limit int) ([]mcmodel.File, error)
+	MoveFile(file, toDir *mcmodel.File, name string) (*mcmodel.File, error)
+	MoveDirectory(dir, toParent *mcmodel.File, name string) (*mcmodel.File, error)
+	DeleteFile(file *mcmodel.File) error
+	DeleteDirectory(dir *mcmodel.File, recursive bool) error
+	ListTrash(projectID int) ([]mcmodel.File, error)
+	RestoreFromTrash(entry *mcmodel.File) (*mcmodel.File, error)
+	PurgeFromTrash(entry *mcmodel.File) ([]string, error)
+	ListFileVersions(projectID int, path string) ([]mcmodel.File, error)
+	GetFileVersion(projectID int, path string, versionID int) (*mcmodel.File, error)
+	PromoteFileVersion(projectID int, path string, versionID int) (*mcmodel.File, error)
+	DiffFileVersions(projectID int, path string, fromVersionID, toVersionID int) ([]mcmodel.FileVersionDiff, error)
 	Root() string
+	Blobs() blobstore.BlobStore
 }
 
 type ProjectStor interface {
@@ -43,8 +63,21 @@ type ProjectStor interface {
 	UpdateProjectSizeAndFileCount(projectID int, size int64, fileCount int) error
 	UpdateProjectDirectoryCount(projectID int, directoryCount int) error
 	UserCanAccessProject(userID, projectID int) bool
+	GetUserProjectRole(userID, projectID int) (authz.Role, error)
+	AddViewerToProject(project *mcmodel.Project, user *mcmodel.User) error
 	AddMemberToProject(project *mcmodel.Project, user *mcmodel.User) error
 	AddAdminToProject(project *mcmodel.Project, user *mcmodel.User) error
+	ListProjectIDs() ([]int, error)
+	RebuildProjectStats(projectID int, dryRun bool) (*mcmodel.ProjectStatsReport, error)
+}
+
+type QuotaStor interface {
+	SetProjectQuota(projectID int, limitBytes int64) error
+	SetUserQuota(userID int, limitBytes int64) error
+	GetProjectQuotaUsage(projectID int) (*mcmodel.QuotaUsage, error)
+	GetUserQuotaUsage(userID int) (*mcmodel.QuotaUsage, error)
+	GetRemainingQuota(projectID, userID int) (*mcmodel.QuotaUsage, error)
+	CheckQuota(projectID, userID int, size int64) error
 }
 
 type TransferRequestFileStor interface {
@@ -57,7 +90,7 @@ type TransferRequestFileStor interface {
 type TransferRequestStor interface {
 	CreateTransferRequest(tr *mcmodel.TransferRequest) (*mcmodel.TransferRequest, error)
 	ListTransferRequests() ([]mcmodel.TransferRequest, error)
-	MarkFileReleased(file *mcmodel.File, checksum string, projectID int, totalBytes int64) error
+	MarkFileReleased(file *mcmodel.File, sums digest.Sums, projectID int, totalBytes int64) error
 	MarkFileAsOpen(file *mcmodel.File) error
 	CreateNewFile(file, dir *mcmodel.File, transferRequest *mcmodel.TransferRequest) (*mcmodel.File, *mcmodel.TransferRequestFile, error)
 	CreateNewFileVersion(file, dir *mcmodel.File, transferRequest *mcmodel.TransferRequest) (*mcmodel.File, error)
@@ -87,6 +120,17 @@ type RemoteClientTransferStor interface {
 	GetAllTransfersForRemoteClient(remoteClientID int) ([]mcmodel.RemoteClientTransfer, error)
 	GetAllUploadTransfersForRemoteClient(remoteClientID int) ([]mcmodel.RemoteClientTransfer, error)
 	GetAllDownloadTransfersForRemoteClient(remoteClientID int) ([]mcmodel.RemoteClientTransfer, error)
+	GetActiveTransfers() ([]mcmodel.RemoteClientTransfer, error)
+}
+
+type PartialTransferFileStor interface {
+	CreatePartialTransferFile(ptf *mcmodel.PartialTransferFile) (*mcmodel.PartialTransferFile, error)
+	UpdateFileSize(transferID string, size int64) error
+	GetUploadingFiles() ([]mcmodel.PartialTransferFile, error)
+	GetPartialTransferFileByID(transferID string) (*mcmodel.PartialTransferFile, error)
+	DeletePartialTransferFile(transferID string) error
+	MarkComplete(transferID string, hash string) error
+	MarkFailed(transferID string, reason string) error
 }
 
 type UserStor interface {
@@ -97,15 +141,34 @@ type UserStor interface {
 	GetUserByAPIToken(apitoken string) (*mcmodel.User, error)
 }
 
+type APITokenStor interface {
+	CreateAPIToken(token *mcmodel.APIToken) (string, *mcmodel.APIToken, error)
+	GetAPITokenBySecret(secret string) (*mcmodel.APIToken, error)
+	ListAPITokensForUser(userID int) ([]mcmodel.APIToken, error)
+	RevokeAPIToken(userID, tokenID int) (*mcmodel.APIToken, error)
+}
+
+type DatasetStor interface {
+	GetDatasetByID(datasetID int) (*mcmodel.Dataset, error)
+	GetDatasetProject(dataset *mcmodel.Dataset) (*mcmodel.Project, error)
+	ListSelectedFiles(dataset *mcmodel.Dataset) ([]mcmodel.File, error)
+	ListDatasetEntities(dataset *mcmodel.Dataset) ([]mcmodel.Entity, error)
+	ListActivitiesForEntities(entityIDs []int) ([]mcmodel.Activity, map[int][]int, error)
+}
+
 type EntityStor interface {
 	GetProjectEntityByID(projectID int, entityID int) (*mcmodel.Entity, error)
 	ListProjectEntitiesByCategory(projectID int, entityType string) ([]mcmodel.Entity, error)
 	CreateEntity(entity *mcmodel.Entity) (*mcmodel.Entity, error)
+	ListEntityActivities(entityID int) ([]mcmodel.Activity, error)
+	ListEntityFiles(entityID int) ([]mcmodel.File, error)
+	ListFileEntities(fileID int) ([]mcmodel.Entity, error)
 }
 
 type ActivityStor interface {
 	GetProjectActivityByID(projectID int, activityID int) (*mcmodel.Activity, error)
 	CreateActivity(activity *mcmodel.Activity) (*mcmodel.Activity, error)
+	ListActivityEntities(activityID int) ([]mcmodel.Entity, error)
 }
 
 //type ClientTransferStor interface {
@@ -124,20 +187,38 @@ type Stors struct {
 	TransferRequestStor      TransferRequestStor
 	GlobusTransferStor       GlobusTransferStor
 	UserStor                 UserStor
+	APITokenStor             APITokenStor
 	RemoteClientStor         RemoteClientStor
 	RemoteClientTransferStor RemoteClientTransferStor
+	PartialTransferFileStor  PartialTransferFileStor
+	QuotaStor                QuotaStor
+	DatasetStor              DatasetStor
+	EntityStor               EntityStor
+	ActivityStor             ActivityStor
 }
 
+// NewGormStors creates the Stors with file contents kept on the local filesystem under mcfsRoot.
 func NewGormStors(db *gorm.DB, mcfsRoot string) *Stors {
+	return NewGormStorsWithBlobStore(db, mcfsRoot, blobstore.NewLocalBlobStore(mcfsRoot))
+}
+
+// NewGormStorsWithBlobStore creates the Stors with file contents kept in blobs.
+func NewGormStorsWithBlobStore(db *gorm.DB, mcfsRoot string, blobs blobstore.BlobStore) *Stors {
 	return &Stors{
 		ConversionStor:           NewGormConversionStor(db),
-		FileStor:                 NewGormFileStor(db, mcfsRoot),
+		FileStor:                 NewGormFileStorWithBlobStore(db, mcfsRoot, blobs),
 		ProjectStor:              NewGormProjectStor(db),
 		TransferRequestFileStor:  NewGormTransferRequestFileStor(db),
-		TransferRequestStor:      NewGormTransferRequestStor(db, mcfsRoot),
+		TransferRequestStor:      NewGormTransferRequestStorWithBlobStore(db, mcfsRoot, blobs),
 		GlobusTransferStor:       NewGormGlobusTransferStor(db),
 		UserStor:                 NewGormUserStor(db),
+		APITokenStor:             NewGormAPITokenStor(db),
 		RemoteClientStor:         NewGormRemoteClientStor(db),
 		RemoteClientTransferStor: NewGormRemoteClientTransferStor(db),
+		PartialTransferFileStor:  NewGormPartialTransferFileStor(db),
+		QuotaStor:                NewGormQuotaStor(db),
+		DatasetStor:              NewGormDatasetStor(db),
+		EntityStor:               NewGormEntityStor(db),
+		ActivityStor:             NewGormActivityStor(db),
 	}
 }
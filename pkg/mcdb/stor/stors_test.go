@@ -0,0 +1,238 @@
+package stor
+
+import (
+	"testing"
+
+	"github.com/materials-commons/hydra/pkg/authz"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStorsOnSQLite exercises the stores that don't have tests of their own against the migrated schema.
+func TestStorsOnSQLite(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	stors := NewGormStors(db, t.TempDir())
+
+	owner := b.User("owner")
+	member := b.User("member")
+	outsider := b.User("outsider")
+	proj := b.Project("proj", owner)
+	f := b.File(proj, proj.RootDir, "f.txt", 10)
+
+	t.Run("ProjectStor", func(t *testing.T) {
+		p, err := stors.ProjectStor.CreateProject(&mcmodel.Project{Name: "Created Project", OwnerID: owner.ID})
+		require.NoError(t, err)
+		require.Equal(t, "created-project", p.Slug)
+
+		p, err = stors.ProjectStor.GetProjectBySlug("created-project")
+		require.NoError(t, err)
+		root, err := stors.FileStor.GetDirByPath(p.ID, "/")
+		require.NoError(t, err)
+		require.Equal(t, p.ID, root.ProjectID)
+
+		require.NoError(t, stors.ProjectStor.AddMemberToProject(proj, member))
+		require.True(t, stors.ProjectStor.UserCanAccessProject(owner.ID, proj.ID))
+		require.True(t, stors.ProjectStor.UserCanAccessProject(member.ID, proj.ID))
+		require.False(t, stors.ProjectStor.UserCanAccessProject(outsider.ID, proj.ID))
+
+		projects, err := stors.ProjectStor.GetProjectsForUser(member.ID)
+		require.NoError(t, err)
+		require.Len(t, projects, 1)
+
+		viewer := b.User("viewer")
+		require.NoError(t, stors.ProjectStor.AddViewerToProject(proj, viewer))
+		require.NoError(t, stors.ProjectStor.AddViewerToProject(proj, viewer))
+		require.True(t, stors.ProjectStor.UserCanAccessProject(viewer.ID, proj.ID))
+		projects, err = stors.ProjectStor.GetProjectsForUser(viewer.ID)
+		require.NoError(t, err)
+		require.Len(t, projects, 1)
+
+		for user, want := range map[*mcmodel.User]authz.Role{
+			owner:    authz.Admin,
+			member:   authz.Contributor,
+			viewer:   authz.Viewer,
+			outsider: authz.None,
+		} {
+			role, err := stors.ProjectStor.GetUserProjectRole(user.ID, proj.ID)
+			require.NoError(t, err)
+			require.Equal(t, want, role, user.Name)
+		}
+
+		// A project2user row on its own doesn't grant access.
+		listed := b.User("listed")
+		require.NoError(t, db.Create(&mcmodel.Project2User{ProjectID: proj.ID, UserID: listed.ID}).Error)
+		role, err := stors.ProjectStor.GetUserProjectRole(listed.ID, proj.ID)
+		require.NoError(t, err)
+		require.Equal(t, authz.None, role)
+		require.False(t, stors.ProjectStor.UserCanAccessProject(listed.ID, proj.ID))
+
+		// A team admin is an admin even when they're also a viewer.
+		admin := b.User("admin")
+		b.AddViewer(proj, admin)
+		require.NoError(t, stors.ProjectStor.AddAdminToProject(proj, admin))
+		role, err = stors.ProjectStor.GetUserProjectRole(admin.ID, proj.ID)
+		require.NoError(t, err)
+		require.Equal(t, authz.Admin, role)
+
+		role, err = stors.ProjectStor.GetUserProjectRole(owner.ID, proj.ID+100)
+		require.NoError(t, err)
+		require.Equal(t, authz.None, role)
+
+		require.NoError(t, stors.ProjectStor.UpdateProjectSizeAndFileCount(proj.ID, 5, 1))
+		p, err = stors.ProjectStor.GetProjectByID(proj.ID)
+		require.NoError(t, err)
+		require.Equal(t, int64(15), p.Size)
+		require.Equal(t, 2, p.FileCount)
+	})
+
+	t.Run("UserStor", func(t *testing.T) {
+		u, err := stors.UserStor.CreateUser(&mcmodel.User{Name: "new", Email: "new@test.com", Slug: "new", ApiToken: "token"})
+		require.NoError(t, err)
+		require.NotEmpty(t, u.UUID)
+
+		found, err := stors.UserStor.GetUserByEmail("new@test.com")
+		require.NoError(t, err)
+		require.Equal(t, u.ID, found.ID)
+
+		found, err = stors.UserStor.GetUserByAPIToken("token")
+		require.NoError(t, err)
+		require.Equal(t, u.ID, found.ID)
+
+		found, err = stors.UserStor.GetUserBySlug("owner")
+		require.NoError(t, err)
+		require.Equal(t, owner.ID, found.ID)
+	})
+
+	t.Run("APITokenStor", func(t *testing.T) {
+		_, _, err := stors.APITokenStor.CreateAPIToken(&mcmodel.APIToken{UserID: member.ID, Scope: "admin"})
+		require.ErrorIs(t, err, ErrInvalidAPITokenScope)
+
+		secret, token, err := stors.APITokenStor.CreateAPIToken(&mcmodel.APIToken{
+			Name: "instrument", UserID: member.ID, ProjectID: proj.ID, Scope: mcmodel.APITokenScopeWrite,
+		})
+		require.NoError(t, err)
+		require.True(t, mcmodel.IsAPITokenSecret(secret))
+		require.NotContains(t, token.SecretHash, secret)
+
+		found, err := stors.APITokenStor.GetAPITokenBySecret(secret)
+		require.NoError(t, err)
+		require.Equal(t, token.ID, found.ID)
+		require.Equal(t, member.ID, found.User.ID)
+		require.True(t, found.CanWrite())
+		require.False(t, found.CanRead())
+		require.False(t, found.CanAccessProject(proj.ID+1))
+
+		_, err = stors.APITokenStor.GetAPITokenBySecret(secret + "x")
+		require.True(t, IsRecordNotFound(err))
+
+		// Only the token's owner can revoke it.
+		_, err = stors.APITokenStor.RevokeAPIToken(owner.ID, token.ID)
+		require.True(t, IsRecordNotFound(err))
+		revoked, err := stors.APITokenStor.RevokeAPIToken(member.ID, token.ID)
+		require.NoError(t, err)
+		require.True(t, revoked.IsRevoked())
+
+		tokens, err := stors.APITokenStor.ListAPITokensForUser(member.ID)
+		require.NoError(t, err)
+		require.Len(t, tokens, 1)
+		require.True(t, tokens[0].IsRevoked())
+	})
+
+	t.Run("EntityAndActivityStor", func(t *testing.T) {
+		entityStor := stors.EntityStor
+		e, err := entityStor.CreateEntity(&mcmodel.Entity{Name: "S1", Category: "computational", ProjectID: proj.ID, OwnerID: owner.ID})
+		require.NoError(t, err)
+		found, err := entityStor.GetProjectEntityByID(proj.ID, e.ID)
+		require.NoError(t, err)
+		require.Equal(t, "S1", found.Name)
+		_, err = entityStor.GetProjectEntityByID(proj.ID+1, e.ID)
+		require.True(t, IsRecordNotFound(err))
+		entities, err := entityStor.ListProjectEntitiesByCategory(proj.ID, "computational")
+		require.NoError(t, err)
+		require.Len(t, entities, 1)
+
+		activityStor := stors.ActivityStor
+		a, err := activityStor.CreateActivity(&mcmodel.Activity{Name: "P1", ProjectID: proj.ID, OwnerID: owner.ID})
+		require.NoError(t, err)
+		foundActivity, err := activityStor.GetProjectActivityByID(proj.ID, a.ID)
+		require.NoError(t, err)
+		require.Equal(t, "P1", foundActivity.Name)
+
+		b.Link(a, e)
+		b.AddFileToEntity(e, f)
+		activities, err := entityStor.ListEntityActivities(e.ID)
+		require.NoError(t, err)
+		require.Len(t, activities, 1)
+		require.Equal(t, a.ID, activities[0].ID)
+		entities, err = activityStor.ListActivityEntities(a.ID)
+		require.NoError(t, err)
+		require.Len(t, entities, 1)
+		require.Equal(t, e.ID, entities[0].ID)
+		files, err := entityStor.ListEntityFiles(e.ID)
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		require.Equal(t, f.ID, files[0].ID)
+		entities, err = entityStor.ListFileEntities(f.ID)
+		require.NoError(t, err)
+		require.Len(t, entities, 1)
+		require.Equal(t, e.ID, entities[0].ID)
+	})
+
+	t.Run("TransferStors", func(t *testing.T) {
+		tr, err := stors.TransferRequestStor.CreateTransferRequest(&mcmodel.TransferRequest{State: "open", ProjectID: proj.ID, OwnerID: owner.ID})
+		require.NoError(t, err)
+		found, err := stors.TransferRequestStor.GetTransferRequestForProjectAndUser(proj.ID, owner.ID)
+		require.NoError(t, err)
+		require.Equal(t, tr.ID, found.ID)
+		require.NoError(t, stors.TransferRequestStor.CloseTransferRequestByUUID(tr.UUID))
+		open, err := stors.TransferRequestStor.ListTransferRequests()
+		require.NoError(t, err)
+		require.Empty(t, open)
+
+		gt, err := stors.GlobusTransferStor.CreateGlobusTransfer(&mcmodel.GlobusTransfer{ProjectID: proj.ID, OwnerID: owner.ID, GlobusIdentityID: "gid", TransferRequestID: tr.ID})
+		require.NoError(t, err)
+		foundGT, err := stors.GlobusTransferStor.GetGlobusTransferByGlobusIdentityID("gid")
+		require.NoError(t, err)
+		require.Equal(t, gt.ID, foundGT.ID)
+
+		rc, err := stors.RemoteClientStor.CreateRemoteClient(&mcmodel.RemoteClient{ClientID: "client1", OwnerID: owner.ID})
+		require.NoError(t, err)
+		foundRC, err := stors.RemoteClientStor.GetRemoteClientByClientID("client1")
+		require.NoError(t, err)
+		require.Equal(t, rc.ID, foundRC.ID)
+
+		_, err = stors.RemoteClientTransferStor.CreateRemoteClientTransfer(&mcmodel.RemoteClientTransfer{
+			TransferID:     "t1",
+			TransferType:   "upload",
+			State:          "open",
+			RemoteClientID: rc.ID,
+			OwnerID:        owner.ID,
+			ProjectID:      proj.ID,
+			FileID:         f.ID,
+		})
+		require.NoError(t, err)
+		rct, err := stors.RemoteClientTransferStor.UpdateRemoteClientTransferState("t1", "complete")
+		require.NoError(t, err)
+		require.Equal(t, "complete", rct.State)
+		require.Equal(t, f.ID, rct.File.ID)
+		transfers, err := stors.RemoteClientTransferStor.GetAllTransfersForRemoteClient(rc.ID)
+		require.NoError(t, err)
+		require.Len(t, transfers, 1)
+		active, err := stors.RemoteClientTransferStor.GetActiveTransfers()
+		require.NoError(t, err)
+		require.Empty(t, active)
+		require.NoError(t, stors.RemoteClientTransferStor.DeleteRemoteClientTransferByTransferID("t1"))
+
+		_, err = stors.PartialTransferFileStor.CreatePartialTransferFile(&mcmodel.PartialTransferFile{TransferID: "t2", ProjectID: proj.ID, Status: "uploading"})
+		require.NoError(t, err)
+		uploading, err := stors.PartialTransferFileStor.GetUploadingFiles()
+		require.NoError(t, err)
+		require.Len(t, uploading, 1)
+
+		c, err := stors.ConversionStor.AddFileToConvert(f)
+		require.NoError(t, err)
+		require.Equal(t, f.ID, c.FileID)
+	})
+}
@@ -4,19 +4,19 @@ import (
 	"context"
 	"fmt"
 	"hash/fnv"
-	"mime"
 	"os"
 	"os/user"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"syscall"
 	"time"
 
 	"github.com/apex/log"
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/mime"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 	"github.com/materials-commons/hydra/pkg/mcfs/fs/bridgefs"
 	"gorm.io/gorm"
@@ -64,6 +64,9 @@ func init() {
 	openedFilesTracker = NewOpenFilesTracker()
 }
 
+// CreateFS creates the root of the bridge file system. The bridge hands the kernel file descriptors for the
+// underlying files under fsRoot, so unlike the other services it only works with blobs kept on the local
+// filesystem, and reads and writes them there directly rather than through a blobstore.BlobStore.
 func CreateFS(fsRoot string, dB *gorm.DB, tr mcmodel.TransferRequest) *Node {
 	mcfsRoot = fsRoot
 	db = dB
@@ -371,12 +374,12 @@ func (n *Node) Release(ctx context.Context, f fs.FileHandle) syscall.Errno {
 		size = attrs.Size
 	}
 
-	var checksum string
+	var sums digest.Sums
 	if nf != nil {
-		checksum = fmt.Sprintf("%x", nf.hasher.Sum(nil))
+		sums = nf.hasher.Sums()
 	}
 
-	errno := fs.ToErrno(transferRequestStore.MarkFileReleased(fileToUpdate, checksum, transferRequest.ProjectID, int64(size)))
+	errno := fs.ToErrno(transferRequestStore.MarkFileReleased(fileToUpdate, sums, transferRequest.ProjectID, int64(size)))
 
 	// Add to convertible list after marking as released to prevent the condition where the
 	// file hasn't been released but is picked up for conversion. This is a very unlikely
@@ -448,7 +451,7 @@ func (n *Node) createNewMCFile(name string) (*mcmodel.File, error) {
 		DirectoryID: dir.ID,
 		Size:        0,
 		Checksum:    "",
-		MimeType:    getMimeType(name),
+		MimeType:    mime.DetectByName(name),
 		OwnerID:     transferRequest.OwnerID,
 		Current:     false,
 	}
@@ -457,23 +460,6 @@ func (n *Node) createNewMCFile(name string) (*mcmodel.File, error) {
 	return f, err
 }
 
-// getMimeType will determine the type of file from its extension. It strips out the extra information
-// such as the charset and just returns the underlying type. It returns "unknown" for the mime type if
-// the mime package is unable to determine the type.
-func getMimeType(name string) string {
-	mimeType := mime.TypeByExtension(filepath.Ext(name))
-	if mimeType == "" {
-		return "unknown"
-	}
-
-	semicolon := strings.Index(mimeType, ";")
-	if semicolon == -1 {
-		return strings.TrimSpace(mimeType)
-	}
-
-	return strings.TrimSpace(mimeType[:semicolon])
-}
-
 func (n *Node) Rename(_ context.Context, name string, newParent fs.InodeEmbedder, newName string, _ uint32) syscall.Errno {
 	fmt.Printf("Rename: %s/%s to %s/%s\n", n.Path(n.Root()), name, newParent.EmbeddedInode().Path(n.Root()), newName)
 	fromPath := filepath.Join("/", n.Path(n.Root()))
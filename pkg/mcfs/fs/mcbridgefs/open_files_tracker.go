@@ -1,10 +1,9 @@
 package mcbridgefs
 
 import (
-	"crypto/md5"
-	"hash"
 	"sync"
 
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 )
 
@@ -15,7 +14,7 @@ type OpenFilesTracker struct {
 type OpenFile struct {
 	File     *mcmodel.File
 	Checksum string
-	hasher   hash.Hash
+	hasher   *digest.Hasher
 }
 
 func NewOpenFilesTracker() *OpenFilesTracker {
@@ -25,7 +24,7 @@ func NewOpenFilesTracker() *OpenFilesTracker {
 func (t *OpenFilesTracker) Store(path string, file *mcmodel.File) {
 	openFile := &OpenFile{
 		File:   file,
-		hasher: md5.New(),
+		hasher: digest.New(),
 	}
 	t.m.Store(path, openFile)
 }
@@ -1,11 +1,10 @@
 package fsstate
 
 import (
-	"crypto/md5"
-	"hash"
 	"sync"
 	"time"
 
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/globus"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 )
@@ -50,7 +49,7 @@ type AccessedFileState struct {
 
 	// Hasher is used to create the checksum. As writes are done to a file the
 	// checksum is updated.
-	Hasher hash.Hash
+	Hasher *digest.Hasher
 
 	// HashInvalid is set to true when a user seeks or truncates a file. When
 	// that happens the hash state is invalid.
@@ -104,7 +103,7 @@ func (tracker *TransferStateTracker) LoadOrStore(transferRequestKey, path string
 		// we need to add it into the list of known transferState.
 		newAccessedFileState := &AccessedFileState{
 			File:   potentialNewFile,
-			Hasher: md5.New(),
+			Hasher: digest.New(),
 		}
 		transferState.AccessedFileStates[path] = newAccessedFileState
 		return nil
@@ -162,7 +161,7 @@ func (tracker *TransferStateTracker) Store(transferRequestKey, path string, file
 	// add it to the tracker.
 	fileState := &AccessedFileState{
 		File:      file,
-		Hasher:    md5.New(),
+		Hasher:    digest.New(),
 		FileState: state,
 	}
 
@@ -185,7 +184,7 @@ func (tracker *TransferStateTracker) GetFile(transferRequestKey, path string) *m
 func (tracker *TransferStateTracker) GetFileWithHashReset(transferRequestKey, path string) *mcmodel.File {
 	fileEntry := tracker.Get(transferRequestKey, path)
 	if fileEntry != nil {
-		fileEntry.Hasher = md5.New()
+		fileEntry.Hasher = digest.New()
 		return fileEntry.File
 	}
 
@@ -1,19 +1,19 @@
 package mcfs
 
 import (
-	"crypto/md5"
 	"fmt"
 	"io"
-	"mime"
-	"os"
 	"path/filepath"
-	"strings"
 	"syscall"
 	"time"
 
 	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/materials-commons/hydra/pkg/authz"
+	"github.com/materials-commons/hydra/pkg/blobstore"
 	"github.com/materials-commons/hydra/pkg/clog"
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/mime"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 	"github.com/materials-commons/hydra/pkg/mcfs/fs/mcfs/fsstate"
 	"github.com/materials-commons/hydra/pkg/mcfs/fs/mcfs/mcpath"
@@ -28,6 +28,10 @@ type LocalMCFSApi struct {
 	transferStateTracker *fsstate.TransferStateTracker
 	pathParser           mcpath.Parser
 	mcfsRoot             string
+
+	// The roles of transfer request owners in their projects. Writes are only allowed for
+	// contributors.
+	roles *authz.Cache
 }
 
 func NewLocalMCFSApi(stors *stor.Stors, tracker *fsstate.TransferStateTracker, pathParser mcpath.Parser, mcfsRoot string) *LocalMCFSApi {
@@ -36,9 +40,21 @@ func NewLocalMCFSApi(stors *stor.Stors, tracker *fsstate.TransferStateTracker, p
 		transferStateTracker: tracker,
 		mcfsRoot:             mcfsRoot,
 		pathParser:           pathParser,
+		roles:                authz.NewCache(stors.ProjectStor, authz.DefaultCacheTTL),
 	}
 }
 
+// checkWrite returns an error matching os.ErrPermission when the user the path belongs to can't
+// write to its project.
+func (fsapi *LocalMCFSApi) checkWrite(p mcpath.Path) error {
+	if err := authz.Require(fsapi.roles, p.UserID(), p.ProjectID(), authz.Contributor); err != nil {
+		clog.UsingCtx(p.TransferKey()).Errorf("User %d can't write to project %d: %s", p.UserID(), p.ProjectID(), err)
+		return err
+	}
+
+	return nil
+}
+
 func (fsapi *LocalMCFSApi) Create(path string) (*mcmodel.File, error) {
 	parsedPath, _ := fsapi.pathParser.Parse(path)
 	clog.UsingCtx(parsedPath.TransferKey()).Debugf("fsapi.Create %s = %s, %s\n", path, parsedPath.TransferKey(), parsedPath.ProjectPath())
@@ -48,6 +64,10 @@ func (fsapi *LocalMCFSApi) Create(path string) (*mcmodel.File, error) {
 		return nil, fmt.Errorf("file found on create: %s", path)
 	}
 
+	if err := fsapi.checkWrite(parsedPath); err != nil {
+		return nil, err
+	}
+
 	f, err := fsapi.createNewFile(parsedPath)
 	fsapi.transferStateTracker.Store(parsedPath.TransferKey(), parsedPath.ProjectPath(), f, fsstate.FileStateOpen)
 
@@ -75,7 +95,7 @@ func (fsapi *LocalMCFSApi) createNewFile(p mcpath.Path) (*mcmodel.File, error) {
 		DirectoryID: dir.ID,
 		Size:        0,
 		Checksum:    "",
-		MimeType:    determineMimeType(name),
+		MimeType:    mime.DetectByName(name),
 		OwnerID:     p.UserID(),
 		Current:     false,
 	}
@@ -96,6 +116,12 @@ func (fsapi *LocalMCFSApi) Open(path string, flags int) (f *mcmodel.File, isNewF
 	key := parsedPath.TransferKey()
 	clog.UsingCtx(key).Debugf("LocalMCFSApi Open %s/%v", path, flags)
 
+	if !isReadonly(flags) {
+		if err := fsapi.checkWrite(parsedPath); err != nil {
+			return nil, false, err
+		}
+	}
+
 	switch {
 	case isReadonly(flags):
 		return fsapi.openReadonly(path, flags, parsedPath)
@@ -148,7 +174,7 @@ func (fsapi *LocalMCFSApi) openForAppend(path string, flags int, parsedPath mcpa
 	_, state := fsapi.transferStateTracker.Store(key, projPath, transferRequestFile.File, fsstate.FileStateOpen)
 
 	// Recompute hash using the hasher that was created when the new state was created
-	fh, err := os.Open(transferRequestFile.File.ToUnderlyingFilePath(fsapi.mcfsRoot))
+	fh, err := fsapi.stors.FileStor.Blobs().Open(transferRequestFile.File.BlobKey(), 0)
 	if err != nil {
 		// This shouldn't happen. If it does we should probably remove the state...
 		// TODO: What to do with state when this error occurs.
@@ -229,7 +255,7 @@ func (fsapi *LocalMCFSApi) createNewFileVersion(p mcpath.Path) (*mcmodel.File, e
 		DirectoryID: dir.ID,
 		Size:        0,
 		Checksum:    "",
-		MimeType:    determineMimeType(name),
+		MimeType:    mime.DetectByName(name),
 		OwnerID:     p.UserID(),
 		Current:     false,
 	}
@@ -253,13 +279,11 @@ func (fsapi *LocalMCFSApi) Release(path string, size uint64) error {
 
 	fileState.FileState = fsstate.FileStateClosed
 	fileState.LastClosedAt = time.Now()
-	checksum := ""
 	var err error
 	if fileState.HashInvalid {
 		fsapi.computeAndUpdateChecksum(path, fileState, size)
 	} else {
-		checksum = fmt.Sprintf("%x", fileState.Hasher.Sum(nil))
-		err = fsapi.stors.TransferRequestStor.MarkFileReleased(fileState.File, checksum, parsedPath.ProjectID(), int64(size))
+		err = fsapi.stors.TransferRequestStor.MarkFileReleased(fileState.File, fileState.Hasher.Sums(), parsedPath.ProjectID(), int64(size))
 		if err != nil {
 			clog.UsingCtx(key).Debugf("LocalMCFSApi.Release MarkFileReleased failed with err %s\n", err)
 			return err
@@ -285,10 +309,10 @@ func (fsapi *LocalMCFSApi) Release(path string, size uint64) error {
 // It then set HashInvalid to false, so that new writes (appends) to the file can use the existing state. Note
 // that for
 func (fsapi *LocalMCFSApi) computeAndUpdateChecksum(path string, fileState *fsstate.AccessedFileState, size uint64) {
-	fileState.Hasher = md5.New()
+	fileState.Hasher = digest.New()
 	f := fileState.File
 
-	fh, err := os.Open(f.ToUnderlyingFilePath(fsapi.mcfsRoot))
+	fh, err := fsapi.stors.FileStor.Blobs().Open(f.BlobKey(), 0)
 	if err != nil {
 		// log that we couldn't compute the hash
 		return
@@ -297,13 +321,13 @@ func (fsapi *LocalMCFSApi) computeAndUpdateChecksum(path string, fileState *fsst
 	defer fh.Close()
 
 	_, _ = io.Copy(fileState.Hasher, fh)
-	checksum := fmt.Sprintf("%x", fileState.Hasher.Sum(nil))
+	sums := fileState.Hasher.Sums()
 
 	parsedPath, _ := fsapi.pathParser.Parse(path)
 
 	fsapi.transferStateTracker.WithLockHeld(parsedPath.TransferKey(), parsedPath.ProjectPath(), func(fileState *fsstate.AccessedFileState) {
 		fileState.HashInvalid = false
-		if err := fsapi.stors.FileStor.UpdateMetadataForFileAndProject(f, checksum, int64(size)); err != nil {
+		if err := fsapi.stors.FileStor.UpdateMetadataForFileAndProject(f, sums, int64(size)); err != nil {
 			// log that we couldn't update the database
 			return
 		}
@@ -326,6 +350,10 @@ func (fsapi *LocalMCFSApi) Mkdir(path string) (*mcmodel.File, error) {
 	clog.Global().Debugf("LocalMCFSApi.Mkdir %s", path)
 	parsedPath, _ := fsapi.pathParser.Parse(path)
 	key := parsedPath.TransferKey()
+	if err := fsapi.checkWrite(parsedPath); err != nil {
+		return nil, err
+	}
+
 	clog.UsingCtx(key).Debugf("LocalMCFSApi.Mkdir GetFileByPath(%d, '%s')\n", parsedPath.ProjectID(), filepath.Dir(parsedPath.ProjectPath()))
 	parentDir, err := fsapi.stors.FileStor.GetFileByPath(parsedPath.ProjectID(), filepath.Dir(parsedPath.ProjectPath()))
 	if err != nil {
@@ -336,11 +364,99 @@ func (fsapi *LocalMCFSApi) Mkdir(path string) (*mcmodel.File, error) {
 		parsedPath.ProjectPath(), filepath.Base(parsedPath.ProjectPath()))
 }
 
+func (fsapi *LocalMCFSApi) Rename(path, newPath string) error {
+	parsedPath, _ := fsapi.pathParser.Parse(path)
+	parsedNewPath, _ := fsapi.pathParser.Parse(newPath)
+	clog.UsingCtx(parsedPath.TransferKey()).Debugf("LocalMCFSApi.Rename %s to %s", path, newPath)
+
+	if parsedPath.PathType() != mcpath.ProjectPathType || parsedNewPath.PathType() != mcpath.ProjectPathType ||
+		parsedPath.TransferKey() != parsedNewPath.TransferKey() || parsedPath.ProjectPath() == "/" {
+		return stor.ErrInvalidMove
+	}
+
+	if err := fsapi.checkWrite(parsedPath); err != nil {
+		return err
+	}
+
+	if file := fsapi.transferStateTracker.GetFile(parsedPath.TransferKey(), parsedPath.ProjectPath()); file != nil {
+		return fmt.Errorf("file %s is open: %w", path, stor.ErrInvalidMove)
+	}
+
+	file, err := parsedPath.Lookup()
+	if err != nil {
+		return err
+	}
+
+	toDir, err := fsapi.stors.FileStor.GetDirByPath(parsedNewPath.ProjectID(), filepath.Dir(parsedNewPath.ProjectPath()))
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Base(parsedNewPath.ProjectPath())
+	if file.IsDir() {
+		_, err = fsapi.stors.FileStor.MoveDirectory(file, toDir, name)
+	} else {
+		_, err = fsapi.stors.FileStor.MoveFile(file, toDir, name)
+	}
+
+	return err
+}
+
+func (fsapi *LocalMCFSApi) Unlink(path string) error {
+	parsedPath, _ := fsapi.pathParser.Parse(path)
+	clog.UsingCtx(parsedPath.TransferKey()).Debugf("LocalMCFSApi.Unlink %s", path)
+
+	if parsedPath.PathType() != mcpath.ProjectPathType {
+		return stor.ErrInvalidMove
+	}
+
+	if err := fsapi.checkWrite(parsedPath); err != nil {
+		return err
+	}
+
+	if file := fsapi.transferStateTracker.GetFile(parsedPath.TransferKey(), parsedPath.ProjectPath()); file != nil {
+		return fmt.Errorf("file %s is open: %w", path, stor.ErrInvalidMove)
+	}
+
+	file, err := parsedPath.Lookup()
+	switch {
+	case err != nil:
+		return err
+	case file.IsDir():
+		return fmt.Errorf("%s is a directory: %w", path, stor.ErrInvalidMove)
+	default:
+		return fsapi.stors.FileStor.DeleteFile(file)
+	}
+}
+
+func (fsapi *LocalMCFSApi) Rmdir(path string) error {
+	parsedPath, _ := fsapi.pathParser.Parse(path)
+	clog.UsingCtx(parsedPath.TransferKey()).Debugf("LocalMCFSApi.Rmdir %s", path)
+
+	if parsedPath.PathType() != mcpath.ProjectPathType {
+		return stor.ErrInvalidMove
+	}
+
+	if err := fsapi.checkWrite(parsedPath); err != nil {
+		return err
+	}
+
+	dir, err := parsedPath.Lookup()
+	switch {
+	case err != nil:
+		return err
+	case !dir.IsDir():
+		return fmt.Errorf("%s is not a directory: %w", path, stor.ErrInvalidMove)
+	default:
+		return fsapi.stors.FileStor.DeleteDirectory(dir, false)
+	}
+}
+
 func (fsapi *LocalMCFSApi) GetRealPath(path string) (realpath string, err error) {
 	parsedPath, _ := fsapi.pathParser.Parse(path)
 	if file := fsapi.transferStateTracker.GetFile(parsedPath.TransferKey(), parsedPath.ProjectPath()); file != nil {
 		// Found known file, so return it's real path
-		return file.ToUnderlyingFilePath(fsapi.mcfsRoot), nil
+		return fsapi.GetFileRealPath(file)
 	}
 
 	// Didn't find a previously opened file, so look up file.
@@ -349,19 +465,25 @@ func (fsapi *LocalMCFSApi) GetRealPath(path string) (realpath string, err error)
 		return "", err
 	}
 
-	return file.ToUnderlyingFilePath(fsapi.mcfsRoot), nil
+	return fsapi.GetFileRealPath(file)
 }
 
 func (fsapi *LocalMCFSApi) GetKnownFileRealPath(path string) (string, error) {
 	parsedPath, _ := fsapi.pathParser.Parse(path)
 	f := fsapi.transferStateTracker.GetFile(parsedPath.TransferKey(), parsedPath.ProjectPath())
 	if f != nil {
-		return f.ToUnderlyingFilePath(fsapi.mcfsRoot), nil
+		return fsapi.GetFileRealPath(f)
 	}
 
 	return "", fmt.Errorf("unknown file: %s", path)
 }
 
+// GetFileRealPath returns the path to the file's blob. FUSE passes file descriptors for the real
+// file back to the kernel, so this only works when the blob store keeps blobs on the local filesystem.
+func (fsapi *LocalMCFSApi) GetFileRealPath(f *mcmodel.File) (string, error) {
+	return blobstore.LocalPath(fsapi.stors.FileStor.Blobs(), f.BlobKey())
+}
+
 func (fsapi *LocalMCFSApi) FTruncate(path string, size uint64) (error, *syscall.Stat_t) {
 	parsedPath, _ := fsapi.pathParser.Parse(path)
 	f := fsapi.transferStateTracker.GetFile(parsedPath.TransferKey(), parsedPath.ProjectPath())
@@ -369,12 +491,17 @@ func (fsapi *LocalMCFSApi) FTruncate(path string, size uint64) (error, *syscall.
 		return syscall.ENOENT, nil
 	}
 
-	if err := syscall.Truncate(f.ToUnderlyingFilePath(fsapi.mcfsRoot), int64(size)); err != nil {
+	realPath, err := fsapi.GetFileRealPath(f)
+	if err != nil {
+		return syscall.ENOTSUP, nil
+	}
+
+	if err := syscall.Truncate(realPath, int64(size)); err != nil {
 		return fs.ToErrno(err), nil
 	}
 
 	st := syscall.Stat_t{}
-	if err := syscall.Lstat(f.ToUnderlyingFilePath(fsapi.mcfsRoot), &st); err != nil {
+	if err := syscall.Lstat(realPath, &st); err != nil {
 		return fs.ToErrno(err), nil
 	}
 
@@ -398,28 +525,3 @@ func isReadonly(flags int) bool {
 		return true
 	}
 }
-
-// determineMimeType ... Move this into a utility package.
-func determineMimeType(name string) string {
-	mimeType := mime.TypeByExtension(filepath.Ext(name))
-	if mimeType == "" {
-		return "unknown"
-	}
-
-	mediatype, _, err := mime.ParseMediaType(mimeType)
-	if err != nil {
-		// ParseMediaType returned an error, but TypeByExtension
-		// returned a mime string. As a fallback let's remove
-		// any parameters on the string (if there is a semicolon
-		// it will be after the semicolon), and return everything
-		// before the (optional) semicolon.
-		semicolon := strings.Index(mimeType, ";")
-		if semicolon == -1 {
-			return strings.TrimSpace(mimeType)
-		}
-
-		return strings.TrimSpace(mimeType[:semicolon])
-	}
-
-	return strings.TrimSpace(mediatype)
-}
@@ -1,10 +1,16 @@
 package mcfs
 
 import (
+	"os"
+	"syscall"
 	"testing"
 
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 	"github.com/materials-commons/hydra/pkg/mcfs/fs/mcfs/fsstate"
+	"github.com/materials-commons/hydra/pkg/mcfs/fs/mcfs/mcpath"
 	"github.com/stretchr/testify/require"
 )
 
@@ -73,3 +79,43 @@ func TestMCApi_Readdir(t *testing.T) {
 func TestMCApi_Release(t *testing.T) {
 
 }
+
+func TestMCApi_ViewerCannotWrite(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	viewer := b.User("viewer")
+	project := b.Project("proj", b.User("owner"))
+	b.AddViewer(project, viewer)
+	b.Dir(project, project.RootDir, "dir1")
+	existing := b.File(project, project.RootDir, "f.txt", 4)
+
+	mcfsDir := t.TempDir()
+	stors := stor.NewGormStorsWithBlobStore(db, mcfsDir, blobstore.NewLocalBlobStore(mcfsDir))
+	tr, err := stors.TransferRequestStor.CreateTransferRequest(&mcmodel.TransferRequest{
+		ProjectID: project.ID,
+		OwnerID:   viewer.ID,
+		State:     "open",
+	})
+	require.NoError(t, err)
+
+	pathParser := mcpath.NewTransferPathParser(stors, fsstate.NewTransferRequestCache(stors.TransferRequestStor))
+	mcapi := NewLocalMCFSApi(stors, fsstate.NewTransferStateTracker(), pathParser, mcfsDir)
+
+	// Viewers can still read.
+	_, _, err = mcapi.Open(tr.Join("f.txt"), syscall.O_RDONLY)
+	require.NoError(t, err)
+
+	_, err = mcapi.Create(tr.Join("new.txt"))
+	require.ErrorIs(t, err, os.ErrPermission)
+	_, _, err = mcapi.Open(tr.Join("f.txt"), syscall.O_WRONLY)
+	require.ErrorIs(t, err, os.ErrPermission)
+	_, err = mcapi.Mkdir(tr.Join("dir2"))
+	require.ErrorIs(t, err, os.ErrPermission)
+	require.ErrorIs(t, mcapi.Rename(tr.Join("f.txt"), tr.Join("g.txt")), os.ErrPermission)
+	require.ErrorIs(t, mcapi.Unlink(tr.Join("f.txt")), os.ErrPermission)
+	require.ErrorIs(t, mcapi.Rmdir(tr.Join("dir1")), os.ErrPermission)
+
+	f, err := stors.FileStor.GetFileByPath(project.ID, "/f.txt")
+	require.NoError(t, err)
+	require.Equal(t, existing.ID, f.ID)
+}
@@ -551,6 +551,44 @@ func TestParallelMkdirDifferentUser(t *testing.T) {
 	require.Equal(t, int64(1), count)
 }
 
+func TestViewerGetsEACCESOnWrites(t *testing.T) {
+	tc := newTestCase(t, &fsTestOptions{})
+	require.NotNil(t, tc)
+
+	// The owner creates a file for the viewer to attempt to rename and delete.
+	require.NoError(t, os.WriteFile(tc.makeTransferRequestPath("f.txt"), []byte("hello"), 0644))
+
+	var err error
+	viewer := &mcmodel.User{Email: "viewer@test.com"}
+	viewer, err = tc.stors.UserStor.CreateUser(viewer)
+	require.NoError(t, err)
+
+	err = tc.stors.ProjectStor.AddViewerToProject(tc.proj, viewer)
+	require.NoError(t, err)
+
+	transferRequest := &mcmodel.TransferRequest{
+		ProjectID: tc.proj.ID,
+		OwnerID:   viewer.ID,
+		State:     "open",
+	}
+
+	transferRequest, err = tc.stors.TransferRequestStor.CreateTransferRequest(transferRequest)
+	require.NoError(t, err)
+
+	viewerPath := func(path string) string {
+		return filepath.Join(tc.mntDir, transferRequest.UUID, path)
+	}
+
+	_, err = os.ReadFile(viewerPath("f.txt"))
+	require.NoError(t, err)
+
+	_, err = os.Create(viewerPath("new.txt"))
+	require.ErrorIs(t, err, syscall.EACCES)
+	require.ErrorIs(t, os.Mkdir(viewerPath("dir1"), 0755), syscall.EACCES)
+	require.ErrorIs(t, os.Rename(viewerPath("f.txt"), viewerPath("g.txt")), syscall.EACCES)
+	require.ErrorIs(t, os.Remove(viewerPath("f.txt")), syscall.EACCES)
+}
+
 func TestActivityCounterIsIncrementedOnReadsAndWrites(t *testing.T) {
 	tc := newTestCase(t, &fsTestOptions{})
 	require.NotNil(t, tc)
@@ -29,6 +29,15 @@ type MCFSApi interface {
 	// Mkdir creates a new directory in MC.
 	Mkdir(path string) (*mcmodel.File, error)
 
+	// Rename moves the file or directory at path to newPath. Both paths must be in the same project.
+	Rename(path, newPath string) error
+
+	// Unlink moves the file at path into the project trash.
+	Unlink(path string) error
+
+	// Rmdir moves the empty directory at path into the project trash.
+	Rmdir(path string) error
+
 	// GetRealPath will take a MCFS path and return the path to the real underlying file (the UUID based path).
 	GetRealPath(path string) (realpath string, err error)
 
@@ -36,6 +45,10 @@ type MCFSApi interface {
 	// that are in the AccessedFileState tracker.
 	GetKnownFileRealPath(path string) (string, error)
 
+	// GetFileRealPath will return the real underlying file path (the UUID based path) for a file. It
+	// returns an error if the blob store doesn't keep files on the local filesystem.
+	GetFileRealPath(f *mcmodel.File) (string, error)
+
 	// FTruncate will truncate the real underlying file (the UUID based one) and return
 	// Stat info on it.
 	FTruncate(path string, size uint64) (error, *syscall.Stat_t)
@@ -2,6 +2,7 @@ package mcfs
 
 import (
 	"context"
+	"errors"
 	"hash/fnv"
 	"os"
 	"os/user"
@@ -15,6 +16,7 @@ import (
 	"github.com/hanwen/go-fuse/v2/fuse"
 	"github.com/materials-commons/hydra/pkg/clog"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 )
 
 type NewFileHandleFN func(fd, flags int, path string, file *mcmodel.File) fs.FileHandle
@@ -208,7 +210,10 @@ func (n *Node) Mkdir(ctx context.Context, name string, _ uint32, out *fuse.Entry
 
 	path := filepath.Join("/", n.Path(n.Root()), name)
 	dir, err := n.RootData.mcfsapi.Mkdir(path)
-	if err != nil {
+	switch {
+	case errors.Is(err, os.ErrPermission):
+		return nil, syscall.EACCES
+	case err != nil:
 		return nil, syscall.EINVAL
 	}
 
@@ -222,9 +227,18 @@ func (n *Node) Mkdir(ctx context.Context, name string, _ uint32, out *fuse.Entry
 	return n.NewInode(ctx, node, fs.StableAttr{Mode: n.getMode(dir)}), fs.OK
 }
 
-func (n *Node) Rmdir(_ context.Context, name string) syscall.Errno {
-	clog.Global().Errorf("Node.Rmdir %s name %s", n.Path(n.Root()), name)
-	return syscall.EIO
+// Rmdir moves an empty directory into the project trash.
+func (n *Node) Rmdir(_ context.Context, name string) (errno syscall.Errno) {
+	defer func() {
+		if r := recover(); r != nil {
+			clog.Global().Errorf("Node.Rmdir panicked")
+			errno = syscall.EIO
+		}
+	}()
+
+	path := filepath.Join("/", n.Path(n.Root()), name)
+	clog.Global().Debugf("Node.Rmdir %s", path)
+	return n.deleteErrno("Rmdir", path, n.RootData.mcfsapi.Rmdir(path))
 }
 
 // Create will create a new file. At this point the file shouldn't exist. However, because multiple users could be
@@ -244,13 +258,22 @@ func (n *Node) Create(ctx context.Context, name string, flags uint32, mode uint3
 	f, err := n.RootData.mcfsapi.Create(fpath)
 	if err != nil {
 		clog.Global().Errorf("Node.Create - failed creating new file %s: %s\n", fpath, err)
+		if errors.Is(err, os.ErrPermission) {
+			return nil, nil, 0, syscall.EACCES
+		}
 		return nil, nil, 0, syscall.EIO
 	}
 
+	realPath, err := n.RootData.mcfsapi.GetFileRealPath(f)
+	if err != nil {
+		clog.Global().Errorf("Node.Create - no real path for %s: %s\n", fpath, err)
+		return nil, nil, 0, syscall.ENOTSUP
+	}
+
 	flags = flags &^ syscall.O_APPEND
-	fd, err := syscall.Open(f.ToUnderlyingFilePath(n.RootData.mcfsRoot), int(flags)|os.O_CREATE, mode)
+	fd, err := syscall.Open(realPath, int(flags)|os.O_CREATE, mode)
 	if err != nil {
-		clog.Global().Errorf("Node.Create - syscall.Open failed %s: %s\n", f.ToUnderlyingFilePath(n.RootData.mcfsRoot), err)
+		clog.Global().Errorf("Node.Create - syscall.Open failed %s: %s\n", realPath, err)
 		return nil, nil, 0, syscall.EIO
 	}
 
@@ -285,7 +308,10 @@ func (n *Node) Open(_ context.Context, flags uint32) (fh fs.FileHandle, fuseFlag
 	omode := flags & syscall.O_ACCMODE
 
 	f, isNewFile, err := n.RootData.mcfsapi.Open(path, int(flags))
-	if err != nil {
+	switch {
+	case errors.Is(err, os.ErrPermission):
+		return nil, 0, syscall.EACCES
+	case err != nil:
 		return nil, 0, syscall.EIO
 	}
 
@@ -295,7 +321,12 @@ func (n *Node) Open(_ context.Context, flags uint32) (fh fs.FileHandle, fuseFlag
 		}
 	}
 
-	filePath := f.ToUnderlyingFilePath(n.RootData.mcfsRoot)
+	filePath, err := n.RootData.mcfsapi.GetFileRealPath(f)
+	if err != nil {
+		clog.Global().Errorf("Node.Open - no real path for %s: %s\n", path, err)
+		return nil, 0, syscall.ENOTSUP
+	}
+
 	clog.Global().Debugf("call syscall.Open (%s) with flags (%v) %s\n", path, flags, filePath)
 	fd, err := syscall.Open(filePath, int(flags), 0755)
 	if err != nil {
@@ -347,14 +378,73 @@ func (n *Node) Setattr(ctx context.Context, f fs.FileHandle, in *fuse.SetAttrIn,
 	return syscall.ENOTSUP
 }
 
-func (n *Node) Rename(_ context.Context, _ string, _ fs.InodeEmbedder, _ string, _ uint32) syscall.Errno {
-	clog.Global().Error("Node.Rename")
-	return syscall.EPERM
+// Rename moves an entry to a new name and/or directory. The flags (RENAME_EXCHANGE, RENAME_NOREPLACE)
+// are not supported.
+func (n *Node) Rename(_ context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32) (errno syscall.Errno) {
+	defer func() {
+		if r := recover(); r != nil {
+			clog.Global().Errorf("Node.Rename panicked")
+			errno = syscall.EIO
+		}
+	}()
+
+	if flags != 0 {
+		return syscall.ENOTSUP
+	}
+
+	path := filepath.Join("/", n.Path(n.Root()), name)
+	newPath := filepath.Join("/", newParent.EmbeddedInode().Path(n.Root()), newName)
+	clog.Global().Debugf("Node.Rename %s to %s", path, newPath)
+
+	err := n.RootData.mcfsapi.Rename(path, newPath)
+	switch {
+	case err == nil:
+		return fs.OK
+	case errors.Is(err, stor.ErrAlreadyExists):
+		return syscall.EEXIST
+	case errors.Is(err, stor.ErrInvalidMove):
+		return syscall.EINVAL
+	case errors.Is(err, os.ErrPermission):
+		return syscall.EACCES
+	case stor.IsRecordNotFound(err):
+		return syscall.ENOENT
+	default:
+		clog.Global().Errorf("Node.Rename %s to %s failed: %s", path, newPath, err)
+		return syscall.EIO
+	}
+}
+
+// Unlink moves a file, including all of its versions, into the project trash.
+func (n *Node) Unlink(_ context.Context, name string) (errno syscall.Errno) {
+	defer func() {
+		if r := recover(); r != nil {
+			clog.Global().Errorf("Node.Unlink panicked")
+			errno = syscall.EIO
+		}
+	}()
+
+	path := filepath.Join("/", n.Path(n.Root()), name)
+	clog.Global().Debugf("Node.Unlink %s", path)
+	return n.deleteErrno("Unlink", path, n.RootData.mcfsapi.Unlink(path))
 }
 
-func (n *Node) Unlink(_ context.Context, name string) syscall.Errno {
-	clog.Global().Errorf("Node.Unlink %s, name %s", n.Path(n.Root()), name)
-	return syscall.EPERM
+// deleteErrno maps the error from an Unlink or Rmdir call to the errno returned to the kernel.
+func (n *Node) deleteErrno(op, path string, err error) syscall.Errno {
+	switch {
+	case err == nil:
+		return fs.OK
+	case errors.Is(err, stor.ErrNotEmpty):
+		return syscall.ENOTEMPTY
+	case errors.Is(err, stor.ErrInvalidMove), errors.Is(err, stor.ErrRootDirectory):
+		return syscall.EINVAL
+	case errors.Is(err, os.ErrPermission):
+		return syscall.EACCES
+	case stor.IsRecordNotFound(err):
+		return syscall.ENOENT
+	default:
+		clog.Global().Errorf("Node.%s %s failed: %s", op, path, err)
+		return syscall.EIO
+	}
 }
 
 func (n *Node) Statfs(_ context.Context, out *fuse.StatfsOut) (errno syscall.Errno) {
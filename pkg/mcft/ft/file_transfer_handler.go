@@ -2,19 +2,19 @@ package ft
 
 import (
 	"bytes"
-	"crypto/md5"
 	"errors"
 	"fmt"
-	"hash"
 	"io"
-	"mime"
-	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/apex/log"
 	"github.com/gorilla/websocket"
+	"github.com/materials-commons/hydra/pkg/authz"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/mime"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 	"github.com/materials-commons/hydra/pkg/mcft/protocol"
 	"gorm.io/gorm"
@@ -27,26 +27,27 @@ var ErrNotAuthenticated = errors.New("not authenticated")
 type FileTransferHandler struct {
 	db           *gorm.DB
 	ws           *websocket.Conn
-	f            *os.File
+	w            blobstore.Writer
+	r            blobstore.Reader
 	Project      *mcmodel.Project
 	User         mcmodel.User
+	role         authz.Role
 	File         *mcmodel.File
 	projectStore stor.ProjectStor
 	fileStore    stor.FileStor
 	convStore    stor.ConversionStor
-	hasher       hash.Hash
-	mcfsRoot     string
+	hasher       *digest.Hasher
 }
 
-func NewFileTransferHandler(ws *websocket.Conn, db *gorm.DB) *FileTransferHandler {
+// NewFileTransferHandler creates a handler for a single connection. File contents are kept in blobs.
+func NewFileTransferHandler(ws *websocket.Conn, db *gorm.DB, blobs blobstore.BlobStore) *FileTransferHandler {
 	return &FileTransferHandler{
 		ws:           ws,
 		db:           db,
 		projectStore: stor.NewGormProjectStor(db),
-		fileStore:    stor.NewGormFileStor(db, GetMCFSRoot()),
+		fileStore:    stor.NewGormFileStorWithBlobStore(db, GetMCFSRoot(), blobs),
 		convStore:    stor.NewGormConversionStor(db),
-		hasher:       md5.New(),
-		mcfsRoot:     GetMCFSRoot(),
+		hasher:       digest.New(),
 	}
 }
 
@@ -96,16 +97,15 @@ func (h *FileTransferHandler) Run() error {
 }
 
 func (h *FileTransferHandler) close() {
-	if h.f != nil {
-		_ = h.f.Close()
-		finfo, err := os.Stat(h.File.ToUnderlyingFilePath(h.mcfsRoot))
+	if h.w != nil {
+		_ = h.w.Close()
+		blobInfo, err := h.fileStore.Blobs().Stat(h.File.BlobKey())
 		if err != nil {
 			log.Errorf("Error stating file: %s", err)
 			return
 		}
 
-		checksum := fmt.Sprintf("%x", h.hasher.Sum(nil))
-		deleteFile, err := h.fileStore.DoneWritingToFile(h.File, checksum, finfo.Size(), h.convStore)
+		deleteFile, err := h.fileStore.DoneWritingToFile(h.File, h.hasher.Sums(), blobInfo.Size, h.convStore)
 		if err != nil {
 			log.Errorf("Error finishing file (%s/%d): %s", h.File.Name, h.File.ID, err)
 			return
@@ -114,8 +114,8 @@ func (h *FileTransferHandler) close() {
 		// If deleteFile is true then DoneWritingToFile found a duplicate file and switched the pointer in the
 		// database to point at it. So we can delete the existing file.
 		if deleteFile {
-			if err := os.Remove(h.File.ToUnderlyingFilePathForUUID(h.mcfsRoot)); err != nil {
-				log.Errorf("Failed to remove file %s: %s", h.File.ToUnderlyingFilePathForUUID(h.mcfsRoot), err)
+			if err := h.fileStore.Blobs().Delete(h.File.BlobKeyForUUID()); err != nil {
+				log.Errorf("Failed to remove file %s: %s", h.File.BlobKeyForUUID(), err)
 			}
 		}
 	}
@@ -144,11 +144,12 @@ func (h *FileTransferHandler) authenticate() error {
 
 	h.User = user
 
-	if !h.projectStore.UserCanAccessProject(h.User.ID, authReq.ProjectID) {
+	role, err := h.projectStore.GetUserProjectRole(h.User.ID, authReq.ProjectID)
+	if err != nil || !role.CanRead() {
 		return ErrNotAuthenticated
 	}
+	h.role = role
 
-	var err error
 	h.Project, err = h.projectStore.GetProjectByID(authReq.ProjectID)
 	if err != nil {
 		return err
@@ -167,6 +168,11 @@ func (h *FileTransferHandler) uploadFile() error {
 		return err
 	}
 
+	if err := authz.Check(h.role, authz.Contributor); err != nil {
+		log.Errorf("User %d can't upload %s to project %d: %s", h.User.ID, uploadReq.Path, h.Project.ID, err)
+		return err
+	}
+
 	dir, err := h.getOrCreateDirectory(filepath.Dir(uploadReq.Path))
 	if err != nil {
 		log.Errorf("getOrCreateDirectory failed for %s: %s", filepath.Dir(uploadReq.Path), err)
@@ -174,20 +180,14 @@ func (h *FileTransferHandler) uploadFile() error {
 	}
 
 	name := filepath.Base(uploadReq.Path)
-	file, err = h.fileStore.CreateFile(name, h.Project.ID, dir.ID, h.User.ID, getMimeType(name))
+	file, err = h.fileStore.CreateFile(name, h.Project.ID, dir.ID, h.User.ID, mime.DetectByName(name))
 	if err != nil {
 		log.Errorf("CreateFile failed: %s", err)
 		return err
 	}
 
-	dirPath := file.ToUnderlyingDirPath(h.mcfsRoot)
-	if err := os.MkdirAll(dirPath, 0777); err != nil {
-		log.Errorf("Unable to create directory path %s to store file %s: %s", dirPath, name, err)
-		return err
-	}
-
 	h.File = file
-	h.f, err = os.Create(file.ToUnderlyingFilePath(h.mcfsRoot))
+	h.w, err = h.fileStore.Blobs().Create(file.BlobKey())
 	if err != nil {
 		log.Errorf("Unable to create file: %s", err)
 		return err
@@ -249,7 +249,7 @@ func (h *FileTransferHandler) getOrCreateDirectory(dirPath string) (*mcmodel.Fil
 }
 
 func (h *FileTransferHandler) writeFileBlock() error {
-	if h.f == nil {
+	if h.w == nil {
 		return ErrBadProtocolSequence
 	}
 
@@ -261,7 +261,7 @@ func (h *FileTransferHandler) writeFileBlock() error {
 	}
 
 	// TODO: Put write into a loop to make sure we write all the blocks...
-	n, err := h.f.Write(fileBlockReq.Block)
+	n, err := h.w.Write(fileBlockReq.Block)
 	if err != nil {
 		log.Errorf("Failed writing to file: %s", err)
 	}
@@ -333,12 +333,16 @@ func (h *FileTransferHandler) computeAndValidateChecksum() error {
 		return err
 	}
 
-	checksum := fmt.Sprintf("%x", h.hasher.Sum(nil))
+	sums := h.hasher.Sums()
 
-	if checksum != finishUploadRequest.FileChecksum {
-		statusResponse.Status = fmt.Sprintf("checksums didn't match got (%s), expected (%s)", checksum, finishUploadRequest.FileChecksum)
+	switch {
+	case sums.MD5 != finishUploadRequest.FileChecksum:
+		statusResponse.Status = fmt.Sprintf("checksums didn't match got (%s), expected (%s)", sums.MD5, finishUploadRequest.FileChecksum)
 		statusResponse.IsError = true
-	} else {
+	case finishUploadRequest.FileSha256 != "" && sums.SHA256 != finishUploadRequest.FileSha256:
+		statusResponse.Status = fmt.Sprintf("sha256 didn't match got (%s), expected (%s)", sums.SHA256, finishUploadRequest.FileSha256)
+		statusResponse.IsError = true
+	default:
 		statusResponse.Status = "checksums matched!"
 		statusResponse.IsError = false
 	}
@@ -371,7 +375,7 @@ func (h *FileTransferHandler) downloadFile() error {
 	}
 
 	h.File = file
-	h.f, err = os.Open(file.ToUnderlyingFilePath(h.mcfsRoot))
+	h.r, err = h.fileStore.Blobs().Open(file.BlobKey(), 0)
 
 	if err != nil {
 		log.Errorf("Unable to open file: %s", err)
@@ -379,8 +383,8 @@ func (h *FileTransferHandler) downloadFile() error {
 	}
 
 	defer func() {
-		_ = h.f.Close()
-		h.f = nil
+		_ = h.r.Close()
+		h.r = nil
 	}()
 
 	return h.runDownloadFile()
@@ -431,7 +435,7 @@ func (h *FileTransferHandler) readFileBlock(buffer []byte) error {
 	var req protocol.IncomingRequestType
 
 	fb := protocol.FileBlockRequest{}
-	n, err := h.f.Read(buffer)
+	n, err := h.r.Read(buffer)
 	if err != nil {
 		if err == io.EOF {
 			req.RequestType = protocol.FinishDownloadReq
@@ -457,6 +461,7 @@ func (h *FileTransferHandler) readFileBlock(buffer []byte) error {
 func (h *FileTransferHandler) sendDownloadFinished() error {
 	resp := protocol.FinishDownloadRequest{
 		Checksum: h.File.Checksum,
+		Sha256:   h.File.Sha256,
 		Size:     int64(h.File.Size),
 		FileID:   h.File.ID,
 		FileUUID: h.File.UUID,
@@ -464,27 +469,3 @@ func (h *FileTransferHandler) sendDownloadFinished() error {
 
 	return h.ws.WriteJSON(resp)
 }
-
-// getMimeType will determine the type of file from its extension. It strips out the extra information
-// such as the charset and just returns the underlying type. It returns "unknown" for the mime type if
-// the mime package is unable to determine the type.
-func getMimeType(name string) string {
-	mimeType := mime.TypeByExtension(filepath.Ext(name))
-	if mimeType == "" {
-		return "unknown"
-	}
-
-	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
-		// If err is nil then we return the parsed mediaType
-		return mediaType
-	}
-
-	// If we are here then ParseMediaType returned an error, so brute force separating
-	// the string to get the media type
-	semicolon := strings.Index(mimeType, ";")
-	if semicolon == -1 {
-		return strings.TrimSpace(mimeType)
-	}
-
-	return strings.TrimSpace(mimeType[:semicolon])
-}
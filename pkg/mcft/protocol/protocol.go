@@ -75,12 +75,14 @@ type FileInfoResponse struct {
 type FinishUploadRequest struct {
 	Path         string `json:"path"`
 	FileChecksum string `json:"file_checksum"`
+	FileSha256   string `json:"file_sha256,omitempty"`
 	Version
 }
 
 type FinishDownloadRequest struct {
 	Path     string `json:"path"`
 	Checksum string `json:"checksum"`
+	Sha256   string `json:"sha256,omitempty"`
 	Size     int64  `json:"size"`
 	FileID   int    `json:"file_id"`
 	FileUUID string `json:"file_uuid"`
@@ -2,6 +2,7 @@ package mcft
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/materials-commons/hydra/pkg/blobstore"
 	"github.com/materials-commons/hydra/pkg/mcft/web/api"
 	"gorm.io/gorm"
 )
@@ -11,10 +12,10 @@ type Server struct {
 	c *api.WSController
 }
 
-func NewServer(e *echo.Echo, db *gorm.DB) *Server {
+func NewServer(e *echo.Echo, db *gorm.DB, blobs blobstore.BlobStore) *Server {
 	return &Server{
 		e: e,
-		c: api.NewWSController(db),
+		c: api.NewWSController(db, blobs),
 	}
 }
 
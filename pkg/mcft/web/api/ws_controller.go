@@ -3,18 +3,21 @@ package api
 import (
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
+	"github.com/materials-commons/hydra/pkg/blobstore"
 	"github.com/materials-commons/hydra/pkg/mcft/ft"
 	"gorm.io/gorm"
 )
 
 type WSController struct {
 	db       *gorm.DB
+	blobs    blobstore.BlobStore
 	upgrader websocket.Upgrader
 }
 
-func NewWSController(db *gorm.DB) *WSController {
+func NewWSController(db *gorm.DB, blobs blobstore.BlobStore) *WSController {
 	return &WSController{
 		db:       db,
+		blobs:    blobs,
 		upgrader: websocket.Upgrader{},
 	}
 }
@@ -25,7 +28,7 @@ func (c *WSController) HandleUploadDownloadConnection(ctx echo.Context) error {
 		return err
 	}
 
-	fileTransferHandler := ft.NewFileTransferHandler(ws, c.db)
+	fileTransferHandler := ft.NewFileTransferHandler(ws, c.db, c.blobs)
 	defer func() {
 		_ = ws.Close()
 	}()
@@ -2,19 +2,22 @@ package wserv
 
 import (
 	"bytes"
-	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/materials-commons/hydra/pkg/apitoken"
+	"github.com/materials-commons/hydra/pkg/authz"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
-	"github.com/materials-commons/hydra/pkg/mcssh/mc"
+	"github.com/materials-commons/hydra/pkg/mcdb/mime"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 )
 
 // Message types
@@ -92,6 +95,10 @@ type ClientConnection struct {
 	// The user that this client is connected as.
 	User *mcmodel.User
 
+	// The token the client authenticated with. A scoped API token limits which projects the client
+	// can upload to. It is nil for connections made with the user's api_token.
+	Principal *apitoken.Principal
+
 	// The projects on the remote client. Only used for "server" connections and not "ui" connections.
 	Projects []*mcmodel.Project
 
@@ -315,6 +322,9 @@ func (c *ClientConnection) handleTransferInit(msg Message) {
 	chunkSize := int(payload["chunk_size"].(float64))
 	projectID := int(payload["project_id"].(float64))
 	checksum := payload["checksum"].(string)
+	// The SHA-256 is optional, older clients only send the MD5 checksum.
+	sha256, _ := payload["sha256"].(string)
+	sums := digest.Sums{MD5: checksum, SHA256: sha256}
 
 	// Validate
 	if transferID == "" || filePath == "" || fileSize <= 0 {
@@ -331,19 +341,28 @@ func (c *ClientConnection) handleTransferInit(msg Message) {
 		return
 	}
 
-	// Check access to the project
-	if !c.Hub.ProjectStor.UserCanAccessProject(c.User.ID, projectID) {
-		c.sendTransferReject(transferID, "no access to project")
+	// Check the token and the user can upload to the project
+	if !c.checkCanUpload(transferID, projectID) {
 		return
 	}
 
 	// Short circuit - If the file has already been uploaded, reject the transfer
-	if alreadyUploaded, f := c.alreadyUploaded(projectID, projectFilePath, checksum); alreadyUploaded {
+	if alreadyUploaded, f := c.alreadyUploaded(projectID, projectFilePath, sums); alreadyUploaded {
 		//c.sendTransferReject(transferID, "file already uploaded")
 		c.sendTransferAlreadyUploaded(transferID, f)
 		return
 	}
 
+	// Reject transfers that would take the project or user over quota before anything is created.
+	if err := c.Hub.QuotaStor.CheckQuota(projectID, c.User.ID, fileSize); err != nil {
+		if errors.Is(err, stor.ErrQuotaExceeded) {
+			c.sendTransferReject(transferID, err.Error())
+		} else {
+			c.sendTransferReject(transferID, "cannot check quota")
+		}
+		return
+	}
+
 	// Create the directory in the database if it doesn't exist
 	dirPath := filepath.Dir(projectFilePath)
 	dir, err := c.Hub.FileStor.GetOrCreateDirPath(projectID, c.User.ID, dirPath)
@@ -353,7 +372,7 @@ func (c *ClientConnection) handleTransferInit(msg Message) {
 	}
 
 	// Create the file in the database, associate it with the directory, and associate it with a remote client transfer.
-	f, err := c.Hub.FileStor.CreateFile(fileName, projectID, dir.ID, c.User.ID, mc.DetectMimeType(filePath))
+	f, err := c.Hub.FileStor.CreateFile(fileName, projectID, dir.ID, c.User.ID, mime.DetectByName(fileName))
 	if err != nil {
 		c.sendTransferReject(transferID, "cannot create file")
 		return
@@ -365,6 +384,7 @@ func (c *ClientConnection) handleTransferInit(msg Message) {
 		TransferID:       transferID,
 		ExpectedSize:     uint64(fileSize),
 		ExpectedChecksum: checksum,
+		ExpectedSha256:   sha256,
 		RemotePath:       filePath, // Have the client send this
 		OwnerID:          c.User.ID,
 		ProjectID:        projectID,
@@ -380,7 +400,7 @@ func (c *ClientConnection) handleTransferInit(msg Message) {
 	}
 
 	// Create the file we are writing to
-	file, err := f.CreateReturningHandleToUnderlyingFile(c.Hub.FileStor.Root())
+	file, err := c.Hub.FileStor.Blobs().Create(f.BlobKey())
 	if err != nil {
 		c.sendTransferReject(transferID, "cannot create file")
 		return
@@ -401,13 +421,13 @@ func (c *ClientConnection) handleTransferInit(msg Message) {
 		FileID:               f.ID,
 		FileName:             fileName,
 		RemoteFilePath:       filePath,
-		ProjectFilePath:      f.ToUnderlyingFilePath(c.Hub.FileStor.Root()),
+		BlobKey:              f.BlobKey(),
 		File:                 file,
 		ExpectedSize:         fileSize,
 		BytesWritten:         0,
 		ChunkSize:            chunkSize,
 		remoteClientTransfer: remoteClientTransfer,
-		Hasher:               md5.New(),
+		Hasher:               digest.New(),
 		HashInvalid:          false,
 		NextChunkSeq:         0,
 		LastActivity:         time.Now(),
@@ -434,7 +454,7 @@ func (c *ClientConnection) handleTransferInit(msg Message) {
 		},
 	}
 
-	log.Printf("Transfer initialized: %s (%s, %.2f MB)", transferID, fileName, fileSize/1024/1024)
+	log.Printf("Transfer initialized: %s (%s, %.2f MB)", transferID, fileName, float64(fileSize)/1024/1024)
 }
 
 func (c *ClientConnection) sendTransferAlreadyUploaded(transferID string, f *mcmodel.File) {
@@ -450,6 +470,7 @@ func (c *ClientConnection) sendTransferAlreadyUploaded(transferID string, f *mcm
 			"file_name":          f.Name,
 			"file_size":          f.Size,
 			"file_checksum":      f.Checksum,
+			"file_sha256":        f.Sha256,
 			"status":             "complete",
 			"file_created_at_ns": f.CreatedAt.UTC().UnixNano(),
 			"file_updated_at_ns": f.UpdatedAt.UTC().UnixNano(),
@@ -556,6 +577,7 @@ func (c *ClientConnection) handleTransferComplete(msg Message) {
 			"file_name":          transfer.FileName,
 			"file_id":            f.ID,
 			"file_checksum":      f.Checksum,
+			"file_sha256":        f.Sha256,
 			"file_created_at_ns": f.CreatedAt.UTC().UnixNano(),
 			"file_updated_at_ns": f.UpdatedAt.UTC().UnixNano(),
 			"file_size":          f.Size,
@@ -591,17 +613,19 @@ func (c *ClientConnection) finalizeTransfer(transfer *FileTransfer) (*mcmodel.Fi
 		return nil, fmt.Errorf("sync error: %v", err)
 	}
 
-	transfer.File.Close()
+	if err := transfer.File.Close(); err != nil {
+		return nil, fmt.Errorf("close error: %v", err)
+	}
 
 	// Verify file size
-	fileInfo, err := os.Stat(transfer.ProjectFilePath)
+	blobInfo, err := c.Hub.FileStor.Blobs().Stat(transfer.BlobKey)
 	if err != nil {
 		return nil, fmt.Errorf("stat error: %v", err)
 	}
 
-	if fileInfo.Size() != transfer.ExpectedSize {
+	if blobInfo.Size != transfer.ExpectedSize {
 		return nil, fmt.Errorf("size mismatch: expected %d, got %d",
-			transfer.ExpectedSize, fileInfo.Size())
+			transfer.ExpectedSize, blobInfo.Size)
 	}
 
 	f, err := c.Hub.FileStor.GetFileByID(transfer.FileID)
@@ -609,12 +633,12 @@ func (c *ClientConnection) finalizeTransfer(transfer *FileTransfer) (*mcmodel.Fi
 		return nil, fmt.Errorf("file not found: %v", err)
 	}
 
-	// Compute the checksum for the uploaded file. There are two paths for this.
-	var checksum string
+	// Compute the checksums for the uploaded file. There are two paths for this.
+	var sums digest.Sums
 	if transfer.HashInvalid {
 		// First path: If transfer.HashInvalid is true, we need to calculate the hash
 		// by reading the entire file and computing it the hash. This is the slow path.
-		checksum, err = calculateMD5(f.ToUnderlyingFilePath(c.Hub.FileStor.Root()))
+		sums, err = c.calculateSums(f.BlobKey())
 		if err != nil {
 			log.Printf("Warning: could not calculate hash: %v", err)
 		}
@@ -622,39 +646,40 @@ func (c *ClientConnection) finalizeTransfer(transfer *FileTransfer) (*mcmodel.Fi
 		// The second path is the fast path and will be the common case. This is the
 		// fast path. In this case we've been building up the hash as we write chunks.
 		// To calculate the hash, we don't need to read the file we just wrote.
-		// Instead, we can just call the Hasher.Sum() to give us the hash.
-		checksum = fmt.Sprintf("%x", transfer.Hasher.Sum(nil))
+		// Instead, we can just call the Hasher.Sums() to give us the hashes.
+		sums = transfer.Hasher.Sums()
+	}
+
+	if sums.MD5 != transfer.remoteClientTransfer.ExpectedChecksum {
+		return nil, fmt.Errorf("checksum mismatch: expected %s, got %s", transfer.remoteClientTransfer.ExpectedChecksum, sums.MD5)
 	}
 
-	if checksum != transfer.remoteClientTransfer.ExpectedChecksum {
-		return nil, fmt.Errorf("checksum mismatch: expected %s, got %s", transfer.remoteClientTransfer.ExpectedChecksum, checksum)
+	if expected := transfer.remoteClientTransfer.ExpectedSha256; expected != "" && sums.SHA256 != expected {
+		return nil, fmt.Errorf("sha256 mismatch: expected %s, got %s", expected, sums.SHA256)
 	}
 
 	// Update the file entry.
-	switched, err := c.Hub.FileStor.DoneWritingToFile(f, transfer.remoteClientTransfer.ExpectedChecksum, transfer.ExpectedSize, c.Hub.ConversionStor)
+	switched, err := c.Hub.FileStor.DoneWritingToFile(f, sums, transfer.ExpectedSize, c.Hub.ConversionStor)
 
 	if err != nil {
 		return nil, fmt.Errorf("file update error: %v", err)
 	}
 
 	if switched {
-		if f.RealFileExists(c.Hub.FileStor.Root()) {
+		if blobstore.Exists(c.Hub.FileStor.Blobs(), f.BlobKey()) {
 			// The real file exists, so we don't need to keep the uploaded file.
-			if err := os.Remove(f.ToUnderlyingFilePathForUUID(c.Hub.FileStor.Root())); err != nil {
-				log.Printf("Failed to remove file %s: %s", f.ToUnderlyingFilePath(c.Hub.FileStor.Root()), err)
+			if err := c.Hub.FileStor.Blobs().Delete(f.BlobKeyForUUID()); err != nil {
+				log.Printf("Failed to remove file %s: %s", f.BlobKeyForUUID(), err)
 			}
 		} else {
 			// Real file doesn't exist so move the uploaded file to the correct UUID path.
-			uploadedFilePath := f.ToUnderlyingFilePathForUUID(c.Hub.FileStor.Root())
-			// Get the path that the file should be moved to.
-			newPath := f.ToUnderlyingFilePath(c.Hub.FileStor.Root())
-
-			// Make sure the destination path exists.
-			_ = f.MkdirUnderlyingPath(c.Hub.FileStor.Root())
+			uploadedFileKey := f.BlobKeyForUUID()
+			// Get the key that the file should be moved to.
+			newKey := f.BlobKey()
 
 			// Move the file.
-			if err := os.Rename(uploadedFilePath, newPath); err != nil {
-				log.Printf("Failed to move file %s to %s: %s", uploadedFilePath, newPath, err)
+			if err := c.Hub.FileStor.Blobs().Rename(uploadedFileKey, newKey); err != nil {
+				log.Printf("Failed to move file %s to %s: %s", uploadedFileKey, newKey, err)
 			}
 
 			// Need to set the file health to fixed
@@ -715,6 +740,12 @@ func (c *ClientConnection) handleTransferResume(msg Message) {
 		return
 	}
 
+	// The token or the user's role may have changed since the transfer was started, so
+	// recheck that they can still upload to the project before reopening the file.
+	if !c.checkCanUpload(transferID, remoteTransfer.ProjectID) {
+		return
+	}
+
 	// Check if already complete
 	if remoteTransfer.State == "complete" {
 		c.sendTransferReject(transferID, "already completed")
@@ -723,21 +754,21 @@ func (c *ClientConnection) handleTransferResume(msg Message) {
 
 	// Verify file exists on disk
 	// TODO: We could just re-create the file and have the resume start from the beginning.
-	fileInfo, err := os.Stat(remoteTransfer.File.ToUnderlyingFilePathForUUID(c.Hub.FileStor.Root()))
+	blobInfo, err := c.Hub.FileStor.Blobs().Stat(remoteTransfer.File.BlobKeyForUUID())
 	if err != nil {
 		c.sendTransferReject(transferID, "file not found on disk")
 		return
 	}
 
 	// Open the file for writing
-	file, err := os.OpenFile(remoteTransfer.File.ToUnderlyingFilePathForUUID(c.Hub.FileStor.Root()), os.O_WRONLY, 0644)
+	file, err := c.Hub.FileStor.Blobs().Append(remoteTransfer.File.BlobKeyForUUID())
 	if err != nil {
 		c.sendTransferReject(transferID, "cannot open file")
 		return
 	}
 
 	// Calculate where to resume from
-	actualSize := fileInfo.Size()
+	actualSize := blobInfo.Size
 	nextChunkSeq := int(actualSize / int64(remoteTransfer.ChunkSize))
 
 	// TODO: Consider building the hash of the file here, so that we don't have to
@@ -750,7 +781,7 @@ func (c *ClientConnection) handleTransferResume(msg Message) {
 		DirectoryID:          remoteTransfer.File.DirectoryID,
 		FileName:             filepath.Base(remoteTransfer.RemotePath),
 		RemoteFilePath:       remoteTransfer.RemotePath,
-		ProjectFilePath:      remoteTransfer.File.ToUnderlyingFilePathForUUID(c.Hub.FileStor.Root()),
+		BlobKey:              remoteTransfer.File.BlobKeyForUUID(),
 		remoteClientTransfer: remoteTransfer,
 		File:                 file,
 		ExpectedSize:         int64(remoteTransfer.ExpectedSize),
@@ -777,6 +808,28 @@ func (c *ClientConnection) handleTransferResume(msg Message) {
 		float64(actualSize)/float64(transfer.ExpectedSize)*100)
 }
 
+// checkCanUpload checks that the connection's token and user can write to the project. If
+// they can't then a transfer reject is sent for transferID and false is returned.
+func (c *ClientConnection) checkCanUpload(transferID string, projectID int) bool {
+	if c.Principal != nil {
+		if err := c.Principal.CheckWrite(projectID); err != nil {
+			c.sendTransferReject(transferID, err.Error())
+			return false
+		}
+	}
+
+	if err := authz.Require(c.Hub.ProjectStor, c.User.ID, projectID, authz.Contributor); err != nil {
+		if errors.Is(err, authz.ErrReadOnly) {
+			c.sendTransferReject(transferID, err.Error())
+		} else {
+			c.sendTransferReject(transferID, "no access to project")
+		}
+		return false
+	}
+
+	return true
+}
+
 func (c *ClientConnection) sendResumeResponse(transferID string, transfer *FileTransfer) {
 	c.Send <- Message{
 		Command:   MsgTransferResumeResponse,
@@ -822,7 +875,7 @@ func (c *ClientConnection) handleTransferCancel(msg Message) {
 	transfer.File.Close()
 	transfer.mu.Unlock()
 	// Lets, remove the underlying filesystem file. We can safely ignore the error here.
-	_ = os.Remove(transfer.remoteClientTransfer.File.ToUnderlyingFilePathForUUID(c.Hub.FileStor.Root()))
+	_ = c.Hub.FileStor.Blobs().Delete(transfer.remoteClientTransfer.File.BlobKeyForUUID())
 
 	// Delete the RemoteClientTransfer, and the File from the database.
 	if err := c.Hub.RemoteClientTransferStor.DeleteRemoteClientTransferByTransferID(transferID); err != nil {
@@ -920,12 +973,12 @@ func (c *ClientConnection) handleHeartbeat(msg Message) error {
 // alreadyUploaded checks if there is a file already matching the checksum. If there is
 // then it will point the file to the existing file taking into account that this
 // exact file may already exist in the project.
-func (c *ClientConnection) alreadyUploaded(projectID int, filePath, checksum string) (bool, *mcmodel.File) {
+func (c *ClientConnection) alreadyUploaded(projectID int, filePath string, sums digest.Sums) (bool, *mcmodel.File) {
 	// First check if there is a file matching checksum
 	dirPath := filepath.Dir(filePath)
 	fileName := filepath.Base(filePath)
 
-	f, err := c.Hub.FileStor.FindMatchingFileByChecksum(checksum)
+	f, err := c.Hub.FileStor.FindMatchingFileByChecksum(sums)
 	if err != nil {
 		// if we get an error then log it, and return false
 		log.Printf("error finding file by checksum: %v", err)
@@ -939,9 +992,9 @@ func (c *ClientConnection) alreadyUploaded(projectID int, filePath, checksum str
 
 	// If we are here, then a file matching the checksum was found.
 
-	// 1. Check that the file actually exists on disk.
-	if !f.RealFileExists(c.Hub.FileStor.Root()) {
-		// File entry in database, but file doesn't exist on disk. So upload it.
+	// 1. Check that the file actually exists in the blob store.
+	if !blobstore.Exists(c.Hub.FileStor.Blobs(), f.BlobKey()) {
+		// File entry in database, but its contents aren't stored. So upload it.
 		return false, nil
 	}
 
@@ -949,7 +1002,7 @@ func (c *ClientConnection) alreadyUploaded(projectID int, filePath, checksum str
 	existingFile, err := c.Hub.FileStor.GetFileByPath(projectID, filePath)
 	if err == nil && existingFile != nil {
 		// Check if the checksum matches. If it does, then there is nothing to do.
-		if existingFile.Checksum == checksum {
+		if existingFile.Sums().Matches(sums) {
 			// Yes, there is a file matching the checksum with the same name.
 			return true, existingFile
 		}
@@ -975,6 +1028,8 @@ func (c *ClientConnection) alreadyUploaded(projectID int, filePath, checksum str
 
 	updates := mcmodel.File{
 		Size:         f.Size,
+		Checksum:     f.Checksum,
+		Sha256:       f.Sha256,
 		UsesUUID:     f.UUIDForUses(),
 		UploadSource: "MCFT",
 	}
@@ -1040,18 +1095,14 @@ func (c *ClientConnection) handleListDirectory(msg Message) {
 	}
 }
 
-// Calculate MD5 hash of a file
-func calculateMD5(path string) (string, error) {
-	file, err := os.Open(path)
+// Calculate the MD5 and SHA-256 checksums of a file
+func (c *ClientConnection) calculateSums(key string) (digest.Sums, error) {
+	file, err := c.Hub.FileStor.Blobs().Open(key, 0)
 	if err != nil {
-		return "", err
+		return digest.Sums{}, err
 	}
 	defer file.Close()
 
-	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", err
-	}
-
-	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+	sums, _, err := digest.FromReader(file)
+	return sums, err
 }
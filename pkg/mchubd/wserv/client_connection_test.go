@@ -1,30 +1,256 @@
 package wserv
 
 import (
+	"fmt"
 	"testing"
+
+	"github.com/materials-commons/hydra/pkg/apitoken"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHandleTransferInit(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	mcfsDir := t.TempDir()
+	hub := NewHub(db, mcfsDir, blobstore.NewLocalBlobStore(mcfsDir))
+
+	user := b.User("user1")
+	proj := b.Project("proj1", user)
+	user2 := b.User("user2")
+	otherProj := b.Project("proj2", user2)
+	viewerProj := b.Project("proj4", user2)
+	b.AddViewer(viewerProj, user)
+	quotaProj := b.Project("proj3", user)
+	require.NoError(t, hub.QuotaStor.SetProjectQuota(quotaProj.ID, 100))
+
+	remoteClient, err := hub.RemoteClientStor.CreateRemoteClient(&mcmodel.RemoteClient{ClientID: "client1", OwnerID: user.ID})
+	require.NoError(t, err)
+
+	transferInit := func(transferID string, projectID int, fileSize float64) Message {
+		return Message{
+			Command: MsgTransferInit,
+			ID:      transferID,
+			Payload: map[string]interface{}{
+				"transfer_id":  transferID,
+				"project_path": "/dir1/file.txt",
+				"file_path":    "/home/user1/file.txt",
+				"file_size":    fileSize,
+				"chunk_size":   float64(1024),
+				"project_id":   float64(projectID),
+				"checksum":     "abc123",
+			},
+		}
+	}
+
 	tests := []struct {
-		name    string
-		setup   func() *ClientConnection
-		wantErr bool
+		name        string
+		msg         Message
+		wantCommand string
+		wantReason  string
 	}{
 		{
-			name: "successful transfer init",
-			setup: func() *ClientConnection {
-				cc := &ClientConnection{}
-				return cc
-			},
-			wantErr: false,
+			name:        "successful transfer init",
+			msg:         transferInit("t1", proj.ID, 2048),
+			wantCommand: MsgTransferAccept,
+		},
+		{
+			name:        "transfer id already used",
+			msg:         transferInit("t1", proj.ID, 2048),
+			wantCommand: MsgTransferReject,
+			wantReason:  "transfer already exists",
+		},
+		{
+			name:        "invalid file size",
+			msg:         transferInit("t2", proj.ID, 0),
+			wantCommand: MsgTransferReject,
+			wantReason:  "invalid parameters",
+		},
+		{
+			name:        "no access to project",
+			msg:         transferInit("t3", otherProj.ID, 2048),
+			wantCommand: MsgTransferReject,
+			wantReason:  "no access to project",
+		},
+		{
+			name:        "read-only access to project",
+			msg:         transferInit("t5", viewerProj.ID, 2048),
+			wantCommand: MsgTransferReject,
+			wantReason:  "read-only access",
 		},
+		{
+			name:        "over quota",
+			msg:         transferInit("t4", quotaProj.ID, 2048),
+			wantCommand: MsgTransferReject,
+			wantReason:  "storage quota exceeded",
+		},
+	}
+
+	cc := &ClientConnection{
+		ID:           "client1",
+		Send:         make(chan Message, 1),
+		Hub:          hub,
+		User:         user,
+		RemoteClient: remoteClient,
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			cc := tt.setup()
-			msg := Message{}
-			cc.handleTransferInit(msg)
+			cc.handleTransferInit(tt.msg)
+			require.Len(t, cc.Send, 1)
+			reply := <-cc.Send
+			require.Equal(t, tt.wantCommand, reply.Command)
+			if tt.wantReason != "" {
+				require.Contains(t, reply.Payload.(map[string]interface{})["reason"], tt.wantReason)
+			}
 		})
 	}
+
+	// The accepted transfer is tracked, and its file was created in the project.
+	require.Len(t, cc.activeTransfers, 1)
+	transfer := cc.activeTransfers["t1"]
+	require.NoError(t, transfer.File.Close())
+	f, err := hub.FileStor.GetFileByID(transfer.FileID)
+	require.NoError(t, err)
+	require.Equal(t, "file.txt", f.Name)
+	dir, err := hub.FileStor.GetDirByPath(proj.ID, "/dir1")
+	require.NoError(t, err)
+	require.Equal(t, dir.ID, f.DirectoryID)
+}
+
+func TestHandleTransferInitWithScopedToken(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	mcfsDir := t.TempDir()
+	hub := NewHub(db, mcfsDir, blobstore.NewLocalBlobStore(mcfsDir))
+
+	user := b.User("user1")
+	proj := b.Project("proj1", user)
+	otherProj := b.Project("proj2", user)
+
+	remoteClient, err := hub.RemoteClientStor.CreateRemoteClient(&mcmodel.RemoteClient{ClientID: "client1", OwnerID: user.ID})
+	require.NoError(t, err)
+
+	transferInit := func(transferID string, projectID int) Message {
+		return Message{
+			Command: MsgTransferInit,
+			ID:      transferID,
+			Payload: map[string]interface{}{
+				"transfer_id":  transferID,
+				"project_path": "/file.txt",
+				"file_path":    "/home/user1/file.txt",
+				"file_size":    float64(2048),
+				"chunk_size":   float64(1024),
+				"project_id":   float64(projectID),
+				"checksum":     "abc123",
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		scope      string
+		projectID  int
+		wantReason string
+	}{
+		{name: "write token", scope: mcmodel.APITokenScopeWrite, projectID: proj.ID},
+		{name: "read token", scope: mcmodel.APITokenScopeRead, projectID: proj.ID, wantReason: "can't be used to write"},
+		{name: "other project", scope: mcmodel.APITokenScopeReadWrite, projectID: otherProj.ID, wantReason: "different project"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := &ClientConnection{
+				ID:           "client1",
+				Send:         make(chan Message, 1),
+				Hub:          hub,
+				User:         user,
+				RemoteClient: remoteClient,
+				Principal: &apitoken.Principal{
+					User:  user,
+					Token: &mcmodel.APIToken{UserID: user.ID, ProjectID: proj.ID, Scope: tt.scope},
+				},
+			}
+
+			cc.handleTransferInit(transferInit(fmt.Sprintf("scoped%d", i), tt.projectID))
+			reply := <-cc.Send
+			if tt.wantReason == "" {
+				require.Equal(t, MsgTransferAccept, reply.Command)
+				return
+			}
+
+			require.Equal(t, MsgTransferReject, reply.Command)
+			require.Contains(t, reply.Payload.(map[string]interface{})["reason"], tt.wantReason)
+		})
+	}
+}
+
+func TestHandleTransferResumeWithScopedToken(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	mcfsDir := t.TempDir()
+	hub := NewHub(db, mcfsDir, blobstore.NewLocalBlobStore(mcfsDir))
+
+	user := b.User("user1")
+	proj := b.Project("proj1", user)
+
+	remoteClient, err := hub.RemoteClientStor.CreateRemoteClient(&mcmodel.RemoteClient{ClientID: "client1", OwnerID: user.ID})
+	require.NoError(t, err)
+
+	connWithScope := func(scope string) *ClientConnection {
+		return &ClientConnection{
+			ID:           "client1",
+			Send:         make(chan Message, 1),
+			Hub:          hub,
+			User:         user,
+			RemoteClient: remoteClient,
+			Principal: &apitoken.Principal{
+				User:  user,
+				Token: &mcmodel.APIToken{UserID: user.ID, ProjectID: proj.ID, Scope: scope},
+			},
+		}
+	}
+
+	// Start the transfer with a write token, then drop the connection.
+	cc := connWithScope(mcmodel.APITokenScopeWrite)
+	cc.handleTransferInit(Message{
+		Command: MsgTransferInit,
+		ID:      "t1",
+		Payload: map[string]interface{}{
+			"transfer_id":  "t1",
+			"project_path": "/file.txt",
+			"file_path":    "/home/user1/file.txt",
+			"file_size":    float64(2048),
+			"chunk_size":   float64(1024),
+			"project_id":   float64(proj.ID),
+			"checksum":     "abc123",
+		},
+	})
+	reply := <-cc.Send
+	require.Equal(t, MsgTransferAccept, reply.Command)
+	require.NoError(t, cc.activeTransfers["t1"].File.Close())
+
+	resume := Message{
+		Command: MsgTransferResume,
+		ID:      "t1",
+		Payload: map[string]interface{}{"transfer_id": "t1"},
+	}
+
+	// A read token for the same user can't pick the transfer back up.
+	cc = connWithScope(mcmodel.APITokenScopeRead)
+	cc.handleTransferResume(resume)
+	reply = <-cc.Send
+	require.Equal(t, MsgTransferReject, reply.Command)
+	require.Contains(t, reply.Payload.(map[string]interface{})["reason"], "can't be used to write")
+	require.Empty(t, cc.activeTransfers)
+
+	// A write token can.
+	cc = connWithScope(mcmodel.APITokenScopeWrite)
+	cc.handleTransferResume(resume)
+	reply = <-cc.Send
+	require.Equal(t, MsgTransferResumeResponse, reply.Command)
+	require.Len(t, cc.activeTransfers, 1)
+	require.NoError(t, cc.activeTransfers["t1"].File.Close())
 }
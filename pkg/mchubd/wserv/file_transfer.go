@@ -2,12 +2,12 @@ package wserv
 
 import (
 	"fmt"
-	"hash"
 	"log"
-	"os"
 	"sync"
 	"time"
 
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 )
@@ -15,7 +15,7 @@ import (
 // FileTransfer represents a file transfer in progress.
 type FileTransfer struct {
 	TransferID           string
-	File                 *os.File
+	File                 blobstore.Writer
 	ProjectID            int
 	DirectoryID          int
 	FileID               int
@@ -23,13 +23,13 @@ type FileTransfer struct {
 	remoteClientTransfer *mcmodel.RemoteClientTransfer
 	FileName             string
 	RemoteFilePath       string
-	ProjectFilePath      string
+	BlobKey              string
 	ExpectedSize         int64
 	BytesWritten         int64
 	ChunkSize            int
 	NextChunkSeq         int
 	LastActivity         time.Time
-	Hasher               hash.Hash // Track the hash of the file. Updated as blocks are written.
+	Hasher               *digest.Hasher // Track the checksums of the file. Updated as blocks are written.
 
 	// Set to true if the hash is invalid. This happens when the writes
 	// are interrupted and have to resume without the hash state
@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/materials-commons/hydra/pkg/apitoken"
+	"github.com/materials-commons/hydra/pkg/blobstore"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 	"gorm.io/gorm"
@@ -29,6 +31,8 @@ type Hub struct {
 	RemoteClientStor         stor.RemoteClientStor
 	RemoteClientTransferStor stor.RemoteClientTransferStor
 	ConversionStor           stor.ConversionStor
+	QuotaStor                stor.QuotaStor
+	authenticator            *apitoken.Authenticator
 	partialTransferFileStor  *stor.GormPartialTransferFileStor // TODO: Make this an interface
 }
 
@@ -59,7 +63,9 @@ type HubCommandResponse struct {
 	Status   string `json:"status"`
 }
 
-func NewHub(db *gorm.DB, mcfsDir string) *Hub {
+// NewHub creates a Hub. File contents are kept in blobs.
+func NewHub(db *gorm.DB, mcfsDir string, blobs blobstore.BlobStore) *Hub {
+	userStor := stor.NewGormUserStor(db)
 	return &Hub{
 		// Initialize connection managers
 		WSManager:  NewWebSocketManager(),
@@ -67,12 +73,14 @@ func NewHub(db *gorm.DB, mcfsDir string) *Hub {
 		rrManager:  NewRequestResponseManager(30 * time.Second), // 30s default timeout
 
 		// Initialize storage interfaces
-		UserStor:                 stor.NewGormUserStor(db),
+		UserStor:                 userStor,
 		ProjectStor:              stor.NewGormProjectStor(db),
 		RemoteClientStor:         stor.NewGormRemoteClientStor(db),
-		FileStor:                 stor.NewGormFileStor(db, mcfsDir),
+		FileStor:                 stor.NewGormFileStorWithBlobStore(db, mcfsDir, blobs),
 		RemoteClientTransferStor: stor.NewGormRemoteClientTransferStor(db),
 		ConversionStor:           stor.NewGormConversionStor(db),
+		QuotaStor:                stor.NewGormQuotaStor(db),
+		authenticator:            apitoken.NewAuthenticator(userStor, stor.NewGormAPITokenStor(db), apitoken.DefaultCacheTTL),
 		partialTransferFileStor:  stor.NewGormPartialTransferFileStor(db),
 	}
 }
@@ -134,11 +142,12 @@ var upgrader = websocket.Upgrader{
 // ServeWS handles incoming WebSocket connections and manages the connection lifecycle.
 func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
 	// Validate token and get client info
-	user, err := h.validateAuthAndGetUser(r)
+	principal, err := h.validateAuth(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
+	user := principal.User
 
 	clientConnectionAttrs := getClientConnectionAttributes(r)
 
@@ -174,6 +183,7 @@ func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
 		Type:         clientConnectionAttrs.Type,
 		RemoteClient: remoteClient,
 		User:         user,
+		Principal:    principal,
 		Projects:     h.commaSeparatedProjectIDsToProjects(clientConnectionAttrs.Projects),
 		Conn:         conn,
 		Send:         make(chan Message, 256),
@@ -449,14 +459,14 @@ func (h *Hub) HandleSSE(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Ensure the user is authenticated
-	user, err := h.validateAuthAndGetUser(r)
+	principal, err := h.validateAuth(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
 	// Delegate to SSE manager
-	h.sseManager.HandleSSE(w, r, user)
+	h.sseManager.HandleSSE(w, r, principal.User)
 }
 
 /////////////////// Utility functions/methods ///////////////////
@@ -499,13 +509,15 @@ func (h *Hub) commaSeparatedProjectIDsToProjects(commaSeparatedIDs string) []*mc
 	return projects
 }
 
-func (h *Hub) validateAuthAndGetUser(r *http.Request) (*mcmodel.User, error) {
+// validateAuth authenticates the request by its bearer token or api_token query parameter. The token
+// can be a user's api_token or a scoped API token.
+func (h *Hub) validateAuth(r *http.Request) (*apitoken.Principal, error) {
 	token, err := h.getAuthToken(r)
 	if err != nil {
 		return nil, err
 	}
 
-	return h.UserStor.GetUserByAPIToken(token)
+	return h.authenticator.Authenticate(token)
 }
 
 func (h *Hub) getAuthToken(r *http.Request) (string, error) {
@@ -1,6 +1,7 @@
 package mc
 
 import (
+	"github.com/materials-commons/hydra/pkg/blobstore"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 	"gorm.io/gorm"
 )
@@ -12,12 +13,15 @@ type Stores struct {
 	FileStore       stor.FileStor
 	ProjectStore    stor.ProjectStor
 	ConversionStore stor.ConversionStor
+	QuotaStore      stor.QuotaStor
 }
 
-func NewGormStores(db *gorm.DB, mcfsRoot string) *Stores {
+// NewGormStores creates the Stores. File contents are kept in blobs.
+func NewGormStores(db *gorm.DB, mcfsRoot string, blobs blobstore.BlobStore) *Stores {
 	return &Stores{
-		FileStore:       stor.NewGormFileStor(db, mcfsRoot),
+		FileStore:       stor.NewGormFileStorWithBlobStore(db, mcfsRoot, blobs),
 		ProjectStore:    stor.NewGormProjectStor(db),
 		ConversionStore: stor.NewGormConversionStor(db),
+		QuotaStore:      stor.NewGormQuotaStor(db),
 	}
 }
@@ -4,8 +4,9 @@ import (
 	"context"
 	"io"
 	"net"
+	"sync"
 
-	"github.com/gliderlabs/ssh"
+	"github.com/charmbracelet/ssh"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 )
 
@@ -14,12 +15,50 @@ import (
 // *mcmodel.User entry. All other methods can be stubbed out. Comments for each of the methods
 // were carried over from the ssh.Session interface definition.
 type fakeSSHSession struct {
-	c context.Context
+	c *fakeSSHContext
 }
 
-func newFakeSshSession() fakeSSHSession {
-	u := &mcmodel.User{Slug: "testslug", ID: 1}
-	return fakeSSHSession{c: context.WithValue(context.Background(), "mcuser", u)}
+func newFakeSshSession(u *mcmodel.User) fakeSSHSession {
+	return fakeSSHSession{c: &fakeSSHContext{Context: context.WithValue(context.Background(), "mcuser", u)}}
+}
+
+// fakeSSHContext implements the ssh.Context interface around a context.Context. Only the embedded
+// context.Context is used by the mcscp.Handler implementation.
+type fakeSSHContext struct {
+	context.Context
+	sync.Mutex
+}
+
+func (c *fakeSSHContext) User() string {
+	return ""
+}
+
+func (c *fakeSSHContext) SessionID() string {
+	return ""
+}
+
+func (c *fakeSSHContext) ClientVersion() string {
+	return ""
+}
+
+func (c *fakeSSHContext) ServerVersion() string {
+	return ""
+}
+
+func (c *fakeSSHContext) RemoteAddr() net.Addr {
+	return nil
+}
+
+func (c *fakeSSHContext) LocalAddr() net.Addr {
+	return nil
+}
+
+func (c *fakeSSHContext) Permissions() *ssh.Permissions {
+	return &ssh.Permissions{}
+}
+
+func (c *fakeSSHContext) SetValue(key, value interface{}) {
+	c.Context = context.WithValue(c.Context, key, value)
 }
 
 // User returns the username used when establishing the SSH connection.
@@ -77,7 +116,7 @@ func (s fakeSSHSession) PublicKey() ssh.PublicKey {
 //
 // The context is canceled when the client's connection closes or I/O
 // operation fails.
-func (s fakeSSHSession) Context() context.Context {
+func (s fakeSSHSession) Context() ssh.Context {
 	return s.c
 }
 
@@ -87,6 +126,11 @@ func (s fakeSSHSession) Permissions() ssh.Permissions {
 	return ssh.Permissions{}
 }
 
+// EmulatedPty returns true if the session is emulating a PTY.
+func (s fakeSSHSession) EmulatedPty() bool {
+	return false
+}
+
 // Pty returns PTY information, a channel of window size changes, and a boolean
 // of whether or not a PTY was accepted for this session.
 func (s fakeSSHSession) Pty() (ssh.Pty, <-chan ssh.Window, bool) {
@@ -1,17 +1,18 @@
 package mcscp
 
 import (
-	"crypto/md5"
 	"fmt"
 	"io"
 	"io/fs"
-	"os"
 	"path/filepath"
 
 	"github.com/apex/log"
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish/scp"
+	"github.com/materials-commons/hydra/pkg/authz"
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/mime"
 	"github.com/materials-commons/hydra/pkg/mcssh/mc"
 )
 
@@ -59,6 +60,9 @@ type mcfsHandler struct {
 	// loadProjectAndUserIntoHandler and pkg/mc/util mc.*ProjectSlug* methods for how this is handled.
 	project *mcmodel.Project
 
+	// The user's role in project. Users with read-only access can download but not upload.
+	role authz.Role
+
 	// The different stores used in the handler.
 	stores *mc.Stores
 
@@ -181,8 +185,8 @@ func (h *mcfsHandler) NewDirEntry(s ssh.Session, name string) (*scp.DirEntry, er
 }
 
 // NewFileEntry sends back the new file entry, and also the handle and a close function for the file. For
-// Materials Commons this means locating the real file by it's UUID (file.ToUnderlyingFilePath(mcfsRoot)),
-// and using os.Open to read it. NewFileEntry doesn't create a file on the server. It sends back to the
+// Materials Commons this means locating the real file by it's UUID (file.BlobKey()), and opening it
+// in the blob store to read it. NewFileEntry doesn't create a file on the server. It sends back to the
 // client an existing file.
 func (h *mcfsHandler) NewFileEntry(s ssh.Session, name string) (*scp.FileEntry, func() error, error) {
 	if err := h.loadProjectAndUserIntoHandler(s, name); err != nil {
@@ -196,7 +200,7 @@ func (h *mcfsHandler) NewFileEntry(s ssh.Session, name string) (*scp.FileEntry,
 		return nil, nil, fmt.Errorf("unable to find file '%s' in project %d: %s", path, h.project.ID, err)
 	}
 
-	f, err := os.Open(file.ToUnderlyingFilePath(h.mcfsRoot))
+	f, err := h.stores.FileStore.Blobs().Open(file.BlobKey(), 0)
 	if err != nil {
 		log.Errorf("Failed to open file %q: %s", path, err)
 		return nil, nil, fmt.Errorf("failed to open %q: %w", path, err)
@@ -224,6 +228,11 @@ func (h *mcfsHandler) Mkdir(s ssh.Session, entry *scp.DirEntry) error {
 		return err
 	}
 
+	if err := authz.Check(h.role, authz.Contributor); err != nil {
+		log.Errorf("User %d can't create %s in project %d: %s", h.user.ID, entry.Filepath, h.project.ID, err)
+		return err
+	}
+
 	path := mc.RemoveProjectSlugFromPath(entry.Filepath, h.project.Slug)
 
 	if _, err := h.stores.FileStore.GetOrCreateDirPath(h.project.ID, h.user.ID, path); err != nil {
@@ -246,19 +255,24 @@ func (h *mcfsHandler) Write(s ssh.Session, entry *scp.FileEntry) (int64, error)
 		file *mcmodel.File
 	)
 
-	// After writing the file if we determine that a file matching its checksum already exists then
-	// we can delete the file just written (because we updated the file in the database to point at
-	// the file with the matching checksum). Assume this is not the case, but if a matching file is
-	// found then Write will set deleteFile to true. The defer method to close the opened file will
-	// then take care of deleting the file since a version with that checksum already exists.
-	deleteFile := false
-
 	if err := h.loadProjectAndUserIntoHandler(s, entry.Filepath); err != nil {
 		return 0, err
 	}
 
+	if err := authz.Check(h.role, authz.Contributor); err != nil {
+		log.Errorf("User %d can't upload %s to project %d: %s", h.user.ID, entry.Filepath, h.project.ID, err)
+		return 0, err
+	}
+
 	path := mc.RemoveProjectSlugFromPath(entry.Filepath, h.project.Slug)
 
+	// SCP sends the size before the contents, so uploads that would go over quota are rejected before
+	// anything is created.
+	if err := h.stores.QuotaStore.CheckQuota(h.project.ID, h.user.ID, entry.Size); err != nil {
+		log.Errorf("Rejecting upload of %s to project %d: %s", path, h.project.ID, err)
+		return 0, err
+	}
+
 	// First steps - Find or create the directories in the path
 	if dir, err = h.stores.FileStore.GetOrCreateDirPath(h.project.ID, h.user.ID, filepath.Dir(path)); err != nil {
 		return 0, fmt.Errorf("unable to find dir '%s' for project %d: %s", filepath.Dir(path), h.project.ID, err)
@@ -266,41 +280,22 @@ func (h *mcfsHandler) Write(s ssh.Session, entry *scp.FileEntry) (int64, error)
 
 	// Create a file that isn't set as current. This way the file doesn't show up until it's
 	// data has been written.
-	if file, err = h.stores.FileStore.CreateFile(entry.Name, h.project.ID, dir.ID, h.user.ID, mc.GetMimeTypeByExtension(entry.Name)); err != nil {
+	if file, err = h.stores.FileStore.CreateFile(entry.Name, h.project.ID, dir.ID, h.user.ID, mime.DetectByName(entry.Name)); err != nil {
 		log.Errorf("Error creating file %s in project %d, in directory %d for user %d: %s", entry.Name, h.project.ID, dir.ID, h.user.ID, err)
 		return 0, fmt.Errorf("unable to create file '%s' in dir %d for project %d: %s", entry.Name, dir.ID, h.project.ID, err)
 	}
 
-	// Create the directory path where the file will be written to
-	if err := os.MkdirAll(file.ToUnderlyingDirPath(h.mcfsRoot), 0777); err != nil {
-		log.Errorf("Error creating directory path %s: %s", file.ToUnderlyingDirPath(h.mcfsRoot), err)
-		return 0, err
-	}
-
-	f, err := os.OpenFile(file.ToUnderlyingFilePath(h.mcfsRoot), os.O_TRUNC|os.O_RDWR|os.O_CREATE, entry.Mode)
+	blobs := h.stores.FileStore.Blobs()
+	f, err := blobs.Create(file.BlobKey())
 	if err != nil {
-		log.Errorf("Failed to open file %d path '%s': %s", file.ID, file.ToUnderlyingFilePath(h.mcfsRoot), err)
-		return 0, fmt.Errorf("failed to open file %d path '%s': %s", file.ID, file.ToUnderlyingFilePath(h.mcfsRoot), err)
+		log.Errorf("Failed to open file %d blob '%s': %s", file.ID, file.BlobKey(), err)
+		return 0, fmt.Errorf("failed to open file %d blob '%s': %s", file.ID, file.BlobKey(), err)
 	}
 
-	// The file is written into in one go in the io.Copy. So we can safely close the file when this
-	// method finishes.
-	defer func() {
-		if err := f.Close(); err != nil {
-			log.Errorf("error closing file (%d) at '%s': %s", file.ID, file.ToUnderlyingFilePath(h.mcfsRoot), err)
-		}
-
-		if deleteFile {
-			// A file matching this file's checksum already exists in the system so delete the file we just
-			// uploaded. See the call to h.stores.FileStore.PointAtExistingIfExists towards the end of this method.
-			_ = os.Remove(file.ToUnderlyingFilePath(h.mcfsRoot))
-		}
-	}()
-
 	// Each file in Materials Commons has a checksum associated with it. Create a TeeReader so that as the stream of
 	// bytes is read it goes to two separate destinations. One is the file we just opened, and the second is the hasher
 	// that is computing the hash.
-	hasher := md5.New()
+	hasher := digest.New()
 	teeReader := io.TeeReader(entry.Reader, hasher)
 
 	written, err := io.Copy(f, teeReader)
@@ -308,14 +303,24 @@ func (h *mcfsHandler) Write(s ssh.Session, entry *scp.FileEntry) (int64, error)
 		log.Errorf("failure writing to file %d: %s", file.ID, err)
 	}
 
-	checksum := fmt.Sprintf("%x", hasher.Sum(nil))
-	// Note deleteFile in the if statement - DoneWritingToFile will switch the file if there was an existing file that had the
-	// same checksum. Here is where deleteFile gets set so that it can delete the file that was just written
-	// if this switch occurred.
-	if deleteFile, err = h.stores.FileStore.DoneWritingToFile(file, checksum, written, h.stores.ConversionStore); err != nil {
+	// The file is written into in one go in the io.Copy, so it can be closed now. It has to be closed
+	// before DoneWritingToFile as some blob stores don't make the contents visible until the close.
+	if err := f.Close(); err != nil {
+		log.Errorf("error closing file (%d) at '%s': %s", file.ID, file.BlobKey(), err)
+		return written, err
+	}
+
+	// DoneWritingToFile will switch the file if there was an existing file that had the same checksum. When
+	// this switch occurs the file that was just written is a duplicate, so delete it.
+	deleteFile, err := h.stores.FileStore.DoneWritingToFile(file, hasher.Sums(), written, h.stores.ConversionStore)
+	if err != nil {
 		log.Errorf("Failure updating file (%d) and project (%d) metadata: %s", file.ID, h.project.ID, err)
 	}
 
+	if deleteFile {
+		_ = blobs.Delete(file.BlobKeyForUUID())
+	}
+
 	return written, nil
 }
 
@@ -408,6 +413,7 @@ func (h *mcfsHandler) loadUserFromContextIntoHandler(s ssh.Session) error {
 func (h *mcfsHandler) loadProjectFromPathIntoHandler(path string, userID int) error {
 	var (
 		project *mcmodel.Project
+		role    authz.Role
 		err     error
 	)
 	if h.fatalErrorLoadingProjectOrUser {
@@ -416,12 +422,13 @@ func (h *mcfsHandler) loadProjectFromPathIntoHandler(path string, userID int) er
 		return fmt.Errorf("internal error no project")
 	}
 
-	if project, err = mc.GetAndValidateProjectFromPath(path, userID, h.stores.ProjectStore); err != nil {
+	if project, role, err = mc.GetProjectAndRoleFromPath(path, userID, h.stores.ProjectStore); err != nil {
 		return err
 	}
 
 	// If we are here then the project exists and the user has access so set it in the handler.
 	h.project = project
+	h.role = role
 
 	return nil
 }
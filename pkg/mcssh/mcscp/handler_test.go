@@ -1,8 +1,13 @@
 package mcscp
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/charmbracelet/wish/scp"
+	"github.com/materials-commons/hydra/pkg/authz"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 	"github.com/materials-commons/hydra/pkg/mcssh/mc"
 	"github.com/stretchr/testify/require"
@@ -20,9 +25,10 @@ func TestMcfsHandler_Mkdir(t *testing.T) {
 }
 
 func TestMcfsHandler_NewDirEntry(t *testing.T) {
-	stores := makeStoresWithFakes()
-	handler := NewMCFSHandler(stores, "/tmp")
-	session := newFakeSshSession()
+	stores, b, project := makeStores(t)
+	user := b.User("user")
+	b.AddMember(project, user)
+	session := newFakeSshSession(user)
 	tests := []struct {
 		tname      string
 		path       string
@@ -35,6 +41,8 @@ func TestMcfsHandler_NewDirEntry(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.tname, func(t *testing.T) {
+			// The handler caches the project from the first path it sees, so each path needs its own handler.
+			handler := NewMCFSHandler(stores, t.TempDir())
 			dirEntry, err := handler.NewDirEntry(session, test.path)
 			if test.shouldFail {
 				require.NotNil(t, err, "NewDirEntry unexpectedly passed, should have errored for path %s", test.path)
@@ -63,19 +71,38 @@ func TestMcfsHandler_loadProjectAndUserIntoHandler(t *testing.T) {
 
 }
 
-func makeStoresWithFakes() *mc.Stores {
-	projects := []mcmodel.Project{
-		{ID: 1, Slug: "proj", OwnerID: 1},
-	}
+func TestMcfsHandler_ViewerCannotWrite(t *testing.T) {
+	stores, b, project := makeStores(t)
+	viewer := b.User("viewer")
+	b.AddViewer(project, viewer)
+	session := newFakeSshSession(viewer)
 
-	files := []mcmodel.File{
-		{ID: 1, Name: "/", Path: "/", ProjectID: 1, OwnerID: 1, MimeType: "directory"},
-		{ID: 2, Name: "dir1", Path: "/dir1", ProjectID: 1, OwnerID: 1, MimeType: "directory"},
-	}
+	// Viewers can still download.
+	_, err := NewMCFSHandler(stores, t.TempDir()).NewDirEntry(session, "/proj/dir1")
+	require.NoError(t, err)
 
-	return &mc.Stores{
-		FileStore:       stor.NewFakeFileStore(files),
-		ProjectStore:    stor.NewFakeProjectStore(projects),
-		ConversionStore: stor.NewFakeConversionStore(),
-	}
+	err = NewMCFSHandler(stores, t.TempDir()).Mkdir(session, &scp.DirEntry{Name: "dir2", Filepath: "/proj/dir2"})
+	require.ErrorIs(t, err, authz.ErrReadOnly)
+
+	entry := &scp.FileEntry{Name: "f.txt", Filepath: "/proj/dir1/f.txt", Size: 5, Reader: strings.NewReader("hello")}
+	_, err = NewMCFSHandler(stores, t.TempDir()).Write(session, entry)
+	require.ErrorIs(t, err, authz.ErrReadOnly)
+
+	// Nothing was created.
+	_, err = stores.FileStore.GetDirByPath(project.ID, "/dir2")
+	require.Error(t, err)
+	_, err = stores.FileStore.GetFileByPath(project.ID, "/dir1/f.txt")
+	require.Error(t, err)
+}
+
+// makeStores creates the project proj containing the directory /dir1. The project's owner is the user
+// called owner.
+func makeStores(t *testing.T) (*mc.Stores, *mcdbtest.Builder, *mcmodel.Project) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	project := b.Project("proj", b.User("owner"))
+	b.Dir(project, project.RootDir, "dir1")
+
+	mcfsDir := t.TempDir()
+	return mc.NewGormStores(db, mcfsDir, blobstore.NewLocalBlobStore(mcfsDir)), b, project
 }
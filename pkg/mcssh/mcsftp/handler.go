@@ -1,7 +1,7 @@
 package mcsftp
 
 import (
-	"crypto/md5"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -10,8 +10,13 @@ import (
 	"time"
 
 	"github.com/apex/log"
+	"github.com/materials-commons/hydra/pkg/authz"
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/mime"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 	"github.com/materials-commons/hydra/pkg/mcssh/mc"
+	"github.com/materials-commons/hydra/pkg/quota"
 	"github.com/pkg/sftp"
 )
 
@@ -49,6 +54,12 @@ type mcfsHandler struct {
 	// The key is the project slug.
 	// If this were a map it would look like: map[string]bool
 	projectsWithoutAccess sync.Map
+
+	// The user's role in each of the projects in projects. Users with read-only access can browse
+	// and download, but not write.
+	// The key is the project id.
+	// If this were a map it would look like: map[int]authz.Role
+	projectRoles sync.Map
 }
 
 // NewMCFSHandler creates a new handler. This is called each time a user connects to the SFTP server.
@@ -86,8 +97,8 @@ func (h *mcfsHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
 		return nil, os.ErrNotExist
 	}
 
-	if mcFile.fileHandle, err = os.Open(mcFile.file.ToUnderlyingFilePath(h.mcfsRoot)); err != nil {
-		log.Errorf("Unable to open file %s: %s", mcFile.file.ToUnderlyingFilePath(h.mcfsRoot), err)
+	if mcFile.reader, err = h.stores.FileStore.Blobs().Open(mcFile.file.BlobKey(), 0); err != nil {
+		log.Errorf("Unable to open file %s: %s", mcFile.file.BlobKey(), err)
 		return nil, os.ErrNotExist
 	}
 
@@ -111,29 +122,34 @@ func (h *mcfsHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
 		return nil, os.ErrNotExist
 	}
 
+	if err := h.checkWrite(mcFile.project); err != nil {
+		log.Errorf("User %d can't write %s in project %d: %s", h.user.ID, r.Filepath, mcFile.project.ID, err)
+		return nil, err
+	}
+
 	// Create the Materials Commons file. This handles version creation.
 	fileName := filepath.Base(r.Filepath)
-	mcFile.file, err = h.stores.FileStore.CreateFile(fileName, mcFile.project.ID, mcFile.dir.ID, h.user.ID, mc.GetMimeTypeByExtension(fileName))
+	mcFile.file, err = h.stores.FileStore.CreateFile(fileName, mcFile.project.ID, mcFile.dir.ID, h.user.ID, mime.DetectByName(fileName))
 	if err != nil {
 		log.Errorf("Error creating file %s for user %d in directory %d of project %d: %s", fileName, h.user.ID, mcFile.dir.ID, mcFile.project.ID, err)
 		return nil, os.ErrNotExist
 	}
 
-	// Create the directory path where the file will be written to
-	if err := os.MkdirAll(mcFile.file.ToUnderlyingDirPath(h.mcfsRoot), 0777); err != nil {
-		log.Errorf("Error creating directory path %s: %s", mcFile.file.ToUnderlyingDirPath(h.mcfsRoot), err)
-		return nil, os.ErrNotExist
+	// SFTP doesn't send the size up front, so the quota is enforced as the file is written.
+	if mcFile.limiter, err = quota.NewLimiter(h.stores.QuotaStore, mcFile.project.ID, h.user.ID); err != nil {
+		log.Errorf("Error loading quota for user %d in project %d: %s", h.user.ID, mcFile.project.ID, err)
+		return nil, err
 	}
 
-	if mcFile.fileHandle, err = os.Create(mcFile.file.ToUnderlyingFilePath(h.mcfsRoot)); err != nil {
-		log.Errorf("Error creating file %s on filesystem: %s", mcFile.file.ToUnderlyingFilePath(h.mcfsRoot), err)
+	if mcFile.writer, err = h.stores.FileStore.Blobs().Create(mcFile.file.BlobKey()); err != nil {
+		log.Errorf("Error creating file %s in blob store: %s", mcFile.file.BlobKey(), err)
 		return nil, err
 	}
 
 	// Since this file was opened for writing we need to track its checksum, and for MCFile.Close() let
 	// it know whether it needs to update statistics about the file (only when openForWrite is true).
 	mcFile.openForWrite = true
-	mcFile.hasher = md5.New()
+	mcFile.hasher = digest.New()
 
 	return mcFile, nil
 }
@@ -163,7 +179,8 @@ func (h *mcfsHandler) createMCFileFromRequest(r *sftp.Request) (*mcfile, error)
 }
 
 // Filecmd supports various SFTP commands that manipulate a file and/or filesystem. It only supports
-// Mkdir for directory creation. Deletes, renames, setting permissions, etc... are not supported.
+// Mkdir for directory creation, Rename, and Remove and Rmdir, which move entries into the project
+// trash. Setting permissions, links, etc... are not supported.
 func (h *mcfsHandler) Filecmd(r *sftp.Request) error {
 	project, err := h.getProject(r)
 	if err != nil {
@@ -172,6 +189,14 @@ func (h *mcfsHandler) Filecmd(r *sftp.Request) error {
 
 	path := getPathFromRequest(r)
 
+	switch r.Method {
+	case "Mkdir", "Rename", "Remove", "Rmdir":
+		if err := h.checkWrite(project); err != nil {
+			log.Errorf("User %d can't %s %s in project %d: %s", h.user.ID, r.Method, path, project.ID, err)
+			return err
+		}
+	}
+
 	switch r.Method {
 	case "Mkdir":
 		_, err := h.stores.FileStore.GetOrCreateDirPath(project.ID, h.user.ID, path)
@@ -180,9 +205,11 @@ func (h *mcfsHandler) Filecmd(r *sftp.Request) error {
 		}
 		return err
 	case "Rename":
-		return fmt.Errorf("unsupported command: 'Rename'")
+		return h.rename(project, path, r.Target)
+	case "Remove":
+		return h.remove(project, path, false)
 	case "Rmdir":
-		return fmt.Errorf("unsupported command: 'Rmdir'")
+		return h.remove(project, path, true)
 	case "Setstat":
 		return fmt.Errorf("unsupported command: 'Setstat'")
 	case "Link":
@@ -194,6 +221,76 @@ func (h *mcfsHandler) Filecmd(r *sftp.Request) error {
 	}
 }
 
+// rename moves the file or directory at path to target. Target still contains the project slug, and
+// has to be in the same project as path.
+func (h *mcfsHandler) rename(project *mcmodel.Project, path, target string) error {
+	if mc.GetProjectSlugFromPath(target) != project.Slug {
+		log.Errorf("Rename of %s to %s across projects is not supported", path, target)
+		return os.ErrPermission
+	}
+
+	targetPath := mc.RemoveProjectSlugFromPath(target, project.Slug)
+
+	file, err := h.stores.FileStore.GetFileByPath(project.ID, path)
+	if err != nil {
+		return os.ErrNotExist
+	}
+
+	toDir, err := h.stores.FileStore.GetDirByPath(project.ID, filepath.Dir(targetPath))
+	if err != nil {
+		return os.ErrNotExist
+	}
+
+	if file.IsDir() {
+		_, err = h.stores.FileStore.MoveDirectory(file, toDir, filepath.Base(targetPath))
+	} else {
+		_, err = h.stores.FileStore.MoveFile(file, toDir, filepath.Base(targetPath))
+	}
+
+	switch {
+	case errors.Is(err, stor.ErrAlreadyExists):
+		return os.ErrExist
+	case errors.Is(err, stor.ErrInvalidMove):
+		return os.ErrInvalid
+	case err != nil:
+		log.Errorf("Unable to rename %s to %s in project %d: %s", path, targetPath, project.ID, err)
+		return err
+	}
+
+	return nil
+}
+
+// remove moves the file or directory at path into the project trash. Like rmdir(1) only empty
+// directories can be removed.
+func (h *mcfsHandler) remove(project *mcmodel.Project, path string, isDir bool) error {
+	file, err := h.stores.FileStore.GetFileByPath(project.ID, path)
+	if err != nil {
+		return os.ErrNotExist
+	}
+
+	if file.IsDir() != isDir {
+		return os.ErrInvalid
+	}
+
+	if isDir {
+		err = h.stores.FileStore.DeleteDirectory(file, false)
+	} else {
+		err = h.stores.FileStore.DeleteFile(file)
+	}
+
+	switch {
+	case errors.Is(err, stor.ErrNotEmpty):
+		return fmt.Errorf("directory %s is not empty", path)
+	case errors.Is(err, stor.ErrRootDirectory):
+		return os.ErrPermission
+	case err != nil:
+		log.Errorf("Unable to remove %s in project %d: %s", path, project.ID, err)
+		return err
+	}
+
+	return nil
+}
+
 // Filelist handles the different SFTP file list type commands. We only support List (directory listing)
 // and Stat. Things like Readlink don't make sense for Materials Commons.
 func (h *mcfsHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
@@ -348,18 +445,35 @@ func (h *mcfsHandler) getProject(r *sftp.Request) (*mcmodel.Project, error) {
 		err     error
 	)
 
-	if project, err = mc.GetAndValidateProjectFromPath(r.Filepath, h.user.ID, h.stores.ProjectStore); err != nil {
+	var role authz.Role
+	if project, role, err = mc.GetProjectAndRoleFromPath(r.Filepath, h.user.ID, h.stores.ProjectStore); err != nil {
 		// Error looking up or validating access. Mark this project slug as invalid.
 		h.projectsWithoutAccess.Store(projectSlug, true)
 		return nil, err
 	}
 
 	// Found the project and user has access so put in the projects cache.
+	h.projectRoles.Store(project.ID, role)
 	h.projects.Store(projectSlug, project)
 
 	return project, nil
 }
 
+// checkWrite returns an error when the user's role in the project doesn't allow writes. The error is
+// authz.ErrReadOnly, wrapped so the SFTP client is told permission was denied.
+func (h *mcfsHandler) checkWrite(project *mcmodel.Project) error {
+	var role authz.Role
+	if r, ok := h.projectRoles.Load(project.ID); ok {
+		role, _ = r.(authz.Role)
+	}
+
+	if err := authz.Check(role, authz.Contributor); err != nil {
+		return fmt.Errorf("%w: %w", err, sftp.ErrSSHFxPermissionDenied)
+	}
+
+	return nil
+}
+
 // getPathFromRequest will get the path to the file from the request after it removes the
 // project slug.
 func getPathFromRequest(r *sftp.Request) string {
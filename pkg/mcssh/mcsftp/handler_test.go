@@ -0,0 +1,81 @@
+package mcsftp
+
+import (
+	"io"
+	"testing"
+
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcssh/mc"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/require"
+)
+
+// sshFxfWrite is the SFTP open flag for writing, which the sftp package doesn't export.
+const sshFxfWrite = 0x00000002
+
+func TestWriteOverQuotaIsDiscarded(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	user := b.User("owner")
+	project := b.Project("proj", user)
+	existing := b.File(project, project.RootDir, "f.txt", 4)
+
+	mcfsDir := t.TempDir()
+	stores := mc.NewGormStores(db, mcfsDir, blobstore.NewLocalBlobStore(mcfsDir))
+	require.NoError(t, stores.QuotaStore.SetProjectQuota(project.ID, project.Size+4))
+	h := NewMCFSHandler(user, stores, mcfsDir)
+
+	r := sftp.NewRequest("Put", "/proj/f.txt")
+	r.Flags = sshFxfWrite
+	w, err := h.FilePut.Filewrite(r)
+	require.NoError(t, err)
+	_, err = w.WriteAt([]byte("too much"), 0)
+	require.Error(t, err)
+	require.NoError(t, w.(io.Closer).Close())
+
+	// The new version is removed, leaving the existing file as the only, and current, version.
+	f, err := stores.FileStore.GetFileByPath(project.ID, "/f.txt")
+	require.NoError(t, err)
+	require.Equal(t, existing.ID, f.ID)
+
+	var count int64
+	require.NoError(t, db.Model(&mcmodel.File{}).Where("name = ?", "f.txt").Where("deleted_at IS NULL").Count(&count).Error)
+	require.Equal(t, int64(1), count)
+}
+
+func TestViewerCannotWrite(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	owner := b.User("owner")
+	viewer := b.User("viewer")
+	project := b.Project("proj", owner)
+	b.AddViewer(project, viewer)
+	existing := b.File(project, project.RootDir, "f.txt", 4)
+
+	mcfsDir := t.TempDir()
+	stores := mc.NewGormStores(db, mcfsDir, blobstore.NewLocalBlobStore(mcfsDir))
+	h := NewMCFSHandler(viewer, stores, mcfsDir)
+
+	// Viewers can still list the project.
+	_, err := h.FileList.Filelist(sftp.NewRequest("List", "/proj"))
+	require.NoError(t, err)
+
+	r := sftp.NewRequest("Put", "/proj/new.txt")
+	r.Flags = sshFxfWrite
+	_, err = h.FilePut.Filewrite(r)
+	require.ErrorIs(t, err, sftp.ErrSSHFxPermissionDenied)
+
+	require.ErrorIs(t, h.FileCmd.Filecmd(sftp.NewRequest("Mkdir", "/proj/dir")), sftp.ErrSSHFxPermissionDenied)
+
+	r = sftp.NewRequest("Rename", "/proj/f.txt")
+	r.Target = "/proj/g.txt"
+	require.ErrorIs(t, h.FileCmd.Filecmd(r), sftp.ErrSSHFxPermissionDenied)
+
+	require.ErrorIs(t, h.FileCmd.Filecmd(sftp.NewRequest("Remove", "/proj/f.txt")), sftp.ErrSSHFxPermissionDenied)
+
+	f, err := stores.FileStore.GetFileByPath(project.ID, "/f.txt")
+	require.NoError(t, err)
+	require.Equal(t, existing.ID, f.ID)
+}
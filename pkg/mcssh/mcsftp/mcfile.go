@@ -3,14 +3,14 @@ package mcsftp
 import (
 	"bytes"
 	"errors"
-	"fmt"
-	"hash"
 	"io"
-	"os"
 
 	"github.com/apex/log"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 	"github.com/materials-commons/hydra/pkg/mcssh/mc"
+	"github.com/materials-commons/hydra/pkg/quota"
 )
 
 // MCFile represents a single SFTP file read or write request. It handles the ReadAt, WriteAt and Close
@@ -28,18 +28,20 @@ type mcfile struct {
 	// stores are the various stores to update
 	stores *mc.Stores
 
-	// The real underlying handle to read/write the file.
-	fileHandle *os.File
+	// The real underlying handles to read or write the file. Only one of these is set,
+	// depending on whether the file was opened for read or write.
+	reader blobstore.Reader
+	writer blobstore.Writer
 
 	// openForWrite is true when the file was opened for write. This is used in MCFile.Close() to
 	// determine if file statistics and checksum handling should be done.
 	openForWrite bool
 
 	// hasher tracks the checksum for files that were opened for write.
-	hasher hash.Hash
+	hasher *digest.Hasher
 
-	// mcfsRoot is the directory path where Materials Commons files are being read from/written to.
-	mcfsRoot string
+	// limiter enforces the project and user storage quotas for files that were opened for write.
+	limiter *quota.Limiter
 }
 
 // WriteAt takes care of writing to the file and updating the hasher that is
@@ -50,7 +52,12 @@ func (f *mcfile) WriteAt(b []byte, offset int64) (int, error) {
 		err error
 	)
 
-	if n, err = f.fileHandle.WriteAt(b, offset); err != nil {
+	if err = f.limiter.Extend(offset + int64(len(b))); err != nil {
+		log.Errorf("Error writing to file %d: %s", f.file.ID, err)
+		return 0, err
+	}
+
+	if n, err = f.writer.WriteAt(b, offset); err != nil {
 		log.Errorf("Error writing to file %d: %s", f.file.ID, err)
 		return n, err
 	}
@@ -65,7 +72,7 @@ func (f *mcfile) WriteAt(b []byte, offset int64) (int, error) {
 // ReadAt reads from the underlying handle. It's just a pass through to the file handle
 // ReadAt plus a bit of extra error logging.
 func (f *mcfile) ReadAt(b []byte, offset int64) (int, error) {
-	n, err := f.fileHandle.ReadAt(b, offset)
+	n, err := f.reader.ReadAt(b, offset)
 	if err != nil && !errors.Is(err, io.EOF) {
 		log.Errorf("Error reading from file %d: %s", f.file.ID, err)
 	}
@@ -83,42 +90,50 @@ func (f *mcfile) isOpenForRead() bool {
 // open for write. Close always returns nil, even if there was an error. Errors
 // are logged as there is nothing that can be done about an error at this point.
 func (f *mcfile) Close() error {
-	deleteFile := false
-
-	defer func() {
-		if err := f.fileHandle.Close(); err != nil {
+	if f.isOpenForRead() {
+		// If open for read then nothing to do other than close the reader.
+		if err := f.reader.Close(); err != nil {
 			log.Errorf("Error closing file %d: %s", f.file.ID, err)
 		}
+		return nil
+	}
 
-		if deleteFile {
-			// A file matching this file's checksum already exists in the system so delete the file we just
-			// uploaded. See the call to h.stores.FileStore.PointAtExistingIfExists towards the end of this method.
-			_ = os.Remove(f.file.ToUnderlyingFilePath(f.mcfsRoot))
-		}
-	}()
+	// If we are here then the file was open for write. The writer has to be closed before
+	// the blob can be examined, as some blob stores only make the contents visible on close.
+	if err := f.writer.Close(); err != nil {
+		log.Errorf("Error closing file %d: %s", f.file.ID, err)
+		return nil
+	}
 
-	if f.isOpenForRead() {
-		// If open for read then nothing to do.
+	blobs := f.stores.FileStore.Blobs()
+
+	// A file that went over quota was never made current, so it's removed rather than saved.
+	if f.limiter.Exceeded() {
+		_ = blobs.Delete(f.file.BlobKey())
+		if err := f.stores.FileStore.DeleteFileByID(f.file.ID); err != nil {
+			log.Errorf("Error removing file %d that went over quota: %s", f.file.ID, err)
+		}
 		return nil
 	}
 
-	// If we are here then the file was open for write, so lets update the metadata
-	// that Materials Commons is tracking.
+	// Now update the metadata that Materials Commons is tracking.
 
-	finfo, err := f.fileHandle.Stat()
+	blobInfo, err := blobs.Stat(f.file.BlobKey())
 	if err != nil {
 		log.Errorf("Unable to update file %d metadata: %s", f.file.ID, err)
 		return nil
 	}
 
-	checksum := fmt.Sprintf("%x", f.hasher.Sum(nil))
-
-	// Note deleteFile. DoneWritingToFile will switch the file if there was an existing file that had the
-	// same checksum. Here is where deleteFile gets set so that it can delete the file that was just written
-	// if this switch occurred.
-	if deleteFile, err = f.stores.FileStore.DoneWritingToFile(f.file, checksum, finfo.Size(), f.stores.ConversionStore); err != nil {
+	// DoneWritingToFile will switch the file if there was an existing file that had the same checksum. When
+	// this switch occurs the file that was just written is a duplicate, so delete it.
+	deleteFile, err := f.stores.FileStore.DoneWritingToFile(f.file, f.hasher.Sums(), blobInfo.Size, f.stores.ConversionStore)
+	if err != nil {
 		log.Errorf("Failure updating file (%d) and project (%d) metadata: %s", f.file.ID, f.project.ID, err)
 	}
 
+	if deleteFile {
+		_ = blobs.Delete(f.file.BlobKeyForUUID())
+	}
+
 	return nil
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
 	"github.com/charmbracelet/wish/scp"
+	"github.com/materials-commons/hydra/pkg/blobstore"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 	"github.com/materials-commons/hydra/pkg/mcssh/mc"
@@ -24,6 +25,7 @@ type Server struct {
 	db             *gorm.DB
 	server         *ssh.Server
 	mcfsRoot       string
+	blobs          blobstore.BlobStore
 	userStore      stor.UserStor
 	sshHost        string
 	sshPort        string
@@ -52,6 +54,8 @@ func (s *Server) init() {
 	if s.mcfsRoot == "" {
 		log.Errorf("MCFS_DIR is not set or blank")
 		incompleteConfiguration = true
+	} else {
+		s.blobs = blobstore.MustFromEnv(s.mcfsRoot)
 	}
 
 	if s.sshPort = os.Getenv("MCSSHD_PORT"); s.sshPort == "" {
@@ -84,7 +88,7 @@ func (s *Server) init() {
 
 func (s *Server) Start() error {
 	var err error
-	stores := mc.NewGormStores(s.db, s.mcfsRoot)
+	stores := mc.NewGormStores(s.db, s.mcfsRoot, s.blobs)
 	s.userStore = stor.NewGormUserStor(s.db)
 	handler := mcscp.NewMCFSHandler(stores, s.mcfsRoot)
 	s.server, err = wish.NewServer(
@@ -3,7 +3,6 @@ package handler
 import (
 	"bytes"
 	"context"
-	"crypto/md5"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,22 +10,28 @@ import (
 	"path/filepath"
 	"strconv"
 
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mime"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
-	"github.com/materials-commons/hydra/pkg/mcssh/mc"
 	"github.com/materials-commons/hydra/pkg/uid"
 	"github.com/tus/tusd/v2/pkg/handler"
 	"gorm.io/gorm"
 )
 
+// MCFileStore keeps uploads in progress in chunksDir on the local filesystem. Finished uploads are
+// moved into blobs.
 type MCFileStore struct {
 	db        *gorm.DB
 	chunksDir string
+	blobs     blobstore.BlobStore
 }
 
-func NewMCFileStore(db *gorm.DB, chunksDir string) *MCFileStore {
+func NewMCFileStore(db *gorm.DB, chunksDir string, blobs blobstore.BlobStore) *MCFileStore {
 	return &MCFileStore{
 		db:        db,
 		chunksDir: chunksDir,
+		blobs:     blobs,
 	}
 }
 
@@ -45,11 +50,10 @@ func (s *MCFileStore) NewUpload(ctx context.Context, info handler.FileInfo) (upl
 	}
 
 	fileUpload := &MCFileUpload{
-		fileStor:       stor.NewGormFileStor(s.db, s.chunksDir),
+		fileStor:       stor.NewGormFileStorWithBlobStore(s.db, s.chunksDir, s.blobs),
 		conversionStor: stor.NewGormConversionStor(s.db),
 		MCFSDir:        s.chunksDir,
 		FileInfo:       info,
-		checksum:       "",
 		Filename:       filename,
 		ProjectID:      projectID,
 		DirectoryID:    directoryID,
@@ -94,7 +98,7 @@ func (s *MCFileStore) GetUpload(ctx context.Context, id string) (upload handler.
 	}
 
 	mcFileUpload.FileInfo.Size = finfo.Size()
-	mcFileUpload.fileStor = stor.NewGormFileStor(s.db, s.chunksDir)
+	mcFileUpload.fileStor = stor.NewGormFileStorWithBlobStore(s.db, s.chunksDir, s.blobs)
 	mcFileUpload.conversionStor = stor.NewGormConversionStor(s.db)
 
 	return &mcFileUpload, nil
@@ -124,7 +128,7 @@ type MCFileUpload struct {
 	conversionStor stor.ConversionStor
 	MCFSDir        string
 	FileInfo       handler.FileInfo
-	checksum       string
+	sums           digest.Sums
 	ProjectID      int
 	DirectoryID    int
 	OwnerID        int
@@ -167,7 +171,7 @@ func (u *MCFileUpload) Terminate(ctx context.Context) error {
 func (u *MCFileUpload) ConcatUploads(ctx context.Context, uploads []handler.Upload) (err error) {
 	fmt.Printf("ConcatUploads: %s, isFinal: %t\n", u.FileInfo.ID, u.FileInfo.IsFinal)
 	// Create the hasher and start it by reading the first chunk that we will be appending to
-	hasher := md5.New()
+	hasher := digest.New()
 	d, err := os.ReadFile(u.getChunkPath())
 	if err != nil {
 		return err
@@ -212,7 +216,7 @@ func (u *MCFileUpload) ConcatUploads(ctx context.Context, uploads []handler.Uplo
 		_ = src.Close()
 	}
 
-	u.checksum = fmt.Sprintf("%x", hasher.Sum(nil))
+	u.sums = hasher.Sums()
 
 	return nil
 }
@@ -234,27 +238,22 @@ func (u *MCFileUpload) DeclareLength(ctx context.Context, length int64) error {
 func (u *MCFileUpload) FinishUpload(ctx context.Context) error {
 	fmt.Printf("FinishUpload: %s, isFinal: %t\n", u.FileInfo.ID, u.FileInfo.IsFinal)
 	if u.FileInfo.IsFinal {
-		// If checksum is "" then there was a single chunk, and we need to compute the checksum here.
-		if u.checksum == "" {
-			hasher := md5.New()
-			d, err := os.ReadFile(u.getChunkPath())
+		// If sums is empty then there was a single chunk, and we need to compute the checksums here.
+		if u.sums.IsZero() {
+			sums, err := digest.FromFile(u.getChunkPath())
 			if err != nil {
 				return err
 			}
-			_, err = io.Copy(hasher, bytes.NewReader(d))
-			if err != nil {
-				return err
-			}
-			u.checksum = fmt.Sprintf("%x", hasher.Sum(nil))
+			u.sums = sums
 		}
 
-		mcfile, err := u.fileStor.CreateFile(u.Filename, u.ProjectID, u.DirectoryID, u.OwnerID, mc.GetMimeTypeByExtension(u.Filename))
+		mcfile, err := u.fileStor.CreateFile(u.Filename, u.ProjectID, u.DirectoryID, u.OwnerID, mime.DetectByName(u.Filename))
 		if err != nil {
 			// Need to do cleanup
 			return err
 		}
 
-		if err := os.Rename(u.getChunkPath(), mcfile.ToUnderlyingFilePath(u.MCFSDir)); err != nil {
+		if err := blobstore.ImportFile(u.fileStor.Blobs(), u.getChunkPath(), mcfile.BlobKey()); err != nil {
 			// Need to do cleanup
 			return err
 		}
@@ -262,12 +261,12 @@ func (u *MCFileUpload) FinishUpload(ctx context.Context) error {
 		// Remove state file for chunk
 		_ = os.Remove(u.getStatePath())
 
-		finfo, err := os.Stat(mcfile.ToUnderlyingFilePath(u.MCFSDir))
+		blobInfo, err := u.fileStor.Blobs().Stat(mcfile.BlobKey())
 		if err != nil {
 			return err
 		}
 
-		_, err = u.fileStor.DoneWritingToFile(mcfile, u.checksum, finfo.Size(), u.conversionStor)
+		_, err = u.fileStor.DoneWritingToFile(mcfile, u.sums, blobInfo.Size, u.conversionStor)
 
 		return err
 	}
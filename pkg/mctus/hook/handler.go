@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"sync"
 
+	"github.com/materials-commons/hydra/pkg/authz"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
 	tusdh "github.com/tus/tusd/v2/pkg/handler"
@@ -190,7 +191,8 @@ func (h *MCHookHandler) userCanAccessProject(userID int, projectID int) bool {
 			}
 		}
 
-		if h.projectStor.UserCanAccessProject(userID, projectID) {
+		// Uploads need a role that can write, read-only (viewer) access isn't enough.
+		if authz.Require(h.projectStor, userID, projectID, authz.Contributor) == nil {
 			h.userIDToProjectList[userID] = append(h.userIDToProjectList[userID], projectID)
 			return true
 		}
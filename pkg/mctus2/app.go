@@ -2,11 +2,8 @@ package mctus2
 
 import (
 	"context"
-	"crypto/md5"
 	"encoding/base64"
 	"errors"
-	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"path"
@@ -15,9 +12,13 @@ import (
 	"sync"
 
 	"github.com/apex/log"
+	"github.com/materials-commons/hydra/pkg/apitoken"
+	"github.com/materials-commons/hydra/pkg/authz"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/mime"
 	"github.com/materials-commons/hydra/pkg/mcdb/stor"
-	"github.com/materials-commons/hydra/pkg/mcssh/mc"
 	tusd "github.com/tus/tusd/v2/pkg/handler"
 	"gorm.io/gorm"
 )
@@ -29,7 +30,9 @@ type App struct {
 	fileStor       stor.FileStor
 	userStor       stor.UserStor
 	conversionStor stor.ConversionStor
-	accessCache    *AccessCache
+	quotaStor      stor.QuotaStor
+	authenticator  *apitoken.Authenticator
+	projectRoles   *authz.Cache
 	accessCount    int
 	directoryCache *DirectoryCache
 	progressCache  *UploadProgressCache
@@ -38,15 +41,20 @@ type App struct {
 	maxParallel    int
 }
 
-func NewApp(tusFileStore LocalFileStore, db *gorm.DB, mcfsDir string, progressCache *UploadProgressCache) *App {
+// NewApp creates the App. Completed uploads are stored in blobs.
+func NewApp(tusFileStore LocalFileStore, db *gorm.DB, mcfsDir string, blobs blobstore.BlobStore, progressCache *UploadProgressCache) *App {
+	projectStor := stor.NewGormProjectStor(db)
+	userStor := stor.NewGormUserStor(db)
 	return &App{
 		TusFileStore:   tusFileStore,
 		TusHandler:     nil,
-		projectStor:    stor.NewGormProjectStor(db),
-		fileStor:       stor.NewGormFileStor(db, mcfsDir),
-		userStor:       stor.NewGormUserStor(db),
+		projectStor:    projectStor,
+		fileStor:       stor.NewGormFileStorWithBlobStore(db, mcfsDir, blobs),
+		userStor:       userStor,
 		conversionStor: stor.NewGormConversionStor(db),
-		accessCache:    NewAccessCache(),
+		quotaStor:      stor.NewGormQuotaStor(db),
+		authenticator:  apitoken.NewAuthenticator(userStor, stor.NewGormAPITokenStor(db), apitoken.DefaultCacheTTL),
+		projectRoles:   authz.NewCache(projectStor, authz.DefaultCacheTTL),
 		directoryCache: NewDirectoryCache(),
 		progressCache:  progressCache,
 		mcfsDir:        mcfsDir,
@@ -55,42 +63,10 @@ func NewApp(tusFileStore LocalFileStore, db *gorm.DB, mcfsDir string, progressCa
 	}
 }
 
-func (a *App) getUserByAPIToken(apiToken string) (*mcmodel.User, error) {
-	a.accessCache.Lock()
-	defer a.accessCache.Unlock()
-
-	if val, ok := a.accessCache.usersByAPIKey[apiToken]; ok {
-		return val, nil
-	}
-
-	// user was not found in cache so look up in db
-	user, err := a.userStor.GetUserByAPIToken(apiToken)
-	if err != nil {
-		return nil, err
-	}
-
-	a.accessCache.usersByAPIKey[apiToken] = user
-	return user, nil
-}
-
-func (a *App) userCanAccessProject(userID int, projectID int) bool {
-	a.accessCache.Lock()
-	defer a.accessCache.Unlock()
-
-	if projList, ok := a.accessCache.userIDToProjectList[userID]; ok {
-		for _, projID := range projList {
-			if projID == projectID {
-				return true
-			}
-		}
-
-		if a.projectStor.UserCanAccessProject(userID, projectID) {
-			a.accessCache.userIDToProjectList[userID] = append(a.accessCache.userIDToProjectList[userID], projectID)
-			return true
-		}
-	}
-
-	return false
+// userCanUploadToProject returns nil when the user's role in the project allows uploads. Viewers
+// get authz.ErrReadOnly.
+func (a *App) userCanUploadToProject(userID int, projectID int) error {
+	return authz.Require(a.projectRoles, userID, projectID, authz.Contributor)
 }
 
 func (a *App) directoryInProject(projectID int, dirID int) bool {
@@ -165,17 +141,40 @@ func (a *App) AccessMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := a.getUserByAPIToken(apiToken)
+		principal, err := a.authenticator.Authenticate(apiToken)
 		if err != nil {
 			http.Error(w, "invalid api token", http.StatusUnauthorized)
 			return
 		}
+		user := principal.User
 
-		if !a.userCanAccessProject(user.ID, projectID) {
-			http.Error(w, "no such project", http.StatusForbidden)
+		if err := principal.CheckWrite(projectID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
 			return
 		}
 
+		if err := a.userCanUploadToProject(user.ID, projectID); err != nil {
+			if errors.Is(err, authz.ErrReadOnly) {
+				http.Error(w, err.Error(), http.StatusForbidden)
+			} else {
+				http.Error(w, "no such project", http.StatusForbidden)
+			}
+			return
+		}
+
+		// Uploads that declare their size up front are rejected if they would go over quota. Uploads
+		// using Upload-Defer-Length are checked when they complete.
+		if uploadLength, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64); err == nil {
+			if err := a.quotaStor.CheckQuota(projectID, user.ID, uploadLength); err != nil {
+				if errors.Is(err, stor.ErrQuotaExceeded) {
+					http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				} else {
+					http.Error(w, "unable to check quota", http.StatusInternalServerError)
+				}
+				return
+			}
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
@@ -273,34 +272,70 @@ func (a *App) OnFileComplete() {
 	wg.Wait()
 }
 
-func (a *App) handleFileComplete(event tusd.HookEvent) error {
-	uploadedFileInfo := event.Upload
-	header := event.HTTPRequest.Header
+// PreFinishResponse is used as the tusd PreFinishResponseCallback. It checks the quota again once the final
+// PATCH of an upload has been received, but before the client gets its response. This catches uploads that
+// deferred their length, as well as concurrent uploads that each fit when they started but together go over
+// the quota. A rejected upload is removed and the client gets a 413, rather than the upload being dropped
+// after the client has been told it succeeded.
+func (a *App) PreFinishResponse(event tusd.HookEvent) (tusd.HTTPResponse, error) {
+	user, uploadedFileMetadata, err := a.getUploadUserAndMetadata(event)
+	if err != nil {
+		return tusd.HTTPResponse{}, tusd.NewError("ERR_UPLOAD_REJECTED", err.Error(), http.StatusBadRequest)
+	}
 
+	err = a.quotaStor.CheckQuota(uploadedFileMetadata.ProjectID, user.ID, event.Upload.Size)
+	switch {
+	case errors.Is(err, stor.ErrQuotaExceeded):
+		log.Errorf("rejecting upload %s: %s", event.Upload.ID, err)
+		a.cleanupTUSFilesForEvent(event.Upload)
+		return tusd.HTTPResponse{}, tusd.NewError("ERR_QUOTA_EXCEEDED", err.Error(), http.StatusRequestEntityTooLarge)
+	case err != nil:
+		log.Errorf("failed checking quota for upload %s: %s", event.Upload.ID, err)
+		return tusd.HTTPResponse{}, tusd.NewError("ERR_INTERNAL_SERVER_ERROR", "unable to check quota", http.StatusInternalServerError)
+	}
+
+	return tusd.HTTPResponse{}, nil
+}
+
+// getUploadUserAndMetadata returns the user who made the upload in event, and the upload's metadata.
+func (a *App) getUploadUserAndMetadata(event tusd.HookEvent) (*mcmodel.User, *FileMetadata, error) {
 	// We need to map the user from the API token. To do that, we extract the API token from the header.
-	// Then from the API token we can get the user in the cache of users we maintain.
-	apiToken, err := apiTokenFromRequestHeader(header)
+	// Then from the API token we can get the user from the authenticator, which caches tokens.
+	apiToken, err := apiTokenFromRequestHeader(event.HTTPRequest.Header)
 	if err != nil {
 		log.Errorf("failed getting api token from request header: %s", err)
-		return err
+		return nil, nil, err
 	}
 
-	user, err := a.getUserByAPIToken(apiToken)
+	principal, err := a.authenticator.Authenticate(apiToken)
 	if err != nil {
 		log.Errorf("failed getting user from api token: %s", err)
-		return err
+		return nil, nil, err
 	}
 
-	uploadedFileMetadata, err := a.getUploadedFileMetadata(uploadedFileInfo.MetaData)
+	uploadedFileMetadata, err := a.getUploadedFileMetadata(event.Upload.MetaData)
 	if err != nil {
 		log.Errorf("failed getting uploaded file metadata: %s", err)
+		return nil, nil, err
+	}
+
+	return principal.User, uploadedFileMetadata, nil
+}
+
+// handleFileComplete stores a completed upload. The quota was checked by PreFinishResponse before the
+// upload was reported as complete, so it isn't checked again here.
+func (a *App) handleFileComplete(event tusd.HookEvent) error {
+	uploadedFileInfo := event.Upload
+
+	user, uploadedFileMetadata, err := a.getUploadUserAndMetadata(event)
+	if err != nil {
 		return err
 	}
 
 	tusFilePath := a.TusFileStore.GetFilePath(uploadedFileInfo.ID)
-	checksum, err := computeChecksum(tusFilePath)
+	sums, err := digest.FromFile(tusFilePath)
 	if err != nil {
-		log.Errorf("failed computing checksum: %s", err)
+		log.Errorf("failed computing checksums: %s", err)
 		return err
 	}
 
@@ -310,17 +345,17 @@ func (a *App) handleFileComplete(event tusd.HookEvent) error {
 		return err
 	}
 
-	existingFile, err := a.fileStor.GetMatchingFileInDirectory(dir.ID, checksum, uploadedFileMetadata.Filename)
+	existingFile, err := a.fileStor.GetMatchingFileInDirectory(dir.ID, sums, uploadedFileMetadata.Filename)
 	switch {
 	case err != nil:
 		// Assume we need to create a new file
-		return a.handleUploadOfNewFile(uploadedFileMetadata, user.ID, checksum, dir, uploadedFileInfo)
+		return a.handleUploadOfNewFile(uploadedFileMetadata, user.ID, sums, dir, uploadedFileInfo)
 	case existingFile == nil:
 		// No matching file found, so we need to create a new file
-		return a.handleUploadOfNewFile(uploadedFileMetadata, user.ID, checksum, dir, uploadedFileInfo)
+		return a.handleUploadOfNewFile(uploadedFileMetadata, user.ID, sums, dir, uploadedFileInfo)
 	default:
 		// The existingFile is not null, so handle upload of an existing entry
-		return a.handleUploadOfExistingFile(uploadedFileMetadata, checksum, dir, existingFile, uploadedFileInfo)
+		return a.handleUploadOfExistingFile(uploadedFileMetadata, sums, dir, existingFile, uploadedFileInfo)
 	}
 }
 
@@ -335,30 +370,18 @@ func (a *App) getOrCreateDir(projectID int, userID int, fileMetadata *FileMetada
 	return a.fileStor.GetOrCreateDirPath(projectID, userID, fileMetadata.DirectoryPath)
 }
 
-func computeChecksum(filePath string) (string, error) {
-	hasher := md5.New()
-	fh, err := os.Open(filePath)
-	if err != nil {
-		return "", err
-	}
-
-	defer fh.Close()
-
-	if _, err := io.Copy(hasher, fh); err != nil {
-		return "", err
-	}
-	sum := hasher.Sum(nil)
-	return fmt.Sprintf("%x", sum), nil
-}
-
-func (a *App) handleUploadOfNewFile(metadata *FileMetadata, userID int, checksum string, dir *mcmodel.File, info tusd.FileInfo) error {
+func (a *App) handleUploadOfNewFile(metadata *FileMetadata, userID int, sums digest.Sums, dir *mcmodel.File, info tusd.FileInfo) error {
 	usesUuid := ""
 
 	tusFilePath := a.TusFileStore.GetFilePath(info.ID)
-	mimeType := mc.DetectMimeType(tusFilePath)
+	mimeType, err := mime.DetectFile(metadata.Filename, tusFilePath)
+	if err != nil {
+		log.Errorf("failed detecting type of %s: %s", tusFilePath, err)
+		mimeType = mime.DetectByName(metadata.Filename)
+	}
 
 	// Check if there is already a file with the same checksum anywhere in the system.
-	matchingFileByChecksum, _ := a.fileStor.FindMatchingFileByChecksum(checksum)
+	matchingFileByChecksum, _ := a.fileStor.FindMatchingFileByChecksum(sums)
 
 	// Ignore the error. We assume if matchingFileByChecksum is nil then there is no match. The worst case
 	// is we have a second copy of a file.
@@ -385,7 +408,7 @@ func (a *App) handleUploadOfNewFile(metadata *FileMetadata, userID int, checksum
 		// new file. We save the file to the generated UUID.
 		//
 		// This is case (1) above.
-		if err := a.moveFileTo(info, f.ToUnderlyingFilePath(a.mcfsDir)); err != nil {
+		if err := a.moveFileTo(info, f.BlobKey()); err != nil {
 			// Review if this is the right thing to do.
 			log.Errorf("failed moving file %d to expected location: %s", f.ID, err)
 			return err
@@ -396,13 +419,13 @@ func (a *App) handleUploadOfNewFile(metadata *FileMetadata, userID int, checksum
 		// containing the pointer to the original file (the pointer is uses_uuid).
 		usesUuid = matchingFileByChecksum.UUIDForUses()
 
-		if !matchingFileByChecksum.RealFileExists(a.mcfsDir) {
+		if !a.blobExists(matchingFileByChecksum) {
 			// The matching file does not exist on disk, so save it and mark it as fixed.
 			// This is case (2) above
 			//
 			// There is nothing we need to do with the fileEntry here, because its health is already set to 'good'.
 			// We only need to set the health of the matching file to 'fixed'.
-			if err := a.moveFileTo(info, matchingFileByChecksum.ToUnderlyingFilePath(a.mcfsDir)); err != nil {
+			if err := a.moveFileTo(info, matchingFileByChecksum.BlobKey()); err != nil {
 				// log err
 				log.Errorf("failed moving file to expected location: %s", err)
 			} else {
@@ -417,6 +440,8 @@ func (a *App) handleUploadOfNewFile(metadata *FileMetadata, userID int, checksum
 	// We need to update the size, uses_uuid if not blank, and then appropriately set the current flag.
 	updates := mcmodel.File{
 		Size:         uint64(info.Size),
+		Checksum:     sums.MD5,
+		Sha256:       sums.SHA256,
 		UploadSource: "TUS",
 		UsesUUID:     usesUuid,
 	}
@@ -430,7 +455,7 @@ func (a *App) handleUploadOfNewFile(metadata *FileMetadata, userID int, checksum
 		log.Errorf("failed adding file %d to be converted: %s", f.ID, err)
 	}
 
-	if !f.RealFileExists(a.mcfsDir) {
+	if !a.blobExists(f) {
 		_, _ = a.fileStor.SetFileHealthMissing(f, "tus-upload:existence-check", "TUS")
 		log.Errorf("file was not moved to expected location")
 	}
@@ -438,22 +463,21 @@ func (a *App) handleUploadOfNewFile(metadata *FileMetadata, userID int, checksum
 	return nil
 }
 
-func (a *App) handleUploadOfExistingFile(metadata *FileMetadata, checksum string, dir *mcmodel.File, existingFile *mcmodel.File, info tusd.FileInfo) error {
+func (a *App) handleUploadOfExistingFile(metadata *FileMetadata, sums digest.Sums, dir *mcmodel.File, existingFile *mcmodel.File, info tusd.FileInfo) error {
 	// There are two cases here we need to account for:
 	// 1. The existingFile file is not on disk. In this case we need to mark it as fixed and save it.
 	// 2. The existingFile is on disk, in that case we don't need to save anything to disk.
-	if !existingFile.RealFileExists(a.mcfsDir) {
+	if !a.blobExists(existingFile) {
 		// This is case (1): The existingFile does not exist on disk. We need to save it to disk and mark it as fixed.
 
 		// Move file
-		pathToMoveFileTo := existingFile.ToUnderlyingFilePath(a.mcfsDir)
-		if err := a.moveFileTo(info, pathToMoveFileTo); err != nil {
+		if err := a.moveFileTo(info, existingFile.BlobKey()); err != nil {
 			log.Errorf("failed moving file %d to expected location: %s", existingFile.ID, err)
 			return err
 		}
 
 		// Check if the file exists and if it does not then mark it as missing.
-		if !existingFile.RealFileExists(a.mcfsDir) {
+		if !a.blobExists(existingFile) {
 			_, _ = a.fileStor.SetFileHealthMissing(existingFile, "tus-upload:existence-check", "TUS")
 			return errors.New("file was not moved to expected location")
 		}
@@ -472,6 +496,13 @@ func (a *App) handleUploadOfExistingFile(metadata *FileMetadata, checksum string
 		}
 	}
 
+	// The existing file may predate SHA-256 checksums, we just computed it so fill it in.
+	if existingFile.Sha256 == "" && sums.SHA256 != "" {
+		if err := a.fileStor.SetFileSha256(existingFile, sums.SHA256); err != nil {
+			log.Errorf("failed setting sha256 on file %d: %s", existingFile.ID, err)
+		}
+	}
+
 	if _, err := a.conversionStor.AddFileToConvert(existingFile); err != nil {
 		log.Errorf("failed adding file %d to be converted: %s", existingFile.ID, err)
 	}
@@ -483,19 +514,22 @@ func (a *App) handleUploadOfExistingFile(metadata *FileMetadata, checksum string
 	return nil
 }
 
-func (a *App) moveFileTo(info tusd.FileInfo, to string) error {
+// moveFileTo moves the completed tus upload into the blob store at key.
+func (a *App) moveFileTo(info tusd.FileInfo, key string) error {
 	tusFilePath := a.TusFileStore.GetFilePath(info.ID)
-	if err := os.MkdirAll(path.Dir(to), 0755); err != nil {
-		log.Errorf("failed creating directory for path %s: %s", path.Dir(to), err)
-	}
-	if err := os.Rename(tusFilePath, to); err != nil {
-		log.Errorf("failed moving file %s to expected location %s: %s", tusFilePath, to, err)
+	if err := blobstore.ImportFile(a.fileStor.Blobs(), tusFilePath, key); err != nil {
+		log.Errorf("failed moving file %s to expected location %s: %s", tusFilePath, key, err)
 		return err
 	}
 
 	return nil
 }
 
+// blobExists returns true if the contents for f are in the blob store.
+func (a *App) blobExists(f *mcmodel.File) bool {
+	return blobstore.Exists(a.fileStor.Blobs(), f.BlobKey())
+}
+
 // cleanupTUSFileForEvent deletes the TUS upload info file and the upload file itself. The
 // upload file may not exist if the upload was moved. The upload file is moved
 // if there isn't a file with the same checksum already stored in the system.
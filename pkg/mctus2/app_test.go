@@ -0,0 +1,63 @@
+package mctus2
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/stretchr/testify/require"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestPreFinishResponseRejectsUploadsOverQuota(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	user := b.User("uploader")
+	require.NoError(t, db.Model(user).Update("api_token", "uploader-token").Error)
+	project := b.Project("proj", user)
+	require.NoError(t, stor.NewGormQuotaStor(db).SetProjectQuota(project.ID, 10))
+
+	mcfsDir := t.TempDir()
+	tusFileStore := LocalFileStore{Path: t.TempDir()}
+	app := NewApp(tusFileStore, db, mcfsDir, blobstore.NewLocalBlobStore(mcfsDir), NewUploadProgressCache())
+
+	// completedUpload writes the tus files for an upload of size bytes and returns its completion event.
+	completedUpload := func(id string, size int64) tusd.HookEvent {
+		require.NoError(t, os.WriteFile(tusFileStore.GetFilePath(id), make([]byte, size), 0644))
+		require.NoError(t, os.WriteFile(tusFileStore.GetInfoPath(id), []byte("{}"), 0644))
+		return tusd.HookEvent{
+			Upload: tusd.FileInfo{
+				ID:   id,
+				Size: size,
+				MetaData: tusd.MetaData{
+					"project_id":     strconv.Itoa(project.ID),
+					"directory_path": "/",
+					"filename":       id + ".txt",
+				},
+			},
+			HTTPRequest: tusd.HTTPRequest{Header: http.Header{"Authorization": []string{"Bearer uploader-token"}}},
+		}
+	}
+
+	_, err := app.PreFinishResponse(completedUpload("fits", 10))
+	require.NoError(t, err)
+	require.FileExists(t, tusFileStore.GetFilePath("fits"))
+
+	// The client is told about the rejection, and the upload is removed.
+	_, err = app.PreFinishResponse(completedUpload("too-big", 11))
+	var tusErr tusd.Error
+	require.ErrorAs(t, err, &tusErr)
+	require.Equal(t, http.StatusRequestEntityTooLarge, tusErr.HTTPResponse.StatusCode)
+	require.NoFileExists(t, tusFileStore.GetFilePath("too-big"))
+	require.NoFileExists(t, tusFileStore.GetInfoPath("too-big"))
+
+	noToken := completedUpload("no-token", 1)
+	noToken.HTTPRequest.Header = http.Header{}
+	_, err = app.PreFinishResponse(noToken)
+	require.ErrorAs(t, err, &tusErr)
+	require.Equal(t, http.StatusBadRequest, tusErr.HTTPResponse.StatusCode)
+}
@@ -52,6 +52,17 @@ type SelectStatement struct {
 	Token               token.Token
 	SelectionStatements []Statement
 	WhereStatement      *WhereStatement
+
+	// Aggregates are set for a query such as "select count, mean(sa:hardness) from samples", which
+	// returns aggregates rather than the samples or processes.
+	Aggregates       []*AggregateExpression
+	GroupByStatement *GroupByStatement
+
+	// OrderByStatement, LimitStatement and OffsetStatement choose the order of the samples or processes
+	// and which of them are returned.
+	OrderByStatement *OrderByStatement
+	LimitStatement   *LimitStatement
+	OffsetStatement  *OffsetStatement
 }
 
 func (s *SelectStatement) statementNode() {
@@ -65,6 +76,15 @@ func (s *SelectStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(" select ")
+	if len(s.Aggregates) != 0 {
+		aggregates := make([]string, 0, len(s.Aggregates))
+		for _, a := range s.Aggregates {
+			aggregates = append(aggregates, a.String())
+		}
+		out.WriteString(strings.Join(aggregates, ", "))
+		out.WriteString(" from ")
+	}
+
 	for _, st := range s.SelectionStatements {
 		out.WriteString(st.String())
 	}
@@ -73,6 +93,22 @@ func (s *SelectStatement) String() string {
 		out.WriteString(s.WhereStatement.String())
 	}
 
+	if s.GroupByStatement != nil {
+		out.WriteString(s.GroupByStatement.String())
+	}
+
+	if s.OrderByStatement != nil {
+		out.WriteString(s.OrderByStatement.String())
+	}
+
+	if s.LimitStatement != nil {
+		out.WriteString(s.LimitStatement.String())
+	}
+
+	if s.OffsetStatement != nil {
+		out.WriteString(s.OffsetStatement.String())
+	}
+
 	return out.String()
 }
 
@@ -131,11 +167,154 @@ func (s *WhereStatement) String() string {
 
 /////////////////////////////////////////
 
+// AggregateExpression is an aggregate in a select statement, such as count or mean(sa:hardness). Attribute
+// is nil for a count of the samples or processes.
+type AggregateExpression struct {
+	Token     token.Token
+	Func      string
+	Attribute *AttributeReference
+}
+
+func (e *AggregateExpression) expressionNode() {
+}
+
+func (e *AggregateExpression) TokenLiteral() string {
+	return e.Token.Literal
+}
+
+func (e *AggregateExpression) String() string {
+	if e.Attribute == nil {
+		return e.Func
+	}
+
+	return fmt.Sprintf("%s(%s)", e.Func, e.Attribute.String())
+}
+
+// GroupByStatement is the group by clause of a select statement, as in "group by s:category".
+type GroupByStatement struct {
+	Token     token.Token
+	Attribute *AttributeReference
+}
+
+func (s *GroupByStatement) statementNode() {
+}
+
+func (s *GroupByStatement) TokenLiteral() string {
+	return s.Token.Literal
+}
+
+func (s *GroupByStatement) String() string {
+	return " group by " + s.Attribute.String()
+}
+
+// OrderByStatement is the order by clause of a select statement, as in "order by sa:hardness desc, s:name".
+type OrderByStatement struct {
+	Token     token.Token
+	Orderings []*Ordering
+}
+
+func (s *OrderByStatement) statementNode() {
+}
+
+func (s *OrderByStatement) TokenLiteral() string {
+	return s.Token.Literal
+}
+
+func (s *OrderByStatement) String() string {
+	orderings := make([]string, 0, len(s.Orderings))
+	for _, o := range s.Orderings {
+		orderings = append(orderings, o.String())
+	}
+
+	return " order by " + strings.Join(orderings, ", ")
+}
+
+// Ordering is one of the fields or attributes in an order by clause, and the direction to sort it in.
+type Ordering struct {
+	Attribute  *AttributeReference
+	Descending bool
+}
+
+func (o *Ordering) String() string {
+	if o.Descending {
+		return o.Attribute.String() + " desc"
+	}
+
+	return o.Attribute.String()
+}
+
+// LimitStatement is the limit clause of a select statement, as in "limit 100".
+type LimitStatement struct {
+	Token token.Token
+	Value *IntegerLiteral
+}
+
+func (s *LimitStatement) statementNode() {
+}
+
+func (s *LimitStatement) TokenLiteral() string {
+	return s.Token.Literal
+}
+
+func (s *LimitStatement) String() string {
+	return " limit " + s.Value.String()
+}
+
+// OffsetStatement is the offset clause of a select statement, as in "offset 200".
+type OffsetStatement struct {
+	Token token.Token
+	Value *IntegerLiteral
+}
+
+func (s *OffsetStatement) statementNode() {
+}
+
+func (s *OffsetStatement) TokenLiteral() string {
+	return s.Token.Literal
+}
+
+func (s *OffsetStatement) String() string {
+	return " offset " + s.Value.String()
+}
+
+// AttributeReference is a field or attribute named outside a match, such as the sa:hardness in
+// mean(sa:hardness). Token is the keyword before the name, such as sa:.
+type AttributeReference struct {
+	Token          token.Token
+	Attribute      string
+	Unit           string
+	AttributeToken token.Token
+}
+
+func (r *AttributeReference) TokenLiteral() string {
+	return r.Token.Literal
+}
+
+func (r *AttributeReference) String() string {
+	attribute := r.Attribute
+	if strings.Contains(attribute, " ") {
+		attribute = "'" + attribute + "'"
+	}
+
+	return r.Token.Literal + attribute + unitSuffix(r.Unit)
+}
+
+/////////////////////////////////////////
+
 type SampleAttributeIdentifier struct {
 	Token     token.Token
 	Attribute string
 	Operator  string
 	Value     string
+	Unit      string
+
+	// Values are the values of an in or between match, which has no Value.
+	Values []token.Token
+
+	// OperatorToken and ValueToken are the tokens Operator and Value were parsed from, so problems with
+	// them can be reported at the right place.
+	OperatorToken token.Token
+	ValueToken    token.Token
 }
 
 func (i *SampleAttributeIdentifier) expressionNode() {
@@ -147,9 +326,9 @@ func (i *SampleAttributeIdentifier) TokenLiteral() string {
 
 func (i *SampleAttributeIdentifier) String() string {
 	if strings.Contains(i.Token.Literal, " ") {
-		return fmt.Sprintf("sample:'%s' %s %s", i.Attribute, i.Operator, i.Value)
+		return fmt.Sprintf("sample:'%s' %s %s", i.Attribute, i.Operator, valueString(i.Operator, i.Value, i.Values, i.Unit))
 	}
-	return fmt.Sprintf("sample:%s %s %s", i.Attribute, i.Operator, i.Value)
+	return fmt.Sprintf("sample:%s %s %s", i.Attribute, i.Operator, valueString(i.Operator, i.Value, i.Values, i.Unit))
 }
 
 /////////////////////////////////////////
@@ -159,6 +338,15 @@ type ProcessAttributeIdentifier struct {
 	Attribute string
 	Operator  string
 	Value     string
+	Unit      string
+
+	// Values are the values of an in or between match, which has no Value.
+	Values []token.Token
+
+	// OperatorToken and ValueToken are the tokens Operator and Value were parsed from, so problems with
+	// them can be reported at the right place.
+	OperatorToken token.Token
+	ValueToken    token.Token
 }
 
 func (i *ProcessAttributeIdentifier) expressionNode() {
@@ -170,9 +358,43 @@ func (i *ProcessAttributeIdentifier) TokenLiteral() string {
 
 func (i *ProcessAttributeIdentifier) String() string {
 	if strings.Contains(i.Token.Literal, " ") {
-		return fmt.Sprintf("process:'%s' %s %s", i.Attribute, i.Operator, i.Value)
+		return fmt.Sprintf("process:'%s' %s %s", i.Attribute, i.Operator, valueString(i.Operator, i.Value, i.Values, i.Unit))
 	}
-	return fmt.Sprintf("process:%s %s %s", i.Attribute, i.Operator, i.Value)
+	return fmt.Sprintf("process:%s %s %s", i.Attribute, i.Operator, valueString(i.Operator, i.Value, i.Values, i.Unit))
+}
+
+// valueString formats the value of an attribute match. The values of an in match are a list in parentheses,
+// and of a between match are joined by and.
+func valueString(operator, value string, values []token.Token, unit string) string {
+	if len(values) == 0 {
+		return value + unitSuffix(unit)
+	}
+
+	literals := make([]string, 0, len(values))
+	for _, v := range values {
+		literals = append(literals, v.Literal+unitSuffix(unit))
+	}
+
+	if operator == "between" {
+		return strings.Join(literals, " and ")
+	}
+
+	return "(" + strings.Join(literals, ", ") + ")"
+}
+
+// unitSuffix formats the unit on a value, quoting units that aren't a plain identifier such as 'wt%'.
+func unitSuffix(unit string) string {
+	if unit == "" {
+		return ""
+	}
+
+	for _, ch := range unit {
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_') {
+			return fmt.Sprintf(" '%s'", unit)
+		}
+	}
+
+	return " " + unit
 }
 
 /////////////////////////////////////////
@@ -288,6 +510,9 @@ func (e *PrefixExpression) String() string {
 
 	out.WriteString("(")
 	out.WriteString(e.Operator)
+	if e.Operator == "not" {
+		out.WriteString(" ")
+	}
 	out.WriteString(e.Right.String())
 	out.WriteString(")")
 
@@ -9,10 +9,12 @@ type Lexer struct {
 	curPosition  int // current position in input (points to current char)
 	readPosition int // current reading position, but not current position so this is "peeking" ahead
 	ch           byte
+	line         int // line of the current char, counting from 1
+	lineStart    int // position in input of the first char on the current line
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
@@ -21,6 +23,7 @@ func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	pos := l.position()
 
 	switch l.ch {
 	case '=':
@@ -71,21 +74,28 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
-			// TODO: Add support for float point type
-			// TODO: Add support for units
-			return newTokenStr(token.INT, l.readNumber())
+			tok = l.readNumber()
+			tok.Pos = pos
+			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
 
 	l.readChar() // advance
+	tok.Pos = pos
 	return tok
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -97,6 +107,11 @@ func (l *Lexer) readChar() {
 	l.readPosition += 1 // Peek ahead - Could advance past end of input
 }
 
+// position returns the position of the current char.
+func (l *Lexer) position() token.Position {
+	return token.Position{Offset: l.curPosition, Line: l.line, Column: l.curPosition - l.lineStart + 1}
+}
+
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		l.readChar()
@@ -111,13 +126,38 @@ func (l *Lexer) peekChar() byte {
 	return l.input[l.readPosition]
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer, or a float when the number has a fraction or an exponent, such as 0.5 or
+// 1e-3. A unit after a number, as in 500 C, is read as the next token.
+func (l *Lexer) readNumber() token.Token {
 	position := l.curPosition
-	for isDigit(l.ch) {
+	tokenType := token.TokenType(token.INT)
+	l.readDigits()
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
 		l.readChar()
+		l.readDigits()
 	}
 
-	return l.input[position:l.curPosition]
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peekChar()
+		if isDigit(next) || ((next == '-' || next == '+') && l.readPosition+1 < len(l.input) && isDigit(l.input[l.readPosition+1])) {
+			tokenType = token.FLOAT
+			l.readChar()
+			if l.ch == '-' || l.ch == '+' {
+				l.readChar()
+			}
+			l.readDigits()
+		}
+	}
+
+	return newTokenStr(tokenType, l.input[position:l.curPosition])
+}
+
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) {
+		l.readChar()
+	}
 }
 
 func (l *Lexer) readString() string {
@@ -44,3 +44,66 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestNumbersAndUnits(t *testing.T) {
+	input := `500 C 0.5mm 1e3 2.5E-4 eV 5. 'wt%'`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "500"},
+		{token.IDENT, "C"},
+		{token.FLOAT, "0.5"},
+		{token.IDENT, "mm"},
+		{token.FLOAT, "1e3"},
+		{token.FLOAT, "2.5E-4"},
+		{token.IDENT, "eV"},
+		{token.INT, "5"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "wt%"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, test := range tests {
+		tok := l.NextToken()
+		if tok.Type != test.expectedType {
+			t.Fatalf("tests[%d] - Token Type wrong. Expected='%s', got='%s': %s", i,
+				token.TokenToStr(test.expectedType), token.TokenToStr(tok.Type), tok.Literal)
+		}
+
+		if tok.Literal != test.expectedLiteral {
+			t.Fatalf("tests[%d] - Literal wrong. Expected=%q, got=%q", i, test.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "select samples\n  where sa:'max size' >= 5.5 mm"
+	tests := []struct {
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{"select", token.Position{Offset: 0, Line: 1, Column: 1}},
+		{"samples", token.Position{Offset: 7, Line: 1, Column: 8}},
+		{"where", token.Position{Offset: 17, Line: 2, Column: 3}},
+		{"sa:", token.Position{Offset: 23, Line: 2, Column: 9}},
+		{"max size", token.Position{Offset: 26, Line: 2, Column: 12}},
+		{">=", token.Position{Offset: 37, Line: 2, Column: 23}},
+		{"5.5", token.Position{Offset: 40, Line: 2, Column: 26}},
+		{"mm", token.Position{Offset: 44, Line: 2, Column: 30}},
+		{"", token.Position{Offset: 46, Line: 2, Column: 32}},
+	}
+
+	l := New(input)
+	for i, test := range tests {
+		tok := l.NextToken()
+		if tok.Literal != test.expectedLiteral {
+			t.Fatalf("tests[%d] - Literal wrong. Expected=%q, got=%q", i, test.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos != test.expectedPos {
+			t.Fatalf("tests[%d] - Position of %q wrong. Expected=%+v, got=%+v", i, tok.Literal, test.expectedPos, tok.Pos)
+		}
+	}
+}
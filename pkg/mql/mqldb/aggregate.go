@@ -0,0 +1,497 @@
+package mqldb
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mql/parser"
+	"github.com/materials-commons/hydra/pkg/units"
+)
+
+// The types of the values in a Column.
+const (
+	ColumnTypeString = "string"
+	ColumnTypeInt    = "int"
+	ColumnTypeFloat  = "float"
+)
+
+// Column describes a column of a Table. Unit is set when the column's values are in a unit.
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Unit string `json:"unit,omitempty"`
+}
+
+// Table is the result of an aggregate query. A grouped query has a row for each group, with the group's
+// value in the first column, otherwise there is a single row. Each value in a row is a string, int64 or
+// float64 as its column's Type says, or nil when it can't be computed, such as the mean of an attribute
+// none of a group has or the group of the samples without the attribute grouped by.
+type Table struct {
+	Columns []Column        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// EvalAggregates runs a query and computes the selection's aggregates over the samples or processes it
+// finds.
+func EvalAggregates(db *DB, selection Selection, statement parser.Statement) (*Table, error) {
+	switch {
+	case selection.SampleSelection.All && selection.ProcessSelection.All:
+		return nil, fmt.Errorf("aggregates are computed over either samples or processes, not both")
+	case selection.SampleSelection.All:
+		_, samples := evalStatement(db, selection, statement)
+		return AggregateSamples(db, samples, selection.Aggregates, selection.GroupBy)
+	case selection.ProcessSelection.All:
+		processes, _ := evalStatement(db, selection, statement)
+		return AggregateProcesses(db, processes, selection.Aggregates, selection.GroupBy)
+	default:
+		return nil, fmt.Errorf("select samples or processes to aggregate")
+	}
+}
+
+// AggregateSamples computes aggregates over samples, grouped by groupBy when it isn't nil. A sample's
+// attribute values are those of all its states, and its process attribute values and fields are those
+// of the processes it was used in.
+func AggregateSamples(db *DB, samples []mcmodel.Entity, aggregates []parser.Aggregate, groupBy *parser.GroupBy) (*Table, error) {
+	items := make([]resultItem, 0, len(samples))
+	for i := range samples {
+		items = append(items, sampleItem(db, &samples[i]))
+	}
+
+	return aggregate(db, items, aggregates, groupBy)
+}
+
+// AggregateProcesses computes aggregates over processes, grouped by groupBy when it isn't nil. A process's
+// sample attribute values and fields are those of the samples it used.
+func AggregateProcesses(db *DB, processes []mcmodel.Activity, aggregates []parser.Aggregate, groupBy *parser.GroupBy) (*Table, error) {
+	items := make([]resultItem, 0, len(processes))
+	for i := range processes {
+		items = append(items, processItem(db, &processes[i]))
+	}
+
+	return aggregate(db, items, aggregates, groupBy)
+}
+
+// resultItem is a sample or process being aggregated or sorted, along with the processes or samples it is
+// related to. A sample has itself and its processes, and a process has itself and its samples.
+type resultItem struct {
+	samples   []*mcmodel.Entity
+	processes []*mcmodel.Activity
+}
+
+func sampleItem(db *DB, sample *mcmodel.Entity) resultItem {
+	return resultItem{samples: []*mcmodel.Entity{sample}, processes: db.SampleProcesses[sample.ID]}
+}
+
+func processItem(db *DB, process *mcmodel.Activity) resultItem {
+	return resultItem{samples: db.ProcessSamples[process.ID], processes: []*mcmodel.Activity{process}}
+}
+
+// attributeValues returns the item's values for an attribute.
+func (item resultItem) attributeValues(db *DB, fieldType int, name string) []mcmodel.AttributeValue {
+	var values []mcmodel.AttributeValue
+	switch fieldType {
+	case parser.SampleAttributeFieldType:
+		for _, sample := range item.samples {
+			for _, attributes := range db.SampleAttributesBySampleIDAndStates[sample.ID] {
+				if attribute, ok := attributes[name]; ok {
+					values = append(values, attribute.AttributeValues...)
+				}
+			}
+		}
+	case parser.ProcessAttributeFieldType:
+		for _, process := range item.processes {
+			if attribute, ok := db.ProcessAttributesByProcessID[process.ID][name]; ok {
+				values = append(values, attribute.AttributeValues...)
+			}
+		}
+	}
+
+	return values
+}
+
+// groupKeys returns the values of the field or attribute the item is grouped by.
+func (item resultItem) groupKeys(db *DB, groupBy *parser.GroupBy) []interface{} {
+	var keys []interface{}
+	switch groupBy.FieldType {
+	case parser.SampleFieldType:
+		for _, sample := range item.samples {
+			keys = append(keys, entityField(sample.Name, sample.Category, groupBy.FieldName))
+		}
+	case parser.ProcessFieldType:
+		for _, process := range item.processes {
+			keys = append(keys, entityField(process.Name, process.Category, groupBy.FieldName))
+		}
+	default:
+		for _, value := range item.attributeValues(db, groupBy.FieldType, groupBy.FieldName) {
+			keys = append(keys, scalarValues(value)...)
+		}
+	}
+
+	return keys
+}
+
+func entityField(name, category, field string) interface{} {
+	if field == "category" {
+		return category
+	}
+
+	return name
+}
+
+// scalarValues returns the int64, float64 and string values of an attribute value, which are the elements
+// of an array.
+func scalarValues(value mcmodel.AttributeValue) []interface{} {
+	var values []interface{}
+	switch value.ValueType {
+	case mcmodel.ValueTypeInt:
+		values = append(values, value.ValueInt)
+	case mcmodel.ValueTypeFloat:
+		values = append(values, value.ValueFloat)
+	case mcmodel.ValueTypeString:
+		values = append(values, value.ValueString)
+	case mcmodel.ValueTypeArrayOfInt:
+		for _, v := range value.ValueArrayOfInt {
+			values = append(values, v)
+		}
+	case mcmodel.ValueTypeArrayOfFloat:
+		for _, v := range value.ValueArrayOfFloat {
+			values = append(values, v)
+		}
+	case mcmodel.ValueTypeArrayOfString:
+		for _, v := range value.ValueArrayOfString {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+// numericValues returns the numbers in an attribute value. Strings, even ones holding a number, and
+// complex values aren't included.
+func numericValues(value mcmodel.AttributeValue) []float64 {
+	var values []float64
+	for _, v := range scalarValues(value) {
+		switch n := v.(type) {
+		case int64:
+			values = append(values, float64(n))
+		case float64:
+			values = append(values, n)
+		}
+	}
+
+	return values
+}
+
+// group is the items with the same value of the field or attribute grouped by. The key is nil for the
+// group of items without a value.
+type group struct {
+	key   interface{}
+	items []int
+}
+
+func aggregate(db *DB, items []resultItem, aggregates []parser.Aggregate, groupBy *parser.GroupBy) (*Table, error) {
+	if len(aggregates) == 0 {
+		return nil, fmt.Errorf("no aggregates to compute")
+	}
+
+	for _, a := range aggregates {
+		if err := a.Check(); err != nil {
+			return nil, err
+		}
+	}
+
+	table := &Table{}
+	var groups []*group
+	if groupBy == nil {
+		all := &group{}
+		for i := range items {
+			all.items = append(all.items, i)
+		}
+		groups = []*group{all}
+	} else {
+		if err := groupBy.Check(); err != nil {
+			return nil, err
+		}
+
+		var keyType string
+		groups, keyType = groupItems(db, items, groupBy)
+		table.Columns = append(table.Columns, Column{Name: groupBy.String(), Type: keyType})
+	}
+
+	// Each aggregate is a column, computed for every group.
+	columns := make([][]interface{}, len(aggregates))
+	for i, a := range aggregates {
+		column, unit, err := aggregateColumn(db, items, groups, a)
+		if err != nil {
+			return nil, err
+		}
+		columns[i] = column
+
+		columnType := ColumnTypeFloat
+		if a.Func == parser.AggregateCount {
+			columnType = ColumnTypeInt
+			unit = ""
+		}
+		table.Columns = append(table.Columns, Column{Name: a.String(), Type: columnType, Unit: unit})
+	}
+
+	table.Rows = make([][]interface{}, 0, len(groups))
+	for g := range groups {
+		var row []interface{}
+		if groupBy != nil {
+			row = append(row, groups[g].key)
+		}
+		for i := range aggregates {
+			row = append(row, columns[i][g])
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	return table, nil
+}
+
+// groupItems splits items into groups by the value of the field or attribute in groupBy, and returns the
+// type of the groups' keys. Numbers are only grouped as numbers when all the values are numbers, otherwise
+// they are grouped as strings. Groups are sorted by their key, with the group of items without a value
+// last.
+func groupItems(db *DB, items []resultItem, groupBy *parser.GroupBy) ([]*group, string) {
+	itemKeys := make([][]interface{}, len(items))
+	keyType := ""
+	for i, item := range items {
+		itemKeys[i] = item.groupKeys(db, groupBy)
+		for _, key := range itemKeys[i] {
+			keyType = combineKeyTypes(keyType, key)
+		}
+	}
+
+	if keyType == "" {
+		keyType = ColumnTypeString
+	}
+
+	groupsByKey := make(map[interface{}]*group)
+	var groups []*group
+	for i := range items {
+		seen := make(map[interface{}]bool)
+		for _, key := range itemKeys[i] {
+			key = convertKey(key, keyType)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			g, ok := groupsByKey[key]
+			if !ok {
+				g = &group{key: key}
+				groupsByKey[key] = g
+				groups = append(groups, g)
+			}
+			g.items = append(g.items, i)
+		}
+
+		if len(seen) == 0 {
+			g, ok := groupsByKey[nil]
+			if !ok {
+				g = &group{}
+				groupsByKey[nil] = g
+				groups = append(groups, g)
+			}
+			g.items = append(g.items, i)
+		}
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return keyLess(groups[i].key, groups[j].key)
+	})
+
+	return groups, keyType
+}
+
+func combineKeyTypes(keyType string, key interface{}) string {
+	var t string
+	switch key.(type) {
+	case int64:
+		t = ColumnTypeInt
+	case float64:
+		t = ColumnTypeFloat
+	default:
+		t = ColumnTypeString
+	}
+
+	switch {
+	case keyType == "" || keyType == t:
+		return t
+	case keyType == ColumnTypeString || t == ColumnTypeString:
+		return ColumnTypeString
+	default:
+		// A mix of ints and floats.
+		return ColumnTypeFloat
+	}
+}
+
+func convertKey(key interface{}, keyType string) interface{} {
+	switch k := key.(type) {
+	case int64:
+		switch keyType {
+		case ColumnTypeFloat:
+			return float64(k)
+		case ColumnTypeString:
+			return strconv.FormatInt(k, 10)
+		}
+	case float64:
+		if keyType == ColumnTypeString {
+			return strconv.FormatFloat(k, 'g', -1, 64)
+		}
+	}
+
+	return key
+}
+
+func keyLess(a, b interface{}) bool {
+	switch {
+	case a == nil:
+		return false
+	case b == nil:
+		return true
+	}
+
+	switch a := a.(type) {
+	case int64:
+		return a < b.(int64)
+	case float64:
+		return a < b.(float64)
+	default:
+		as, bs := a.(string), b.(string)
+		if !strings.EqualFold(as, bs) {
+			return strings.ToLower(as) < strings.ToLower(bs)
+		}
+		return as < bs
+	}
+}
+
+// aggregateColumn computes an aggregate for each group, returning the column's values and the unit they
+// are in.
+func aggregateColumn(db *DB, items []resultItem, groups []*group, a parser.Aggregate) ([]interface{}, string, error) {
+	column := make([]interface{}, len(groups))
+	if a.FieldName == "" {
+		for g := range groups {
+			column[g] = int64(len(groups[g].items))
+		}
+		return column, "", nil
+	}
+
+	itemValues := make([][]mcmodel.AttributeValue, len(items))
+	for i, item := range items {
+		itemValues[i] = item.attributeValues(db, a.FieldType, a.FieldName)
+	}
+
+	unit, err := aggregateUnit(a, itemValues)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for g := range groups {
+		var values []float64
+		for _, i := range groups[g].items {
+			for _, value := range itemValues[i] {
+				numbers := numericValues(value)
+				for _, n := range numbers {
+					if value.Unit != "" && unit != "" && value.Unit != unit {
+						if n, err = units.Convert(n, value.Unit, unit); err != nil {
+							return nil, "", fmt.Errorf("cannot compute %s: %w", a, err)
+						}
+					}
+					values = append(values, n)
+				}
+			}
+		}
+
+		column[g] = aggregateValues(a.Func, values)
+	}
+
+	return column, unit, nil
+}
+
+// aggregateUnit returns the unit an aggregate is computed in. That's the aggregate's unit when it has one,
+// otherwise the unit the values are recorded in. Values recorded in more than one unit can only be
+// aggregated when a unit to convert them to is given.
+func aggregateUnit(a parser.Aggregate, itemValues [][]mcmodel.AttributeValue) (string, error) {
+	if a.Unit != "" {
+		return a.Unit, nil
+	}
+
+	seen := make(map[string]bool)
+	var found []string
+	for _, values := range itemValues {
+		for _, value := range values {
+			if value.Unit != "" && !seen[value.Unit] && len(numericValues(value)) != 0 {
+				seen[value.Unit] = true
+				found = append(found, value.Unit)
+			}
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", nil
+	case 1:
+		return found[0], nil
+	default:
+		sort.Strings(found)
+		return "", fmt.Errorf("cannot compute %s, its values are recorded in %s, give a unit to convert them to",
+			a, strings.Join(found, " and "))
+	}
+}
+
+// aggregateValues computes an aggregate function over values. The standard deviation is the sample standard
+// deviation, which needs at least two values. Nothing can be computed from no values, except their count.
+func aggregateValues(fn string, values []float64) interface{} {
+	if fn == parser.AggregateCount {
+		return int64(len(values))
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	switch fn {
+	case parser.AggregateMin:
+		lowest := values[0]
+		for _, v := range values[1:] {
+			lowest = math.Min(lowest, v)
+		}
+		return lowest
+	case parser.AggregateMax:
+		highest := values[0]
+		for _, v := range values[1:] {
+			highest = math.Max(highest, v)
+		}
+		return highest
+	case parser.AggregateMean:
+		return mean(values)
+	case parser.AggregateStdDev:
+		if len(values) < 2 {
+			return nil
+		}
+		m := mean(values)
+		var sum float64
+		for _, v := range values {
+			sum += (v - m) * (v - m)
+		}
+		return math.Sqrt(sum / float64(len(values)-1))
+	default:
+		return nil
+	}
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+
+	return sum / float64(len(values))
+}
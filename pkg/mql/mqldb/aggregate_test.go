@@ -0,0 +1,151 @@
+package mqldb
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+)
+
+func TestAggregateSamplesQuery(t *testing.T) {
+	db := createTestDB()
+	db.Samples[0].Category = "alloy"
+	db.Samples[1].Category = "alloy"
+	db.Samples[2].Category = "reference"
+
+	table := evalAggregateQuery(t, db,
+		`select count, mean(sa:zn), min(sa:zn), max(sa:zn), stddev(sa:zn) from samples where sa:zn > 0 group by s:category`)
+
+	expectedColumns := []Column{
+		{Name: "s:category", Type: ColumnTypeString},
+		{Name: "count", Type: ColumnTypeInt},
+		{Name: "mean(sa:zn)", Type: ColumnTypeFloat},
+		{Name: "min(sa:zn)", Type: ColumnTypeFloat},
+		{Name: "max(sa:zn)", Type: ColumnTypeFloat},
+		{Name: "stddev(sa:zn)", Type: ColumnTypeFloat},
+	}
+	if !reflect.DeepEqual(table.Columns, expectedColumns) {
+		t.Fatalf("Expected columns %+v, got %+v", expectedColumns, table.Columns)
+	}
+
+	// The zn values of every state of a sample are aggregated.
+	expectRows(t, table, [][]interface{}{
+		{"alloy", int64(2), 0.525, 0.5, 0.6, 0.05},
+		{"reference", int64(1), 0.565, 0.45, 0.68, 0.16263456},
+	})
+
+	// Samples without the attribute grouped by are in a group of their own.
+	table = evalAggregateQuery(t, db, `select count from samples where sa:zn > 0 group by sa:alloy`)
+	expectRows(t, table, [][]interface{}{
+		{"zn45", int64(1)},
+		{nil, int64(2)},
+	})
+
+	// A sample is in the group of each type of process it was used in.
+	table = evalAggregateQuery(t, db, `select count from samples where s:name in (S1, S3) group by p:name`)
+	expectRows(t, table, [][]interface{}{
+		{"EBSD", int64(2)},
+		{"Texture", int64(2)},
+	})
+
+	// Without group by there is a single row, which has nothing to compute for an attribute that's missing.
+	table = evalAggregateQuery(t, db, `select count, count(sa:hardness), mean(sa:missing) from samples where sa:zn > 0`)
+	expectRows(t, table, [][]interface{}{
+		{int64(3), int64(1), nil},
+	})
+}
+
+func TestAggregateProcessesQuery(t *testing.T) {
+	db := createTestDB()
+
+	// A process's sample attributes are those of the samples it used.
+	table := evalAggregateQuery(t, db,
+		`select count, mean(pa:'frames per second'), mean(sa:mg) from processes where p:name = EBSD`)
+	expectRows(t, table, [][]interface{}{
+		{int64(2), 4.0, 0.395},
+	})
+
+	table = evalAggregateQuery(t, db, `select max(pa:'PF scale max') from processes where p:name = Texture group by sa:zn`)
+	if table.Columns[0].Type != ColumnTypeFloat {
+		t.Fatalf("Expected groups of float zn values, got %+v", table.Columns[0])
+	}
+	expectRows(t, table, [][]interface{}{
+		{0.45, 3.0},
+		{0.5, 2.0},
+		{0.6, 2.0},
+		{0.68, 3.0},
+	})
+}
+
+func TestAggregateUnits(t *testing.T) {
+	db := createTestDB()
+	db.ProcessAttributesByProcessID[1]["temperature"] = &mcmodel.Attribute{
+		Name:            "temperature",
+		AttributeValues: []mcmodel.AttributeValue{{ValueType: mcmodel.ValueTypeInt, ValueInt: 500, Unit: "C"}},
+	}
+	db.ProcessAttributesByProcessID[2]["temperature"] = &mcmodel.Attribute{
+		Name:            "temperature",
+		AttributeValues: []mcmodel.AttributeValue{{ValueType: mcmodel.ValueTypeFloat, ValueFloat: 873.15, Unit: "K"}},
+	}
+
+	query, err := CompileQuery(`select mean(pa:temperature) from processes where p:name = EBSD`)
+	if err != nil {
+		t.Fatalf("CompileQuery failed: %s", err)
+	}
+
+	if _, err := EvalAggregates(db, query.Selection, query.Statement); err == nil {
+		t.Errorf("Expected values in different units without a unit to be an error")
+	}
+
+	table := evalAggregateQuery(t, db, `select mean(pa:temperature C), max(pa:temperature K) from processes where p:name = EBSD`)
+	if table.Columns[0].Unit != "C" || table.Columns[1].Unit != "K" {
+		t.Errorf("Expected columns in C and K, got %+v", table.Columns)
+	}
+	expectRows(t, table, [][]interface{}{
+		{550.0, 873.15},
+	})
+
+	if _, err := evalAggregate(db, `select mean(pa:temperature mm) from processes where p:name = EBSD`); err == nil {
+		t.Errorf("Expected a temperature in mm to be an error")
+	}
+}
+
+func evalAggregate(db *DB, q string) (*Table, error) {
+	query, err := CompileQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	return EvalAggregates(db, query.Selection, query.Statement)
+}
+
+func evalAggregateQuery(t *testing.T, db *DB, q string) *Table {
+	t.Helper()
+	table, err := evalAggregate(db, q)
+	if err != nil {
+		t.Fatalf("%s: failed: %s", q, err)
+	}
+
+	return table
+}
+
+func expectRows(t *testing.T, table *Table, expected [][]interface{}) {
+	t.Helper()
+	if len(table.Rows) != len(expected) {
+		t.Fatalf("Expected %d rows, got %+v", len(expected), table.Rows)
+	}
+
+	for i, row := range expected {
+		for j, value := range row {
+			got := table.Rows[i][j]
+			if f, ok := value.(float64); ok {
+				if g, ok := got.(float64); !ok || math.Abs(f-g) > 1e-6 {
+					t.Errorf("Row %d column %d: expected %v, got %v", i, j, value, got)
+				}
+			} else if got != value {
+				t.Errorf("Row %d column %d: expected %v (%T), got %v (%T)", i, j, value, value, got, got)
+			}
+		}
+	}
+}
@@ -56,29 +56,6 @@ func NewDB(projectID int, db *gorm.DB) *DB {
 	}
 }
 
-// Activity2Entity represents the join table for mapping the relationships between processes and samples.
-type Activity2Entity struct {
-	ID         int
-	ActivityID int
-	EntityID   int
-}
-
-type Experiment2Entity struct {
-	ID           int
-	EntityID     int
-	ExperimentID int
-}
-
-type Experiment2Activity struct {
-	ID           int
-	ActivityID   int
-	ExperimentID int
-}
-
-func (Activity2Entity) TableName() string {
-	return "activity2entity"
-}
-
 // Load loads the samples, processes and attributes for the given project into memory.
 func (db *DB) Load() error {
 	// Make sure project exists
@@ -173,7 +150,7 @@ func (db *DB) loadSamplesAndAttributes() error {
 
 func (db *DB) loadProcessSampleMappings() error {
 	// Now setup mapping of samples -> to their associated processes, and processes -> to their associated samples
-	var activity2entity []Activity2Entity
+	var activity2entity []mcmodel.Activity2Entity
 	err := db.db.Where("entity_id in (select id from entities where project_id = ?)", db.ProjectID).
 		Find(&activity2entity).Error
 	if err != nil {
@@ -213,14 +190,14 @@ func (db *DB) loadProcessSampleMappings() error {
 
 func (db *DB) loadExperimentProcessSampleMappings() error {
 	experimentID := 1234
-	var experiment2entity []Experiment2Entity
+	var experiment2entity []mcmodel.Experiment2Entity
 
 	err := db.db.Where("experiment_id = ?", experimentID).Find(&experiment2entity).Error
 	if err != nil {
 		return err
 	}
 
-	var experiment2activity []Experiment2Activity
+	var experiment2activity []mcmodel.Experiment2Activity
 	err = db.db.Where("experiment_id = ?", experimentID).Find(&experiment2activity).Error
 	if err != nil {
 		return err
@@ -3,19 +3,217 @@ package mqldb
 import (
 	"testing"
 
-	"gorm.io/driver/mysql"
-	"gorm.io/gorm"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mql/parser"
+	"github.com/materials-commons/hydra/pkg/units"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoadingFromSQLDB(t *testing.T) {
-	dsn := "mc:mcpw@tcp(127.0.0.1:3306)/mc?charset=utf8mb4&parseTime=True&loc=Local"
-	mysqldb, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
-	if err != nil {
-		t.Errorf("Failed to open db: %s", err)
+	gdb := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, gdb)
+
+	user := b.User("user1")
+	proj := b.Project("proj1", user)
+
+	texture := b.Activity(proj, "Texture")
+	b.ActivityAttribute(texture, "frames per second", 3, "")
+	b.ActivityAttribute(texture, "Beam Type", "Wide", "")
+	heat := b.Activity(proj, "Heat Treatment")
+	b.ActivityAttribute(heat, "temperature", 400, "c")
+
+	s1 := b.Entity(proj, "S1")
+	b.EntityStateAttribute(&s1.EntityStates[0], "alloy", "zn45", "")
+	s2 := b.Entity(proj, "S2")
+	b.EntityStateAttribute(&s2.EntityStates[0], "ductility", 0.81, "")
+
+	b.Link(texture, s1)
+	b.Link(heat, s1)
+	b.Link(heat, s2)
+
+	// Data in another project shouldn't be loaded.
+	other := b.Project("proj2", user)
+	otherProcess := b.Activity(other, "Texture")
+	b.ActivityAttribute(otherProcess, "Beam Type", "Wide", "")
+	otherSample := b.Entity(other, "S3")
+	b.EntityStateAttribute(&otherSample.EntityStates[0], "alloy", "zn45", "")
+	b.Link(otherProcess, otherSample)
+
+	db := NewDB(proj.ID, gdb)
+	require.NoError(t, db.Load())
+
+	require.Len(t, db.Processes, 2)
+	require.Len(t, db.Samples, 2)
+	require.Len(t, db.AllProcessAttributes, 3)
+	require.Len(t, db.AllSampleAttributes, 2)
+	require.Len(t, db.ProcessSamples[heat.ID], 2)
+	require.Len(t, db.SampleProcesses[s1.ID], 2)
+
+	fps := db.ProcessAttributesByProcessID[texture.ID]["frames per second"]
+	require.NotNil(t, fps)
+	require.Equal(t, mcmodel.ValueTypeInt, fps.AttributeValues[0].ValueType)
+	require.Equal(t, int64(3), fps.AttributeValues[0].ValueInt)
+
+	alloy := db.SampleAttributesBySampleIDAndStates[s1.ID][s1.EntityStates[0].ID]["alloy"]
+	require.NotNil(t, alloy)
+	require.Equal(t, "zn45", alloy.AttributeValues[0].ValueString)
+
+	// The loaded data can be queried.
+	matchStatement := parser.MatchStatement{
+		FieldType: parser.ProcessAttributeFieldType,
+		FieldName: "Beam Type",
+		Operation: "=",
+		Value:     "Wide",
+	}
+	_, matchingSamples := EvalStatement(db, selectAllSamples(), matchStatement)
+	require.Len(t, matchingSamples, 1)
+
+	require.Error(t, NewDB(other.ID+100, gdb).Load())
+}
+
+func TestMatchingArrayAttributes(t *testing.T) {
+	gdb := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, gdb)
+
+	user := b.User("user1")
+	proj := b.Project("proj1", user)
+
+	scan := b.Activity(proj, "Scan")
+	b.ActivityAttribute(scan, "temperatures", []int{300, 400, 500}, "c")
+	b.ActivityAttribute(scan, "widths", []float64{0.5, 1.25}, "mm")
+	b.ActivityAttribute(scan, "detectors", []string{"EBSD", "EDS"}, "")
+	b.ActivityAttribute(scan, "settings", map[string]interface{}{"mode": "fast"}, "")
+	sample := b.Entity(proj, "S1")
+	b.Link(scan, sample)
+
+	db := NewDB(proj.ID, gdb)
+	require.NoError(t, db.Load())
+
+	tests := []struct {
+		field     string
+		operation string
+		value     interface{}
+		matches   bool
+	}{
+		{field: "temperatures", operation: "=", value: 400, matches: true},
+		{field: "temperatures", operation: "=", value: 450, matches: false},
+		{field: "temperatures", operation: ">", value: 450, matches: true},
+		{field: "temperatures", operation: ">", value: 500, matches: false},
+		{field: "temperatures", operation: "=", value: 400.5, matches: false},
+		{field: "temperatures", operation: "<>", value: 400, matches: false},
+		{field: "temperatures", operation: "<>", value: 450, matches: true},
+		{field: "widths", operation: "<", value: 1, matches: true},
+		{field: "widths", operation: "=", value: 1.25, matches: true},
+		{field: "detectors", operation: "=", value: "eds", matches: true},
+		{field: "detectors", operation: "substr", value: "BS", matches: true},
+		{field: "detectors", operation: "<>", value: "EDS", matches: false},
+		{field: "settings", operation: "=", value: "fast", matches: false},
 	}
 
-	db := NewDB(77, mysqldb)
-	if err := db.Load(); err != nil {
-		t.Fatalf("Failed loading database: %s", err)
+	for _, test := range tests {
+		match := parser.MatchStatement{
+			FieldType: parser.ProcessAttributeFieldType,
+			FieldName: test.field,
+			Operation: test.operation,
+			Value:     test.value,
+		}
+		matchingProcesses, _ := EvalStatement(db, selectAllProcesses(), match)
+		if test.matches {
+			require.Len(t, matchingProcesses, 1, "%s %s %v", test.field, test.operation, test.value)
+		} else {
+			require.Empty(t, matchingProcesses, "%s %s %v", test.field, test.operation, test.value)
+		}
 	}
 }
+
+func TestMatchingAttributesWithUnits(t *testing.T) {
+	gdb := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, gdb)
+
+	user := b.User("user1")
+	proj := b.Project("proj1", user)
+
+	hot := b.Entity(proj, "hot")
+	b.EntityStateAttribute(&hot.EntityStates[0], "temperature", 800, "K")
+	b.EntityStateAttribute(&hot.EntityStates[0], "thickness", []float64{0.4, 0.6}, "mm")
+	warm := b.Entity(proj, "warm")
+	b.EntityStateAttribute(&warm.EntityStates[0], "temperature", 500, "c")
+	b.EntityStateAttribute(&warm.EntityStates[0], "thickness", 250, "um")
+	cold := b.Entity(proj, "cold")
+	b.EntityStateAttribute(&cold.EntityStates[0], "temperature", 20, "")
+	b.EntityStateAttribute(&cold.EntityStates[0], "hardness", 150, "HV")
+
+	db := NewDB(proj.ID, gdb)
+	require.NoError(t, db.Load())
+
+	tests := []struct {
+		field     string
+		operation string
+		value     interface{}
+		unit      string
+		expected  []string
+	}{
+		// 800 K is 526.85 C. A value without a unit is compared as is.
+		{field: "temperature", operation: ">", value: "500", unit: "C", expected: []string{"hot"}},
+		{field: "temperature", operation: ">=", value: "500", unit: "C", expected: []string{"hot", "warm"}},
+		{field: "temperature", operation: "=", value: "773.15", unit: "K", expected: []string{"warm"}},
+		{field: "temperature", operation: "<", value: "100", unit: "F", expected: []string{"cold"}},
+		{field: "temperature", operation: ">", value: "500", unit: "", expected: []string{"hot"}},
+		{field: "thickness", operation: ">", value: "500", unit: "µm", expected: []string{"hot"}},
+		{field: "thickness", operation: "<", value: "0.3", unit: "mm", expected: []string{"warm"}},
+		{field: "hardness", operation: ">", value: "100", unit: "HV", expected: []string{"cold"}},
+	}
+
+	for _, test := range tests {
+		match := parser.MatchStatement{
+			FieldType: parser.SampleAttributeFieldType,
+			FieldName: test.field,
+			Operation: test.operation,
+			Value:     test.value,
+			Unit:      test.unit,
+		}
+		_, samples := EvalStatement(db, selectAllSamples(), match)
+		var names []string
+		for _, sample := range samples {
+			names = append(names, sample.Name)
+		}
+		require.ElementsMatch(t, test.expected, names, "%s %s %v %s", test.field, test.operation, test.value, test.unit)
+	}
+}
+
+func TestCheckUnits(t *testing.T) {
+	gdb := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, gdb)
+
+	user := b.User("user1")
+	proj := b.Project("proj1", user)
+	sample := b.Entity(proj, "S1")
+	b.EntityStateAttribute(&sample.EntityStates[0], "temperature", 800, "K")
+	b.EntityStateAttribute(&sample.EntityStates[0], "hardness", 150, "HV")
+	heat := b.Activity(proj, "Heat Treatment")
+	b.ActivityAttribute(heat, "time", 2, "h")
+	b.Link(heat, sample)
+
+	db := NewDB(proj.ID, gdb)
+	require.NoError(t, db.Load())
+
+	match := func(fieldType int, field, unit string) parser.MatchStatement {
+		return parser.MatchStatement{FieldType: fieldType, FieldName: field, Operation: ">", Value: "1", Unit: unit}
+	}
+
+	require.NoError(t, CheckUnits(db, match(parser.SampleAttributeFieldType, "temperature", "C")))
+	require.NoError(t, CheckUnits(db, match(parser.SampleAttributeFieldType, "temperature", "")))
+	require.NoError(t, CheckUnits(db, match(parser.SampleAttributeFieldType, "hardness", "mm")))
+	require.NoError(t, CheckUnits(db, match(parser.ProcessAttributeFieldType, "time", "min")))
+
+	err := CheckUnits(db, parser.AndStatement{
+		Left:  match(parser.ProcessAttributeFieldType, "time", "min"),
+		Right: parser.OrStatement{Left: match(parser.SampleAttributeFieldType, "temperature", "mm")},
+	})
+	require.ErrorIs(t, err, units.ErrIncompatible)
+
+	require.ErrorIs(t, CheckUnits(db, match(parser.SampleAttributeFieldType, "temperature", "furlong")), units.ErrUnknownUnit)
+	require.NoError(t, CheckUnits(db, match(parser.SampleAttributeFieldType, "hardness", "HV")))
+	require.Error(t, CheckUnits(db, match(parser.SampleFieldType, "name", "C")))
+}
@@ -8,9 +8,20 @@ import (
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 )
 
-// EvalStatement runs a query and returns the results. At the moment selection is a simple boolean flag
-// on whether to return samples and/or processes from the matches.
+// EvalStatement runs a query and returns the results. The selection says whether to return samples and/or
+// processes from the matches, the order to return them in and, when it has a limit or offset, which of them
+// to return. Use EvalPage to page through the results with cursors.
 func EvalStatement(db *DB, selection Selection, statement parser.Statement) ([]mcmodel.Activity, []mcmodel.Entity) {
+	// Without a cursor the page can't fail.
+	page, _ := EvalPage(db, selection, statement, "")
+	return page.Processes, page.Samples
+}
+
+// evalStatement returns every sample and/or process matching a query, in no particular order.
+func evalStatement(db *DB, selection Selection, statement parser.Statement) ([]mcmodel.Activity, []mcmodel.Entity) {
+	// Compile any patterns that haven't been already. A pattern that doesn't compile never matches.
+	statement, _ = parser.Prepare(statement)
+
 	var (
 		matchingProcesses []mcmodel.Activity
 		matchingSamples   []mcmodel.Entity
@@ -39,6 +50,13 @@ func evalSelectProcessesAndSamples(db *DB, statement parser.Statement) ([]mcmode
 // then takes the results from the processes and filters it down to just the unique samples associated
 // the process.
 func evalSelectSamples(db *DB, statement parser.Statement) []mcmodel.Entity {
+	// A negated statement is only evaluated against samples, with any process matches evaluated against each
+	// sample's processes. Matching it against processes and taking their samples would find samples whose other
+	// processes don't satisfy it.
+	if parser.HasNotStatement(statement) {
+		return evalMatchingSamples(db, statement)
+	}
+
 	var matchingSamples []mcmodel.Entity
 	var matchingProcesses []mcmodel.Activity
 
@@ -98,6 +116,12 @@ func uniqueSamplesForProcesses(db *DB, processes []mcmodel.Activity) []mcmodel.E
 // then takes the results from the sample and filters it down to just the unique processes associated with the
 // samples.
 func evalSelectProcesses(db *DB, statement parser.Statement) []mcmodel.Activity {
+	// A negated statement is only evaluated against processes, with any sample matches evaluated against each
+	// process's samples, for the same reason as in evalSelectSamples.
+	if parser.HasNotStatement(statement) {
+		return evalMatchingProcesses(db, statement)
+	}
+
 	var matchingProcesses []mcmodel.Activity
 	var matchingSamples []mcmodel.Entity
 
@@ -210,6 +234,8 @@ func eval(db *DB, process *mcmodel.Activity, sampleState *SampleState, statement
 		return evalAndStatement(db, process, sampleState, s)
 	case parser.OrStatement:
 		return evalOrStatement(db, process, sampleState, s)
+	case parser.NotStatement:
+		return evalNotStatement(db, process, sampleState, s)
 	default:
 		return false
 	}
@@ -235,11 +261,36 @@ func evalOrStatement(db *DB, process *mcmodel.Activity, sampleState *SampleState
 	return eval(db, process, sampleState, statement.Right)
 }
 
+// evalNotStatement evaluates a NotStatement. A sample matches when none of its states match the negated
+// statement, rather than when one of them doesn't. Otherwise "not sa:grain size = 5" would match a sample
+// that had a grain size of 5 in one state but not in another, and "not s-has-attribute" would match every
+// sample with a state that lacks the attribute.
+func evalNotStatement(db *DB, process *mcmodel.Activity, sampleState *SampleState, statement parser.NotStatement) bool {
+	if sampleState == nil {
+		return !eval(db, process, nil, statement.Statement)
+	}
+
+	for _, entityState := range sampleState.sample.EntityStates {
+		state := SampleState{sampleState.sample, entityState.ID}
+		if eval(db, process, &state, statement.Statement) {
+			return false
+		}
+	}
+
+	return true
+}
+
 // evalMatchStatement evaluates a MatchStatement which is a leaf node matching against a specific type of item such
 // as a process or sample attribute, or similar.
 func evalMatchStatement(db *DB, process *mcmodel.Activity, sampleState *SampleState, match parser.MatchStatement) bool {
 	switch match.FieldType {
 	case parser.ProcessFieldType:
+		// Like process attributes below, in a sample context the match is against the sample's processes.
+		if sampleState != nil {
+			return anySampleProcess(sampleState, db, func(process *mcmodel.Activity) bool {
+				return evalProcessFieldMatch(process, match)
+			})
+		}
 		return evalProcessFieldMatch(process, match)
 	case parser.ProcessAttributeFieldType:
 		// There are two contexts in which to evaluate a process attribute - A sample or a process context. When in
@@ -251,6 +302,12 @@ func evalMatchStatement(db *DB, process *mcmodel.Activity, sampleState *SampleSt
 		}
 		return evalProcessAttributeFieldMatch(process, db, match)
 	case parser.SampleFieldType:
+		// Like sample attributes below, in a process context the match is against the process's samples.
+		if process != nil {
+			return anyProcessSampleState(process, db, func(sampleState *SampleState) bool {
+				return evalSampleFieldMatch(sampleState, match)
+			})
+		}
 		return evalSampleFieldMatch(sampleState, match)
 	case parser.SampleAttributeFieldType:
 		// There are two contexts in which to evaluate a sample attribute - A sample or a process context. When in
@@ -262,8 +319,18 @@ func evalMatchStatement(db *DB, process *mcmodel.Activity, sampleState *SampleSt
 		}
 		return evalSampleAttributeFieldMatch(sampleState, db, match)
 	case parser.ProcessFuncType:
+		if sampleState != nil {
+			return anySampleProcess(sampleState, db, func(process *mcmodel.Activity) bool {
+				return evalProcessFuncMatch(process, db, match)
+			})
+		}
 		return evalProcessFuncMatch(process, db, match)
 	case parser.SampleFuncType:
+		if process != nil {
+			return anyProcessSampleState(process, db, func(sampleState *SampleState) bool {
+				return evalSampleFuncMatch(sampleState, db, match)
+			})
+		}
 		return evalSampleFuncMatch(sampleState, db, match)
 	}
 
@@ -385,6 +452,14 @@ func evalProcessFuncMatchHasAttribute(process *mcmodel.Activity, db *DB, attribu
 // this it uses the sample to look up all the processes associated with the sample and then evaluates them, stopping
 // if one of them evaluates to true.
 func evalProcessAttributeFieldMatchForSampleState(sampleState *SampleState, db *DB, match parser.MatchStatement) bool {
+	return anySampleProcess(sampleState, db, func(process *mcmodel.Activity) bool {
+		return evalProcessAttributeFieldMatch(process, db, match)
+	})
+}
+
+// anySampleProcess looks up the processes associated with the sample and returns true if evalProcess is true
+// for one of them.
+func anySampleProcess(sampleState *SampleState, db *DB, evalProcess func(process *mcmodel.Activity) bool) bool {
 	// Get the processes associated with the sample
 	processes, ok := db.SampleProcesses[sampleState.sample.ID]
 	if !ok {
@@ -392,9 +467,9 @@ func evalProcessAttributeFieldMatchForSampleState(sampleState *SampleState, db *
 		return false
 	}
 
-	// Loop through the processes looking for a match on the specified attribute
+	// Loop through the processes looking for a match
 	for _, process := range processes {
-		if evalProcessAttributeFieldMatch(process, db, match) {
+		if evalProcess(process) {
 			return true
 		}
 	}
@@ -427,13 +502,8 @@ func evalProcessAttributeFieldMatch(process *mcmodel.Activity, db *DB, match par
 	// An attribute may have a list of values, so evaluate the match statement against each
 	// stopping if one matches.
 	for _, value := range attribute.AttributeValues {
-		switch value.ValueType {
-		case mcmodel.ValueTypeInt:
-			return tryEvalAttributeIntMatch(value.ValueInt, match)
-		case mcmodel.ValueTypeFloat:
-			return tryEvalAttributeFloatMatch(value.ValueFloat, match)
-		case mcmodel.ValueTypeString:
-			return tryEvalAttributeStringMatch(value.ValueString, match)
+		if evalAttributeValueMatch(value, match) {
+			return true
 		}
 	}
 
@@ -443,6 +513,14 @@ func evalProcessAttributeFieldMatch(process *mcmodel.Activity, db *DB, match par
 // evalSampleAttributeFieldMatchForProcess evaluates a sample field in a process context. It looks up the samples
 // for a given process and then runs an evaluation again each of them.
 func evalSampleAttributeFieldMatchForProcess(process *mcmodel.Activity, db *DB, match parser.MatchStatement) bool {
+	return anyProcessSampleState(process, db, func(sampleState *SampleState) bool {
+		return evalSampleAttributeFieldMatch(sampleState, db, match)
+	})
+}
+
+// anyProcessSampleState looks up the samples associated with the process and returns true if evalSampleState
+// is true for one of their states.
+func anyProcessSampleState(process *mcmodel.Activity, db *DB, evalSampleState func(sampleState *SampleState) bool) bool {
 	// Get the list of samples associated with the process
 	samples, ok := db.ProcessSamples[process.ID]
 	if !ok {
@@ -456,7 +534,7 @@ func evalSampleAttributeFieldMatchForProcess(process *mcmodel.Activity, db *DB,
 				sample:        sample,
 				EntityStateID: state.ID,
 			}
-			if evalSampleAttributeFieldMatch(sampleState, db, match) {
+			if evalSampleState(sampleState) {
 				return true
 			}
 		}
@@ -493,13 +571,8 @@ func evalSampleAttributeFieldMatch(sampleState *SampleState, db *DB, match parse
 
 	// Attributes can have multiple values, loop through each value, stopping if a match evaluates to true.
 	for _, value := range attribute.AttributeValues {
-		switch value.ValueType {
-		case mcmodel.ValueTypeInt:
-			return tryEvalAttributeIntMatch(value.ValueInt, match)
-		case mcmodel.ValueTypeFloat:
-			return tryEvalAttributeFloatMatch(value.ValueFloat, match)
-		case mcmodel.ValueTypeString:
-			return tryEvalAttributeStringMatch(value.ValueString, match)
+		if evalAttributeValueMatch(value, match) {
+			return true
 		}
 	}
 
@@ -1,9 +1,15 @@
 package mqldb
 
 import (
+	"encoding/json"
 	"fmt"
-	"github.com/materials-commons/hydra/pkg/mql/parser"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mql/parser"
 )
 
 func TestSimpleProcessQueries(t *testing.T) {
@@ -260,3 +266,257 @@ func TestSimpleSelectSamplesThroughProcessesQuery(t *testing.T) {
 		t.Fatalf("Expected matchingSamples length = 2, got %d", len(matchingSamples))
 	}
 }
+
+func TestTextQuery(t *testing.T) {
+	db := createTestDB()
+
+	query, err := CompileQuery(`select processes where p:name = Texture or p:'frames per second' > 3`)
+	if err != nil {
+		t.Fatalf("CompileQuery failed: %s", err)
+	}
+
+	if !query.Selection.ProcessSelection.All || query.Selection.SampleSelection.All {
+		t.Fatalf("Expected only processes to be selected, got %+v", query.Selection)
+	}
+
+	matchingProcesses, _ := EvalStatement(db, query.Selection, query.Statement)
+	if len(matchingProcesses) != 3 {
+		t.Fatalf("Expected 3 matches on: name = 'Texture' or attribute 'frames per second' > 3, but got %d", len(matchingProcesses))
+	}
+
+	if _, err := CompileQuery(`select processes where p:name > Texture`); err == nil {
+		t.Fatalf("Expected comparing a name with > to fail")
+	}
+}
+
+func TestNotStatementQueries(t *testing.T) {
+	db := createTestDB()
+
+	tests := []struct {
+		query   string
+		samples []string
+	}{
+		// S1 and S2 each have a state with mg = 0.4. Negation is across all of a sample's states, so having
+		// another state with a different mg doesn't make them match.
+		{`select samples where not sa:mg = 0.4`, []string{"S3"}},
+		{`select samples where sa:mg <> 0.4`, []string{"S1", "S2", "S3"}},
+		{`select samples where sa:zn = 0.5 and not sa:hardness = 1`, []string{"S2"}},
+		{`select samples where not (sa:alloy = zn45 or sa:hardness = 1)`, []string{"S3"}},
+		{`select samples where not pa:'PF scale max' = 3`, []string{"S1", "S2"}},
+		// Process fields are matched against a sample's processes. Every sample went through an EBSD process.
+		{`select samples where not p:name = EBSD`, nil},
+		{`select samples where s:name = S1 or not p:name = EBSD`, []string{"S1"}},
+		{`select samples where p:name = EBSD and not sa:hardness = 1`, []string{"S2", "S3"}},
+	}
+
+	for _, test := range tests {
+		query, err := CompileQuery(test.query)
+		if err != nil {
+			t.Fatalf("%s: CompileQuery failed: %s", test.query, err)
+		}
+
+		_, samples := EvalStatement(db, query.Selection, query.Statement)
+		if names := sampleNames(samples); !equalNames(names, test.samples) {
+			t.Errorf("%s: expected %v, got %v", test.query, test.samples, names)
+		}
+	}
+
+	processTests := []struct {
+		query     string
+		processes []int
+	}{
+		// S2 is used by processes 1 and 3, so only the processes for S3 don't have a sample with that alloy.
+		{`select processes where not sa:alloy = zn45`, []int{2, 4}},
+		// Sample fields are matched against a process's samples.
+		{`select processes where not s:name = S1`, []int{2, 4}},
+		{`select processes where p:name = EBSD and not s:name = S3`, []int{1}},
+		{`select processes where s:name = S1 and not pa:'Beam Type' = Wide`, []int{3}},
+	}
+
+	for _, test := range processTests {
+		query, err := CompileQuery(test.query)
+		if err != nil {
+			t.Fatalf("%s: CompileQuery failed: %s", test.query, err)
+		}
+
+		processes, _ := EvalStatement(db, query.Selection, query.Statement)
+		if ids := sortedProcessIDs(processes); !reflect.DeepEqual(ids, test.processes) {
+			t.Errorf("%s: expected %v, got %v", test.query, test.processes, ids)
+		}
+	}
+
+	// Built-in functions are negated across sample states too.
+	notHasHardness := parser.NotStatement{
+		Statement: parser.MatchStatement{
+			FieldType: parser.SampleFuncType,
+			Operation: "has-attribute",
+			Value:     "hardness",
+		},
+	}
+	_, samples := EvalStatement(db, selectAllSamples(), notHasHardness)
+	if names := sampleNames(samples); !equalNames(names, []string{"S2", "S3"}) {
+		t.Errorf("Expected samples without hardness to be S2 and S3, got %v", names)
+	}
+
+	// And against a process's samples. S1 has hardness and is used by processes 1 and 3.
+	processes, _ := EvalStatement(db, selectAllProcesses(), notHasHardness)
+	if ids := sortedProcessIDs(processes); !reflect.DeepEqual(ids, []int{2, 4}) {
+		t.Errorf("Expected processes without a hardness sample to be 2 and 4, got %v", ids)
+	}
+
+	// Process functions are matched against a sample's processes. Only S3 is used by a process with S3.
+	notHasSampleS3 := parser.NotStatement{
+		Statement: parser.MatchStatement{
+			FieldType: parser.ProcessFuncType,
+			Operation: "has-sample",
+			Value:     "S3",
+		},
+	}
+	_, samples = EvalStatement(db, selectAllSamples(), notHasSampleS3)
+	if names := sampleNames(samples); !equalNames(names, []string{"S1", "S2"}) {
+		t.Errorf("Expected samples not sharing a process with S3 to be S1 and S2, got %v", names)
+	}
+}
+
+func TestNotStatementJSON(t *testing.T) {
+	statement := parser.AndStatement{
+		Left: parser.NotStatement{
+			Statement: parser.MatchStatement{
+				FieldType: parser.SampleFuncType,
+				FieldName: "",
+				Operation: "has-process",
+				Value:     "heat treatment",
+			},
+		},
+		Right: parser.MatchStatement{
+			FieldType: parser.SampleAttributeFieldType,
+			FieldName: "grain size",
+			Operation: "<>",
+			Value:     "5",
+		},
+	}
+
+	data, err := json.Marshal(statement)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+
+	if decoded := MapToStatement(m); !reflect.DeepEqual(decoded, parser.Statement(statement)) {
+		t.Fatalf("Expected %+v, got %+v", statement, decoded)
+	}
+}
+
+func TestPatternQueries(t *testing.T) {
+	db := createTestDB()
+
+	tests := []struct {
+		query   string
+		samples []string
+	}{
+		{`select samples where sa:zn between 0.55 and 0.7`, []string{"S2", "S3"}},
+		{`select samples where sa:zn in (0.6, 0.45)`, []string{"S2", "S3"}},
+		{`select samples where sa:'hardness' in (1, 2)`, []string{"S1"}},
+		{`select samples where sa:alloy in (al7075, "ZN45")`, []string{"S2"}},
+		{`select samples where sa:alloy like "zn%"`, []string{"S2"}},
+		{`select samples where sa:alloy matches '^zn[0-9]+$'`, []string{"S2"}},
+		{`select samples where sa:alloy matches '^zn[0-9]$'`, nil},
+		{`select samples where s:name like "S_"`, []string{"S1", "S2", "S3"}},
+		{`select samples where s:name in (S1, S3) and not sa:zn between 0.6 and 0.7`, []string{"S1"}},
+	}
+
+	for _, test := range tests {
+		query, err := CompileQuery(test.query)
+		if err != nil {
+			t.Fatalf("%s: CompileQuery failed: %s", test.query, err)
+		}
+
+		_, samples := EvalStatement(db, query.Selection, query.Statement)
+		if names := sampleNames(samples); !equalNames(names, test.samples) {
+			t.Errorf("%s: expected %v, got %v", test.query, test.samples, names)
+		}
+	}
+
+	query, err := CompileQuery(`select processes where p:name like "tex%" or pa:'frames per second' between 4 and 6`)
+	if err != nil {
+		t.Fatalf("CompileQuery failed: %s", err)
+	}
+
+	processes, _ := EvalStatement(db, query.Selection, query.Statement)
+	if len(processes) != 3 {
+		t.Fatalf("Expected 3 processes, got %d", len(processes))
+	}
+	for _, process := range processes {
+		if process.ID == 2 {
+			t.Errorf("Expected process 2 not to match")
+		}
+	}
+
+	if _, err := CompileQuery(`select samples where sa:alloy matches '[zn'`); err == nil {
+		t.Errorf("Expected an invalid regex to be an error")
+	}
+}
+
+func TestPatternStatementJSON(t *testing.T) {
+	statement := parser.OrStatement{
+		Left: parser.MatchStatement{
+			FieldType: parser.SampleAttributeFieldType,
+			FieldName: "zn",
+			Operation: parser.OpBetween,
+			Value:     []interface{}{0.55, 0.7},
+		},
+		Right: parser.MatchStatement{
+			FieldType: parser.SampleAttributeFieldType,
+			FieldName: "alloy",
+			Operation: parser.OpMatches,
+			Value:     "^ZN",
+		},
+	}
+
+	data, err := json.Marshal(statement)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+
+	decoded := MapToStatement(m)
+	if !reflect.DeepEqual(decoded, parser.Statement(statement)) {
+		t.Fatalf("Expected %+v, got %+v", statement, decoded)
+	}
+
+	_, samples := EvalStatement(createTestDB(), selectAllSamples(), decoded)
+	if names := sampleNames(samples); !equalNames(names, []string{"S2", "S3"}) {
+		t.Errorf("Expected S2 and S3, got %v", names)
+	}
+
+	if _, err := parser.Prepare(parser.MatchStatement{Operation: parser.OpIn, Value: "zn45"}); err == nil {
+		t.Errorf("Expected an in match without a list to be an error")
+	}
+}
+
+func sampleNames(samples []mcmodel.Entity) []string {
+	var names []string
+	for _, sample := range samples {
+		names = append(names, sample.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedProcessIDs(processes []mcmodel.Activity) []int {
+	ids := processIDs(processes)
+	sort.Ints(ids)
+	return ids
+}
+
+func equalNames(names, expected []string) bool {
+	return strings.Join(names, ",") == strings.Join(expected, ",")
+}
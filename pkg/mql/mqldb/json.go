@@ -10,6 +10,7 @@ func MapToStatement(m map[string]interface{}) parser.Statement {
 	//fmt.Printf("MapToStatement = %+v\n", m)
 	_, hasAnd := m["and"]
 	_, hasOr := m["or"]
+	_, hasNot := m["not"]
 	_, hasFieldName := m["field_name"]
 	switch {
 	case hasAnd:
@@ -40,16 +41,27 @@ func MapToStatement(m map[string]interface{}) parser.Statement {
 
 		return orStatement
 
+	case hasNot:
+		notStatement := parser.NotStatement{}
+		statement, hasStatement := m["statement"]
+		if hasStatement {
+			notStatement.Statement = MapToStatement(statement.(map[string]interface{}))
+		}
+
+		return notStatement
+
 	case hasFieldName:
 		fieldName, ok := m["field_name"].(string)
 		if !ok {
 			fieldName = ""
 		}
+		unit, _ := m["unit"].(string)
 		return parser.MatchStatement{
 			FieldType: int(m["field_type"].(float64)),
 			FieldName: fieldName,
 			Operation: m["operation"].(string),
 			Value:     m["value"],
+			Unit:      unit,
 		}
 	}
 
@@ -1,15 +1,119 @@
 package mqldb
 
 import (
+	"math"
 	"strconv"
 	"strings"
 
 	"github.com/materials-commons/hydra/pkg/mql/parser"
+	"github.com/materials-commons/hydra/pkg/units"
 
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 )
 
+// evalAttributeValueMatch evaluates a match against a single attribute value. For an array value the match
+// is evaluated against each element and is true if any element matches, except for "<>" which is true
+// only when no element equals the match value. Complex values never match. When the match and the value
+// are in different units the value is converted to the match's unit first.
+func evalAttributeValueMatch(value mcmodel.AttributeValue, match parser.MatchStatement) bool {
+	if match.Unit != "" && value.Unit != "" && match.Unit != value.Unit {
+		// Values in a unit that isn't known are compared as is.
+		if _, known := units.Lookup(value.Unit); known {
+			return evalConvertedMatch(value, match)
+		}
+	}
+
+	switch value.ValueType {
+	case mcmodel.ValueTypeInt:
+		return tryEvalAttributeIntMatch(value.ValueInt, match)
+	case mcmodel.ValueTypeFloat:
+		return tryEvalAttributeFloatMatch(value.ValueFloat, match)
+	case mcmodel.ValueTypeString:
+		return tryEvalAttributeStringMatch(value.ValueString, match)
+	case mcmodel.ValueTypeArrayOfInt:
+		return evalArrayMatch(len(value.ValueArrayOfInt), match, func(i int, m parser.MatchStatement) bool {
+			return tryEvalAttributeIntMatch(value.ValueArrayOfInt[i], m)
+		})
+	case mcmodel.ValueTypeArrayOfFloat:
+		return evalArrayMatch(len(value.ValueArrayOfFloat), match, func(i int, m parser.MatchStatement) bool {
+			return tryEvalAttributeFloatMatch(value.ValueArrayOfFloat[i], m)
+		})
+	case mcmodel.ValueTypeArrayOfString:
+		return evalArrayMatch(len(value.ValueArrayOfString), match, func(i int, m parser.MatchStatement) bool {
+			return tryEvalAttributeStringMatch(value.ValueArrayOfString[i], m)
+		})
+	default:
+		return false
+	}
+}
+
+// evalArrayMatch evaluates match against the n elements of an array using evalElement.
+func evalArrayMatch(n int, match parser.MatchStatement, evalElement func(i int, match parser.MatchStatement) bool) bool {
+	if match.Operation == "<>" {
+		equals := match
+		equals.Operation = "="
+		for i := 0; i < n; i++ {
+			if evalElement(i, equals) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for i := 0; i < n; i++ {
+		if evalElement(i, match) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// evalCompoundMatch evaluates the "in" and "between" operations, which are made up of several simple
+// matches, using evalSimple to evaluate each of them. An "in" is true when the value equals any of the
+// listed values, and a "between" when it is within the two values inclusive. The second return is false
+// for any other operation.
+func evalCompoundMatch(match parser.MatchStatement, evalSimple func(match parser.MatchStatement) bool) (result bool, compound bool) {
+	switch match.Operation {
+	case parser.OpIn:
+		values, _ := match.Value.([]interface{})
+		for _, v := range values {
+			if evalSimple(simpleMatch(match, "=", v)) {
+				return true, true
+			}
+		}
+		return false, true
+	case parser.OpBetween:
+		values, _ := match.Value.([]interface{})
+		if len(values) != 2 {
+			return false, true
+		}
+		return evalSimple(simpleMatch(match, ">=", values[0])) && evalSimple(simpleMatch(match, "<=", values[1])), true
+	default:
+		return false, false
+	}
+}
+
+// simpleMatch returns a copy of match with operation and value replaced.
+func simpleMatch(match parser.MatchStatement, operation string, value interface{}) parser.MatchStatement {
+	m := match
+	m.Operation = operation
+	m.Value = value
+	return m
+}
+
 func tryEvalAttributeIntMatch(val1 int64, match parser.MatchStatement) bool {
+	if result, compound := evalCompoundMatch(match, func(m parser.MatchStatement) bool {
+		return tryEvalAttributeIntMatch(val1, m)
+	}); compound {
+		return result
+	}
+
+	// Compare against a value with a fraction as floats, so 3 = 3.5 isn't true.
+	if val2, ok := matchValToFloat(match); ok && val2 != math.Trunc(val2) {
+		return evalFloatMatch(float64(val1), val2, match.Operation)
+	}
+
 	val2, ok := matchValToInt(match)
 	if !ok {
 		return false
@@ -40,6 +144,12 @@ func matchValToInt(match parser.MatchStatement) (int64, bool) {
 }
 
 func tryEvalAttributeFloatMatch(val1 float64, match parser.MatchStatement) bool {
+	if result, compound := evalCompoundMatch(match, func(m parser.MatchStatement) bool {
+		return tryEvalAttributeFloatMatch(val1, m)
+	}); compound {
+		return result
+	}
+
 	val2, ok := matchValToFloat(match)
 	if !ok {
 		return false
@@ -71,6 +181,18 @@ func matchValToFloat(match parser.MatchStatement) (float64, bool) {
 }
 
 func tryEvalAttributeStringMatch(val1 string, match parser.MatchStatement) bool {
+	if result, compound := evalCompoundMatch(match, func(m parser.MatchStatement) bool {
+		return tryEvalAttributeStringMatch(val1, m)
+	}); compound {
+		return result
+	}
+
+	switch match.Operation {
+	case parser.OpLike, parser.OpMatches:
+		// The pattern is compiled once for the whole query by parser.Prepare.
+		return match.Pattern != nil && match.Pattern.MatchString(val1)
+	}
+
 	val2, ok := match.Value.(string)
 	if !ok {
 		return false
@@ -82,46 +204,34 @@ func evalProcessFieldMatch(process *mcmodel.Activity, match parser.MatchStatemen
 	if process == nil {
 		return false
 	}
-	if match.FieldName == "name" {
-		name, ok := match.Value.(string)
-		if !ok {
-			return false
-		}
-		return evalStringMatch(name, process.Name, match.Operation)
-	}
 
-	if match.FieldName == "id" {
-		id, ok := match.Value.(int)
-		if !ok {
-			return false
-		}
-		return evalIntMatch(int64(id), int64(process.ID), match.Operation)
+	switch match.FieldName {
+	case "name":
+		return tryEvalAttributeStringMatch(process.Name, match)
+	case "category":
+		return tryEvalAttributeStringMatch(process.Category, match)
+	case "id":
+		return tryEvalAttributeIntMatch(int64(process.ID), match)
+	default:
+		return false
 	}
-
-	return false
 }
 
 func evalSampleFieldMatch(sampleState *SampleState, match parser.MatchStatement) bool {
 	if sampleState == nil {
 		return false
 	}
-	if match.FieldName == "name" {
-		name, ok := match.Value.(string)
-		if !ok {
-			return false
-		}
-		return evalStringMatch(name, sampleState.sample.Name, match.Operation)
-	}
 
-	if match.FieldName == "id" {
-		id, ok := match.Value.(int)
-		if !ok {
-			return false
-		}
-		return evalIntMatch(int64(id), int64(sampleState.sample.ID), match.Operation)
+	switch match.FieldName {
+	case "name":
+		return tryEvalAttributeStringMatch(sampleState.sample.Name, match)
+	case "category":
+		return tryEvalAttributeStringMatch(sampleState.sample.Category, match)
+	case "id":
+		return tryEvalAttributeIntMatch(int64(sampleState.sample.ID), match)
+	default:
+		return false
 	}
-
-	return false
 }
 
 func stringsMatchIgnoringCase(val1, val2 string) bool {
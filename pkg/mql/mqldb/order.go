@@ -0,0 +1,385 @@
+package mqldb
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mql/parser"
+	"github.com/materials-commons/hydra/pkg/units"
+)
+
+// ErrInvalidCursor is returned for a cursor that wasn't returned by EvalPage for the same query.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page is a page of the samples and processes returned by a query. NextCursor gets the page after it, and
+// is empty when there are no more.
+type Page struct {
+	Processes  []mcmodel.Activity
+	Samples    []mcmodel.Entity
+	NextCursor string
+}
+
+// EvalPage runs a query and returns a page of its results. The samples and processes are sorted by
+// selection.OrderBy and then by ID, so they are always in the same order, and at most selection.Limit of
+// each are returned. The first page, which is returned when cursor is empty, skips the first
+// selection.Offset of them. Later pages start after the samples and processes of the page before, whose
+// NextCursor records the values they were sorted by rather than their positions. So a page doesn't repeat
+// or skip results when samples or processes are added or removed, as when the project's DB is reloaded,
+// between pages.
+func EvalPage(db *DB, selection Selection, statement parser.Statement, cursor string) (*Page, error) {
+	var after *pageCursor
+	if cursor != "" {
+		var err error
+		if after, err = decodeCursor(cursor, queryFingerprint(db, selection, statement), len(selection.OrderBy)); err != nil {
+			return nil, err
+		}
+	}
+
+	processes, samples := evalStatement(db, selection, statement)
+	page := &Page{}
+	next := &pageCursor{}
+	more := false
+
+	if selection.ProcessSelection.All {
+		items := make([]resultItem, len(processes))
+		for i := range processes {
+			items[i] = processItem(db, &processes[i])
+		}
+
+		var from *sortKey
+		if after != nil {
+			from = after.Processes
+		}
+
+		keys := sortItems(db, items, processIDs(processes), selection.OrderBy)
+		start, end := pageBounds(keys, selection, after != nil, from)
+		for _, key := range keys[start:end] {
+			page.Processes = append(page.Processes, processes[key.index])
+		}
+		if end < len(keys) {
+			next.Processes, more = &keys[end-1], true
+		}
+	}
+
+	if selection.SampleSelection.All {
+		items := make([]resultItem, len(samples))
+		for i := range samples {
+			items[i] = sampleItem(db, &samples[i])
+		}
+
+		var from *sortKey
+		if after != nil {
+			from = after.Samples
+		}
+
+		keys := sortItems(db, items, sampleIDs(samples), selection.OrderBy)
+		start, end := pageBounds(keys, selection, after != nil, from)
+		for _, key := range keys[start:end] {
+			page.Samples = append(page.Samples, samples[key.index])
+		}
+		if end < len(keys) {
+			next.Samples, more = &keys[end-1], true
+		}
+	}
+
+	if more {
+		next.Query = queryFingerprint(db, selection, statement)
+		page.NextCursor = encodeCursor(next)
+	}
+
+	return page, nil
+}
+
+// OrderSamples returns samples sorted by orderBy, and then by ID.
+func OrderSamples(db *DB, samples []mcmodel.Entity, orderBy []parser.OrderBy) []mcmodel.Entity {
+	items := make([]resultItem, len(samples))
+	for i := range samples {
+		items[i] = sampleItem(db, &samples[i])
+	}
+
+	sorted := make([]mcmodel.Entity, 0, len(samples))
+	for _, key := range sortItems(db, items, sampleIDs(samples), orderBy) {
+		sorted = append(sorted, samples[key.index])
+	}
+
+	return sorted
+}
+
+// OrderProcesses returns processes sorted by orderBy, and then by ID.
+func OrderProcesses(db *DB, processes []mcmodel.Activity, orderBy []parser.OrderBy) []mcmodel.Activity {
+	items := make([]resultItem, len(processes))
+	for i := range processes {
+		items[i] = processItem(db, &processes[i])
+	}
+
+	sorted := make([]mcmodel.Activity, 0, len(processes))
+	for _, key := range sortItems(db, items, processIDs(processes), orderBy) {
+		sorted = append(sorted, processes[key.index])
+	}
+
+	return sorted
+}
+
+func sampleIDs(samples []mcmodel.Entity) []int {
+	ids := make([]int, len(samples))
+	for i := range samples {
+		ids[i] = samples[i].ID
+	}
+
+	return ids
+}
+
+func processIDs(processes []mcmodel.Activity) []int {
+	ids := make([]int, len(processes))
+	for i := range processes {
+		ids[i] = processes[i].ID
+	}
+
+	return ids
+}
+
+// sortKey is what a sample or process is sorted by: its value for each of the fields or attributes ordered
+// by, which is nil when it has none, and then its ID. Values are float64s or strings, so a key survives
+// being encoded in a cursor. The index is the position of the sample or process in the results.
+type sortKey struct {
+	Values []interface{} `json:"v"`
+	ID     int           `json:"id"`
+	index  int
+}
+
+// sortItems returns the sort keys of items, whose IDs are ids, in sorted order.
+func sortItems(db *DB, items []resultItem, ids []int, orderBy []parser.OrderBy) []sortKey {
+	keys := make([]sortKey, len(items))
+	for i, item := range items {
+		keys[i] = sortKey{ID: ids[i], index: i}
+		for _, o := range orderBy {
+			keys[i].Values = append(keys[i].Values, item.sortValue(db, o))
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return compareKeys(keys[i], keys[j], orderBy) < 0
+	})
+
+	return keys
+}
+
+// sortValue returns the value of a field or attribute that the item is sorted by. When it has several, the
+// smallest is used to sort in ascending order and the largest in descending order. Numbers in a known unit
+// are converted to the base unit of what they measure, so that values recorded in different units sort
+// correctly.
+func (item resultItem) sortValue(db *DB, o parser.OrderBy) interface{} {
+	var values []interface{}
+	switch o.FieldType {
+	case parser.SampleFieldType:
+		for _, sample := range item.samples {
+			values = append(values, entityField(sample.Name, sample.Category, o.FieldName))
+		}
+	case parser.ProcessFieldType:
+		for _, process := range item.processes {
+			values = append(values, entityField(process.Name, process.Category, o.FieldName))
+		}
+	default:
+		for _, value := range item.attributeValues(db, o.FieldType, o.FieldName) {
+			for _, v := range scalarValues(value) {
+				if v = sortableValue(v, value.Unit); v != nil {
+					values = append(values, v)
+				}
+			}
+		}
+	}
+
+	var result interface{}
+	for _, v := range values {
+		switch c := compareValues(v, result); {
+		case result == nil, o.Descending && c > 0, !o.Descending && c < 0:
+			result = v
+		}
+	}
+
+	return result
+}
+
+// sortableValue converts a scalar attribute value to the float64 or string it is sorted by. It returns nil
+// for a number that isn't finite, which can't be sorted or put in a cursor.
+func sortableValue(value interface{}, unit string) interface{} {
+	var n float64
+	switch v := value.(type) {
+	case int64:
+		n = float64(v)
+	case float64:
+		n = v
+	default:
+		return value
+	}
+
+	if normalized, _, err := units.Normalize(n, unit); err == nil {
+		n = normalized
+	}
+
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return nil
+	}
+
+	return n
+}
+
+// compareKeys compares two sort keys, returning a negative number when a comes first, a positive one when
+// b does, and 0 when they are the same. Values that are missing come last in either direction.
+func compareKeys(a, b sortKey, orderBy []parser.OrderBy) int {
+	for i, o := range orderBy {
+		av, bv := a.Values[i], b.Values[i]
+		switch {
+		case av == nil && bv == nil:
+			continue
+		case av == nil:
+			return 1
+		case bv == nil:
+			return -1
+		}
+
+		c := compareValues(av, bv)
+		if o.Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case a.ID < b.ID:
+		return -1
+	case a.ID > b.ID:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareValues compares two sort values. Numbers come before strings, which are compared ignoring case
+// unless that makes them the same.
+func compareValues(a, b interface{}) int {
+	an, aIsNumber := a.(float64)
+	bn, bIsNumber := b.(float64)
+	switch {
+	case aIsNumber && bIsNumber:
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		default:
+			return 0
+		}
+	case aIsNumber:
+		return -1
+	case bIsNumber:
+		return 1
+	}
+
+	as, _ := a.(string)
+	bs, _ := b.(string)
+	if c := strings.Compare(strings.ToLower(as), strings.ToLower(bs)); c != 0 {
+		return c
+	}
+
+	return strings.Compare(as, bs)
+}
+
+// pageBounds returns the range of keys in a page. A page that continues from a cursor starts after the
+// key in the cursor, and is empty when the cursor has none as they were all returned by earlier pages.
+func pageBounds(keys []sortKey, selection Selection, fromCursor bool, after *sortKey) (int, int) {
+	start := 0
+	switch {
+	case fromCursor && after == nil:
+		start = len(keys)
+	case fromCursor:
+		start = sort.Search(len(keys), func(i int) bool {
+			return compareKeys(keys[i], *after, selection.OrderBy) > 0
+		})
+	default:
+		start = min(max(selection.Offset, 0), len(keys))
+	}
+
+	end := len(keys)
+	if selection.Limit > 0 && start+selection.Limit < end {
+		end = start + selection.Limit
+	}
+
+	return start, end
+}
+
+// pageCursor is what a cursor holds: the keys of the last process and sample returned, which are nil once
+// all of them have been, and a fingerprint of the query it is for.
+type pageCursor struct {
+	Query     string   `json:"q"`
+	Processes *sortKey `json:"p,omitempty"`
+	Samples   *sortKey `json:"s,omitempty"`
+}
+
+func encodeCursor(c *pageCursor) string {
+	// A cursor only holds strings, float64s that are finite and ints, so can always be marshalled.
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor decodes a cursor, checking that it is for the query with the fingerprint query and that
+// its keys have a value for each of the orderings.
+func decodeCursor(cursor, query string, orderings int) (*pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c pageCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if c.Query != query {
+		return nil, fmt.Errorf("%w: it is for a different query", ErrInvalidCursor)
+	}
+
+	for _, key := range []*sortKey{c.Processes, c.Samples} {
+		if key == nil {
+			continue
+		}
+
+		if len(key.Values) != orderings {
+			return nil, ErrInvalidCursor
+		}
+
+		for _, v := range key.Values {
+			switch v.(type) {
+			case nil, float64, string:
+			default:
+				return nil, ErrInvalidCursor
+			}
+		}
+	}
+
+	return &c, nil
+}
+
+// queryFingerprint identifies a query and the project it is run against, so that a cursor can't be used
+// with another. The limit isn't part of it, so pages can be of different sizes.
+func queryFingerprint(db *DB, selection Selection, statement parser.Statement) string {
+	b, _ := json.Marshal(struct {
+		ProjectID int
+		Processes bool
+		Samples   bool
+		OrderBy   []parser.OrderBy
+		Statement parser.Statement
+	}{db.ProjectID, selection.ProcessSelection.All, selection.SampleSelection.All, selection.OrderBy, statement})
+
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
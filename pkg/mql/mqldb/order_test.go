@@ -0,0 +1,146 @@
+package mqldb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+)
+
+func TestOrderSamplesQuery(t *testing.T) {
+	db := createTestDB()
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		// A sample is sorted by its smallest zn in ascending order and its largest in descending order, and
+		// then by ID.
+		{`select samples where sa:zn > 0 order by sa:zn`, "S3,S1,S2"},
+		{`select samples where sa:zn > 0 order by sa:zn desc`, "S3,S2,S1"},
+
+		// Samples without the attribute come last in either direction.
+		{`select samples where sa:zn > 0 order by sa:hardness`, "S1,S2,S3"},
+		{`select samples where sa:zn > 0 order by sa:hardness desc, s:name desc`, "S1,S3,S2"},
+
+		{`select samples where sa:zn > 0 order by s:name desc offset 1`, "S2,S1"},
+		{`select samples where sa:zn > 0 order by s:name desc limit 2`, "S3,S2"},
+		{`select samples where sa:zn > 0 offset 1 limit 1`, "S2"},
+		{`select samples where sa:zn > 0 offset 5`, ""},
+	}
+
+	for _, test := range tests {
+		query, err := CompileQuery(test.query)
+		if err != nil {
+			t.Fatalf("%s: CompileQuery failed: %s", test.query, err)
+		}
+
+		_, samples := EvalStatement(db, query.Selection, query.Statement)
+		if names := orderedSampleNames(samples); names != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.query, test.expected, names)
+		}
+	}
+}
+
+func TestOrderProcessesQuery(t *testing.T) {
+	db := createTestDB()
+	db.ProcessAttributesByProcessID[1]["temperature"] = &mcmodel.Attribute{
+		Name:            "temperature",
+		AttributeValues: []mcmodel.AttributeValue{{ValueType: mcmodel.ValueTypeInt, ValueInt: 500, Unit: "C"}},
+	}
+	db.ProcessAttributesByProcessID[2]["temperature"] = &mcmodel.Attribute{
+		Name:            "temperature",
+		AttributeValues: []mcmodel.AttributeValue{{ValueType: mcmodel.ValueTypeFloat, ValueFloat: 700, Unit: "K"}},
+	}
+
+	query, err := CompileQuery(`select processes where sa:zn > 0 order by pa:temperature, p:name desc`)
+	if err != nil {
+		t.Fatalf("CompileQuery failed: %s", err)
+	}
+
+	// 700 K is colder than 500 C.
+	processes, _ := EvalStatement(db, query.Selection, query.Statement)
+	var ids []int
+	for _, process := range processes {
+		ids = append(ids, process.ID)
+	}
+	if len(ids) != 4 || ids[0] != 2 || ids[1] != 1 || ids[2] != 3 || ids[3] != 4 {
+		t.Errorf("expected processes 2, 1, 3, 4, got %v", ids)
+	}
+}
+
+func TestEvalPage(t *testing.T) {
+	db := createTestDB()
+	query, err := CompileQuery(`select samples where sa:zn > 0 order by sa:zn desc limit 2`)
+	if err != nil {
+		t.Fatalf("CompileQuery failed: %s", err)
+	}
+
+	page, err := EvalPage(db, query.Selection, query.Statement, "")
+	if err != nil {
+		t.Fatalf("EvalPage failed: %s", err)
+	}
+	if names := orderedSampleNames(page.Samples); names != "S3,S2" || page.NextCursor == "" {
+		t.Fatalf("expected S3,S2 and a cursor, got %q and %q", names, page.NextCursor)
+	}
+
+	// The cursor still finds the next page when a sample returned by the first page is gone after the
+	// project's DB is reloaded, where an offset would skip S1.
+	reloaded := createTestDB()
+	reloaded.Samples = reloaded.Samples[:2]
+	next, err := EvalPage(reloaded, query.Selection, query.Statement, page.NextCursor)
+	if err != nil {
+		t.Fatalf("EvalPage with a cursor failed: %s", err)
+	}
+	if names := orderedSampleNames(next.Samples); names != "S1" || next.NextCursor != "" {
+		t.Errorf("expected S1 and no cursor, got %q and %q", names, next.NextCursor)
+	}
+
+	if _, err := EvalPage(db, query.Selection, query.Statement, "not a cursor"); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+
+	other, err := CompileQuery(`select samples where sa:zn > 0 order by sa:zn limit 2`)
+	if err != nil {
+		t.Fatalf("CompileQuery failed: %s", err)
+	}
+	if _, err := EvalPage(db, other.Selection, other.Statement, page.NextCursor); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected a cursor for another query to be invalid, got %v", err)
+	}
+}
+
+func TestEvalPageSamplesAndProcesses(t *testing.T) {
+	db := createTestDB()
+	query, err := CompileQuery(`select samples, processes where sa:zn > 0 limit 3`)
+	if err != nil {
+		t.Fatalf("CompileQuery failed: %s", err)
+	}
+
+	page, err := EvalPage(db, query.Selection, query.Statement, "")
+	if err != nil {
+		t.Fatalf("EvalPage failed: %s", err)
+	}
+	if len(page.Samples) != 3 || len(page.Processes) != 3 || page.NextCursor == "" {
+		t.Fatalf("expected 3 samples, 3 processes and a cursor, got %+v", page)
+	}
+
+	// Every sample was returned by the first page, so the next only has the last process.
+	page, err = EvalPage(db, query.Selection, query.Statement, page.NextCursor)
+	if err != nil {
+		t.Fatalf("EvalPage with a cursor failed: %s", err)
+	}
+	if len(page.Samples) != 0 || len(page.Processes) != 1 || page.Processes[0].ID != 4 || page.NextCursor != "" {
+		t.Errorf("expected only process 4, got %+v", page)
+	}
+}
+
+// orderedSampleNames returns the names of samples in the order they are in.
+func orderedSampleNames(samples []mcmodel.Entity) string {
+	var names []string
+	for _, sample := range samples {
+		names = append(names, sample.Name)
+	}
+
+	return strings.Join(names, ",")
+}
@@ -1,8 +1,21 @@
 package mqldb
 
+import "github.com/materials-commons/hydra/pkg/mql/parser"
+
 type Selection struct {
 	ProcessSelection ProcessSelection
 	SampleSelection  SampleSelection
+
+	// Aggregates, when set, are computed by EvalAggregates over the selected samples or processes, grouped
+	// by GroupBy.
+	Aggregates []parser.Aggregate
+	GroupBy    *parser.GroupBy
+
+	// OrderBy sorts the samples and processes returned, which are then sorted by ID. The first Offset of
+	// each are skipped and, when Limit isn't 0, at most Limit of the rest are returned.
+	OrderBy []parser.OrderBy
+	Limit   int
+	Offset  int
 }
 
 type ProcessSelection struct {
@@ -18,3 +31,41 @@ type SampleSelection struct {
 	ID         bool
 	Attributes []string
 }
+
+// Query is a text query compiled to the Selection and Statement that EvalStatement, or EvalAggregates for
+// an aggregate query, runs.
+type Query struct {
+	Selection Selection
+	Statement parser.Statement
+}
+
+// IsAggregate returns true for a query that computes aggregates rather than returning samples or processes.
+func (q *Query) IsAggregate() bool {
+	return len(q.Selection.Aggregates) != 0
+}
+
+// CompileQuery parses and compiles a text query such as "select samples where sa:temperature > 400 C".
+// When the query has problems the error is a parser.Errors with every problem found.
+func CompileQuery(query string) (*Query, error) {
+	selection, errs := parser.ParseQuery(query)
+	if len(errs) != 0 {
+		return nil, errs
+	}
+
+	return &Query{
+		Selection: Selection{
+			SampleSelection: SampleSelection{
+				All: selection.SelectSamples,
+			},
+			ProcessSelection: ProcessSelection{
+				All: selection.SelectProcesses,
+			},
+			Aggregates: selection.Aggregates,
+			GroupBy:    selection.GroupBy,
+			OrderBy:    selection.OrderBy,
+			Limit:      selection.Limit,
+			Offset:     selection.Offset,
+		},
+		Statement: selection.Statement,
+	}, nil
+}
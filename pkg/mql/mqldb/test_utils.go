@@ -305,29 +305,30 @@ func createTestDB() *DB {
 		},
 	}
 
-	// Now set up the mapping of processes to samples, and samples to processes
+	// Now set up the mapping of processes to samples, and samples to processes. The processes refer to the
+	// samples above, states and all, as they do when loaded from the database.
 	db.ProcessSamples = make(map[int][]*mcmodel.Entity)
 
 	// EBSD
 	db.ProcessSamples[1] = []*mcmodel.Entity{
-		{ID: 1, Name: "S1"},
-		{ID: 2, Name: "S2"},
+		&db.Samples[0],
+		&db.Samples[1],
 	}
 
 	// EBSD
 	db.ProcessSamples[2] = []*mcmodel.Entity{
-		{ID: 3, Name: "S3"},
+		&db.Samples[2],
 	}
 
 	// Texture
 	db.ProcessSamples[3] = []*mcmodel.Entity{
-		{ID: 1, Name: "S1"},
-		{ID: 2, Name: "S2"},
+		&db.Samples[0],
+		&db.Samples[1],
 	}
 
 	// Texture
 	db.ProcessSamples[4] = []*mcmodel.Entity{
-		{ID: 3, Name: "S3"},
+		&db.Samples[2],
 	}
 
 	db.SampleProcesses = make(map[int][]*mcmodel.Activity)
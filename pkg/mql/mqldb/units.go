@@ -0,0 +1,159 @@
+package mqldb
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mql/parser"
+	"github.com/materials-commons/hydra/pkg/units"
+)
+
+// CheckUnits checks the units given in the statement's matches. It returns an error for an attribute
+// match whose unit can't be converted to a unit the attribute is recorded in, either because they measure
+// different things, such as a temperature and a length, or because the match's unit isn't known. Values
+// without a unit, or in a unit that isn't known, are compared as is and so never cause an error.
+// Statements should be checked before they are evaluated, as evaluation treats values that can't be
+// converted as not matching.
+func CheckUnits(db *DB, statement parser.Statement) error {
+	switch s := statement.(type) {
+	case parser.AndStatement:
+		if err := CheckUnits(db, s.Left); err != nil {
+			return err
+		}
+		return CheckUnits(db, s.Right)
+	case parser.OrStatement:
+		if err := CheckUnits(db, s.Left); err != nil {
+			return err
+		}
+		return CheckUnits(db, s.Right)
+	case parser.NotStatement:
+		return CheckUnits(db, s.Statement)
+	case parser.MatchStatement:
+		return checkMatchUnits(db, s)
+	default:
+		return nil
+	}
+}
+
+func checkMatchUnits(db *DB, match parser.MatchStatement) error {
+	if match.Unit == "" {
+		return nil
+	}
+
+	var attributes []*mcmodel.Attribute
+	switch match.FieldType {
+	case parser.ProcessAttributeFieldType:
+		attributes = db.AllProcessAttributes
+	case parser.SampleAttributeFieldType:
+		attributes = db.AllSampleAttributes
+	default:
+		return fmt.Errorf("%s doesn't have a unit", match.FieldName)
+	}
+
+	for _, attr := range attributes {
+		if attr.Name != match.FieldName {
+			continue
+		}
+
+		for _, value := range attr.AttributeValues {
+			if value.Unit == match.Unit {
+				continue
+			}
+
+			if _, known := units.Lookup(value.Unit); !known {
+				continue
+			}
+
+			if err := units.Compatible(value.Unit, match.Unit); err != nil {
+				return fmt.Errorf("cannot compare %s to %v %s: %w", match.FieldName, match.Value, match.Unit, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// evalConvertedMatch evaluates a match given in a unit against an attribute value recorded in a different
+// unit. The value is converted to the match's unit before being compared. A value that can't be
+// converted, or that isn't a number, doesn't match.
+func evalConvertedMatch(value mcmodel.AttributeValue, match parser.MatchStatement) bool {
+	var values []float64
+	switch value.ValueType {
+	case mcmodel.ValueTypeInt:
+		values = []float64{float64(value.ValueInt)}
+	case mcmodel.ValueTypeFloat:
+		values = []float64{value.ValueFloat}
+	case mcmodel.ValueTypeArrayOfInt:
+		for _, v := range value.ValueArrayOfInt {
+			values = append(values, float64(v))
+		}
+	case mcmodel.ValueTypeArrayOfFloat:
+		values = value.ValueArrayOfFloat
+	default:
+		return false
+	}
+
+	converted := make([]float64, 0, len(values))
+	for _, v := range values {
+		c, err := units.Convert(v, value.Unit, match.Unit)
+		if err != nil {
+			return false
+		}
+		converted = append(converted, c)
+	}
+
+	if len(converted) == 1 && !isArrayValue(value) {
+		return evalConvertedFloatMatch(converted[0], match)
+	}
+
+	return evalArrayMatch(len(converted), match, func(i int, m parser.MatchStatement) bool {
+		return evalConvertedFloatMatch(converted[i], m)
+	})
+}
+
+// evalConvertedFloatMatch evaluates match against a value that has been converted to the match's unit.
+func evalConvertedFloatMatch(val float64, match parser.MatchStatement) bool {
+	if result, compound := evalCompoundMatch(match, func(m parser.MatchStatement) bool {
+		return evalConvertedFloatMatch(val, m)
+	}); compound {
+		return result
+	}
+
+	target, ok := matchValToFloat(match)
+	if !ok {
+		return false
+	}
+
+	return evalApproxFloatMatch(val, target, match.Operation)
+}
+
+func isArrayValue(value mcmodel.AttributeValue) bool {
+	return value.ValueType == mcmodel.ValueTypeArrayOfInt || value.ValueType == mcmodel.ValueTypeArrayOfFloat
+}
+
+// evalApproxFloatMatch compares floats allowing for the rounding that comes from converting units, so
+// 500 C = 773.15 K.
+func evalApproxFloatMatch(val1, val2 float64, operation string) bool {
+	equal := approxEqual(val1, val2)
+	switch operation {
+	case "=":
+		return equal
+	case "<>":
+		return !equal
+	case ">":
+		return !equal && val1 > val2
+	case ">=":
+		return equal || val1 > val2
+	case "<":
+		return !equal && val1 < val2
+	case "<=":
+		return equal || val1 < val2
+	default:
+		return false
+	}
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(math.Abs(a), math.Abs(b))
+}
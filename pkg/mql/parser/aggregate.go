@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The functions an Aggregate can compute.
+const (
+	AggregateCount  = "count"
+	AggregateMin    = "min"
+	AggregateMax    = "max"
+	AggregateMean   = "mean"
+	AggregateStdDev = "stddev"
+)
+
+// Aggregate summarizes the selected samples or processes. A count without a field counts the samples or
+// processes themselves. Otherwise the function is computed over the numeric values of an attribute, which
+// are converted to Unit when it is set.
+type Aggregate struct {
+	Func      string `json:"func"`
+	FieldType int    `json:"field_type,omitempty"`
+	FieldName string `json:"field_name,omitempty"`
+	Unit      string `json:"unit,omitempty"`
+}
+
+// String returns the aggregate as it is written in a query, such as mean(sa:hardness). It is also used to
+// name the aggregate's column in results.
+func (a Aggregate) String() string {
+	if a.FieldName == "" {
+		return a.Func
+	}
+
+	return fmt.Sprintf("%s(%s)", a.Func, fieldString(a.FieldType, a.FieldName))
+}
+
+// Check returns an error if the aggregate can't be computed.
+func (a Aggregate) Check() error {
+	if !IsAggregateFunc(a.Func) {
+		return fmt.Errorf("unknown aggregate %q, expected count, min, max, mean or stddev", a.Func)
+	}
+
+	if a.FieldName == "" {
+		if a.Func != AggregateCount {
+			return fmt.Errorf("%s needs an attribute", a.Func)
+		}
+		return nil
+	}
+
+	if a.FieldType != SampleAttributeFieldType && a.FieldType != ProcessAttributeFieldType {
+		return fmt.Errorf("%s can only be computed over an attribute, got %s", a.Func, fieldString(a.FieldType, a.FieldName))
+	}
+
+	return nil
+}
+
+// IsAggregateFunc returns true if name is one of the functions an Aggregate can compute.
+func IsAggregateFunc(name string) bool {
+	switch name {
+	case AggregateCount, AggregateMin, AggregateMax, AggregateMean, AggregateStdDev:
+		return true
+	default:
+		return false
+	}
+}
+
+// GroupBy splits the selected samples or processes into groups that are aggregated separately. They are
+// grouped by the value of a field, such as a sample's category or the name of a process, which is its
+// type, or by the value of an attribute. A sample or process with several values, such as a sample used
+// in more than one type of process, is in the group for each of them.
+type GroupBy struct {
+	FieldType int    `json:"field_type"`
+	FieldName string `json:"field_name"`
+}
+
+// String returns the field as it is written in a query, such as s:category.
+func (g GroupBy) String() string {
+	return fieldString(g.FieldType, g.FieldName)
+}
+
+// Check returns an error if results can't be grouped by the field.
+func (g GroupBy) Check() error {
+	switch g.FieldType {
+	case SampleFieldType, ProcessFieldType:
+		if g.FieldName != "name" && g.FieldName != "category" {
+			return fmt.Errorf("cannot group by %s, only by name, category or an attribute", g)
+		}
+		return nil
+	case SampleAttributeFieldType, ProcessAttributeFieldType:
+		if g.FieldName == "" {
+			return fmt.Errorf("group by needs an attribute name")
+		}
+		return nil
+	default:
+		return fmt.Errorf("cannot group by a field of type %d", g.FieldType)
+	}
+}
+
+// fieldString formats a field as it is written in a query.
+func fieldString(fieldType int, fieldName string) string {
+	if strings.ContainsAny(fieldName, " \t") {
+		fieldName = "'" + fieldName + "'"
+	}
+
+	switch fieldType {
+	case SampleFieldType:
+		return "s:" + fieldName
+	case ProcessFieldType:
+		return "p:" + fieldName
+	case SampleAttributeFieldType:
+		return "sa:" + fieldName
+	case ProcessAttributeFieldType:
+		return "pa:" + fieldName
+	default:
+		return fieldName
+	}
+}
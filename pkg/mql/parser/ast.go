@@ -2,21 +2,74 @@ package parser
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/materials-commons/hydra/pkg/mql/ast"
+	"github.com/materials-commons/hydra/pkg/mql/lexer"
+	"github.com/materials-commons/hydra/pkg/mql/token"
 )
 
 var ErrNoSelectionStatement = errors.New("no selection statement")
 var ErrInvalidWhereStatement = errors.New("invalid where statement")
 
+// AST2Selection converts a parsed query to a Selection. It returns ErrNoSelectionStatement when the query
+// isn't a select statement, and ErrInvalidWhereStatement when its where clause can't be run. Use Compile
+// to find out where in the query the problems are.
 func AST2Selection(query *ast.MQL) (*Selection, error) {
-	var selection Selection
+	if len(query.Statements) == 0 {
+		return nil, ErrNoSelectionStatement
+	}
+
+	if _, ok := query.Statements[0].(*ast.SelectStatement); !ok {
+		return nil, ErrNoSelectionStatement
+	}
+
+	selection, errs := Compile(query)
+	if len(errs) != 0 {
+		return nil, errors.Join(ErrInvalidWhereStatement, errs)
+	}
+
+	return selection, nil
+}
+
+// ParseQuery parses and compiles a text query, such as "select samples where sa:temperature > 400 C". It
+// returns all the syntax errors when the query can't be parsed, otherwise all the semantic errors found by
+// Compile.
+func ParseQuery(query string) (*Selection, Errors) {
+	p := New(lexer.New(query))
+	mql := p.ParseMQL()
+	if errs := p.Errors(); len(errs) != 0 {
+		return nil, errs
+	}
+
+	return Compile(mql)
+}
+
+// Compile converts a parsed query into a Selection and the Statement that is evaluated to run it. A query
+// must be a single select statement with a where clause, whose conditions are attribute matches combined
+// with and, or and not. A query can instead compute aggregates over the samples or processes it selects,
+// optionally grouped by a field or attribute. Every problem found is returned, positioned at the part of the
+// query it is about.
+func Compile(query *ast.MQL) (*Selection, Errors) {
+	c := &compiler{}
+
+	if len(query.Statements) == 0 {
+		c.errorf(token.Position{Line: 1, Column: 1}, "expected a select statement")
+		return nil, c.errors
+	}
+
 	ss, ok := query.Statements[0].(*ast.SelectStatement)
 	if !ok {
-		return nil, ErrNoSelectionStatement
+		c.errorf(statementPos(query.Statements[0]), "expected a select statement, got %s", strings.TrimSpace(query.Statements[0].String()))
+		return nil, c.errors
+	}
+
+	for _, s := range query.Statements[1:] {
+		c.errorf(statementPos(s), "only one statement can be run at a time")
 	}
 
+	var selection Selection
 	for _, s := range ss.SelectionStatements {
 		switch s.(type) {
 		case *ast.ProcessesSelectionStatement:
@@ -26,69 +79,302 @@ func AST2Selection(query *ast.MQL) (*Selection, error) {
 		}
 	}
 
-	selection.Statement = convertAstExpression(ss.WhereStatement.Expression)
+	switch {
+	case ss.WhereStatement == nil:
+		c.errorf(ss.Token.Pos, "expected a where clause saying which %s to select", selectionName(selection))
+	case ss.WhereStatement.Expression == nil:
+		c.errorf(ss.WhereStatement.Token.Pos, "expected a condition after where")
+	default:
+		selection.Statement = c.compileExpression(ss.WhereStatement.Expression)
+	}
+
+	switch {
+	case len(ss.Aggregates) != 0:
+		c.compileAggregates(ss, &selection)
+	case ss.GroupByStatement != nil:
+		c.errorf(ss.GroupByStatement.Token.Pos, "group by needs aggregates, as in select count from %s",
+			selectionName(selection))
+	}
+
+	c.compileOrdering(ss, &selection)
+
+	if len(c.errors) != 0 {
+		return nil, c.errors
+	}
 
 	return &selection, nil
 }
 
-func convertAstExpression(expression ast.Expression) Statement {
+// compileAggregates compiles the aggregates and group by clause of a query such as
+// "select count, mean(sa:hardness) from samples where ... group by s:category".
+func (c *compiler) compileAggregates(ss *ast.SelectStatement, selection *Selection) {
+	if selection.SelectSamples && selection.SelectProcesses {
+		c.errorf(ss.Token.Pos, "aggregates are computed over either samples or processes, not both")
+	}
+
+	for _, a := range ss.Aggregates {
+		aggregate := Aggregate{Func: a.Func}
+		pos := a.Token.Pos
+		if a.Attribute != nil {
+			aggregate.FieldType, aggregate.FieldName = referenceField(a.Attribute)
+			aggregate.Unit = a.Attribute.Unit
+			pos = a.Attribute.AttributeToken.Pos
+		}
+
+		if err := aggregate.Check(); err != nil {
+			c.errorf(pos, "%s", err)
+		}
+		selection.Aggregates = append(selection.Aggregates, aggregate)
+	}
+
+	if ss.GroupByStatement != nil {
+		groupBy := &GroupBy{}
+		groupBy.FieldType, groupBy.FieldName = referenceField(ss.GroupByStatement.Attribute)
+		if err := groupBy.Check(); err != nil {
+			c.errorf(ss.GroupByStatement.Attribute.AttributeToken.Pos, "%s", err)
+		}
+		selection.GroupBy = groupBy
+	}
+}
+
+// compileOrdering compiles the order by, limit and offset clauses of a select statement. They choose which
+// samples or processes are returned, so can't be used with aggregates.
+func (c *compiler) compileOrdering(ss *ast.SelectStatement, selection *Selection) {
+	if len(ss.Aggregates) != 0 {
+		if ss.OrderByStatement != nil {
+			c.errorf(ss.OrderByStatement.Token.Pos, "order by can't be used with aggregates")
+		}
+		if ss.LimitStatement != nil {
+			c.errorf(ss.LimitStatement.Token.Pos, "limit can't be used with aggregates")
+		}
+		if ss.OffsetStatement != nil {
+			c.errorf(ss.OffsetStatement.Token.Pos, "offset can't be used with aggregates")
+		}
+		return
+	}
+
+	if ss.OrderByStatement != nil {
+		for _, o := range ss.OrderByStatement.Orderings {
+			orderBy := OrderBy{Descending: o.Descending}
+			orderBy.FieldType, orderBy.FieldName = referenceField(o.Attribute)
+			if err := orderBy.Check(); err != nil {
+				c.errorf(o.Attribute.AttributeToken.Pos, "%s", err)
+			}
+			selection.OrderBy = append(selection.OrderBy, orderBy)
+		}
+	}
+
+	if ss.LimitStatement != nil {
+		if selection.Limit = int(ss.LimitStatement.Value.Value); selection.Limit < 1 {
+			c.errorf(ss.LimitStatement.Value.Token.Pos, "limit must be at least 1")
+		}
+	}
+
+	if ss.OffsetStatement != nil {
+		selection.Offset = int(ss.OffsetStatement.Value.Value)
+	}
+}
+
+// compiler collects the semantic errors found while compiling a query.
+type compiler struct {
+	errors Errors
+}
+
+func (c *compiler) errorf(pos token.Position, format string, args ...interface{}) {
+	c.errors = append(c.errors, &Error{Kind: SemanticError, Message: fmt.Sprintf(format, args...), Pos: pos})
+}
+
+func (c *compiler) compileExpression(expression ast.Expression) Statement {
 	switch e := expression.(type) {
 	case *ast.InfixExpression:
-		return convertAstInfixExpression(e)
+		return c.compileInfixExpression(e)
 	case *ast.SampleAttributeIdentifier:
-		return sampleAttributeIdentifier2MatchStatement(e)
+		return c.compileMatch(sampleAttributeIdentifier2MatchStatement(e), e.OperatorToken, e.ValueToken, e.Values)
 	case *ast.ProcessAttributeIdentifier:
-		return processAttributeIdentifier2MatchStatement(e)
+		return c.compileMatch(processAttributeIdentifier2MatchStatement(e), e.OperatorToken, e.ValueToken, e.Values)
+	case *ast.PrefixExpression:
+		switch strings.ToLower(e.Operator) {
+		case "not", "!":
+			return NotStatement{Statement: c.compileExpression(e.Right)}
+		default:
+			c.errorf(e.Token.Pos, "%s is not supported in a condition", e.Operator)
+			return nil
+		}
+	case nil:
+		return nil
 	default:
+		c.errorf(expressionPos(e), "expected a condition such as sa:temperature > 400, got %s", e.String())
 		return nil
 	}
 }
 
-func processAttributeIdentifier2MatchStatement(ai *ast.ProcessAttributeIdentifier) MatchStatement {
-	m := MatchStatement{}
-	switch ai.Attribute {
-	case "name":
-		m.FieldType = ProcessFieldType
+func (c *compiler) compileInfixExpression(ie *ast.InfixExpression) Statement {
+	switch strings.ToLower(ie.Operator) {
+	case "and":
+		statement := AndStatement{}
+		statement.Left = c.compileExpression(ie.Left)
+		statement.Right = c.compileExpression(ie.Right)
+		return statement
+	case "or":
+		statement := OrStatement{}
+		statement.Left = c.compileExpression(ie.Left)
+		statement.Right = c.compileExpression(ie.Right)
+		return statement
 	default:
-		m.FieldType = ProcessAttributeFieldType
+		c.errorf(ie.Token.Pos, "conditions are combined with and or or, not %s", ie.Operator)
+		return nil
+	}
+}
+
+// checkMatch checks that the value in an attribute match can be compared with its operator. Strings can
+// only be compared for equality.
+func (c *compiler) checkMatch(attribute string, operator, value token.Token, values []token.Token) {
+	switch operator.Type {
+	case token.LT, token.LTEQ, token.GT, token.GTEQ:
+		if !isNumber(value) {
+			c.errorf(value.Pos, "%s %s needs a number, got %s", attribute, operator.Literal, describe(value))
+		}
+	case token.BETWEEN:
+		for _, v := range values {
+			if !isNumber(v) {
+				c.errorf(v.Pos, "%s between needs numbers, got %s", attribute, describe(v))
+			}
+		}
+	case token.LIKE, token.MATCHES:
+		if value.Type != token.STRING && value.Type != token.IDENT {
+			c.errorf(value.Pos, "%s %s needs a pattern, got %s", attribute, operator.Literal, describe(value))
+		}
+	}
+}
+
+// compileMatch checks match, which was parsed from the operator and value or values tokens, and compiles
+// its pattern.
+func (c *compiler) compileMatch(match MatchStatement, operator, value token.Token, values []token.Token) Statement {
+	errorCount := len(c.errors)
+	c.checkMatch(match.FieldName, operator, value, values)
+	if len(c.errors) != errorCount {
+		return match
+	}
+
+	match, err := PrepareMatch(match)
+	if err != nil {
+		c.errorf(value.Pos, "%s", err)
+	}
+
+	return match
+}
+
+func isNumber(tok token.Token) bool {
+	return tok.Type == token.INT || tok.Type == token.FLOAT
+}
+
+// matchValue returns the value of a match parsed from value or, for an in or between match, values.
+func matchValue(value string, values []token.Token) interface{} {
+	if len(values) == 0 {
+		return value
+	}
+
+	list := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		list = append(list, v.Literal)
 	}
 
+	return list
+}
+
+func sampleAttributeIdentifier2MatchStatement(ai *ast.SampleAttributeIdentifier) MatchStatement {
+	m := MatchStatement{}
+	m.FieldType = sampleFieldType(ai.Attribute)
 	m.FieldName = ai.Attribute
-	m.Value = ai.Value
+	m.Value = matchValue(ai.Value, ai.Values)
+	m.Unit = ai.Unit
 	m.Operation = ai.Operator
 
 	return m
 }
 
-func sampleAttributeIdentifier2MatchStatement(ai *ast.SampleAttributeIdentifier) MatchStatement {
+func processAttributeIdentifier2MatchStatement(ai *ast.ProcessAttributeIdentifier) MatchStatement {
 	m := MatchStatement{}
-	switch ai.Attribute {
-	case "name":
-		m.FieldType = SampleFieldType
-	default:
-		m.FieldType = SampleAttributeFieldType
-	}
-
+	m.FieldType = processFieldType(ai.Attribute)
 	m.FieldName = ai.Attribute
-	m.Value = ai.Value
+	m.Value = matchValue(ai.Value, ai.Values)
+	m.Unit = ai.Unit
 	m.Operation = ai.Operator
 
 	return m
 }
 
-func convertAstInfixExpression(ie *ast.InfixExpression) Statement {
-	switch strings.ToLower(ie.Operator) {
-	case "and":
-		statement := AndStatement{}
-		statement.Left = convertAstExpression(ie.Left)
-		statement.Right = convertAstExpression(ie.Right)
-		return statement
-	case "or":
-		statement := OrStatement{}
-		statement.Left = convertAstExpression(ie.Left)
-		statement.Right = convertAstExpression(ie.Right)
-		return statement
+// sampleFieldType returns whether name, after s: or sa:, is one of a sample's fields or is an attribute.
+func sampleFieldType(name string) int {
+	switch name {
+	case "name", "category":
+		return SampleFieldType
 	default:
-		return nil
+		return SampleAttributeFieldType
+	}
+}
+
+// processFieldType returns whether name, after p: or pa:, is one of a process's fields or is an attribute.
+func processFieldType(name string) int {
+	switch name {
+	case "name", "category":
+		return ProcessFieldType
+	default:
+		return ProcessAttributeFieldType
+	}
+}
+
+// referenceField returns the field type and name of a field or attribute named outside a match.
+func referenceField(r *ast.AttributeReference) (int, string) {
+	if r.Token.Type == token.PROCESS_ATTR {
+		return processFieldType(r.Attribute), r.Attribute
+	}
+
+	return sampleFieldType(r.Attribute), r.Attribute
+}
+
+// selectionName describes what a query selects, for error messages.
+func selectionName(selection Selection) string {
+	switch {
+	case selection.SelectSamples && selection.SelectProcesses:
+		return "samples and processes"
+	case selection.SelectProcesses:
+		return "processes"
+	default:
+		return "samples"
+	}
+}
+
+// statementPos returns where a statement starts in the query.
+func statementPos(statement ast.Statement) token.Position {
+	switch s := statement.(type) {
+	case *ast.SelectStatement:
+		return s.Token.Pos
+	case *ast.ExpressionStatement:
+		return s.Token.Pos
+	case *ast.ExecuteStatement:
+		return s.Token.Pos
+	default:
+		return token.Position{}
+	}
+}
+
+// expressionPos returns the position of the token an expression was parsed from.
+func expressionPos(expression ast.Expression) token.Position {
+	switch e := expression.(type) {
+	case *ast.IntegerLiteral:
+		return e.Token.Pos
+	case *ast.FloatLiteral:
+		return e.Token.Pos
+	case *ast.StringLiteral:
+		return e.Token.Pos
+	case *ast.BooleanLiteral:
+		return e.Token.Pos
+	case *ast.PrefixExpression:
+		return e.Token.Pos
+	case *ast.InfixExpression:
+		return e.Token.Pos
+	default:
+		return token.Position{}
 	}
 }
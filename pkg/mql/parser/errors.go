@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/materials-commons/hydra/pkg/mql/token"
+)
+
+// Kinds of Error.
+const (
+	// SyntaxError is a query that can't be parsed.
+	SyntaxError = "syntax"
+
+	// SemanticError is a query that parses, but can't be run.
+	SemanticError = "semantic"
+)
+
+// Error is a problem found in a query. Pos is where in the query the problem is, it has a zero Line
+// when the problem isn't at a single place in the query.
+type Error struct {
+	Kind    string         `json:"kind"`
+	Message string         `json:"message"`
+	Pos     token.Position `json:"position"`
+}
+
+func (e *Error) Error() string {
+	if e.Pos.Line == 0 {
+		return fmt.Sprintf("%s error: %s", e.Kind, e.Message)
+	}
+
+	return fmt.Sprintf("%s error at %s: %s", e.Kind, e.Pos, e.Message)
+}
+
+// Errors are all the problems found in a query.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// describe returns how tok is shown in an error message.
+func describe(tok token.Token) string {
+	if tok.Type == token.EOF {
+		return "end of query"
+	}
+
+	return fmt.Sprintf("%q", tok.Literal)
+}
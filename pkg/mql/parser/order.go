@@ -0,0 +1,40 @@
+package parser
+
+import "fmt"
+
+// OrderBy sorts the selected samples or processes by a field, such as a sample's name, or by an
+// attribute. A sample or process with several values, such as a sample whose states have different
+// hardnesses, is sorted by the smallest of them in ascending order and by the largest in descending order.
+// Those without any value come last in either direction.
+type OrderBy struct {
+	FieldType  int    `json:"field_type"`
+	FieldName  string `json:"field_name"`
+	Descending bool   `json:"descending,omitempty"`
+}
+
+// String returns the ordering as it is written in a query, such as sa:hardness desc.
+func (o OrderBy) String() string {
+	if o.Descending {
+		return fieldString(o.FieldType, o.FieldName) + " desc"
+	}
+
+	return fieldString(o.FieldType, o.FieldName)
+}
+
+// Check returns an error if results can't be sorted by the field.
+func (o OrderBy) Check() error {
+	switch o.FieldType {
+	case SampleFieldType, ProcessFieldType:
+		if o.FieldName != "name" && o.FieldName != "category" {
+			return fmt.Errorf("cannot order by %s, only by name, category or an attribute", fieldString(o.FieldType, o.FieldName))
+		}
+		return nil
+	case SampleAttributeFieldType, ProcessAttributeFieldType:
+		if o.FieldName == "" {
+			return fmt.Errorf("order by needs an attribute name")
+		}
+		return nil
+	default:
+		return fmt.Errorf("cannot order by a field of type %d", o.FieldType)
+	}
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/materials-commons/hydra/pkg/mql/ast"
 	"github.com/materials-commons/hydra/pkg/mql/lexer"
@@ -45,7 +46,7 @@ type (
 
 type Parser struct {
 	l              *lexer.Lexer
-	errors         []string
+	errors         Errors
 	curToken       token.Token
 	peekToken      token.Token
 	prefixParseFns map[token.TokenType]prefixParseFn
@@ -53,7 +54,7 @@ type Parser struct {
 }
 
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, errors: Errors{}}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
@@ -75,10 +76,12 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.SAMPLE_ATTR, p.parseSampleAttrFunc)
 	p.registerPrefix(token.PROCESS_ATTR, p.parseProcessAttrFunc)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
+	p.registerPrefix(token.NOT, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 
 	// Infix
 	p.registerInfix(token.EQUAL, p.parseInfixExpression)
+	p.registerInfix(token.NOTEQ, p.parseInfixExpression)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.AND, p.parseInfixExpression)
 	p.registerInfix(token.OR, p.parseInfixExpression)
@@ -94,14 +97,25 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// Errors returns the syntax errors found by ParseMQL.
+func (p *Parser) Errors() Errors {
+	return p.errors
+}
+
 func (p *Parser) ParseMQL() *ast.MQL {
 	mqlProgram := &ast.MQL{}
 	mqlProgram.Statements = []ast.Statement{}
 	for p.curToken.Type != token.EOF {
+		errorCount := len(p.errors)
 		stmt := p.parseStatement()
 		if stmt != nil {
 			mqlProgram.Statements = append(mqlProgram.Statements, stmt)
 		}
+
+		// The rest of a statement with an error would only give confusing errors of its own.
+		if len(p.errors) != errorCount {
+			p.skipStatement()
+		}
 		p.nextToken()
 	}
 
@@ -120,20 +134,258 @@ func (p *Parser) parseStatement() ast.Statement {
 	}
 }
 
+// skipStatement moves to the semicolon at the end of the current statement.
+func (p *Parser) skipStatement() {
+	for !p.curTokenIs(token.SEMICOLON) && !p.curTokenIs(token.EOF) {
+		p.nextToken()
+	}
+}
+
 func (p *Parser) parseSelectStatement() ast.Statement {
 	statement := &ast.SelectStatement{Token: p.curToken, SelectionStatements: []ast.Statement{}}
-	if !p.peekTokenIs(token.SAMPLES) && !p.peekTokenIs(token.PROCESSES) {
+	if p.peekTokenIs(token.IDENT) {
+		// An aggregate query, such as "select count, mean(sa:hardness) from samples where ...".
+		p.nextToken()
+		if statement.Aggregates = p.parseAggregates(); statement.Aggregates == nil {
+			return nil
+		}
+
+		if !p.peekTokenIs(token.FROM) {
+			p.appendErrorAt(p.peekToken.Pos, "expected , or from after %s, got %s", p.curToken.Literal, describe(p.peekToken))
+			return nil
+		}
+		p.nextToken()
+
+		if !p.peekTokenIs(token.SAMPLES) && !p.peekTokenIs(token.PROCESSES) {
+			p.appendErrorAt(p.peekToken.Pos, "expected samples or processes after from, got %s", describe(p.peekToken))
+			return nil
+		}
+	} else if !p.peekTokenIs(token.SAMPLES) && !p.peekTokenIs(token.PROCESSES) {
+		p.appendErrorAt(p.peekToken.Pos, "expected samples or processes after select, got %s", describe(p.peekToken))
 		return nil
 	}
 	p.nextToken()
 	statement.SelectionStatements = p.parseSelectionStatement()
-	if p.curTokenIs(token.WHERE) {
+	switch {
+	case p.curTokenIs(token.WHERE):
 		statement.WhereStatement = p.parseWhereStatement()
+		if isClause(p.peekToken) {
+			p.nextToken()
+			p.parseClauses(statement)
+		}
+	case isClause(p.curToken):
+		p.parseClauses(statement)
+	case !p.curTokenIs(token.SEMICOLON) && !p.curTokenIs(token.EOF):
+		p.appendError("expected where, got %s", describe(p.curToken))
+	}
+
+	return statement
+}
+
+// isClause returns true if tok starts one of the clauses that can follow the where clause.
+func isClause(tok token.Token) bool {
+	switch tok.Type {
+	case token.GROUP, token.ORDER, token.LIMIT, token.OFFSET:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseClauses parses the group by, order by, limit and offset clauses at the end of a select statement.
+// They can be given in any order, but only once each.
+func (p *Parser) parseClauses(statement *ast.SelectStatement) {
+	for {
+		clause := p.curToken
+		switch {
+		case p.curTokenIs(token.GROUP) && statement.GroupByStatement == nil:
+			statement.GroupByStatement = p.parseGroupByStatement()
+			if statement.GroupByStatement == nil {
+				return
+			}
+		case p.curTokenIs(token.ORDER) && statement.OrderByStatement == nil:
+			statement.OrderByStatement = p.parseOrderByStatement()
+			if statement.OrderByStatement == nil {
+				return
+			}
+		case p.curTokenIs(token.LIMIT) && statement.LimitStatement == nil:
+			value := p.parseClauseInteger()
+			if value == nil {
+				return
+			}
+			statement.LimitStatement = &ast.LimitStatement{Token: clause, Value: value}
+		case p.curTokenIs(token.OFFSET) && statement.OffsetStatement == nil:
+			value := p.parseClauseInteger()
+			if value == nil {
+				return
+			}
+			statement.OffsetStatement = &ast.OffsetStatement{Token: clause, Value: value}
+		default:
+			p.appendError("%s can only be given once", clause.Literal)
+			return
+		}
+
+		if !isClause(p.peekToken) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.peekTokenIs(token.SEMICOLON) && !p.peekTokenIs(token.EOF) {
+		p.appendErrorAt(p.peekToken.Pos, "expected the end of the query, got %s", describe(p.peekToken))
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+}
+
+// parseAggregates parses the list of aggregates in a select statement, such as "count, mean(sa:hardness C)".
+// It returns nil if any of them can't be parsed.
+func (p *Parser) parseAggregates() []*ast.AggregateExpression {
+	var aggregates []*ast.AggregateExpression
+	for {
+		aggregate := &ast.AggregateExpression{Token: p.curToken, Func: strings.ToLower(p.curToken.Literal)}
+		if !IsAggregateFunc(aggregate.Func) {
+			p.appendError("expected samples, processes or an aggregate such as count or mean after select, got %s",
+				describe(p.curToken))
+			return nil
+		}
+
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			if p.peekTokenIs(token.RPAREN) {
+				// count() is the same as count.
+				p.nextToken()
+			} else {
+				if !p.peekTokenIs(token.SAMPLE_ATTR) && !p.peekTokenIs(token.PROCESS_ATTR) {
+					p.appendErrorAt(p.peekToken.Pos, "expected an attribute such as sa:hardness in %s, got %s",
+						aggregate.Func, describe(p.peekToken))
+					return nil
+				}
+				p.nextToken()
+
+				if aggregate.Attribute = p.parseAttributeReference(true); aggregate.Attribute == nil {
+					return nil
+				}
+
+				if !p.peekTokenIs(token.RPAREN) {
+					p.appendErrorAt(p.peekToken.Pos, "expected ) after %s, got %s", aggregate.Attribute, describe(p.peekToken))
+					return nil
+				}
+				p.nextToken()
+			}
+		}
+
+		aggregates = append(aggregates, aggregate)
+		if !p.peekTokenIs(token.COMMA) {
+			return aggregates
+		}
+
+		p.nextToken()
+		p.nextToken()
+	}
+}
+
+// parseGroupByStatement parses "group by" and the field or attribute to group by.
+func (p *Parser) parseGroupByStatement() *ast.GroupByStatement {
+	statement := &ast.GroupByStatement{Token: p.curToken}
+	if !p.peekTokenIs(token.BY) {
+		p.appendErrorAt(p.peekToken.Pos, "expected by after group, got %s", describe(p.peekToken))
+		return nil
+	}
+	p.nextToken()
+
+	if !p.peekTokenIs(token.SAMPLE_ATTR) && !p.peekTokenIs(token.PROCESS_ATTR) {
+		p.appendErrorAt(p.peekToken.Pos, "expected a field or attribute such as s:category to group by, got %s",
+			describe(p.peekToken))
+		return nil
+	}
+	p.nextToken()
+
+	if statement.Attribute = p.parseAttributeReference(false); statement.Attribute == nil {
+		return nil
 	}
 
 	return statement
 }
 
+// parseOrderByStatement parses an order by clause, such as "order by sa:hardness desc, s:name". Each field
+// or attribute is sorted in ascending order unless it is followed by desc.
+func (p *Parser) parseOrderByStatement() *ast.OrderByStatement {
+	statement := &ast.OrderByStatement{Token: p.curToken}
+	if !p.peekTokenIs(token.BY) {
+		p.appendErrorAt(p.peekToken.Pos, "expected by after order, got %s", describe(p.peekToken))
+		return nil
+	}
+	p.nextToken()
+
+	for {
+		if !p.peekTokenIs(token.SAMPLE_ATTR) && !p.peekTokenIs(token.PROCESS_ATTR) {
+			p.appendErrorAt(p.peekToken.Pos, "expected a field or attribute such as sa:hardness to order by, got %s",
+				describe(p.peekToken))
+			return nil
+		}
+		p.nextToken()
+
+		ordering := &ast.Ordering{}
+		if ordering.Attribute = p.parseAttributeReference(false); ordering.Attribute == nil {
+			return nil
+		}
+
+		switch {
+		case p.peekTokenIs(token.ASC):
+			p.nextToken()
+		case p.peekTokenIs(token.DESC):
+			p.nextToken()
+			ordering.Descending = true
+		}
+
+		statement.Orderings = append(statement.Orderings, ordering)
+		if !p.peekTokenIs(token.COMMA) {
+			return statement
+		}
+		p.nextToken()
+	}
+}
+
+// parseClauseInteger parses the number after limit or offset.
+func (p *Parser) parseClauseInteger() *ast.IntegerLiteral {
+	if !p.peekTokenIs(token.INT) {
+		p.appendErrorAt(p.peekToken.Pos, "expected a number after %s, got %s", p.curToken.Literal, describe(p.peekToken))
+		return nil
+	}
+	p.nextToken()
+
+	literal, ok := p.parseIntegerLiteral().(*ast.IntegerLiteral)
+	if !ok {
+		return nil
+	}
+
+	return literal
+}
+
+// parseAttributeReference parses a field or attribute such as sa:hardness, which is followed by a unit when
+// withUnit is true and one is given.
+func (p *Parser) parseAttributeReference(withUnit bool) *ast.AttributeReference {
+	reference := &ast.AttributeReference{Token: p.curToken}
+	if !p.peekTokenIs(token.IDENT) {
+		p.appendErrorAt(p.peekToken.Pos, "expected an attribute name after %s, got %s", p.curToken.Literal,
+			describe(p.peekToken))
+		return nil
+	}
+	p.nextToken()
+
+	reference.Attribute = p.curToken.Literal
+	reference.AttributeToken = p.curToken
+	if withUnit && p.peekTokenIs(token.IDENT) {
+		p.nextToken()
+		reference.Unit = p.curToken.Literal
+	}
+
+	return reference
+}
+
 func (p *Parser) parseSelectionStatement() []ast.Statement {
 	var selectionStatements []ast.Statement
 	for {
@@ -159,6 +411,11 @@ func (p *Parser) parseWhereStatement() *ast.WhereStatement {
 
 	whereStatement.Expression = p.parseExpression(LOWEST)
 
+	if whereStatement.Expression != nil && !p.peekTokenIs(token.SEMICOLON) && !p.peekTokenIs(token.EOF) &&
+		!isClause(p.peekToken) {
+		p.appendErrorAt(p.peekToken.Pos, "expected and, or or the end of the query, got %s", describe(p.peekToken))
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -177,11 +434,9 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
-	//fmt.Printf("parseExpression p.curToken.Type = %d/%s\n", p.curToken.Type, p.curToken.Literal)
 	prefixFn := p.prefixParseFns[p.curToken.Type]
 	if prefixFn == nil {
-		fmt.Printf("No function found for %d/%s\n", p.curToken.Type, p.curToken.Literal)
-		p.appendError("no prefix parse function for %s found", token.TokenToStr(p.curToken.Type))
+		p.appendError("unexpected %s", describe(p.curToken))
 		return nil
 	}
 
@@ -201,27 +456,157 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 }
 
 func (p *Parser) parseSampleAttrFunc() ast.Expression {
-	attribute, operator, value := p.parseAttribute()
-	return &ast.SampleAttributeIdentifier{Token: p.curToken, Attribute: attribute, Operator: operator, Value: value}
+	a := p.parseAttribute()
+	return &ast.SampleAttributeIdentifier{Token: p.curToken, Attribute: a.attribute, Operator: a.operator.Literal,
+		Value: a.value.Literal, Values: a.values, Unit: a.unit, OperatorToken: a.operator, ValueToken: a.value}
 }
 
 func (p *Parser) parseProcessAttrFunc() ast.Expression {
-	attribute, operator, value := p.parseAttribute()
-	return &ast.ProcessAttributeIdentifier{Token: p.curToken, Attribute: attribute, Operator: operator, Value: value}
-}
+	a := p.parseAttribute()
+	return &ast.ProcessAttributeIdentifier{Token: p.curToken, Attribute: a.attribute, Operator: a.operator.Literal,
+		Value: a.value.Literal, Values: a.values, Unit: a.unit, OperatorToken: a.operator, ValueToken: a.value}
+}
+
+// attributeMatch is the parts of an attribute match. An in or between match has values rather than a
+// value.
+type attributeMatch struct {
+	attribute string
+	operator  token.Token
+	value     token.Token
+	values    []token.Token
+	unit      string
+}
+
+// comparisonOperators are the operators an attribute can be compared to a single value with.
+var comparisonOperators = map[token.TokenType]bool{
+	token.EQUAL:   true,
+	token.NOTEQ:   true,
+	token.LT:      true,
+	token.LTEQ:    true,
+	token.GT:      true,
+	token.GTEQ:    true,
+	token.LIKE:    true,
+	token.MATCHES: true,
+}
+
+// valueTokens are the tokens that can be an attribute match's value.
+var valueTokens = map[token.TokenType]bool{
+	token.INT:    true,
+	token.FLOAT:  true,
+	token.STRING: true,
+	token.IDENT:  true,
+	token.TRUE:   true,
+	token.FALSE:  true,
+}
+
+// parseAttribute parses an attribute match such as "temperature > 500 C", "phase in (alpha, beta)" or
+// "temperature between 400 C and 500 C". A negative number is written with a leading minus, and numbers can
+// be followed by a unit. Units that aren't a plain identifier are quoted, as in 'wt%'.
+func (p *Parser) parseAttribute() attributeMatch {
+	var a attributeMatch
+	keyword := p.curToken.Literal
 
-func (p *Parser) parseAttribute() (string, string, string) {
 	p.nextToken()
-	attribute := p.curToken.Literal
+	a.attribute = p.curToken.Literal
+	if !p.curTokenIs(token.IDENT) {
+		p.appendError("expected an attribute name after %s, got %s", keyword, describe(p.curToken))
+		return a
+	}
+
+	p.nextToken()
+	a.operator = p.curToken
+	switch {
+	case p.curTokenIs(token.IN):
+		p.parseInList(&a)
+	case p.curTokenIs(token.BETWEEN):
+		p.parseBetween(&a)
+	case comparisonOperators[p.curToken.Type]:
+		p.nextToken()
+		a.value, _ = p.parseValue(&a)
+	default:
+		p.appendError("expected a comparison such as = or > after %s, got %s", a.attribute, describe(p.curToken))
+	}
+
+	return a
+}
+
+// parseInList parses the list of values in "in (a, b, c)".
+func (p *Parser) parseInList(a *attributeMatch) {
+	if !p.expectPeek(token.LPAREN) {
+		return
+	}
+
+	for {
+		p.nextToken()
+		value, ok := p.parseValue(a)
+		if !ok {
+			return
+		}
+		a.values = append(a.values, value)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	p.expectPeek(token.RPAREN)
+}
+
+// parseBetween parses the low and high values in "between low and high".
+func (p *Parser) parseBetween(a *attributeMatch) {
 	p.nextToken()
-	operator := p.curToken.Literal
+	low, ok := p.parseValue(a)
+	if !ok {
+		return
+	}
+
+	if !p.expectPeek(token.AND) {
+		return
+	}
+
 	p.nextToken()
-	value := p.curToken.Literal
-	return attribute, operator, value
+	high, ok := p.parseValue(a)
+	if !ok {
+		return
+	}
+
+	a.values = []token.Token{low, high}
+}
+
+// parseValue parses the value at the current token, along with a negative sign before it and a unit after
+// it. When a match has several values their units must be the same.
+func (p *Parser) parseValue(a *attributeMatch) (token.Token, bool) {
+	value := p.curToken
+	if p.curTokenIs(token.MINUS) && (p.peekTokenIs(token.INT) || p.peekTokenIs(token.FLOAT)) {
+		p.nextToken()
+		value.Type = p.curToken.Type
+		value.Literal = "-" + p.curToken.Literal
+	}
+
+	if !valueTokens[value.Type] {
+		p.appendErrorAt(value.Pos, "expected a value to compare %s to, got %s", a.attribute, describe(value))
+		return value, false
+	}
+
+	if (p.curTokenIs(token.INT) || p.curTokenIs(token.FLOAT)) && p.peekTokenIs(token.IDENT) {
+		p.nextToken()
+		if a.unit != "" && a.unit != p.curToken.Literal {
+			p.appendError("expected all the values for %s to be in %s, got %s", a.attribute, a.unit, p.curToken.Literal)
+			return value, false
+		}
+		a.unit = p.curToken.Literal
+	}
+
+	return value, true
 }
 
 func (p *Parser) appendError(msg string, args ...interface{}) {
-	p.errors = append(p.errors, fmt.Sprintf(msg, args...))
+	p.appendErrorAt(p.curToken.Pos, msg, args...)
+}
+
+func (p *Parser) appendErrorAt(pos token.Position, msg string, args ...interface{}) {
+	p.errors = append(p.errors, &Error{Kind: SyntaxError, Message: fmt.Sprintf(msg, args...), Pos: pos})
 }
 
 func (p *Parser) registerPrefix(t token.TokenType, fn prefixParseFn) {
@@ -331,8 +716,8 @@ func (p *Parser) getPrecedence(t token.TokenType) int {
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	p.errors = append(p.errors, fmt.Sprintf("Expect next token to be %s, got %s instead", token.TokenToStr(t),
-		token.TokenToStr(p.peekToken.Type)))
+	p.appendErrorAt(p.peekToken.Pos, "Expect next token to be %s, got %s instead", token.TokenToStr(t),
+		token.TokenToStr(p.peekToken.Type))
 }
 
 func (p *Parser) parseAndExpression(expression ast.Expression) ast.Expression {
@@ -345,25 +730,33 @@ func (p *Parser) parseAndExpression(expression ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseSamplesLiteral() ast.Expression {
+	p.appendError("unexpected %s", describe(p.curToken))
 	return nil
 }
 
 func (p *Parser) parseProcessesLiteral() ast.Expression {
+	p.appendError("unexpected %s", describe(p.curToken))
 	return nil
 }
 
 func (p *Parser) parseSampleHasAttributeFunc() ast.Expression {
-	return nil
+	return p.unsupported()
 }
 
 func (p *Parser) parseSampleHasProcessFunc() ast.Expression {
-	return nil
+	return p.unsupported()
 }
 
 func (p *Parser) parseProcessHasAttributeFunc() ast.Expression {
-	return nil
+	return p.unsupported()
 }
 
 func (p *Parser) parseProcessHasSampleFunc() ast.Expression {
+	return p.unsupported()
+}
+
+// unsupported reports the current token as something the parser doesn't handle yet.
+func (p *Parser) unsupported() ast.Expression {
+	p.appendError("%s is not supported yet", p.curToken.Literal)
 	return nil
 }
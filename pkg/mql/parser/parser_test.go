@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/materials-commons/hydra/pkg/mql/ast"
@@ -378,3 +379,290 @@ func parseForTest(t *testing.T, input string, length int) *ast.MQL {
 	}
 	return mql
 }
+
+func TestAttributeValueUnits(t *testing.T) {
+	tests := []struct {
+		input string
+		value string
+		unit  string
+	}{
+		{`select samples where sa:temperature > 500 C`, "500", "C"},
+		{`select samples where sa:thickness <= 0.5 mm`, "0.5", "mm"},
+		{`select samples where sa:temperature > -40 F`, "-40", "F"},
+		{`select samples where sa:energy = 1.5e-3 eV`, "1.5e-3", "eV"},
+		{`select samples where sa:zinc >= 2 'wt%'`, "2", "wt%"},
+		{`select samples where sa:temperature > 500`, "500", ""},
+		{`select samples where sa:alloy = zn45`, "zn45", ""},
+	}
+
+	for _, test := range tests {
+		mql := parseForTest(t, test.input, 1)
+		s, err := AST2Selection(mql)
+		if err != nil {
+			t.Fatalf("%s: AST2Selection failed: %s", test.input, err)
+		}
+
+		match, ok := s.Statement.(MatchStatement)
+		if !ok {
+			t.Fatalf("%s: expected MatchStatement, got %T", test.input, s.Statement)
+		}
+
+		if match.Value != test.value || match.Unit != test.unit {
+			t.Errorf("%s: expected value %q unit %q, got value %q unit %q", test.input, test.value, test.unit, match.Value, match.Unit)
+		}
+	}
+}
+
+func TestAttributeValueUnitsWithLogicalOperators(t *testing.T) {
+	input := `select samples where sa:temperature > 500 C and pa:time < 2 h`
+	s, err := AST2Selection(parseForTest(t, input, 1))
+	if err != nil {
+		t.Fatalf("AST2Selection failed: %s", err)
+	}
+
+	and, ok := s.Statement.(AndStatement)
+	if !ok {
+		t.Fatalf("expected AndStatement, got %T", s.Statement)
+	}
+
+	if left := and.Left.(MatchStatement); left.Unit != "C" {
+		t.Errorf("expected left unit C, got %q", left.Unit)
+	}
+
+	if right := and.Right.(MatchStatement); right.Unit != "h" || right.Value != "2" {
+		t.Errorf("expected right 2 h, got %v %q", right.Value, right.Unit)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	selection, errs := ParseQuery(`select samples, processes where sa:temperature > 400 C and (pa:time < 2 h or sa:name = "S1")`)
+	if len(errs) != 0 {
+		t.Fatalf("ParseQuery failed: %s", errs)
+	}
+
+	if !selection.SelectSamples || !selection.SelectProcesses {
+		t.Fatalf("Expected samples and processes to be selected, got %+v", selection)
+	}
+
+	and, ok := selection.Statement.(AndStatement)
+	if !ok {
+		t.Fatalf("expected AndStatement, got %T", selection.Statement)
+	}
+
+	if _, ok := and.Right.(OrStatement); !ok {
+		t.Fatalf("expected OrStatement, got %T", and.Right)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		kind   string
+		line   int
+		column int
+	}{
+		{`select where sa:a = 1`, SyntaxError, 1, 8},
+		{`select samples sa:a = 1`, SyntaxError, 1, 16},
+		{`select samples where sa:a 1`, SyntaxError, 1, 27},
+		{`select samples where sa:a =`, SyntaxError, 1, 28},
+		{"select samples\nwhere sa:a = 1 sa:b = 2", SyntaxError, 2, 16},
+		{`select samples where (sa:a = 1`, SyntaxError, 1, 31},
+		{`select samples`, SemanticError, 1, 1},
+		{`select samples where sa:a = 1; select processes where pa:b = 2`, SemanticError, 1, 32},
+		{`select samples where sa:a = 1 = 2`, SemanticError, 1, 31},
+		{"select samples where\n  sa:name > S1", SemanticError, 2, 13},
+		{`sa:a = 1`, SemanticError, 1, 1},
+		{`select samples where sa:a matches "(zn"`, SemanticError, 1, 35},
+		{`select samples where sa:a like 5`, SemanticError, 1, 32},
+		{`select samples where sa:a in ()`, SyntaxError, 1, 31},
+		{`select samples where sa:a in (1, 2`, SyntaxError, 1, 35},
+		{`select samples where sa:a between 1 2`, SyntaxError, 1, 37},
+		{`select samples where sa:a between low and 2`, SemanticError, 1, 35},
+		{`select total from samples where sa:a = 1`, SyntaxError, 1, 8},
+		{`select count samples where sa:a = 1`, SyntaxError, 1, 14},
+		{`select mean(hardness) from samples where sa:a = 1`, SyntaxError, 1, 13},
+		{`select mean(sa:hardness from samples where sa:a = 1`, SyntaxError, 1, 25},
+		{`select count from samples where sa:a = 1 group s:category`, SyntaxError, 1, 48},
+		{`select count from samples where sa:a = 1 group by s:category sa:b = 2`, SyntaxError, 1, 62},
+		{`select mean(s:name) from samples where sa:a = 1`, SemanticError, 1, 15},
+		{`select max from samples where sa:a = 1`, SemanticError, 1, 8},
+		{`select count from samples, processes where sa:a = 1`, SemanticError, 1, 1},
+		{`select samples where sa:a = 1 group by s:category`, SemanticError, 1, 31},
+		{`select samples where sa:a = 1 order sa:b`, SyntaxError, 1, 37},
+		{`select samples where sa:a = 1 order by sa:b limit`, SyntaxError, 1, 50},
+		{`select samples where sa:a = 1 limit 10 limit 5`, SyntaxError, 1, 40},
+		{`select samples where sa:a = 1 order by sa:b desc sa:c`, SyntaxError, 1, 50},
+		{`select samples where sa:a = 1 limit 0`, SemanticError, 1, 37},
+		{`select count from samples where sa:a = 1 order by sa:b`, SemanticError, 1, 42},
+	}
+
+	for _, test := range tests {
+		_, errs := ParseQuery(test.input)
+		if len(errs) == 0 {
+			t.Fatalf("%q: expected an error", test.input)
+		}
+
+		err := errs[0]
+		if err.Kind != test.kind || err.Pos.Line != test.line || err.Pos.Column != test.column {
+			t.Errorf("%q: expected %s error at %d:%d, got %s", test.input, test.kind, test.line, test.column, err)
+		}
+	}
+}
+
+func TestParseNotQuery(t *testing.T) {
+	selection, errs := ParseQuery(`select samples where sa:zn = 0.5 and not (sa:mg <> 0.4 or ! pa:time > 2)`)
+	if len(errs) != 0 {
+		t.Fatalf("ParseQuery failed: %s", errs)
+	}
+
+	and, ok := selection.Statement.(AndStatement)
+	if !ok {
+		t.Fatalf("expected AndStatement, got %T", selection.Statement)
+	}
+
+	not, ok := and.Right.(NotStatement)
+	if !ok {
+		t.Fatalf("expected NotStatement, got %T", and.Right)
+	}
+
+	or, ok := not.Statement.(OrStatement)
+	if !ok {
+		t.Fatalf("expected OrStatement, got %T", not.Statement)
+	}
+
+	if match := or.Left.(MatchStatement); match.Operation != "<>" {
+		t.Errorf("expected <>, got %s", match.Operation)
+	}
+
+	if _, ok := or.Right.(NotStatement); !ok {
+		t.Errorf("expected NotStatement, got %T", or.Right)
+	}
+
+	if !HasNotStatement(selection.Statement) || !HasProcessMatchStatement(not) {
+		t.Errorf("expected the negated process match to be found")
+	}
+}
+
+func TestParsePatternQuery(t *testing.T) {
+	selection, errs := ParseQuery(`select samples where sa:zn between 0.4 and -0.6 and sa:alloy in (zn45, "al 7075") ` +
+		`or s:name like "S_%" or sa:alloy matches '^zn[0-9]+$'`)
+	if len(errs) != 0 {
+		t.Fatalf("ParseQuery failed: %s", errs)
+	}
+
+	var matches []MatchStatement
+	var collect func(statement Statement)
+	collect = func(statement Statement) {
+		switch s := statement.(type) {
+		case AndStatement:
+			collect(s.Left)
+			collect(s.Right)
+		case OrStatement:
+			collect(s.Left)
+			collect(s.Right)
+		case MatchStatement:
+			matches = append(matches, s)
+		}
+	}
+	collect(selection.Statement)
+
+	if len(matches) != 4 {
+		t.Fatalf("expected 4 matches, got %d", len(matches))
+	}
+
+	if m := matches[0]; m.Operation != OpBetween || !reflect.DeepEqual(m.Value, []interface{}{"0.4", "-0.6"}) {
+		t.Errorf("unexpected between match %+v", m)
+	}
+
+	if m := matches[1]; m.Operation != OpIn || !reflect.DeepEqual(m.Value, []interface{}{"zn45", "al 7075"}) {
+		t.Errorf("unexpected in match %+v", m)
+	}
+
+	if m := matches[2]; m.FieldType != SampleFieldType || m.Pattern == nil || !m.Pattern.MatchString("s12") ||
+		m.Pattern.MatchString("S") {
+		t.Errorf("unexpected like match %+v", m)
+	}
+
+	if m := matches[3]; m.Operation != OpMatches || m.Pattern == nil || !m.Pattern.MatchString("zn45") {
+		t.Errorf("unexpected matches match %+v", m)
+	}
+}
+
+func TestParseAggregateQuery(t *testing.T) {
+	selection, errs := ParseQuery(`select count, mean(sa:hardness), max(pa:temperature C), stddev(sa:'grain size') ` +
+		`from samples where sa:zn > 0.4 group by p:name`)
+	if len(errs) != 0 {
+		t.Fatalf("ParseQuery failed: %s", errs)
+	}
+
+	if !selection.SelectSamples || selection.SelectProcesses {
+		t.Errorf("expected only samples to be selected")
+	}
+
+	expected := []Aggregate{
+		{Func: AggregateCount},
+		{Func: AggregateMean, FieldType: SampleAttributeFieldType, FieldName: "hardness"},
+		{Func: AggregateMax, FieldType: ProcessAttributeFieldType, FieldName: "temperature", Unit: "C"},
+		{Func: AggregateStdDev, FieldType: SampleAttributeFieldType, FieldName: "grain size"},
+	}
+	if !reflect.DeepEqual(selection.Aggregates, expected) {
+		t.Errorf("expected aggregates %+v, got %+v", expected, selection.Aggregates)
+	}
+
+	if selection.GroupBy == nil || *selection.GroupBy != (GroupBy{FieldType: ProcessFieldType, FieldName: "name"}) {
+		t.Errorf("expected to group by p:name, got %+v", selection.GroupBy)
+	}
+
+	if _, ok := selection.Statement.(MatchStatement); !ok {
+		t.Errorf("expected MatchStatement, got %T", selection.Statement)
+	}
+
+	if names := []string{expected[0].String(), expected[2].String(), expected[3].String(), selection.GroupBy.String()}; !reflect.DeepEqual(names,
+		[]string{"count", "max(pa:temperature)", "stddev(sa:'grain size')", "p:name"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+
+	selection, errs = ParseQuery(`select count() from processes where pa:time > 2 group by sa:alloy;`)
+	if len(errs) != 0 {
+		t.Fatalf("ParseQuery failed: %s", errs)
+	}
+
+	if !selection.SelectProcesses || len(selection.Aggregates) != 1 || selection.GroupBy.FieldType != SampleAttributeFieldType {
+		t.Errorf("unexpected selection %+v", selection)
+	}
+}
+
+func TestParseOrderByQuery(t *testing.T) {
+	selection, errs := ParseQuery(`select samples, processes where sa:zn > 0.4 order by sa:hardness desc, p:name asc, s:name ` +
+		`offset 20 limit 10;`)
+	if len(errs) != 0 {
+		t.Fatalf("ParseQuery failed: %s", errs)
+	}
+
+	expected := []OrderBy{
+		{FieldType: SampleAttributeFieldType, FieldName: "hardness", Descending: true},
+		{FieldType: ProcessFieldType, FieldName: "name"},
+		{FieldType: SampleFieldType, FieldName: "name"},
+	}
+	if !reflect.DeepEqual(selection.OrderBy, expected) {
+		t.Errorf("expected order by %+v, got %+v", expected, selection.OrderBy)
+	}
+
+	if selection.Limit != 10 || selection.Offset != 20 {
+		t.Errorf("expected limit 10 and offset 20, got %d and %d", selection.Limit, selection.Offset)
+	}
+
+	if s := expected[0].String(); s != "sa:hardness desc" {
+		t.Errorf("unexpected name %q", s)
+	}
+
+	// The clauses can be in any order.
+	selection, errs = ParseQuery(`select processes where pa:time > 2 limit 5 order by pa:'frames per second'`)
+	if len(errs) != 0 {
+		t.Fatalf("ParseQuery failed: %s", errs)
+	}
+
+	if selection.Limit != 5 || len(selection.OrderBy) != 1 || selection.OrderBy[0].FieldName != "frames per second" {
+		t.Errorf("unexpected selection %+v", selection)
+	}
+}
@@ -1,5 +1,11 @@
 package parser
 
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
 const (
 	ProcessFieldType          = 1
 	SampleFieldType           = 2
@@ -9,10 +15,19 @@ const (
 	SampleFuncType            = 6
 )
 
+// Selection is a compiled query. A query with Aggregates selects either samples or processes, and returns
+// the aggregates for them, split into groups when GroupBy is set, rather than the samples or processes.
+// Otherwise the samples and processes are sorted by OrderBy, and Offset and Limit, when they aren't 0,
+// choose which of them are returned.
 type Selection struct {
 	SelectProcesses bool
 	SelectSamples   bool
 	Statement       Statement
+	Aggregates      []Aggregate
+	GroupBy         *GroupBy
+	OrderBy         []OrderBy
+	Limit           int
+	Offset          int
 }
 
 type Statement interface {
@@ -39,11 +54,46 @@ type OrStatement struct {
 func (s OrStatement) statementNode() {
 }
 
+// NotStatement negates Statement. Against samples it matches a sample when no state of the sample matches
+// Statement, so a negated attribute match finds the samples that never had the attribute value.
+type NotStatement struct {
+	// Ignored field that is here to distinguish json from the other statements
+	Not       int       `json:"not"`
+	Statement Statement `json:"statement"`
+}
+
+func (s NotStatement) statementNode() {
+}
+
+// Operations a MatchStatement can have beyond the comparisons =, <>, <, <=, > and >=.
+const (
+	// OpLike matches strings against a pattern where % matches any number of characters and _ matches a
+	// single character. Like the other string comparisons it ignores case.
+	OpLike = "like"
+
+	// OpMatches matches strings against a regular expression, using RE2 syntax.
+	OpMatches = "matches"
+
+	// OpIn matches values equal to one of the values in a list.
+	OpIn = "in"
+
+	// OpBetween matches values in a range, including its ends. The value is a list of the low and high
+	// ends of the range.
+	OpBetween = "between"
+)
+
+// MatchStatement compares a field to a value. Unit is the unit the value is given in, when set attribute
+// values recorded in another unit of the same dimension are converted to it before being compared. The
+// Value of an OpIn or OpBetween match is a list of values.
 type MatchStatement struct {
 	FieldType int         `json:"field_type"`
 	FieldName string      `json:"field_name"`
 	Operation string      `json:"operation"`
 	Value     interface{} `json:"value"`
+	Unit      string      `json:"unit,omitempty"`
+
+	// Pattern is the compiled pattern of an OpLike or OpMatches match. It is set by Prepare.
+	Pattern *regexp.Regexp `json:"-"`
 }
 
 func (s MatchStatement) statementNode() {
@@ -80,6 +130,9 @@ func HasProcessMatchStatement(statement Statement) bool {
 			return true
 		}
 		return false
+
+	case NotStatement:
+		return HasProcessMatchStatement(s.Statement)
 	}
 
 	return false
@@ -116,7 +169,117 @@ func HasSampleMatchStatement(statement Statement) bool {
 			return true
 		}
 		return false
+
+	case NotStatement:
+		return HasSampleMatchStatement(s.Statement)
 	}
 
 	return false
 }
+
+// HasNotStatement returns true if statement negates any part of itself.
+func HasNotStatement(statement Statement) bool {
+	switch s := statement.(type) {
+	case AndStatement:
+		return HasNotStatement(s.Left) || HasNotStatement(s.Right)
+	case OrStatement:
+		return HasNotStatement(s.Left) || HasNotStatement(s.Right)
+	case NotStatement:
+		return true
+	default:
+		return false
+	}
+}
+
+// Prepare checks the matches in statement and compiles their patterns, so that a query's patterns are only
+// compiled once rather than for every value they are matched against. It returns a copy of statement with
+// the patterns set, and an error for the first match that can't be evaluated. Matches that already have a
+// Pattern are left as they are.
+func Prepare(statement Statement) (Statement, error) {
+	switch s := statement.(type) {
+	case AndStatement:
+		left, leftErr := Prepare(s.Left)
+		right, rightErr := Prepare(s.Right)
+		return AndStatement{Left: left, Right: right}, firstError(leftErr, rightErr)
+	case OrStatement:
+		left, leftErr := Prepare(s.Left)
+		right, rightErr := Prepare(s.Right)
+		return OrStatement{Left: left, Right: right}, firstError(leftErr, rightErr)
+	case NotStatement:
+		negated, err := Prepare(s.Statement)
+		return NotStatement{Statement: negated}, err
+	case MatchStatement:
+		return PrepareMatch(s)
+	default:
+		return statement, nil
+	}
+}
+
+// PrepareMatch checks a single match and compiles its pattern, as Prepare does for every match in a
+// statement.
+func PrepareMatch(match MatchStatement) (MatchStatement, error) {
+	switch match.Operation {
+	case OpLike, OpMatches:
+		if match.Pattern != nil {
+			return match, nil
+		}
+
+		pattern, ok := match.Value.(string)
+		if !ok {
+			return match, fmt.Errorf("%s %s needs a string, got %v", match.FieldName, match.Operation, match.Value)
+		}
+
+		expr := pattern
+		if match.Operation == OpLike {
+			expr = likeToRegexp(pattern)
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return match, fmt.Errorf("%s %s %q is not a valid regular expression: %w", match.FieldName, match.Operation, pattern, err)
+		}
+		match.Pattern = re
+
+	case OpIn:
+		if values, ok := match.Value.([]interface{}); !ok || len(values) == 0 {
+			return match, fmt.Errorf("%s in needs a list of values, got %v", match.FieldName, match.Value)
+		}
+
+	case OpBetween:
+		if values, ok := match.Value.([]interface{}); !ok || len(values) != 2 {
+			return match, fmt.Errorf("%s between needs a low and a high value, got %v", match.FieldName, match.Value)
+		}
+	}
+
+	return match, nil
+}
+
+// likeToRegexp converts a like pattern to a regular expression that matches the whole of a string,
+// ignoring case.
+func likeToRegexp(pattern string) string {
+	var expr strings.Builder
+	expr.WriteString("(?is)^")
+	for _, ch := range pattern {
+		switch ch {
+		case '%':
+			expr.WriteString(".*")
+		case '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	expr.WriteString("$")
+
+	return expr.String()
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -23,6 +23,7 @@ func (s *Server) Init() error {
 	s.g.POST("/load-project", api.LoadProjectController)
 	s.g.POST("/reload-project", api.ReloadProjectController)
 	s.g.POST("/execute-query", api.ExecuteQueryController)
+	s.g.POST("/query/text", api.ExecuteTextQueryController)
 
 	return nil
 }
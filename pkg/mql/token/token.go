@@ -22,6 +22,12 @@ const (
 	GTEQ  = 0x204 // >=
 	NOTEQ = 0x205 // <>
 
+	// Pattern, list and range operators
+	LIKE    = 0x206 // like
+	MATCHES = 0x207 // matches
+	IN      = 0x208 // in
+	BETWEEN = 0x209 // between
+
 	// Logical Operators
 	AND = 0x300 // and
 	OR  = 0x301 // or
@@ -46,6 +52,14 @@ const (
 	SAMPLE_ATTR  = 0x709 // sa:
 	TRUE         = 0x710 // true
 	FALSE        = 0x711 // false
+	FROM         = 0x712 // from
+	GROUP        = 0x713 // group
+	BY           = 0x714 // by
+	ORDER        = 0x715 // order
+	ASC          = 0x716 // asc
+	DESC         = 0x717 // desc
+	LIMIT        = 0x718 // limit
+	OFFSET       = 0x719 // offset
 
 	// Elements
 	LBRACKET  = 0x800 // [
@@ -64,11 +78,32 @@ const (
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+}
+
+// Position is where a token starts in a query. Offset is in bytes from the start of the query, Line and
+// Column count from 1.
+type Position struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 var keywords = map[string]TokenType{
 	"select": SELECT,
 	"where":  WHERE,
+	"from":   FROM,
+	"group":  GROUP,
+	"by":     BY,
+	"order":  ORDER,
+	"asc":    ASC,
+	"desc":   DESC,
+	"limit":  LIMIT,
+	"offset": OFFSET,
 
 	"s:":           SAMPLE_ATTR,
 	"sa:":          SAMPLE_ATTR,
@@ -85,6 +120,10 @@ var keywords = map[string]TokenType{
 	"and":       AND,
 	"or":        OR,
 	"not":       NOT,
+	"like":      LIKE,
+	"matches":   MATCHES,
+	"in":        IN,
+	"between":   BETWEEN,
 	"null":      NULL,
 
 	"s-has-process:":  SAMPLE_HAS_PROCESS_FUNC,
@@ -111,6 +150,10 @@ var tokenToStr = map[TokenType]string{
 	LT:                         "LT: <",
 	GTEQ:                       "GTEQ: >=",
 	GT:                         "GT: >",
+	LIKE:                       "LIKE: like",
+	MATCHES:                    "MATCHES: matches",
+	IN:                         "IN: in",
+	BETWEEN:                    "BETWEEN: between",
 	COMMA:                      "COMMA: ,",
 	LBRACKET:                   "LBRACKET: [",
 	RBRACKET:                   "RBRACKET: ]",
@@ -118,6 +161,14 @@ var tokenToStr = map[TokenType]string{
 	RPAREN:                     "RPAREN: )",
 	SEMICOLON:                  "SEMICOLON: ;",
 	WHERE:                      "WHERE: where",
+	FROM:                       "FROM: from",
+	GROUP:                      "GROUP: group",
+	BY:                         "BY: by",
+	ORDER:                      "ORDER: order",
+	ASC:                        "ASC: asc",
+	DESC:                       "DESC: desc",
+	LIMIT:                      "LIMIT: limit",
+	OFFSET:                     "OFFSET: offset",
 	AND:                        "AND: and",
 	NOT:                        "NOT: not",
 	NULL:                       "NULL: null",
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	mqldb2 "github.com/materials-commons/hydra/pkg/mql/mqldb"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mql/parser"
 	"gorm.io/gorm"
 )
 
@@ -65,12 +67,23 @@ func ReloadProjectController(c echo.Context) error {
 	return nil
 }
 
+// ExecuteQueryController runs a query given as a JSON statement against a loaded project. When the request
+// has aggregates the response is a table of them, computed over the selected samples or processes, rather
+// than the samples and processes. Otherwise the samples and processes are sorted by order_by, and limit
+// and offset page through them. When there are more than limit of either the response has a next_cursor,
+// which is sent back as cursor to get the next page.
 func ExecuteQueryController(c echo.Context) error {
 	var req struct {
 		Statement       map[string]interface{} `json:"statement"`
 		ProjectID       int                    `json:"project_id"`
 		SelectProcesses bool                   `json:"select_processes"`
 		SelectSamples   bool                   `json:"select_samples"`
+		Aggregates      []parser.Aggregate     `json:"aggregates"`
+		GroupBy         *parser.GroupBy        `json:"group_by"`
+		OrderBy         []parser.OrderBy       `json:"order_by"`
+		Limit           int                    `json:"limit"`
+		Offset          int                    `json:"offset"`
+		Cursor          string                 `json:"cursor"`
 	}
 
 	if err := c.Bind(&req); err != nil {
@@ -81,7 +94,14 @@ func ExecuteQueryController(c echo.Context) error {
 		return badRequest(fmt.Errorf("illegal project: %d", req.ProjectID))
 	}
 
-	statement := mqldb2.MapToStatement(req.Statement)
+	statement, err := parser.Prepare(mqldb2.MapToStatement(req.Statement))
+	if err != nil {
+		return badRequest(err)
+	}
+
+	if err := checkOrdering(req.OrderBy, req.Limit, req.Offset, len(req.Aggregates) != 0); err != nil {
+		return badRequest(err)
+	}
 
 	mutex.Lock()
 	defer mutex.Unlock()
@@ -98,18 +118,136 @@ func ExecuteQueryController(c echo.Context) error {
 		ProcessSelection: mqldb2.ProcessSelection{
 			All: req.SelectProcesses,
 		},
+		Aggregates: req.Aggregates,
+		GroupBy:    req.GroupBy,
+		OrderBy:    req.OrderBy,
+		Limit:      req.Limit,
+		Offset:     req.Offset,
+	}
+
+	var resp struct {
+		Processes  []mcmodel.Activity `json:"processes"`
+		Samples    []mcmodel.Entity   `json:"samples"`
+		NextCursor string             `json:"next_cursor,omitempty"`
+	}
+
+	if err := mqldb2.CheckUnits(db, statement); err != nil {
+		return badRequest(err)
+	}
+
+	if len(selection.Aggregates) != 0 {
+		table, err := mqldb2.EvalAggregates(db, selection, statement)
+		if err != nil {
+			return badRequest(err)
+		}
+		return c.JSON(http.StatusOK, &aggregateResponse{Table: table})
+	}
+
+	page, err := mqldb2.EvalPage(db, selection, statement, req.Cursor)
+	if err != nil {
+		return badRequest(err)
+	}
+	resp.Processes, resp.Samples, resp.NextCursor = page.Processes, page.Samples, page.NextCursor
+
+	return c.JSON(http.StatusOK, &resp)
+}
+
+// ExecuteTextQueryController runs a query written in MQL, such as "select samples where sa:temperature > 400 C",
+// against a loaded project. It returns the same results as ExecuteQueryController, including a table for a
+// query with aggregates such as "select count, mean(sa:hardness) from samples where ... group by s:category".
+// A query that can't be run gets a 400 with every syntax or semantic error found, each with its position in
+// the query. A query with a limit, such as "select samples where ... order by sa:hardness limit 100", gets a
+// next_cursor when there are more results, which is sent back as cursor along with the same query.
+func ExecuteTextQueryController(c echo.Context) error {
+	var req struct {
+		ProjectID int    `json:"project_id"`
+		Query     string `json:"query"`
+		Cursor    string `json:"cursor"`
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	if req.ProjectID == 0 {
+		return badRequest(fmt.Errorf("illegal project: %d", req.ProjectID))
+	}
+
+	query, err := mqldb2.CompileQuery(req.Query)
+	if err != nil {
+		return queryErrors(c, err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	db, ok := mqlDBByProjectID[req.ProjectID]
+	if !ok {
+		return badRequest(fmt.Errorf("project %d was never loaded", req.ProjectID))
 	}
 
 	var resp struct {
-		Processes []mcmodel.Activity `json:"processes"`
-		Samples   []mcmodel.Entity   `json:"samples"`
+		Processes  []mcmodel.Activity `json:"processes"`
+		Samples    []mcmodel.Entity   `json:"samples"`
+		NextCursor string             `json:"next_cursor,omitempty"`
+	}
+
+	if err := mqldb2.CheckUnits(db, query.Statement); err != nil {
+		return queryErrors(c, parser.Errors{{Kind: parser.SemanticError, Message: err.Error()}})
 	}
 
-	resp.Processes, resp.Samples = mqldb2.EvalStatement(db, selection, statement)
+	if query.IsAggregate() {
+		table, err := mqldb2.EvalAggregates(db, query.Selection, query.Statement)
+		if err != nil {
+			return queryErrors(c, parser.Errors{{Kind: parser.SemanticError, Message: err.Error()}})
+		}
+		return c.JSON(http.StatusOK, &aggregateResponse{Table: table})
+	}
+
+	page, err := mqldb2.EvalPage(db, query.Selection, query.Statement, req.Cursor)
+	if err != nil {
+		return badRequest(err)
+	}
+	resp.Processes, resp.Samples, resp.NextCursor = page.Processes, page.Samples, page.NextCursor
 
 	return c.JSON(http.StatusOK, &resp)
 }
 
+// checkOrdering checks the order_by, limit and offset of a JSON query, which can't be used with aggregates.
+func checkOrdering(orderBy []parser.OrderBy, limit, offset int, hasAggregates bool) error {
+	switch {
+	case hasAggregates && (len(orderBy) != 0 || limit != 0 || offset != 0):
+		return fmt.Errorf("order_by, limit and offset can't be used with aggregates")
+	case limit < 0:
+		return fmt.Errorf("limit can't be negative: %d", limit)
+	case offset < 0:
+		return fmt.Errorf("offset can't be negative: %d", offset)
+	}
+
+	for _, o := range orderBy {
+		if err := o.Check(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// aggregateResponse is the response to a query with aggregates.
+type aggregateResponse struct {
+	Table *mqldb2.Table `json:"table"`
+}
+
+// queryErrors responds with the problems found in a text query.
+func queryErrors(c echo.Context, err error) error {
+	var errs parser.Errors
+	if !errors.As(err, &errs) {
+		return badRequest(err)
+	}
+
+	return c.JSON(http.StatusBadRequest, map[string]interface{}{"errors": errs})
+}
+
 // loadProjectDB will load the mqldb for the project and save it into mqlDBByProjectID. It does not attempt to lock
 // access to mqlDBByProjectID. If this is important then the call must acquire the mutex.Lock().
 func loadProjectDB(projectID int) error {
@@ -0,0 +1,212 @@
+package mql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/feather-lang/feather"
+	"github.com/materials-commons/hydra/pkg/mql/mqldb"
+	"github.com/materials-commons/hydra/pkg/mql/parser"
+	"github.com/olekukonko/tablewriter"
+)
+
+// parseAggregateColumns returns the aggregates in the select columns of a query, such as count and
+// mean(hardness). It returns nil when none of the columns are aggregates, and an error when only some of
+// them are.
+func parseAggregateColumns(columns []string, queryType string) ([]parser.Aggregate, error) {
+	var aggregates []parser.Aggregate
+	for _, column := range columns {
+		if aggregate, ok := parseAggregate(column, queryType); ok {
+			aggregates = append(aggregates, aggregate)
+		}
+	}
+
+	switch {
+	case len(aggregates) == 0:
+		return nil, nil
+	case len(aggregates) != len(columns):
+		return nil, fmt.Errorf("select either columns or aggregates such as count and mean(hardness), not both")
+	}
+
+	for _, aggregate := range aggregates {
+		if err := aggregate.Check(); err != nil {
+			return nil, err
+		}
+	}
+
+	return aggregates, nil
+}
+
+// parseAggregate parses an aggregate column such as count, max(hardness) or mean(temperature, C), where C
+// is the unit to compute the mean in.
+func parseAggregate(column, queryType string) (parser.Aggregate, bool) {
+	fn, arg := column, ""
+	if open := strings.Index(column, "("); open != -1 && strings.HasSuffix(column, ")") {
+		fn, arg = column[:open], strings.TrimSpace(column[open+1:len(column)-1])
+	}
+
+	aggregate := parser.Aggregate{Func: strings.ToLower(strings.TrimSpace(fn))}
+	if !parser.IsAggregateFunc(aggregate.Func) {
+		return aggregate, false
+	}
+
+	if arg == "" {
+		return aggregate, true
+	}
+
+	if comma := strings.LastIndex(arg, ","); comma != -1 {
+		arg, aggregate.Unit = strings.TrimSpace(arg[:comma]), strings.TrimSpace(arg[comma+1:])
+	}
+	aggregate.FieldType, aggregate.FieldName = fieldRef(arg, queryType)
+
+	return aggregate, true
+}
+
+// fieldRef resolves a field or attribute named in a query. As in MQL the name can start with s: or sa: for
+// a sample's fields and attributes, or p: or pa: for a process's, so that samples can be grouped by the
+// processes they were used in. Otherwise it is one of the fields or attributes of the samples or processes
+// being queried. The fields are name and category, anything else is an attribute.
+func fieldRef(ref, queryType string) (int, string) {
+	prefix, name := "", ref
+	if colon := strings.Index(ref, ":"); colon != -1 {
+		switch ref[:colon] {
+		case "s", "sa", "p", "pa":
+			prefix, name = ref[:colon], ref[colon+1:]
+		}
+	}
+
+	sample := prefix == "s" || prefix == "sa" || (prefix == "" && queryType == "samples")
+	isField := name == "name" || name == "category"
+	switch {
+	case sample && isField:
+		return parser.SampleFieldType, name
+	case sample:
+		return parser.SampleAttributeFieldType, name
+	case isField:
+		return parser.ProcessFieldType, name
+	default:
+		return parser.ProcessAttributeFieldType, name
+	}
+}
+
+// formatTableOutput formats the result of an aggregate query in the format given by the show options.
+func (q *Query) formatTableOutput(t *mqldb.Table, options *ShowOptions) feather.Result {
+	format := "list"
+	if options != nil && options.Format != "" {
+		format = options.Format
+	}
+
+	switch format {
+	case "table":
+		return q.formatTableAsTable(t, options)
+	case "csv":
+		return q.formatTableAsCSV(t)
+	case "json":
+		// The table keeps its column types and units.
+		b, err := json.Marshal(t)
+		if err != nil {
+			return feather.Error(err)
+		}
+		return feather.OK(string(b))
+	default:
+		return q.formatTableAsList(t)
+	}
+}
+
+func (q *Query) formatTableAsTable(t *mqldb.Table, options *ShowOptions) feather.Result {
+	buf := new(bytes.Buffer)
+	table := tablewriter.NewWriter(buf)
+	defer table.Close()
+
+	headers := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		headers[i] = tableColumnName(col)
+	}
+	if options != nil && len(options.Headers) > 0 {
+		headers = options.Headers
+	}
+	table.Header(headers)
+
+	for _, row := range t.Rows {
+		table.Append(tableRowValues(row))
+	}
+
+	buf.WriteString("\n")
+	table.Render()
+
+	return feather.OK(buf.String())
+}
+
+func (q *Query) formatTableAsCSV(t *mqldb.Table) feather.Result {
+	var lines []string
+
+	headers := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		headers[i] = csvValue(tableColumnName(col))
+	}
+	lines = append(lines, strings.Join(headers, ","))
+
+	for _, row := range t.Rows {
+		values := tableRowValues(row)
+		for i, value := range values {
+			values[i] = csvValue(value)
+		}
+		lines = append(lines, strings.Join(values, ","))
+	}
+
+	return feather.OK(strings.Join(lines, "\n"))
+}
+
+func (q *Query) formatTableAsList(t *mqldb.Table) feather.Result {
+	var items []string
+
+	for _, row := range t.Rows {
+		var parts []string
+		for i, value := range tableRowValues(row) {
+			parts = append(parts, fmt.Sprintf("%s: %s", tableColumnName(t.Columns[i]), value))
+		}
+		items = append(items, strings.Join(parts, " "))
+	}
+
+	return feather.OK(items)
+}
+
+// tableColumnName is the name of a column followed by its unit, as in mean(sa:temperature) (C).
+func tableColumnName(col mqldb.Column) string {
+	if col.Unit == "" {
+		return col.Name
+	}
+
+	return fmt.Sprintf("%s (%s)", col.Name, col.Unit)
+}
+
+// tableRowValues formats the values in a row. Values that couldn't be computed are shown as "-", as
+// missing attributes are in other query output.
+func tableRowValues(row []interface{}) []string {
+	values := make([]string, len(row))
+	for i, value := range row {
+		switch v := value.(type) {
+		case nil:
+			values[i] = "-"
+		case int64:
+			values[i] = strconv.FormatInt(v, 10)
+		case float64:
+			values[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			values[i] = fmt.Sprintf("%v", v)
+		}
+	}
+
+	return values
+}
+
+func csvValue(value string) string {
+	if strings.Contains(value, ",") || strings.Contains(value, "\"") {
+		return fmt.Sprintf("\"%s\"", strings.ReplaceAll(value, "\"", "\"\""))
+	}
+
+	return value
+}
@@ -343,6 +343,7 @@ func (mql *MQLCommands) sendDownloadFile(f *mcmodel.File, clientID, projectPath,
 	payload["file_id"] = f.ID
 	payload["size"] = f.Size
 	payload["checksum"] = f.Checksum
+	payload["sha256"] = f.Sha256
 
 	msg := wserv2.Message{
 		Command:   "DOWNLOAD_FILE",
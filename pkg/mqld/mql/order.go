@@ -0,0 +1,44 @@
+package mql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/materials-commons/hydra/pkg/mql/parser"
+)
+
+// parseOrderBy parses the fields of an order by clause, such as {hardness desc name}. Each field is resolved
+// as by fieldRef, and sorted in ascending order unless it is followed by desc.
+func parseOrderBy(fields []string, queryType string) ([]parser.OrderBy, error) {
+	var orderings []parser.OrderBy
+	for _, field := range fields {
+		switch strings.ToLower(field) {
+		case "asc", "desc":
+			if len(orderings) == 0 {
+				return nil, fmt.Errorf("%s must follow a field to order by", field)
+			}
+			orderings[len(orderings)-1].Descending = strings.EqualFold(field, "desc")
+		default:
+			var o parser.OrderBy
+			o.FieldType, o.FieldName = fieldRef(field, queryType)
+			if err := o.Check(); err != nil {
+				return nil, err
+			}
+			orderings = append(orderings, o)
+		}
+	}
+
+	return orderings, nil
+}
+
+// pageBounds returns the range of n results to show, after skipping offset of them and showing at most
+// limit when it isn't 0.
+func pageBounds(n int, offset, limit int64) (int, int) {
+	start := int(min(offset, int64(n)))
+	end := n
+	if limit > 0 && int64(start)+limit < int64(n) {
+		end = start + int(limit)
+	}
+
+	return start, end
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/feather-lang/feather"
 	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
 	"github.com/materials-commons/hydra/pkg/mql/mqldb"
+	"github.com/materials-commons/hydra/pkg/mql/parser"
 	"github.com/olekukonko/tablewriter"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
@@ -451,15 +452,25 @@ func (q *Query) endsWithCommand(i *feather.Interp, o *feather.Obj, args []*feath
 }
 
 func (q *Query) queryCommand(i *feather.Interp, o *feather.Obj, args []*feather.Obj) feather.Result {
-	// Parse: query [select {columns}] <type> where {condition} [show {options}]
+	// Parse: query [select {columns}] <type> where {condition} [group by <field>] [order by {fields}]
+	//              [limit <n>] [offset <n>] [show {options}]
+	//
+	// The columns can instead be aggregates, such as {count mean(hardness) max(temperature, C)}, which
+	// returns a row of them for each group rather than the matching samples or processes. The fields
+	// to order by can each be followed by asc or desc, as in {hardness desc name}.
 	var (
 		selectColumns []string
 		queryType     string
 		condition     string
+		groupBy       string
+		orderBy       []string
+		limit         int64
+		offset        int64
 		showOptions   *ShowOptions
 	)
 
-	usageErr := fmt.Errorf("query [select {columns}] <type> where {condition} [show {options}]")
+	usageErr := fmt.Errorf("query [select {columns}] <type> where {condition} [group by <field>] [order by {fields}] " +
+		"[limit <n>] [offset <n>] [show {options}]")
 
 	// argIdx is the index of the current argument being parsed we advance it
 	// we walk through the args array.
@@ -480,7 +491,7 @@ func (q *Query) queryCommand(i *feather.Interp, o *feather.Obj, args []*feather.
 	}
 
 	// Check for the query type
-	if argIdx > len(args) {
+	if argIdx >= len(args) {
 		return feather.Error(usageErr)
 	}
 
@@ -491,17 +502,60 @@ func (q *Query) queryCommand(i *feather.Interp, o *feather.Obj, args []*feather.
 	if argIdx >= len(args) || args[argIdx].String() != "where" {
 		return feather.Error(usageErr)
 	}
+	argIdx++
 
 	// Get the where condition
-	if argIdx > len(args) {
+	if argIdx >= len(args) {
 		return feather.Error(usageErr)
 	}
 
 	condition = args[argIdx].String()
 	argIdx++
 
+	// Check for optional group by clause
+	if argIdx < len(args) && args[argIdx].String() == "group" {
+		if argIdx+2 >= len(args) || args[argIdx+1].String() != "by" {
+			return feather.Error(usageErr)
+		}
+
+		groupBy = args[argIdx+2].String()
+		argIdx += 3
+	}
+
+	// Check for optional order by clause
+	if argIdx < len(args) && args[argIdx].String() == "order" {
+		if argIdx+2 >= len(args) || args[argIdx+1].String() != "by" {
+			return feather.Error(usageErr)
+		}
+
+		orderBy = q.parseColumnList(args[argIdx+2])
+		argIdx += 3
+	}
+
+	// Check for optional limit and offset clauses
+	for _, clause := range []struct {
+		name  string
+		value *int64
+	}{{"limit", &limit}, {"offset", &offset}} {
+		if argIdx >= len(args) || args[argIdx].String() != clause.name {
+			continue
+		}
+
+		if argIdx+1 >= len(args) {
+			return feather.Error(usageErr)
+		}
+
+		n, err := args[argIdx+1].Int()
+		if err != nil || n < 0 {
+			return feather.Error(fmt.Errorf("%s must be a number that isn't negative, got '%s'", clause.name, args[argIdx+1].String()))
+		}
+		*clause.value = n
+		argIdx += 2
+	}
+
 	// Check for optional show clause
 	if argIdx < len(args) && args[argIdx].String() == "show" {
+		argIdx++
 		// Has a show keyword, let's make sure the clause is included and parse it.
 		if argIdx >= len(args) {
 			return feather.Error(usageErr)
@@ -516,6 +570,34 @@ func (q *Query) queryCommand(i *feather.Interp, o *feather.Obj, args []*feather.
 		selectColumns = showOptions.Columns
 	}
 
+	if queryType != "samples" && queryType != "processes" {
+		return feather.Error(fmt.Errorf("unknown query type '%s'", queryType))
+	}
+
+	aggregates, err := parseAggregateColumns(selectColumns, queryType)
+	if err != nil {
+		return feather.Error(err)
+	}
+
+	var group *parser.GroupBy
+	if groupBy != "" {
+		if len(aggregates) == 0 {
+			return feather.Error(fmt.Errorf("group by needs aggregates to select, such as {count mean(hardness)}"))
+		}
+
+		group = &parser.GroupBy{}
+		group.FieldType, group.FieldName = fieldRef(groupBy, queryType)
+	}
+
+	if len(aggregates) != 0 && (len(orderBy) != 0 || limit != 0 || offset != 0) {
+		return feather.Error(fmt.Errorf("order by, limit and offset can't be used with aggregates"))
+	}
+
+	orderings, err := parseOrderBy(orderBy, queryType)
+	if err != nil {
+		return feather.Error(err)
+	}
+
 	// Now execute the query
 	switch queryType {
 	case "samples":
@@ -523,16 +605,38 @@ func (q *Query) queryCommand(i *feather.Interp, o *feather.Obj, args []*feather.
 		if err != nil {
 			return feather.Error(err)
 		}
-		return q.formatSamplesOutput(samples, selectColumns, showOptions)
 
-	case "processes":
+		if len(aggregates) != 0 {
+			table, err := mqldb.AggregateSamples(q.db, samples, aggregates, group)
+			if err != nil {
+				return feather.Error(err)
+			}
+			return q.formatTableOutput(table, showOptions)
+		}
+
+		samples = mqldb.OrderSamples(q.db, samples, orderings)
+		start, end := pageBounds(len(samples), offset, limit)
+
+		return q.formatSamplesOutput(samples[start:end], selectColumns, showOptions)
+
+	default:
 		processes, err := q.executeProcessesQuery(i, condition)
 		if err != nil {
 			return feather.Error(err)
 		}
-		return q.formatProcessesOutput(processes, selectColumns, showOptions)
-	default:
-		return feather.Error(fmt.Errorf("unknown query type '%s'", queryType))
+
+		if len(aggregates) != 0 {
+			table, err := mqldb.AggregateProcesses(q.db, processes, aggregates, group)
+			if err != nil {
+				return feather.Error(err)
+			}
+			return q.formatTableOutput(table, showOptions)
+		}
+
+		processes = mqldb.OrderProcesses(q.db, processes, orderings)
+		start, end := pageBounds(len(processes), offset, limit)
+
+		return q.formatProcessesOutput(processes[start:end], selectColumns, showOptions)
 	}
 }
 
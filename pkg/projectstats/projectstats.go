@@ -0,0 +1,138 @@
+// Package projectstats rebuilds the statistics stored on projects (size, file and directory counts, and
+// the file type histogram) from the files table. These statistics are maintained incrementally as files
+// are uploaded, moved and deleted, and drift whenever a code path forgets to update them. A rebuild
+// reports the differences it finds and corrects them.
+//
+// A rebuild can be run once, for example from mcadmin, or periodically from a long running server
+// using RunEvery.
+package projectstats
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+)
+
+type Options struct {
+	// ProjectID limits the rebuild to a single project. Zero rebuilds every project.
+	ProjectID int
+
+	// DryRun reports differences without correcting them.
+	DryRun bool
+}
+
+// ProjectError records a project whose statistics couldn't be rebuilt.
+type ProjectError struct {
+	ProjectID int    `json:"project_id"`
+	Error     string `json:"error"`
+}
+
+// Report is the result of a rebuild. Projects only contains the projects whose statistics differed.
+type Report struct {
+	ProjectID         int                          `json:"project_id"`
+	DryRun            bool                         `json:"dry_run"`
+	StartedAt         time.Time                    `json:"started_at"`
+	FinishedAt        time.Time                    `json:"finished_at"`
+	ProjectsChecked   int                          `json:"projects_checked"`
+	ProjectsDiffering int                          `json:"projects_differing"`
+	ProjectsCorrected int                          `json:"projects_corrected"`
+	Projects          []mcmodel.ProjectStatsReport `json:"projects"`
+	Errors            []ProjectError               `json:"errors"`
+}
+
+type Rebuilder struct {
+	projectStor stor.ProjectStor
+}
+
+func NewRebuilder(projectStor stor.ProjectStor) *Rebuilder {
+	return &Rebuilder{projectStor: projectStor}
+}
+
+// Run rebuilds the statistics for the projects selected by opts. A failure on one project is recorded
+// in the report and doesn't stop the remaining projects from being rebuilt.
+func (r *Rebuilder) Run(opts Options) (*Report, error) {
+	report := &Report{
+		ProjectID: opts.ProjectID,
+		DryRun:    opts.DryRun,
+		StartedAt: time.Now(),
+		Projects:  []mcmodel.ProjectStatsReport{},
+		Errors:    []ProjectError{},
+	}
+
+	projectIDs := []int{opts.ProjectID}
+	if opts.ProjectID == 0 {
+		var err error
+		if projectIDs, err = r.projectStor.ListProjectIDs(); err != nil {
+			return nil, fmt.Errorf("unable to list projects: %w", err)
+		}
+	}
+
+	for _, projectID := range projectIDs {
+		projectReport, err := r.projectStor.RebuildProjectStats(projectID, opts.DryRun)
+		if err != nil {
+			if opts.ProjectID != 0 {
+				return nil, fmt.Errorf("unable to rebuild statistics for project %d: %w", projectID, err)
+			}
+
+			report.Errors = append(report.Errors, ProjectError{ProjectID: projectID, Error: err.Error()})
+			continue
+		}
+
+		report.ProjectsChecked++
+		if len(projectReport.Diffs) == 0 {
+			continue
+		}
+
+		report.ProjectsDiffering++
+		if projectReport.Corrected {
+			report.ProjectsCorrected++
+		}
+		report.Projects = append(report.Projects, *projectReport)
+	}
+
+	report.FinishedAt = time.Now()
+
+	return report, nil
+}
+
+// RunEvery runs a rebuild immediately, and then once every interval, until ctx is cancelled. Each
+// rebuild is logged.
+func (r *Rebuilder) RunEvery(ctx context.Context, interval time.Duration, opts Options) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.runAndLog(opts)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Rebuilder) runAndLog(opts Options) {
+	report, err := r.Run(opts)
+	if err != nil {
+		log.Errorf("Project statistics rebuild failed: %s", err)
+		return
+	}
+
+	for _, projectReport := range report.Projects {
+		for _, diff := range projectReport.Diffs {
+			log.Infof("Project %d %s: stored %s, computed %s", projectReport.ProjectID, diff.Field, diff.Stored, diff.Computed)
+		}
+	}
+
+	for _, projectErr := range report.Errors {
+		log.Errorf("Unable to rebuild statistics for project %d: %s", projectErr.ProjectID, projectErr.Error)
+	}
+
+	log.Infof("Project statistics rebuild checked %d projects: %d differed, %d corrected, %d errors",
+		report.ProjectsChecked, report.ProjectsDiffering, report.ProjectsCorrected, len(report.Errors))
+}
@@ -0,0 +1,121 @@
+package projectstats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRebuilder(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	projectStor := stor.NewGormProjectStor(db)
+
+	user := b.User("user1")
+	proj := b.Project("proj1", user)
+	d1 := b.Dir(proj, proj.RootDir, "d1")
+	b.Dir(proj, d1, "d2")
+	b.File(proj, proj.RootDir, "a.txt", 10)
+	b.File(proj, d1, "b.txt", 20)
+	png := b.File(proj, d1, "c.png", 30)
+	require.NoError(t, db.Model(png).Update("mime_type", "image/png").Error)
+
+	// An older version of a.txt counts towards the size, but not the number of files.
+	old := b.File(proj, proj.RootDir, "a.txt", 5)
+	require.NoError(t, db.Model(old).Update("current", false).Error)
+
+	// Deleted files and files in datasets aren't counted.
+	deleted := b.File(proj, d1, "deleted.txt", 100)
+	require.NoError(t, db.Model(deleted).Update("deleted_at", time.Now()).Error)
+	published := b.File(proj, d1, "published.txt", 1000)
+	require.NoError(t, db.Model(published).Update("dataset_id", 1).Error)
+
+	// Make the stored statistics drift.
+	err := db.Model(proj).Updates(map[string]interface{}{
+		"size":            1,
+		"file_count":      1,
+		"directory_count": 7,
+		"file_types":      `{"Text": 9, "Video": 2}`,
+	}).Error
+	require.NoError(t, err)
+
+	// A second project whose statistics are right.
+	proj2 := b.Project("proj2", user)
+	b.File(proj2, proj2.RootDir, "x.txt", 10)
+	require.NoError(t, db.Model(proj2).Update("file_types", `{"Text": 1}`).Error)
+
+	rebuilder := NewRebuilder(projectStor)
+
+	report, err := rebuilder.Run(Options{DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, 2, report.ProjectsChecked)
+	require.Equal(t, 1, report.ProjectsDiffering)
+	require.Equal(t, 0, report.ProjectsCorrected)
+	require.Len(t, report.Projects, 1)
+
+	projectReport := report.Projects[0]
+	require.Equal(t, proj.ID, projectReport.ProjectID)
+	require.False(t, projectReport.Corrected)
+	require.Equal(t, mcmodel.ProjectStats{
+		Size:           65,
+		FileCount:      3,
+		DirectoryCount: 2,
+		FileTypes:      map[string]int{"Text": 2, "Image": 1},
+	}, projectReport.Computed)
+	require.Equal(t, []mcmodel.ProjectStatsDiff{
+		{Field: "size", Stored: "1", Computed: "65"},
+		{Field: "file_count", Stored: "1", Computed: "3"},
+		{Field: "directory_count", Stored: "7", Computed: "2"},
+		{Field: "file_types.Image", Stored: "0", Computed: "1"},
+		{Field: "file_types.Text", Stored: "9", Computed: "2"},
+		{Field: "file_types.Video", Stored: "2", Computed: "0"},
+	}, projectReport.Diffs)
+
+	p, err := projectStor.GetProjectByID(proj.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), p.Size)
+
+	report, err = rebuilder.Run(Options{ProjectID: proj.ID})
+	require.NoError(t, err)
+	require.Equal(t, 1, report.ProjectsChecked)
+	require.Equal(t, 1, report.ProjectsCorrected)
+
+	p, err = projectStor.GetProjectByID(proj.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(65), p.Size)
+	require.Equal(t, 3, p.FileCount)
+	require.Equal(t, 2, p.DirectoryCount)
+	fileTypes, err := p.GetFileTypes()
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"Text": 2, "Image": 1}, fileTypes)
+
+	report, err = rebuilder.Run(Options{})
+	require.NoError(t, err)
+	require.Equal(t, 0, report.ProjectsDiffering)
+
+	_, err = rebuilder.Run(Options{ProjectID: proj2.ID + 100})
+	require.Error(t, err)
+}
+
+func TestRebuilderRunEvery(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	projectStor := stor.NewGormProjectStor(db)
+
+	proj := b.Project("proj1", b.User("user1"))
+	require.NoError(t, db.Model(proj).Update("file_count", 10).Error)
+
+	// With a cancelled context RunEvery does a single rebuild and returns.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	NewRebuilder(projectStor).RunEvery(ctx, time.Hour, Options{})
+
+	p, err := projectStor.GetProjectByID(proj.ID)
+	require.NoError(t, err)
+	require.Equal(t, 0, p.FileCount)
+}
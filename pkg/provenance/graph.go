@@ -0,0 +1,259 @@
+package provenance
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+)
+
+// Node kinds.
+const (
+	KindSample  = "sample"
+	KindProcess = "process"
+	KindFile    = "file"
+)
+
+// Edge kinds. Edges point the way material and data flow: from an input sample to the process it was
+// used in, from a process to the sample it produced, and from a sample to a file attached to it.
+const (
+	EdgeInput  = "input"
+	EdgeOutput = "output"
+	EdgeFile   = "file"
+)
+
+// DirectionNote explains how input and output edges are decided. It is included in every graph.
+const DirectionNote = "Input and output edges are inferred from creation times, compared to the second: a " +
+	"sample created before a process is an input to it, and one created after it is an output. A sample " +
+	"created in the same second as a process is taken to be an output, and the edge is marked ambiguous."
+
+// Graph is the lineage of a sample or file. Root is the id of the node lineage was built from, and Note
+// is DirectionNote.
+type Graph struct {
+	Root  string  `json:"root"`
+	Note  string  `json:"note"`
+	Nodes []*Node `json:"nodes"`
+	Edges []Edge  `json:"edges"`
+
+	nodes map[string]*Node
+	edges map[Edge]bool
+}
+
+// Node is a sample, process or file in a lineage graph. ItemID is the id of the entity, activity or
+// file it is, and Depth is how many steps it is from the root.
+type Node struct {
+	ID       string `json:"id"`
+	Kind     string `json:"kind"`
+	ItemID   int    `json:"item_id"`
+	UUID     string `json:"uuid"`
+	Name     string `json:"name"`
+	Category string `json:"category,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Depth    int    `json:"depth"`
+}
+
+// Edge connects two nodes. Ambiguous is set on input and output edges whose direction was decided by
+// the tie-break described in DirectionNote.
+type Edge struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Kind      string `json:"kind"`
+	Ambiguous bool   `json:"ambiguous,omitempty"`
+}
+
+func newGraph() *Graph {
+	return &Graph{
+		Note:  DirectionNote,
+		Nodes: []*Node{},
+		Edges: []Edge{},
+		nodes: make(map[string]*Node),
+		edges: make(map[Edge]bool),
+	}
+}
+
+// Node returns the node with id, or nil if it isn't in the graph.
+func (g *Graph) Node(id string) *Node {
+	for _, n := range g.Nodes {
+		if n.ID == id {
+			return n
+		}
+	}
+
+	return nil
+}
+
+func (g *Graph) addSample(entity mcmodel.Entity, depth int) *Node {
+	return g.addNode(&Node{
+		ID:       SampleNodeID(entity.ID),
+		Kind:     KindSample,
+		ItemID:   entity.ID,
+		UUID:     entity.UUID,
+		Name:     entity.Name,
+		Category: entity.Category,
+		Depth:    depth,
+	})
+}
+
+func (g *Graph) addProcess(activity mcmodel.Activity, depth int) *Node {
+	return g.addNode(&Node{
+		ID:       ProcessNodeID(activity.ID),
+		Kind:     KindProcess,
+		ItemID:   activity.ID,
+		UUID:     activity.UUID,
+		Name:     activity.Name,
+		Category: activity.Category,
+		Depth:    depth,
+	})
+}
+
+func (g *Graph) addFile(file mcmodel.File, depth int) *Node {
+	return g.addNode(&Node{
+		ID:     FileNodeID(file.ID),
+		Kind:   KindFile,
+		ItemID: file.ID,
+		UUID:   file.UUID,
+		Name:   file.Name,
+		Path:   file.FullPath(),
+		Depth:  depth,
+	})
+}
+
+// addNode adds n to the graph, unless a node with the same id is already there. The node in the graph
+// is returned, with the smaller of the two depths.
+func (g *Graph) addNode(n *Node) *Node {
+	if existing, ok := g.nodes[n.ID]; ok {
+		if n.Depth < existing.Depth {
+			existing.Depth = n.Depth
+		}
+		return existing
+	}
+
+	g.nodes[n.ID] = n
+	g.Nodes = append(g.Nodes, n)
+	return n
+}
+
+func (g *Graph) addEdge(e Edge) {
+	if g.edges[e] {
+		return
+	}
+
+	g.edges[e] = true
+	g.Edges = append(g.Edges, e)
+}
+
+var kindOrder = map[string]int{KindSample: 0, KindProcess: 1, KindFile: 2}
+
+// sort puts the nodes and edges in a fixed order, so the same lineage always renders the same way.
+// Nodes are ordered by depth, then kind, then id.
+func (g *Graph) sort() {
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		a, b := g.Nodes[i], g.Nodes[j]
+		switch {
+		case a.Depth != b.Depth:
+			return a.Depth < b.Depth
+		case a.Kind != b.Kind:
+			return kindOrder[a.Kind] < kindOrder[b.Kind]
+		default:
+			return a.ItemID < b.ItemID
+		}
+	})
+
+	position := make(map[string]int, len(g.Nodes))
+	for i, n := range g.Nodes {
+		position[n.ID] = i
+	}
+
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if position[a.From] != position[b.From] {
+			return position[a.From] < position[b.From]
+		}
+		return position[a.To] < position[b.To]
+	})
+}
+
+// WriteDOT writes the graph in the GraphViz DOT language. Samples are drawn as ellipses, processes as
+// boxes and files as notes, and the root is highlighted. Edges to files are dashed, ambiguous edges are
+// dotted, and the graph starts with DirectionNote as a comment.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "// %s\n", DirectionNote)
+	b.WriteString("digraph provenance {\n")
+	b.WriteString("  rankdir=LR;\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "  %s [label=%s, shape=%s", dotID(n.ID), dotString(n.label()), nodeShape(n.Kind))
+		if n.ID == g.Root {
+			b.WriteString(", style=filled, fillcolor=lightyellow")
+		}
+		b.WriteString("];\n")
+	}
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %s -> %s", dotID(e.From), dotID(e.To))
+		switch {
+		case e.Kind == EdgeFile:
+			b.WriteString(" [style=dashed]")
+		case e.Ambiguous:
+			b.WriteString(" [style=dotted]")
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// DOT returns the graph in the GraphViz DOT language.
+func (g *Graph) DOT() string {
+	var b strings.Builder
+	_ = g.WriteDOT(&b)
+	return b.String()
+}
+
+func (n *Node) label() string {
+	if n.Kind == KindFile {
+		return n.Path
+	}
+
+	return n.Name
+}
+
+func nodeShape(kind string) string {
+	switch kind {
+	case KindProcess:
+		return "box"
+	case KindFile:
+		return "note"
+	default:
+		return "ellipse"
+	}
+}
+
+// dotID turns a node id into a DOT identifier. Node ids are a kind followed by a number, so replacing the
+// dash is enough.
+func dotID(id string) string {
+	return strings.ReplaceAll(id, "-", "_")
+}
+
+// dotString quotes s as a DOT string.
+func dotString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "").Replace(s) + `"`
+}
+
+func SampleNodeID(entityID int) string {
+	return fmt.Sprintf("%s-%d", KindSample, entityID)
+}
+
+func ProcessNodeID(activityID int) string {
+	return fmt.Sprintf("%s-%d", KindProcess, activityID)
+}
+
+func FileNodeID(fileID int) string {
+	return fmt.Sprintf("%s-%d", KindFile, fileID)
+}
@@ -0,0 +1,308 @@
+// Package provenance builds the lineage of a sample or file from the provenance graph formed by
+// samples (entities), the processes (activities) performed on them and the files attached to them.
+//
+// The activity2entity join doesn't record whether a sample was an input to, or an output of, a process,
+// and neither do entity_states, which aren't linked to the process that created them. The direction is
+// inferred from when each was created: a sample created before the process was an input to it, a
+// sample created after the process was an output of it. So the processes upstream of a sample are the
+// ones that produced it, and the processes downstream of it are the ones it was used in.
+//
+// Creation times are compared to the second, the resolution the database stores them at. A sample and
+// a process created in the same second are a tie, and the sample is taken to be an output: samples are
+// usually created alongside the process that produces them, while the inputs to a process already
+// exist. Edges decided by the tie-break are marked Ambiguous, and every graph carries DirectionNote so
+// API clients know the directions are inferred.
+//
+// Lineage is walked separately upstream and downstream from the starting point, so going up to a
+// process and back down to its other outputs never happens. The files attached to each sample in the
+// lineage are always included, they don't count towards the depth. A file's lineage is the lineage of
+// the samples it is attached to.
+package provenance
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"gorm.io/gorm"
+)
+
+// Direction is which way from the starting point lineage is followed.
+type Direction string
+
+const (
+	Upstream   Direction = "upstream"
+	Downstream Direction = "downstream"
+	Both       Direction = "both"
+)
+
+// DefaultDepth is the depth lineage is followed to when none is given.
+const DefaultDepth = 3
+
+// ParseDirection returns the Direction named by s. An empty s is Both.
+func ParseDirection(s string) (Direction, error) {
+	switch d := Direction(s); d {
+	case "":
+		return Both, nil
+	case Upstream, Downstream, Both:
+		return d, nil
+	default:
+		return "", fmt.Errorf("unknown direction %q", s)
+	}
+}
+
+type Service struct {
+	entityStor   stor.EntityStor
+	activityStor stor.ActivityStor
+	fileStor     stor.FileStor
+}
+
+func NewService(entityStor stor.EntityStor, activityStor stor.ActivityStor, fileStor stor.FileStor) *Service {
+	return &Service{entityStor: entityStor, activityStor: activityStor, fileStor: fileStor}
+}
+
+// SampleLineage returns the lineage of the sample in the project, following direction to depth steps
+// away from it. Each process and each sample is one step. An entity that isn't in the project returns
+// an error matching gorm.ErrRecordNotFound.
+func (s *Service) SampleLineage(projectID, entityID int, direction Direction, depth int) (*Graph, error) {
+	if err := checkArgs(direction, depth); err != nil {
+		return nil, err
+	}
+
+	entity, err := s.entityStor.GetProjectEntityByID(projectID, entityID)
+	if err != nil {
+		return nil, err
+	}
+
+	w := s.newWalk()
+	root := w.graph.addSample(*entity, 0)
+	w.graph.Root = root.ID
+	if err := w.addFiles(root); err != nil {
+		return nil, err
+	}
+
+	w.samples[root.ID] = *entity
+	if err := w.walk([]*Node{root}, direction, depth); err != nil {
+		return nil, err
+	}
+
+	w.graph.sort()
+	return w.graph, nil
+}
+
+// FileLineage returns the lineage of the file in the project. The samples the file is attached to are
+// one step from it, and lineage is followed from them in direction until depth steps from the file. A
+// file that isn't in the project returns an error matching gorm.ErrRecordNotFound.
+func (s *Service) FileLineage(projectID, fileID int, direction Direction, depth int) (*Graph, error) {
+	if err := checkArgs(direction, depth); err != nil {
+		return nil, err
+	}
+
+	file, err := s.fileStor.GetFileByID(fileID)
+	switch {
+	case err != nil:
+		return nil, err
+	case file.ID == 0 || file.ProjectID != projectID || file.IsDir():
+		return nil, fmt.Errorf("file %d not found for project %d: %w", fileID, projectID, gorm.ErrRecordNotFound)
+	}
+
+	if file.Directory, err = s.fileStor.GetFileByID(file.DirectoryID); err != nil {
+		return nil, fmt.Errorf("unable to get directory for file %d: %w", fileID, err)
+	}
+
+	entities, err := s.entityStor.ListFileEntities(file.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	w := s.newWalk()
+	root := w.graph.addFile(*file, 0)
+	w.graph.Root = root.ID
+
+	var samples []*Node
+	for _, entity := range entities {
+		sample := w.graph.addSample(entity, 1)
+		w.samples[sample.ID] = entity
+		w.graph.addEdge(Edge{From: sample.ID, To: root.ID, Kind: EdgeFile})
+		if err := w.addFiles(sample); err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+
+	if err := w.walk(samples, direction, depth); err != nil {
+		return nil, err
+	}
+
+	w.graph.sort()
+	return w.graph, nil
+}
+
+func checkArgs(direction Direction, depth int) error {
+	if _, err := ParseDirection(string(direction)); err != nil {
+		return err
+	}
+
+	if depth < 1 {
+		return fmt.Errorf("depth must be at least 1, got %d", depth)
+	}
+
+	return nil
+}
+
+// walk holds the state of building a single lineage graph.
+type walk struct {
+	*Service
+	graph *Graph
+
+	// The samples and processes loaded so far, keyed by node id. Lineage in each direction is followed
+	// from a node once, the first time it's reached, which is also the closest to the root.
+	samples    map[string]mcmodel.Entity
+	processes  map[string]mcmodel.Activity
+	followed   map[Direction]map[string]bool
+	filesAdded map[string]bool
+}
+
+func (s *Service) newWalk() *walk {
+	return &walk{
+		Service:    s,
+		graph:      newGraph(),
+		samples:    make(map[string]mcmodel.Entity),
+		processes:  make(map[string]mcmodel.Activity),
+		followed:   map[Direction]map[string]bool{Upstream: {}, Downstream: {}},
+		filesAdded: make(map[string]bool),
+	}
+}
+
+// walk follows lineage from the start samples in direction, breadth first, until depth steps from the
+// root.
+func (w *walk) walk(start []*Node, direction Direction, depth int) error {
+	for _, d := range []Direction{Upstream, Downstream} {
+		if direction != Both && direction != d {
+			continue
+		}
+
+		queue := append([]*Node(nil), start...)
+		for len(queue) != 0 {
+			n := queue[0]
+			queue = queue[1:]
+			if n.Depth >= depth || w.followed[d][n.ID] {
+				continue
+			}
+			w.followed[d][n.ID] = true
+
+			var (
+				next []*Node
+				err  error
+			)
+			if n.Kind == KindSample {
+				next, err = w.sampleProcesses(n, d)
+			} else {
+				next, err = w.processSamples(n, d)
+			}
+			if err != nil {
+				return err
+			}
+
+			queue = append(queue, next...)
+		}
+	}
+
+	return nil
+}
+
+// sampleProcesses adds the processes that produced the sample (upstream) or that it was used in
+// (downstream), and returns their nodes.
+func (w *walk) sampleProcesses(n *Node, d Direction) ([]*Node, error) {
+	entity := w.samples[n.ID]
+	activities, err := w.entityStor.ListEntityActivities(entity.ID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list processes for sample %d: %w", entity.ID, err)
+	}
+
+	var next []*Node
+	for _, activity := range activities {
+		output, tie := isOutput(entity, activity)
+		if output != (d == Upstream) {
+			continue
+		}
+
+		p := w.graph.addProcess(activity, n.Depth+1)
+		w.processes[p.ID] = activity
+		if output {
+			w.graph.addEdge(Edge{From: p.ID, To: n.ID, Kind: EdgeOutput, Ambiguous: tie})
+		} else {
+			w.graph.addEdge(Edge{From: n.ID, To: p.ID, Kind: EdgeInput, Ambiguous: tie})
+		}
+		next = append(next, p)
+	}
+
+	return next, nil
+}
+
+// processSamples adds the samples that were inputs to the process (upstream) or outputs of it
+// (downstream), along with their files, and returns their nodes.
+func (w *walk) processSamples(n *Node, d Direction) ([]*Node, error) {
+	activity := w.processes[n.ID]
+	entities, err := w.activityStor.ListActivityEntities(activity.ID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list samples for process %d: %w", activity.ID, err)
+	}
+
+	var next []*Node
+	for _, entity := range entities {
+		output, tie := isOutput(entity, activity)
+		if output != (d == Downstream) {
+			continue
+		}
+
+		sample := w.graph.addSample(entity, n.Depth+1)
+		w.samples[sample.ID] = entity
+		if output {
+			w.graph.addEdge(Edge{From: n.ID, To: sample.ID, Kind: EdgeOutput, Ambiguous: tie})
+		} else {
+			w.graph.addEdge(Edge{From: sample.ID, To: n.ID, Kind: EdgeInput, Ambiguous: tie})
+		}
+
+		if err := w.addFiles(sample); err != nil {
+			return nil, err
+		}
+		next = append(next, sample)
+	}
+
+	return next, nil
+}
+
+// addFiles adds the files attached to the sample.
+func (w *walk) addFiles(sample *Node) error {
+	if w.filesAdded[sample.ID] {
+		return nil
+	}
+	w.filesAdded[sample.ID] = true
+
+	files, err := w.entityStor.ListEntityFiles(sample.ItemID)
+	if err != nil {
+		return fmt.Errorf("unable to list files for sample %d: %w", sample.ItemID, err)
+	}
+
+	for _, file := range files {
+		f := w.graph.addFile(file, sample.Depth)
+		w.graph.addEdge(Edge{From: sample.ID, To: f.ID, Kind: EdgeFile})
+	}
+
+	return nil
+}
+
+// isOutput returns true when the entity is inferred to be an output of the activity rather than an
+// input to it. tie is true when they were created in the same second, and output was decided by the
+// tie-break.
+func isOutput(entity mcmodel.Entity, activity mcmodel.Activity) (output, tie bool) {
+	entityCreated := entity.CreatedAt.Truncate(time.Second)
+	activityCreated := activity.CreatedAt.Truncate(time.Second)
+	if entityCreated.Equal(activityCreated) {
+		return true, true
+	}
+
+	return entityCreated.After(activityCreated), false
+}
@@ -0,0 +1,247 @@
+package provenance
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type fixture struct {
+	service *Service
+	proj    *mcmodel.Project
+	other   *mcmodel.Project
+
+	// raw and lubricant are cast into ingot, ingot is rolled into sheet, and sheet is annealed into
+	// annealed.
+	raw, lubricant, ingot, sheet, annealed *mcmodel.Entity
+	cast, roll, anneal                     *mcmodel.Activity
+	spec, micrograph                       *mcmodel.File
+}
+
+func newFixture(t *testing.T) *fixture {
+	db := mcdbtest.NewDB(t)
+	b := mcdbtest.NewBuilder(t, db)
+	user := b.User("user1")
+	f := &fixture{proj: b.Project("proj1", user), other: b.Project("proj2", user)}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(model interface{}, hours int) {
+		require.NoError(t, db.Model(model).Update("created_at", start.Add(time.Duration(hours)*time.Hour)).Error)
+	}
+
+	f.raw = b.Entity(f.proj, "Raw Mg")
+	at(f.raw, 0)
+	f.lubricant = b.Entity(f.proj, "Lubricant")
+	at(f.lubricant, 0)
+
+	f.cast = b.Activity(f.proj, "Cast")
+	at(f.cast, 1)
+	b.Link(f.cast, f.raw)
+	f.ingot = b.Entity(f.proj, "Ingot \"A\"")
+	at(f.ingot, 1)
+	b.Link(f.cast, f.ingot)
+
+	f.roll = b.Activity(f.proj, "Roll")
+	at(f.roll, 2)
+	b.Link(f.roll, f.ingot)
+	b.Link(f.roll, f.lubricant)
+	f.sheet = b.Entity(f.proj, "Sheet")
+	at(f.sheet, 3)
+	b.Link(f.roll, f.sheet)
+
+	f.anneal = b.Activity(f.proj, "Anneal")
+	at(f.anneal, 4)
+	b.Link(f.anneal, f.sheet)
+	f.annealed = b.Entity(f.proj, "Annealed Sheet")
+	at(f.annealed, 4)
+	b.Link(f.anneal, f.annealed)
+
+	f.spec = b.File(f.proj, f.proj.RootDir, "spec.pdf", 10)
+	b.AddFileToEntity(f.raw, f.spec)
+	images := b.Dir(f.proj, f.proj.RootDir, "images")
+	f.micrograph = b.File(f.proj, images, "sheet.tif", 10)
+	b.AddFileToEntity(f.sheet, f.micrograph)
+
+	stors := stor.NewGormStors(db, t.TempDir())
+	f.service = NewService(stors.EntityStor, stors.ActivityStor, stors.FileStor)
+	return f
+}
+
+func TestSampleLineage(t *testing.T) {
+	f := newFixture(t)
+
+	t.Run("Upstream", func(t *testing.T) {
+		g, err := f.service.SampleLineage(f.proj.ID, f.sheet.ID, Upstream, 10)
+		require.NoError(t, err)
+		require.Equal(t, SampleNodeID(f.sheet.ID), g.Root)
+		require.Equal(t, []string{
+			SampleNodeID(f.sheet.ID), FileNodeID(f.micrograph.ID),
+			ProcessNodeID(f.roll.ID),
+			SampleNodeID(f.lubricant.ID), SampleNodeID(f.ingot.ID),
+			ProcessNodeID(f.cast.ID),
+			SampleNodeID(f.raw.ID), FileNodeID(f.spec.ID),
+		}, nodeIDs(g))
+
+		require.ElementsMatch(t, []Edge{
+			{From: SampleNodeID(f.sheet.ID), To: FileNodeID(f.micrograph.ID), Kind: EdgeFile},
+			{From: ProcessNodeID(f.roll.ID), To: SampleNodeID(f.sheet.ID), Kind: EdgeOutput},
+			{From: SampleNodeID(f.ingot.ID), To: ProcessNodeID(f.roll.ID), Kind: EdgeInput},
+			{From: SampleNodeID(f.lubricant.ID), To: ProcessNodeID(f.roll.ID), Kind: EdgeInput},
+			{From: ProcessNodeID(f.cast.ID), To: SampleNodeID(f.ingot.ID), Kind: EdgeOutput, Ambiguous: true},
+			{From: SampleNodeID(f.raw.ID), To: ProcessNodeID(f.cast.ID), Kind: EdgeInput},
+			{From: SampleNodeID(f.raw.ID), To: FileNodeID(f.spec.ID), Kind: EdgeFile},
+		}, g.Edges)
+
+		require.Equal(t, 4, g.Node(SampleNodeID(f.raw.ID)).Depth)
+		require.Equal(t, "/spec.pdf", g.Node(FileNodeID(f.spec.ID)).Path)
+	})
+
+	t.Run("Depth", func(t *testing.T) {
+		g, err := f.service.SampleLineage(f.proj.ID, f.sheet.ID, Upstream, 2)
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			SampleNodeID(f.sheet.ID), FileNodeID(f.micrograph.ID),
+			ProcessNodeID(f.roll.ID),
+			SampleNodeID(f.lubricant.ID), SampleNodeID(f.ingot.ID),
+		}, nodeIDs(g))
+	})
+
+	t.Run("Downstream", func(t *testing.T) {
+		// The lubricant was also an input to rolling, but it isn't downstream of the ingot.
+		g, err := f.service.SampleLineage(f.proj.ID, f.ingot.ID, Downstream, 10)
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			SampleNodeID(f.ingot.ID),
+			ProcessNodeID(f.roll.ID),
+			SampleNodeID(f.sheet.ID), FileNodeID(f.micrograph.ID),
+			ProcessNodeID(f.anneal.ID),
+			SampleNodeID(f.annealed.ID),
+		}, nodeIDs(g))
+	})
+
+	t.Run("Both", func(t *testing.T) {
+		g, err := f.service.SampleLineage(f.proj.ID, f.sheet.ID, Both, 1)
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			SampleNodeID(f.sheet.ID), FileNodeID(f.micrograph.ID),
+			ProcessNodeID(f.roll.ID), ProcessNodeID(f.anneal.ID),
+		}, nodeIDs(g))
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := f.service.SampleLineage(f.other.ID, f.sheet.ID, Both, 1)
+		require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+		_, err = f.service.SampleLineage(f.proj.ID, f.sheet.ID, Both, 0)
+		require.Error(t, err)
+
+		_, err = f.service.SampleLineage(f.proj.ID, f.sheet.ID, "sideways", 1)
+		require.Error(t, err)
+	})
+}
+
+func TestFileLineage(t *testing.T) {
+	f := newFixture(t)
+
+	g, err := f.service.FileLineage(f.proj.ID, f.micrograph.ID, Both, 2)
+	require.NoError(t, err)
+	require.Equal(t, FileNodeID(f.micrograph.ID), g.Root)
+	require.Equal(t, []string{
+		FileNodeID(f.micrograph.ID),
+		SampleNodeID(f.sheet.ID),
+		ProcessNodeID(f.roll.ID), ProcessNodeID(f.anneal.ID),
+	}, nodeIDs(g))
+	require.Contains(t, g.Edges, Edge{From: SampleNodeID(f.sheet.ID), To: FileNodeID(f.micrograph.ID), Kind: EdgeFile})
+
+	_, err = f.service.FileLineage(f.other.ID, f.micrograph.ID, Both, 2)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	_, err = f.service.FileLineage(f.proj.ID, f.proj.RootDir.ID, Both, 2)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestIsOutput(t *testing.T) {
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	activity := mcmodel.Activity{CreatedAt: created.Add(100 * time.Millisecond)}
+
+	var tests = []struct {
+		name          string
+		entityCreated time.Time
+		output, tie   bool
+	}{
+		{name: "Created a second before", entityCreated: created.Add(-time.Second), output: false, tie: false},
+		{name: "Created a second after", entityCreated: created.Add(time.Second), output: true, tie: false},
+		{name: "Created at the same time", entityCreated: activity.CreatedAt, output: true, tie: true},
+		// Sub-second differences aren't kept by the database, so they are a tie too.
+		{name: "Created earlier in the same second", entityCreated: created, output: true, tie: true},
+		{name: "Created later in the same second", entityCreated: created.Add(900 * time.Millisecond), output: true, tie: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, tie := isOutput(mcmodel.Entity{CreatedAt: test.entityCreated}, activity)
+			require.Equal(t, test.output, output)
+			require.Equal(t, test.tie, tie)
+		})
+	}
+}
+
+func TestGraphOutput(t *testing.T) {
+	f := newFixture(t)
+
+	g, err := f.service.SampleLineage(f.proj.ID, f.ingot.ID, Both, 1)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(g)
+	require.NoError(t, err)
+	var decoded Graph
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, g.Root, decoded.Root)
+	require.Equal(t, DirectionNote, decoded.Note)
+	require.Equal(t, g.Edges, decoded.Edges)
+	require.Len(t, decoded.Nodes, 3)
+	require.Equal(t, "Ingot \"A\"", decoded.Nodes[0].Name)
+
+	ingot := dotID(SampleNodeID(f.ingot.ID))
+	cast := dotID(ProcessNodeID(f.cast.ID))
+	roll := dotID(ProcessNodeID(f.roll.ID))
+	require.Equal(t, strings.Join([]string{
+		"// " + DirectionNote,
+		"digraph provenance {",
+		"  rankdir=LR;",
+		"  " + ingot + ` [label="Ingot \"A\"", shape=ellipse, style=filled, fillcolor=lightyellow];`,
+		"  " + cast + ` [label="Cast", shape=box];`,
+		"  " + roll + ` [label="Roll", shape=box];`,
+		"  " + ingot + " -> " + roll + ";",
+		"  " + cast + " -> " + ingot + " [style=dotted];",
+		"}",
+		"",
+	}, "\n"), g.DOT())
+}
+
+// nodeIDs returns the ids of the graph's nodes in order, with the nodes at the same depth and of the
+// same kind sorted by id so the expectations don't depend on the order ids were assigned.
+func nodeIDs(g *Graph) []string {
+	var ids []string
+	for _, n := range g.Nodes {
+		ids = append(ids, n.ID)
+	}
+
+	sort.SliceStable(ids, func(i, j int) bool {
+		a, b := g.Node(ids[i]), g.Node(ids[j])
+		if a.Depth != b.Depth || a.Kind != b.Kind {
+			return false
+		}
+		return a.ID < b.ID
+	})
+
+	return ids
+}
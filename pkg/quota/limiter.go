@@ -0,0 +1,56 @@
+// Package quota enforces storage quotas on writes where the final size isn't known up front, such as
+// SFTP and WebDAV uploads.
+package quota
+
+import (
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+)
+
+// A Limiter tracks how far a single upload has written against the quota that was remaining when the
+// upload started. It is not safe for concurrent use.
+type Limiter struct {
+	usage    mcmodel.QuotaUsage
+	size     int64
+	exceeded bool
+}
+
+// NewLimiter creates a Limiter for an upload by userID into projectID.
+func NewLimiter(quotaStor stor.QuotaStor, projectID, userID int) (*Limiter, error) {
+	usage, err := quotaStor.GetRemainingQuota(projectID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Limiter{usage: *usage}, nil
+}
+
+// Extend records that the upload now extends to end bytes. Writes can arrive out of order, so the upload
+// size is the largest end seen. It returns a *stor.QuotaExceededError once the size goes over the quota,
+// and keeps returning it for every later call.
+func (l *Limiter) Extend(end int64) error {
+	if end > l.size {
+		l.size = end
+	}
+
+	if !l.usage.IsLimited() {
+		return nil
+	}
+
+	if l.exceeded || l.size > l.usage.RemainingBytes() {
+		l.exceeded = true
+		return &stor.QuotaExceededError{Usage: l.usage, RequestedBytes: l.size}
+	}
+
+	return nil
+}
+
+// Add records that n more bytes were written to the end of a sequential upload.
+func (l *Limiter) Add(n int64) error {
+	return l.Extend(l.size + n)
+}
+
+// Exceeded returns true if Extend has returned an error. The upload should be discarded rather than saved.
+func (l *Limiter) Exceeded() bool {
+	return l.exceeded
+}
@@ -0,0 +1,30 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	l := &Limiter{usage: mcmodel.QuotaUsage{Scope: mcmodel.QuotaScopeProject, ID: 1, LimitBytes: 100, UsedBytes: 90}}
+
+	// Out of order writes only count the furthest extent.
+	require.NoError(t, l.Extend(10))
+	require.NoError(t, l.Extend(5))
+	require.False(t, l.Exceeded())
+
+	err := l.Add(1)
+	require.True(t, errors.Is(err, stor.ErrQuotaExceeded))
+	require.True(t, l.Exceeded())
+
+	// Once exceeded every write fails.
+	require.Error(t, l.Extend(1))
+
+	unlimited := &Limiter{usage: mcmodel.QuotaUsage{UsedBytes: 1000}}
+	require.NoError(t, unlimited.Add(1<<40))
+	require.False(t, unlimited.Exceeded())
+}
@@ -0,0 +1,57 @@
+package scrub
+
+import (
+	"io"
+	"time"
+)
+
+// rateLimiter keeps reads under a number of bytes per second. It measures from the first read, and
+// sleeps whenever more bytes have been read than the rate allows for the elapsed time.
+type rateLimiter struct {
+	bytesPerSecond int64
+	start          time.Time
+	total          int64
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	return &rateLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+func (l *rateLimiter) reader(r io.Reader) io.Reader {
+	if l.bytesPerSecond <= 0 {
+		return r
+	}
+
+	return &limitedReader{r: r, limiter: l}
+}
+
+func (l *rateLimiter) wait(n int) {
+	if l.start.IsZero() {
+		l.start = time.Now()
+	}
+
+	l.total += int64(n)
+	allowedAt := l.start.Add(time.Duration(float64(l.total) / float64(l.bytesPerSecond) * float64(time.Second)))
+	if delay := time.Until(allowedAt); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+type limitedReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	// Keep individual reads small so the limiter sleeps in short steps.
+	if max := int(lr.limiter.bytesPerSecond); len(p) > max && max > 0 {
+		p = p[:max]
+	}
+
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		lr.limiter.wait(n)
+	}
+
+	return n, err
+}
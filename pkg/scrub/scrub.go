@@ -0,0 +1,298 @@
+// Package scrub verifies that the blob behind every file is present and intact. Each file's blob is
+// re-hashed and compared against the checksums (MD5, and SHA-256 when present) and size stored in the files table. Problems are
+// recorded through FileStor.SetFileHealthMissing, and files previously marked missing whose blob
+// checks out again are cleared through FileStor.SetFileHealthFixed.
+//
+// A scrub is meant to run unattended (for example nightly). Reads can be rate limited so that the
+// scrub doesn't saturate storage, and progress is saved to a state file so that a scrub that is
+// stopped, or that runs out of time, picks up where it left off on the next run.
+package scrub
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/digest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+)
+
+// determinedBy is recorded in the file health fields so it's clear what made the change.
+const determinedBy = "scrubber"
+
+// Kinds of problems a scrub reports.
+const (
+	ProblemMissing          = "missing"
+	ProblemSizeMismatch     = "size-mismatch"
+	ProblemChecksumMismatch = "checksum-mismatch"
+	ProblemRestored         = "restored"
+	ProblemError            = "error"
+)
+
+const defaultBatchSize = 200
+
+type Options struct {
+	// ProjectID limits the scrub to a single project. Zero scrubs every project.
+	ProjectID int
+
+	// BytesPerSecond limits how fast blobs are read. Zero means no limit.
+	BytesPerSecond int64
+
+	// StateFile is where progress is saved. When blank the scrub always starts from the beginning.
+	StateFile string
+
+	// MaxDuration stops the scrub, saving progress, once it has run this long. Zero means no limit.
+	MaxDuration time.Duration
+
+	// DryRun reports problems without updating file health.
+	DryRun bool
+
+	// BatchSize is the number of files loaded from the database at a time.
+	BatchSize int
+}
+
+// Problem describes a file whose blob didn't check out, or whose health was restored.
+type Problem struct {
+	FileID    int    `json:"file_id"`
+	ProjectID int    `json:"project_id"`
+	UUID      string `json:"uuid"`
+	BlobKey   string `json:"blob_key"`
+	Path      string `json:"path"`
+	Kind      string `json:"kind"`
+	Expected  string `json:"expected,omitempty"`
+	Actual    string `json:"actual,omitempty"`
+}
+
+// Report is the result of a scrub. When Complete is false the scrub stopped early, and the next run
+// with the same state file resumes after LastFileID.
+type Report struct {
+	ProjectID    int       `json:"project_id"`
+	DryRun       bool      `json:"dry_run"`
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+	Resumed      bool      `json:"resumed"`
+	Complete     bool      `json:"complete"`
+	LastFileID   int       `json:"last_file_id"`
+	FilesChecked int       `json:"files_checked"`
+	BytesRead    int64     `json:"bytes_read"`
+	Missing      int       `json:"missing"`
+	Corrupted    int       `json:"corrupted"`
+	Restored     int       `json:"restored"`
+	Errors       int       `json:"errors"`
+	Problems     []Problem `json:"problems"`
+}
+
+type Scrubber struct {
+	fileStor stor.FileStor
+	blobs    blobstore.BlobStore
+
+	// verified caches the outcome of checking a blob, so files that share a blob through
+	// uses_uuid don't cause the blob to be read more than once in a run.
+	verified map[string]blobResult
+}
+
+type blobResult struct {
+	exists bool
+	size   int64
+	sums   digest.Sums
+}
+
+func NewScrubber(fileStor stor.FileStor, blobs blobstore.BlobStore) *Scrubber {
+	return &Scrubber{fileStor: fileStor, blobs: blobs}
+}
+
+// Run scrubs the files selected by opts, resuming from the state file if there is one.
+func (s *Scrubber) Run(opts Options) (*Report, error) {
+	if opts.BatchSize == 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+
+	s.verified = make(map[string]blobResult)
+
+	report := &Report{
+		ProjectID: opts.ProjectID,
+		DryRun:    opts.DryRun,
+		StartedAt: time.Now(),
+		Problems:  []Problem{},
+	}
+
+	if opts.StateFile != "" {
+		st, err := loadState(opts.StateFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if st != nil && st.ProjectID == opts.ProjectID {
+			report.LastFileID = st.LastFileID
+			report.Resumed = st.LastFileID != 0
+		}
+	}
+
+	limiter := newRateLimiter(opts.BytesPerSecond)
+
+	for !s.outOfTime(opts, report) {
+		files, err := s.fileStor.ListFilesAfterID(opts.ProjectID, report.LastFileID, opts.BatchSize)
+		if err != nil {
+			return report, fmt.Errorf("unable to list files after %d: %w", report.LastFileID, err)
+		}
+
+		if len(files) == 0 {
+			report.Complete = true
+			break
+		}
+
+		for i := range files {
+			s.checkFile(&files[i], limiter, opts, report)
+			report.LastFileID = files[i].ID
+			if s.outOfTime(opts, report) {
+				break
+			}
+		}
+
+		if err := s.saveProgress(opts, report); err != nil {
+			return report, err
+		}
+	}
+
+	report.FinishedAt = time.Now()
+
+	if err := s.saveProgress(opts, report); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// checkFile verifies a single file's blob, and updates its health when needed.
+func (s *Scrubber) checkFile(file *mcmodel.File, limiter *rateLimiter, opts Options, report *Report) {
+	report.FilesChecked++
+
+	key := file.BlobKey()
+	problem := Problem{
+		FileID:    file.ID,
+		ProjectID: file.ProjectID,
+		UUID:      file.UUID,
+		BlobKey:   key,
+		Path:      file.Path,
+	}
+
+	result, err := s.verifyBlob(key, limiter, report)
+	switch {
+	case err != nil:
+		problem.Kind = ProblemError
+		problem.Actual = err.Error()
+		report.Errors++
+		report.Problems = append(report.Problems, problem)
+		return
+
+	case !result.exists:
+		problem.Kind = ProblemMissing
+		report.Missing++
+
+	case uint64(result.size) != file.Size:
+		problem.Kind = ProblemSizeMismatch
+		problem.Expected = fmt.Sprintf("%d", file.Size)
+		problem.Actual = fmt.Sprintf("%d", result.size)
+		report.Corrupted++
+
+	case file.Checksum != "" && result.sums.MD5 != file.Checksum:
+		problem.Kind = ProblemChecksumMismatch
+		problem.Expected = file.Checksum
+		problem.Actual = result.sums.MD5
+		report.Corrupted++
+
+	case file.Sha256 != "" && result.sums.SHA256 != file.Sha256:
+		problem.Kind = ProblemChecksumMismatch
+		problem.Expected = file.Sha256
+		problem.Actual = result.sums.SHA256
+		report.Corrupted++
+
+	case file.Health == "missing":
+		// The blob is back and intact.
+		problem.Kind = ProblemRestored
+		report.Restored++
+		report.Problems = append(report.Problems, problem)
+		if !opts.DryRun {
+			if _, err := s.fileStor.SetFileHealthFixed(file, determinedBy, ""); err != nil {
+				log.Errorf("Unable to clear health for file %d: %s", file.ID, err)
+			}
+		}
+		return
+
+	default:
+		return
+	}
+
+	report.Problems = append(report.Problems, problem)
+
+	if opts.DryRun || file.Health == "missing" {
+		return
+	}
+
+	if _, err := s.fileStor.SetFileHealthMissing(file, determinedBy+":"+problem.Kind, ""); err != nil {
+		log.Errorf("Unable to set health for file %d: %s", file.ID, err)
+	}
+}
+
+// verifyBlob stats and hashes the blob at key. A missing blob is not an error, it is reported
+// through blobResult.exists.
+func (s *Scrubber) verifyBlob(key string, limiter *rateLimiter, report *Report) (blobResult, error) {
+	if result, ok := s.verified[key]; ok {
+		return result, nil
+	}
+
+	var result blobResult
+
+	info, err := s.blobs.Stat(key)
+	switch {
+	case blobstore.IsNotExist(err):
+		s.verified[key] = result
+		return result, nil
+	case err != nil:
+		return result, err
+	}
+
+	r, err := s.blobs.Open(key, 0)
+	if err != nil {
+		return result, err
+	}
+	defer r.Close()
+
+	hasher := digest.New()
+	n, err := io.Copy(hasher, limiter.reader(r))
+	report.BytesRead += n
+	if err != nil {
+		return result, err
+	}
+
+	result = blobResult{exists: true, size: info.Size, sums: hasher.Sums()}
+	s.verified[key] = result
+	return result, nil
+}
+
+// outOfTime returns true once the scrub has run for longer than opts.MaxDuration.
+func (s *Scrubber) outOfTime(opts Options, report *Report) bool {
+	return opts.MaxDuration != 0 && time.Since(report.StartedAt) > opts.MaxDuration
+}
+
+func (s *Scrubber) saveProgress(opts Options, report *Report) error {
+	if opts.StateFile == "" {
+		return nil
+	}
+
+	st := &state{
+		ProjectID:  opts.ProjectID,
+		LastFileID: report.LastFileID,
+		UpdatedAt:  time.Now(),
+	}
+
+	if report.Complete {
+		// Start over next time.
+		st.LastFileID = 0
+	}
+
+	return st.save(opts.StateFile)
+}
@@ -0,0 +1,164 @@
+package scrub
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/materials-commons/hydra/pkg/blobstore"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcdbtest"
+	"github.com/materials-commons/hydra/pkg/mcdb/mcmodel"
+	"github.com/materials-commons/hydra/pkg/mcdb/stor"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestScrubber(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+
+	root := t.TempDir()
+	blobs := blobstore.NewLocalBlobStore(root)
+	fileStor := stor.NewGormFileStorWithBlobStore(db, root, blobs)
+
+	good := createFile(t, db, blobs, "00000000-aaaa-0000-0000-000000000001", "good", "good", "")
+	sharing := createFile(t, db, blobs, "00000000-aaab-0000-0000-000000000002", "good", "", "")
+	missing := createFile(t, db, blobs, "00000000-aaac-0000-0000-000000000003", "missing", "", "")
+	wrongSize := createFile(t, db, blobs, "00000000-aaad-0000-0000-000000000004", "wrong-size", "short", "")
+	wrongChecksum := createFile(t, db, blobs, "00000000-aaae-0000-0000-000000000005", "abcdef", "ABCDEF", "")
+	restored := createFile(t, db, blobs, "00000000-aaaf-0000-0000-000000000006", "restored", "restored", "missing")
+	require.NoError(t, db.Model(sharing).Update("uses_uuid", good.UUID).Error)
+	require.NoError(t, db.Create(&mcmodel.File{UUID: "00000000-ffff-0000-0000-000000000007", Name: "dir", MimeType: "directory", ProjectID: 1}).Error)
+
+	stateFile := filepath.Join(t.TempDir(), "scrub.json")
+	report, err := NewScrubber(fileStor, blobs).Run(Options{DryRun: true, StateFile: stateFile, BatchSize: 2})
+	require.NoError(t, err)
+	require.True(t, report.Complete)
+	require.False(t, report.Resumed)
+	require.Equal(t, 6, report.FilesChecked)
+	require.Equal(t, 1, report.Missing)
+	require.Equal(t, 2, report.Corrupted)
+	require.Equal(t, 1, report.Restored)
+	require.Equal(t, 0, report.Errors)
+	// The shared blob is only read once.
+	require.Equal(t, int64(len("good")+len("short")+len("ABCDEF")+len("restored")), report.BytesRead)
+
+	kinds := make(map[int]string)
+	for _, p := range report.Problems {
+		kinds[p.FileID] = p.Kind
+	}
+	require.Equal(t, map[int]string{
+		missing.ID:       ProblemMissing,
+		wrongSize.ID:     ProblemSizeMismatch,
+		wrongChecksum.ID: ProblemChecksumMismatch,
+		restored.ID:      ProblemRestored,
+	}, kinds)
+
+	// A dry run doesn't touch file health.
+	require.Equal(t, "", reload(t, db, missing.ID).Health)
+
+	report, err = NewScrubber(fileStor, blobs).Run(Options{StateFile: stateFile})
+	require.NoError(t, err)
+	require.True(t, report.Complete)
+
+	require.Equal(t, "", reload(t, db, good.ID).Health)
+	require.Equal(t, "missing", reload(t, db, missing.ID).Health)
+	require.Equal(t, "scrubber:missing", reload(t, db, missing.ID).FileMissingDeterminedBy)
+	require.Equal(t, "missing", reload(t, db, wrongSize.ID).Health)
+	require.Equal(t, "scrubber:checksum-mismatch", reload(t, db, wrongChecksum.ID).FileMissingDeterminedBy)
+	require.Equal(t, "fixed", reload(t, db, restored.ID).Health)
+
+	// Once the missing blob reappears the next scrub clears it.
+	writeBlob(t, blobs, missing.BlobKey(), "missing")
+	report, err = NewScrubber(fileStor, blobs).Run(Options{ProjectID: 1})
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Restored)
+	fixed := reload(t, db, missing.ID)
+	require.Equal(t, "fixed", fixed.Health)
+	require.False(t, fixed.HealthFixedAt.IsZero())
+	require.True(t, fixed.FileMissingAt.IsZero())
+}
+
+func TestScrubberResumes(t *testing.T) {
+	db := mcdbtest.NewDB(t)
+
+	root := t.TempDir()
+	blobs := blobstore.NewLocalBlobStore(root)
+	fileStor := stor.NewGormFileStorWithBlobStore(db, root, blobs)
+
+	var files []*mcmodel.File
+	for _, uuid := range []string{
+		"00000000-bbba-0000-0000-000000000001",
+		"00000000-bbbb-0000-0000-000000000002",
+		"00000000-bbbc-0000-0000-000000000003",
+	} {
+		files = append(files, createFile(t, db, blobs, uuid, "data", "data", ""))
+	}
+
+	stateFile := filepath.Join(t.TempDir(), "scrub.json")
+	require.NoError(t, (&state{LastFileID: files[0].ID, UpdatedAt: time.Now()}).save(stateFile))
+
+	report, err := NewScrubber(fileStor, blobs).Run(Options{StateFile: stateFile})
+	require.NoError(t, err)
+	require.True(t, report.Resumed)
+	require.Equal(t, 2, report.FilesChecked)
+
+	// A completed scrub starts over on the next run.
+	st, err := loadState(stateFile)
+	require.NoError(t, err)
+	require.Equal(t, 0, st.LastFileID)
+
+	// A state file for a different project is ignored.
+	require.NoError(t, (&state{ProjectID: 5, LastFileID: files[1].ID}).save(stateFile))
+	report, err = NewScrubber(fileStor, blobs).Run(Options{StateFile: stateFile})
+	require.NoError(t, err)
+	require.False(t, report.Resumed)
+	require.Equal(t, 3, report.FilesChecked)
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(1000)
+	start := time.Now()
+	limiter.wait(500)
+	limiter.wait(500)
+	require.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+}
+
+// createFile creates a file row whose checksum and size describe content, and stores blobContent
+// as its blob. A blank blobContent leaves the blob missing.
+func createFile(t *testing.T, db *gorm.DB, blobs *blobstore.LocalBlobStore, uuid, content, blobContent, health string) *mcmodel.File {
+	sum := md5.Sum([]byte(content))
+	f := &mcmodel.File{
+		UUID:      uuid,
+		ProjectID: 1,
+		Name:      uuid,
+		Path:      "/" + uuid,
+		MimeType:  "text/plain",
+		Size:      uint64(len(content)),
+		Checksum:  hex.EncodeToString(sum[:]),
+		Current:   true,
+		Health:    health,
+	}
+	require.NoError(t, db.Create(f).Error)
+
+	if blobContent != "" {
+		writeBlob(t, blobs, f.BlobKey(), blobContent)
+	}
+
+	return f
+}
+
+func writeBlob(t *testing.T, blobs blobstore.BlobStore, key, content string) {
+	w, err := blobs.Create(key)
+	require.NoError(t, err)
+	_, err = w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+}
+
+func reload(t *testing.T, db *gorm.DB, id int) mcmodel.File {
+	var f mcmodel.File
+	require.NoError(t, db.First(&f, id).Error)
+	return f
+}
@@ -0,0 +1,61 @@
+package scrub
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// state is the progress of a scrub, saved after every batch of files.
+type state struct {
+	ProjectID  int       `json:"project_id"`
+	LastFileID int       `json:"last_file_id"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// loadState reads the state file. It returns nil when there is no state file yet.
+func loadState(path string) (*state, error) {
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("unable to read scrub state %s: %w", path, err)
+	}
+
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("unable to parse scrub state %s: %w", path, err)
+	}
+
+	return &st, nil
+}
+
+// save writes the state to a temporary file and renames it into place, so a crash
+// never leaves a partially written state file behind.
+func (st *state) save(path string) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to save scrub state: %w", err)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("unable to save scrub state: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("unable to save scrub state: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
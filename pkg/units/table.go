@@ -0,0 +1,161 @@
+package units
+
+import "strings"
+
+// unitDef defines a unit, its aliases are other symbols and names it is written as.
+type unitDef struct {
+	symbol  string
+	aliases []string
+	scale   float64
+	offset  float64
+}
+
+var definitions = map[Dimension][]unitDef{
+	Temperature: {
+		{symbol: "K", aliases: []string{"kelvin", "kelvins"}, scale: 1},
+		{symbol: "°C", aliases: []string{"C", "celsius", "centigrade"}, scale: 1, offset: 273.15},
+		{symbol: "°F", aliases: []string{"F", "fahrenheit"}, scale: 5.0 / 9.0, offset: 273.15 - 32*5.0/9.0},
+		{symbol: "°R", aliases: []string{"rankine"}, scale: 5.0 / 9.0},
+	},
+	Length: {
+		{symbol: "m", aliases: []string{"meter", "meters", "metre", "metres"}, scale: 1},
+		{symbol: "km", aliases: []string{"kilometer", "kilometers"}, scale: 1e3},
+		{symbol: "cm", aliases: []string{"centimeter", "centimeters"}, scale: 1e-2},
+		{symbol: "mm", aliases: []string{"millimeter", "millimeters"}, scale: 1e-3},
+		{symbol: "µm", aliases: []string{"μm", "um", "micron", "microns", "micrometer", "micrometers"}, scale: 1e-6},
+		{symbol: "nm", aliases: []string{"nanometer", "nanometers"}, scale: 1e-9},
+		{symbol: "pm", aliases: []string{"picometer", "picometers"}, scale: 1e-12},
+		{symbol: "Å", aliases: []string{"angstrom", "angstroms"}, scale: 1e-10},
+		{symbol: "in", aliases: []string{"inch", "inches"}, scale: 0.0254},
+		{symbol: "ft", aliases: []string{"foot", "feet"}, scale: 0.3048},
+	},
+	Time: {
+		{symbol: "s", aliases: []string{"sec", "secs", "second", "seconds"}, scale: 1},
+		{symbol: "ms", aliases: []string{"millisecond", "milliseconds"}, scale: 1e-3},
+		{symbol: "µs", aliases: []string{"μs", "us", "microsecond", "microseconds"}, scale: 1e-6},
+		{symbol: "ns", aliases: []string{"nanosecond", "nanoseconds"}, scale: 1e-9},
+		{symbol: "min", aliases: []string{"mins", "minute", "minutes"}, scale: 60},
+		{symbol: "h", aliases: []string{"hr", "hrs", "hour", "hours"}, scale: 3600},
+		{symbol: "d", aliases: []string{"day", "days"}, scale: 86400},
+		{symbol: "wk", aliases: []string{"week", "weeks"}, scale: 7 * 86400},
+	},
+	Pressure: {
+		{symbol: "Pa", aliases: []string{"pascal", "pascals"}, scale: 1},
+		{symbol: "kPa", scale: 1e3},
+		{symbol: "MPa", scale: 1e6},
+		{symbol: "GPa", scale: 1e9},
+		{symbol: "bar", aliases: []string{"bars"}, scale: 1e5},
+		{symbol: "mbar", scale: 1e2},
+		{symbol: "atm", scale: 101325},
+		{symbol: "Torr", aliases: []string{"mmHg"}, scale: 101325.0 / 760},
+		{symbol: "psi", scale: 6894.757293168},
+		{symbol: "ksi", scale: 6894757.293168},
+	},
+	Energy: {
+		{symbol: "J", aliases: []string{"joule", "joules"}, scale: 1},
+		{symbol: "kJ", scale: 1e3},
+		{symbol: "MJ", scale: 1e6},
+		{symbol: "eV", aliases: []string{"electronvolt", "electronvolts"}, scale: 1.602176634e-19},
+		{symbol: "meV", scale: 1.602176634e-22},
+		{symbol: "keV", scale: 1.602176634e-16},
+		{symbol: "MeV", scale: 1.602176634e-13},
+		{symbol: "cal", aliases: []string{"calorie", "calories"}, scale: 4.184},
+		{symbol: "kcal", scale: 4184},
+		{symbol: "Wh", scale: 3600},
+		{symbol: "kWh", scale: 3.6e6},
+	},
+	Mass: {
+		{symbol: "kg", aliases: []string{"kilogram", "kilograms"}, scale: 1},
+		{symbol: "g", aliases: []string{"gram", "grams"}, scale: 1e-3},
+		{symbol: "mg", aliases: []string{"milligram", "milligrams"}, scale: 1e-6},
+		{symbol: "µg", aliases: []string{"μg", "ug", "microgram", "micrograms"}, scale: 1e-9},
+		{symbol: "t", aliases: []string{"tonne", "tonnes"}, scale: 1e3},
+		{symbol: "lb", aliases: []string{"lbs", "pound", "pounds"}, scale: 0.45359237},
+	},
+	Fraction: {
+		{symbol: "1", aliases: []string{"fraction"}, scale: 1},
+		{symbol: "%", aliases: []string{"percent"}, scale: 1e-2},
+		{symbol: "ppm", scale: 1e-6},
+		{symbol: "ppb", scale: 1e-9},
+	},
+	MassFraction: {
+		{symbol: "wt%", aliases: []string{"wt.%", "wt %", "wt. %", "weight percent", "mass%", "mass %"}, scale: 1},
+		{symbol: "ppmw", aliases: []string{"wppm"}, scale: 1e-4},
+	},
+	AtomicFraction: {
+		{symbol: "at%", aliases: []string{"at.%", "at %", "at. %", "atomic percent"}, scale: 1},
+		{symbol: "ppma", aliases: []string{"appm"}, scale: 1e-4},
+	},
+	MolarFraction: {
+		{symbol: "mol%", aliases: []string{"mol.%", "mol %", "mole percent"}, scale: 1},
+	},
+	VolumeFraction: {
+		{symbol: "vol%", aliases: []string{"vol.%", "vol %", "volume percent"}, scale: 1},
+	},
+	MolarConcentration: {
+		{symbol: "mol/m^3", aliases: []string{"mol/m3"}, scale: 1},
+		{symbol: "mol/L", aliases: []string{"M", "molar"}, scale: 1e3},
+		{symbol: "mmol/L", aliases: []string{"mM", "millimolar"}, scale: 1},
+		{symbol: "µmol/L", aliases: []string{"μM", "uM", "micromolar"}, scale: 1e-3},
+	},
+	MassConcentration: {
+		{symbol: "kg/m^3", aliases: []string{"kg/m3"}, scale: 1},
+		{symbol: "g/L", aliases: []string{"g/l"}, scale: 1},
+		{symbol: "g/cm^3", aliases: []string{"g/cm3", "g/cc"}, scale: 1e3},
+		{symbol: "mg/L", aliases: []string{"mg/l"}, scale: 1e-3},
+	},
+	AmountOfSubstance: {
+		{symbol: "mol", aliases: []string{"mole", "moles"}, scale: 1},
+		{symbol: "mmol", scale: 1e-3},
+	},
+	NumberConcentration: {
+		{symbol: "m^-3", aliases: []string{"1/m^3", "/m^3", "1/m3"}, scale: 1},
+		{symbol: "cm^-3", aliases: []string{"1/cm^3", "/cm^3", "1/cm3", "/cc"}, scale: 1e6},
+	},
+}
+
+var (
+	bySymbol       = make(map[string]Unit)
+	byFoldedSymbol = make(map[string]Unit)
+	baseUnits      = make(map[Dimension]Unit)
+)
+
+func init() {
+	folded := make(map[string][]Unit)
+	for dimension, defs := range definitions {
+		for _, def := range defs {
+			u := Unit{Symbol: def.symbol, Dimension: dimension, Scale: def.scale, Offset: def.offset}
+			if def.scale == 1 && def.offset == 0 {
+				if _, ok := baseUnits[dimension]; !ok {
+					baseUnits[dimension] = u
+				}
+			}
+
+			for _, name := range append([]string{def.symbol}, def.aliases...) {
+				if _, ok := bySymbol[name]; ok {
+					panic("units: " + name + " is defined twice")
+				}
+				bySymbol[name] = u
+				lower := strings.ToLower(name)
+				folded[lower] = appendUnique(folded[lower], u)
+			}
+		}
+	}
+
+	// Only names that can't be confused with another unit are looked up ignoring case.
+	for name, units := range folded {
+		if len(units) == 1 {
+			byFoldedSymbol[name] = units[0]
+		}
+	}
+}
+
+func appendUnique(units []Unit, u Unit) []Unit {
+	for _, existing := range units {
+		if existing == u {
+			return units
+		}
+	}
+
+	return append(units, u)
+}
@@ -0,0 +1,161 @@
+// Package units converts measurements between the units attributes are recorded in. It covers the
+// quantities that come up most in materials science: temperature, length, time, pressure, energy, mass
+// and concentration.
+//
+// Every unit belongs to a Dimension and is defined relative to that dimension's base unit, so a value
+// can be converted between any two units of the same dimension. Units are looked up by symbol or name,
+// see Lookup.
+package units
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Dimension is the kind of quantity a unit measures. Only units with the same dimension can be converted
+// between each other.
+type Dimension string
+
+const (
+	Temperature Dimension = "temperature" // base unit K
+	Length      Dimension = "length"      // base unit m
+	Time        Dimension = "time"        // base unit s
+	Pressure    Dimension = "pressure"    // base unit Pa
+	Energy      Dimension = "energy"      // base unit J
+	Mass        Dimension = "mass"        // base unit kg
+
+	// Concentrations are split by what they are a fraction of, as converting between them requires
+	// knowing the composition.
+	Fraction            Dimension = "fraction"             // base unit 1 (unitless ratio)
+	MassFraction        Dimension = "mass fraction"        // base unit wt%
+	AtomicFraction      Dimension = "atomic fraction"      // base unit at%
+	MolarConcentration  Dimension = "molar concentration"  // base unit mol/m^3
+	MolarFraction       Dimension = "molar fraction"       // base unit mol%
+	VolumeFraction      Dimension = "volume fraction"      // base unit vol%
+	MassConcentration   Dimension = "mass concentration"   // base unit kg/m^3
+	AmountOfSubstance   Dimension = "amount of substance"  // base unit mol
+	NumberConcentration Dimension = "number concentration" // base unit 1/m^3
+)
+
+// Unit is a unit of measure. A value v in the unit is v*Scale + Offset in its dimension's base unit.
+type Unit struct {
+	Symbol    string
+	Dimension Dimension
+	Scale     float64
+	Offset    float64
+}
+
+// ToBase converts value in u to the base unit of u's dimension.
+func (u Unit) ToBase(value float64) float64 {
+	return value*u.Scale + u.Offset
+}
+
+// FromBase converts value in the base unit of u's dimension to u.
+func (u Unit) FromBase(value float64) float64 {
+	return (value - u.Offset) / u.Scale
+}
+
+var (
+	// ErrUnknownUnit is returned for a unit that isn't known.
+	ErrUnknownUnit = errors.New("unknown unit")
+
+	// ErrIncompatible is returned when converting between units with different dimensions.
+	ErrIncompatible = errors.New("incompatible units")
+)
+
+// Lookup finds the unit for s. Surrounding white space is ignored, as is a "°" or "deg" before a
+// temperature unit. Symbols are case-sensitive ("Mm" isn't "mm"), but when s doesn't match a symbol
+// exactly it is matched ignoring case, as long as that leaves only one possible unit. So "mpa" is MPa
+// and "c" is °C, while "mev" is ambiguous between MeV and meV and isn't found.
+func Lookup(s string) (Unit, bool) {
+	s = normalizeSymbol(s)
+	if u, ok := bySymbol[s]; ok {
+		return u, true
+	}
+
+	u, ok := byFoldedSymbol[strings.ToLower(s)]
+	return u, ok
+}
+
+// MustLookup is Lookup for units known to exist. It panics if s isn't found.
+func MustLookup(s string) Unit {
+	u, ok := Lookup(s)
+	if !ok {
+		panic(fmt.Sprintf("units: unknown unit %q", s))
+	}
+
+	return u
+}
+
+// Convert converts value from one unit to another.
+func Convert(value float64, from, to string) (float64, error) {
+	fromUnit, toUnit, err := lookupPair(from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	if fromUnit == toUnit {
+		return value, nil
+	}
+
+	return toUnit.FromBase(fromUnit.ToBase(value)), nil
+}
+
+// Normalize converts value in unit to the base unit of the unit's dimension, returning the base unit
+// along with the converted value.
+func Normalize(value float64, unit string) (float64, Unit, error) {
+	u, ok := Lookup(unit)
+	if !ok {
+		return 0, Unit{}, fmt.Errorf("%w %q", ErrUnknownUnit, unit)
+	}
+
+	return u.ToBase(value), baseUnits[u.Dimension], nil
+}
+
+// Compatible returns nil if values can be converted between the two units, and an error wrapping
+// ErrUnknownUnit or ErrIncompatible if they can't.
+func Compatible(from, to string) error {
+	_, _, err := lookupPair(from, to)
+	return err
+}
+
+func lookupPair(from, to string) (Unit, Unit, error) {
+	fromUnit, ok := Lookup(from)
+	if !ok {
+		return Unit{}, Unit{}, fmt.Errorf("%w %q", ErrUnknownUnit, from)
+	}
+
+	toUnit, ok := Lookup(to)
+	if !ok {
+		return Unit{}, Unit{}, fmt.Errorf("%w %q", ErrUnknownUnit, to)
+	}
+
+	if fromUnit.Dimension != toUnit.Dimension {
+		return Unit{}, Unit{}, fmt.Errorf("%w: %s is a %s and %s is a %s", ErrIncompatible,
+			fromUnit.Symbol, fromUnit.Dimension, toUnit.Symbol, toUnit.Dimension)
+	}
+
+	return fromUnit, toUnit, nil
+}
+
+func normalizeSymbol(s string) string {
+	s = strings.TrimSpace(s)
+	for _, prefix := range []string{"°", "º", "deg ", "deg.", "deg"} {
+		// Only strip the prefix from temperatures, "degree" alone stays as is.
+		if rest := strings.TrimSpace(strings.TrimPrefix(s, prefix)); rest != s && isTemperatureLetter(rest) {
+			return rest
+		}
+	}
+
+	return s
+}
+
+func isTemperatureLetter(s string) bool {
+	switch s {
+	case "C", "c", "F", "f", "K", "k":
+		return true
+	}
+
+	return false
+}
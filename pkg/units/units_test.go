@@ -0,0 +1,118 @@
+package units
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		value    float64
+		from, to string
+		expected float64
+	}{
+		{500, "C", "K", 773.15},
+		{773.15, "K", "°C", 500},
+		{212, "F", "C", 100},
+		{-40, "°F", "deg C", -40},
+		{0, "K", "°R", 0},
+		{1, "mm", "µm", 1000},
+		{25, "um", "mm", 0.025},
+		{1, "in", "cm", 2.54},
+		{3, "nm", "Å", 30},
+		{2, "h", "min", 120},
+		{1, "day", "s", 86400},
+		{1, "GPa", "MPa", 1000},
+		{1, "atm", "kPa", 101.325},
+		{1, "ksi", "MPa", 6.894757293168},
+		{1, "eV", "J", 1.602176634e-19},
+		{1, "kcal", "kJ", 4.184},
+		{1, "kg", "g", 1000},
+		{1, "lb", "kg", 0.45359237},
+		{5, "%", "ppm", 50000},
+		{0.5, "wt%", "ppmw", 5000},
+		{2, "at%", "ppma", 20000},
+		{1, "M", "mM", 1000},
+		{1, "g/cm3", "kg/m^3", 1000},
+	}
+
+	for _, test := range tests {
+		actual, err := Convert(test.value, test.from, test.to)
+		require.NoError(t, err, "%v %s -> %s", test.value, test.from, test.to)
+		require.InDelta(t, test.expected, actual, 1e-9*max(1, abs(test.expected)), "%v %s -> %s", test.value, test.from, test.to)
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	_, err := Convert(1, "K", "mm")
+	require.True(t, errors.Is(err, ErrIncompatible))
+
+	_, err = Convert(1, "wt%", "at%")
+	require.True(t, errors.Is(err, ErrIncompatible))
+
+	_, err = Convert(1, "furlong", "m")
+	require.True(t, errors.Is(err, ErrUnknownUnit))
+
+	_, err = Convert(1, "m", "")
+	require.True(t, errors.Is(err, ErrUnknownUnit))
+
+	require.NoError(t, Compatible("MPa", "psi"))
+	require.Error(t, Compatible("MPa", "eV"))
+}
+
+func TestLookup(t *testing.T) {
+	for symbol, expected := range map[string]string{
+		"c":        "°C",
+		" °C ":     "°C",
+		"degC":     "°C",
+		"deg F":    "°F",
+		"kelvin":   "K",
+		"mpa":      "MPa",
+		"MPA":      "MPa",
+		"micron":   "µm",
+		"μm":       "µm",
+		"Hours":    "h",
+		"wt.%":     "wt%",
+		"at %":     "at%",
+		"Mm":       "",
+		"mev":      "",
+		"meV":      "meV",
+		"MeV":      "MeV",
+		"mm":       "mm",
+		"mM":       "mmol/L",
+		"degree":   "",
+		"furlongs": "",
+	} {
+		u, ok := Lookup(symbol)
+		if expected == "" {
+			require.False(t, ok, symbol)
+			continue
+		}
+		require.True(t, ok, symbol)
+		require.Equal(t, expected, u.Symbol, symbol)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	value, base, err := Normalize(25, "C")
+	require.NoError(t, err)
+	require.InDelta(t, 298.15, value, 1e-9)
+	require.Equal(t, "K", base.Symbol)
+
+	value, base, err = Normalize(2, "mmol/L")
+	require.NoError(t, err)
+	require.Equal(t, 2.0, value)
+	require.Equal(t, "mol/m^3", base.Symbol)
+
+	_, _, err = Normalize(1, "furlong")
+	require.Error(t, err)
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
@@ -246,6 +246,9 @@ func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) (status i
 		return http.StatusMethodNotAllowed, err
 	}
 	if err := h.FileSystem.RemoveAll(ctx, reqPath); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return http.StatusForbidden, err
+		}
 		return http.StatusMethodNotAllowed, err
 	}
 	return http.StatusNoContent, nil
@@ -267,6 +270,9 @@ func (h *Handler) handlePut(w http.ResponseWriter, r *http.Request) (status int,
 
 	f, err := h.FileSystem.OpenFile(ctx, reqPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return http.StatusForbidden, err
+		}
 		return http.StatusNotFound, err
 	}
 	_, copyErr := io.Copy(f, r.Body)
@@ -310,6 +316,9 @@ func (h *Handler) handleMkcol(w http.ResponseWriter, r *http.Request) (status in
 		if os.IsNotExist(err) {
 			return http.StatusConflict, err
 		}
+		if errors.Is(err, os.ErrPermission) {
+			return http.StatusForbidden, err
+		}
 		return http.StatusMethodNotAllowed, err
 	}
 	return http.StatusCreated, nil